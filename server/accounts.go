@@ -52,38 +52,43 @@ var maxSubLimitReportThreshold = defaultMaxSubLimitReportThreshold
 type Account struct {
 	stats
 	gwReplyMapping
-	Name         string
-	LogicalName  string
-	Nkey         string
-	Issuer       string
-	claimJWT     string
-	updated      time.Time
-	mu           sync.RWMutex
-	sqmu         sync.Mutex
-	sl           *Sublist
-	ic           *client
-	sq           *sendq
-	isid         uint64
-	etmr         *time.Timer
-	ctmr         *time.Timer
-	strack       map[string]sconns
-	nrclients    int32
-	sysclients   int32
-	nleafs       int32
-	nrleafs      int32
-	clients      map[*client]struct{}
-	rm           map[string]int32
-	lqws         map[string]int32
-	usersRevoked map[string]int64
-	mappings     []*mapping
-	hasMapped    atomic.Bool
-	lmu          sync.RWMutex
-	lleafs       []*client
-	leafClusters map[string]uint64
-	imports      importMap
-	exports      exportMap
-	js           *jsAccount
-	jsLimits     map[string]JetStreamAccountLimits
+	Name           string
+	LogicalName    string
+	Nkey           string
+	Issuer         string
+	claimJWT       string
+	updated        time.Time
+	mu             sync.RWMutex
+	sqmu           sync.Mutex
+	sl             *Sublist
+	ic             *client
+	sq             *sendq
+	isid           uint64
+	etmr           *time.Timer
+	ctmr           *time.Timer
+	strack         map[string]sconns
+	nrclients      int32
+	sysclients     int32
+	nleafs         int32
+	nrleafs        int32
+	clients        map[*client]struct{}
+	rm             map[string]int32
+	lqws           map[string]int32
+	usersRevoked   map[string]int64
+	mappings       []*mapping
+	hasMapped      atomic.Bool
+	lmu            sync.RWMutex
+	lleafs         []*client
+	leafClusters   map[string]uint64
+	imports        importMap
+	exports        exportMap
+	js             *jsAccount
+	jsLimits       map[string]JetStreamAccountLimits
+	nrgWeight      int           // Weight of the raft proposals of this account when they are scheduled.
+	jsSyncInterval time.Duration // Default sync interval of the file based streams of this account.
+	jsReadAhead    int64         // Memory budget of the blocks read ahead for the streams of this account.
+	jsIndexDir     string        // Directory the indexes of the streams of this account are placed in.
+	jsFrozen       time.Time     // Set while the creation of new jetstream assets is frozen.
 	limits
 	expired      atomic.Bool
 	incomplete   bool
@@ -334,6 +339,10 @@ func (a *Account) shallowCopy(na *Account) {
 
 	// JetStream
 	na.jsLimits = a.jsLimits
+	na.nrgWeight = a.nrgWeight
+	na.jsSyncInterval = a.jsSyncInterval
+	na.jsReadAhead = a.jsReadAhead
+	na.jsIndexDir = a.jsIndexDir
 	// Server config account limits.
 	na.limits = a.limits
 }
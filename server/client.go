@@ -4291,6 +4291,7 @@ func getHeader(key string, hdr []byte) []byte {
 var (
 	jsRequestNextPreB = []byte(jsRequestNextPre)
 	jsDirectGetPreB   = []byte(jsDirectGetPre)
+	jsReadReplicaPreB = []byte(jsReadReplicaPre)
 )
 
 // processServiceImport is an internal callback when a subscription matches an imported service
@@ -4314,7 +4315,8 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 	var checkJS bool
 	shouldReturn := si.invalid || acc.sl == nil
 	if !shouldReturn && !isResponse && si.to == jsAllAPI {
-		if bytes.HasPrefix(c.pa.subject, jsDirectGetPreB) || bytes.HasPrefix(c.pa.subject, jsRequestNextPreB) {
+		if bytes.HasPrefix(c.pa.subject, jsDirectGetPreB) || bytes.HasPrefix(c.pa.subject, jsRequestNextPreB) ||
+			bytes.HasPrefix(c.pa.subject, jsReadReplicaPreB) {
 			checkJS = true
 		}
 	}
@@ -4323,7 +4325,7 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 	acc.mu.RUnlock()
 
 	// We have a special case where JetStream pulls in all service imports through one export.
-	// However the GetNext for consumers and DirectGet for streams are a no-op and causes buildups of service imports,
+	// However the GetNext for consumers, DirectGet and read replica requests for streams are a no-op and causes buildups of service imports,
 	// response service imports and rrMap entries which all will need to simply expire.
 	// TODO(dlc) - Come up with something better.
 	if shouldReturn || (checkJS && si.se != nil && si.se.acc == c.srv.SystemAccount()) {
@@ -4377,6 +4379,9 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 	// Copy our pubArg since this gets modified as we process the service import itself.
 	pacopy := c.pa
 
+	// A chunk of a chunked JetStream API response is followed by more responses.
+	isRespChunk := isResponse && c.pa.hdr > 0 && len(getHeader(JSResponseChunk, msg[:c.pa.hdr])) > 0
+
 	// Now check to see if this account has mappings that could affect the service import.
 	// Can't use non-locked trick like in processInboundClientMsg, so just call into selectMappedSubject
 	// so we only lock once.
@@ -4510,8 +4515,8 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 
 	// Determine if we should remove this service import. This is for response service imports.
 	// We will remove if we did not deliver, or if we are a response service import and we are
-	// a singleton, or we have an EOF message.
-	shouldRemove := !didDeliver || (isResponse && (si.rt == Singleton || len(msg) == LEN_CR_LF))
+	// a singleton that is not a chunk of a chunked response, or we have an EOF message.
+	shouldRemove := !didDeliver || (isResponse && ((si.rt == Singleton && !isRespChunk) || len(msg) == LEN_CR_LF))
 	// If we are tracking and we did not actually send the latency info we need to suppress the removal.
 	if si.tracking && !didSendTL {
 		shouldRemove = false
@@ -15,10 +15,13 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"container/heap"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"slices"
@@ -28,6 +31,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/nats-io/nats-server/v2/server/avl"
 	"github.com/nats-io/nuid"
 	"golang.org/x/time/rate"
@@ -57,6 +61,8 @@ type ConsumerInfo struct {
 	PushBound      bool            `json:"push_bound,omitempty"`
 	Paused         bool            `json:"paused,omitempty"`
 	PauseRemaining time.Duration   `json:"pause_remaining,omitempty"`
+	// PullStats are reported by the leader of a pull consumer.
+	PullStats *ConsumerPullStats `json:"pull_stats,omitempty"`
 	// TimeStamp indicates when the info was gathered
 	TimeStamp time.Time `json:"ts"`
 }
@@ -104,11 +110,41 @@ type ConsumerConfig struct {
 	// Don't add to general clients.
 	Direct bool `json:"direct,omitempty"`
 
+	// Shared allows the filters of this consumer to overlap with those of other shared
+	// consumers on a WorkQueue stream. Each message is owned by the first of them it is delivered to.
+	Shared bool `json:"shared,omitempty"`
+
 	// Metadata is additional metadata for the Consumer.
 	Metadata map[string]string `json:"metadata,omitempty"`
 
 	// PauseUntil is for suspending the consumer until the deadline.
 	PauseUntil *time.Time `json:"pause_until,omitempty"`
+
+	// DeliverOrder is the order in which a pull consumer on a WorkQueue stream delivers new messages.
+	DeliverOrder DeliverOrder `json:"deliver_order,omitempty"`
+	// OrderHeader is the numeric header that orders the messages with DeliverOrderHeader.
+	OrderHeader string `json:"order_header,omitempty"`
+
+	// Compression of message payloads on delivery. Stored messages are not affected.
+	Compression DeliverCompression `json:"compression,omitempty"`
+	// CompressMinSize is the payload size from which on payloads are compressed.
+	CompressMinSize int `json:"compress_min_size,omitempty"`
+
+	// ProgressHeartbeats lets clients send heartbeats on the progress subject of the consumer
+	// to mark all messages delivered to them as in progress, instead of acking each with +WPI.
+	ProgressHeartbeats bool `json:"progress_heartbeats,omitempty"`
+
+	// ReplaySpeed scales the original timing of ReplayOriginal, e.g. 2 replays twice as fast
+	// and 0.5 at half the speed. Replay can be paused and resumed on the replay subject.
+	ReplaySpeed float64 `json:"replay_speed,omitempty"`
+
+	// Protected consumers can only be deleted with force, and are recreated from their
+	// configuration when their state is lost instead of silently starting over.
+	Protected bool `json:"protected,omitempty"`
+
+	// SLAReportInterval is how often the leader publishes an aggregated report of the ack times
+	// and redeliveries of the consumer, as a cheaper alternative to sampling individual acks.
+	SLAReportInterval time.Duration `json:"sla_report_interval,omitempty"`
 }
 
 // SequenceInfo has both the consumer and the stream sequence and last activity.
@@ -189,6 +225,35 @@ type ConsumerNakOptions struct {
 	Delay time.Duration `json:"delay"`
 }
 
+// DeliverOrder determines the order in which a pull consumer delivers new messages.
+type DeliverOrder string
+
+const (
+	// DeliverOrderFIFO delivers the oldest messages first. This is the default.
+	DeliverOrderFIFO = DeliverOrder("fifo")
+	// DeliverOrderLIFO delivers the newest messages first.
+	DeliverOrderLIFO = DeliverOrder("lifo")
+	// DeliverOrderHeader delivers the messages with the lowest value of the order header first,
+	// and the oldest first amongst equal values. Messages without a numeric value come last.
+	DeliverOrderHeader = DeliverOrder("header")
+)
+
+// DeliverCompression determines how a consumer compresses message payloads on delivery.
+// Compressed messages carry the algorithm in the Content-Encoding header.
+type DeliverCompression string
+
+const (
+	// DeliverCompressionNone delivers payloads as they were stored. This is the default.
+	DeliverCompressionNone = DeliverCompression("none")
+	// DeliverCompressionS2 compresses payloads with the s2 block format.
+	DeliverCompressionS2 = DeliverCompression("s2")
+	// DeliverCompressionGzip compresses payloads with gzip.
+	DeliverCompressionGzip = DeliverCompression("gzip")
+)
+
+// Payloads smaller than this are delivered uncompressed unless configured otherwise.
+const defaultCompressMinSize = 1024
+
 // DeliverPolicy determines how the consumer should select the first message to deliver.
 type DeliverPolicy int
 
@@ -205,6 +270,9 @@ const (
 	DeliverByStartTime
 	// DeliverLastPerSubject will start the consumer with the last message for all subjects received.
 	DeliverLastPerSubject
+	// DeliverByStartEventTime will select the first message with an event time >= to StartTime.
+	// The stream needs an event time header.
+	DeliverByStartEventTime
 )
 
 func (dp DeliverPolicy) String() string {
@@ -221,6 +289,8 @@ func (dp DeliverPolicy) String() string {
 		return "by_start_time"
 	case DeliverLastPerSubject:
 		return "last_per_subject"
+	case DeliverByStartEventTime:
+		return "by_start_event_time"
 	default:
 		return "undefined"
 	}
@@ -285,6 +355,8 @@ var (
 	AckNext = []byte("+NXT")
 	// Terminate delivery of the message.
 	AckTerm = []byte("+TERM")
+	// Ack the message and all pending messages before it.
+	AckCumulative = []byte("+ACKCUM")
 )
 
 const (
@@ -334,9 +406,16 @@ type consumer struct {
 	dsubj             string
 	qgroup            string
 	lss               *lastSeqSkipList
+	ord               *orderedMsgs // Messages not yet delivered when not in FIFO order.
+	released          []uint64     // Messages skipped for another shared consumer that no longer owns them.
 	rlimit            *rate.Limiter
 	reqSub            *subscription
 	ackSub            *subscription
+	progSub           *subscription     // Progress heartbeats from clients.
+	powners           map[uint64]string // Delivery subjects of pending messages, for progress heartbeats.
+	pstats            ConsumerPullStats // Pull request accounting, leader only.
+	replaySub         *subscription     // Pause and resume of replay.
+	rpause            chan struct{}     // Closed when a paused replay is resumed.
 	ackReplyT         string
 	ackSubj           string
 	nextMsgSubj       string
@@ -370,6 +449,8 @@ type consumer struct {
 	qch               chan struct{} // Quit channel
 	inch              chan bool     // Interest change channel
 	sfreq             int32
+	sla               *consumerSLA
+	slatmr            *time.Timer
 	ackEventT         string
 	nakEventT         string
 	deliveryExcEventT string
@@ -387,6 +468,7 @@ type consumer struct {
 	prm       map[string]struct{}
 	prOk      bool
 	uch       chan struct{}
+	wcch      chan chan struct{} // Requests to compact the WAL, for the monitor routine.
 	retention RetentionPolicy
 
 	monitorWg sync.WaitGroup
@@ -467,7 +549,8 @@ func setConsumerConfigDefaults(config *ConsumerConfig, streamCfg *StreamConfig,
 		}
 		config.MaxAckPending = streamCfg.ConsumerLimits.MaxAckPending
 	}
-	if config.InactiveThreshold == 0 {
+	// Protected consumers do not go away when inactive.
+	if config.InactiveThreshold == 0 && !config.Protected {
 		if pedantic && streamCfg.ConsumerLimits.InactiveThreshold > 0 {
 			return NewJSPedanticError(errors.New("inactive_threshold must be set if it's configured in stream limits"))
 		}
@@ -508,6 +591,98 @@ func checkConsumerCfg(
 	if config.Replicas > 0 && config.Replicas > cfg.Replicas {
 		return NewJSConsumerReplicasExceedsStreamError()
 	}
+
+	// Shared consumers are arbitrated by the stream on the server that delivers the
+	// messages, so they need a WorkQueue stream that is not replicated.
+	if config.Shared {
+		if cfg.Retention != WorkQueuePolicy {
+			return NewJSConsumerSharedRequiresWorkQueueError()
+		}
+		if cfg.Replicas > 1 {
+			return NewJSConsumerSharedReplicatedStreamError()
+		}
+	}
+
+	// Delivery orders other than FIFO pick from all messages not yet delivered, which
+	// the stream only tells apart from acknowledged ones with WorkQueue retention.
+	switch config.DeliverOrder {
+	case _EMPTY_, DeliverOrderFIFO:
+		if config.OrderHeader != _EMPTY_ {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("order header requires header delivery order"))
+		}
+	case DeliverOrderLIFO, DeliverOrderHeader:
+		if cfg.Retention != WorkQueuePolicy {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("requires a stream with WorkQueue retention"))
+		}
+		if config.DeliverSubject != _EMPTY_ {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("only supported by pull consumers"))
+		}
+		if config.DeliverOrder == DeliverOrderHeader && config.OrderHeader == _EMPTY_ {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("header delivery order requires an order header"))
+		}
+		if config.DeliverOrder == DeliverOrderLIFO && config.OrderHeader != _EMPTY_ {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("order header requires header delivery order"))
+		}
+		// Acknowledging all up to a message would take older ones not delivered yet with it.
+		if config.AckPolicy == AckAll {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("not supported with ack all policy"))
+		}
+		// The messages not delivered yet are only known to the server delivering them,
+		// so the ack floor can not be kept below them by the replicas.
+		if cfg.Replicas > 1 {
+			return NewJSConsumerDeliverOrderInvalidError(errors.New("not supported on replicated streams"))
+		}
+	default:
+		return NewJSConsumerDeliverOrderInvalidError(fmt.Errorf("unknown delivery order %q", config.DeliverOrder))
+	}
+
+	if config.ReplaySpeed < 0 || math.IsNaN(config.ReplaySpeed) || math.IsInf(config.ReplaySpeed, 0) {
+		return NewJSConsumerReplaySpeedInvalidError(errors.New("must be a positive number"))
+	}
+	if config.ReplaySpeed > 0 && config.ReplayPolicy != ReplayOriginal {
+		return NewJSConsumerReplaySpeedInvalidError(errors.New("requires original replay policy"))
+	}
+
+	// Protected consumers are meant to stay, so they can not be ephemeral or expire.
+	if config.Protected {
+		if !isDurableConsumer(config) {
+			return NewJSConsumerProtectedInvalidError(errors.New("requires a durable consumer"))
+		}
+		if config.InactiveThreshold > 0 {
+			return NewJSConsumerProtectedInvalidError(errors.New("inactive threshold is not allowed"))
+		}
+	}
+
+	// Progress only delays redelivery of messages that need an ack.
+	if config.ProgressHeartbeats && config.AckPolicy == AckNone {
+		return NewJSConsumerProgressHeartbeatsRequiresAckError()
+	}
+
+	// SLA reports are built from acks.
+	if config.SLAReportInterval != 0 {
+		if config.SLAReportInterval < minConsumerSLAReportInterval {
+			return NewJSConsumerInvalidPolicyError(fmt.Errorf("sla report interval can not be less than %v", minConsumerSLAReportInterval))
+		}
+		if config.AckPolicy == AckNone {
+			return NewJSConsumerInvalidPolicyError(errors.New("sla reports require an ack policy"))
+		}
+	}
+
+	switch config.Compression {
+	case _EMPTY_, DeliverCompressionNone:
+		if config.CompressMinSize != 0 {
+			return NewJSConsumerCompressionInvalidError(errors.New("compress min size requires compression"))
+		}
+	case DeliverCompressionS2, DeliverCompressionGzip:
+		if config.CompressMinSize < 0 {
+			return NewJSConsumerCompressionInvalidError(errors.New("compress min size can not be negative"))
+		}
+		if config.HeadersOnly {
+			return NewJSConsumerCompressionInvalidError(errors.New("headers only consumers have no payload to compress"))
+		}
+	default:
+		return NewJSConsumerCompressionInvalidError(fmt.Errorf("unknown compression %q", config.Compression))
+	}
 	// Check that it is not negative
 	if config.Replicas < 0 {
 		return NewJSReplicasCountCannotBeNegativeError()
@@ -688,6 +863,16 @@ func checkConsumerCfg(
 		if config.OptStartSeq != 0 {
 			return NewJSConsumerInvalidPolicyError(badStart("by start time", "start sequence"))
 		}
+	case DeliverByStartEventTime:
+		if config.OptStartTime == nil {
+			return NewJSConsumerInvalidPolicyError(notSet("by start event time", "start time"))
+		}
+		if config.OptStartSeq != 0 {
+			return NewJSConsumerInvalidPolicyError(badStart("by start event time", "start sequence"))
+		}
+		if cfg.EventTimeHeader == _EMPTY_ {
+			return NewJSConsumerInvalidPolicyError(errors.New("consumer delivery policy is deliver by start event time, but stream has no event time header"))
+		}
 	}
 
 	if config.SampleFrequency != _EMPTY_ {
@@ -808,7 +993,7 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 			// Check for overlapping subjects if we are a workqueue
 			if cfg.Retention == WorkQueuePolicy {
 				subjects := gatherSubjectFilters(config.FilterSubject, config.FilterSubjects)
-				if !mset.partitionUnique(cName, subjects) {
+				if !mset.partitionUnique(cName, subjects, config.Shared) {
 					return nil, NewJSConsumerWQConsumerNotUniqueError()
 				}
 			}
@@ -847,10 +1032,10 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 
 		if len(mset.consumers) > 0 {
 			subjects := gatherSubjectFilters(config.FilterSubject, config.FilterSubjects)
-			if len(subjects) == 0 {
+			if len(subjects) == 0 && !config.Shared {
 				mset.mu.Unlock()
 				return nil, NewJSConsumerWQMultipleUnfilteredError()
-			} else if !mset.partitionUnique(cName, subjects) {
+			} else if !mset.partitionUnique(cName, subjects, config.Shared) {
 				// Prior to v2.9.7, on a stream with WorkQueue policy, the servers
 				// were not catching the error of having multiple consumers with
 				// overlapping filter subjects depending on the scope, for instance
@@ -892,6 +1077,7 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 		active:    true,
 		qch:       make(chan struct{}),
 		uch:       make(chan struct{}, 1),
+		wcch:      make(chan chan struct{}, 1),
 		mch:       make(chan struct{}, 1),
 		sfreq:     int32(sampleFreq),
 		maxdc:     uint64(config.MaxDeliver),
@@ -985,7 +1171,9 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 	if o.store != nil && o.store.HasState() {
 		// Restore our saved state.
 		o.mu.Lock()
-		o.readStoredState(0)
+		if err := o.readStoredState(0); err != nil && o.cfg.Protected {
+			o.recreateLostState(err)
+		}
 		o.mu.Unlock()
 	} else {
 		// Select starting sequence number
@@ -1254,7 +1442,14 @@ func (o *consumer) setLeader(isLeader bool) {
 		o.rdqi.Empty()
 
 		// Restore our saved state. During non-leader status we just update our underlying store.
-		o.readStoredState(lseq)
+		if err := o.readStoredState(lseq); err != nil && o.cfg.Protected {
+			o.recreateLostState(err)
+		}
+
+		// When not in FIFO order we have to look again at all messages not yet acknowledged.
+		if o.isOrdered() {
+			o.resetOrdered()
+		}
 
 		// Setup initial num pending.
 		o.streamNumPending()
@@ -1285,6 +1480,24 @@ func (o *consumer) setLeader(isLeader bool) {
 			}
 		}
 
+		if o.cfg.ProgressHeartbeats {
+			psubj := fmt.Sprintf(jsAckProgressT, stream, o.name)
+			if o.progSub, err = o.subscribeInternal(psubj, o.processProgressHeartbeat); err != nil {
+				o.mu.Unlock()
+				o.deleteWithoutAdvisory()
+				return
+			}
+		}
+
+		if o.cfg.ReplayPolicy == ReplayOriginal {
+			rsubj := fmt.Sprintf(jsReplayControlT, stream, o.name)
+			if o.replaySub, err = o.subscribeInternal(rsubj, o.processReplayControl); err != nil {
+				o.mu.Unlock()
+				o.deleteWithoutAdvisory()
+				return
+			}
+		}
+
 		// Setup the internal sub for next message requests regardless.
 		// Will error if wrong mode to provide feedback to users.
 		if o.reqSub, err = o.subscribeInternal(o.nextMsgSubj, o.processNextMsgReq); err != nil {
@@ -1331,6 +1544,12 @@ func (o *consumer) setLeader(isLeader bool) {
 		// Update the consumer pause tracking.
 		o.updatePauseState(&o.cfg)
 
+		// Pull statistics are only kept by the leader.
+		o.pstats = ConsumerPullStats{}
+
+		// So are the SLA reports.
+		o.resetSLA()
+
 		// If we are not in ReplayInstant mode mark us as in replay state until resolved.
 		if o.cfg.ReplayPolicy != ReplayInstant {
 			o.replay = true
@@ -1405,14 +1624,20 @@ func (o *consumer) setLeader(isLeader bool) {
 		stopAndClearTimer(&o.uptmr)
 		// Make sure to clear out any re-deliver queues
 		stopAndClearTimer(&o.ptmr)
+		// Stop the SLA reports, only published by leaders.
+		stopAndClearTimer(&o.slatmr)
+		o.sla = nil
 		o.rdq = nil
 		o.rdqi.Empty()
-		o.pending = nil
+		o.pending, o.powners = nil, nil
 		// ok if they are nil, we protect inside unsubscribe()
 		o.unsubscribe(o.ackSub)
 		o.unsubscribe(o.reqSub)
 		o.unsubscribe(o.fcSub)
-		o.ackSub, o.reqSub, o.fcSub = nil, nil, nil
+		o.unsubscribe(o.progSub)
+		o.unsubscribe(o.replaySub)
+		o.ackSub, o.reqSub, o.fcSub, o.progSub, o.replaySub = nil, nil, nil, nil, nil
+		o.rpause = nil
 		if o.infoSub != nil {
 			o.srv.sysUnsubscribe(o.infoSub)
 			o.infoSub = nil
@@ -1902,6 +2127,12 @@ func (acc *Account) checkNewConsumerConfig(cfg, ncfg *ConsumerConfig) error {
 	if cfg.AckPolicy != ncfg.AckPolicy {
 		return errors.New("ack policy can not be updated")
 	}
+	if cfg.Shared != ncfg.Shared {
+		return errors.New("shared can not be updated")
+	}
+	if cfg.DeliverOrder != ncfg.DeliverOrder || cfg.OrderHeader != ncfg.OrderHeader {
+		return errors.New("delivery order can not be updated")
+	}
 	if cfg.ReplayPolicy != ncfg.ReplayPolicy {
 		return errors.New("replay policy can not be updated")
 	}
@@ -1911,6 +2142,9 @@ func (acc *Account) checkNewConsumerConfig(cfg, ncfg *ConsumerConfig) error {
 	if cfg.FlowControl != ncfg.FlowControl {
 		return errors.New("flow control can not be updated")
 	}
+	if cfg.ProgressHeartbeats != ncfg.ProgressHeartbeats {
+		return errors.New("progress heartbeats can not be updated")
+	}
 	if cfg.MaxWaiting != ncfg.MaxWaiting {
 		return errors.New("max waiting can not be updated")
 	}
@@ -2057,10 +2291,17 @@ func (o *consumer) updateConfig(cfg *ConsumerConfig) error {
 		}
 	}
 
+	// Restart the SLA reports if their interval changed.
+	resetSLA := cfg.SLAReportInterval != o.cfg.SLAReportInterval
+
 	// Record new config for others that do not need special handling.
 	// Allowed but considered no-op, [Description, SampleFrequency, MaxWaiting, HeadersOnly]
 	o.cfg = *cfg
 
+	if resetSLA && o.isLeader() {
+		o.resetSLA()
+	}
+
 	// Cleanup messages that lost interest.
 	if o.retention == InterestPolicy {
 		o.mu.Unlock()
@@ -2174,6 +2415,11 @@ func (o *consumer) processAck(subject, reply string, hdr int, rmsg []byte) {
 			// We handle replies for acks in updateAcks
 			skipAckReply = true
 		}
+	case bytes.Equal(msg, AckCumulative):
+		if !o.processCumulativeAck(sseq, dseq, dc, reply) {
+			// We handle replies for acks in updateAcks
+			skipAckReply = true
+		}
 	case bytes.HasPrefix(msg, AckNext):
 		o.processAckMsg(sseq, dseq, dc, _EMPTY_, true)
 		o.processNextMsgRequest(reply, msg[len(AckNext):])
@@ -2211,6 +2457,86 @@ func (o *consumer) progressUpdate(seq uint64) {
 	}
 }
 
+// Remembers the subject a pending message was delivered to, for progress heartbeats.
+// Lock should be held.
+func (o *consumer) trackOwner(sseq uint64, dsubj string) {
+	if o.powners == nil {
+		o.powners = make(map[uint64]string)
+	}
+	o.powners[sseq] = dsubj
+}
+
+// Processes a heartbeat on the progress subject, which marks the pending messages that were
+// delivered to the subject in the payload as in progress, like a +WPI ack for each would.
+// The subject can have wildcards, e.g. for the inbox of a pull subscription, and an empty
+// payload marks all pending messages of the consumer.
+func (o *consumer) processProgressHeartbeat(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	_, msg := c.msgParts(rmsg)
+	owner := string(bytes.TrimSpace(msg))
+	if owner != _EMPTY_ && !IsValidSubject(owner) {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for seq, dsubj := range o.powners {
+		p, ok := o.pending[seq]
+		if !ok {
+			delete(o.powners, seq)
+			continue
+		}
+		if owner != _EMPTY_ && !subjectIsSubsetMatch(dsubj, owner) {
+			continue
+		}
+		// Messages on the redelivery queue are already expired.
+		if o.onRedeliverQueue(seq) {
+			continue
+		}
+		p.Timestamp = now
+		o.updateDelivered(p.Sequence, seq, 1, p.Timestamp)
+	}
+}
+
+// ConsumerReplayState is the reply to a request on the replay subject of a consumer.
+type ConsumerReplayState struct {
+	Replaying bool    `json:"replaying"`
+	Paused    bool    `json:"paused"`
+	Speed     float64 `json:"speed,omitempty"`
+}
+
+// Processes a request on the replay subject. A PAUSE payload holds the replay before the
+// next message and RESUME continues it, an empty payload only reports the state.
+// The pause is kept by the leader only, a new leader resumes the replay.
+func (o *consumer) processReplayControl(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	_, msg := c.msgParts(rmsg)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch cmd := strings.ToUpper(string(bytes.TrimSpace(msg))); cmd {
+	case "PAUSE":
+		if o.rpause == nil {
+			o.rpause = make(chan struct{})
+		}
+	case "RESUME":
+		if o.rpause != nil {
+			close(o.rpause)
+			o.rpause = nil
+		}
+	case _EMPTY_:
+	default:
+		return
+	}
+	if reply == _EMPTY_ {
+		return
+	}
+	state := ConsumerReplayState{Replaying: o.replay, Paused: o.rpause != nil, Speed: o.cfg.ReplaySpeed}
+	b, _ := json.Marshal(&state)
+	o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, b, nil, 0))
+}
+
 // Lock should be held.
 func (o *consumer) updateSkipped(seq uint64) {
 	// Clustered mode and R>1 only.
@@ -2346,7 +2672,38 @@ func (o *consumer) updateAcks(dseq, sseq uint64, reply string) {
 			o.addAckReply(sseq, reply)
 		}
 	} else if o.store != nil {
-		o.store.UpdateAcks(dseq, sseq)
+		// The store would move the floor past the messages not delivered yet.
+		if o.limitsAckFloor() {
+			o.writeStoreStateUnlocked()
+		} else {
+			o.store.UpdateAcks(dseq, sseq)
+		}
+		if reply != _EMPTY_ {
+			// Already locked so send direct.
+			o.outq.sendMsg(reply, nil)
+		}
+	}
+	// Update activity.
+	o.lat = time.Now()
+}
+
+// Lock should be held.
+func (o *consumer) updateAcksUpTo(sseq uint64, reply string) {
+	if o.node != nil {
+		var b [binary.MaxVarintLen64 + 1]byte
+		b[0] = byte(updateAcksUpToOp)
+		n := 1 + binary.PutUvarint(b[1:], sseq)
+		o.propose(b[:n])
+		if reply != _EMPTY_ {
+			o.addAckReply(sseq, reply)
+		}
+	} else if o.store != nil {
+		// The store would move the floor past the messages not delivered yet.
+		if o.limitsAckFloor() {
+			o.writeStoreStateUnlocked()
+		} else {
+			o.store.UpdateAcksUpTo(sseq)
+		}
 		if reply != _EMPTY_ {
 			// Already locked so send direct.
 			o.outq.sendMsg(reply, nil)
@@ -2625,10 +2982,53 @@ func (o *consumer) readStoredState(slseq uint64) error {
 		if len(o.rdc) > 0 {
 			o.checkRedelivered(slseq)
 		}
+		// Claims are not stored, we own what we have pending.
+		if o.cfg.Shared && o.mset != nil {
+			o.mset.claimPending(o.name, o.pending)
+		}
 	}
 	return err
 }
 
+// Recreates a protected consumer whose stored state could not be read from its configuration.
+// It starts at the earliest position the configuration allows, so no messages are skipped at
+// the cost of redelivering ones that were acknowledged before.
+// Lock should be held.
+func (o *consumer) recreateLostState(err error) {
+	o.srv.Warnf("JetStream protected consumer '%s > %s > %s' lost its state, recreating: %v", o.acc.Name, o.stream, o.name, err)
+
+	o.pending, o.rdc = nil, nil
+	// New and last deliveries start at the end of the stream and would skip what was not delivered.
+	dp := o.cfg.DeliverPolicy
+	switch dp {
+	case DeliverNew, DeliverLast, DeliverLastPerSubject:
+		o.cfg.DeliverPolicy = DeliverAll
+	}
+	o.selectStartingSeqNo()
+	o.cfg.DeliverPolicy = dp
+
+	e := JSConsumerRecreatedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerRecreatedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   o.stream,
+		Consumer: o.name,
+		StartSeq: o.sseq,
+		Error:    err.Error(),
+		Domain:   o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, merr := json.Marshal(e)
+	if merr != nil {
+		return
+	}
+
+	subj := JSAdvisoryConsumerRecreatedPre + "." + o.stream + "." + o.name
+	o.sendAdvisory(subj, j)
+}
+
 // Apply the consumer stored state.
 // Lock should be held.
 func (o *consumer) applyState(state *ConsumerState) {
@@ -2815,6 +3215,11 @@ func (o *consumer) infoWithSnapAndReply(snap bool, reply string) *ConsumerInfo {
 	if o.isPullMode() {
 		o.processWaiting(false)
 		info.NumWaiting = o.waiting.len()
+		if isLeader {
+			ps := o.pstats
+			ps.Problems = ps.problems()
+			info.PullStats = &ps
+		}
 	}
 	// If we were asked to snapshot do so here.
 	if snap {
@@ -2890,6 +3295,90 @@ func (o *consumer) sampleAck(sseq, dseq, dc uint64) {
 	o.sendAdvisory(o.ackEventT, j)
 }
 
+// Process a cumulative ACK, which acknowledges all pending messages up to and including
+// the stream sequence, so a client consuming in order only needs to ack the last of a batch.
+// Note that for explicit acks these are all pending messages, whichever client they were delivered to.
+// The ack floor is moved once and replicated as a single update.
+// Returns `true` if the acks were processed in place and the sender can now respond
+// to the client, or `false` if there was an error or the acks are replicated.
+func (o *consumer) processCumulativeAck(sseq, dseq, dc uint64, reply string) bool {
+	o.mu.Lock()
+	if o.cfg.AckPolicy != AckExplicit {
+		// AckAll is cumulative already.
+		o.mu.Unlock()
+		return o.processAckMsg(sseq, dseq, dc, reply, true)
+	}
+	if o.closed {
+		o.mu.Unlock()
+		return false
+	}
+
+	// Check if this ack is above the current pointer to our next to deliver.
+	if sseq >= o.sseq {
+		o.sseq = sseq + 1
+	}
+
+	mset := o.mset
+	if mset == nil || mset.closed.Load() {
+		o.mu.Unlock()
+		return false
+	}
+
+	// Same as for single acks, clustered consumers do this in processReplicatedAcksUpTo.
+	ackInPlace := o.node == nil && o.retention != LimitsPolicy
+
+	if p, ok := o.pending[sseq]; ok {
+		o.sampleAck(sseq, dseq, dc)
+		if o.sla != nil {
+			o.sla.ack(time.Now().UnixNano() - p.Timestamp)
+		}
+	}
+	needSignal := o.maxp > 0 && len(o.pending) >= o.maxp
+
+	var acked []uint64
+	var low uint64
+	for seq := range o.pending {
+		if seq <= sseq {
+			delete(o.pending, seq)
+			delete(o.rdc, seq)
+			o.removeFromRedeliverQueue(seq)
+			if ackInPlace {
+				acked = append(acked, seq)
+			}
+		} else if low == 0 || seq < low {
+			low = seq
+		}
+	}
+	// Move our floors up to just below the lowest message still pending.
+	if len(o.pending) == 0 {
+		o.adflr = o.dseq - 1
+		o.asflr = o.sseq - 1
+	} else if p := o.pending[low]; p.Sequence > 0 {
+		o.adflr, o.asflr = p.Sequence-1, low-1
+	}
+	if o.limitsAckFloor() {
+		if lim := o.ackFloorLimit(); o.asflr > lim {
+			o.asflr = lim
+		}
+	}
+
+	// The caller sends the reply if processed in place.
+	if ackInPlace {
+		reply = _EMPTY_
+	}
+	o.updateAcksUpTo(sseq, reply)
+	o.mu.Unlock()
+
+	slices.Sort(acked)
+	for _, seq := range acked {
+		mset.ackMsg(o, seq)
+	}
+	if needSignal {
+		o.signalNewMessages()
+	}
+	return ackInPlace
+}
+
 // Process an ACK.
 // Returns `true` if the ack was processed in place and the sender can now respond
 // to the client, or `false` if there was an error or the ack is replicated (in which
@@ -2926,6 +3415,9 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, reply string, doSample b
 		if p, ok := o.pending[sseq]; ok {
 			if doSample {
 				o.sampleAck(sseq, dseq, dc)
+				if o.sla != nil {
+					o.sla.ack(time.Now().UnixNano() - p.Timestamp)
+				}
 			}
 			if o.maxp > 0 && len(o.pending) >= o.maxp {
 				needSignal = true
@@ -2949,6 +3441,13 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, reply string, doSample b
 					}
 				}
 			}
+			// Not delivering in order, or skipping messages other shared consumers own,
+			// the floor can not pass older messages not delivered or acknowledged yet.
+			if o.limitsAckFloor() {
+				if lim := o.ackFloorLimit(); o.asflr > lim {
+					o.asflr = lim
+				}
+			}
 		}
 		delete(o.rdc, sseq)
 		o.removeFromRedeliverQueue(sseq)
@@ -2961,6 +3460,9 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, reply string, doSample b
 		if o.maxp > 0 && len(o.pending) >= o.maxp {
 			needSignal = true
 		}
+		if p, ok := o.pending[sseq]; ok && doSample && o.sla != nil {
+			o.sla.ack(time.Now().UnixNano() - p.Timestamp)
+		}
 		sgap = sseq - o.asflr
 		floor = sgap // start at same and set lower as we go.
 		o.adflr, o.asflr = dseq, sseq
@@ -3187,6 +3689,55 @@ type waitingRequest struct {
 	noWait   bool
 }
 
+// ConsumerPullStats account for the pull requests a consumer received since its leader was elected.
+// Many requests that expire without messages, or are rejected, point to fetch sizes or expiries
+// that do not fit the consumer and silently reduce its throughput.
+type ConsumerPullStats struct {
+	// Requests is the number of pull requests received.
+	Requests uint64 `json:"requests"`
+	// Expired is the number of requests that expired before they were filled.
+	Expired uint64 `json:"expired"`
+	// ExpiredEmpty is the number of expired requests that did not get any message.
+	ExpiredEmpty uint64 `json:"expired_empty"`
+	// Conflicts is the number of requests that ended with a 409 status, e.g. for exceeding limits.
+	Conflicts uint64 `json:"conflicts"`
+	// Msgs and Bytes are what was delivered to the requests.
+	Msgs  uint64 `json:"messages"`
+	Bytes uint64 `json:"bytes"`
+	// Problems describes what the statistics point to, if anything.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Minimum number of pull requests before we report problems.
+const pullStatsMinRequests = 100
+
+// Returns the problems the statistics point to.
+func (ps *ConsumerPullStats) problems() []string {
+	if ps.Requests < pullStatsMinRequests {
+		return nil
+	}
+	var problems []string
+	if ps.ExpiredEmpty*2 > ps.Requests {
+		problems = append(problems, "most pull requests expire without messages, the expiry may be too short or there are too many waiting requests")
+	}
+	if (ps.Expired-ps.ExpiredEmpty)*2 > ps.Requests {
+		problems = append(problems, "pull requests expire partially filled, the batch size may be too large for the message rate")
+	}
+	if ps.Conflicts*10 > ps.Requests {
+		problems = append(problems, "many pull requests end with a 409 status, check their batch, expiry and max bytes against the consumer limits")
+	}
+	return problems
+}
+
+// Accounts for a pull request that expired.
+// Lock should be held.
+func (o *consumer) pullRequestExpired(wr *waitingRequest) {
+	o.pstats.Expired++
+	if wr.d == 0 {
+		o.pstats.ExpiredEmpty++
+	}
+}
+
 // sync.Pool for waiting requests.
 var wrPool = sync.Pool{
 	New: func() any {
@@ -3368,6 +3919,7 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 				const maxBytesT = "NATS/1.0 409 Message Size Exceeds MaxBytes\r\n%s: %d\r\n%s: %d\r\n\r\n"
 				hdr := fmt.Appendf(nil, maxBytesT, JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
 				o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+				o.pstats.Conflicts++
 				// Remove the current one, no longer valid due to max bytes limit.
 				o.waiting.removeCurrent()
 				if o.node != nil {
@@ -3390,6 +3942,7 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 			// We do check for expiration in `processWaiting`, but it is possible to hit the expiry here, and not there.
 			hdr := fmt.Appendf(nil, "NATS/1.0 408 Request Timeout\r\n%s: %d\r\n%s: %d\r\n\r\n", JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
 			o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			o.pullRequestExpired(wr)
 			o.waiting.removeCurrent()
 			if o.node != nil {
 				o.removeClusterPendingRequest(wr.reply)
@@ -3475,12 +4028,16 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 	sendErr := func(status int, description string) {
 		hdr := fmt.Appendf(nil, "NATS/1.0 %d %s\r\n\r\n", status, description)
 		o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+		if status == 409 {
+			o.pstats.Conflicts++
+		}
 	}
 
 	if o.isPushMode() || o.waiting == nil {
 		sendErr(409, "Consumer is push based")
 		return
 	}
+	o.pstats.Requests++
 
 	// Check payload here to see if they sent in batch size or a formal request.
 	expires, batchSize, maxBytes, noWait, hb, hbt, err := nextReqFromMsg(msg)
@@ -3722,6 +4279,17 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 		return nil, 0, errMaxAckPending
 	}
 
+	// Shared consumers deliver nothing new until the claims of all consumers are known,
+	// then first the messages they skipped that were released by another consumer.
+	if o.cfg.Shared {
+		if o.mset.claimsRecovering.Load() {
+			return nil, 0, ErrStoreEOF
+		}
+		if pmsg := o.getNextReleasedMsg(); pmsg != nil {
+			return pmsg, 1, nil
+		}
+	}
+
 	if o.hasSkipListPending() {
 		seq := o.lss.seqs[0]
 		if len(o.lss.seqs) == 1 {
@@ -3740,40 +4308,279 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 		return pmsg, 1, err
 	}
 
-	// Hold onto this since we release the lock.
-	store := o.mset.store
+	// Not in FIFO order we pick amongst all messages not yet delivered.
+	if o.isOrdered() {
+		return o.getNextOrderedMsg()
+	}
 
 	var sseq uint64
 	var err error
 	var sm *StoreMsg
 	var pmsg = getJSPubMsgFromPool()
 
-	// Grab next message applicable to us.
-	filters, subjf, fseq := o.filters, o.subjf, o.sseq
+	for {
+		// Grab next message applicable to us.
+		sm, sseq, err = o.loadNextMsg(o.sseq, &pmsg.StoreMsg)
+		if sm == nil {
+			pmsg.returnToPool()
+			pmsg = nil
+		}
+		// Check if we should move our o.sseq.
+		if sseq >= o.sseq {
+			// If we are moving step by step then sseq == o.sseq.
+			// If we have jumped we should update skipped for other replicas.
+			if sseq != o.sseq && err == ErrStoreEOF {
+				o.updateSkipped(sseq + 1)
+			}
+			o.sseq = sseq + 1
+		}
+		// Shared consumers skip messages owned by another shared consumer.
+		if sm != nil && o.cfg.Shared && !o.mset.claimMsg(sm.seq, o.name) {
+			continue
+		}
+		return pmsg, 1, err
+	}
+}
+
+// addReleased hands a shared consumer the messages another shared consumer released,
+// so the ones we skipped are delivered.
+func (o *consumer) addReleased(seqs []uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed || o.mset == nil {
+		return
+	}
+	var added bool
+	for _, seq := range seqs {
+		if seq >= o.sseq {
+			break
+		}
+		if _, ok := o.pending[seq]; !ok {
+			o.released = append(o.released, seq)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	slices.Sort(o.released)
+	o.released = slices.Compact(o.released)
+	o.streamNumPending()
+	o.signalNewMessages()
+}
+
+// releaseUnclaimed hands a recovered shared consumer the messages it skipped that no
+// consumer owns anymore. On a work queue all stored messages are not acknowledged yet.
+func (o *consumer) releaseUnclaimed() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed || o.mset == nil || o.mset.store == nil {
+		return
+	}
+	var state StreamState
+	o.mset.store.FastState(&state)
+	var smv StoreMsg
+	for seq := state.FirstSeq; seq < o.sseq; seq++ {
+		sm, sseq, err := o.loadNextMsg(seq, &smv)
+		if sm == nil || err != nil || sseq >= o.sseq {
+			break
+		}
+		seq = sseq
+		if _, ok := o.pending[seq]; !ok && !o.mset.isClaimed(seq) {
+			o.released = append(o.released, seq)
+		}
+	}
+	if len(o.released) > 0 {
+		o.streamNumPending()
+		o.signalNewMessages()
+	}
+}
+
+// getNextReleasedMsg returns the first of the released messages we can claim, if any.
+// Messages before our ack floor move it back, since we have not acknowledged them.
+// Lock should be held.
+func (o *consumer) getNextReleasedMsg() *jsPubMsg {
+	for len(o.released) > 0 {
+		seq := o.released[0]
+		o.released = o.released[1:]
+		if _, ok := o.pending[seq]; ok {
+			continue
+		}
+		pmsg := getJSPubMsgFromPool()
+		sm, err := o.mset.store.LoadMsg(seq, &pmsg.StoreMsg)
+		if sm == nil || err != nil || !o.isFilteredMatch(sm.subj) || !o.mset.claimMsg(seq, o.name) {
+			pmsg.returnToPool()
+			continue
+		}
+		if seq <= o.asflr {
+			o.asflr = seq - 1
+			if o.store != nil {
+				state := &ConsumerState{
+					Delivered:   SequencePair{Consumer: o.dseq - 1, Stream: o.sseq - 1},
+					AckFloor:    SequencePair{Consumer: o.adflr, Stream: o.asflr},
+					Pending:     o.pending,
+					Redelivered: o.rdc,
+				}
+				o.store.Reset(state)
+			}
+		}
+		return pmsg
+	}
+	o.released = nil
+	return nil
+}
+
+// Loads the next message at or after fseq that matches our filters.
+// Lock should be held.
+func (o *consumer) loadNextMsg(fseq uint64, smp *StoreMsg) (*StoreMsg, uint64, error) {
+	store := o.mset.store
 	// Check if we are multi-filtered or not.
-	if filters != nil {
-		sm, sseq, err = store.LoadNextMsgMulti(filters, fseq, &pmsg.StoreMsg)
-	} else if subjf != nil { // Means single filtered subject since o.filters means > 1.
-		filter, wc := subjf[0].subject, subjf[0].hasWildcard
-		sm, sseq, err = store.LoadNextMsg(filter, wc, fseq, &pmsg.StoreMsg)
-	} else {
-		// No filter here.
-		sm, sseq, err = store.LoadNextMsg(_EMPTY_, false, fseq, &pmsg.StoreMsg)
+	if o.filters != nil {
+		return store.LoadNextMsgMulti(o.filters, fseq, smp)
+	} else if o.subjf != nil { // Means single filtered subject since o.filters means > 1.
+		filter, wc := o.subjf[0].subject, o.subjf[0].hasWildcard
+		return store.LoadNextMsg(filter, wc, fseq, smp)
 	}
-	if sm == nil {
-		pmsg.returnToPool()
-		pmsg = nil
+	// No filter here.
+	return store.LoadNextMsg(_EMPTY_, false, fseq, smp)
+}
+
+// Returns true if we do not deliver in FIFO order.
+// Lock should be held.
+func (o *consumer) isOrdered() bool {
+	return o.cfg.DeliverOrder == DeliverOrderLIFO || o.cfg.DeliverOrder == DeliverOrderHeader
+}
+
+// Returns true if our ack floor has to be kept below messages we have not delivered yet,
+// since we do not deliver them in order, or skip the ones other shared consumers own.
+// Lock should be held.
+func (o *consumer) limitsAckFloor() bool {
+	return o.isOrdered() || o.cfg.Shared
+}
+
+// Returns the highest our ack floor for the stream can be, just below the lowest
+// message that is pending, not delivered yet or owned by another shared consumer.
+// Lock should be held.
+func (o *consumer) ackFloorLimit() uint64 {
+	lim := o.sseq - 1
+	for seq := range o.pending {
+		if seq <= lim {
+			lim = seq - 1
+		}
 	}
-	// Check if we should move our o.sseq.
-	if sseq >= o.sseq {
-		// If we are moving step by step then sseq == o.sseq.
-		// If we have jumped we should update skipped for other replicas.
-		if sseq != o.sseq && err == ErrStoreEOF {
-			o.updateSkipped(sseq + 1)
+	if o.ord != nil {
+		for _, e := range o.ord.msgs {
+			if e.seq <= lim {
+				lim = e.seq - 1
+			}
+		}
+	}
+	if o.cfg.Shared && o.mset != nil {
+		for _, seq := range o.released {
+			if seq <= lim {
+				lim = seq - 1
+			}
+		}
+		if seq := o.mset.lowestClaim(o.name, lim); seq > 0 {
+			lim = seq - 1
+		}
+	}
+	return lim
+}
+
+// resetOrdered will start over from the first message of the stream, since
+// with WorkQueue retention all messages not pending are not delivered yet.
+// Lock should be held.
+func (o *consumer) resetOrdered() {
+	var state StreamState
+	o.mset.store.FastState(&state)
+	o.sseq, o.ord = state.FirstSeq, nil
+}
+
+// getNextOrderedMsg adds all new messages to the ones not yet delivered
+// and returns the first of them in our delivery order.
+// Lock should be held.
+func (o *consumer) getNextOrderedMsg() (*jsPubMsg, uint64, error) {
+	if o.ord == nil {
+		o.ord = &orderedMsgs{lifo: o.cfg.DeliverOrder == DeliverOrderLIFO, hdr: o.cfg.OrderHeader}
+	}
+	pmsg := getJSPubMsgFromPool()
+	for {
+		sm, sseq, err := o.loadNextMsg(o.sseq, &pmsg.StoreMsg)
+		if sm == nil || err != nil {
+			break
 		}
 		o.sseq = sseq + 1
+		// Skip the ones delivered before we took over.
+		if _, ok := o.pending[sseq]; ok {
+			continue
+		}
+		o.ord.add(sm)
 	}
-	return pmsg, 1, err
+	for o.ord.Len() > 0 {
+		e := heap.Pop(o.ord).(orderedMsg)
+		// This could have been removed in the meantime.
+		if sm, err := o.mset.store.LoadMsg(e.seq, &pmsg.StoreMsg); sm == nil || err != nil {
+			continue
+		}
+		// Skip messages owned by another shared consumer.
+		if o.cfg.Shared && !o.mset.claimMsg(e.seq, o.name) {
+			continue
+		}
+		return pmsg, 1, nil
+	}
+	pmsg.returnToPool()
+	return nil, 0, ErrStoreEOF
+}
+
+// A message not yet delivered by a consumer that does not deliver in FIFO order.
+type orderedMsg struct {
+	key int64
+	seq uint64
+}
+
+// orderedMsgs is a heap of the messages not yet delivered, first to deliver on top.
+type orderedMsgs struct {
+	lifo bool
+	hdr  string
+	msgs []orderedMsg
+}
+
+// Adds a message, keyed by our order header if any.
+func (h *orderedMsgs) add(sm *StoreMsg) {
+	key := int64(math.MaxInt64)
+	if h.hdr != _EMPTY_ {
+		if v := getHeader(h.hdr, sm.hdr); len(v) > 0 {
+			if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+				key = n
+			}
+		}
+	}
+	heap.Push(h, orderedMsg{key: key, seq: sm.seq})
+}
+
+func (h *orderedMsgs) Len() int { return len(h.msgs) }
+
+func (h *orderedMsgs) Less(i, j int) bool {
+	a, b := h.msgs[i], h.msgs[j]
+	if h.lifo {
+		return a.seq > b.seq
+	}
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.seq < b.seq
+}
+
+func (h *orderedMsgs) Swap(i, j int) { h.msgs[i], h.msgs[j] = h.msgs[j], h.msgs[i] }
+
+func (h *orderedMsgs) Push(x any) { h.msgs = append(h.msgs, x.(orderedMsg)) }
+
+func (h *orderedMsgs) Pop() any {
+	n := len(h.msgs)
+	e := h.msgs[n-1]
+	h.msgs = h.msgs[:n-1]
+	return e
 }
 
 // Will check for expiration and lack of interest on waiting requests.
@@ -3807,6 +4614,10 @@ func (o *consumer) processWaiting(eos bool) (int, int, int, time.Time) {
 		if (eos && wr.noWait && wr.d > 0) || (!wr.expires.IsZero() && now.After(wr.expires)) {
 			hdr := fmt.Appendf(nil, "NATS/1.0 408 Request Timeout\r\n%s: %d\r\n%s: %d\r\n\r\n", JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
 			o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			// A no wait request that got messages is done, not expired.
+			if !(eos && wr.noWait && wr.d > 0) {
+				o.pullRequestExpired(wr)
+			}
 			wr = remove(pre, wr)
 			continue
 		}
@@ -4128,6 +4939,10 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			// go back to waiting.
 			goto waitForMsgs
 		}
+		// Same if the stream pauses its consumers.
+		if o.mset.consumersPaused() {
+			goto waitForMsgs
+		}
 
 		// If we are in push mode and not active or under flowcontrol let's stop sending.
 		if o.isPushMode() {
@@ -4179,6 +4994,17 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 		// Add in msg size itself as header.
 		if o.cfg.HeadersOnly {
 			convertToHeadersOnly(pmsg)
+		} else if o.isCompressing() {
+			// Compressing takes a while, so do not hold up acks and requests meanwhile.
+			alg, minSize := o.cfg.Compression, o.cfg.CompressMinSize
+			o.mu.Unlock()
+			compressPayload(pmsg, alg, minSize)
+			o.mu.Lock()
+			if o.closed || o.mset == nil {
+				o.mu.Unlock()
+				pmsg.returnToPool()
+				return
+			}
 		}
 		// Calculate payload size. This can be calculated on client side.
 		// We do not include transport subject here since not generally known on client.
@@ -4189,6 +5015,8 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 		} else if wr := o.nextWaiting(sz); wr != nil {
 			wrn, wrb = wr.n, wr.b
 			dsubj = wr.reply
+			o.pstats.Msgs++
+			o.pstats.Bytes += uint64(sz)
 			if done := wr.recycleIfDone(); done && o.node != nil {
 				o.removeClusterPendingRequest(dsubj)
 			} else if !done && wr.hb > 0 {
@@ -4199,7 +5027,10 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			// Need to also test that this is not going backwards since if
 			// we fail to deliver we can end up here from rdq but we do not
 			// want to decrement o.sseq if that is the case.
-			if dc == 1 && pmsg.seq == o.sseq-1 {
+			if dc == 1 && o.ord != nil {
+				o.ord.add(&pmsg.StoreMsg)
+				o.npc++
+			} else if dc == 1 && pmsg.seq == o.sseq-1 {
 				o.sseq--
 				o.npc++
 			} else if !o.onRedeliverQueue(pmsg.seq) {
@@ -4212,9 +5043,26 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			goto waitForMsgs
 		}
 
+		// Hold a paused replay until it is resumed.
+		for o.replay && o.rpause != nil {
+			rch := o.rpause
+			o.mu.Unlock()
+			select {
+			case <-qch:
+				pmsg.returnToPool()
+				return
+			case <-rch:
+			}
+			o.mu.Lock()
+		}
+
 		// If we are in a replay scenario and have not caught up check if we need to delay here.
 		if o.replay && lts > 0 {
-			if delay = time.Duration(pmsg.ts - lts); delay > time.Millisecond {
+			delay = time.Duration(pmsg.ts - lts)
+			if speed := o.cfg.ReplaySpeed; speed > 0 {
+				delay = time.Duration(float64(delay) / speed)
+			}
+			if delay > time.Millisecond {
 				o.mu.Unlock()
 				select {
 				case <-qch:
@@ -4395,6 +5243,20 @@ func (o *consumer) streamNumPending() uint64 {
 	}
 	npc, npf := o.calculateNumPending()
 	o.npc, o.npf = int64(npc), npf
+	// When not in FIFO order, messages we have already looked at but not delivered
+	// yet are still pending, while those delivered out of order are not.
+	if o.isOrdered() {
+		if o.ord != nil {
+			o.npc += int64(o.ord.Len())
+		}
+		for seq := range o.pending {
+			if seq >= o.sseq {
+				o.npc--
+			}
+		}
+	}
+	// Released messages of shared consumers are before our next sequence.
+	o.npc += int64(len(o.released))
 	return o.numPending()
 }
 
@@ -4466,6 +5328,60 @@ func convertToHeadersOnly(pmsg *jsPubMsg) {
 	pmsg.msg = nil
 }
 
+// Lock should be held.
+func (o *consumer) isCompressing() bool {
+	return o.cfg.Compression == DeliverCompressionS2 || o.cfg.Compression == DeliverCompressionGzip
+}
+
+// compressPayload will compress the payload of the message if it is large enough
+// and gets smaller, and adds the Content-Encoding header.
+func compressPayload(pmsg *jsPubMsg, alg DeliverCompression, minSize int) {
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+	hdr, msg := pmsg.hdr, pmsg.msg
+	if len(msg) < minSize || len(getHeader(JSContentEncoding, hdr)) > 0 {
+		return
+	}
+
+	var cmsg []byte
+	switch alg {
+	case DeliverCompressionS2:
+		cmsg = s2.Encode(nil, msg)
+	case DeliverCompressionGzip:
+		var bb bytes.Buffer
+		zw := gzip.NewWriter(&bb)
+		if _, err := zw.Write(msg); err != nil {
+			return
+		}
+		if err := zw.Close(); err != nil {
+			return
+		}
+		cmsg = bb.Bytes()
+	}
+	if len(cmsg) >= len(msg) {
+		return
+	}
+
+	var bb bytes.Buffer
+	if len(hdr) == 0 {
+		bb.WriteString(hdrLine)
+	} else {
+		bb.Write(hdr)
+		bb.Truncate(len(hdr) - LEN_CR_LF)
+	}
+	bb.WriteString(JSContentEncoding)
+	bb.WriteString(": ")
+	bb.WriteString(string(alg))
+	bb.WriteString(CR_LF)
+	bb.WriteString(CR_LF)
+	// Replace underlying buf with the new header followed by the compressed payload.
+	pmsg.buf = append(pmsg.buf[:0], bb.Bytes()...)
+	hlen := len(pmsg.buf)
+	pmsg.buf = append(pmsg.buf, cmsg...)
+	pmsg.hdr, pmsg.msg = pmsg.buf[:hlen:hlen], pmsg.buf[hlen:]
+}
+
 // Deliver a msg to the consumer.
 // Lock should be held and o.mset validated to be non-nil.
 func (o *consumer) deliverMsg(dsubj, ackReply string, pmsg *jsPubMsg, dc uint64, rp RetentionPolicy) {
@@ -4493,11 +5409,18 @@ func (o *consumer) deliverMsg(dsubj, ackReply string, pmsg *jsPubMsg, dc uint64,
 	// Update delivered first.
 	o.updateDelivered(dseq, seq, dc, ts)
 
+	if o.sla != nil {
+		o.sla.deliver(dc)
+	}
+
 	// Send message.
 	o.outq.send(pmsg)
 
 	if ap == AckExplicit || ap == AckAll {
 		o.trackPending(seq, dseq)
+		if o.cfg.ProgressHeartbeats {
+			o.trackOwner(seq, dsubj)
+		}
 	} else if ap == AckNone {
 		o.adflr = dseq
 		o.asflr = seq
@@ -4815,6 +5738,13 @@ func (o *consumer) checkPending() {
 		}
 	}
 
+	// Forget the owners of messages that are no longer pending.
+	for seq := range o.powners {
+		if _, ok := o.pending[seq]; !ok {
+			delete(o.powners, seq)
+		}
+	}
+
 	if len(expired) > 0 {
 		// We need to sort.
 		slices.Sort(expired)
@@ -4842,7 +5772,7 @@ func (o *consumer) checkPending() {
 		stopAndClearTimer(&o.ptmr)
 		o.rdq = nil
 		o.rdqi.Empty()
-		o.pending = nil
+		o.pending, o.powners = nil, nil
 		// Mimic behavior in processAckMsg when pending is empty.
 		o.adflr, o.asflr = o.dseq-1, o.sseq-1
 	}
@@ -5015,6 +5945,11 @@ func (o *consumer) selectStartingSeqNo() {
 					// Assign skip list.
 					o.lss = lss
 				}
+			} else if o.cfg.DeliverPolicy == DeliverByStartEventTime {
+				o.mset.cfgMu.RLock()
+				hdr := o.mset.cfg.EventTimeHeader
+				o.mset.cfgMu.RUnlock()
+				o.sseq = o.mset.seqFromEventTime(hdr, *o.cfg.OptStartTime)
 			} else if o.cfg.OptStartTime != nil {
 				// If we are here we are time based.
 				// TODO(dlc) - Once clustered can't rely on this.
@@ -5314,9 +6249,13 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	o.unsubscribe(o.ackSub)
 	o.unsubscribe(o.reqSub)
 	o.unsubscribe(o.fcSub)
+	o.unsubscribe(o.progSub)
+	o.unsubscribe(o.replaySub)
 	o.ackSub = nil
 	o.reqSub = nil
 	o.fcSub = nil
+	o.progSub = nil
+	o.replaySub = nil
 	if o.infoSub != nil {
 		o.srv.sysUnsubscribe(o.infoSub)
 		o.infoSub = nil
@@ -5328,6 +6267,7 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	stopAndClearTimer(&o.ptmr)
 	stopAndClearTimer(&o.dtmr)
 	stopAndClearTimer(&o.gwdtmr)
+	stopAndClearTimer(&o.slatmr)
 	delivery := o.cfg.DeliverSubject
 	o.waiting = nil
 	// Break us out of the readLoop.
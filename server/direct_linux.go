@@ -0,0 +1,36 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Opens a file to bypass the page cache with, file systems that do not support
+// direct I/O, like tmpfs, reject opening it.
+func openDirectFile(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|unix.O_DIRECT, defaultFilePerms)
+	var errno syscall.Errno
+	if errors.As(err, &errno) && errno == unix.EINVAL {
+		return nil, fmt.Errorf("%w: %v", errDirectIOUnsupported, err)
+	}
+	return f, err
+}
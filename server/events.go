@@ -67,6 +67,7 @@ const (
 	serverPingReqSubj         = "$SYS.REQ.SERVER.PING.%s"
 	serverStatsPingReqSubj    = "$SYS.REQ.SERVER.PING"             // use $SYS.REQ.SERVER.PING.STATSZ instead
 	serverReloadReqSubj       = "$SYS.REQ.SERVER.%s.RELOAD"        // with server ID
+	jsMaintenanceReqSubj      = "$SYS.REQ.SERVER.%s.JSMAINTENANCE" // with server ID
 	leafNodeConnectEventSubj  = "$SYS.ACCOUNT.%s.LEAFNODE.CONNECT" // for internal use only
 	remoteLatencyEventSubj    = "$SYS.LATENCY.M2.%s"
 	inboxRespSubj             = "$SYS._INBOX.%s.%s"
@@ -326,6 +327,8 @@ type ClientInfo struct {
 	ClientType string        `json:"client_type,omitempty"`
 	MQTTClient string        `json:"client_id,omitempty"` // This is the MQTT client ID
 	Nonce      string        `json:"nonce,omitempty"`
+	// Size of the chunks of JetStream API responses, if the request asked for chunked responses.
+	ResponseChunk int `json:"resp_chunk,omitempty"`
 }
 
 // ServerStats hold various statistics that we will periodically send out.
@@ -940,12 +943,14 @@ func (s *Server) sendStatsz(subj string) {
 		jStat.Config = &c
 		js.mu.RUnlock()
 		jStat.Stats = js.usageStats()
+		jStat.Maintenance = js.maintenance()
 		// Update our own usage since we do not echo so we will not hear ourselves.
 		ourNode := getHash(s.serverName())
 		if v, ok := s.nodeToInfo.Load(ourNode); ok && v != nil {
 			ni := v.(nodeInfo)
 			ni.stats = jStat.Stats
 			ni.cfg = jStat.Config
+			ni.maintenance = jStat.Maintenance != nil
 			s.optsMu.RLock()
 			ni.tags = copyStrings(s.opts.Tags)
 			s.optsMu.RUnlock()
@@ -1333,6 +1338,22 @@ func (s *Server) initEventTracking() {
 				}
 			})
 		},
+		"INTERESTZ": func(sub *subscription, c *client, _ *Account, subject, reply string, hdr, msg []byte) {
+			optz := &InterestzEventOptions{}
+			s.zReq(c, reply, hdr, msg, &optz.EventFilterOptions, optz, func() (any, error) {
+				if acc, err := extractAccount(subject); err != nil {
+					return nil, err
+				} else {
+					optz.InterestzOptions.Account = acc
+					return s.Interestz(&optz.InterestzOptions)
+				}
+			})
+		},
+		"JSFREEZE": func(sub *subscription, c *client, _ *Account, subject, reply string, hdr, msg []byte) {
+			if acc, err := extractAccount(subject); err == nil {
+				s.jsFreezeReq(c, acc, reply, hdr, msg)
+			}
+		},
 		"CONNS": s.connsRequest,
 	}
 	for name, req := range monAccSrvc {
@@ -1394,6 +1415,13 @@ func (s *Server) initEventTracking() {
 		return
 	}
 
+	// Listen for requests to put JetStream in or out of maintenance.
+	subject = fmt.Sprintf(jsMaintenanceReqSubj, s.info.ID)
+	if _, err := s.sysSubscribe(subject, s.noInlineCallback(s.jsMaintenanceReq)); err != nil {
+		s.Errorf("Error setting up JetStream maintenance handler: %v", err)
+		return
+	}
+
 	// Client connection kick
 	subject = fmt.Sprintf(clientKickReqSubj, s.info.ID)
 	if _, err := s.sysSubscribe(subject, s.noInlineCallback(s.kickClient)); err != nil {
@@ -1640,10 +1668,12 @@ func (s *Server) remoteServerUpdate(sub *subscription, c *client, _ *Account, su
 
 	var cfg *JetStreamConfig
 	var stats *JetStreamStats
+	var maintenance bool
 
 	if ssm.Stats.JetStream != nil {
 		cfg = ssm.Stats.JetStream.Config
 		stats = ssm.Stats.JetStream.Stats
+		maintenance = ssm.Stats.JetStream.Maintenance != nil
 	}
 
 	node := getHash(si.Name)
@@ -1661,6 +1691,7 @@ func (s *Server) remoteServerUpdate(sub *subscription, c *client, _ *Account, su
 		si.JetStreamEnabled(),
 		si.BinaryStreamSnapshot(),
 		accountNRG,
+		maintenance,
 	})
 	if oldInfo == nil || accountNRG != oldInfo.(nodeInfo).accountNRG {
 		// One of the servers we received statsz from changed its mind about
@@ -1715,6 +1746,7 @@ func (s *Server) processNewServer(si *ServerInfo) {
 				si.JetStreamEnabled(),
 				si.BinaryStreamSnapshot(),
 				si.AccountNRG(),
+				false,
 			})
 		}
 	}
@@ -1895,6 +1927,12 @@ type SubszEventOptions struct {
 	EventFilterOptions
 }
 
+// In the context of system events, InterestzEventOptions are options passed to Interestz
+type InterestzEventOptions struct {
+	InterestzOptions
+	EventFilterOptions
+}
+
 // In the context of system events, VarzEventOptions are options passed to Varz
 type VarzEventOptions struct {
 	VarzOptions
@@ -24,6 +24,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -1358,6 +1359,76 @@ func TestAccountReqMonitoring(t *testing.T) {
 	require_Error(t, err)
 }
 
+func TestAccountReqInterestz(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts {
+			A { jetstream: enabled, users = [ { user: "a", pass: "a" } ] }
+			$SYS { users = [ { user: "admin", pass: "s3cr3t!" } ] }
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "a"))
+	defer nc.Close()
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t!"))
+	defer ncSys.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.*"}})
+	require_NoError(t, err)
+	for name, filter := range map[string]string{"ALL": _EMPTY_, "NEW": "orders.new", "OLD": "orders.old"} {
+		_, err = js.AddConsumer("ORDERS", &nats.ConsumerConfig{Durable: name, FilterSubject: filter, AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+	}
+	natsSubSync(t, nc, "orders.>")
+	natsQueueSubSync(t, nc, "orders.new", "q")
+	natsSubSync(t, nc, "orders.old")
+	require_NoError(t, nc.Flush())
+
+	interestz := func(subject string) (*Interestz, *ApiError) {
+		t.Helper()
+		req, err := json.Marshal(&InterestzOptions{Subject: subject})
+		require_NoError(t, err)
+		msg, err := ncSys.Request(fmt.Sprintf(accDirectReqSubj, "A", "INTERESTZ"), req, time.Second)
+		require_NoError(t, err)
+		var resp struct {
+			Data  *Interestz `json:"data"`
+			Error *ApiError  `json:"error"`
+		}
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Data, resp.Error
+	}
+
+	iz, apiErr := interestz("orders.new")
+	require_True(t, apiErr == nil)
+	require_Equal(t, iz.Account, "A")
+	require_Equal(t, iz.Subject, "orders.new")
+	require_Len(t, len(iz.Streams), 1)
+	require_Equal(t, iz.Streams[0].Name, "ORDERS")
+	require_Equal(t, iz.Streams[0].Subject, "orders.new")
+	require_Equal(t, strings.Join(iz.Streams[0].Consumers, ","), "ALL,NEW")
+	require_Len(t, len(iz.Subscriptions), 2)
+	var subjects []string
+	for _, sd := range iz.Subscriptions {
+		subjects = append(subjects, sd.Subject+"/"+sd.Queue)
+	}
+	slices.Sort(subjects)
+	require_Equal(t, strings.Join(subjects, ","), "orders.>/,orders.new/q")
+
+	// Nothing stores or receives this one.
+	iz, apiErr = interestz("invoices.new")
+	require_True(t, apiErr == nil)
+	require_Len(t, len(iz.Streams), 0)
+	require_Len(t, len(iz.Subscriptions), 0)
+
+	// Needs to be a publish subject.
+	_, apiErr = interestz("orders.*")
+	require_True(t, apiErr != nil)
+	require_Contains(t, apiErr.Description, "not a valid publish subject")
+}
+
 func TestAccountReqInfo(t *testing.T) {
 	s, opts := runTrustedServer(t)
 	defer s.Shutdown()
@@ -1675,7 +1746,7 @@ func TestSystemAccountWithGateways(t *testing.T) {
 
 	// If this tests fails with wrong number after 10 seconds we may have
 	// added a new initial subscription for the eventing system.
-	checkExpectedSubs(t, 58, sa)
+	checkExpectedSubs(t, 61, sa)
 
 	// Create a client on B and see if we receive the event
 	urlb := fmt.Sprintf("nats://%s:%d", ob.Host, ob.Port)
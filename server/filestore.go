@@ -64,11 +64,26 @@ type FileStoreConfig struct {
 	AsyncFlush bool
 	// Cipher is the cipher to use when encrypting.
 	Cipher StoreCipher
+	// EncryptSnapshots is when snapshots of an encrypted store are encrypted as well.
+	EncryptSnapshots bool
+	// Tier is the object store blocks are offloaded to, see StreamTiering.
+	Tier TierStore
 	// Compression is the algorithm to use when compressing.
 	Compression StoreCompression
+	// Preallocate allocates the disk space of new blocks up front where the file system supports it.
+	Preallocate bool
+	// DirectIO writes blocks bypassing the page cache where the file system supports it,
+	// so very large streams do not evict the hot data of others.
+	DirectIO bool
+	// MaxBlocks is the most message blocks a stream keeps unless its configuration sets a lower limit.
+	MaxBlocks int
+	// IndexDir is where the index of the stream is kept when placed apart from the blocks in StoreDir.
+	IndexDir string
 
 	// Internal reference to our server.
 	srv *Server
+	// The read ahead budget of the account, nil if not reading ahead.
+	readAhead *readAheadBudget
 }
 
 // FileStreamInfo allows us to remember created time.
@@ -171,8 +186,16 @@ type fileStore struct {
 	tombs       []uint64
 	ld          *LostStreamData
 	scb         StorageUpdateHandler
+	ccb         CompactionUpdateHandler
+	reclaimed   atomic.Uint64
+	scrubbing   atomic.Bool
+	stats       storeStats
 	ageChk      *time.Timer
+	ttls        msgTTLs
+	ttlChk      *time.Timer
+	ttlNext     int64
 	syncTmr     *time.Timer
+	tierTmr     *time.Timer
 	cfg         FileStreamInfo
 	fcfg        FileStoreConfig
 	prf         keyGen
@@ -181,10 +204,13 @@ type fileStore struct {
 	lmb         *msgBlock
 	blks        []*msgBlock
 	bim         map[uint32]*msgBlock
+	pdirs       map[uint32]int64 // Time partitions of the blocks kept in partition directories.
 	psim        *stree.SubjectTree[psi]
 	tsl         int
 	adml        int
 	hh          hash.Hash64
+	hname       string
+	sdef        storeSyncDefaults
 	qch         chan struct{}
 	fsld        chan struct{}
 	cmu         sync.RWMutex
@@ -194,8 +220,19 @@ type fileStore struct {
 	closing     bool
 	closed      bool
 	fip         bool
+	gcommit     bool
+	noPrealloc  bool
+	noDirect    atomic.Bool
+	chmu        sync.Mutex
+	chunks      map[uint64]msgChunks
+	nchunks     atomic.Int64
+	dropped     []string
+	repair      *StreamRepair
 	receivedAny bool
 	firstMoved  bool
+
+	// Used to mock block creation failures.
+	mockCreateErr error
 }
 
 // Represents a message store block and its data.
@@ -211,6 +248,8 @@ type msgBlock struct {
 	nonce      []byte
 	mfn        string
 	mfd        *os.File
+	dfd        *os.File         // Opened to bypass the page cache when writing, see DirectIO.
+	dsz        int64            // Size of the data in the block file while the last direct write is padded.
 	cmp        StoreCompression // Effective compression at the time of loading the block
 	liwsz      int64
 	index      uint32
@@ -219,6 +258,7 @@ type msgBlock struct {
 	msgs       uint64 // User visible message count.
 	fss        *stree.SubjectTree[SimpleState]
 	kfn        string
+	pstart     int64 // Start of the time partition holding the block, if partitioned.
 	lwts       int64
 	llts       int64
 	lrts       int64
@@ -241,7 +281,14 @@ type msgBlock struct {
 	needSync   bool
 	syncAlways bool
 	noCompact  bool
+	raNext     bool
+	raBytes    int64
 	closed     bool
+	tfn        string
+	intier     bool
+	tiered     bool
+	tfetch     chan struct{}
+	tgen       uint64
 
 	// Used to mock write failures.
 	mockWriteErr bool
@@ -319,6 +366,15 @@ const (
 	// This is the full snapshotted state for the stream.
 	streamStreamStateFile = "index.db"
 
+	// This holds the expirations of messages with a TTL as of the full state.
+	ttlStreamStateFile = "ttl.db"
+
+	// This is the dedupe state of the stream written on a clean stop.
+	streamDedupeStateFile = "dd.dat"
+
+	// This holds the name of a renamed stream its data was written under.
+	streamOrigNameFile = "name.orig"
+
 	// AEK key sizes
 	minMetaKeySize = 64
 	minBlkKeySize  = 64
@@ -348,6 +404,27 @@ const (
 	recordHashSize = 8
 )
 
+// Checks that we can create files in the storage directory.
+func checkStoreDirWritable(dir string) error {
+	tmpfile, err := os.CreateTemp(dir, "_test_")
+	if err != nil {
+		return err
+	}
+	tmpfile.Close()
+	<-dios
+	os.Remove(tmpfile.Name())
+	dios <- struct{}{}
+	return nil
+}
+
+// checkWritable returns an error if our storage directory can not be written to.
+func (fs *fileStore) checkWritable() error {
+	fs.mu.RLock()
+	dir := fs.fcfg.StoreDir
+	fs.mu.RUnlock()
+	return newStorageError(checkStoreDirWritable(dir))
+}
+
 func newFileStore(fcfg FileStoreConfig, cfg StreamConfig) (*fileStore, error) {
 	return newFileStoreWithCreated(fcfg, cfg, time.Now().UTC(), nil, nil)
 }
@@ -379,21 +456,16 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 	// Check the directory
 	if stat, err := os.Stat(fcfg.StoreDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(fcfg.StoreDir, defaultDirPerms); err != nil {
-			return nil, fmt.Errorf("could not create storage directory - %v", err)
+			return nil, fmt.Errorf("could not create storage directory - %w", err)
 		}
 	} else if stat == nil || !stat.IsDir() {
 		return nil, fmt.Errorf("storage directory is not a directory")
 	}
-	tmpfile, err := os.CreateTemp(fcfg.StoreDir, "_test_")
+	err := checkStoreDirWritable(fcfg.StoreDir)
 	if err != nil {
 		return nil, fmt.Errorf("storage directory is not writable")
 	}
 
-	tmpfile.Close()
-	<-dios
-	os.Remove(tmpfile.Name())
-	dios <- struct{}{}
-
 	fs := &fileStore{
 		fcfg:   fcfg,
 		psim:   stree.NewSubjectTree[psi](),
@@ -406,18 +478,25 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		srv:    fcfg.srv,
 	}
 
-	// Set flush in place to AsyncFlush which by default is false.
-	fs.fip = !fcfg.AsyncFlush
+	// Set flush in place to AsyncFlush which by default is false,
+	// unless the stream has a durability of its own.
+	fs.sdef = storeSyncDefaults{interval: fcfg.SyncInterval, always: fcfg.SyncAlways, async: fcfg.AsyncFlush}
+	fs.applyDurability(cfg.Durability)
 
 	// Check if this is a new setup.
 	mdir := filepath.Join(fcfg.StoreDir, msgDir)
 	odir := filepath.Join(fcfg.StoreDir, consumerDir)
 	if err := os.MkdirAll(mdir, defaultDirPerms); err != nil {
-		return nil, fmt.Errorf("could not create message storage directory - %v", err)
+		return nil, fmt.Errorf("could not create message storage directory - %w", err)
 	}
 	if err := os.MkdirAll(odir, defaultDirPerms); err != nil {
-		return nil, fmt.Errorf("could not create consumer storage directory - %v", err)
+		return nil, fmt.Errorf("could not create consumer storage directory - %w", err)
 	}
+	if err := fs.setupIndexDir(); err != nil {
+		return nil, err
+	}
+	fs.recoverChunks()
+	fs.recoverPartitionDirs()
 
 	// Create highway hash for message blocks. Use sha256 of directory as key.
 	key := sha256.Sum256([]byte(cfg.Name))
@@ -426,6 +505,13 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		return nil, fmt.Errorf("could not create hash: %v", err)
 	}
 
+	// The hashes of the blocks and consumer states are keyed by the name the stream
+	// had when created, which is only different once renamed.
+	fs.hname = cfg.Name
+	if b, err := os.ReadFile(filepath.Join(fcfg.StoreDir, streamOrigNameFile)); err == nil && len(b) > 0 {
+		fs.hname = string(b)
+	}
+
 	keyFile := filepath.Join(fs.fcfg.StoreDir, JetStreamMetaFileKey)
 	// Make sure we do not have an encrypted store underneath of us but no main key.
 	if fs.prf == nil {
@@ -436,6 +522,7 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 
 	// Attempt to recover our state.
 	err = fs.recoverFullState()
+	recovered := err == nil
 	if err != nil {
 		if !os.IsNotExist(err) {
 			fs.warn("Recovering stream state from index errored: %v", err)
@@ -475,6 +562,11 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		go fs.cleanupOldMeta()
 	}()
 
+	// Rebuild the expirations of messages with a TTL, unless kept along with the recovered state.
+	if cfg.AllowMsgTTL && (!recovered || fs.recoverMsgTTLState() != nil) {
+		fs.recoverMsgTTLs()
+	}
+
 	// Lock while we do enforcements and removals.
 	fs.mu.Lock()
 
@@ -488,6 +580,9 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		fs.tombs = nil
 	}
 
+	// Remember what we had to drop to recover.
+	fs.recordRepair()
+
 	// Limits checks and enforcement.
 	fs.enforceMsgLimit()
 	fs.enforceBytesLimit()
@@ -503,6 +598,9 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		fs.enforceMsgPerSubjectLimit(false)
 	}
 
+	// Remove the chunks of messages that were not stored or are gone.
+	fs.removeStaleChunks()
+
 	// Grab first sequence for check below while we have lock.
 	firstSeq := fs.state.FirstSeq
 	fs.mu.Unlock()
@@ -540,6 +638,11 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 	// Setup our sync timer.
 	fs.setSyncTimer()
 
+	// And the one to offload blocks if tiered.
+	fs.mu.Lock()
+	fs.setTierTimer()
+	fs.mu.Unlock()
+
 	// Spin up the go routine that will write out our full state stream index.
 	go fs.flushStreamStateLoop(fs.qch, fs.fsld)
 
@@ -599,6 +702,7 @@ func (fs *fileStore) UpdateConfig(cfg *StreamConfig) error {
 	// Limits checks and enforcement.
 	fs.enforceMsgLimit()
 	fs.enforceBytesLimit()
+	fs.enforceSubjectLimits(_EMPTY_)
 
 	// Do age timers.
 	if fs.ageChk == nil && fs.cfg.MaxAge != 0 {
@@ -612,8 +716,17 @@ func (fs *fileStore) UpdateConfig(cfg *StreamConfig) error {
 	if fs.cfg.MaxMsgsPer > 0 && fs.cfg.MaxMsgsPer < old_cfg.MaxMsgsPer {
 		fs.enforceMsgPerSubjectLimit(true)
 	}
+	fs.setTierTimer()
+	if d, od := cfg.Durability, old_cfg.Durability; (d == nil) != (od == nil) || d != nil && *d != *od {
+		fs.updateDurability(cfg.Durability)
+	}
 	fs.mu.Unlock()
 
+	// Track messages that have a TTL from before it was allowed.
+	if cfg.AllowMsgTTL && !old_cfg.AllowMsgTTL {
+		fs.recoverMsgTTLs()
+	}
+
 	if cfg.MaxAge != 0 {
 		fs.expireMsgs()
 	}
@@ -825,6 +938,52 @@ func (fs *fileStore) writeStreamMeta() error {
 	return nil
 }
 
+// Write out the dedupe state of the stream, so a restart does not need to rebuild it from the messages.
+func (fs *fileStore) writeDedupeState(b []byte) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.setupAEK(); err != nil {
+		return err
+	}
+	// Encrypt if needed.
+	if fs.aek != nil {
+		nonce := make([]byte, fs.aek.NonceSize(), fs.aek.NonceSize()+len(b)+fs.aek.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		b = fs.aek.Seal(nonce, nonce, b, nil)
+	}
+	return fs.writeFileWithOptionalSync(filepath.Join(fs.fcfg.StoreDir, streamDedupeStateFile), b, defaultFilePerms)
+}
+
+// Reads the dedupe state written on a clean stop. The state is removed, since it will
+// be out of date once new messages are stored.
+func (fs *fileStore) readDedupeState() ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fn := filepath.Join(fs.fcfg.StoreDir, streamDedupeStateFile)
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(fn)
+
+	if err := fs.recoverAEK(); err != nil {
+		return nil, err
+	}
+	// Decrypt if needed.
+	if fs.aek != nil {
+		ns := fs.aek.NonceSize()
+		if len(b) < ns {
+			return nil, errBadMsg
+		}
+		return fs.aek.Open(nil, b[:ns], b[ns:], nil)
+	}
+	return b, nil
+}
+
 // Pools to recycle the blocks to help with memory pressure.
 var blkPoolBig sync.Pool    // 16MB
 var blkPoolMedium sync.Pool // 8MB
@@ -898,8 +1057,11 @@ func (fs *fileStore) initMsgBlock(index uint32) *msgBlock {
 		syncAlways: fs.fcfg.SyncAlways,
 	}
 
-	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
-	mb.mfn = filepath.Join(mdir, fmt.Sprintf(blkScan, index))
+	mb.pstart = fs.pdirs[index]
+	mb.mfn = filepath.Join(fs.blockDir(index), fmt.Sprintf(blkScan, index))
+	if fs.fcfg.Tier != nil {
+		mb.initTier()
+	}
 
 	if mb.hh == nil {
 		key := sha256.Sum256(fs.hashKeyForBlock(index))
@@ -915,8 +1077,7 @@ func (fs *fileStore) loadEncryptionForMsgBlock(mb *msgBlock) error {
 	}
 
 	var createdKeys bool
-	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
-	ekey, err := os.ReadFile(filepath.Join(mdir, fmt.Sprintf(keyScan, mb.index)))
+	ekey, err := os.ReadFile(mb.keyFile())
 	if err != nil {
 		// We do not seem to have keys even though we should. Could be a plaintext conversion.
 		// Create the keys and we will double check below.
@@ -981,6 +1142,13 @@ func (mb *msgBlock) ensureLastChecksumLoaded() {
 // Lock held on entry
 func (fs *fileStore) recoverMsgBlock(index uint32) (*msgBlock, error) {
 	mb := fs.initMsgBlock(index)
+	// Fetch the block back if it was offloaded.
+	mb.mu.Lock()
+	err := mb.fetchTiered()
+	mb.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
 	// Open up the message file, but we will try to recover from the index file.
 	// We will check that the last checksums match.
 	file, err := mb.openBlock()
@@ -990,7 +1158,7 @@ func (fs *fileStore) recoverMsgBlock(index uint32) (*msgBlock, error) {
 	defer file.Close()
 
 	if fi, err := file.Stat(); fi != nil {
-		mb.rbytes = uint64(fi.Size())
+		mb.rbytes = uint64(mb.dataSize(fi.Size()))
 	} else {
 		return nil, err
 	}
@@ -1030,10 +1198,13 @@ func (fs *fileStore) recoverMsgBlock(index uint32) (*msgBlock, error) {
 	}
 
 	// If we get data loss rebuilding the message block state record that with the fs itself.
-	ld, tombs, _ := mb.rebuildState()
+	ld, tombs, err := mb.rebuildState()
 	if ld != nil {
 		fs.addLostData(ld)
 	}
+	if err != nil && mb.msgs == 0 {
+		fs.recordDroppedBlock(mb, err)
+	}
 	// Collect all tombstones.
 	if len(tombs) > 0 {
 		fs.tombs = append(fs.tombs, tombs...)
@@ -1145,8 +1316,7 @@ func (mb *msgBlock) convertCipher() error {
 		osc = ChaCha
 	}
 
-	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
-	ekey, err := os.ReadFile(filepath.Join(mdir, fmt.Sprintf(keyScan, mb.index)))
+	ekey, err := os.ReadFile(mb.keyFile())
 	if err != nil {
 		return err
 	}
@@ -1200,8 +1370,7 @@ func (mb *msgBlock) convertCipher() error {
 		// Generate new keys. If we error for some reason then we will put
 		// the old keyfile back.
 		if err := fs.genEncryptionKeysForBlock(mb); err != nil {
-			keyFile := filepath.Join(mdir, fmt.Sprintf(keyScan, mb.index))
-			fs.writeFileWithOptionalSync(keyFile, ekey, defaultFilePerms)
+			fs.writeFileWithOptionalSync(mb.keyFile(), ekey, defaultFilePerms)
 			return err
 		}
 		mb.bek.XORKeyStream(buf, buf)
@@ -1374,6 +1543,12 @@ func (mb *msgBlock) rebuildStateLocked() (*LostStreamData, []uint64, error) {
 		hdr := buf[index : index+msgHdrSize]
 		rl, slen := le.Uint32(hdr[0:]), le.Uint16(hdr[20:])
 
+		// The padding of a direct write that was not truncated off before a crash.
+		if rl == 0 && mb.fs.fcfg.DirectIO && len(bytes.TrimRight(buf[index:], "\x00")) == 0 {
+			truncate(index)
+			break
+		}
+
 		hasHeaders := rl&hbit != 0
 		// Clear any headers bit that could be set.
 		rl &^= hbit
@@ -1449,7 +1624,7 @@ func (mb *msgBlock) rebuildStateLocked() (*LostStreamData, []uint64, error) {
 
 		if !mb.dmap.Exists(seq) {
 			mb.msgs++
-			mb.bytes += uint64(rl)
+			mb.bytes += uint64(rl) + mb.fs.chunkedSize(seq)
 		}
 
 		// Check for any gaps from compaction, meaning no ebit entry.
@@ -1545,7 +1720,7 @@ func (fs *fileStore) recoverFullState() (rerr error) {
 		os.RemoveAll(pdir)
 	}
 	// Grab our stream state file and load it in.
-	fn := filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile)
+	fn := fs.stateFile()
 	buf, err := os.ReadFile(fn)
 	dios <- struct{}{}
 
@@ -1777,6 +1952,12 @@ func (fs *fileStore) recoverFullState() (rerr error) {
 			}
 		}
 	}
+	for index := range fs.pdirs {
+		if index > blkIndex {
+			fs.warn("Stream state outdated, found extra blocks, will rebuild")
+			return errPriorState
+		}
+	}
 
 	// We check first and last seq and number of msgs and bytes. If there is a difference,
 	// return and error so we rebuild from the message block state on disk.
@@ -1800,7 +1981,7 @@ func (mb *msgBlock) lastChecksum() []byte {
 
 	var lchk [8]byte
 	if fi, _ := f.Stat(); fi != nil {
-		mb.rbytes = uint64(fi.Size())
+		mb.rbytes = uint64(mb.dataSize(fi.Size()))
 	}
 	if mb.rbytes < checksumSize {
 		return lchk[:]
@@ -1860,6 +2041,8 @@ func (fs *fileStore) recoverMsgs() error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	fs.recoverPartitionDirs()
+
 	// Check for any left over purged messages.
 	<-dios
 	pdir := filepath.Join(fs.fcfg.StoreDir, purgeDir)
@@ -1885,8 +2068,17 @@ func (fs *fileStore) recoverMsgs() error {
 	for _, fi := range dirs {
 		if n, err := fmt.Sscanf(fi.Name(), blkScan, &index); err == nil && n == 1 {
 			indices = append(indices, index)
+		} else if n, err := fmt.Sscanf(fi.Name(), tierScan, &index); err == nil && n == 1 && fs.fcfg.Tier != nil {
+			// Offloaded blocks that are not available locally.
+			if _, err := os.Stat(filepath.Join(mdir, fmt.Sprintf(blkScan, index))); os.IsNotExist(err) {
+				indices = append(indices, index)
+			}
 		}
 	}
+	// Blocks in time partition directories.
+	for index := range fs.pdirs {
+		indices = append(indices, int(index))
+	}
 	indices.Sort()
 
 	// Recover all of the msg blocks.
@@ -1949,8 +2141,12 @@ func (fs *fileStore) recoverMsgs() error {
 		return err
 	}
 
-	// Check for keyfiles orphans.
-	if kms, err := filepath.Glob(filepath.Join(mdir, keyScanAll)); err == nil && len(kms) > 0 {
+	// Check for keyfiles orphans, including the ones in time partition directories.
+	kms, _ := filepath.Glob(filepath.Join(mdir, keyScanAll))
+	if pkms, err := filepath.Glob(filepath.Join(mdir, "*", keyScanAll)); err == nil {
+		kms = append(kms, pkms...)
+	}
+	if len(kms) > 0 {
 		valid := make(map[uint32]bool)
 		for _, mb := range fs.blks {
 			valid[mb.index] = true
@@ -2071,7 +2267,7 @@ func (fs *fileStore) expireMsgsOnRecover() {
 			if mb.msgs > 0 {
 				atomic.StoreUint64(&mb.first.seq, seq)
 				needNextFirst = true
-				sz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+				sz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg) + mb.fs.chunkedSize(sm.seq)
 				if sz > mb.bytes {
 					sz = mb.bytes
 				}
@@ -3208,7 +3404,7 @@ func (fs *fileStore) RegisterStorageUpdates(cb StorageUpdateHandler) {
 // Helper to get hash key for specific message block.
 // Lock should be held
 func (fs *fileStore) hashKeyForBlock(index uint32) []byte {
-	return []byte(fmt.Sprintf("%s-%d", fs.cfg.Name, index))
+	return []byte(fmt.Sprintf("%s-%d", fs.hname, index))
 }
 
 func (mb *msgBlock) setupWriteCache(buf []byte) {
@@ -3227,7 +3423,7 @@ func (mb *msgBlock) setupWriteCache(buf []byte) {
 		fi, _ = os.Stat(mb.mfn)
 	}
 	if fi != nil {
-		mb.cache.off = int(fi.Size())
+		mb.cache.off = int(mb.dataSize(fi.Size()))
 	}
 	mb.llts = time.Now().UnixNano()
 	mb.startCacheExpireTimer()
@@ -3236,23 +3432,37 @@ func (mb *msgBlock) setupWriteCache(buf []byte) {
 // This rolls to a new append msg block.
 // Lock should be held.
 func (fs *fileStore) newMsgBlockForWrite() (*msgBlock, error) {
+	return fs.newMsgBlockForWriteAt(time.Now().UnixNano())
+}
+
+// Creates the new write block for a message with the timestamp ts,
+// which selects the time partition of the block if partitioned.
+// Lock should be held.
+func (fs *fileStore) newMsgBlockForWriteAt(mts int64) (*msgBlock, error) {
 	index := uint32(1)
 	var rbuf []byte
 
 	if lmb := fs.lmb; lmb != nil {
 		index = lmb.index + 1
+		lmb.mu.Lock()
+		// No longer written to, so the padding of direct writes can go.
+		if err := lmb.truncatePadding(); err != nil {
+			fs.warn("Could not truncate message block %d: %v", lmb.index, err)
+		}
 		// Determine if we can reclaim any resources here.
 		if fs.fip {
-			lmb.mu.Lock()
 			lmb.closeFDsLocked()
 			if lmb.cache != nil {
 				// Reset write timestamp and see if we can expire this cache.
 				rbuf = lmb.tryExpireWriteCache()
 			}
-			lmb.mu.Unlock()
 		}
+		lmb.mu.Unlock()
 	}
 
+	if err := fs.setBlockPartition(index, mts); err != nil {
+		return nil, err
+	}
 	mb := fs.initMsgBlock(index)
 	// Lock should be held to quiet race detector.
 	mb.mu.Lock()
@@ -3279,12 +3489,23 @@ func (fs *fileStore) newMsgBlockForWrite() (*msgBlock, error) {
 	mfd, err := os.OpenFile(mb.mfn, os.O_CREATE|os.O_RDWR, defaultFilePerms)
 	dios <- struct{}{}
 
+	// Used to mock block creation failures.
+	if err == nil && fs.mockCreateErr != nil {
+		mfd.Close()
+		err, fs.mockCreateErr = fs.mockCreateErr, nil
+	}
+
 	if err != nil {
 		mb.dirtyCloseWithRemove(true)
-		return nil, fmt.Errorf("Error creating msg block file: %v", err)
+		return nil, fmt.Errorf("Error creating msg block file: %w", err)
 	}
 	mb.mfd = mfd
 
+	if err := fs.preallocateBlock(mfd); err != nil {
+		mb.dirtyCloseWithRemove(true)
+		return nil, fmt.Errorf("Error preallocating msg block file: %w", err)
+	}
+
 	// Check if encryption is enabled.
 	if fs.prf != nil {
 		if err := fs.genEncryptionKeysForBlock(mb); err != nil {
@@ -3313,8 +3534,7 @@ func (fs *fileStore) genEncryptionKeysForBlock(mb *msgBlock) error {
 		return err
 	}
 	mb.aek, mb.bek, mb.seed, mb.nonce = key, bek, seed, encrypted[:key.NonceSize()]
-	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
-	keyFile := filepath.Join(mdir, fmt.Sprintf(keyScan, mb.index))
+	keyFile := mb.keyFile()
 	if _, err := os.Stat(keyFile); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -3332,6 +3552,7 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 	if fs.closed {
 		return ErrStoreClosed
 	}
+	defer fs.stats.write(time.Now())
 
 	// Per subject max check needed.
 	mmp := uint64(fs.cfg.MaxMsgsPer)
@@ -3368,6 +3589,9 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 					return ErrMaxBytes
 				}
 			}
+			if fs.blockLimitReached(ts, fileStoreMsgSize(subj, hdr, msg)) {
+				return ErrMaxBlocks
+			}
 		}
 	}
 
@@ -3446,19 +3670,29 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 	// byte count on their own, so no need to compensate.
 	fs.enforceMsgLimit()
 	fs.enforceBytesLimit()
+	fs.enforceSubjectLimits(subj)
+	fs.enforceBlockLimit()
 
 	// Check if we have and need the age expiration timer running.
 	if fs.ageChk == nil && fs.cfg.MaxAge != 0 {
 		fs.startAgeChk()
 	}
 
+	// Track the expiration of messages with a TTL.
+	if fs.cfg.AllowMsgTTL && len(hdr) > 0 {
+		if ttl, err := getMessageTTL(hdr); err == nil && ttl > 0 {
+			fs.ttls.add(seq, ts+int64(ttl))
+			fs.resetTTLChk()
+		}
+	}
+
 	return nil
 }
 
 // StoreRawMsg stores a raw message with expected sequence number and timestamp.
 func (fs *fileStore) StoreRawMsg(subj string, hdr, msg []byte, seq uint64, ts int64) error {
 	fs.mu.Lock()
-	err := fs.storeRawMsg(subj, hdr, msg, seq, ts)
+	err := newStorageError(fs.storeRawMsg(subj, hdr, msg, seq, ts))
 	cb := fs.scb
 	// Check if first message timestamp requires expiry
 	// sooner than initial replica expiry timer set to MaxAge when initializing.
@@ -3481,7 +3715,7 @@ func (fs *fileStore) StoreRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 func (fs *fileStore) StoreMsg(subj string, hdr, msg []byte) (uint64, int64, error) {
 	fs.mu.Lock()
 	seq, ts := fs.state.LastSeq+1, time.Now().UnixNano()
-	err := fs.storeRawMsg(subj, hdr, msg, seq, ts)
+	err := newStorageError(fs.storeRawMsg(subj, hdr, msg, seq, ts))
 	cb := fs.scb
 	fs.mu.Unlock()
 
@@ -3769,6 +4003,23 @@ func (fs *fileStore) enforceBytesLimit() {
 	}
 }
 
+// Will check the limits of the subject groups the subject belongs to and drop
+// the oldest msgs of a group if needed. An empty subject checks all groups.
+// Lock should be held.
+func (fs *fileStore) enforceSubjectLimits(subj string) {
+	for _, sl := range fs.cfg.SubjectLimits {
+		if subj != _EMPTY_ && !subjectIsSubsetMatch(subj, sl.Filter) {
+			continue
+		}
+		var ss SimpleState
+		for fs.numFilteredPendingNoLast(sl.Filter, &ss); ss.Msgs > uint64(sl.MaxMsgs); fs.numFilteredPendingNoLast(sl.Filter, &ss) {
+			if removed, err := fs.removeMsgViaLimits(ss.First); err != nil || !removed {
+				break
+			}
+		}
+	}
+}
+
 // Will make sure we have limits honored for max msgs per subject on recovery or config update.
 // We will make sure to go through all msg blocks etc. but in practice this
 // will most likely only be the last one, so can take a more conservative approach.
@@ -3948,6 +4199,10 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 		fsUnlock()
 		return false, ErrStoreSnapshotInProgress
 	}
+	// Streams can ask for all removed messages to be erased.
+	if fs.cfg.SecureErase {
+		secure = true
+	}
 	// If in encrypted mode negate secure rewrite here.
 	if secure && fs.prf != nil {
 		secure = false
@@ -3995,7 +4250,7 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 		return false, err
 	}
 	// Grab size
-	msz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+	msz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg) + fs.chunkedSize(seq)
 
 	// Set cache timestamp for last remove.
 	mb.lrts = time.Now().UnixNano()
@@ -4040,6 +4295,7 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 			return false, err
 		}
 	}
+	fs.removeChunks(seq, secure)
 
 	fifo := seq == atomic.LoadUint64(&mb.first.seq)
 	isLastBlock := mb == fs.lmb
@@ -4238,7 +4494,7 @@ func (mb *msgBlock) compactWithFloor(floor uint64) {
 	mb.closeFDsLocked()
 
 	// We will write to a new file and mv/rename it in case of failure.
-	mfn := filepath.Join(mb.fs.fcfg.StoreDir, msgDir, fmt.Sprintf(newScan, mb.index))
+	mfn := filepath.Join(filepath.Dir(mb.mfn), fmt.Sprintf(newScan, mb.index))
 	<-dios
 	err := os.WriteFile(mfn, nbuf, defaultFilePerms)
 	dios <- struct{}{}
@@ -4250,6 +4506,8 @@ func (mb *msgBlock) compactWithFloor(floor uint64) {
 		os.Remove(mfn)
 		return
 	}
+	mb.tgen++
+	mb.dsz = 0
 
 	// Make sure to sync
 	mb.needSync = true
@@ -4259,6 +4517,9 @@ func (mb *msgBlock) compactWithFloor(floor uint64) {
 		// No change, so set our noCompact bool here to avoid attempting to continually compress in syncBlocks.
 		mb.noCompact = true
 	} else {
+		if rbytes < mb.rbytes {
+			mb.fs.reclaimed.Add(mb.rbytes - rbytes)
+		}
 		mb.rbytes = rbytes
 	}
 
@@ -4464,6 +4725,7 @@ func (mb *msgBlock) eraseMsg(seq uint64, ri, rl int) error {
 			return err
 		}
 		defer mfd.Close()
+		mb.tgen++
 		if _, err = mfd.WriteAt(nbytes, int64(ri)); err == nil {
 			mfd.Sync()
 		}
@@ -4509,7 +4771,7 @@ func (mb *msgBlock) truncate(sm *StoreMsg) (nmsgs, nbytes uint64, err error) {
 		// We should have a valid msg to calculate removal stats.
 		if m, err := mb.cacheLookup(seq, &smv); err == nil {
 			if mb.msgs > 0 {
-				rl := fileStoreMsgSize(m.subj, m.hdr, m.msg)
+				rl := fileStoreMsgSize(m.subj, m.hdr, m.msg) + mb.fs.chunkedSize(seq)
 				mb.msgs--
 				if rl > mb.bytes {
 					rl = mb.bytes
@@ -4571,8 +4833,11 @@ func (mb *msgBlock) truncate(sm *StoreMsg) (nmsgs, nbytes uint64, err error) {
 		}
 		mb.mfd.Truncate(int64(len(buf)))
 		mb.mfd.Sync()
+		mb.dsz = 0
 	} else if mb.mfd != nil {
 		mb.mfd.Truncate(eof)
+		mb.tgen++
+		mb.dsz = 0
 		mb.mfd.Sync()
 		// Update our checksum.
 		var lchk [8]byte
@@ -4690,6 +4955,7 @@ func (mb *msgBlock) clearCacheAndOffset() {
 
 // Lock should be held.
 func (mb *msgBlock) clearCache() {
+	mb.releaseReadAhead()
 	if mb.ctmr != nil {
 		tsla := mb.sinceLastActivity()
 		if mb.fss == nil || tsla > mb.fexp {
@@ -4855,6 +5121,9 @@ func (fs *fileStore) expireMsgs() {
 	minAge := time.Now().UnixNano() - maxAge
 	fs.mu.RUnlock()
 
+	// Partitions that expired as a whole are dropped at once.
+	fs.expirePartitions(minAge)
+
 	for sm, _ = fs.msgForSeq(0, &smv); sm != nil && sm.ts <= minAge; sm, _ = fs.msgForSeq(0, &smv) {
 		fs.mu.Lock()
 		fs.removeMsgViaLimits(sm.seq)
@@ -4878,6 +5147,182 @@ func (fs *fileStore) expireMsgs() {
 	}
 }
 
+// Will track the expirations of the stored messages with a TTL.
+func (fs *fileStore) recoverMsgTTLs() {
+	var smv StoreMsg
+	var ttls msgTTLs
+	for seq := uint64(0); ; seq++ {
+		sm, nseq, err := fs.LoadNextMsg(fwcs, true, seq, &smv)
+		if err != nil {
+			break
+		}
+		if len(sm.hdr) > 0 {
+			if ttl, err := getMessageTTL(sm.hdr); err == nil && ttl > 0 {
+				ttls.add(nseq, sm.ts+int64(ttl))
+			}
+		}
+		seq = nseq
+	}
+	if len(ttls) == 0 {
+		return
+	}
+	fs.mu.Lock()
+	for _, t := range ttls {
+		fs.ttls.add(t.seq, t.expires)
+	}
+	fs.resetTTLChk()
+	fs.mu.Unlock()
+}
+
+const (
+	ttlStateMagic   = uint8(12)
+	ttlStateVersion = uint8(1)
+)
+
+// Encodes the expirations of messages with a TTL along with the last sequence of
+// the state they were taken at. Encrypted if needed and checksummed like the full state.
+// Lock should be held.
+func (fs *fileStore) encodeMsgTTLs() ([]byte, error) {
+	buf := make([]byte, hdrLen, hdrLen+binary.MaxVarintLen64*(2+2*len(fs.ttls))+highwayhash.Size64)
+	buf[0], buf[1] = ttlStateMagic, ttlStateVersion
+	buf = binary.AppendUvarint(buf, fs.state.LastSeq)
+	buf = binary.AppendUvarint(buf, uint64(len(fs.ttls)))
+	for _, t := range fs.ttls {
+		buf = binary.AppendUvarint(buf, t.seq)
+		buf = binary.AppendVarint(buf, t.expires)
+	}
+	if fs.aek != nil {
+		nonce := make([]byte, fs.aek.NonceSize(), fs.aek.NonceSize()+len(buf)+fs.aek.Overhead())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		buf = fs.aek.Seal(nonce, nonce, buf, nil)
+	}
+	fs.hh.Reset()
+	fs.hh.Write(buf)
+	return fs.hh.Sum(buf), nil
+}
+
+// Will track the expirations of messages with a TTL written along with the full state.
+// Only used when the full state was recovered and at the same last sequence.
+func (fs *fileStore) recoverMsgTTLState() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fn := fs.ttlStateFile()
+	<-dios
+	buf, err := os.ReadFile(fn)
+	dios <- struct{}{}
+	if err != nil {
+		return err
+	}
+
+	if len(buf) < hdrLen+highwayhash.Size64 {
+		return errCorruptState
+	}
+	h := buf[len(buf)-highwayhash.Size64:]
+	buf = buf[:len(buf)-highwayhash.Size64]
+	fs.hh.Reset()
+	fs.hh.Write(buf)
+	if !bytes.Equal(h, fs.hh.Sum(nil)) {
+		fs.warn("Stream TTL state checksum did not match")
+		return errCorruptState
+	}
+	if fs.prf != nil {
+		if err := fs.recoverAEK(); err != nil {
+			return err
+		}
+		ns := fs.aek.NonceSize()
+		if len(buf) < ns {
+			return errCorruptState
+		}
+		if buf, err = fs.aek.Open(nil, buf[:ns], buf[ns:], nil); err != nil {
+			return err
+		}
+	}
+	if len(buf) < hdrLen || buf[0] != ttlStateMagic || buf[1] != ttlStateVersion {
+		return errCorruptState
+	}
+
+	bi := hdrLen
+	readU64 := func() uint64 {
+		if bi < 0 {
+			return 0
+		}
+		v, n := binary.Uvarint(buf[bi:])
+		if n <= 0 {
+			bi = -1
+			return 0
+		}
+		bi += n
+		return v
+	}
+	if lseq := readU64(); bi < 0 || lseq != fs.state.LastSeq {
+		return errPriorState
+	}
+	num := readU64()
+	ttls := make(msgTTLs, 0, min(num, uint64(len(buf))))
+	for i := uint64(0); i < num; i++ {
+		seq := readU64()
+		if bi < 0 {
+			return errCorruptState
+		}
+		expires, n := binary.Varint(buf[bi:])
+		if n <= 0 {
+			return errCorruptState
+		}
+		bi += n
+		ttls.add(seq, expires)
+	}
+	for _, t := range ttls {
+		fs.ttls.add(t.seq, t.expires)
+	}
+	fs.resetTTLChk()
+	return nil
+}
+
+// Will arm the TTL timer for the earliest expiration, if it is not armed earlier already.
+// Lock should be held.
+func (fs *fileStore) resetTTLChk() {
+	next := fs.ttls.next()
+	if next == 0 {
+		fs.cancelTTLChk()
+		return
+	}
+	if fs.ttlChk != nil && fs.ttlNext != 0 && fs.ttlNext <= next {
+		return
+	}
+	fs.ttlNext = next
+	if fireIn := msgTTLFireIn(next); fs.ttlChk != nil {
+		fs.ttlChk.Reset(fireIn)
+	} else {
+		fs.ttlChk = time.AfterFunc(fireIn, fs.expireTTLs)
+	}
+}
+
+// Lock should be held.
+func (fs *fileStore) cancelTTLChk() {
+	if fs.ttlChk != nil {
+		fs.ttlChk.Stop()
+		fs.ttlChk = nil
+	}
+	fs.ttlNext = 0
+}
+
+// Will expire msgs whose TTL has passed.
+func (fs *fileStore) expireTTLs() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed || fs.closing {
+		return
+	}
+	fs.ttlNext = 0
+	for _, seq := range fs.ttls.expired(time.Now().UnixNano()) {
+		fs.removeMsgViaLimits(seq)
+	}
+	fs.resetTTLChk()
+}
+
 // Lock should be held.
 func (fs *fileStore) checkAndFlushAllBlocks() {
 	for _, mb := range fs.blks {
@@ -4893,6 +5338,29 @@ func (fs *fileStore) checkAndFlushAllBlocks() {
 	}
 }
 
+// checkMetaFile reads the meta file in dir and checks it against its checksum.
+// Streams key the checksum by their name, consumers by the stream and consumer name.
+func checkMetaFile(dir, key string) ([]byte, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, JetStreamMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	sum, err := os.ReadFile(filepath.Join(dir, JetStreamMetaFileSum))
+	if err != nil {
+		return nil, err
+	}
+	hkey := sha256.Sum256([]byte(key))
+	hh, err := highwayhash.New64(hkey[:])
+	if err != nil {
+		return nil, err
+	}
+	hh.Write(buf)
+	if hex.EncodeToString(hh.Sum(nil)) != string(sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return buf, nil
+}
+
 // This will check all the checksums on messages and report back any sequence numbers with errors.
 func (fs *fileStore) checkMsgs() *LostStreamData {
 	fs.mu.Lock()
@@ -4925,11 +5393,14 @@ func (mb *msgBlock) enableForWriting(fip bool) error {
 	if mb.mfd != nil {
 		return nil
 	}
+	if mb.tiered {
+		return errBlockTiered
+	}
 	<-dios
 	mfd, err := os.OpenFile(mb.mfn, os.O_CREATE|os.O_RDWR, defaultFilePerms)
 	dios <- struct{}{}
 	if err != nil {
-		return fmt.Errorf("error opening msg block file [%q]: %v", mb.mfn, err)
+		return fmt.Errorf("error opening msg block file [%q]: %w", mb.mfn, err)
 	}
 	mb.mfd = mfd
 
@@ -5116,6 +5587,7 @@ func (mb *msgBlock) closeFDsLockedNoCheck() {
 		mb.mfd.Close()
 		mb.mfd = nil
 	}
+	mb.closeDirect()
 }
 
 // bytesPending returns the buffer to be used for writing to the underlying file.
@@ -5178,25 +5650,49 @@ func (fs *fileStore) writeMsgRecord(seq uint64, ts int64, subj string, hdr, msg
 	if rl&hbit != 0 {
 		return 0, ErrMsgTooLarge
 	}
+	// Messages larger than a block can be stored in chunks instead of growing the block to fit.
+	if fs.shouldChunk(rl, hdr, msg) {
+		return fs.writeChunkedMsgRecord(seq, ts, subj, hdr, msg)
+	}
 	// Grab our current last message block.
 	mb := fs.lmb
 
 	// Mark as dirty for stream state.
 	fs.dirty++
 
-	if mb == nil || mb.msgs > 0 && mb.blkSize()+rl > fs.fcfg.BlockSize {
+	if fs.needsNewBlock(mb, ts, rl) {
+		// An empty block of another time partition is replaced instead of kept around.
+		if fs.removeUnusedPartitionBlock(mb) {
+			mb = nil
+		}
+		if mb != nil && fs.gcommit {
+			// The group is only committed on the last block.
+			mb.flushPendingGroup()
+		}
 		if mb != nil && fs.fcfg.Compression != NoCompression {
 			// We've now reached the end of this message block, if we want
 			// to compress blocks then now's the time to do it.
 			go mb.recompressOnDiskIfNeeded()
 		}
-		if mb, err = fs.newMsgBlockForWrite(); err != nil {
+		if mb, err = fs.newMsgBlockForWriteAt(ts); err != nil {
+			return 0, err
+		}
+	}
+
+	flush := fs.fip
+	if fs.gcommit {
+		// Held in the cache until the group is committed, without a flusher.
+		flush = false
+		mb.mu.Lock()
+		err = mb.enableForWriting(true)
+		mb.mu.Unlock()
+		if err != nil {
 			return 0, err
 		}
 	}
 
 	// Ask msg block to store in write through cache.
-	err = mb.writeMsgRecord(rl, seq, subj, hdr, msg, ts, fs.fip)
+	err = mb.writeMsgRecord(rl, seq, subj, hdr, msg, ts, flush)
 
 	return rl, err
 }
@@ -5242,6 +5738,7 @@ func (mb *msgBlock) recompressOnDiskIfNeeded() error {
 	if err != nil {
 		return fmt.Errorf("failed to read original block from disk: %w", err)
 	}
+	origBuf = origBuf[:mb.dataSize(int64(len(origBuf)))]
 
 	// If the block is encrypted then we will need to decrypt it before
 	// doing anything. We always encrypt after compressing because then the
@@ -5350,6 +5847,7 @@ func (mb *msgBlock) recompressOnDiskIfNeeded() error {
 
 	// Also update rbytes
 	mb.rbytes = uint64(len(cmpBuf))
+	mb.dsz = 0
 
 	return nil
 }
@@ -5385,7 +5883,7 @@ func (mb *msgBlock) ensureRawBytesLoaded() error {
 	}
 	defer f.Close()
 	if fi, err := f.Stat(); fi != nil && err == nil {
-		mb.rbytes = uint64(fi.Size())
+		mb.rbytes = uint64(mb.dataSize(fi.Size()))
 	} else {
 		return err
 	}
@@ -5407,6 +5905,8 @@ func (fs *fileStore) syncBlocks() {
 	fs.mu.Unlock()
 
 	var markDirty bool
+	var compacted int
+	var reclaimed uint64
 	for _, mb := range blks {
 		// Do actual sync. Hold lock for consistency.
 		mb.mu.Lock()
@@ -5445,7 +5945,12 @@ func (fs *fileStore) syncBlocks() {
 		if needsCompact {
 			fs.mu.RLock()
 			mb.mu.Lock()
+			rbytes := mb.rbytes
 			mb.compactWithFloor(firstSeq)
+			if mb.rbytes < rbytes {
+				compacted++
+				reclaimed += rbytes - mb.rbytes
+			}
 			// If this compact removed all raw bytes due to tombstone cleanup, schedule to remove.
 			shouldRemove := mb.rbytes == 0
 			mb.mu.Unlock()
@@ -5478,7 +5983,9 @@ func (fs *fileStore) syncBlocks() {
 			}
 			// If we have an fd.
 			if fd != nil {
+				start := time.Now()
 				canClear := fd.Sync() == nil
+				fs.stats.sync(start)
 				// If we opened the file close the fd.
 				if didOpen {
 					fd.Close()
@@ -5501,10 +6008,20 @@ func (fs *fileStore) syncBlocks() {
 	if markDirty {
 		fs.dirty++
 	}
+	if ccb := fs.ccb; ccb != nil && compacted > 0 {
+		// Do not hold the lock while reporting.
+		fs.mu.Unlock()
+		ccb(compacted, reclaimed)
+		fs.mu.Lock()
+		if fs.closed {
+			fs.mu.Unlock()
+			return
+		}
+	}
 
 	// Sync state file if we are not running with sync always.
 	if !fs.fcfg.SyncAlways {
-		fn := filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile)
+		fn := fs.stateFile()
 		<-dios
 		fd, _ := os.OpenFile(fn, os.O_RDWR, defaultFilePerms)
 		dios <- struct{}{}
@@ -5755,10 +6272,13 @@ func (mb *msgBlock) writeAt(buf []byte, woff int64) (int, error) {
 		mb.mockWriteErr = false
 		return 0, errors.New("mock write error")
 	}
+	mb.tgen++
 	<-dios
-	n, err := mb.mfd.WriteAt(buf, woff)
-	dios <- struct{}{}
-	return n, err
+	defer func() { dios <- struct{}{} }()
+	if mb.directIO() {
+		return mb.writeDirect(buf, woff)
+	}
+	return mb.mfd.WriteAt(buf, woff)
 }
 
 // flushPendingMsgsLocked writes out any messages for this message block.
@@ -5831,7 +6351,7 @@ func (mb *msgBlock) flushPendingMsgsLocked() (*LostStreamData, error) {
 
 	// Check if we are in sync always mode.
 	if mb.syncAlways {
-		mb.mfd.Sync()
+		mb.syncWithStats()
 	} else {
 		mb.needSync = true
 	}
@@ -5907,6 +6427,9 @@ func (mb *msgBlock) fssNotLoaded() bool {
 // Wrap openBlock for the gated semaphore processing.
 // Lock should be held
 func (mb *msgBlock) openBlock() (*os.File, error) {
+	if mb.tiered {
+		return nil, errBlockTiered
+	}
 	// Gate with concurrent IO semaphore.
 	<-dios
 	f, err := os.Open(mb.mfn)
@@ -5940,7 +6463,7 @@ func (mb *msgBlock) loadBlock(buf []byte) ([]byte, error) {
 
 	var sz int
 	if info, err := f.Stat(); err == nil {
-		sz64 := info.Size()
+		sz64 := mb.dataSize(info.Size())
 		if int64(int(sz64)) == sz64 {
 			sz = int(sz64)
 		} else {
@@ -5975,6 +6498,11 @@ func (mb *msgBlock) loadBlock(buf []byte) ([]byte, error) {
 
 // Lock should be held.
 func (mb *msgBlock) loadMsgsWithLock() error {
+	// Fetch the block back first if it was offloaded, this releases the lock while fetching.
+	if err := mb.fetchTiered(); err != nil {
+		return err
+	}
+
 	// Check for encryption, we do not load keys on startup anymore so might need to load them here.
 	if mb.fs != nil && mb.fs.prf != nil && (mb.aek == nil || mb.bek == nil) {
 		if err := mb.fs.loadEncryptionForMsgBlock(mb); err != nil {
@@ -6098,7 +6626,11 @@ func (mb *msgBlock) fetchMsg(seq uint64, sm *StoreMsg) (*StoreMsg, bool, error)
 		return nil, expireOk, errDeletedMsg
 	}
 
-	if mb.cacheNotLoaded() {
+	notLoaded := mb.cacheNotLoaded()
+	if mb.fs != nil {
+		mb.fs.stats.cacheLookup(!notLoaded)
+	}
+	if notLoaded {
 		if err := mb.loadMsgsWithLock(); err != nil {
 			return nil, false, err
 		}
@@ -6241,7 +6773,7 @@ func (fs *fileStore) sizeForSeq(seq uint64) int {
 	var smv StoreMsg
 	if mb := fs.selectMsgBlock(seq); mb != nil {
 		if sm, _, _ := mb.fetchMsg(seq, &smv); sm != nil {
-			return int(fileStoreMsgSize(sm.subj, sm.hdr, sm.msg))
+			return int(fileStoreMsgSize(sm.subj, sm.hdr, sm.msg) + fs.chunkedSize(seq))
 		}
 	}
 	return 0
@@ -6261,7 +6793,8 @@ func (fs *fileStore) msgForSeq(seq uint64, sm *StoreMsg) (*StoreMsg, error) {
 		seq = fs.state.FirstSeq
 	}
 	// Make sure to snapshot here.
-	mb, lseq := fs.selectMsgBlock(seq), fs.state.LastSeq
+	bi, mb := fs.selectMsgBlockWithIndex(seq)
+	lseq, ra := fs.state.LastSeq, fs.fcfg.readAhead != nil
 	fs.mu.RUnlock()
 
 	if mb == nil {
@@ -6282,13 +6815,23 @@ func (fs *fileStore) msgForSeq(seq uint64, sm *StoreMsg) (*StoreMsg, error) {
 	if expireOk {
 		mb.tryForceExpireCache()
 	}
+	if ra {
+		fs.mu.RLock()
+		fs.readAhead(mb, bi, seq)
+		fs.mu.RUnlock()
+	}
 
-	return fsm, nil
+	return fs.loadChunks(fsm)
 }
 
 // Internal function to return msg parts from a raw buffer.
 // Lock should be held.
 func (mb *msgBlock) msgFromBuf(buf []byte, sm *StoreMsg, hh hash.Hash64) (*StoreMsg, error) {
+	return msgFromBuf(buf, sm, hh)
+}
+
+// Returns the msg parts of the record at the start of buf, checking its checksum if hh is set.
+func msgFromBuf(buf []byte, sm *StoreMsg, hh hash.Hash64) (*StoreMsg, error) {
 	if len(buf) < emptyRecordLen {
 		return nil, errBadMsg
 	}
@@ -6356,6 +6899,41 @@ func (mb *msgBlock) msgFromBuf(buf []byte, sm *StoreMsg, hh hash.Hash64) (*Store
 	return sm, nil
 }
 
+// catchupBlock returns the message block that starts at seq, to be sent whole to a
+// replica that is catching up. Only blocks we no longer write to and that end at or
+// before last qualify, otherwise this returns nil and messages are sent one by one.
+// Any sequences from seq up to the first message of the block were deleted.
+func (fs *fileStore) catchupBlock(seq, last uint64) *catchupBlock {
+	fs.mu.RLock()
+	mb := fs.selectMsgBlock(seq)
+	sealed := mb != nil && mb != fs.lmb
+	fs.mu.RUnlock()
+	if !sealed {
+		return nil
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	first, lseq := atomic.LoadUint64(&mb.first.seq), atomic.LoadUint64(&mb.last.seq)
+	if mb.closed || seq > first || lseq > last || mb.msgs == 0 {
+		return nil
+	}
+	// Chunked messages are not held in the block.
+	if fs.hasChunksWithin(first, lseq) {
+		return nil
+	}
+	if err := mb.loadMsgsWithLock(); err != nil || !mb.cacheAlreadyLoaded() {
+		return nil
+	}
+	cb := &catchupBlock{index: mb.index, first: seq, last: lseq, buf: copyBytes(mb.cache.buf)}
+	mb.dmap.Range(func(dseq uint64) bool {
+		cb.deleted = append(cb.deleted, dseq)
+		return true
+	})
+	return cb
+}
+
 // LoadMsg will lookup the message by sequence number and return it if found.
 func (fs *fileStore) LoadMsg(seq uint64, sm *StoreMsg) (*StoreMsg, error) {
 	return fs.msgForSeq(seq, sm)
@@ -6439,7 +7017,10 @@ func (fs *fileStore) loadLast(subj string, sm *StoreMsg) (lsm *StoreMsg, err err
 			break
 		}
 	}
-	return lsm, err
+	if err != nil {
+		return nil, err
+	}
+	return fs.loadChunks(lsm)
 }
 
 // LoadLastMsg will return the last message we have that matches a given subject.
@@ -6481,6 +7062,10 @@ func (fs *fileStore) LoadNextMsgMulti(sl *Sublist, start uint64, smp *StoreMsg)
 				if expireOk {
 					mb.tryForceExpireCache()
 				}
+				fs.readAhead(mb, i, sm.seq)
+				if sm, err = fs.loadChunks(sm); err != nil {
+					return nil, 0, err
+				}
 				return sm, sm.seq, nil
 			} else if err != ErrStoreMsgNotFound {
 				return nil, 0, err
@@ -6530,6 +7115,10 @@ func (fs *fileStore) LoadNextMsg(filter string, wc bool, start uint64, sm *Store
 				if expireOk {
 					mb.tryForceExpireCache()
 				}
+				fs.readAhead(mb, i, sm.seq)
+				if sm, err = fs.loadChunks(sm); err != nil {
+					return nil, 0, err
+				}
 				return sm, sm.seq, nil
 			} else if err != ErrStoreMsgNotFound {
 				return nil, 0, err
@@ -6937,7 +7526,7 @@ func (fs *fileStore) PurgeEx(subject string, sequence, keep uint64) (purged uint
 
 		for seq := f; seq <= l; seq++ {
 			if sm, _ := mb.cacheLookup(seq, &smv); sm != nil && eq(sm.subj, subject) {
-				rl := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+				rl := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg) + fs.chunkedSize(seq)
 				// Do fast in place remove.
 				// Stats
 				if mb.msgs > 0 {
@@ -7009,7 +7598,8 @@ func (fs *fileStore) PurgeEx(subject string, sequence, keep uint64) (purged uint
 		}
 	}
 
-	os.Remove(filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile))
+	fs.removeStaleChunks()
+	os.Remove(fs.stateFile())
 	fs.dirty++
 	cb := fs.scb
 	fs.mu.Unlock()
@@ -7045,6 +7635,9 @@ func (fs *fileStore) purge(fseq uint64) (uint64, error) {
 
 	for _, mb := range fs.blks {
 		mb.dirtyClose()
+		mb.mu.Lock()
+		mb.removeFromTier()
+		mb.mu.Unlock()
 	}
 
 	fs.blks = nil
@@ -7055,6 +7648,9 @@ func (fs *fileStore) purge(fseq uint64) (uint64, error) {
 	// Mark dirty.
 	fs.dirty++
 
+	// The chunks of large messages go with the msgs directory.
+	fs.resetChunks()
+
 	// Move the msgs directory out of the way, will delete out of band.
 	// FIXME(dlc) - These can error and we need to change api above to propagate?
 	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
@@ -7070,9 +7666,15 @@ func (fs *fileStore) purge(fseq uint64) (uint64, error) {
 	<-dios
 	os.Rename(mdir, pdir)
 	dios <- struct{}{}
+	// Time partition directories went with it.
+	fs.pdirs = nil
 
+	secure := fs.secureErase()
 	go func() {
 		<-dios
+		if secure {
+			overwriteDir(pdir)
+		}
 		os.RemoveAll(pdir)
 		dios <- struct{}{}
 	}()
@@ -7191,7 +7793,13 @@ func (fs *fileStore) Compact(seq uint64) (uint64, error) {
 				smb.dmap.Delete(seq)
 			}
 		} else if sm != nil {
-			sz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+			sz := fileStoreMsgSize(sm.subj, sm.hdr, sm.msg) + fs.chunkedSize(mseq)
+			if fs.secureErase() {
+				ri, rl, _, _ := smb.slotInfo(int(mseq - smb.cache.fseq))
+				if err := smb.eraseMsg(mseq, int(ri), int(rl)); err != nil {
+					fs.warn("Failed to erase message %d: %v", mseq, err)
+				}
+			}
 			if smb.msgs > 0 {
 				smb.msgs--
 				if sz > smb.bytes {
@@ -7307,9 +7915,11 @@ SKIP:
 	}
 	fs.state.Bytes -= bytes
 
+	fs.removeStaleChunks()
+
 	// Any existing state file no longer applicable. We will force write a new one
 	// after we release the lock.
-	os.Remove(filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile))
+	os.Remove(fs.stateFile())
 	fs.dirty++
 
 	cb := fs.scb
@@ -7365,6 +7975,7 @@ func (fs *fileStore) reset() error {
 	// Reset subject mappings.
 	fs.psim, fs.tsl = fs.psim.Empty(), 0
 	fs.bim = make(map[uint32]*msgBlock)
+	fs.removeStaleChunks()
 
 	// If we purged anything, make sure we kick flush state loop.
 	if purged > 0 {
@@ -7504,9 +8115,11 @@ func (fs *fileStore) Truncate(seq uint64) error {
 		}
 	}
 
+	fs.removeStaleChunks()
+
 	// Any existing state file no longer applicable. We will force write a new one
 	// after we release the lock.
-	os.Remove(filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile))
+	os.Remove(fs.stateFile())
 	fs.dirty++
 
 	cb := fs.scb
@@ -7558,6 +8171,7 @@ func (fs *fileStore) removeMsgBlockFromList(mb *msgBlock) {
 			if fs.bim != nil {
 				delete(fs.bim, mb.index)
 			}
+			delete(fs.pdirs, mb.index)
 			break
 		}
 	}
@@ -7610,16 +8224,23 @@ func (mb *msgBlock) dirtyCloseWithRemove(remove bool) {
 		mb.mfd.Close()
 		mb.mfd = nil
 	}
+	mb.closeDirect()
 	if remove {
 		// Clear any tracking by subject if we are removing.
 		mb.fss = nil
 		if mb.mfn != _EMPTY_ {
+			if mb.fs != nil && mb.fs.secureErase() {
+				overwriteFile(mb.mfn)
+			}
 			os.Remove(mb.mfn)
 			mb.mfn = _EMPTY_
 		}
 		if mb.kfn != _EMPTY_ {
 			os.Remove(mb.kfn)
 		}
+		mb.removeFromTier()
+		// The last block of a time partition takes its directory with it.
+		mb.removePartitionDir()
 	}
 }
 
@@ -7854,6 +8475,8 @@ func (mb *msgBlock) close(sync bool) {
 		mb.mfd.Close()
 	}
 	mb.mfd = nil
+	mb.closeDirect()
+	mb.truncatePadding()
 	// Mark as closed.
 	mb.closed = true
 }
@@ -7868,6 +8491,7 @@ func (fs *fileStore) Delete() error {
 	if fs.isClosed() {
 		// Always attempt to remove since we could have been closed beforehand.
 		os.RemoveAll(fs.fcfg.StoreDir)
+		fs.removeIndexDir()
 		// Since we did remove, if we did have anything remaining make sure to
 		// call into any storage updates that had been registered.
 		fs.mu.Lock()
@@ -7892,6 +8516,9 @@ func (fs *fileStore) Delete() error {
 	fs.mu.Lock()
 	for _, mb := range fs.blks {
 		mb.dirtyClose()
+		mb.mu.Lock()
+		mb.removeFromTier()
+		mb.mu.Unlock()
 	}
 	dmsgs := fs.state.Msgs
 	dbytes := int64(fs.state.Bytes)
@@ -7912,6 +8539,7 @@ func (fs *fileStore) Delete() error {
 	if err := os.Remove(filepath.Join(fs.fcfg.StoreDir, JetStreamMetaFile)); err != nil {
 		return err
 	}
+	fs.removeIndexDir()
 	// Now move into different directory with "." prefix.
 	ndir := filepath.Join(filepath.Dir(fs.fcfg.StoreDir), tsep+filepath.Base(fs.fcfg.StoreDir))
 	if err := os.Rename(fs.fcfg.StoreDir, ndir); err != nil {
@@ -8150,12 +8778,22 @@ func (fs *fileStore) _writeFullState(force bool) error {
 		buf = fs.aek.Seal(nonce, nonce, buf, nil)
 	}
 
-	fn := filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile)
+	fn := fs.stateFile()
 
 	fs.hh.Reset()
 	fs.hh.Write(buf)
 	buf = fs.hh.Sum(buf)
 
+	// The expirations of messages with a TTL are kept next to the state to not rebuild them on recovery.
+	var tbuf []byte
+	if fs.cfg.AllowMsgTTL {
+		var err error
+		if tbuf, err = fs.encodeMsgTTLs(); err != nil {
+			fs.mu.Unlock()
+			return err
+		}
+	}
+
 	// Snapshot prior dirty count.
 	priorDirty := fs.dirty
 
@@ -8180,9 +8818,14 @@ func (fs *fileStore) _writeFullState(force bool) error {
 		fs.warn("WriteFullState took %v (%d bytes)", took.Round(time.Millisecond), len(buf))
 	}
 
-	// Write our update index.db
+	// Write our update index.db, with the TTLs first so they are never older than it.
 	// Protect with dios.
 	<-dios
+	if tbuf != nil {
+		if tfn := fs.ttlStateFile(); os.WriteFile(tfn, tbuf, defaultFilePerms) != nil {
+			os.Remove(tfn)
+		}
+	}
 	err := os.WriteFile(fn, buf, defaultFilePerms)
 	dios <- struct{}{}
 
@@ -8220,6 +8863,8 @@ func (fs *fileStore) stop(delete, writeState bool) error {
 
 	fs.cancelSyncTimer()
 	fs.cancelAgeChk()
+	fs.cancelTTLChk()
+	fs.cancelTierTimer()
 
 	// Release the state flusher loop.
 	if fs.qch != nil {
@@ -8273,18 +8918,27 @@ const errFile = "errors.txt"
 func (fs *fileStore) streamSnapshot(w io.WriteCloser, includeConsumers bool) {
 	defer w.Close()
 
-	enc := s2.NewWriter(w)
-	defer enc.Close()
-
-	tw := tar.NewWriter(enc)
-	defer tw.Close()
-
 	defer func() {
 		fs.mu.Lock()
 		fs.sips--
 		fs.mu.Unlock()
 	}()
 
+	// Check if the snapshot should be encrypted.
+	var sw io.Writer = w
+	if fs.fcfg.EncryptSnapshots && fs.prf != nil {
+		var err error
+		if sw, err = newSnapshotEncrypter(w, fs.fcfg.Cipher, fs.prf, fs.cfg.Name); err != nil {
+			return
+		}
+	}
+
+	enc := s2.NewWriter(sw)
+	defer enc.Close()
+
+	tw := tar.NewWriter(enc)
+	defer tw.Close()
+
 	modTime := time.Now().UTC()
 
 	writeFile := func(name string, buf []byte) error {
@@ -8371,16 +9025,22 @@ func (fs *fileStore) streamSnapshot(w io.WriteCloser, includeConsumers bool) {
 		mb.mu.Unlock()
 
 		// Do this one unlocked.
-		if writeFile(msgPre+fmt.Sprintf(blkScan, mb.index), bbuf) != nil {
+		if writeFile(msgPre+mb.partitionPrefix()+fmt.Sprintf(blkScan, mb.index), bbuf) != nil {
 			return
 		}
 	}
 
+	// The chunks of large messages go next to the blocks.
+	if err := fs.snapshotChunks(writeFile); err != nil {
+		writeErr(fmt.Sprintf("Could not read message chunks: %v", err))
+		return
+	}
+
 	// Do index.db last. We will force a write as well.
 	// Write out full state as well before proceeding.
 	if err := fs.forceWriteFullState(); err == nil {
 		const minLen = 32
-		sfn := filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile)
+		sfn := fs.stateFile()
 		if buf, err := os.ReadFile(sfn); err == nil && len(buf) >= minLen {
 			if fs.aek != nil {
 				ns := fs.aek.NonceSize()
@@ -8496,6 +9156,16 @@ func (fs *fileStore) fileStoreConfig() FileStoreConfig {
 	return fs.fcfg
 }
 
+// Changes the block size, existing blocks are kept and newly written blocks use the new size.
+func (fs *fileStore) setBlockSize(blkSize uint64) {
+	if blkSize == 0 || blkSize > maxBlockSize {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.fcfg.BlockSize = blkSize
+}
+
 // Read lock all existing message blocks.
 // Lock held on entry.
 func (fs *fileStore) readLockAllMsgBlocks() {
@@ -8589,6 +9259,15 @@ func (fs *fileStore) deleteBlocks() DeleteBlocks {
 	return dbs
 }
 
+// Returns the gaps of deleted messages as ranges, without going through the messages.
+func (fs *fileStore) deletedRanges() []SequenceRange {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	fs.readLockAllMsgBlocks()
+	defer fs.readUnlockAllMsgBlocks()
+	return fs.deleteBlocks().ranges()
+}
+
 // SyncDeleted will make sure this stream has same deleted state as dbs.
 // This will only process deleted state within our current state.
 func (fs *fileStore) SyncDeleted(dbs DeleteBlocks) {
@@ -8673,7 +9352,7 @@ func (fs *fileStore) ConsumerStore(name string, cfg *ConsumerConfig) (ConsumerSt
 
 	odir := filepath.Join(fs.fcfg.StoreDir, consumerDir, name)
 	if err := os.MkdirAll(odir, defaultDirPerms); err != nil {
-		return nil, fmt.Errorf("could not create consumer directory - %v", err)
+		return nil, fmt.Errorf("could not create consumer directory - %w", err)
 	}
 	csi := &FileConsumerInfo{Name: name, Created: time.Now().UTC(), ConsumerConfig: *cfg}
 	o := &consumerFileStore{
@@ -8684,7 +9363,7 @@ func (fs *fileStore) ConsumerStore(name string, cfg *ConsumerConfig) (ConsumerSt
 		odir: odir,
 		ifn:  filepath.Join(odir, consumerState),
 	}
-	key := sha256.Sum256([]byte(fs.cfg.Name + "/" + name))
+	key := sha256.Sum256([]byte(fs.hname + "/" + name))
 	hh, err := highwayhash.New64(key[:])
 	if err != nil {
 		return nil, fmt.Errorf("could not create hash: %v", err)
@@ -8975,6 +9654,10 @@ func (o *consumerFileStore) UpdateDelivered(dseq, sseq, dc uint64, ts int64) err
 			if p = o.state.Pending[sseq]; p != nil {
 				// Do not update p.Sequence, that should be the original delivery sequence.
 				p.Timestamp = ts
+			} else if dc == 1 && (o.cfg.Shared || o.cfg.DeliverOrder == DeliverOrderLIFO || o.cfg.DeliverOrder == DeliverOrderHeader) && sseq > o.state.AckFloor.Stream {
+				// Shared consumers deliver the messages released by another one after later ones,
+				// and consumers not delivering in FIFO order deliver older ones after later ones.
+				o.state.Pending[sseq] = &Pending{dseq, ts}
 			}
 		} else {
 			// Add to pending.
@@ -9100,6 +9783,24 @@ func (o *consumerFileStore) UpdateAcks(dseq, sseq uint64) error {
 	return nil
 }
 
+// UpdateAcksUpTo is called whenever a consumer with explicit ack acks all pending messages up to a sequence.
+func (o *consumerFileStore) UpdateAcksUpTo(sseq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cfg.AckPolicy != AckExplicit {
+		return ErrNoAckPolicy
+	}
+	// On restarts the old leader may get a replay from the raft logs that are old.
+	if sseq <= o.state.AckFloor.Stream {
+		return nil
+	}
+	o.state.ackUpTo(sseq)
+
+	o.kickFlusher()
+	return nil
+}
+
 const seqsHdrSize = 6*binary.MaxVarintLen64 + hdrLen
 
 // Encode our consumer state, version 2.
@@ -9177,6 +9878,14 @@ func (o *consumerFileStore) Update(state *ConsumerState) error {
 	return nil
 }
 
+// Reset will replace our state, even if it is older than the one we have.
+func (o *consumerFileStore) Reset(state *ConsumerState) error {
+	o.mu.Lock()
+	o.state.Delivered, o.state.AckFloor = SequencePair{}, SequencePair{}
+	o.mu.Unlock()
+	return o.Update(state)
+}
+
 // Will encrypt the state with our asset key. Will be a no-op if encryption not enabled.
 // Lock should be held.
 func (o *consumerFileStore) encryptState(buf []byte) ([]byte, error) {
@@ -9696,7 +10405,7 @@ func newTemplateFileStore(storeDir string) *templateFileStore {
 func (ts *templateFileStore) Store(t *streamTemplate) error {
 	dir := filepath.Join(ts.dir, t.Name)
 	if err := os.MkdirAll(dir, defaultDirPerms); err != nil {
-		return fmt.Errorf("could not create templates storage directory for %q- %v", t.Name, err)
+		return fmt.Errorf("could not create templates storage directory for %q- %w", t.Name, err)
 	}
 	meta := filepath.Join(dir, JetStreamMetaFile)
 	if _, err := os.Stat(meta); (err != nil && !os.IsNotExist(err)) || err == nil {
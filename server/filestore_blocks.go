@@ -0,0 +1,128 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StreamBlocks reports the message blocks of file storage and the files they hold open.
+type StreamBlocks struct {
+	Blocks    int `json:"blocks"`
+	OpenFiles int `json:"open_files"`
+	// Max is the most message blocks the stream keeps, if limited.
+	Max int `json:"max,omitempty"`
+}
+
+// Checks the maximum number of message blocks of a stream against the limit of the server.
+func validateMaxBlocks(cfg *StreamConfig, limit int) error {
+	if cfg.MaxBlocks == 0 {
+		return nil
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("max blocks requires file storage")
+	}
+	// The last block is written to, so at least one more is needed to move on.
+	if cfg.MaxBlocks < 2 {
+		return errors.New("max blocks can not be less than 2")
+	}
+	if limit > 0 && cfg.MaxBlocks > limit {
+		return fmt.Errorf("max blocks can not exceed the server limit of %d", limit)
+	}
+	return nil
+}
+
+// Returns the most message blocks the store keeps, 0 if not limited.
+// Lock should be held.
+func (fs *fileStore) maxBlocks() int {
+	if fs.cfg.MaxBlocks > 0 {
+		return fs.cfg.MaxBlocks
+	}
+	return fs.fcfg.MaxBlocks
+}
+
+// Returns true if writing a record of size rl at ts needs a new block.
+// Partitioned streams also start a new block with every time partition.
+// Lock should be held.
+func (fs *fileStore) needsNewBlock(mb *msgBlock, ts int64, rl uint64) bool {
+	if mb == nil || mb.msgs > 0 && mb.blkSize()+rl > fs.fcfg.BlockSize {
+		return true
+	}
+	pi := fs.cfg.PartitionInterval
+	return pi > 0 && mb.partitionEnded(ts, pi)
+}
+
+// Returns true if writing a record of size rl at ts needs a new block
+// while the store already has the most blocks it keeps.
+// Lock should be held.
+func (fs *fileStore) blockLimitReached(ts int64, rl uint64) bool {
+	max := fs.maxBlocks()
+	return max > 0 && len(fs.blks) >= max && fs.needsNewBlock(fs.lmb, ts, rl)
+}
+
+// Will check the block limit and drop the messages of the first block if needed.
+// Blocks that only hold tombstones are kept, they are removed once compacted.
+// Lock should be held.
+func (fs *fileStore) enforceBlockLimit() {
+	if fs.cfg.Discard != DiscardOld {
+		return
+	}
+	max := fs.maxBlocks()
+	if max <= 0 {
+		return
+	}
+	for len(fs.blks) > max {
+		fmb := fs.blks[0]
+		fmb.mu.RLock()
+		msgs := fmb.msgs
+		fmb.mu.RUnlock()
+		if fmb == fs.lmb || msgs == 0 {
+			return
+		}
+		if removed, err := fs.deleteFirstMsg(); err != nil || !removed {
+			fs.rebuildFirst()
+			return
+		}
+	}
+}
+
+// Returns the message blocks of the store and the files they hold open.
+func (fs *fileStore) blockStats() *StreamBlocks {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	bs := &StreamBlocks{Blocks: len(fs.blks), Max: fs.maxBlocks()}
+	for _, mb := range fs.blks {
+		mb.mu.RLock()
+		if mb.mfd != nil {
+			bs.OpenFiles++
+		}
+		if mb.dfd != nil {
+			bs.OpenFiles++
+		}
+		mb.mu.RUnlock()
+	}
+	return bs
+}
+
+// Returns the message blocks of the stream, for file storage.
+func (mset *stream) blocks() *StreamBlocks {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fs.blockStats()
+}
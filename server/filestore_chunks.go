@@ -0,0 +1,359 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+const (
+	// This is where we keep the chunks of messages larger than a block, next to the blocks.
+	chunkDir = "chunks"
+	// used to scan chunk file names, by sequence and index of the chunk.
+	chunkScan = "%d.%d.chk"
+	// The first chunk starts with the length of the headers and of headers and payload together.
+	chunkHdrSize = 12
+)
+
+var errBadChunks = errors.New("message chunks missing or corrupt")
+
+// Tracks the chunks of a message stored apart from its block.
+type msgChunks struct {
+	num  int    // number of chunk files
+	size uint64 // bytes accounted for the message on top of its record
+}
+
+// Checks the chunking of large messages of a stream.
+func validateChunkLargeMsgs(cfg *StreamConfig) error {
+	if cfg.ChunkLargeMsgs && cfg.Storage != FileStorage {
+		return errors.New("chunking large messages requires file storage")
+	}
+	return nil
+}
+
+// Returns the directory holding the chunks of large messages.
+func (fs *fileStore) chunkDir() string {
+	return filepath.Join(fs.fcfg.StoreDir, msgDir, chunkDir)
+}
+
+// Returns true if a message with a record of length rl should be stored in chunks.
+// Encrypted stores keep large messages in their blocks.
+// Lock should be held.
+func (fs *fileStore) shouldChunk(rl uint64, hdr, msg []byte) bool {
+	return fs.cfg.ChunkLargeMsgs && fs.prf == nil && rl > fs.fcfg.BlockSize && len(hdr)+len(msg) > 0
+}
+
+// Returns the bytes accounted for a chunked message on top of its record, 0 if not chunked.
+// This makes the message accounted at its full size, as if it was stored in its block.
+func (fs *fileStore) chunkedSize(seq uint64) uint64 {
+	if fs.nchunks.Load() == 0 {
+		return 0
+	}
+	fs.chmu.Lock()
+	defer fs.chmu.Unlock()
+	return fs.chunks[seq].size
+}
+
+// Stores the headers and payload of a message in chunks of the block size apart from the blocks,
+// while the block holds a record for the message without them. Returns the record length,
+// which accounts for the message at its full size.
+// Lock should be held.
+func (fs *fileStore) writeChunkedMsgRecord(seq uint64, ts int64, subj string, hdr, msg []byte) (uint64, error) {
+	mc, err := fs.writeChunks(seq, hdr, msg)
+	if err != nil {
+		return 0, err
+	}
+	rl, err := fs.writeMsgRecord(seq, ts, subj, nil, nil)
+	if err != nil {
+		fs.removeChunks(seq, false)
+		return 0, err
+	}
+	mb := fs.lmb
+	mb.mu.Lock()
+	mb.bytes += mc.size
+	mb.mu.Unlock()
+	return rl + mc.size, nil
+}
+
+// Writes the chunk files of a message and tracks them.
+// Lock should be held.
+func (fs *fileStore) writeChunks(seq uint64, hdr, msg []byte) (mc msgChunks, err error) {
+	dir := fs.chunkDir()
+	if err = os.MkdirAll(dir, defaultDirPerms); err != nil {
+		return mc, err
+	}
+	// Anything left behind for this sequence, e.g. before a truncate, is replaced.
+	fs.removeChunks(seq, false)
+
+	var frame [chunkHdrSize]byte
+	binary.LittleEndian.PutUint32(frame[0:], uint32(len(hdr)))
+	binary.LittleEndian.PutUint64(frame[4:], uint64(len(hdr)+len(msg)))
+	parts := [][]byte{frame[:], hdr, msg}
+
+	defer func() {
+		if err != nil {
+			for i := 0; i <= mc.num; i++ {
+				os.Remove(filepath.Join(dir, fmt.Sprintf(chunkScan, seq, i)))
+			}
+		}
+	}()
+	for len(parts) > 0 {
+		var f *os.File
+		f, err = os.OpenFile(filepath.Join(dir, fmt.Sprintf(chunkScan, seq, mc.num)), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, defaultFilePerms)
+		if err != nil {
+			return mc, err
+		}
+		for left := int(fs.fcfg.BlockSize); left > 0 && len(parts) > 0; {
+			p := parts[0]
+			if len(p) > left {
+				p = p[:left]
+			}
+			if _, err = f.Write(p); err != nil {
+				break
+			}
+			left -= len(p)
+			if parts[0] = parts[0][len(p):]; len(parts[0]) == 0 {
+				parts = parts[1:]
+			}
+		}
+		if err == nil && fs.fcfg.SyncAlways {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return mc, err
+		}
+		mc.num++
+	}
+
+	mc.size = fileStoreMsgSize(_EMPTY_, hdr, msg) - fileStoreMsgSize(_EMPTY_, nil, nil)
+	fs.chmu.Lock()
+	if fs.chunks == nil {
+		fs.chunks = make(map[uint64]msgChunks)
+	}
+	fs.chunks[seq] = mc
+	fs.nchunks.Store(int64(len(fs.chunks)))
+	fs.chmu.Unlock()
+	return mc, nil
+}
+
+// Removes the chunk files of a message, overwriting them first if secure.
+func (fs *fileStore) removeChunks(seq uint64, secure bool) {
+	if fs.nchunks.Load() == 0 {
+		return
+	}
+	fs.chmu.Lock()
+	mc, ok := fs.chunks[seq]
+	if ok {
+		delete(fs.chunks, seq)
+		fs.nchunks.Store(int64(len(fs.chunks)))
+	}
+	fs.chmu.Unlock()
+	if !ok {
+		return
+	}
+	dir := fs.chunkDir()
+	for i := 0; i < mc.num; i++ {
+		fn := filepath.Join(dir, fmt.Sprintf(chunkScan, seq, i))
+		if secure {
+			overwriteFile(fn)
+		}
+		os.Remove(fn)
+	}
+}
+
+// Removes the chunks of messages no longer stored, e.g. after a purge, compact or truncate.
+// Lock should be held.
+func (fs *fileStore) removeStaleChunks() {
+	if fs.nchunks.Load() == 0 {
+		return
+	}
+	fs.chmu.Lock()
+	seqs := make([]uint64, 0, len(fs.chunks))
+	for seq := range fs.chunks {
+		seqs = append(seqs, seq)
+	}
+	fs.chmu.Unlock()
+
+	secure := fs.secureErase()
+	for _, seq := range seqs {
+		if !fs.hasMsg(seq) {
+			fs.removeChunks(seq, secure)
+		}
+	}
+}
+
+// Returns true if the message with this sequence is stored.
+// Lock should be held.
+func (fs *fileStore) hasMsg(seq uint64) bool {
+	if seq < fs.state.FirstSeq || seq > fs.state.LastSeq {
+		return false
+	}
+	mb := fs.selectMsgBlock(seq)
+	if mb == nil {
+		return false
+	}
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return seq >= atomic.LoadUint64(&mb.first.seq) && seq <= atomic.LoadUint64(&mb.last.seq) && !mb.dmap.Exists(seq)
+}
+
+// Returns true if any message from first to last is chunked.
+func (fs *fileStore) hasChunksWithin(first, last uint64) bool {
+	if fs.nchunks.Load() == 0 {
+		return false
+	}
+	fs.chmu.Lock()
+	defer fs.chmu.Unlock()
+	for seq := range fs.chunks {
+		if seq >= first && seq <= last {
+			return true
+		}
+	}
+	return false
+}
+
+// Tracks the chunks found on disk, before the messages are recovered so they are accounted
+// at their full size. Chunks of messages that were not stored are removed once recovered.
+func (fs *fileStore) recoverChunks() {
+	dir := fs.chunkDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	found := make(map[uint64]int)
+	for _, e := range entries {
+		var seq uint64
+		var index int
+		if n, err := fmt.Sscanf(e.Name(), chunkScan, &seq, &index); err == nil && n == 2 {
+			if index+1 > found[seq] {
+				found[seq] = index + 1
+			}
+		}
+	}
+	chunks := make(map[uint64]msgChunks, len(found))
+	for seq, num := range found {
+		var frame [chunkHdrSize]byte
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf(chunkScan, seq, 0)))
+		if err == nil {
+			_, err = f.ReadAt(frame[:], 0)
+			f.Close()
+		}
+		if err != nil {
+			fs.warn("Could not recover chunks of message %d: %v", seq, err)
+			for i := 0; i < num; i++ {
+				os.Remove(filepath.Join(dir, fmt.Sprintf(chunkScan, seq, i)))
+			}
+			continue
+		}
+		hl, total := binary.LittleEndian.Uint32(frame[0:]), binary.LittleEndian.Uint64(frame[4:])
+		size := total
+		if hl > 0 {
+			size += 4
+		}
+		chunks[seq] = msgChunks{num: num, size: size}
+	}
+	fs.chmu.Lock()
+	fs.chunks = chunks
+	fs.nchunks.Store(int64(len(chunks)))
+	fs.chmu.Unlock()
+}
+
+// Forgets all chunks, when removed with the message directory.
+func (fs *fileStore) resetChunks() {
+	fs.chmu.Lock()
+	fs.chunks = nil
+	fs.nchunks.Store(0)
+	fs.chmu.Unlock()
+}
+
+// Returns the message with its headers and payload read back from its chunks, if chunked.
+func (fs *fileStore) loadChunks(sm *StoreMsg) (*StoreMsg, error) {
+	if sm == nil || fs.nchunks.Load() == 0 {
+		return sm, nil
+	}
+	fs.chmu.Lock()
+	mc, ok := fs.chunks[sm.seq]
+	fs.chmu.Unlock()
+	if !ok {
+		return sm, nil
+	}
+
+	dir := fs.chunkDir()
+	buf := sm.buf[:0]
+	for i := 0; i < mc.num; i++ {
+		b, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf(chunkScan, sm.seq, i)))
+		if err != nil {
+			return nil, errBadChunks
+		}
+		buf = append(buf, b...)
+	}
+	if len(buf) < chunkHdrSize {
+		return nil, errBadChunks
+	}
+	hl, total := int(binary.LittleEndian.Uint32(buf[0:])), binary.LittleEndian.Uint64(buf[4:])
+	if uint64(len(buf)-chunkHdrSize) != total || hl > int(total) {
+		return nil, errBadChunks
+	}
+	// Drop the frame so buf only holds the headers and payload.
+	buf = append(buf[:0], buf[chunkHdrSize:]...)
+	sm.buf = buf
+	if hl > 0 {
+		sm.hdr = buf[:hl:hl]
+	} else {
+		sm.hdr = nil
+	}
+	sm.msg = buf[hl:]
+	return sm, nil
+}
+
+// Adds the chunk files to a snapshot, so they are restored with the blocks.
+func (fs *fileStore) snapshotChunks(writeFile func(name string, buf []byte) error) error {
+	if fs.nchunks.Load() == 0 {
+		return nil
+	}
+	fs.chmu.Lock()
+	chunks := make(map[uint64]msgChunks, len(fs.chunks))
+	for seq, mc := range fs.chunks {
+		chunks[seq] = mc
+	}
+	fs.chmu.Unlock()
+
+	dir := fs.chunkDir()
+	// Can't use join path here, tar only recognizes relative paths with forward slashes.
+	pre := msgDir + "/" + chunkDir + "/"
+	for seq, mc := range chunks {
+		for i := 0; i < mc.num; i++ {
+			name := fmt.Sprintf(chunkScan, seq, i)
+			buf, err := os.ReadFile(filepath.Join(dir, name))
+			if os.IsNotExist(err) {
+				// Removed since, so was the message.
+				break
+			} else if err != nil {
+				return err
+			}
+			if err := writeFile(pre+name, buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
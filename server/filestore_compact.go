@@ -0,0 +1,63 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Used to call back into the upper layers when the file store compacted sparse message blocks
+// in the background, with the number of blocks rewritten and the bytes reclaimed on disk.
+type CompactionUpdateHandler func(blocks int, reclaimed uint64)
+
+// Registers the handler called after the periodic sync compacted message blocks.
+func (fs *fileStore) registerCompactionUpdates(cb CompactionUpdateHandler) {
+	fs.mu.Lock()
+	fs.ccb = cb
+	fs.mu.Unlock()
+}
+
+// Called when our file store compacted sparse message blocks, e.g. holes left behind
+// by acknowledged messages with interest or workqueue retention.
+func (mset *stream) storeCompacted(blocks int, reclaimed uint64) {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if !mset.isLeader() || mset.outq == nil {
+		return
+	}
+	fs, ok := mset.store.(*fileStore)
+	if !ok {
+		return
+	}
+	m := JSStreamCompactedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamCompactedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:         mset.cfg.Name,
+		Blocks:         blocks,
+		Reclaimed:      reclaimed,
+		TotalReclaimed: fs.reclaimed.Load(),
+		Domain:         mset.srv.getOpts().JetStreamDomain,
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamCompactedPre + "." + mset.cfg.Name
+		mset.outq.sendMsg(subj, j)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// Alignment of the offsets, sizes and memory of writes bypassing the page cache,
+	// which covers the logical block size of common devices.
+	directIOAlign = 4096
+	// Size of the aligned buffers, larger writes are split up.
+	directIOBufSize = 1024 * 1024
+)
+
+// Returned when the platform or file system can not bypass the page cache.
+var errDirectIOUnsupported = errors.New("direct I/O not supported")
+
+// Pool of aligned buffers for writes bypassing the page cache.
+var directBufPool = sync.Pool{
+	New: func() any {
+		buf := alignedBuf(directIOBufSize)
+		return &buf
+	},
+}
+
+// Returns a buffer of the given size aligned in memory for direct I/O.
+func alignedBuf(size int) []byte {
+	buf := make([]byte, size+directIOAlign)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlign - 1))
+	if off > 0 {
+		off = directIOAlign - off
+	}
+	return buf[off : off+size : off+size]
+}
+
+// Returns if writes of this block bypass the page cache.
+// Lock should be held.
+func (mb *msgBlock) directIO() bool {
+	return mb.fs.fcfg.DirectIO && !mb.fs.noDirect.Load()
+}
+
+// Writes buf at woff bypassing the page cache, so writing very large streams does not
+// evict the hot data of others. Writes have to be aligned, so the partial page already
+// on disk ahead of woff is written again along with buf and the last page is padded.
+// The padding is overwritten by the next write, we track where the data ends and only
+// truncate the file once the block is sealed or closed, see truncatePadding.
+// Returns how much of buf was written, which is less than its length when it does not
+// fit the aligned buffer.
+// Lock should be held.
+func (mb *msgBlock) writeDirect(buf []byte, woff int64) (int, error) {
+	if mb.dfd == nil {
+		dfd, err := openDirectFile(mb.mfn)
+		if errors.Is(err, errDirectIOUnsupported) {
+			if mb.fs.noDirect.CompareAndSwap(false, true) {
+				mb.fs.warn("Direct I/O of message blocks not supported, writing through the page cache: %v", err)
+			}
+			return mb.mfd.WriteAt(buf, woff)
+		} else if err != nil {
+			return 0, err
+		}
+		mb.dfd = dfd
+	}
+
+	bp := directBufPool.Get().(*[]byte)
+	defer directBufPool.Put(bp)
+	dbuf := *bp
+
+	start := woff &^ (directIOAlign - 1)
+	head := int(woff - start)
+	if head > 0 {
+		if _, err := mb.mfd.ReadAt(dbuf[:head], start); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(dbuf[head:], buf)
+	end := head + n
+	padded := (end + directIOAlign - 1) &^ (directIOAlign - 1)
+	clear(dbuf[end:padded])
+
+	if _, err := mb.dfd.WriteAt(dbuf[:padded], start); err != nil {
+		return 0, err
+	}
+	if padded != end {
+		mb.dsz = woff + int64(n)
+	} else {
+		mb.dsz = 0
+	}
+	return n, nil
+}
+
+// Returns the size of the block file without the padding of the last write
+// bypassing the page cache, given the size of the file.
+// Lock should be held.
+func (mb *msgBlock) dataSize(size int64) int64 {
+	if mb.dsz > 0 && mb.dsz < size {
+		return mb.dsz
+	}
+	return size
+}
+
+// Truncates the padding of the last write bypassing the page cache off the block file,
+// once the block is no longer written to. Truncating frees the disk space preallocated
+// past the end of the file, so this is not done while the block is still written to.
+// Lock should be held.
+func (mb *msgBlock) truncatePadding() error {
+	if mb.dsz == 0 {
+		return nil
+	}
+	<-dios
+	err := os.Truncate(mb.mfn, mb.dsz)
+	dios <- struct{}{}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mb.dsz = 0
+	return nil
+}
+
+// Closes the file used to bypass the page cache, if open.
+// Lock should be held.
+func (mb *msgBlock) closeDirect() {
+	if mb.dfd != nil {
+		mb.dfd.Close()
+		mb.dfd = nil
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DurabilityMode determines when the writes of a file based stream are synced to disk.
+type DurabilityMode string
+
+const (
+	// DurabilitySync syncs every write to disk before it is acknowledged.
+	DurabilitySync = DurabilityMode("sync")
+	// DurabilityInterval writes messages to the file system in place and syncs them
+	// to disk periodically. This is the default of the server.
+	DurabilityInterval = DurabilityMode("interval")
+	// DurabilityAsync buffers writes and flushes them to the file system in the
+	// background, syncing them to disk periodically.
+	DurabilityAsync = DurabilityMode("async")
+)
+
+// StreamDurability trades the cost of syncing the writes of a stream to disk for a
+// bounded window of messages that can be lost when the server or host fails.
+type StreamDurability struct {
+	Mode DurabilityMode `json:"mode"`
+	// Interval is how often writes are synced to disk, the window of messages that can be lost.
+	// Defaults to the sync interval of the server, not used in sync mode.
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+// Checks the durability configuration of a stream.
+func (d *StreamDurability) validate(cfg *StreamConfig) error {
+	if cfg.Storage != FileStorage {
+		return errors.New("durability requires file storage")
+	}
+	switch d.Mode {
+	case DurabilitySync, DurabilityInterval, DurabilityAsync:
+	default:
+		return fmt.Errorf("durability mode %q is invalid, expected %q, %q or %q", d.Mode, DurabilitySync, DurabilityInterval, DurabilityAsync)
+	}
+	if d.Interval < 0 {
+		return errors.New("durability interval can not be negative")
+	}
+	if d.Interval > 0 {
+		return validateSyncInterval(d.Interval)
+	}
+	return nil
+}
+
+// The bounds of the sync intervals of streams and accounts.
+const (
+	minSyncInterval = 10 * time.Millisecond
+	maxSyncInterval = time.Hour
+)
+
+// Checks a sync interval of a stream or an account.
+func validateSyncInterval(interval time.Duration) error {
+	if interval < minSyncInterval || interval > maxSyncInterval {
+		return fmt.Errorf("sync interval must be between %v and %v", minSyncInterval, maxSyncInterval)
+	}
+	return nil
+}
+
+// Returns the sync interval of the file based streams of the account without a
+// durability interval of their own, which is the one of the server unless set.
+func (a *Account) syncInterval(opts *Options) time.Duration {
+	if a != nil && a.jsSyncInterval > 0 {
+		return a.jsSyncInterval
+	}
+	return opts.SyncInterval
+}
+
+// The sync settings of the file store config, used for streams without a durability.
+type storeSyncDefaults struct {
+	interval time.Duration
+	always   bool
+	async    bool
+}
+
+// Applies the durability of the stream over the sync defaults of the store.
+// Lock should be held.
+func (fs *fileStore) applyDurability(d *StreamDurability) {
+	interval, always, async := fs.sdef.interval, fs.sdef.always, fs.sdef.async
+	if d != nil {
+		always, async = d.Mode == DurabilitySync, d.Mode == DurabilityAsync
+		if d.Interval > 0 {
+			interval = d.Interval
+		}
+	}
+	fs.fcfg.SyncInterval, fs.fcfg.SyncAlways, fs.fcfg.AsyncFlush = interval, always, async
+	fs.fip = !async
+}
+
+// Changes the durability of the stream, on update.
+// Lock should be held.
+func (fs *fileStore) updateDurability(d *StreamDurability) {
+	wasAsync := !fs.fip
+	fs.applyDurability(d)
+	if fs.syncTmr != nil {
+		fs.setSyncTimer()
+	}
+	lmb := fs.lmb
+	if lmb == nil {
+		return
+	}
+	lmb.mu.Lock()
+	lmb.syncAlways = fs.fcfg.SyncAlways
+	lmb.mu.Unlock()
+	if async := !fs.fip; async && !wasAsync {
+		lmb.spinUpFlushLoop()
+	} else if !async && wasAsync {
+		lmb.flushPendingMsgs()
+	}
+}
+
+// Returns the durability the store is running with.
+func (fs *fileStore) durability() StreamDurability {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	d := StreamDurability{Mode: DurabilityInterval, Interval: fs.fcfg.SyncInterval}
+	if fs.fcfg.SyncAlways {
+		d.Mode, d.Interval = DurabilitySync, 0
+	} else if fs.fcfg.AsyncFlush {
+		d.Mode = DurabilityAsync
+	}
+	return d
+}
+
+// Returns the durability of a file based stream, for the stream info.
+func (mset *stream) durability() *StreamDurability {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	d := fs.durability()
+	return &d
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Checks the secure erase setting of a stream.
+func validateSecureErase(cfg *StreamConfig) error {
+	if !cfg.SecureErase {
+		return nil
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("secure erase requires file storage")
+	}
+	// Compressed records can not be overwritten in place.
+	if cfg.Compression != NoCompression {
+		return errors.New("secure erase can not be used with compression")
+	}
+	return nil
+}
+
+// Returns true if removed messages need to be overwritten. Encrypted stores
+// are excluded, their removed messages can not be read without the keys.
+// Lock should be held, either the store lock or the lock of one of its blocks.
+func (fs *fileStore) secureErase() bool {
+	return fs.cfg.SecureErase && fs.prf == nil
+}
+
+// Overwrites the contents of the file with random data and syncs it,
+// so the data is gone from disk once the file is removed.
+func overwriteFile(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, defaultFilePerms)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(f, rand.Reader, fi.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Overwrites all files in the directory, see overwriteFile.
+func overwriteDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return overwriteFile(path)
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Implemented by stores that can write and sync a group of messages at once.
+type groupCommitter interface {
+	// Starts a group, returns false if the store syncs writes on its own.
+	beginGroupCommit() bool
+	// Writes out the messages stored since the group started with a single sync.
+	commitGroup() error
+}
+
+// Starts holding writes in the cache until the group is committed, instead of
+// writing and syncing every message. Only used when syncing all writes.
+func (fs *fileStore) beginGroupCommit() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed || !fs.fcfg.SyncAlways || !fs.fip {
+		return false
+	}
+	fs.gcommit = true
+	return true
+}
+
+// Writes out the messages of the group and syncs them.
+func (fs *fileStore) commitGroup() error {
+	fs.mu.Lock()
+	if fs.closed {
+		fs.mu.Unlock()
+		return ErrStoreClosed
+	}
+	fs.gcommit = false
+	lmb := fs.lmb
+	fs.mu.Unlock()
+
+	if lmb == nil {
+		return nil
+	}
+	return lmb.flushPendingMsgs()
+}
+
+// Writes out the messages still held in the cache of any block, which are
+// synced as well when syncing all writes.
+func (fs *fileStore) flushPending() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return ErrStoreClosed
+	}
+	for _, mb := range fs.blks {
+		if mb.pendingWriteSize() == 0 {
+			continue
+		}
+		mb.mu.Lock()
+		ld, err := mb.flushPendingMsgsLocked()
+		mb.mu.Unlock()
+		if ld != nil {
+			fs.rebuildStateLocked(ld)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes out the messages of the group when moving on to a new block.
+// Lock should be held.
+func (mb *msgBlock) flushPendingGroup() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if ld, _ := mb.flushPendingMsgsLocked(); ld != nil {
+		// We hold the store lock here, so rebuild in its own go routine.
+		go mb.fs.rebuildState(ld)
+	}
+}
+
+// The acknowledgements, and the work acting on the messages, held back until
+// the messages of a group are synced.
+type groupCommit struct {
+	mu     sync.Mutex
+	store  groupCommitter
+	acks   []groupAck
+	stored []func() // Rollups, republishes and consumer signals, in order.
+	seq    uint64   // The last sequence before the group.
+	lmsgId string   // The last message id before the group.
+}
+
+type groupAck struct {
+	reply string
+	resp  []byte
+}
+
+// Holds back an acknowledgement until the group is committed.
+func (gc *groupCommit) add(reply string, resp []byte) {
+	gc.mu.Lock()
+	gc.acks = append(gc.acks, groupAck{reply, resp})
+	gc.mu.Unlock()
+}
+
+// Holds back the work acting on a stored message until the group is committed.
+func (gc *groupCommit) after(fn func()) {
+	gc.mu.Lock()
+	gc.stored = append(gc.stored, fn)
+	gc.mu.Unlock()
+}
+
+// Starts a group commit for the messages stored from now on, if our store can.
+// The acknowledgements for these are sent once committed.
+func (mset *stream) beginGroupCommit() bool {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	gcs, ok := mset.store.(groupCommitter)
+	if !ok || !gcs.beginGroupCommit() {
+		return false
+	}
+	mset.gcommit = &groupCommit{store: gcs, seq: mset.lseq, lmsgId: mset.lmsgId}
+	return true
+}
+
+// Commits the group of messages stored, then acts on them and sends their acknowledgements.
+// Nothing but the error acknowledgements is sent for a group that failed to commit.
+func (mset *stream) commitGroup() {
+	mset.mu.Lock()
+	gc := mset.gcommit
+	mset.gcommit = nil
+	mset.mu.Unlock()
+	if gc == nil {
+		return
+	}
+
+	err := gc.store.commitGroup()
+
+	gc.mu.Lock()
+	acks, stored := gc.acks, gc.stored
+	gc.acks, gc.stored = nil, nil
+	gc.mu.Unlock()
+
+	if err != nil {
+		s := mset.srv
+		mset.mu.RLock()
+		accName, name := mset.acc.Name, mset.cfg.Name
+		mset.mu.RUnlock()
+		s.Errorf("JetStream failed to sync msgs on stream '%s > %s': %v", accName, name, err)
+		// Remove the messages of the group, the publishers retry them on the error.
+		if rerr := mset.removeGroup(gc); rerr != nil {
+			s.Warnf("JetStream failed to remove unsynced msgs on stream '%s > %s': %v", accName, name, rerr)
+		}
+		s.handleStorageError(mset, err)
+		for _, ack := range acks {
+			resp := &JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: NewJSStreamStoreFailedError(err, Unless(err))}
+			b, _ := json.Marshal(resp)
+			mset.outq.sendMsg(ack.reply, b)
+		}
+		return
+	}
+	mset.mu.RLock()
+	mset.signalPushMirrors()
+	mset.mu.RUnlock()
+	for _, fn := range stored {
+		fn()
+	}
+	for _, ack := range acks {
+		mset.outq.sendMsg(ack.reply, ack.resp)
+	}
+}
+
+// Removes the messages stored as part of a group that failed to commit,
+// along with their message ids so retries are not taken for duplicates.
+func (mset *stream) removeGroup(gc *groupCommit) error {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	var rerr error
+	for seq := gc.seq + 1; seq <= mset.lseq; seq++ {
+		if _, err := mset.store.RemoveMsg(seq); err != nil && err != ErrStoreMsgNotFound && err != ErrStoreEOF && rerr == nil {
+			rerr = err
+		}
+	}
+	for len(mset.ddarr) > mset.ddindex {
+		dde := mset.ddarr[len(mset.ddarr)-1]
+		if dde.seq <= gc.seq {
+			break
+		}
+		if mset.ddmap[dde.id] == dde {
+			delete(mset.ddmap, dde.id)
+		}
+		mset.ddarr = mset.ddarr[:len(mset.ddarr)-1]
+	}
+	mset.lmsgId = gc.lmsgId
+	return rerr
+}
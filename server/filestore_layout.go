@@ -0,0 +1,121 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Returns the directory holding the index of the stream. This is the message directory
+// next to the blocks unless the index was placed apart, e.g. on a faster volume.
+func (fs *fileStore) indexDir() string {
+	if fs.fcfg.IndexDir != _EMPTY_ {
+		return fs.fcfg.IndexDir
+	}
+	return filepath.Join(fs.fcfg.StoreDir, msgDir)
+}
+
+// Returns the name of the file holding the full state of the stream.
+func (fs *fileStore) stateFile() string {
+	return filepath.Join(fs.indexDir(), streamStreamStateFile)
+}
+
+// Returns the name of the file holding the expirations of messages with a TTL.
+func (fs *fileStore) ttlStateFile() string {
+	return filepath.Join(fs.indexDir(), ttlStreamStateFile)
+}
+
+// Sets up the index directory when placed apart from the blocks. An index found next
+// to the blocks, which is where snapshots are restored and where it was kept before
+// being placed apart, takes precedence and is moved into the index directory.
+func (fs *fileStore) setupIndexDir() error {
+	if fs.fcfg.IndexDir == _EMPTY_ {
+		return nil
+	}
+	if err := os.MkdirAll(fs.fcfg.IndexDir, defaultDirPerms); err != nil {
+		return fmt.Errorf("could not create index storage directory - %w", err)
+	}
+	// The TTLs are rebuilt along with a moved index.
+	os.Remove(filepath.Join(fs.fcfg.StoreDir, msgDir, ttlStreamStateFile))
+	ofn := filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile)
+	if _, err := os.Stat(ofn); err != nil {
+		return nil
+	}
+	if err := moveFile(ofn, fs.stateFile()); err != nil {
+		// The state is rebuilt from the blocks, just make sure a stale one is not used.
+		fs.warn("Could not move stream index into %q: %v", fs.fcfg.IndexDir, err)
+		os.Remove(ofn)
+		os.Remove(fs.stateFile())
+	}
+	return nil
+}
+
+// Removes the index directory when placed apart from the blocks.
+func (fs *fileStore) removeIndexDir() {
+	if fs.fcfg.IndexDir != _EMPTY_ {
+		os.RemoveAll(fs.fcfg.IndexDir)
+	}
+}
+
+// Moves a file, copying it over when the destination is on a different volume.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, defaultFilePerms)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Returns the directory holding the index of the stream with the given name when the
+// account places indexes apart from the message blocks, empty otherwise.
+// Lock should be held.
+func (jsa *jsAccount) streamIndexDir(name string) string {
+	if jsa.indexDir == _EMPTY_ {
+		return _EMPTY_
+	}
+	return filepath.Join(jsa.indexDir, streamsDir, name)
+}
+
+// Returns the root directory of the indexes of the streams of this account,
+// which the account can set and otherwise defaults to the one of the server.
+func (a *Account) indexDir(opts *Options) string {
+	if a != nil && a.jsIndexDir != _EMPTY_ {
+		return a.jsIndexDir
+	}
+	if opts != nil {
+		return opts.JetStreamIndexDir
+	}
+	return _EMPTY_
+}
@@ -0,0 +1,292 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// The smallest partition interval, to keep the number of message blocks in check.
+	minPartitionInterval = time.Minute
+	// Time layout of the names of partition directories, by the start of the partition in UTC.
+	partitionDirLayout = "20060102T150405Z"
+)
+
+// StreamPartition is a time partition of a stream, whose message blocks are kept in a directory
+// of their own. Partitions other than the last are sealed and no longer written to, so backups can
+// be made incrementally by copying the directories of the sealed partitions not copied yet.
+type StreamPartition struct {
+	// Start is the start of the time partition.
+	Start time.Time `json:"start"`
+	// Dir is the directory holding the message blocks of the partition, relative to the store
+	// directory of the stream. Empty for blocks written before the stream was partitioned.
+	Dir      string `json:"dir,omitempty"`
+	Blocks   int    `json:"blocks"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Msgs     uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	Sealed   bool   `json:"sealed"`
+}
+
+// Checks the partition interval of a stream.
+func validatePartitionInterval(cfg *StreamConfig) error {
+	if cfg.PartitionInterval == 0 {
+		return nil
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("partition interval requires file storage")
+	}
+	if cfg.PartitionInterval < minPartitionInterval {
+		return errors.New("partition interval can not be less than 1m")
+	}
+	return nil
+}
+
+// Returns the start of the time partition of the timestamp.
+func partitionStart(ts int64, interval time.Duration) int64 {
+	return ts - ts%int64(interval)
+}
+
+// Returns the name of the directory of the time partition starting at start.
+func partitionDir(start int64) string {
+	return time.Unix(0, start).UTC().Format(partitionDirLayout)
+}
+
+// Returns true if a message with this timestamp belongs to another partition than the block.
+// Blocks move on to later partitions only, unless nothing was written to them yet.
+func (mb *msgBlock) partitionEnded(ts int64, interval time.Duration) bool {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	start := mb.pstart
+	if start == 0 {
+		// Written before the stream was partitioned.
+		if mb.msgs == 0 {
+			return false
+		}
+		start = partitionStart(mb.first.ts, interval)
+	}
+	pts := partitionStart(ts, interval)
+	if mb.msgs == 0 && mb.rbytes == 0 {
+		return pts != start
+	}
+	return pts > start
+}
+
+// Places a new block in the directory of the time partition of ts, if partitioned.
+// Lock should be held.
+func (fs *fileStore) setBlockPartition(index uint32, ts int64) error {
+	pi := fs.cfg.PartitionInterval
+	if pi == 0 {
+		return nil
+	}
+	start := partitionStart(ts, pi)
+	pdir := filepath.Join(fs.fcfg.StoreDir, msgDir, partitionDir(start))
+	if err := os.MkdirAll(pdir, defaultDirPerms); err != nil {
+		return fmt.Errorf("could not create partition directory - %w", err)
+	}
+	if fs.pdirs == nil {
+		fs.pdirs = make(map[uint32]int64)
+	}
+	fs.pdirs[index] = start
+	return nil
+}
+
+// Returns the directory of the block with this index, which is the one of its time partition if it has one.
+// Lock should be held.
+func (fs *fileStore) blockDir(index uint32) string {
+	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
+	if start, ok := fs.pdirs[index]; ok {
+		return filepath.Join(mdir, partitionDir(start))
+	}
+	return mdir
+}
+
+// Returns the name of the encryption key file of the block, which is kept next to it.
+func (mb *msgBlock) keyFile() string {
+	return filepath.Join(filepath.Dir(mb.mfn), fmt.Sprintf(keyScan, mb.index))
+}
+
+// Returns the path of the time partition directory of the block within the
+// message directory, with a trailing slash, or nothing if it has none.
+func (mb *msgBlock) partitionPrefix() string {
+	if mb.pstart == 0 {
+		return _EMPTY_
+	}
+	return partitionDir(mb.pstart) + "/"
+}
+
+// Removes what is left of a removed block in its time partition directory,
+// and the directory itself once the last block of the partition is gone.
+// Lock should be held.
+func (mb *msgBlock) removePartitionDir() {
+	if mb.pstart == 0 || mb.fs == nil {
+		return
+	}
+	pdir := filepath.Join(mb.fs.fcfg.StoreDir, msgDir, partitionDir(mb.pstart))
+	os.Remove(filepath.Join(pdir, fmt.Sprintf(keyScan, mb.index)))
+	// Fails while other blocks of the partition are left.
+	os.Remove(pdir)
+}
+
+// Removes the write block if nothing was written to it, so the block of
+// another time partition can take its place. Returns true if removed.
+// Lock should be held.
+func (fs *fileStore) removeUnusedPartitionBlock(mb *msgBlock) bool {
+	if mb == nil || fs.cfg.PartitionInterval == 0 {
+		return false
+	}
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.msgs > 0 || mb.rbytes > 0 || mb.pendingWriteSizeLocked() > 0 {
+		return false
+	}
+	mb.dirtyCloseWithRemove(true)
+	fs.removeMsgBlockFromList(mb)
+	return true
+}
+
+// Finds the blocks kept in time partition directories and removes directories left empty.
+// Lock should be held.
+func (fs *fileStore) recoverPartitionDirs() {
+	fs.pdirs = nil
+	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
+	<-dios
+	dirs, _ := os.ReadDir(mdir)
+	dios <- struct{}{}
+
+	for _, de := range dirs {
+		if !de.IsDir() {
+			continue
+		}
+		t, err := time.Parse(partitionDirLayout, de.Name())
+		if err != nil {
+			continue
+		}
+		pdir := filepath.Join(mdir, de.Name())
+		<-dios
+		files, _ := os.ReadDir(pdir)
+		dios <- struct{}{}
+		if len(files) == 0 {
+			os.Remove(pdir)
+			continue
+		}
+		var index uint32
+		for _, fi := range files {
+			if n, err := fmt.Sscanf(fi.Name(), blkScan, &index); err != nil || n != 1 {
+				// Offloaded blocks that are not available locally.
+				if n, err = fmt.Sscanf(fi.Name(), tierScan, &index); err != nil || n != 1 || fs.fcfg.Tier == nil {
+					continue
+				}
+			}
+			if fs.pdirs == nil {
+				fs.pdirs = make(map[uint32]int64)
+			}
+			fs.pdirs[index] = t.UnixNano()
+		}
+	}
+}
+
+// Removes the partitions that expired as a whole, by dropping their blocks and directories
+// instead of removing their messages one by one. Consumers recalculate their pending messages afterwards.
+func (fs *fileStore) expirePartitions(minAge int64) {
+	fs.mu.RLock()
+	if fs.cfg.PartitionInterval == 0 {
+		fs.mu.RUnlock()
+		return
+	}
+	var upto uint64
+	for _, mb := range fs.blks {
+		if mb == fs.lmb {
+			break
+		}
+		mb.mu.RLock()
+		last := mb.last
+		mb.mu.RUnlock()
+		if last.ts > minAge {
+			break
+		}
+		upto = last.seq
+	}
+	fs.mu.RUnlock()
+
+	if upto > 0 {
+		fs.Compact(upto + 1)
+	}
+}
+
+// Returns the time partitions held by the store, oldest first.
+func (fs *fileStore) partitions() []*StreamPartition {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	interval := fs.cfg.PartitionInterval
+	if interval == 0 {
+		return nil
+	}
+	// The partition written to is the one of the last block.
+	var wstart int64
+	if lmb := fs.lmb; lmb != nil {
+		lmb.mu.RLock()
+		if wstart = lmb.pstart; wstart == 0 {
+			wstart = partitionStart(lmb.first.ts, interval)
+		}
+		lmb.mu.RUnlock()
+	}
+	var parts []*StreamPartition
+	var last *StreamPartition
+	for _, mb := range fs.blks {
+		mb.mu.RLock()
+		if mb.msgs == 0 {
+			mb.mu.RUnlock()
+			continue
+		}
+		start, dir := mb.pstart, _EMPTY_
+		if start == 0 {
+			start = partitionStart(mb.first.ts, interval)
+		} else {
+			dir = filepath.Join(msgDir, partitionDir(start))
+		}
+		if last == nil || last.Dir != dir || last.Start.UnixNano() != start {
+			last = &StreamPartition{
+				Start:    time.Unix(0, start).UTC(),
+				Dir:      dir,
+				FirstSeq: mb.first.seq,
+				Sealed:   start != wstart,
+			}
+			parts = append(parts, last)
+		}
+		last.Blocks++
+		last.LastSeq = mb.last.seq
+		last.Msgs += mb.msgs
+		last.Bytes += mb.bytes
+		mb.mu.RUnlock()
+	}
+	return parts
+}
+
+// Returns the time partitions of the stream, if it is partitioned.
+func (mset *stream) partitions() []*StreamPartition {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fs.partitions()
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// Returned when the platform or file system can not preallocate files.
+var errPreallocUnsupported = errors.New("file preallocation not supported")
+
+// Preallocates the disk space of a new block file up to the block size without changing the
+// size of the file, so the block is laid out contiguously and running out of space fails the
+// creation of the block instead of a write halfway through it. Where the file system can not
+// preallocate we fall back to allocating on write, which is only warned about once.
+// Lock should be held.
+func (fs *fileStore) preallocateBlock(mfd *os.File) error {
+	if !fs.fcfg.Preallocate || fs.noPrealloc {
+		return nil
+	}
+	err := preallocateFile(mfd, int64(fs.fcfg.BlockSize))
+	if errors.Is(err, errPreallocUnsupported) {
+		fs.noPrealloc = true
+		fs.warn("Preallocation of message blocks not supported, allocating on write: %v", err)
+		return nil
+	}
+	return err
+}
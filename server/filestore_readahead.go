@@ -0,0 +1,100 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "sync/atomic"
+
+// readAheadBudget bounds the memory of the message blocks that the file based streams
+// of an account prefetched ahead of sequential readers, such as consumers.
+type readAheadBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// Returns the read ahead budget of an account, nil if it does not read ahead.
+func newReadAheadBudget(max int64) *readAheadBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &readAheadBudget{max: max}
+}
+
+// Reserves n bytes of the budget, returns false if not enough is left.
+func (b *readAheadBudget) reserve(n int64) bool {
+	for {
+		used := b.used.Load()
+		if used+n > b.max {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			return true
+		}
+	}
+}
+
+func (b *readAheadBudget) release(n int64) {
+	b.used.Add(-n)
+}
+
+// Called after a read of seq from the block mb at index i. Once a reader passed the middle of the
+// block, the next block is loaded into its cache in the background, so sequential readers such
+// as consumers find it cached instead of waiting on the disk when they get there. Prefetched
+// caches count against the read ahead budget of the account until they are cleared.
+// Lock should be held.
+func (fs *fileStore) readAhead(mb *msgBlock, i int, seq uint64) {
+	budget := fs.fcfg.readAhead
+	// The last block holds the write cache already.
+	if budget == nil || i < 0 || i+2 >= len(fs.blks) || fs.blks[i] != mb {
+		return
+	}
+	nmb := fs.blks[i+1]
+
+	mb.mu.Lock()
+	first, last := atomic.LoadUint64(&mb.first.seq), atomic.LoadUint64(&mb.last.seq)
+	if mb.raNext || seq < first+(last-first)/2 {
+		mb.mu.Unlock()
+		return
+	}
+	mb.raNext = true
+	mb.mu.Unlock()
+
+	go func() {
+		nmb.mu.Lock()
+		defer nmb.mu.Unlock()
+		if nmb.closed || nmb.raBytes > 0 || nmb.cacheAlreadyLoaded() {
+			return
+		}
+		n := int64(nmb.rbytes)
+		if !budget.reserve(n) {
+			return
+		}
+		if err := nmb.loadMsgsWithLock(); err != nil {
+			budget.release(n)
+			return
+		}
+		nmb.raBytes = n
+		fs.stats.readAheads.Add(1)
+	}()
+}
+
+// Releases the read ahead budget held by the cache of the block, when it is cleared.
+// Lock should be held.
+func (mb *msgBlock) releaseReadAhead() {
+	mb.raNext = false
+	if mb.raBytes == 0 || mb.fs == nil {
+		return
+	}
+	mb.fs.fcfg.readAhead.release(mb.raBytes)
+	mb.raBytes = 0
+}
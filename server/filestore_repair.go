@@ -0,0 +1,116 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// StreamRepair records how the storage of a stream was repaired when it was recovered,
+// after blocks were found truncated or corrupt, instead of failing to load the stream.
+type StreamRepair struct {
+	Time time.Time `json:"time"`
+	// LastSeq is the last sequence that could be recovered consistently.
+	LastSeq uint64 `json:"last_seq"`
+	// Blocks are the message blocks that could not be read at all and were dropped.
+	Blocks []string `json:"blocks,omitempty"`
+	// Lost are the messages dropped when truncating blocks to their last consistent message.
+	Lost *LostStreamData `json:"lost,omitempty"`
+}
+
+// Records a block that could not be rebuilt on recovery and is dropped.
+// Lock should be held.
+func (fs *fileStore) recordDroppedBlock(mb *msgBlock, err error) {
+	name := filepath.Base(mb.mfn)
+	fs.warn("Dropping message block %q that could not be recovered: %v", name, err)
+	fs.dropped = append(fs.dropped, name)
+}
+
+// Called once recovered, records the repair if any data had to be dropped.
+// Lock should be held.
+func (fs *fileStore) recordRepair() {
+	if fs.ld == nil && len(fs.dropped) == 0 {
+		return
+	}
+	fs.repair = &StreamRepair{
+		Time:    time.Now().UTC(),
+		LastSeq: fs.state.LastSeq,
+		Blocks:  fs.dropped,
+	}
+	if fs.ld != nil {
+		ld := *fs.ld
+		ld.Msgs = append([]uint64(nil), fs.ld.Msgs...)
+		fs.repair.Lost = &ld
+	}
+	fs.dropped = nil
+	var lost int
+	if fs.repair.Lost != nil {
+		lost = len(fs.repair.Lost.Msgs)
+	}
+	fs.warn("Repaired storage on recovery, %d messages lost and %d blocks dropped, last sequence is %d",
+		lost, len(fs.repair.Blocks), fs.repair.LastSeq)
+}
+
+// Returns the repair made when recovering the store, if any.
+func (fs *fileStore) recoveryRepair() *StreamRepair {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.repair
+}
+
+// Returns the repair made to the storage of the stream when it was recovered, if any.
+func (mset *stream) storeRepair() *StreamRepair {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fs.recoveryRepair()
+}
+
+// Sends an advisory for the repair of the storage of the stream when it was recovered.
+func (mset *stream) sendRepairAdvisory() {
+	repair := mset.storeRepair()
+	if repair == nil {
+		return
+	}
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	s, name := mset.srv, mset.cfg.Name
+	s.Warnf("JetStream stream '%s > %s' was repaired on recovery, last sequence is %d", mset.acc.Name, name, repair.LastSeq)
+	if mset.outq == nil {
+		return
+	}
+	m := JSStreamRepairAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamRepairAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream: name,
+		Server: s.Name(),
+		Repair: repair,
+		Domain: s.getOpts().JetStreamDomain,
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamRepairPre + "." + name
+		mset.outq.sendMsg(subj, j)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/highwayhash"
+	"github.com/nats-io/nuid"
+)
+
+// StreamScrubResult is the result of verifying the messages a stream stores on disk against their checksums.
+type StreamScrubResult struct {
+	// Blocks is the number of message blocks verified.
+	Blocks int `json:"blocks"`
+	// Offloaded is the number of message blocks skipped since they were offloaded to the tier store.
+	Offloaded int `json:"offloaded,omitempty"`
+	// Msgs is the number of messages verified.
+	Msgs uint64 `json:"messages"`
+	// NumCorrupt is the number of messages that failed verification.
+	NumCorrupt int `json:"num_corrupt,omitempty"`
+	// Corrupt are the sequences of the messages that failed verification, up to a limit.
+	Corrupt  []uint64      `json:"corrupt,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// The most corrupt sequences we report.
+const maxScrubCorrupt = 10_000
+
+var errScrubInProgress = errors.New("scrub already in progress")
+
+// Adds a corrupt sequence to the result.
+func (r *StreamScrubResult) corrupt(seq uint64) {
+	r.NumCorrupt++
+	if len(r.Corrupt) < maxScrubCorrupt {
+		r.Corrupt = append(r.Corrupt, seq)
+	}
+}
+
+// Starts verifying all message blocks against their checksums in the background, cb is called when done.
+// This does not repair anything, corrupt messages are only reported.
+func (fs *fileStore) scrub(cb func(*StreamScrubResult, error)) error {
+	if !fs.scrubbing.CompareAndSwap(false, true) {
+		return errScrubInProgress
+	}
+	go func() {
+		defer fs.scrubbing.Store(false)
+		cb(fs.scrubBlocks())
+	}()
+	return nil
+}
+
+func (fs *fileStore) scrubBlocks() (*StreamScrubResult, error) {
+	res := &StreamScrubResult{Start: time.Now().UTC()}
+	fs.mu.RLock()
+	if fs.closed {
+		fs.mu.RUnlock()
+		return nil, ErrStoreClosed
+	}
+	blks := append([]*msgBlock(nil), fs.blks...)
+	fs.mu.RUnlock()
+
+	for _, mb := range blks {
+		if fs.isClosed() {
+			return nil, ErrStoreClosed
+		}
+		if err := mb.scrub(res); err != nil {
+			return nil, err
+		}
+	}
+	res.Duration = time.Since(res.Start)
+	return res, nil
+}
+
+// Verifies the records of the block on disk against their checksums, adding corrupt messages to res.
+func (mb *msgBlock) scrub(res *StreamScrubResult) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	// Removed since we started.
+	if mb.closed {
+		return nil
+	}
+	if mb.tiered {
+		res.Offloaded++
+		return nil
+	}
+	res.Blocks++
+
+	fs := mb.fs
+	if fs.prf != nil && (mb.aek == nil || mb.bek == nil) {
+		if err := fs.loadEncryptionForMsgBlock(mb); err != nil {
+			return err
+		}
+	}
+	if buf, _ := mb.bytesPending(); len(buf) > 0 {
+		if _, err := mb.flushPendingMsgsLocked(); err != nil {
+			return err
+		}
+	}
+
+	fseq, lseq := atomic.LoadUint64(&mb.first.seq), atomic.LoadUint64(&mb.last.seq)
+	isLive := func(seq uint64) bool {
+		return seq >= fseq && seq <= lseq && !mb.dmap.Exists(seq)
+	}
+	// Everything past the last valid record can not be verified.
+	var last uint64
+	corruptRest := func() {
+		start := fseq
+		if last >= start {
+			start = last + 1
+		}
+		for seq := start; seq <= lseq; seq++ {
+			if isLive(seq) {
+				res.corrupt(seq)
+			}
+		}
+	}
+
+	rbuf, err := mb.loadBlock(nil)
+	defer recycleMsgBlockBuf(rbuf)
+	if err != nil {
+		if err == errNoBlkData {
+			corruptRest()
+			return nil
+		}
+		return err
+	}
+	buf := rbuf
+	if mb.bek != nil && len(buf) > 0 {
+		bek, err := genBlockEncryptionKey(fs.fcfg.Cipher, mb.seed, mb.nonce)
+		if err != nil {
+			return err
+		}
+		bek.XORKeyStream(buf, buf)
+	}
+	if buf, err = mb.decompressIfNeeded(buf); err != nil {
+		corruptRest()
+		return nil
+	}
+
+	// Our own hash, the one of the block is used for writes.
+	key := sha256.Sum256(fs.hashKeyForBlock(mb.index))
+	hh, err := highwayhash.New64(key[:])
+	if err != nil {
+		return err
+	}
+
+	var le = binary.LittleEndian
+	for index, lbuf := uint32(0), uint32(len(buf)); index < lbuf; {
+		if index+msgHdrSize > lbuf {
+			corruptRest()
+			return nil
+		}
+		hdr := buf[index : index+msgHdrSize]
+		rl, slen := le.Uint32(hdr[0:]), le.Uint16(hdr[20:])
+		hasHeaders := rl&hbit != 0
+		rl &^= hbit
+		dlen := int(rl) - msgHdrSize
+		if dlen < 0 || int(slen) > (dlen-recordHashSize) || dlen > int(rl) || index+rl > lbuf || rl > rlBadThresh {
+			corruptRest()
+			return nil
+		}
+
+		data := buf[index+msgHdrSize : index+rl]
+		hh.Reset()
+		hh.Write(hdr[4:20])
+		hh.Write(data[:slen])
+		if hasHeaders {
+			hh.Write(data[slen+4 : dlen-recordHashSize])
+		} else {
+			hh.Write(data[slen : dlen-recordHashSize])
+		}
+		valid := bytes.Equal(hh.Sum(nil), data[len(data)-recordHashSize:])
+
+		// Tombstones and erased messages are not messages of the stream.
+		if seq := le.Uint64(hdr[4:]); seq&(tbit|ebit) == 0 && isLive(seq) {
+			if valid {
+				res.Msgs++
+			} else {
+				res.corrupt(seq)
+			}
+			last = seq
+		}
+		index += rl
+	}
+	return nil
+}
+
+// Starts verifying the messages of the stream against their checksums in the background,
+// the result is reported in an advisory.
+func (mset *stream) scrubStore() error {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return NewJSStreamScrubNotSupportedError()
+	}
+	err := fs.scrub(mset.storeScrubbed)
+	if err == errScrubInProgress {
+		return NewJSStreamScrubInProgressError()
+	}
+	return err
+}
+
+// Called when verifying the messages of the stream is done.
+func (mset *stream) storeScrubbed(res *StreamScrubResult, err error) {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	s, name := mset.srv, mset.cfg.Name
+	if err != nil {
+		s.Warnf("JetStream stream '%s > %s' could not be scrubbed: %v", mset.acc.Name, name, err)
+		res = &StreamScrubResult{Error: err.Error()}
+	} else if res.NumCorrupt > 0 {
+		s.Errorf("JetStream stream '%s > %s' has %d corrupt messages", mset.acc.Name, name, res.NumCorrupt)
+	}
+	if mset.outq == nil {
+		return
+	}
+	m := JSStreamScrubAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamScrubAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream: name,
+		Server: s.Name(),
+		Result: res,
+		Domain: s.getOpts().JetStreamDomain,
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamScrubPre + "." + name
+		mset.outq.sendMsg(subj, j)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StreamStorageStats are statistics of the storage of a stream on this server,
+// to tell streams bound by their storage apart from those bound by the network.
+type StreamStorageStats struct {
+	// Writes is the number of messages written.
+	Writes uint64 `json:"writes"`
+	// WriteLatency is the average time it took to store a message.
+	WriteLatency    time.Duration `json:"write_latency"`
+	MaxWriteLatency time.Duration `json:"max_write_latency"`
+	// Syncs is the number of times written messages were synced to disk.
+	Syncs uint64 `json:"syncs"`
+	// SyncLatency is the average time a sync took.
+	SyncLatency    time.Duration `json:"sync_latency"`
+	MaxSyncLatency time.Duration `json:"max_sync_latency"`
+	// CacheHits and CacheMisses count the reads of messages found in or loaded into the block cache.
+	CacheHits    uint64  `json:"cache_hits"`
+	CacheMisses  uint64  `json:"cache_misses"`
+	CacheHitRate float64 `json:"cache_hit_rate"`
+	// CachedBlocks and CacheBytes are the message blocks that are cached and the memory they use.
+	CachedBlocks int    `json:"cached_blocks"`
+	CacheBytes   uint64 `json:"cache_bytes"`
+	// ReadAheads is the number of blocks loaded ahead of sequential readers.
+	ReadAheads uint64 `json:"read_aheads,omitempty"`
+}
+
+// The counters behind the storage statistics of a file store.
+type storeStats struct {
+	writes     atomic.Uint64
+	writeNs    atomic.Uint64
+	maxWrite   atomic.Uint64
+	syncs      atomic.Uint64
+	syncNs     atomic.Uint64
+	maxSync    atomic.Uint64
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	readAheads atomic.Uint64
+}
+
+// Stores v in a if it is larger.
+func storeMaxUint64(a *atomic.Uint64, v uint64) {
+	for o := a.Load(); v > o; o = a.Load() {
+		if a.CompareAndSwap(o, v) {
+			return
+		}
+	}
+}
+
+func (ss *storeStats) write(start time.Time) {
+	d := uint64(time.Since(start))
+	ss.writes.Add(1)
+	ss.writeNs.Add(d)
+	storeMaxUint64(&ss.maxWrite, d)
+}
+
+func (ss *storeStats) sync(start time.Time) {
+	d := uint64(time.Since(start))
+	ss.syncs.Add(1)
+	ss.syncNs.Add(d)
+	storeMaxUint64(&ss.maxSync, d)
+}
+
+func (ss *storeStats) cacheLookup(hit bool) {
+	if hit {
+		ss.hits.Add(1)
+	} else {
+		ss.misses.Add(1)
+	}
+}
+
+// Syncs the file of the block to disk, tracking how long it took.
+// Lock should be held.
+func (mb *msgBlock) syncWithStats() error {
+	start := time.Now()
+	err := mb.mfd.Sync()
+	if mb.fs != nil {
+		mb.fs.stats.sync(start)
+	}
+	return err
+}
+
+// Returns the statistics of our storage.
+func (fs *fileStore) storageStats() *StreamStorageStats {
+	ss := &fs.stats
+	stats := &StreamStorageStats{
+		Writes:          ss.writes.Load(),
+		MaxWriteLatency: time.Duration(ss.maxWrite.Load()),
+		Syncs:           ss.syncs.Load(),
+		MaxSyncLatency:  time.Duration(ss.maxSync.Load()),
+		CacheHits:       ss.hits.Load(),
+		CacheMisses:     ss.misses.Load(),
+		ReadAheads:      ss.readAheads.Load(),
+	}
+	if stats.Writes > 0 {
+		stats.WriteLatency = time.Duration(ss.writeNs.Load() / stats.Writes)
+	}
+	if stats.Syncs > 0 {
+		stats.SyncLatency = time.Duration(ss.syncNs.Load() / stats.Syncs)
+	}
+	if lookups := stats.CacheHits + stats.CacheMisses; lookups > 0 {
+		stats.CacheHitRate = float64(stats.CacheHits) / float64(lookups)
+	}
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	for _, mb := range fs.blks {
+		mb.mu.RLock()
+		if mb.cache != nil && len(mb.cache.buf) > 0 {
+			stats.CachedBlocks++
+			stats.CacheBytes += uint64(len(mb.cache.buf))
+		}
+		mb.mu.RUnlock()
+	}
+	return stats
+}
+
+// Returns the statistics of the storage of the stream, only kept for file storage.
+func (mset *stream) storageStats() *StreamStorageStats {
+	mset.mu.RLock()
+	fs, ok := mset.store.(*fileStore)
+	mset.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fs.storageStats()
+}
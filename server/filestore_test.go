@@ -33,11 +33,14 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/klauspost/compress/s2"
 )
@@ -4351,6 +4354,31 @@ func TestFileStoreOutOfSpaceRebuildState(t *testing.T) {
 	})
 }
 
+func TestFileStoreOutOfSpaceOnBlockCreate(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 256
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"*"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := bytes.Repeat([]byte("Z"), 128)
+		_, _, err = fs.StoreMsg("foo", nil, msg)
+		require_NoError(t, err)
+
+		// Set mock out of space error to trip when the next block is created.
+		fs.mu.Lock()
+		fs.mockCreateErr = &os.PathError{Op: "open", Path: "2.blk", Err: syscall.ENOSPC}
+		fs.mu.Unlock()
+
+		_, _, err = fs.StoreMsg("bar", nil, msg)
+		require_Error(t, err)
+		require_True(t, errors.Is(err, syscall.ENOSPC))
+		require_Equal(t, classifyStorageError(err), StorageErrorOutOfSpace)
+		require_True(t, isOutOfSpaceErr(err))
+	})
+}
+
 func TestFileStoreRebuildStateProperlyWithMaxMsgsPerSubject(t *testing.T) {
 	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
 		fcfg.BlockSize = 4096
@@ -8245,3 +8273,1279 @@ func TestFileStoreRecoverFullStateDetectCorruptState(t *testing.T) {
 	err = fs.recoverFullState()
 	require_Error(t, err, errCorruptState)
 }
+
+func TestFileStoreMsgTTLRecovery(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, AllowMsgTTL: true}
+		created := time.Now()
+
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		// Only the messages with a TTL expire.
+		hdr := genHeader(nil, JSMessageTTL, "1s")
+		for i := 0; i < 10; i++ {
+			_, _, err = fs.StoreMsg("foo", hdr, []byte("Hello World"))
+			require_NoError(t, err)
+			_, _, err = fs.StoreMsg("foo", nil, []byte("Hello World"))
+			require_NoError(t, err)
+		}
+		fs.Stop()
+
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		checkFor(t, 3*time.Second, 100*time.Millisecond, func() error {
+			if state := fs.State(); state.Msgs != 10 {
+				return fmt.Errorf("Expected 10 msgs, got %d", state.Msgs)
+			}
+			return nil
+		})
+		var smv StoreMsg
+		for seq := uint64(1); seq <= 20; seq++ {
+			_, err = fs.LoadMsg(seq, &smv)
+			if seq%2 == 1 {
+				require_Error(t, err, ErrStoreMsgNotFound, errDeletedMsg)
+			} else {
+				require_NoError(t, err)
+			}
+		}
+	})
+}
+
+func TestFileStoreMsgTTLState(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, AllowMsgTTL: true}
+		created := time.Now()
+
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		hdr := genHeader(nil, JSMessageTTL, "1h")
+		for i := 0; i < 5; i++ {
+			_, _, err = fs.StoreMsg("foo", hdr, []byte("Hello World"))
+			require_NoError(t, err)
+		}
+		// Track one that is not stored, to tell the TTLs were kept with the state and not rebuilt.
+		fs.mu.Lock()
+		fs.ttls.add(100, time.Now().Add(time.Hour).UnixNano())
+		fs.mu.Unlock()
+		fs.Stop()
+
+		_, err = os.Stat(filepath.Join(fcfg.StoreDir, msgDir, ttlStreamStateFile))
+		require_NoError(t, err)
+
+		ttls := func() int {
+			t.Helper()
+			fs.mu.RLock()
+			defer fs.mu.RUnlock()
+			return len(fs.ttls)
+		}
+
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		require_Equal(t, ttls(), 6)
+
+		// Without the full state the TTLs are rebuilt from the messages.
+		fs.Stop()
+		require_NoError(t, os.Remove(filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile)))
+
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		require_Equal(t, ttls(), 5)
+	})
+}
+
+func TestFileStoreCatchupBlock(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 256
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		hdr := genHeader(nil, "X", "Y")
+		for i := 0; i < 30; i++ {
+			_, _, err = fs.StoreMsg(fmt.Sprintf("foo.%d", i), hdr, []byte("Hello World"))
+			require_NoError(t, err)
+		}
+		_, err = fs.RemoveMsg(3)
+		require_NoError(t, err)
+		_, err = fs.EraseMsg(5)
+		require_NoError(t, err)
+
+		var state StreamState
+		fs.FastState(&state)
+
+		// A block in the middle or past the last sequence asked for does not qualify.
+		require_True(t, fs.catchupBlock(2, state.LastSeq) == nil)
+		require_True(t, fs.catchupBlock(1, 1) == nil)
+
+		var smv StoreMsg
+		var blocks int
+		seq := uint64(1)
+		for ; seq <= state.LastSeq; seq++ {
+			cb := fs.catchupBlock(seq, state.LastSeq)
+			if cb == nil {
+				break
+			}
+			blocks++
+			require_Equal(t, cb.first, seq)
+
+			dcb, err := decodeCatchupBlock(encodeCatchupBlock(cb, blocks%2 == 0)[1:])
+			require_NoError(t, err)
+			require_Equal(t, dcb.last, cb.last)
+
+			// Every message of the range that was not removed comes out, and nothing else.
+			var got []uint64
+			require_NoError(t, dcb.forEachMsg("zzz", func(sm *StoreMsg) error {
+				got = append(got, sm.seq)
+				fsm, err := fs.LoadMsg(sm.seq, &smv)
+				require_NoError(t, err)
+				require_Equal(t, sm.subj, fsm.subj)
+				require_True(t, bytes.Equal(sm.hdr, fsm.hdr))
+				require_True(t, bytes.Equal(sm.msg, fsm.msg))
+				return nil
+			}))
+			var expected []uint64
+			for s := cb.first; s <= cb.last; s++ {
+				if s != 3 && s != 5 {
+					expected = append(expected, s)
+				}
+			}
+			require_True(t, reflect.DeepEqual(got, expected))
+
+			// Checksums are keyed by the stream and block.
+			require_Error(t, dcb.forEachMsg("yyy", func(*StoreMsg) error { return nil }), errCatchupBadMsg)
+			seq = cb.last
+		}
+		require_True(t, blocks > 1)
+
+		// The last block is still written to, so goes message by message.
+		fs.mu.RLock()
+		lfirst := atomic.LoadUint64(&fs.lmb.first.seq)
+		fs.mu.RUnlock()
+		require_True(t, fs.catchupBlock(lfirst, state.LastSeq) == nil)
+	})
+}
+
+type testTierStore struct {
+	sync.Mutex
+	objs map[string][]byte
+}
+
+func (t *testTierStore) Put(key string, data []byte) error {
+	t.Lock()
+	defer t.Unlock()
+	t.objs[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (t *testTierStore) Get(key string) ([]byte, error) {
+	t.Lock()
+	defer t.Unlock()
+	data, ok := t.objs[key]
+	if !ok {
+		return nil, errTierNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (t *testTierStore) Delete(key string) error {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.objs, key)
+	return nil
+}
+
+func (t *testTierStore) len() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.objs)
+}
+
+func TestFileStoreTiering(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		tier := &testTierStore{objs: make(map[string][]byte)}
+		fcfg.BlockSize = 256
+		fcfg.Tier = tier
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage, Tiering: &StreamTiering{MaxLocalBytes: 1}}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		for i := 0; i < 50; i++ {
+			_, _, err = fs.StoreMsg(fmt.Sprintf("foo.%d", i), nil, []byte("Hello World"))
+			require_NoError(t, err)
+		}
+		fs.mu.Lock()
+		fs.checkAndFlushAllBlocks()
+		blks := append([]*msgBlock(nil), fs.blks...)
+		fs.mu.Unlock()
+		// Compress the blocks now, so that they are not compressed in the background once offloaded.
+		for _, mb := range blks[:len(blks)-1] {
+			require_NoError(t, mb.recompressOnDiskIfNeeded())
+		}
+
+		blkFiles := func() int {
+			t.Helper()
+			files, err := filepath.Glob(filepath.Join(fcfg.StoreDir, msgDir, "*.blk"))
+			require_NoError(t, err)
+			return len(files)
+		}
+		nblks := fs.numMsgBlocks()
+		require_True(t, nblks > 4)
+		require_Equal(t, blkFiles(), nblks)
+
+		// All but the last block are offloaded, keeping at most MaxLocalBytes locally.
+		fs.tierBlocks()
+		offloaded := tier.len()
+		require_Equal(t, offloaded, nblks-1)
+		require_Equal(t, blkFiles(), nblks-offloaded)
+
+		// Offloaded messages are fetched back on demand.
+		sm, err := fs.LoadMsg(1, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "foo.0")
+		require_Equal(t, blkFiles(), nblks-offloaded+1)
+		fs.tierBlocks()
+		require_Equal(t, blkFiles(), nblks-offloaded)
+
+		// Recovers with the blocks offloaded, with and without the full state.
+		checkRecover := func() {
+			t.Helper()
+			fs.Stop()
+			fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+			require_NoError(t, err)
+			state := fs.State()
+			require_Equal(t, state.Msgs, 50)
+			require_Equal(t, state.FirstSeq, 1)
+			for seq := uint64(1); seq <= 50; seq++ {
+				sm, err := fs.LoadMsg(seq, nil)
+				require_NoError(t, err)
+				require_Equal(t, sm.subj, fmt.Sprintf("foo.%d", seq-1))
+			}
+			fs.tierBlocks()
+		}
+		checkRecover()
+		require_NoError(t, os.Remove(filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile)))
+		checkRecover()
+
+		// Removing blocks removes them from the tier store.
+		_, err = fs.Compact(26)
+		require_NoError(t, err)
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if n := tier.len(); n >= offloaded {
+				return fmt.Errorf("expected less than %d offloaded blocks, got %d", offloaded, n)
+			}
+			return nil
+		})
+		_, err = fs.Purge()
+		require_NoError(t, err)
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if n := tier.len(); n > 0 {
+				return fmt.Errorf("expected no offloaded blocks, got %d", n)
+			}
+			return nil
+		})
+	})
+}
+
+// Tier store that blocks its calls until released.
+type blockingTierStore struct {
+	*testTierStore
+	entered chan string
+	release chan struct{}
+}
+
+func (t *blockingTierStore) Put(key string, data []byte) error {
+	t.entered <- key
+	<-t.release
+	return t.testTierStore.Put(key, data)
+}
+
+func (t *blockingTierStore) Get(key string) ([]byte, error) {
+	t.entered <- key
+	<-t.release
+	return t.testTierStore.Get(key)
+}
+
+func TestFileStoreTieringWithoutLockDuringIO(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		tier := &blockingTierStore{
+			testTierStore: &testTierStore{objs: make(map[string][]byte)},
+			entered:       make(chan string, 100),
+			release:       make(chan struct{}),
+		}
+		fcfg.BlockSize = 256
+		fcfg.Tier = tier
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage, Tiering: &StreamTiering{MaxLocalBytes: 1}}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		for i := 0; i < 50; i++ {
+			_, _, err = fs.StoreMsg(fmt.Sprintf("foo.%d", i), nil, []byte("Hello World"))
+			require_NoError(t, err)
+		}
+		fs.mu.Lock()
+		fs.checkAndFlushAllBlocks()
+		blks := append([]*msgBlock(nil), fs.blks...)
+		fs.mu.Unlock()
+		for _, mb := range blks[:len(blks)-1] {
+			require_NoError(t, mb.recompressOnDiskIfNeeded())
+		}
+		mb := blks[0]
+
+		waitEntered := func() {
+			t.Helper()
+			select {
+			case <-tier.entered:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Tier store was not accessed")
+			}
+		}
+
+		// The first block can be used while it is uploaded, and is kept locally if it changed.
+		done := make(chan struct{})
+		go func() {
+			fs.tierBlocks()
+			close(done)
+		}()
+		waitEntered()
+		sm, err := fs.LoadMsg(1, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "foo.0")
+		mb.mu.Lock()
+		mb.tgen++
+		mb.mu.Unlock()
+		close(tier.release)
+		<-done
+		mb.mu.RLock()
+		tiered := mb.tiered
+		mb.mu.RUnlock()
+		require_False(t, tiered)
+		for _, mb := range blks[1 : len(blks)-1] {
+			mb.mu.RLock()
+			tiered := mb.tiered
+			mb.mu.RUnlock()
+			require_True(t, tiered)
+		}
+
+		// The next check offloads it.
+		fs.tierBlocks()
+		mb.mu.RLock()
+		tiered = mb.tiered
+		mb.mu.RUnlock()
+		require_True(t, tiered)
+
+		// The block is not locked while it is fetched back.
+		tier.release = make(chan struct{})
+		for len(tier.entered) > 0 {
+			<-tier.entered
+		}
+		done = make(chan struct{})
+		go func() {
+			fs.LoadMsg(2, nil)
+			close(done)
+		}()
+		waitEntered()
+		mb.mu.Lock()
+		require_True(t, mb.tiered)
+		mb.mu.Unlock()
+		close(tier.release)
+		<-done
+		sm, err = fs.LoadMsg(2, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "foo.1")
+		sm, err = fs.LoadMsg(1, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "foo.0")
+	})
+}
+
+func TestFileStoreBackgroundCompactionReclaimed(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		var blocks int
+		var reclaimed uint64
+		fs.registerCompactionUpdates(func(b int, r uint64) {
+			blocks += b
+			reclaimed += r
+		})
+
+		// Random so the blocks do not compress.
+		msg := make([]byte, 128)
+		crand.Read(msg)
+		for i := 0; i < 100; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		// Leave holes, keeping every fourth message.
+		for seq := uint64(1); seq <= 100; seq++ {
+			if seq%4 != 0 {
+				_, err = fs.RemoveMsg(seq)
+				require_NoError(t, err)
+			}
+		}
+
+		onDisk := func() int64 {
+			t.Helper()
+			files, err := filepath.Glob(filepath.Join(fcfg.StoreDir, msgDir, "*.blk"))
+			require_NoError(t, err)
+			var total int64
+			for _, fn := range files {
+				fi, err := os.Stat(fn)
+				require_NoError(t, err)
+				total += fi.Size()
+			}
+			return total
+		}
+		before := onDisk()
+
+		fs.syncBlocks()
+		require_True(t, blocks > 0)
+		require_True(t, reclaimed > 0)
+		state := fs.State()
+		require_Equal(t, state.Msgs, 25)
+		require_Equal(t, fs.reclaimed.Load(), reclaimed)
+		require_True(t, onDisk() < before)
+
+		// Nothing more to reclaim.
+		fs.syncBlocks()
+		require_Equal(t, fs.reclaimed.Load(), reclaimed)
+	})
+}
+
+func TestFileStoreScrub(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := make([]byte, 128)
+		crand.Read(msg)
+		for i := 0; i < 100; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		_, err = fs.RemoveMsg(50)
+		require_NoError(t, err)
+
+		scrub := func() *StreamScrubResult {
+			t.Helper()
+			ch := make(chan *StreamScrubResult, 1)
+			require_NoError(t, fs.scrub(func(res *StreamScrubResult, err error) {
+				require_NoError(t, err)
+				ch <- res
+			}))
+			select {
+			case res := <-ch:
+				return res
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Scrub did not complete")
+			}
+			return nil
+		}
+
+		res := scrub()
+		require_Equal(t, res.Blocks, fs.numMsgBlocks())
+		require_Equal(t, res.Msgs, 99)
+		require_Equal(t, res.NumCorrupt, 0)
+
+		// Corrupt the middle of the second block.
+		fs.mu.RLock()
+		mb := fs.blks[1]
+		fs.mu.RUnlock()
+		mb.mu.Lock()
+		first, last := atomic.LoadUint64(&mb.first.seq), atomic.LoadUint64(&mb.last.seq)
+		mb.clearCacheAndOffset()
+		mb.mu.Unlock()
+		buf, err := os.ReadFile(mb.mfn)
+		require_NoError(t, err)
+		buf[len(buf)/2] ^= 0xff
+		require_NoError(t, os.WriteFile(mb.mfn, buf, defaultFilePerms))
+
+		res = scrub()
+		require_True(t, res.NumCorrupt > 0)
+		require_Equal(t, len(res.Corrupt), res.NumCorrupt)
+		require_True(t, res.Msgs < 99)
+		for _, seq := range res.Corrupt {
+			require_True(t, seq >= first && seq <= last)
+		}
+	})
+}
+
+func TestFileStoreGroupCommit(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		// Only when syncing all writes.
+		require_False(t, fs.beginGroupCommit())
+		fs.Stop()
+
+		fcfg.SyncAlways = true
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		lmbSize := func() int64 {
+			t.Helper()
+			fs.mu.RLock()
+			mfn := fs.lmb.mfn
+			fs.mu.RUnlock()
+			fi, err := os.Stat(mfn)
+			require_NoError(t, err)
+			return fi.Size()
+		}
+
+		require_True(t, fs.beginGroupCommit())
+		msg := make([]byte, 128)
+		for i := 0; i < 5; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		// Held until committed.
+		require_Equal(t, lmbSize(), 0)
+		require_NoError(t, fs.commitGroup())
+		require_True(t, lmbSize() > 0)
+
+		// Groups spanning blocks.
+		require_True(t, fs.beginGroupCommit())
+		for i := 0; i < 50; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		require_True(t, fs.numMsgBlocks() > 1)
+		require_NoError(t, fs.commitGroup())
+
+		// Back to syncing every write.
+		_, _, err = fs.StoreMsg("foo", nil, msg)
+		require_NoError(t, err)
+		size := lmbSize()
+		_, _, err = fs.StoreMsg("foo", nil, msg)
+		require_NoError(t, err)
+		require_True(t, lmbSize() > size)
+
+		// Everything made it to disk.
+		fs.Stop()
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		state := fs.State()
+		require_Equal(t, state.Msgs, 57)
+		require_Equal(t, state.LastSeq, 57)
+	})
+}
+
+func TestFileStoreSetBlockSize(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := make([]byte, 100)
+		for i := 0; i < 50; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		nblks := fs.numMsgBlocks()
+		require_True(t, nblks > 1)
+
+		fs.setBlockSize(8192)
+		require_Equal(t, fs.fileStoreConfig().BlockSize, 8192)
+		for i := 0; i < 50; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+
+		// Existing blocks are kept, new ones use the new size.
+		fs.mu.RLock()
+		blks := append([]*msgBlock(nil), fs.blks...)
+		fs.mu.RUnlock()
+		for i, mb := range blks {
+			mb.mu.RLock()
+			sz := mb.bytes
+			mb.mu.RUnlock()
+			if i < nblks-1 {
+				require_True(t, sz <= 1024)
+			}
+		}
+		require_True(t, len(blks) < nblks+2)
+		require_Equal(t, fs.State().Msgs, 100)
+	})
+}
+
+func TestFileStoreTimePartitions(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, PartitionInterval: time.Hour}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		// Three messages in each of the last three hours.
+		now := time.Now().Truncate(time.Hour)
+		seq := uint64(1)
+		for h := 2; h >= 0; h-- {
+			for i := 0; i < 3; i++ {
+				ts := now.Add(-time.Duration(h)*time.Hour + time.Duration(i)*time.Minute).UnixNano()
+				require_NoError(t, fs.StoreRawMsg("foo", nil, []byte("ok"), seq, ts))
+				seq++
+			}
+		}
+		require_Equal(t, fs.numMsgBlocks(), 3)
+
+		checkPartitions := func(first int) []*StreamPartition {
+			t.Helper()
+			parts := fs.partitions()
+			require_Len(t, len(parts), 3-first)
+			for i, p := range parts {
+				i += first
+				start := now.Add(-time.Duration(2-i) * time.Hour)
+				require_True(t, p.Start.Equal(start))
+				require_Equal(t, p.Dir, filepath.Join(msgDir, start.UTC().Format(partitionDirLayout)))
+				require_Equal(t, p.Blocks, 1)
+				require_Equal(t, p.FirstSeq, uint64(i*3+1))
+				require_Equal(t, p.LastSeq, uint64(i*3+3))
+				require_Equal(t, p.Msgs, 3)
+				require_Equal(t, p.Sealed, i < 2)
+				// Each partition has a directory of its own.
+				blks, err := filepath.Glob(filepath.Join(fcfg.StoreDir, p.Dir, "*.blk"))
+				require_NoError(t, err)
+				require_Len(t, len(blks), 1)
+			}
+			return parts
+		}
+		parts := checkPartitions(0)
+
+		// The oldest partition expires as a whole, taking its directory with it.
+		fs.expirePartitions(now.Add(-time.Hour - time.Nanosecond).UnixNano())
+		require_Equal(t, fs.numMsgBlocks(), 2)
+		state := fs.State()
+		require_Equal(t, state.FirstSeq, 4)
+		require_Equal(t, state.Msgs, 6)
+		_, err = os.Stat(filepath.Join(fcfg.StoreDir, parts[0].Dir))
+		require_True(t, os.IsNotExist(err))
+		checkPartitions(1)
+
+		// The partitions are found again on restart.
+		fs.Stop()
+		fs, err = newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		checkPartitions(1)
+		var smv StoreMsg
+		sm, err := fs.LoadMsg(5, &smv)
+		require_NoError(t, err)
+		require_Equal(t, string(sm.msg), "ok")
+
+		// Snapshots keep the blocks in their partition directories.
+		sr, err := fs.Snapshot(5*time.Second, false, true)
+		require_NoError(t, err)
+		rfcfg := fcfg
+		rfcfg.StoreDir = t.TempDir()
+		tr := tar.NewReader(s2.NewReader(sr.Reader))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require_NoError(t, err)
+			fpath := filepath.Join(rfcfg.StoreDir, filepath.Clean(hdr.Name))
+			require_NoError(t, os.MkdirAll(filepath.Dir(fpath), defaultDirPerms))
+			buf, err := io.ReadAll(tr)
+			require_NoError(t, err)
+			require_NoError(t, os.WriteFile(fpath, buf, defaultFilePerms))
+		}
+		rfs, err := newFileStoreWithCreated(rfcfg, cfg, time.Now(), prf(&rfcfg), nil)
+		require_NoError(t, err)
+		defer rfs.Stop()
+		rparts := rfs.partitions()
+		require_Len(t, len(rparts), 2)
+		for i, p := range rparts {
+			require_Equal(t, p.Dir, parts[i+1].Dir)
+			require_Equal(t, p.Msgs, 3)
+		}
+
+		// Not the one still being written to.
+		fs.expirePartitions(time.Now().UnixNano())
+		state = fs.State()
+		require_Equal(t, state.FirstSeq, 7)
+		require_Equal(t, state.Msgs, 3)
+	})
+}
+
+func TestFileStorePreallocate(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 4096
+		fcfg.Preallocate = true
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := make([]byte, 100)
+		for i := 0; i < 100; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		require_True(t, fs.numMsgBlocks() > 1)
+
+		// Preallocation keeps the size of the block files.
+		fs.mu.RLock()
+		lmb, unsupported := fs.lmb, fs.noPrealloc
+		fs.mu.RUnlock()
+		require_Equal(t, unsupported, runtime.GOOS != "linux")
+		require_NoError(t, lmb.flushPendingMsgs())
+		fi, err := os.Stat(lmb.mfn)
+		require_NoError(t, err)
+		lmb.mu.RLock()
+		rbytes := lmb.rbytes
+		lmb.mu.RUnlock()
+		require_Equal(t, uint64(fi.Size()), rbytes)
+
+		// And the blocks recover as usual.
+		fs.Stop()
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		state := fs.State()
+		require_Equal(t, state.Msgs, 100)
+		require_Equal(t, state.LastSeq, 100)
+		_, err = fs.LoadMsg(100, nil)
+		require_NoError(t, err)
+	})
+}
+
+func TestFileStoreReadAhead(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		budget := newReadAheadBudget(1024 * 1024)
+		fcfg.readAhead = budget
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		fs, err := newFileStoreWithCreated(fcfg, cfg, time.Now(), prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := make([]byte, 100)
+		for i := 0; i < 100; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		require_True(t, fs.numMsgBlocks() > 3)
+
+		clearCaches := func() {
+			fs.mu.RLock()
+			for _, mb := range fs.blks {
+				mb.mu.Lock()
+				mb.clearCacheAndOffset()
+				mb.mu.Unlock()
+			}
+			fs.mu.RUnlock()
+		}
+		clearCaches()
+		require_Equal(t, budget.used.Load(), 0)
+
+		// Reading sequentially prefetches the blocks ahead of the reader.
+		var smv StoreMsg
+		for seq := uint64(1); seq <= 100; seq++ {
+			sm, _, err := fs.LoadNextMsg("foo", false, seq, &smv)
+			require_NoError(t, err)
+			require_Equal(t, sm.seq, seq)
+			// Give the prefetch a moment, as a consumer delivering would.
+			time.Sleep(time.Millisecond)
+		}
+		stats := fs.storageStats()
+		require_True(t, stats.ReadAheads > 0)
+		require_True(t, budget.used.Load() <= budget.max)
+
+		// Nothing is read ahead once the budget is used up.
+		clearCaches()
+		require_Equal(t, budget.used.Load(), 0)
+		require_True(t, budget.reserve(budget.max))
+		for seq := uint64(1); seq <= 100; seq++ {
+			_, err := fs.LoadMsg(seq, &smv)
+			require_NoError(t, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		require_Equal(t, fs.storageStats().ReadAheads, stats.ReadAheads)
+		budget.release(budget.max)
+
+		// The budget is returned when the store stops.
+		clearCaches()
+		for seq := uint64(1); seq <= 100; seq++ {
+			_, err := fs.LoadMsg(seq, &smv)
+			require_NoError(t, err)
+		}
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if fs.storageStats().ReadAheads == stats.ReadAheads {
+				return errors.New("no read ahead")
+			}
+			return nil
+		})
+		fs.Stop()
+		require_Equal(t, budget.used.Load(), 0)
+	})
+}
+
+func TestFileStoreSecureErase(t *testing.T) {
+	fcfg := FileStoreConfig{StoreDir: t.TempDir(), BlockSize: 1024}
+	cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, MaxMsgs: 10, SecureErase: true}
+	fs, err := newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	secret := func(i int) []byte { return []byte(fmt.Sprintf("SECRET-%03d", i)) }
+	for i := 1; i <= 20; i++ {
+		_, _, err = fs.StoreMsg("foo", nil, secret(i))
+		require_NoError(t, err)
+	}
+	// Removed by delete and by compacting part of a block.
+	_, err = fs.RemoveMsg(15)
+	require_NoError(t, err)
+	fs.mu.RLock()
+	first := atomic.LoadUint64(&fs.lmb.first.seq)
+	fs.mu.RUnlock()
+	_, err = fs.Compact(first + 1)
+	require_NoError(t, err)
+	fs.checkAndFlushAllBlocks()
+
+	var onDisk []byte
+	files, err := filepath.Glob(filepath.Join(fcfg.StoreDir, msgDir, "*.blk"))
+	require_NoError(t, err)
+	for _, fn := range files {
+		buf, err := os.ReadFile(fn)
+		require_NoError(t, err)
+		onDisk = append(onDisk, buf...)
+	}
+	state := fs.State()
+	for i := 1; i <= 20; i++ {
+		stored := uint64(i) >= state.FirstSeq && i != 15
+		require_Equal(t, bytes.Contains(onDisk, secret(i)), stored)
+	}
+}
+
+func TestFileStoreOverwriteFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "1.blk")
+	data := bytes.Repeat([]byte("SECRET"), 1000)
+	require_NoError(t, os.WriteFile(fn, data, defaultFilePerms))
+	require_NoError(t, overwriteFile(fn))
+	buf, err := os.ReadFile(fn)
+	require_NoError(t, err)
+	require_Equal(t, len(buf), len(data))
+	require_False(t, bytes.Contains(buf, []byte("SECRET")))
+}
+
+func TestFileStoreRepairOnRecovery(t *testing.T) {
+	fcfg := FileStoreConfig{StoreDir: t.TempDir(), BlockSize: 1024}
+	cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+	created := time.Now()
+	fs, err := newFileStoreWithCreated(fcfg, cfg, created, nil, nil)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	msg := make([]byte, 100)
+	for i := 0; i < 30; i++ {
+		_, _, err = fs.StoreMsg("foo", nil, msg)
+		require_NoError(t, err)
+	}
+	require_True(t, fs.recoveryRepair() == nil)
+
+	blocks := func() []*msgBlock {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+		return append([]*msgBlock(nil), fs.blks...)
+	}
+	restart := func() {
+		t.Helper()
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, nil, nil)
+		require_NoError(t, err)
+	}
+
+	// Truncating the last block in the middle of its last message drops just that message.
+	blks := blocks()
+	lmb := blks[len(blks)-1]
+	fs.Stop()
+	os.Remove(filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile))
+	fi, err := os.Stat(lmb.mfn)
+	require_NoError(t, err)
+	require_NoError(t, os.Truncate(lmb.mfn, fi.Size()-10))
+	restart()
+	repair := fs.recoveryRepair()
+	require_True(t, repair != nil)
+	require_Equal(t, repair.LastSeq, 29)
+	require_Len(t, len(repair.Blocks), 0)
+	require_True(t, repair.Lost != nil)
+	// The sequence of a partially written message can not be read back, only its bytes are accounted.
+	require_True(t, repair.Lost.Bytes > 0)
+	require_Equal(t, fs.State().Msgs, 29)
+
+	// A block that can not be read at all is dropped.
+	blks = blocks()
+	lmb, pmb := blks[len(blks)-1], blks[len(blks)-2]
+	fs.Stop()
+	os.Remove(filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile))
+	require_NoError(t, os.WriteFile(lmb.mfn, []byte{'c', 'm', 'p', byte(S2Compression), 100, 1, 2, 3, 4, 5}, defaultFilePerms))
+	restart()
+	defer fs.Stop()
+	repair = fs.recoveryRepair()
+	require_True(t, repair != nil)
+	require_Equal(t, repair.LastSeq, atomic.LoadUint64(&pmb.last.seq))
+	require_Len(t, len(repair.Blocks), 1)
+	require_Equal(t, repair.Blocks[0], filepath.Base(lmb.mfn))
+	state := fs.State()
+	require_Equal(t, state.LastSeq, atomic.LoadUint64(&pmb.last.seq))
+}
+
+func TestFileStoreIndexDir(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage}
+		created := time.Now()
+		// Start with the index next to the blocks.
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		for i := 0; i < 10; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, []byte("ok"))
+			require_NoError(t, err)
+		}
+		fs.Stop()
+		mfn := filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile)
+		_, err = os.Stat(mfn)
+		require_NoError(t, err)
+
+		// Placing the index apart moves it over and recovers from it.
+		fcfg.IndexDir = filepath.Join(t.TempDir(), "idx")
+		ifn := filepath.Join(fcfg.IndexDir, streamStreamStateFile)
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		_, err = os.Stat(mfn)
+		require_True(t, os.IsNotExist(err))
+		_, err = os.Stat(ifn)
+		require_NoError(t, err)
+		require_Equal(t, fs.State().Msgs, 10)
+
+		_, _, err = fs.StoreMsg("foo", nil, []byte("ok"))
+		require_NoError(t, err)
+		fs.Stop()
+		_, err = os.Stat(mfn)
+		require_True(t, os.IsNotExist(err))
+		_, err = os.Stat(ifn)
+		require_NoError(t, err)
+
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		state := fs.State()
+		require_Equal(t, state.Msgs, 11)
+		require_Equal(t, state.LastSeq, 11)
+
+		// Deleting the store removes the index as well.
+		require_NoError(t, fs.Delete())
+		_, err = os.Stat(fcfg.IndexDir)
+		require_True(t, os.IsNotExist(err))
+	})
+}
+
+func TestFileStoreMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require_NoError(t, os.WriteFile(src, []byte("index"), defaultFilePerms))
+	require_NoError(t, moveFile(src, dst))
+	_, err := os.Stat(src)
+	require_True(t, os.IsNotExist(err))
+	buf, err := os.ReadFile(dst)
+	require_NoError(t, err)
+	require_Equal(t, string(buf), "index")
+	require_Error(t, moveFile(src, dst))
+}
+
+func TestFileStoreDirectIO(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 16 * 1024
+		fcfg.DirectIO = true
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		// Sizes that do not line up with the alignment of direct writes.
+		for i := 0; i < 500; i++ {
+			msg := bytes.Repeat([]byte{byte(i)}, 33+i%97)
+			_, _, err = fs.StoreMsg(fmt.Sprintf("foo.%d", i), nil, msg)
+			require_NoError(t, err)
+			if i%7 == 0 {
+				fs.mu.RLock()
+				lmb := fs.lmb
+				fs.mu.RUnlock()
+				require_NoError(t, lmb.flushPendingMsgs())
+			}
+		}
+		fs.mu.RLock()
+		lmb := fs.lmb
+		fs.mu.RUnlock()
+		require_NoError(t, lmb.flushPendingMsgs())
+		if runtime.GOOS == "linux" {
+			require_False(t, fs.noDirect.Load())
+		}
+
+		// Padding of the last page is kept while the block is written to.
+		fi, err := os.Stat(lmb.mfn)
+		require_NoError(t, err)
+		lmb.mu.RLock()
+		rbytes := lmb.rbytes
+		lmb.mu.RUnlock()
+		require_True(t, uint64(fi.Size()) >= rbytes)
+		if runtime.GOOS == "linux" {
+			require_Equal(t, fi.Size()%directIOAlign, 0)
+		}
+
+		// And truncated off once sealed.
+		fs.mu.RLock()
+		blks := fs.blks[:len(fs.blks)-1]
+		fs.mu.RUnlock()
+		require_True(t, len(blks) > 0)
+		for _, mb := range blks {
+			// Sealed blocks may be compressed in the background.
+			mb.mu.RLock()
+			fi, err := os.Stat(mb.mfn)
+			rbytes := mb.rbytes
+			mb.mu.RUnlock()
+			require_NoError(t, err)
+			require_Equal(t, uint64(fi.Size()), rbytes)
+		}
+
+		check := func() {
+			t.Helper()
+			state := fs.State()
+			require_Equal(t, state.Msgs, 500)
+			for i := 0; i < 500; i++ {
+				sm, err := fs.LoadMsg(uint64(i+1), nil)
+				require_NoError(t, err)
+				require_Equal(t, sm.subj, fmt.Sprintf("foo.%d", i))
+				require_True(t, bytes.Equal(sm.msg, bytes.Repeat([]byte{byte(i)}, 33+i%97)))
+			}
+		}
+		check()
+
+		// And on stop.
+		fs.Stop()
+		fi, err = os.Stat(lmb.mfn)
+		require_NoError(t, err)
+		require_Equal(t, uint64(fi.Size()), rbytes)
+
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		check()
+	})
+}
+
+func TestFileStoreAlignedBuf(t *testing.T) {
+	for _, size := range []int{directIOAlign, directIOBufSize} {
+		buf := alignedBuf(size)
+		require_Equal(t, len(buf), size)
+		require_Equal(t, cap(buf), size)
+		require_Equal(t, uintptr(unsafe.Pointer(&buf[0]))%directIOAlign, 0)
+	}
+}
+
+func TestFileStoreMaxBlocks(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, MaxBlocks: 3}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := bytes.Repeat([]byte("Z"), 200)
+		for i := 0; i < 100; i++ {
+			_, _, err = fs.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+		}
+		bs := fs.blockStats()
+		require_True(t, bs.Blocks <= 3)
+		require_Equal(t, bs.Max, 3)
+		state := fs.State()
+		require_Equal(t, state.LastSeq, 100)
+		require_True(t, state.Msgs < 100)
+		require_Equal(t, state.FirstSeq, state.LastSeq-state.Msgs+1)
+	})
+
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo"}, Storage: FileStorage, MaxBlocks: 3, Discard: DiscardNew}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		msg := bytes.Repeat([]byte("Z"), 200)
+		var stored int
+		for i := 0; i < 100; i++ {
+			if _, _, err = fs.StoreMsg("foo", nil, msg); err != nil {
+				break
+			}
+			stored++
+		}
+		require_Error(t, err, ErrMaxBlocks)
+		require_Equal(t, fs.blockStats().Blocks, 3)
+		state := fs.State()
+		require_Equal(t, state.Msgs, uint64(stored))
+		require_Equal(t, state.FirstSeq, 1)
+	})
+}
+
+func TestFileStoreChunkLargeMsgs(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 1024
+		cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage, ChunkLargeMsgs: true}
+		created := time.Now()
+		fs, err := newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		// Every third message is larger than a block, some with headers.
+		msgs := make(map[uint64][2][]byte)
+		var total uint64
+		for i := 1; i <= 30; i++ {
+			var hdr []byte
+			msg := []byte("small")
+			if i%3 == 0 {
+				msg = bytes.Repeat([]byte{byte(i)}, 5000+i)
+			}
+			if i%2 == 0 {
+				hdr = []byte(fmt.Sprintf("NATS/1.0\r\nX: %d\r\n\r\n", i))
+			}
+			seq, _, err := fs.StoreMsg(fmt.Sprintf("foo.%d", i%3), hdr, msg)
+			require_NoError(t, err)
+			msgs[seq] = [2][]byte{hdr, msg}
+			total += fileStoreMsgSize(fmt.Sprintf("foo.%d", i%3), hdr, msg)
+		}
+
+		chunked := func() int {
+			t.Helper()
+			files, _ := filepath.Glob(filepath.Join(fcfg.StoreDir, msgDir, chunkDir, "*.chk"))
+			return len(files)
+		}
+		check := func() {
+			t.Helper()
+			state := fs.State()
+			require_Equal(t, state.Bytes, total)
+			require_Equal(t, state.Msgs, uint64(len(msgs)))
+			for seq, m := range msgs {
+				sm, err := fs.LoadMsg(seq, nil)
+				require_NoError(t, err)
+				require_True(t, bytes.Equal(sm.hdr, m[0]))
+				require_True(t, bytes.Equal(sm.msg, m[1]))
+			}
+			sm, err := fs.LoadLastMsg("foo.0", nil)
+			require_NoError(t, err)
+			require_Equal(t, len(sm.msg), 5030)
+			sm, _, err = fs.LoadNextMsg("foo.0", false, 1, nil)
+			require_NoError(t, err)
+			require_Equal(t, sm.seq, 3)
+			require_True(t, bytes.Equal(sm.msg, msgs[3][1]))
+		}
+		check()
+
+		// Encrypted stores keep large messages in their blocks.
+		if fs.prf != nil {
+			require_Equal(t, chunked(), 0)
+			return
+		}
+		// Each large message is split in 5 chunks, the blocks hold none of it.
+		require_Equal(t, chunked(), 50)
+		fs.mu.RLock()
+		for _, mb := range fs.blks {
+			mb.mu.RLock()
+			require_True(t, mb.rbytes <= fcfg.BlockSize)
+			mb.mu.RUnlock()
+		}
+		fs.mu.RUnlock()
+
+		// Removing a chunked message removes its chunks.
+		n := chunked()
+		removed, err := fs.RemoveMsg(6)
+		require_NoError(t, err)
+		require_True(t, removed)
+		total -= fileStoreMsgSize("foo.0", msgs[6][0], msgs[6][1])
+		delete(msgs, 6)
+		require_True(t, chunked() < n)
+		check()
+
+		// Recovered with and without the index.
+		fs.Stop()
+		fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+		require_NoError(t, err)
+		defer fs.Stop()
+		check()
+		// Blocks being recompressed in the background can not be rebuilt reliably right away.
+		if fcfg.Compression == NoCompression {
+			fs.Stop()
+			os.Remove(filepath.Join(fcfg.StoreDir, msgDir, streamStreamStateFile))
+			fs, err = newFileStoreWithCreated(fcfg, cfg, created, prf(&fcfg), nil)
+			require_NoError(t, err)
+			defer fs.Stop()
+			check()
+		}
+
+		// Chunks of compacted and truncated messages are removed.
+		for seq := uint64(1); seq < 10; seq++ {
+			if m, ok := msgs[seq]; ok {
+				total -= fileStoreMsgSize(fmt.Sprintf("foo.%d", seq%3), m[0], m[1])
+				delete(msgs, seq)
+			}
+		}
+		_, err = fs.Compact(10)
+		require_NoError(t, err)
+		for seq := uint64(28); seq <= 30; seq++ {
+			m := msgs[seq]
+			total -= fileStoreMsgSize(fmt.Sprintf("foo.%d", seq%3), m[0], m[1])
+			delete(msgs, seq)
+		}
+		require_NoError(t, fs.Truncate(27))
+		check2 := func() {
+			t.Helper()
+			state := fs.State()
+			require_Equal(t, state.Bytes, total)
+			for seq, m := range msgs {
+				sm, err := fs.LoadMsg(seq, nil)
+				require_NoError(t, err)
+				require_True(t, bytes.Equal(sm.msg, m[1]))
+			}
+		}
+		check2()
+		// 12, 15, 18, 21, 24 and 27 are left, in 5 chunks each.
+		require_Equal(t, chunked(), 30)
+
+		_, err = fs.Purge()
+		require_NoError(t, err)
+		require_Equal(t, chunked(), 0)
+		require_Equal(t, fs.State().Bytes, 0)
+	})
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// TierStore is an object store the message blocks of file stores are offloaded to.
+type TierStore interface {
+	// Put stores data under key.
+	Put(key string, data []byte) error
+	// Get returns the data stored under key, or errTierNotFound.
+	Get(key string) ([]byte, error)
+	// Delete removes the data stored under key.
+	Delete(key string) error
+}
+
+// StreamTiering offloads the message blocks of a file based stream to the tier store
+// of the server, the blocks are fetched back on demand when messages are loaded.
+// The last block of the stream is always kept locally.
+type StreamTiering struct {
+	// MaxAge offloads a block once its last message is older.
+	MaxAge time.Duration `json:"max_age,omitempty"`
+	// MaxLocalBytes offloads the oldest blocks while the blocks kept locally are larger.
+	MaxLocalBytes int64 `json:"max_local_bytes,omitempty"`
+}
+
+const (
+	// Marks a block that is stored in the tier store.
+	tierScan = "%d.tier"
+)
+
+var (
+	errTierNotFound = errors.New("tier store key not found")
+	errNoTierStore  = errors.New("block is offloaded but no tier store is configured")
+	errBlockTiered  = errors.New("block is offloaded to the tier store")
+)
+
+// How often the blocks are checked to be offloaded.
+var tierCheckInterval = time.Minute
+
+// Checks the tiering configuration of a stream.
+func (t *StreamTiering) validate(cfg *StreamConfig, tier TierStore) error {
+	if cfg.Storage != FileStorage {
+		return errors.New("tiering requires file storage")
+	}
+	if tier == nil {
+		return errors.New("tiering requires a tier store configured on the server")
+	}
+	if t.MaxAge < 0 || t.MaxLocalBytes < 0 {
+		return errors.New("tiering limits can not be negative")
+	}
+	if t.MaxAge == 0 && t.MaxLocalBytes == 0 {
+		return errors.New("tiering requires a max age or max local bytes")
+	}
+	return nil
+}
+
+// Tier store that keeps the keys of one stream under a prefix.
+type prefixTierStore struct {
+	tier   TierStore
+	prefix string
+}
+
+func (t *prefixTierStore) Put(key string, data []byte) error {
+	return t.tier.Put(path.Join(t.prefix, key), data)
+}
+
+func (t *prefixTierStore) Get(key string) ([]byte, error) {
+	return t.tier.Get(path.Join(t.prefix, key))
+}
+
+func (t *prefixTierStore) Delete(key string) error {
+	return t.tier.Delete(path.Join(t.prefix, key))
+}
+
+// Returns the tier store for the blocks of a stream, nil if the server has none.
+func (s *Server) streamTierStore(acc, stream string) TierStore {
+	js := s.getJetStream()
+	if js == nil || js.tier == nil {
+		return nil
+	}
+	return &prefixTierStore{tier: js.tier, prefix: path.Join(acc, stream)}
+}
+
+// Checks if the block was offloaded, on init.
+// Lock should be held.
+func (mb *msgBlock) initTier() {
+	mb.tfn = filepath.Join(filepath.Dir(mb.mfn), fmt.Sprintf(tierScan, mb.index))
+	if _, err := os.Stat(mb.tfn); err != nil {
+		return
+	}
+	mb.intier = true
+	if _, err := os.Stat(mb.mfn); os.IsNotExist(err) {
+		mb.tiered = true
+	}
+}
+
+// Fetches the block back from the tier store if it was offloaded.
+// Lock should be held, it is released while the block is fetched from the
+// tier store, so callers need to check the state of the block again.
+func (mb *msgBlock) fetchTiered() error {
+	for mb.tiered {
+		tier := mb.fs.fcfg.Tier
+		if tier == nil {
+			return errNoTierStore
+		}
+		// Wait for a fetch already in progress.
+		if fch := mb.tfetch; fch != nil {
+			mb.mu.Unlock()
+			<-fch
+			mb.mu.Lock()
+			continue
+		}
+		fch, tgen := make(chan struct{}), mb.tgen
+		mb.tfetch = fch
+		mb.mu.Unlock()
+		buf, err := tier.Get(fmt.Sprintf(blkScan, mb.index))
+		mb.mu.Lock()
+		mb.tfetch = nil
+		close(fch)
+		if err != nil {
+			return err
+		}
+		// The block was removed, or fetched and offloaded again, in the meantime.
+		if !mb.tiered || mb.tgen != tgen {
+			continue
+		}
+		<-dios
+		err = os.WriteFile(mb.mfn, buf, defaultFilePerms)
+		dios <- struct{}{}
+		if err != nil {
+			return err
+		}
+		mb.tiered = false
+		mb.tgen++
+	}
+	return nil
+}
+
+// Offloads the block to the tier store and removes it locally. Returns true if it was offloaded.
+// The block is uploaded again if it was fetched, since it could have changed.
+// The block is read with the lock held but uploaded without it, and is only removed
+// locally if its generation did not change in the meantime, otherwise it is offloaded
+// on a later check.
+// Lock should not be held.
+func (mb *msgBlock) offloadToTier(tier TierStore) (bool, error) {
+	mb.mu.Lock()
+	if mb.tiered || mb.closed || mb.tfetch != nil || mb.mfn == _EMPTY_ || mb.pendingWriteSizeLocked() > 0 {
+		mb.mu.Unlock()
+		return false, nil
+	}
+	tgen := mb.tgen
+	<-dios
+	buf, err := os.ReadFile(mb.mfn)
+	dios <- struct{}{}
+	mb.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	if err := tier.Put(fmt.Sprintf(blkScan, mb.index), buf); err != nil {
+		return false, err
+	}
+
+	// The last block is always kept locally, it changes on truncate.
+	fs := mb.fs
+	fs.mu.RLock()
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	lmb := fs.lmb
+	fs.mu.RUnlock()
+
+	if mb == lmb || mb.tiered || mb.closed || mb.tgen != tgen || mb.pendingWriteSizeLocked() > 0 {
+		return false, nil
+	}
+	if !mb.intier {
+		<-dios
+		err = os.WriteFile(mb.tfn, nil, defaultFilePerms)
+		dios <- struct{}{}
+		if err != nil {
+			return false, err
+		}
+		mb.intier = true
+	}
+	mb.clearCacheAndOffset()
+	mb.closeFDsLockedNoCheck()
+	<-dios
+	err = os.Remove(mb.mfn)
+	dios <- struct{}{}
+	if err != nil {
+		return false, err
+	}
+	mb.tiered = true
+	mb.tgen++
+	return true, nil
+}
+
+// Removes the block from the tier store, the store is updated in the background.
+// Lock should be held.
+func (mb *msgBlock) removeFromTier() {
+	if !mb.intier {
+		return
+	}
+	os.Remove(mb.tfn)
+	mb.intier, mb.tiered = false, false
+	mb.tgen++
+	if tier := mb.fs.fcfg.Tier; tier != nil {
+		key := fmt.Sprintf(blkScan, mb.index)
+		go func() {
+			if err := tier.Delete(key); err != nil {
+				mb.fs.warn("Could not remove block %q from tier store: %v", key, err)
+			}
+		}()
+	}
+}
+
+// Returns the bytes of the block kept locally.
+// Lock should be held.
+func (mb *msgBlock) localBytes() uint64 {
+	if mb.tiered {
+		return 0
+	}
+	if mb.rbytes > 0 {
+		return mb.rbytes
+	}
+	return mb.bytes
+}
+
+// Offloads the blocks past the tiering limits of the stream to the tier store, oldest first.
+func (fs *fileStore) tierBlocks() {
+	fs.mu.RLock()
+	if fs.closed || fs.closing {
+		fs.mu.RUnlock()
+		return
+	}
+	tiering, tier, lmb := fs.cfg.Tiering, fs.fcfg.Tier, fs.lmb
+	blks := append([]*msgBlock(nil), fs.blks...)
+	fs.mu.RUnlock()
+
+	if tiering == nil || tier == nil {
+		return
+	}
+
+	var local uint64
+	for _, mb := range blks {
+		mb.mu.RLock()
+		local += mb.localBytes()
+		mb.mu.RUnlock()
+	}
+
+	cutoff := time.Now().Add(-tiering.MaxAge).UnixNano()
+	for _, mb := range blks {
+		if mb == lmb {
+			break
+		}
+		mb.mu.RLock()
+		byAge := tiering.MaxAge > 0 && mb.last.ts < cutoff
+		bySize := tiering.MaxLocalBytes > 0 && local > uint64(tiering.MaxLocalBytes)
+		tiered, sz := mb.tiered, mb.localBytes()
+		mb.mu.RUnlock()
+		if tiered || !(byAge || bySize) {
+			continue
+		}
+		if offloaded, err := mb.offloadToTier(tier); err != nil {
+			fs.warn("Could not offload block %d to tier store: %v", mb.index, err)
+		} else if offloaded {
+			local -= sz
+		}
+	}
+}
+
+// Sets up the timer to offload blocks, if the stream is tiered.
+// Lock should be held.
+func (fs *fileStore) setTierTimer() {
+	if fs.cfg.Tiering == nil || fs.fcfg.Tier == nil {
+		fs.cancelTierTimer()
+		return
+	}
+	if fs.tierTmr == nil {
+		fs.tierTmr = time.AfterFunc(tierCheckInterval, fs.checkTiering)
+	}
+}
+
+// Lock should be held.
+func (fs *fileStore) cancelTierTimer() {
+	if fs.tierTmr != nil {
+		fs.tierTmr.Stop()
+		fs.tierTmr = nil
+	}
+}
+
+// Called by the tier timer.
+func (fs *fileStore) checkTiering() {
+	fs.tierBlocks()
+	fs.mu.Lock()
+	if !fs.closed && fs.tierTmr != nil {
+		fs.tierTmr.Reset(tierCheckInterval)
+	}
+	fs.mu.Unlock()
+}
@@ -21,6 +21,37 @@ import (
 
 const ipQueueDefaultMaxRecycleSize = 4 * 1024
 
+// QueueLimitPolicy is what an internal queue does once one of its limits is reached.
+type QueueLimitPolicy string
+
+const (
+	// QueueBackpressure rejects new entries so that the producer can slow down.
+	QueueBackpressure = QueueLimitPolicy("backpressure")
+	// QueueDropNew silently discards new entries.
+	QueueDropNew = QueueLimitPolicy("drop_new")
+	// QueueDropOldest discards the oldest entries to make room for new ones.
+	QueueDropOldest = QueueLimitPolicy("drop_oldest")
+)
+
+// QueueLimit bounds an internal queue by number of entries and/or bytes.
+// A zero limit means unlimited.
+type QueueLimit struct {
+	MaxMsgs  int              `json:"max_msgs,omitempty"`
+	MaxBytes int64            `json:"max_bytes,omitempty"`
+	Policy   QueueLimitPolicy `json:"policy,omitempty"`
+}
+
+// JSQueueLimits are the limits of the internal queues used by JetStream.
+type JSQueueLimits struct {
+	// RaftProposals bounds the pending proposals of each raft group.
+	RaftProposals QueueLimit `json:"raft_proposals,omitempty"`
+	// Catchup bounds the messages received while a stream replica catches up.
+	Catchup QueueLimit `json:"catchup,omitempty"`
+	// Outbound bounds the queue of each stream used to send advisories,
+	// acks and push consumer deliveries. Once bounded, it must use a drop policy.
+	Outbound QueueLimit `json:"outbound,omitempty"`
+}
+
 // This is a generic intra-process queue.
 type ipQueue[T any] struct {
 	inprogress int64
@@ -32,6 +63,9 @@ type ipQueue[T any] struct {
 	sz   uint64 // Calculated size (only if calc != nil)
 	name string
 	m    *sync.Map
+	// Number of entries dropped or rejected due to the limits.
+	dropped  atomic.Uint64
+	rejected atomic.Uint64
 	ipQueueOpts[T]
 }
 
@@ -40,6 +74,8 @@ type ipQueueOpts[T any] struct {
 	calc func(e T) uint64 // Calc function for tracking size
 	msz  uint64           // Limit by total calculated size
 	mlen int              // Limit by number of entries
+	pol  QueueLimitPolicy // What to do when a limit is reached
+	drop func(e T)        // Called for entries discarded by the drop policies
 }
 
 type ipQueueOpt[T any] func(*ipQueueOpts[T])
@@ -80,6 +116,34 @@ func ipqLimitByLen[T any](max int) ipQueueOpt[T] {
 	}
 }
 
+// This option selects what push() does once a limit is reached. By default
+// the entry is rejected and an error returned to the caller, which can then
+// apply backpressure. The drop policies instead discard either the new entry
+// or the oldest ones to make room, and push() does not return an error.
+func ipqLimitPolicy[T any](pol QueueLimitPolicy) ipQueueOpt[T] {
+	return func(o *ipQueueOpts[T]) {
+		o.pol = pol
+	}
+}
+
+// This option applies the limits and policy of a configured queue limit.
+func ipqLimits[T any](ql QueueLimit) ipQueueOpt[T] {
+	return func(o *ipQueueOpts[T]) {
+		o.mlen, o.pol = ql.MaxMsgs, ql.Policy
+		if ql.MaxBytes > 0 {
+			o.msz = uint64(ql.MaxBytes)
+		}
+	}
+}
+
+// This option sets a function called with each entry discarded by the drop
+// policies, for instance to return it to its pool.
+func ipqDropHandler[T any](drop func(e T)) ipQueueOpt[T] {
+	return func(o *ipQueueOpts[T]) {
+		o.drop = drop
+	}
+}
+
 var errIPQLenLimitReached = errors.New("IPQ len limit reached")
 var errIPQSizeLimitReached = errors.New("IPQ size limit reached")
 
@@ -113,15 +177,45 @@ func newIPQueue[T any](s *Server, name string, opts ...ipQueueOpt[T]) *ipQueue[T
 func (q *ipQueue[T]) push(e T) (int, error) {
 	q.Lock()
 	l := len(q.elts) - q.pos
-	if q.mlen > 0 && l == q.mlen {
-		q.Unlock()
-		return l, errIPQLenLimitReached
+	if q.mlen > 0 && l >= q.mlen {
+		switch q.pol {
+		case QueueDropNew:
+			q.Unlock()
+			q.dropped.Add(1)
+			if q.drop != nil {
+				q.drop(e)
+			}
+			return l, nil
+		case QueueDropOldest:
+			q.dropOldest()
+			l--
+		default:
+			q.Unlock()
+			q.rejected.Add(1)
+			return l, errIPQLenLimitReached
+		}
 	}
 	if q.calc != nil {
 		sz := q.calc(e)
 		if q.msz > 0 && q.sz+sz > q.msz {
-			q.Unlock()
-			return l, errIPQSizeLimitReached
+			switch q.pol {
+			case QueueDropNew:
+				q.Unlock()
+				q.dropped.Add(1)
+				if q.drop != nil {
+					q.drop(e)
+				}
+				return l, nil
+			case QueueDropOldest:
+				for l > 0 && q.sz+sz > q.msz {
+					q.dropOldest()
+					l--
+				}
+			default:
+				q.Unlock()
+				q.rejected.Add(1)
+				return l, errIPQSizeLimitReached
+			}
 		}
 		q.sz += sz
 	}
@@ -140,6 +234,102 @@ func (q *ipQueue[T]) push(e T) (int, error) {
 	return l + 1, nil
 }
 
+// Adds all the elements `es` to the queue as one unit, so once a limit is
+// reached either all or none of them are added, and returns the length of
+// the queue after these elements are added.
+func (q *ipQueue[T]) pushMany(es []T) (int, error) {
+	q.Lock()
+	l, n := len(q.elts)-q.pos, len(es)
+	if n == 0 {
+		q.Unlock()
+		return l, nil
+	}
+	if q.mlen > 0 && l+n > q.mlen {
+		switch q.pol {
+		case QueueDropNew:
+			q.Unlock()
+			q.dropNew(es)
+			return l, nil
+		case QueueDropOldest:
+			for l > 0 && l+n > q.mlen {
+				q.dropOldest()
+				l--
+			}
+		default:
+			q.Unlock()
+			q.rejected.Add(uint64(n))
+			return l, errIPQLenLimitReached
+		}
+	}
+	if q.calc != nil {
+		var sz uint64
+		for _, e := range es {
+			sz += q.calc(e)
+		}
+		if q.msz > 0 && q.sz+sz > q.msz {
+			switch q.pol {
+			case QueueDropNew:
+				q.Unlock()
+				q.dropNew(es)
+				return l, nil
+			case QueueDropOldest:
+				for l > 0 && q.sz+sz > q.msz {
+					q.dropOldest()
+					l--
+				}
+			default:
+				q.Unlock()
+				q.rejected.Add(uint64(n))
+				return l, errIPQSizeLimitReached
+			}
+		}
+		q.sz += sz
+	}
+	if q.elts == nil {
+		// What comes out of the pool is already of size 0, so no need for [:0].
+		q.elts = *(q.pool.Get().(*[]T))
+	}
+	q.elts = append(q.elts, es...)
+	q.Unlock()
+	if l == 0 {
+		select {
+		case q.ch <- struct{}{}:
+		default:
+		}
+	}
+	return l + n, nil
+}
+
+// Removes the oldest entry to make room for a new one.
+// Lock should be held.
+func (q *ipQueue[T]) dropOldest() {
+	if len(q.elts)-q.pos == 0 {
+		return
+	}
+	if q.calc != nil {
+		q.sz -= q.calc(q.elts[q.pos])
+	}
+	if q.drop != nil {
+		q.drop(q.elts[q.pos])
+	}
+	var empty T
+	q.elts[q.pos] = empty
+	if q.pos++; q.pos == len(q.elts) {
+		q.elts, q.pos, q.sz = q.elts[:0], 0, 0
+	}
+	q.dropped.Add(1)
+}
+
+// Discards the new elements `es` that do not fit in the queue.
+func (q *ipQueue[T]) dropNew(es []T) {
+	q.dropped.Add(uint64(len(es)))
+	if q.drop != nil {
+		for _, e := range es {
+			q.drop(e)
+		}
+	}
+}
+
 // Returns the whole list of elements currently present in the queue,
 // emptying the queue. This should be called after receiving a notification
 // from the queue's `ch` notification channel that indicates that there
@@ -273,6 +463,11 @@ func (q *ipQueue[T]) inProgress() int64 {
 	return atomic.LoadInt64(&q.inprogress)
 }
 
+// Returns the number of entries dropped and rejected because of the limits.
+func (q *ipQueue[T]) limitStats() (dropped, rejected uint64) {
+	return q.dropped.Load(), q.rejected.Load()
+}
+
 // Remove this queue from the server's map of ipQueues.
 // All ipQueue operations (such as push/pop/etc..) are still possible.
 func (q *ipQueue[T]) unregister() {
@@ -445,6 +445,144 @@ func TestIPQueueSizeCalculationWithLimits(t *testing.T) {
 	})
 }
 
+func TestIPQueueLimitPolicies(t *testing.T) {
+	calc := ipqSizeCalculation[int](func(e int) uint64 { return 8 })
+	s := &Server{}
+
+	t.Run("Backpressure", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 5}))
+		for i := 0; i < 10; i++ {
+			_, err := q.push(i)
+			if i >= 5 {
+				require_Error(t, err, errIPQLenLimitReached)
+			} else {
+				require_NoError(t, err)
+			}
+		}
+		dropped, rejected := q.limitStats()
+		require_Equal(t, dropped, 0)
+		require_Equal(t, rejected, 5)
+	})
+
+	t.Run("DropNew", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 5, Policy: QueueDropNew}))
+		for i := 0; i < 10; i++ {
+			_, err := q.push(i)
+			require_NoError(t, err)
+		}
+		require_Equal(t, q.len(), 5)
+		require_Equal(t, q.size(), 40)
+		elts := q.pop()
+		require_Equal(t, elts[0], 0)
+		require_Equal(t, elts[4], 4)
+		dropped, rejected := q.limitStats()
+		require_Equal(t, dropped, 5)
+		require_Equal(t, rejected, 0)
+	})
+
+	t.Run("DropOldestByLen", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 5, Policy: QueueDropOldest}))
+		for i := 0; i < 10; i++ {
+			n, err := q.push(i)
+			require_NoError(t, err)
+			require_LessThan(t, n, 6)
+		}
+		require_Equal(t, q.len(), 5)
+		require_Equal(t, q.size(), 40)
+		for i := 5; i < 10; i++ {
+			e, ok := q.popOne()
+			require_True(t, ok)
+			require_Equal(t, e, i)
+		}
+		dropped, _ := q.limitStats()
+		require_Equal(t, dropped, 5)
+	})
+
+	t.Run("DropOldestBySize", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxBytes: 8 * 3, Policy: QueueDropOldest}))
+		for i := 0; i < 10; i++ {
+			_, err := q.push(i)
+			require_NoError(t, err)
+		}
+		require_Equal(t, q.len(), 3)
+		require_Equal(t, q.size(), 24)
+		elts := q.pop()
+		require_Equal(t, elts[0], 7)
+		require_Equal(t, elts[2], 9)
+		dropped, _ := q.limitStats()
+		require_Equal(t, dropped, 7)
+	})
+
+	t.Run("PushManyBackpressure", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 5}))
+		n, err := q.pushMany([]int{0, 1, 2})
+		require_NoError(t, err)
+		require_Equal(t, n, 3)
+		// Does not fit as a whole, so none are added.
+		n, err = q.pushMany([]int{3, 4, 5})
+		require_Error(t, err, errIPQLenLimitReached)
+		require_Equal(t, n, 3)
+		require_Equal(t, q.len(), 3)
+		require_Equal(t, q.size(), 24)
+		n, err = q.pushMany([]int{3, 4})
+		require_NoError(t, err)
+		require_Equal(t, n, 5)
+		_, rejected := q.limitStats()
+		require_Equal(t, rejected, 3)
+	})
+
+	t.Run("PushManyDropNew", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxBytes: 8 * 4, Policy: QueueDropNew}))
+		_, err := q.pushMany([]int{0, 1, 2})
+		require_NoError(t, err)
+		_, err = q.pushMany([]int{3, 4})
+		require_NoError(t, err)
+		require_Equal(t, q.len(), 3)
+		dropped, _ := q.limitStats()
+		require_Equal(t, dropped, 2)
+	})
+
+	t.Run("PushManyDropOldest", func(t *testing.T) {
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 5, Policy: QueueDropOldest}))
+		_, err := q.pushMany([]int{0, 1, 2, 3})
+		require_NoError(t, err)
+		n, err := q.pushMany([]int{4, 5, 6})
+		require_NoError(t, err)
+		require_Equal(t, n, 5)
+		require_Equal(t, q.size(), 40)
+		elts := q.pop()
+		require_Equal(t, elts[0], 2)
+		require_Equal(t, elts[4], 6)
+		dropped, _ := q.limitStats()
+		require_Equal(t, dropped, 2)
+	})
+
+	t.Run("DropHandler", func(t *testing.T) {
+		var discarded []int
+		drop := ipqDropHandler(func(e int) { discarded = append(discarded, e) })
+		q := newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 2, Policy: QueueDropNew}), drop)
+		for i := 0; i < 3; i++ {
+			q.push(i)
+		}
+		q.pushMany([]int{3, 4})
+		require_Equal(t, len(discarded), 3)
+		for i, e := range discarded {
+			require_Equal(t, e, i+2)
+		}
+
+		discarded = nil
+		q = newIPQueue[int](s, "test", calc, ipqLimits[int](QueueLimit{MaxMsgs: 2, Policy: QueueDropOldest}), drop)
+		for i := 0; i < 3; i++ {
+			q.push(i)
+		}
+		q.pushMany([]int{3, 4})
+		require_Equal(t, len(discarded), 3)
+		for i, e := range discarded {
+			require_Equal(t, e, i)
+		}
+	})
+}
+
 func Benchmark_IPQueueSizeCalculation(b *testing.B) {
 	type testType = [16]byte
 	var testValue testType
@@ -126,6 +126,18 @@ type jetStream struct {
 	oos            bool
 	shuttingDown   bool
 
+	// When we last sent a storage error advisory, to not flood the system.
+	serrs map[string]time.Time
+
+	// Snapshots of interrupted restores that can be resumed, by restore id.
+	restores map[string]*stagedRestore
+
+	// Object store message blocks of tiered streams are offloaded to.
+	tier TierStore
+
+	// Maintenance mode, has its own lock.
+	maint jsMaintenance
+
 	// Atomic versions
 	disabled atomic.Bool
 }
@@ -151,6 +163,7 @@ type jsAccount struct {
 	js        *jetStream
 	account   *Account
 	storeDir  string
+	indexDir  string
 	inflight  sync.Map
 	streams   map[string]*stream
 	templates map[string]*streamTemplate
@@ -178,6 +191,12 @@ type jsAccount struct {
 
 	// Which account to send NRG traffic into. Empty string is system account.
 	nrgAccount string
+
+	// Bounds the memory of the blocks read ahead for the file based streams.
+	readAhead *readAheadBudget
+
+	// Bounds how many streams deliver at the same time, nil if not bounded.
+	delivery *jsDeliveryBudget
 }
 
 // Track general usage for this account.
@@ -412,6 +431,9 @@ func (s *Server) initJetStreamEncryption() (err error) {
 // enableJetStream will start up the JetStream subsystem.
 func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 	js := &jetStream{srv: s, config: cfg, accounts: make(map[string]*jsAccount), apiSubs: NewSublistNoCache()}
+	if tier := s.getOpts().JetStreamTier; tier.Bucket != _EMPTY_ {
+		js.tier = newS3TierStore(tier)
+	}
 	s.gcbMu.Lock()
 	if s.gcbOutMax = s.getOpts().JetStreamMaxCatchup; s.gcbOutMax == 0 {
 		s.gcbOutMax = defaultMaxTotalCatchupOutBytes
@@ -470,7 +492,11 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 	}
 
 	if ek := opts.JetStreamKey; ek != _EMPTY_ {
-		s.Noticef("  Encryption:      %s", opts.JetStreamCipher)
+		if opts.JetStreamEncryptSnapshots {
+			s.Noticef("  Encryption:      %s (including snapshots)", opts.JetStreamCipher)
+		} else {
+			s.Noticef("  Encryption:      %s", opts.JetStreamCipher)
+		}
 	}
 	if opts.JetStreamTpm.KeysFile != _EMPTY_ {
 		s.Noticef("  TPM File:        %q, Pcr: %d", opts.JetStreamTpm.KeysFile,
@@ -511,6 +537,9 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 		}
 	}
 
+	// Start sampling stream statistics if configured.
+	s.startStreamStatsSampling()
+
 	// Mark when we are up and running.
 	js.setStarted()
 
@@ -629,6 +658,151 @@ func (s *Server) handleOutOfSpace(mset *stream) {
 	}
 }
 
+// StorageErrorAction is what the server does when its storage fails.
+type StorageErrorAction string
+
+const (
+	// StorageErrorActionDisable disables JetStream on this server.
+	StorageErrorActionDisable = StorageErrorAction("disable")
+	// StorageErrorActionReadOnly rejects new messages for the affected stream on this server.
+	StorageErrorActionReadOnly = StorageErrorAction("read_only")
+	// StorageErrorActionAdvisory only sends an advisory.
+	StorageErrorActionAdvisory = StorageErrorAction("advisory")
+)
+
+// How often we send a storage error advisory for the same stream and class.
+const storageErrorAdvisoryInterval = time.Minute
+
+// Returns the configured action for this class of storage errors.
+// Running out of space disables JetStream unless configured otherwise,
+// all other failures only make the affected stream read-only.
+func (s *Server) storageErrorAction(class StorageErrorClass) StorageErrorAction {
+	if action, ok := s.getOpts().JetStreamStorageErrors[class]; ok {
+		return action
+	}
+	if class == StorageErrorOutOfSpace {
+		return StorageErrorActionDisable
+	}
+	return StorageErrorActionReadOnly
+}
+
+// handleStorageError will apply the configured action if err is a failure of
+// the underlying storage, and returns true in that case.
+// The stream can be nil for failures outside of a stream, e.g. the raft layer.
+func (s *Server) handleStorageError(mset *stream, err error) bool {
+	class := classifyStorageError(err)
+	if class == StorageErrorNone {
+		return false
+	}
+	action := s.storageErrorAction(class)
+	// Without a stream we can not be read-only, but we can still let someone know.
+	if action == StorageErrorActionReadOnly && mset == nil {
+		action = StorageErrorActionAdvisory
+	}
+
+	var accName, stream string
+	if mset != nil {
+		accName, stream = mset.accName(), mset.name()
+	}
+
+	switch action {
+	case StorageErrorActionDisable:
+		if class == StorageErrorOutOfSpace {
+			s.handleOutOfSpace(mset)
+			return true
+		}
+		if s.JetStreamEnabled() && !s.jetStreamOOSPending() {
+			s.Errorf("JetStream storage %s error, will be DISABLED: %v", class, err)
+			go s.DisableJetStream()
+		}
+	case StorageErrorActionReadOnly:
+		if mset.setStorageReadOnly(err) {
+			s.Errorf("JetStream storage %s error, stream '%s > %s' is now read-only: %v", class, accName, stream, err)
+		}
+	}
+
+	// Rate limit the advisories per stream and class.
+	js := s.getJetStream()
+	if js == nil {
+		return true
+	}
+	key := fmt.Sprintf("%s > %s > %s", accName, stream, class)
+	now := time.Now().UTC()
+	js.mu.Lock()
+	if last, ok := js.serrs[key]; ok && now.Sub(last) < storageErrorAdvisoryInterval {
+		js.mu.Unlock()
+		return true
+	}
+	if js.serrs == nil {
+		js.serrs = make(map[string]time.Time)
+	}
+	js.serrs[key] = now
+	js.mu.Unlock()
+
+	if action == StorageErrorActionAdvisory {
+		s.RateLimitWarnf("JetStream storage %s error for '%s > %s': %v", class, accName, stream, err)
+	}
+	adv := &JSServerStorageErrorAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSServerStorageErrorAdvisoryType,
+			ID:   nuid.Next(),
+			Time: now,
+		},
+		Server:   s.Name(),
+		ServerID: s.ID(),
+		Account:  accName,
+		Stream:   stream,
+		Class:    class,
+		Action:   action,
+		Error:    err.Error(),
+		Cluster:  s.cachedClusterName(),
+		Domain:   s.getOpts().JetStreamDomain,
+	}
+	s.publishAdvisory(nil, JSAdvisoryServerStorageError, adv)
+	return true
+}
+
+// recoverStreamStorage will have a stream that is read-only after a storage failure
+// accept new messages again, if its storage can be written to.
+// Returns the failure that was cleared, nil if the stream was not read-only.
+func (s *Server) recoverStreamStorage(mset *stream) (*StreamStorageFailure, error) {
+	failure := mset.storageFailure()
+	if failure == nil {
+		return nil, nil
+	}
+	if err := mset.clearStorageReadOnly(); err != nil {
+		return failure, err
+	}
+
+	accName, stream := mset.accName(), mset.name()
+	s.Noticef("JetStream stream '%s > %s' recovered from storage %s error", accName, stream, failure.Class)
+
+	// Make sure we report it should the storage fail again.
+	if js := s.getJetStream(); js != nil {
+		js.mu.Lock()
+		delete(js.serrs, fmt.Sprintf("%s > %s > %s", accName, stream, failure.Class))
+		js.mu.Unlock()
+	}
+
+	adv := &JSServerStorageRecoveredAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSServerStorageRecoveredAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Server:   s.Name(),
+		ServerID: s.ID(),
+		Account:  accName,
+		Stream:   stream,
+		Class:    failure.Class,
+		Since:    failure.Since,
+		Cluster:  s.cachedClusterName(),
+		Domain:   s.getOpts().JetStreamDomain,
+	}
+	s.publishAdvisory(nil, JSAdvisoryServerStorageRecovered, adv)
+	return failure, nil
+}
+
 // DisableJetStream will turn off JetStream and signals in clustered mode
 // to have the metacontroller remove us from the peer list.
 func (s *Server) DisableJetStream() error {
@@ -1139,6 +1313,11 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 
 	jsa := &jsAccount{js: js, account: a, limits: limits, streams: make(map[string]*stream), sendq: sendq, usage: make(map[string]*jsaStorage)}
 	jsa.storeDir = filepath.Join(js.config.StoreDir, a.Name)
+	if idir := a.indexDir(s.getOpts()); idir != _EMPTY_ {
+		jsa.indexDir = filepath.Join(idir, a.Name)
+	}
+	jsa.readAhead = newReadAheadBudget(a.jsReadAhead)
+	jsa.delivery = newJSDeliveryBudget(s.getOpts().JetStreamAccountIsolation.DeliveryMaxInflight)
 
 	// A single server does not need to do the account updates at this point.
 	if js.cluster != nil || !s.standAloneMode() {
@@ -1264,6 +1443,10 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 			go os.RemoveAll(mdir)
 			continue
 		}
+		// Finish a rename the server went down in the middle of.
+		if err := finishStreamRename(mdir); err != nil {
+			s.Warnf("  Error finishing rename of stream %q: %v", mdir, err)
+		}
 		key := sha256.Sum256([]byte(fi.Name()))
 		hh, err := highwayhash.New64(key[:])
 		if err != nil {
@@ -1406,71 +1589,17 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		consumers = append(consumers, &ce{mset, odir})
 	}
 
-	for _, e := range consumers {
-		ofis, _ := os.ReadDir(e.odir)
-		if len(ofis) > 0 {
-			s.Noticef("  Recovering %d consumers for stream - '%s > %s'", len(ofis), e.mset.accName(), e.mset.name())
-		}
-		for _, ofi := range ofis {
-			metafile := filepath.Join(e.odir, ofi.Name(), JetStreamMetaFile)
-			metasum := filepath.Join(e.odir, ofi.Name(), JetStreamMetaFileSum)
-			if _, err := os.Stat(metafile); os.IsNotExist(err) {
-				s.Warnf("    Missing consumer metafile %q", metafile)
-				continue
-			}
-			buf, err := os.ReadFile(metafile)
-			if err != nil {
-				s.Warnf("    Error reading consumer metafile %q: %v", metafile, err)
-				continue
-			}
-			if _, err := os.Stat(metasum); os.IsNotExist(err) {
-				s.Warnf("    Missing consumer checksum for %q", metasum)
-				continue
-			}
-
-			// Check if we are encrypted.
-			if key, err := os.ReadFile(filepath.Join(e.odir, ofi.Name(), JetStreamMetaFileKey)); err == nil {
-				s.Debugf("  Consumer metafile is encrypted, reading encrypted keyfile")
-				// Decode the buffer before proceeding.
-				ctxName := e.mset.name() + tsep + ofi.Name()
-				nbuf, _, err := s.decryptMeta(sc, key, buf, a.Name, ctxName)
-				if err != nil {
-					s.Warnf("  Error decrypting our consumer metafile: %v", err)
-					continue
-				}
-				buf = nbuf
-			}
+	// Remove what an atomic publish stored before the server went down in its middle.
+	jsa.recoverAtomicPublish()
 
-			var cfg FileConsumerInfo
-			if err := json.Unmarshal(buf, &cfg); err != nil {
-				s.Warnf("    Error unmarshalling consumer metafile %q: %v", metafile, err)
-				continue
-			}
-			isEphemeral := !isDurableConsumer(&cfg.ConsumerConfig)
-			if isEphemeral {
-				// This is an ephermal consumer and this could fail on restart until
-				// the consumer can reconnect. We will create it as a durable and switch it.
-				cfg.ConsumerConfig.Durable = ofi.Name()
-			}
-			obs, err := e.mset.addConsumerWithAssignment(&cfg.ConsumerConfig, _EMPTY_, nil, true, ActionCreateOrUpdate, false)
-			if err != nil {
-				s.Warnf("    Error adding consumer %q: %v", cfg.Name, err)
-				continue
-			}
-			if isEphemeral {
-				obs.switchToEphemeral()
-			}
-			if !cfg.Created.IsZero() {
-				obs.setCreatedTime(cfg.Created)
-			}
-			if err != nil {
-				s.Warnf("    Error restoring consumer %q state: %v", cfg.Name, err)
-			}
-		}
+	for _, e := range consumers {
+		s.recoverStreamConsumers(a, e.mset, e.odir)
 	}
 
 	// Make sure to cleanup any old remaining snapshots.
 	os.RemoveAll(filepath.Join(jsa.storeDir, snapsDir))
+	// As well as what memory streams spilled over to disk.
+	os.RemoveAll(filepath.Join(jsa.storeDir, spillDir))
 
 	// Check interest policy streams for auto cleanup.
 	for _, mset := range ipstreams {
@@ -1483,6 +1612,75 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 	return nil
 }
 
+// Recovers the consumers of a stream from their directories on disk.
+func (s *Server) recoverStreamConsumers(acc *Account, mset *stream, odir string) {
+	sc := s.getOpts().JetStreamCipher
+	ofis, _ := os.ReadDir(odir)
+	if len(ofis) > 0 {
+		s.Noticef("  Recovering %d consumers for stream - '%s > %s'", len(ofis), mset.accName(), mset.name())
+	}
+	// Shared consumers wait for the claims of all consumers to be known before delivering.
+	mset.claimsRecovering.Store(true)
+	defer mset.claimsRecovered()
+
+	for _, ofi := range ofis {
+		metafile := filepath.Join(odir, ofi.Name(), JetStreamMetaFile)
+		metasum := filepath.Join(odir, ofi.Name(), JetStreamMetaFileSum)
+		if _, err := os.Stat(metafile); os.IsNotExist(err) {
+			s.Warnf("    Missing consumer metafile %q", metafile)
+			continue
+		}
+		buf, err := os.ReadFile(metafile)
+		if err != nil {
+			s.Warnf("    Error reading consumer metafile %q: %v", metafile, err)
+			continue
+		}
+		if _, err := os.Stat(metasum); os.IsNotExist(err) {
+			s.Warnf("    Missing consumer checksum for %q", metasum)
+			continue
+		}
+
+		// Check if we are encrypted.
+		if key, err := os.ReadFile(filepath.Join(odir, ofi.Name(), JetStreamMetaFileKey)); err == nil {
+			s.Debugf("  Consumer metafile is encrypted, reading encrypted keyfile")
+			// Decode the buffer before proceeding.
+			ctxName := mset.name() + tsep + ofi.Name()
+			nbuf, _, err := s.decryptMeta(sc, key, buf, acc.Name, ctxName)
+			if err != nil {
+				s.Warnf("  Error decrypting our consumer metafile: %v", err)
+				continue
+			}
+			buf = nbuf
+		}
+
+		var cfg FileConsumerInfo
+		if err := json.Unmarshal(buf, &cfg); err != nil {
+			s.Warnf("    Error unmarshalling consumer metafile %q: %v", metafile, err)
+			continue
+		}
+		isEphemeral := !isDurableConsumer(&cfg.ConsumerConfig)
+		if isEphemeral {
+			// This is an ephermal consumer and this could fail on restart until
+			// the consumer can reconnect. We will create it as a durable and switch it.
+			cfg.ConsumerConfig.Durable = ofi.Name()
+		}
+		obs, err := mset.addConsumerWithAssignment(&cfg.ConsumerConfig, _EMPTY_, nil, true, ActionCreateOrUpdate, false)
+		if err != nil {
+			s.Warnf("    Error adding consumer %q: %v", cfg.Name, err)
+			continue
+		}
+		if isEphemeral {
+			obs.switchToEphemeral()
+		}
+		if !cfg.Created.IsZero() {
+			obs.setCreatedTime(cfg.Created)
+		}
+		if err != nil {
+			s.Warnf("    Error restoring consumer %q state: %v", cfg.Name, err)
+		}
+	}
+}
+
 // Return whether we require MaxBytes to be set and if > 0 an upper limit for stream size exists
 // Both limits are independent of each other.
 func (a *Account) maxBytesLimits(cfg *StreamConfig) (bool, int64) {
@@ -1503,7 +1701,7 @@ func (a *Account) maxBytesLimits(cfg *StreamConfig) (bool, int64) {
 		return false, 0
 	}
 	maxStreamBytes := int64(0)
-	if cfg.Storage == MemoryStorage {
+	if cfg.Storage.accounting() == MemoryStorage {
 		maxStreamBytes = selectedLimits.MemoryMaxStreamBytes
 	} else {
 		maxStreamBytes = selectedLimits.StoreMaxStreamBytes
@@ -1646,9 +1844,9 @@ func diffCheckedLimits(a, b map[string]JetStreamAccountLimits) map[string]JetStr
 // Lock should be held.
 func (jsa *jsAccount) reservedStorage(tier string) (mem, store uint64) {
 	for _, mset := range jsa.streams {
-		cfg := &mset.cfg
+		cfg := mset.storeConfig(&mset.cfg)
 		if tier == _EMPTY_ || tier == tierName(cfg.Replicas) && cfg.MaxBytes > 0 {
-			switch cfg.Storage {
+			switch cfg.Storage.accounting() {
 			case FileStorage:
 				store += uint64(cfg.MaxBytes)
 			case MemoryStorage:
@@ -1665,7 +1863,7 @@ func reservedStorage(sas map[string]*streamAssignment, tier string) (mem, store
 	for _, sa := range sas {
 		cfg := sa.Config
 		if tier == _EMPTY_ || tier == tierName(cfg.Replicas) && cfg.MaxBytes > 0 {
-			switch cfg.Storage {
+			switch cfg.Storage.accounting() {
 			case FileStorage:
 				store += uint64(cfg.MaxBytes)
 			case MemoryStorage:
@@ -2000,7 +2198,7 @@ func (jsa *jsAccount) checkAndSyncUsage(tierName string, storeType StorageType)
 
 	var needClusterUpdate bool
 	// If we do not match on our calculations compute delta and adjust.
-	if storeType == MemoryStorage {
+	if storeType.accounting() == MemoryStorage {
 		if total != usage.local.mem {
 			s.Warnf("MemStore usage drift of %v vs %v detected for account %q",
 				friendlyBytes(total), friendlyBytes(usage.local.mem), jsa.account.GetName())
@@ -2045,7 +2243,7 @@ func (jsa *jsAccount) updateUsage(tierName string, storeType StorageType, delta
 		s = &jsaStorage{}
 		jsa.usage[tierName] = s
 	}
-	if storeType == MemoryStorage {
+	if storeType.accounting() == MemoryStorage {
 		s.local.mem += delta
 		s.total.mem += delta
 		atomic.AddInt64(&js.memUsed, delta)
@@ -2147,7 +2345,7 @@ func (js *jetStream) wouldExceedLimits(storeType StorageType, sz int) bool {
 		total *int64
 		max   int64
 	)
-	if storeType == MemoryStorage {
+	if storeType.accounting() == MemoryStorage {
 		total, max = &js.memUsed, js.config.MaxMemory
 	} else {
 		total, max = &js.storeUsed, js.config.MaxStore
@@ -2245,7 +2443,7 @@ func (jsa *jsAccount) wouldExceedLimits(storeType StorageType, tierName string,
 	}
 
 	// Since tiers are flat we need to scale limit up by replicas when checking.
-	if storeType == MemoryStorage {
+	if storeType.accounting() == MemoryStorage {
 		totalMem := inUse.total.mem + (int64(memStoreMsgSize(subj, hdr, msg)) * r)
 		if selectedLimits.MemoryMaxStreamBytes > 0 && totalMem > selectedLimits.MemoryMaxStreamBytes*lr {
 			return true, nil
@@ -2298,7 +2496,7 @@ func (js *jetStream) checkBytesLimits(selectedLimits *JetStreamAccountLimits, ad
 	}
 	totalBytes := addBytes + maxBytesOffset
 
-	switch storage {
+	switch storage.accounting() {
 	case MemoryStorage:
 		// Account limits defined.
 		if selectedLimits.MaxMemory >= 0 && currentRes+totalBytes > selectedLimits.MaxMemory {
@@ -2468,7 +2666,7 @@ func (js *jetStream) reserveStreamResources(cfg *StreamConfig) {
 	}
 
 	js.mu.Lock()
-	switch cfg.Storage {
+	switch cfg.Storage.accounting() {
 	case MemoryStorage:
 		js.memReserved += cfg.MaxBytes
 	case FileStorage:
@@ -2489,7 +2687,7 @@ func (js *jetStream) releaseStreamResources(cfg *StreamConfig) {
 	}
 
 	js.mu.Lock()
-	switch cfg.Storage {
+	switch cfg.Storage.accounting() {
 	case MemoryStorage:
 		js.memReserved -= cfg.MaxBytes
 	case FileStorage:
@@ -2986,6 +3184,19 @@ func validateJetStreamOptions(o *Options) error {
 			return fmt.Errorf("invalid domain name: may not contain ., * or >")
 		}
 	}
+	// Streams reach remotes over leafnode connections, so each needs a leafnode remote.
+	for name, r := range o.JetStreamRemotes {
+		found := false
+		for _, rlo := range o.LeafNode.Remotes {
+			if rlo.LocalAccount == r.Account {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("jetstream remote %q requires a leafnode remote for account %q", name, r.Account)
+		}
+	}
 	// If not clustered no checks needed past here.
 	if !o.JetStream || o.Cluster.Port == 0 {
 		return nil
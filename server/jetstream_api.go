@@ -109,6 +109,79 @@ const (
 	JSApiStreamRestore  = "$JS.API.STREAM.RESTORE.*"
 	JSApiStreamRestoreT = "$JS.API.STREAM.RESTORE.%s"
 
+	// JSApiStreamStats is the endpoint to get the sampled statistics of a stream.
+	// Will return JSON response.
+	JSApiStreamStats  = "$JS.API.STREAM.STATS.*"
+	JSApiStreamStatsT = "$JS.API.STREAM.STATS.%s"
+
+	// JSApiStreamAssert is the endpoint to check assertions about the state of a stream.
+	// Will return JSON response.
+	JSApiStreamAssert  = "$JS.API.STREAM.ASSERT.*"
+	JSApiStreamAssertT = "$JS.API.STREAM.ASSERT.%s"
+
+	// JSApiStreamSearch is the endpoint to search a window of a stream for messages.
+	// Will return JSON response.
+	JSApiStreamSearch  = "$JS.API.STREAM.SEARCH.*"
+	JSApiStreamSearchT = "$JS.API.STREAM.SEARCH.%s"
+
+	// JSApiStreamRecover is the endpoint to have a stream that is read-only after
+	// a failure of its storage accept new messages again.
+	// Will return JSON response.
+	JSApiStreamRecover  = "$JS.API.STREAM.RECOVER.*"
+	JSApiStreamRecoverT = "$JS.API.STREAM.RECOVER.%s"
+
+	// JSApiStreamScrub is the endpoint to verify the messages of a stream against their
+	// checksums in the background, the results are sent as advisories.
+	// Will return JSON response.
+	JSApiStreamScrub  = "$JS.API.STREAM.SCRUB.*"
+	JSApiStreamScrubT = "$JS.API.STREAM.SCRUB.%s"
+
+	// JSApiStreamPause is the endpoint to pause a stream, so it does not accept new messages.
+	// Will return JSON response.
+	JSApiStreamPause  = "$JS.API.STREAM.PAUSE.*"
+	JSApiStreamPauseT = "$JS.API.STREAM.PAUSE.%s"
+
+	// JSApiStreamResume is the endpoint to resume a paused stream.
+	// Will return JSON response.
+	JSApiStreamResume  = "$JS.API.STREAM.RESUME.*"
+	JSApiStreamResumeT = "$JS.API.STREAM.RESUME.%s"
+
+	// JSApiStreamRename is the endpoint to rename a stream, keeping its messages and consumers.
+	// Will return JSON response.
+	JSApiStreamRename  = "$JS.API.STREAM.RENAME.*"
+	JSApiStreamRenameT = "$JS.API.STREAM.RENAME.%s"
+
+	// JSApiStreamTruncate is the endpoint to remove all messages after a sequence and reset the last sequence.
+	// Will return JSON response.
+	JSApiStreamTruncate  = "$JS.API.STREAM.TRUNCATE.*"
+	JSApiStreamTruncateT = "$JS.API.STREAM.TRUNCATE.%s"
+
+	// JSApiShardedStreamCreate is the endpoint to create the shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamCreate  = "$JS.API.STREAM.SHARDED.CREATE.*"
+	JSApiShardedStreamCreateT = "$JS.API.STREAM.SHARDED.CREATE.%s"
+
+	// JSApiShardedStreamInfo is the endpoint to get information on all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamInfo  = "$JS.API.STREAM.SHARDED.INFO.*"
+	JSApiShardedStreamInfoT = "$JS.API.STREAM.SHARDED.INFO.%s"
+
+	// JSApiShardedStreamPurge is the endpoint to purge all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamPurge  = "$JS.API.STREAM.SHARDED.PURGE.*"
+	JSApiShardedStreamPurgeT = "$JS.API.STREAM.SHARDED.PURGE.%s"
+
+	// JSApiShardedStreamDelete is the endpoint to delete all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamDelete  = "$JS.API.STREAM.SHARDED.DELETE.*"
+	JSApiShardedStreamDeleteT = "$JS.API.STREAM.SHARDED.DELETE.%s"
+
+	// JSApiStreamAtomicPublish is the endpoint to publish messages to one or more streams
+	// such that either all or none of them are stored. In clustered mode all messages
+	// need to be stored in the same stream.
+	// Will return JSON response.
+	JSApiStreamAtomicPublish = "$JS.API.STREAM.ATOMIC.PUBLISH"
+
 	// JSApiMsgDelete is the endpoint to delete messages from a stream.
 	// Will return JSON response.
 	JSApiMsgDelete  = "$JS.API.STREAM.MSG.DELETE.*"
@@ -133,6 +206,23 @@ const (
 	// jsDirectGetPre
 	jsDirectGetPre = "$JS.API.DIRECT.GET"
 
+	// JSReadReplicaMsgGet is the direct get equivalent served by the read replicas of a stream.
+	// These are answered by read replicas only, never by the stream's group.
+	JSReadReplicaMsgGet  = "$JS.API.READ.GET.*"
+	JSReadReplicaMsgGetT = "$JS.API.READ.GET.%s"
+
+	// JSReadReplicaGetLastBySubject is the get last by subject equivalent served by read replicas.
+	JSReadReplicaGetLastBySubject  = "$JS.API.READ.GET.*.>"
+	JSReadReplicaGetLastBySubjectT = "$JS.API.READ.GET.%s.%s"
+
+	// JSReadReplicaConsumerCreate is the endpoint to create consumers local to a read replica.
+	// These are always ephemeral push consumers and are not replicated.
+	JSReadReplicaConsumerCreate  = "$JS.API.READ.CONSUMER.CREATE.*"
+	JSReadReplicaConsumerCreateT = "$JS.API.READ.CONSUMER.CREATE.%s"
+
+	// jsReadReplicaPre
+	jsReadReplicaPre = "$JS.API.READ"
+
 	// JSApiConsumerCreate is the endpoint to create consumers for streams.
 	// This was also the legacy endpoint for ephemeral consumers.
 	// It now can take consumer name and optional filter subject, which when part of the subject controls access.
@@ -171,6 +261,26 @@ const (
 	JSApiConsumerPause  = "$JS.API.CONSUMER.PAUSE.*.*"
 	JSApiConsumerPauseT = "$JS.API.CONSUMER.PAUSE.%s.%s"
 
+	// JSApiShardedConsumerCreate is the endpoint to create a consumer on all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedConsumerCreate  = "$JS.API.CONSUMER.SHARDED.CREATE.*.*"
+	JSApiShardedConsumerCreateT = "$JS.API.CONSUMER.SHARDED.CREATE.%s.%s"
+
+	// JSApiShardedConsumerDelete is the endpoint to delete a consumer from all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedConsumerDelete  = "$JS.API.CONSUMER.SHARDED.DELETE.*.*"
+	JSApiShardedConsumerDeleteT = "$JS.API.CONSUMER.SHARDED.DELETE.%s.%s"
+
+	// JSApiConsumerExport is the endpoint to export the checkpoint of a durable consumer.
+	// Will return JSON response.
+	JSApiConsumerExport  = "$JS.API.CONSUMER.EXPORT.*.*"
+	JSApiConsumerExportT = "$JS.API.CONSUMER.EXPORT.%s.%s"
+
+	// JSApiConsumerImport is the endpoint to restore a durable consumer from a checkpoint.
+	// Will return JSON response.
+	JSApiConsumerImport  = "$JS.API.CONSUMER.IMPORT.*.*"
+	JSApiConsumerImportT = "$JS.API.CONSUMER.IMPORT.%s.%s"
+
 	// JSApiRequestNextT is the prefix for the request next message(s) for a consumer in worker/pull mode.
 	JSApiRequestNextT = "$JS.API.CONSUMER.MSG.NEXT.%s.%s"
 
@@ -196,6 +306,16 @@ const (
 	JSApiConsumerLeaderStepDown  = "$JS.API.CONSUMER.LEADER.STEPDOWN.*.*"
 	JSApiConsumerLeaderStepDownT = "$JS.API.CONSUMER.LEADER.STEPDOWN.%s.%s"
 
+	// JSApiStreamCompactWAL is the endpoint to have all replicas of a stream snapshot and compact their raft WAL.
+	// Will return JSON response.
+	JSApiStreamCompactWAL  = "$JS.API.STREAM.WAL.COMPACT.*"
+	JSApiStreamCompactWALT = "$JS.API.STREAM.WAL.COMPACT.%s"
+
+	// JSApiConsumerCompactWAL is the endpoint to have all replicas of a consumer snapshot and compact their raft WAL.
+	// Will return JSON response.
+	JSApiConsumerCompactWAL  = "$JS.API.CONSUMER.WAL.COMPACT.*.*"
+	JSApiConsumerCompactWALT = "$JS.API.CONSUMER.WAL.COMPACT.%s.%s"
+
 	// JSApiLeaderStepDown is the endpoint to have our metaleader stepdown.
 	// Only works from system account.
 	// Will return JSON response.
@@ -233,6 +353,12 @@ const (
 	jsAckPre    = "$JS.ACK."
 	jsAckPreLen = len(jsAckPre)
 
+	// jsAckProgressT is the subject for progress heartbeats of a consumer.
+	jsAckProgressT = "$JS.ACK.%s.%s.PROGRESS"
+
+	// jsReplayControlT is the subject to pause and resume the replay of a consumer.
+	jsReplayControlT = "$JS.REPLAY.%s.%s"
+
 	// jsFlowControl is for flow control subjects.
 	jsFlowControlPre = "$JS.FC."
 	// jsFlowControl is for FC responses.
@@ -247,6 +373,9 @@ const (
 	// JSMetricConsumerAckPre is a metric containing ack latency.
 	JSMetricConsumerAckPre = "$JS.EVENT.METRIC.CONSUMER.ACK"
 
+	// JSMetricConsumerSLAPre is a metric containing the periodic SLA report of a consumer.
+	JSMetricConsumerSLAPre = "$JS.EVENT.METRIC.CONSUMER.SLA"
+
 	// JSAdvisoryConsumerMaxDeliveryExceedPre is a notification published when a message exceeds its delivery threshold.
 	JSAdvisoryConsumerMaxDeliveryExceedPre = "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES"
 
@@ -274,18 +403,54 @@ const (
 	// JSAdvisoryConsumerPausePre notification that a consumer paused/unpaused.
 	JSAdvisoryConsumerPausePre = "$JS.EVENT.ADVISORY.CONSUMER.PAUSE"
 
+	// JSAdvisoryConsumerRecreatedPre notification that a protected consumer lost its state and was recreated.
+	JSAdvisoryConsumerRecreatedPre = "$JS.EVENT.ADVISORY.CONSUMER.RECREATED"
+
 	// JSAdvisoryStreamSnapshotCreatePre notification that a snapshot was created.
 	JSAdvisoryStreamSnapshotCreatePre = "$JS.EVENT.ADVISORY.STREAM.SNAPSHOT_CREATE"
 
 	// JSAdvisoryStreamSnapshotCompletePre notification that a snapshot was completed.
 	JSAdvisoryStreamSnapshotCompletePre = "$JS.EVENT.ADVISORY.STREAM.SNAPSHOT_COMPLETE"
 
+	// JSAdvisoryStreamMaxConsumersWarnPre notification that a stream reached its soft limit of consumers.
+	JSAdvisoryStreamMaxConsumersWarnPre = "$JS.EVENT.ADVISORY.STREAM.MAX_CONSUMERS_WARN"
+
 	// JSAdvisoryStreamRestoreCreatePre notification that a restore was start.
 	JSAdvisoryStreamRestoreCreatePre = "$JS.EVENT.ADVISORY.STREAM.RESTORE_CREATE"
 
 	// JSAdvisoryStreamRestoreCompletePre notification that a restore was completed.
 	JSAdvisoryStreamRestoreCompletePre = "$JS.EVENT.ADVISORY.STREAM.RESTORE_COMPLETE"
 
+	// JSAdvisoryStreamRestoreProgressPre notification of how far a restore has progressed.
+	JSAdvisoryStreamRestoreProgressPre = "$JS.EVENT.ADVISORY.STREAM.RESTORE_PROGRESS"
+
+	// JSAdvisoryStreamBackupPre notification that a scheduled backup succeeded or failed.
+	JSAdvisoryStreamBackupPre = "$JS.EVENT.ADVISORY.STREAM.BACKUP"
+
+	// JSAdvisoryStreamHotSubjectPre notification that a subject receives a disproportionate share of a stream's messages.
+	JSAdvisoryStreamHotSubjectPre = "$JS.EVENT.ADVISORY.STREAM.HOT_SUBJECT"
+
+	// JSAdvisoryStreamSourceGapPre notification that the origin of a mirror or source removed messages before they were ingested.
+	JSAdvisoryStreamSourceGapPre = "$JS.EVENT.ADVISORY.STREAM.SOURCE_GAP"
+
+	// JSAdvisoryStreamRetentionMigratedPre notification that an update changed the retention policy of a stream.
+	JSAdvisoryStreamRetentionMigratedPre = "$JS.EVENT.ADVISORY.STREAM.RETENTION_MIGRATED"
+
+	// JSAdvisoryStreamCompactedPre notification that the storage of a stream reclaimed the space of deleted messages.
+	JSAdvisoryStreamCompactedPre = "$JS.EVENT.ADVISORY.STREAM.COMPACTED"
+
+	// JSAdvisoryStreamScrubPre notification that a server verified the messages it stores for a stream.
+	JSAdvisoryStreamScrubPre = "$JS.EVENT.ADVISORY.STREAM.SCRUB"
+
+	// JSAdvisoryStreamQuotaWarningPre notification to the system account that a stream is nearing one of its limits.
+	JSAdvisoryStreamQuotaWarningPre = "$JS.EVENT.ADVISORY.STREAM.QUOTA_WARNING"
+
+	// JSAdvisoryStreamRepairPre notification that the storage of a stream was repaired when recovered.
+	JSAdvisoryStreamRepairPre = "$JS.EVENT.ADVISORY.STREAM.REPAIRED"
+
+	// JSAdvisoryStreamOversizedMsgsRemovedPre notification that the messages over a lowered max message size of a stream were removed.
+	JSAdvisoryStreamOversizedMsgsRemovedPre = "$JS.EVENT.ADVISORY.STREAM.OVERSIZED_MSGS_REMOVED"
+
 	// JSAdvisoryDomainLeaderElectedPre notification that a jetstream domain has elected a leader.
 	JSAdvisoryDomainLeaderElected = "$JS.EVENT.ADVISORY.DOMAIN.LEADER_ELECTED"
 
@@ -304,6 +469,12 @@ const (
 	// JSAdvisoryServerOutOfStorage notification that a server has no more storage.
 	JSAdvisoryServerOutOfStorage = "$JS.EVENT.ADVISORY.SERVER.OUT_OF_STORAGE"
 
+	// JSAdvisoryServerStorageError notification that a server hit a failure of its storage.
+	JSAdvisoryServerStorageError = "$JS.EVENT.ADVISORY.SERVER.STORAGE_ERROR"
+
+	// JSAdvisoryServerStorageRecovered notification that a stream recovered from a failure of its storage.
+	JSAdvisoryServerStorageRecovered = "$JS.EVENT.ADVISORY.SERVER.STORAGE_RECOVERED"
+
 	// JSAdvisoryServerRemoved notification that a server has been removed from the system.
 	JSAdvisoryServerRemoved = "$JS.EVENT.ADVISORY.SERVER.REMOVED"
 
@@ -401,6 +572,45 @@ type ApiPagedRequest struct {
 	Offset int `json:"offset"`
 }
 
+// ApiListFilter holds filters on the configuration of streams or consumers for list requests.
+type ApiListFilter struct {
+	// Description selects those whose description contains this text, ignoring case.
+	Description string `json:"description,omitempty"`
+	// Metadata selects those having all of these metadata keys, with the given value unless it is empty.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// matches returns true if the description and metadata pass the filter.
+func (lf *ApiListFilter) matches(description string, metadata map[string]string) bool {
+	if lf == nil {
+		return true
+	}
+	if lf.Description != _EMPTY_ && !strings.Contains(strings.ToLower(description), strings.ToLower(lf.Description)) {
+		return false
+	}
+	for k, v := range lf.Metadata {
+		if mv, ok := metadata[k]; !ok || (v != _EMPTY_ && mv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the consumer passes the filters of a list request.
+// Consumers without filter subjects match all subjects.
+func consumerMatchesListFilter(cfg *ConsumerConfig, subject string, lf *ApiListFilter) bool {
+	if cfg == nil {
+		return false
+	}
+	if subject != _EMPTY_ && (cfg.FilterSubject != _EMPTY_ || len(cfg.FilterSubjects) > 0) {
+		collides := func(f string) bool { return SubjectsCollide(subject, f) }
+		if !(cfg.FilterSubject != _EMPTY_ && collides(cfg.FilterSubject)) && !slices.ContainsFunc(cfg.FilterSubjects, collides) {
+			return false
+		}
+	}
+	return lf.matches(cfg.Description, cfg.Metadata)
+}
+
 // JSApiAccountInfoResponse reports back information on jetstream for this account.
 type JSApiAccountInfoResponse struct {
 	ApiResponse
@@ -433,6 +643,14 @@ type JSApiStreamInfoRequest struct {
 	ApiPagedRequest
 	DeletedDetails bool   `json:"deleted_details,omitempty"`
 	SubjectsFilter string `json:"subjects_filter,omitempty"`
+	// TokenStats asks for the statistics by placement token, if the stream has token placement.
+	TokenStats bool `json:"token_stats,omitempty"`
+	// DeletedRanges asks for the gaps of deleted messages as ranges.
+	DeletedRanges bool `json:"deleted_ranges,omitempty"`
+	// StorageStats asks for the statistics of the storage of the stream on the responding server.
+	StorageStats bool `json:"storage_stats,omitempty"`
+	// Partitions asks for the time partitions of a partitioned stream.
+	Partitions bool `json:"partitions,omitempty"`
 }
 
 type JSApiStreamInfoResponse struct {
@@ -452,6 +670,7 @@ type JSApiStreamNamesRequest struct {
 	ApiPagedRequest
 	// These are filters that can be applied to the list.
 	Subject string `json:"subject,omitempty"`
+	ApiListFilter
 }
 
 // JSApiStreamNamesResponse list of streams.
@@ -468,6 +687,7 @@ type JSApiStreamListRequest struct {
 	ApiPagedRequest
 	// These are filters that can be applied to the list.
 	Subject string `json:"subject,omitempty"`
+	ApiListFilter
 }
 
 // JSApiStreamListResponse list of detailed stream information.
@@ -553,6 +773,82 @@ type JSApiStreamRestoreRequest struct {
 	Config StreamConfig `json:"config"`
 	// Current State for the given stream.
 	State StreamState `json:"state"`
+	// Options for receiving the snapshot.
+	StreamRestoreOptions
+}
+
+// StreamRestoreOptions control how the snapshot of a restore is received.
+type StreamRestoreOptions struct {
+	// Size of the snapshot in bytes, if known. Used to report progress.
+	Size int64 `json:"size,omitempty"`
+	// RateLimit limits how fast the snapshot is received in bytes per second.
+	RateLimit int64 `json:"rate_limit,omitempty"`
+	// Resume continues an interrupted restore with the given id.
+	Resume string `json:"resume,omitempty"`
+	// VerifyOnly checks the snapshot and reports the result without creating the stream.
+	VerifyOnly bool `json:"verify_only,omitempty"`
+	// Ephemerals is how the ephemeral consumers of the snapshot are restored.
+	Ephemerals EphemeralRestorePolicy `json:"ephemerals,omitempty"`
+	// EphemeralsTTL is how long ephemerals restored as durables are kept once inactive.
+	// Defaults to an hour.
+	EphemeralsTTL time.Duration `json:"ephemerals_ttl,omitempty"`
+}
+
+// EphemeralRestorePolicy determines how the ephemeral consumers of a snapshot are restored.
+// By default they are restored as ephemerals under their own name, and are removed when no
+// client shows interest in them.
+type EphemeralRestorePolicy int
+
+const (
+	// RestoreEphemeralsAsEphemerals restores ephemerals under their own name.
+	RestoreEphemeralsAsEphemerals EphemeralRestorePolicy = iota
+	// RestoreEphemeralsAsDurables restores ephemerals as durables, removed once inactive for the TTL.
+	RestoreEphemeralsAsDurables
+	// DropEphemerals does not restore ephemerals.
+	DropEphemerals
+)
+
+// Default time ephemerals restored as durables are kept once inactive.
+const defaultRestoredEphemeralTTL = time.Hour
+
+func (ep EphemeralRestorePolicy) String() string {
+	switch ep {
+	case RestoreEphemeralsAsEphemerals:
+		return "Ephemeral"
+	case RestoreEphemeralsAsDurables:
+		return "Durable"
+	case DropEphemerals:
+		return "Drop"
+	default:
+		return "Unknown Ephemeral Restore Policy"
+	}
+}
+
+func (ep EphemeralRestorePolicy) MarshalJSON() ([]byte, error) {
+	switch ep {
+	case RestoreEphemeralsAsEphemerals:
+		return []byte(`"ephemeral"`), nil
+	case RestoreEphemeralsAsDurables:
+		return []byte(`"durable"`), nil
+	case DropEphemerals:
+		return []byte(`"drop"`), nil
+	default:
+		return nil, fmt.Errorf("can not marshal %v", ep)
+	}
+}
+
+func (ep *EphemeralRestorePolicy) UnmarshalJSON(data []byte) error {
+	switch strings.ToLower(string(data)) {
+	case `"ephemeral"`:
+		*ep = RestoreEphemeralsAsEphemerals
+	case `"durable"`:
+		*ep = RestoreEphemeralsAsDurables
+	case `"drop"`:
+		*ep = DropEphemerals
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
 }
 
 // JSApiStreamRestoreResponse is the direct response to the restore request.
@@ -560,10 +856,272 @@ type JSApiStreamRestoreResponse struct {
 	ApiResponse
 	// Subject to deliver the chunks to for the snapshot restore.
 	DeliverSubject string `json:"deliver_subject"`
+	// RestoreID can be used to resume the restore if the transfer gets interrupted.
+	RestoreID string `json:"restore_id,omitempty"`
+	// Offset into the snapshot the chunks should be sent from when resuming.
+	Offset int64 `json:"offset,omitempty"`
 }
 
 const JSApiStreamRestoreResponseType = "io.nats.jetstream.api.v1.stream_restore_response"
 
+// JSApiStreamRestoreVerifyResponse is the response once the snapshot of a verify only restore was received.
+type JSApiStreamRestoreVerifyResponse struct {
+	ApiResponse
+	Report *StreamSnapshotReport `json:"report,omitempty"`
+}
+
+const JSApiStreamRestoreVerifyResponseType = "io.nats.jetstream.api.v1.stream_restore_verify_response"
+
+// JSApiStreamStatsRequest selects the statistics samples of a stream.
+type JSApiStreamStatsRequest struct {
+	// Since only returns samples taken after this time.
+	Since time.Time `json:"since,omitempty"`
+}
+
+// JSApiStreamStatsResponse holds the statistics samples of a stream, oldest first.
+type JSApiStreamStatsResponse struct {
+	ApiResponse
+	Stream   string              `json:"stream,omitempty"`
+	Interval time.Duration       `json:"interval,omitempty"`
+	Samples  []StreamStatsSample `json:"samples,omitempty"`
+}
+
+const JSApiStreamStatsResponseType = "io.nats.jetstream.api.v1.stream_stats_response"
+
+// ShardedStreamInfo shows the shards of a sharded stream and their combined state.
+type ShardedStreamInfo struct {
+	Stream    string        `json:"stream"`
+	Msgs      uint64        `json:"messages"`
+	Bytes     uint64        `json:"bytes"`
+	Consumers int           `json:"consumer_count"`
+	Shards    []*StreamInfo `json:"shards"`
+}
+
+// JSApiShardedStreamCreateResponse holds the shards of a newly created sharded stream.
+type JSApiShardedStreamCreateResponse struct {
+	ApiResponse
+	*ShardedStreamInfo
+}
+
+const JSApiShardedStreamCreateResponseType = "io.nats.jetstream.api.v1.sharded_stream_create_response"
+
+// JSApiShardedStreamInfoResponse holds the shards of a sharded stream.
+type JSApiShardedStreamInfoResponse struct {
+	ApiResponse
+	*ShardedStreamInfo
+}
+
+const JSApiShardedStreamInfoResponseType = "io.nats.jetstream.api.v1.sharded_stream_info_response"
+
+// JSApiShardedStreamPurgeResponse holds the number of messages purged from all shards.
+type JSApiShardedStreamPurgeResponse struct {
+	ApiResponse
+	Success bool   `json:"success,omitempty"`
+	Purged  uint64 `json:"purged"`
+}
+
+const JSApiShardedStreamPurgeResponseType = "io.nats.jetstream.api.v1.sharded_stream_purge_response"
+
+type JSApiShardedStreamDeleteResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiShardedStreamDeleteResponseType = "io.nats.jetstream.api.v1.sharded_stream_delete_response"
+
+// JSApiShardedConsumerCreateResponse holds the consumer of each shard.
+type JSApiShardedConsumerCreateResponse struct {
+	ApiResponse
+	Stream string          `json:"stream_name,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Shards []*ConsumerInfo `json:"shards,omitempty"`
+}
+
+const JSApiShardedConsumerCreateResponseType = "io.nats.jetstream.api.v1.sharded_consumer_create_response"
+
+type JSApiShardedConsumerDeleteResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiShardedConsumerDeleteResponseType = "io.nats.jetstream.api.v1.sharded_consumer_delete_response"
+
+// JSApiStreamAssertRequest holds the assertions to check against the state of a stream.
+// All assertions that are set are checked against the same state.
+type JSApiStreamAssertRequest struct {
+	// FirstSeq asserts the first sequence of the stream.
+	FirstSeq *uint64 `json:"first_seq,omitempty"`
+	// LastSeq asserts the last sequence of the stream.
+	LastSeq *uint64 `json:"last_seq,omitempty"`
+	// MinMsgs asserts the stream holds at least this many messages.
+	MinMsgs *uint64 `json:"min_msgs,omitempty"`
+	// MaxMsgs asserts the stream holds at most this many messages.
+	MaxMsgs *uint64 `json:"max_msgs,omitempty"`
+	// LastBySubject asserts the digest of the data of the last message on subjects.
+	LastBySubject []StreamSubjectAssertion `json:"last_by_subject,omitempty"`
+}
+
+// StreamSubjectAssertion asserts the digest of the data of the last message on a subject.
+// An empty digest asserts there is no message on the subject.
+type StreamSubjectAssertion struct {
+	Subject string `json:"subject"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// StreamAssertionResult is the outcome of a single assertion.
+type StreamAssertionResult struct {
+	Assertion string `json:"assertion"`
+	Subject   string `json:"subject,omitempty"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+// JSApiStreamAssertResponse holds the outcome of the assertions about a stream.
+type JSApiStreamAssertResponse struct {
+	ApiResponse
+	Passed  bool                    `json:"passed"`
+	Results []StreamAssertionResult `json:"results,omitempty"`
+	// LastSeq is the last sequence of the stream the assertions were checked against.
+	LastSeq uint64 `json:"last_seq"`
+}
+
+const JSApiStreamAssertResponseType = "io.nats.jetstream.api.v1.stream_assert_response"
+
+// JSApiStreamSearchRequest searches a window of a stream for messages with matching
+// headers or payloads. All criteria that are set have to match. The scan is bounded,
+// when a limit is reached the response tells where to continue.
+type JSApiStreamSearchRequest struct {
+	// StartSeq is the first sequence of the window, or StartTime its first time.
+	StartSeq  uint64     `json:"start_seq,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	// EndSeq is the last sequence of the window, or EndTime its last time.
+	EndSeq  uint64     `json:"end_seq,omitempty"`
+	EndTime *time.Time `json:"end_time,omitempty"`
+	// Subject only scans the messages on matching subjects.
+	Subject string `json:"subject,omitempty"`
+	// Headers matches messages that have all of these headers with these values.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Contains matches messages whose payload contains this byte pattern.
+	Contains string `json:"contains,omitempty"`
+	// MaxBytes limits the bytes scanned, it can not exceed the server limit.
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// MaxMatches limits the matches returned, it can not exceed the server limit.
+	MaxMatches int `json:"max_matches,omitempty"`
+}
+
+// StreamSearchMatch is a message that matched a search.
+type StreamSearchMatch struct {
+	Sequence uint64    `json:"seq"`
+	Subject  string    `json:"subject"`
+	Time     time.Time `json:"time"`
+}
+
+// JSApiStreamSearchResponse holds the messages that matched a search.
+type JSApiStreamSearchResponse struct {
+	ApiResponse
+	Matches []StreamSearchMatch `json:"matches,omitempty"`
+	// Scanned is the number of messages scanned, ScannedBytes their size.
+	Scanned      uint64 `json:"scanned"`
+	ScannedBytes uint64 `json:"scanned_bytes"`
+	// NextSeq is where to continue when a limit was reached before the end of the window.
+	NextSeq uint64 `json:"next_seq,omitempty"`
+}
+
+const JSApiStreamSearchResponseType = "io.nats.jetstream.api.v1.stream_search_response"
+
+// JSApiCompactWALResponse is the response to compacting the raft WAL of a stream or consumer.
+// Entries and Bytes are the size of the WAL of the leader after the compaction.
+type JSApiCompactWALResponse struct {
+	ApiResponse
+	Entries uint64 `json:"entries"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+const JSApiStreamCompactWALResponseType = "io.nats.jetstream.api.v1.stream_wal_compact_response"
+const JSApiConsumerCompactWALResponseType = "io.nats.jetstream.api.v1.consumer_wal_compact_response"
+
+// JSApiStreamPauseResponse is the response to pausing or resuming a stream.
+type JSApiStreamPauseResponse struct {
+	ApiResponse
+	Paused         bool          `json:"paused"`
+	Pause          *StreamPause  `json:"pause,omitempty"`
+	PauseRemaining time.Duration `json:"pause_remaining,omitempty"`
+}
+
+const JSApiStreamPauseResponseType = "io.nats.jetstream.api.v1.stream_pause_response"
+
+// JSApiStreamRenameRequest is the request to rename a stream.
+type JSApiStreamRenameRequest struct {
+	// Name is the new name of the stream.
+	Name string `json:"name"`
+}
+
+// JSApiStreamRenameResponse is the response to renaming a stream.
+type JSApiStreamRenameResponse struct {
+	ApiResponse
+	Name    string `json:"name,omitempty"`
+	Success bool   `json:"success,omitempty"`
+}
+
+const JSApiStreamRenameResponseType = "io.nats.jetstream.api.v1.stream_rename_response"
+
+// JSApiStreamTruncateRequest is the request to truncate a stream.
+type JSApiStreamTruncateRequest struct {
+	// Sequence is the last sequence to keep, all messages after it are removed.
+	Sequence uint64 `json:"seq"`
+}
+
+// JSApiStreamTruncateResponse is the response to truncating a stream.
+type JSApiStreamTruncateResponse struct {
+	ApiResponse
+	Success bool   `json:"success,omitempty"`
+	Removed uint64 `json:"removed"`
+}
+
+const JSApiStreamTruncateResponseType = "io.nats.jetstream.api.v1.stream_truncate_response"
+
+// JSApiStreamRecoverResponse is the response to recovering a stream after a storage failure.
+type JSApiStreamRecoverResponse struct {
+	ApiResponse
+	// Recovered is true if the stream was read-only and accepts new messages again.
+	Recovered bool `json:"recovered"`
+	// Failure is the storage failure the stream recovered from.
+	Failure *StreamStorageFailure `json:"failure,omitempty"`
+}
+
+const JSApiStreamRecoverResponseType = "io.nats.jetstream.api.v1.stream_recover_response"
+
+// JSApiStreamScrubResponse is the response to starting to verify the messages of a stream.
+type JSApiStreamScrubResponse struct {
+	ApiResponse
+	// Started is true if verifying the messages started, the results are sent as advisories.
+	Started bool `json:"started"`
+}
+
+const JSApiStreamScrubResponseType = "io.nats.jetstream.api.v1.stream_scrub_response"
+
+// JSApiStreamAtomicPublishRequest holds the messages to store atomically.
+// Each message is stored in the stream that listens on its subject.
+type JSApiStreamAtomicPublishRequest struct {
+	Messages []*AtomicMsg `json:"messages"`
+}
+
+// AtomicMsg is a single message of an atomic publish.
+type AtomicMsg struct {
+	Subject string `json:"subject"`
+	Header  []byte `json:"hdrs,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+// JSApiStreamAtomicPublishResponse holds the acks for all messages, in request order.
+type JSApiStreamAtomicPublishResponse struct {
+	ApiResponse
+	Acks []*PubAck `json:"acks,omitempty"`
+}
+
+const JSApiStreamAtomicPublishResponseType = "io.nats.jetstream.api.v1.stream_atomic_publish_response"
+
 // JSApiStreamRemovePeerRequest is the required remove peer request.
 type JSApiStreamRemovePeerRequest struct {
 	// Server name of the peer to be removed.
@@ -685,6 +1243,11 @@ type JSApiConsumerCreateResponse struct {
 
 const JSApiConsumerCreateResponseType = "io.nats.jetstream.api.v1.consumer_create_response"
 
+// JSApiConsumerDeleteRequest is optional, Force is required to delete protected consumers.
+type JSApiConsumerDeleteRequest struct {
+	Force bool `json:"force,omitempty"`
+}
+
 type JSApiConsumerDeleteResponse struct {
 	ApiResponse
 	Success bool `json:"success,omitempty"`
@@ -705,6 +1268,27 @@ type JSApiConsumerPauseResponse struct {
 	PauseRemaining time.Duration `json:"pause_remaining,omitempty"`
 }
 
+// JSApiConsumerExportResponse holds the checkpoint of a durable consumer.
+type JSApiConsumerExportResponse struct {
+	ApiResponse
+	Checkpoint *ConsumerCheckpoint `json:"checkpoint,omitempty"`
+}
+
+const JSApiConsumerExportResponseType = "io.nats.jetstream.api.v1.consumer_export_response"
+
+// JSApiConsumerImportRequest restores a durable consumer from a checkpoint.
+type JSApiConsumerImportRequest struct {
+	Checkpoint *ConsumerCheckpoint `json:"checkpoint"`
+}
+
+// JSApiConsumerImportResponse holds the checkpoint a durable consumer was restored from.
+type JSApiConsumerImportResponse struct {
+	ApiResponse
+	Checkpoint *ConsumerCheckpoint `json:"checkpoint,omitempty"`
+}
+
+const JSApiConsumerImportResponseType = "io.nats.jetstream.api.v1.consumer_import_response"
+
 type JSApiConsumerInfoResponse struct {
 	ApiResponse
 	*ConsumerInfo
@@ -714,6 +1298,10 @@ const JSApiConsumerInfoResponseType = "io.nats.jetstream.api.v1.consumer_info_re
 
 type JSApiConsumersRequest struct {
 	ApiPagedRequest
+	// These are filters that can be applied to the list.
+	// Subject selects consumers with a filter subject that overlaps with it.
+	Subject string `json:"subject,omitempty"`
+	ApiListFilter
 }
 
 type JSApiConsumerNamesResponse struct {
@@ -789,6 +1377,9 @@ type jsAPIRoutedReq struct {
 	reply   string
 	msg     []byte
 	pa      pubArg
+	// Set when queued, the account the request is made for and when.
+	account string
+	queued  time.Time
 }
 
 func (js *jetStream) apiDispatch(sub *subscription, c *client, acc *Account, subject, reply string, rmsg []byte) {
@@ -869,11 +1460,18 @@ func (js *jetStream) apiDispatch(sub *subscription, c *client, acc *Account, sub
 	// Copy the state. Note the JSAPI only uses the hdr index to piece apart the
 	// header from the msg body. No other references are needed.
 	// Check pending and warn if getting backed up.
-	pending, _ := s.jsAPIRoutedReqs.push(&jsAPIRoutedReq{jsub, sub, acc, subject, reply, copyBytes(rmsg), c.pa})
+	// Requests are queued per account, so one account can not starve the others.
+	account := jsAPIRequestAccount(acc, hdr)
+	pending, ok := s.jsAPIRoutedReqs.push(account, &jsAPIRoutedReq{jsub: jsub, sub: sub, acc: acc, subject: subject, reply: reply, msg: copyBytes(rmsg), pa: c.pa})
+	if !ok {
+		atomic.AddInt64(&js.apiInflight, -1)
+		s.rateLimitFormatWarnf("JetStream API queue limit reached for account %q, dropping request", account)
+		return
+	}
 	limit := atomic.LoadInt64(&js.queueLimit)
 	if pending >= int(limit) {
 		s.rateLimitFormatWarnf("JetStream API queue limit reached, dropping %d requests", pending)
-		s.jsAPIRoutedReqs.drain()
+		atomic.AddInt64(&js.apiInflight, -int64(s.jsAPIRoutedReqs.drain()))
 
 		s.publishAdvisory(nil, JSAdvisoryAPILimitReached, JSAPILimitReachedAdvisory{
 			TypedEvent: TypedEvent{
@@ -901,17 +1499,16 @@ func (s *Server) processJSAPIRoutedRequests() {
 	for {
 		select {
 		case <-queue.ch:
-			reqs := queue.pop()
-			for _, r := range reqs {
+			for r := queue.pop(); r != nil; r = queue.pop() {
 				client.pa = r.pa
 				start := time.Now()
 				r.jsub.icb(r.sub, client, r.acc, r.subject, r.reply, r.msg)
 				if dur := time.Since(start); dur >= readLoopReportThreshold {
 					s.Warnf("Internal subscription on %q took too long: %v", r.subject, dur)
 				}
+				queue.done(r)
 				atomic.AddInt64(&js.apiInflight, -1)
 			}
-			queue.recycle(&reqs)
 		case <-s.quitCh:
 			return
 		}
@@ -932,7 +1529,8 @@ func (s *Server) setJetStreamExportSubs() error {
 	if mp > maxProcs {
 		mp = maxProcs
 	}
-	s.jsAPIRoutedReqs = newIPQueue[*jsAPIRoutedReq](s, "Routed JS API Requests")
+	s.jsAPIRoutedReqs = newJSAPIQueue(s.getOpts().JetStreamAccountIsolation)
+	s.ipQueues.Store("Routed JS API Requests", s.jsAPIRoutedReqs)
 	for i := 0; i < mp; i++ {
 		s.startGoRoutine(s.processJSAPIRoutedRequests)
 	}
@@ -966,9 +1564,25 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiStreamPurge, s.jsStreamPurgeRequest},
 		{JSApiStreamSnapshot, s.jsStreamSnapshotRequest},
 		{JSApiStreamRestore, s.jsStreamRestoreRequest},
+		{JSApiStreamStats, s.jsStreamStatsRequest},
+		{JSApiStreamAssert, s.jsStreamAssertRequest},
+		{JSApiStreamSearch, s.jsStreamSearchRequest},
+		{JSApiStreamRecover, s.jsStreamRecoverRequest},
+		{JSApiStreamScrub, s.jsStreamScrubRequest},
+		{JSApiStreamPause, s.jsStreamPauseRequest},
+		{JSApiStreamResume, s.jsStreamResumeRequest},
+		{JSApiStreamRename, s.jsStreamRenameRequest},
+		{JSApiStreamTruncate, s.jsStreamTruncateRequest},
+		{JSApiShardedStreamCreate, s.jsShardedStreamCreateRequest},
+		{JSApiShardedStreamInfo, s.jsShardedStreamInfoRequest},
+		{JSApiShardedStreamPurge, s.jsShardedStreamPurgeRequest},
+		{JSApiShardedStreamDelete, s.jsShardedStreamDeleteRequest},
+		{JSApiStreamAtomicPublish, s.jsStreamAtomicPublishRequest},
 		{JSApiStreamRemovePeer, s.jsStreamRemovePeerRequest},
 		{JSApiStreamLeaderStepDown, s.jsStreamLeaderStepDownRequest},
 		{JSApiConsumerLeaderStepDown, s.jsConsumerLeaderStepDownRequest},
+		{JSApiStreamCompactWAL, s.jsStreamCompactWALRequest},
+		{JSApiConsumerCompactWAL, s.jsConsumerCompactWALRequest},
 		{JSApiMsgDelete, s.jsMsgDeleteRequest},
 		{JSApiMsgGet, s.jsMsgGetRequest},
 		{JSApiConsumerCreateEx, s.jsConsumerCreateRequest},
@@ -979,6 +1593,10 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiConsumerInfo, s.jsConsumerInfoRequest},
 		{JSApiConsumerDelete, s.jsConsumerDeleteRequest},
 		{JSApiConsumerPause, s.jsConsumerPauseRequest},
+		{JSApiShardedConsumerCreate, s.jsShardedConsumerCreateRequest},
+		{JSApiShardedConsumerDelete, s.jsShardedConsumerDeleteRequest},
+		{JSApiConsumerExport, s.jsConsumerExportRequest},
+		{JSApiConsumerImport, s.jsConsumerImportRequest},
 	}
 
 	js.mu.Lock()
@@ -997,7 +1615,7 @@ func (s *Server) setJetStreamExportSubs() error {
 func (s *Server) sendAPIResponse(ci *ClientInfo, acc *Account, subject, reply, request, response string) {
 	acc.trackAPI()
 	if reply != _EMPTY_ {
-		s.sendInternalAccountMsg(nil, reply, response)
+		s.sendAPIReply(ci, reply, response)
 	}
 	s.sendJetStreamAPIAuditAdvisory(ci, acc, subject, request, response)
 }
@@ -1005,7 +1623,7 @@ func (s *Server) sendAPIResponse(ci *ClientInfo, acc *Account, subject, reply, r
 func (s *Server) sendAPIErrResponse(ci *ClientInfo, acc *Account, subject, reply, request, response string) {
 	acc.trackAPIErr()
 	if reply != _EMPTY_ {
-		s.sendInternalAccountMsg(nil, reply, response)
+		s.sendAPIReply(ci, reply, response)
 	}
 	s.sendJetStreamAPIAuditAdvisory(ci, acc, subject, request, response)
 }
@@ -1147,6 +1765,11 @@ func (s *Server) getRequestInfo(c *client, raw []byte) (pci *ClientInfo, acc *Ac
 		}
 	}
 
+	// Requests forwarded within the cluster carry the chunk size in the client info.
+	if v := getHeader(JSResponseChunked, hdr); v != nil {
+		ci.ResponseChunk = s.jsApiResponseChunkSize(v)
+	}
+
 	if ci.Service != _EMPTY_ {
 		acc, _ = s.LookupAccount(ci.Service)
 	} else if ci.Account != _EMPTY_ {
@@ -1576,6 +2199,49 @@ func (s *Server) jsStreamCreateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	// A retry of a create that was applied already gets the current stream.
+	if cfg.Token != _EMPTY_ {
+		if mset, err := acc.lookupStream(streamName); err == nil && mset.hasToken(cfg.Token) {
+			msetCfg := mset.config()
+			resp.StreamInfo = &StreamInfo{
+				Created:        mset.createdTime(),
+				State:          mset.state(),
+				Config:         *setDynamicStreamMetadata(&msetCfg),
+				TimeStamp:      time.Now().UTC(),
+				Mirror:         mset.mirrorInfo(),
+				Sources:        mset.sourcesInfo(),
+				PushMirrors:    mset.pushMirrorsInfo(),
+				Rejections:     mset.rejections(),
+				StorageFailure: mset.storageFailure(),
+				Durability:     mset.durability(),
+				Spilled:        mset.isSpilled(),
+				Repair:         mset.storeRepair(),
+				Blocks:         mset.blocks(),
+			}
+			resp.DidCreate = true
+			s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+			return
+		}
+	}
+
+	// No new streams while in maintenance.
+	if s.JetStreamInMaintenance() {
+		if _, err := acc.lookupStream(streamName); err != nil {
+			resp.Error = NewJSMaintenanceModeError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	// No new streams while the account is frozen.
+	if acc.JetStreamFrozen() {
+		if _, err := acc.lookupStream(streamName); err != nil {
+			resp.Error = NewJSAccountFrozenError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
 	if err := acc.jsNonClusteredStreamLimitsCheck(&cfg.StreamConfig); err != nil {
 		resp.Error = err
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
@@ -1592,14 +2258,22 @@ func (s *Server) jsStreamCreateRequest(sub *subscription, c *client, _ *Account,
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	mset.addToken(cfg.Token)
 	msetCfg := mset.config()
 	resp.StreamInfo = &StreamInfo{
-		Created:   mset.createdTime(),
-		State:     mset.state(),
-		Config:    *setDynamicStreamMetadata(&msetCfg),
-		TimeStamp: time.Now().UTC(),
-		Mirror:    mset.mirrorInfo(),
-		Sources:   mset.sourcesInfo(),
+		Created:        mset.createdTime(),
+		State:          mset.state(),
+		Config:         *setDynamicStreamMetadata(&msetCfg),
+		TimeStamp:      time.Now().UTC(),
+		Mirror:         mset.mirrorInfo(),
+		Sources:        mset.sourcesInfo(),
+		PushMirrors:    mset.pushMirrorsInfo(),
+		Rejections:     mset.rejections(),
+		StorageFailure: mset.storageFailure(),
+		Durability:     mset.durability(),
+		Spilled:        mset.isSpilled(),
+		Repair:         mset.storeRepair(),
+		Blocks:         mset.blocks(),
 	}
 	resp.DidCreate = true
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
@@ -1664,40 +2338,61 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	// Handle clustered version here.
-	if s.JetStreamIsClustered() {
-		// Always do in separate Go routine.
-		go s.jsClusteredStreamUpdateRequest(ci, acc, subject, reply, copyBytes(rmsg), &cfg, nil, ncfg.Pedantic)
-		return
-	}
+	// Removing subjects may need to be approved by a lifecycle hook first.
+	msg, rmsg = copyBytes(msg), copyBytes(rmsg)
+	s.approveStreamOp(ci, acc, streamName, streamHookUpdate, msg, &cfg, func() {
+		// Handle clustered version here.
+		if s.JetStreamIsClustered() {
+			// Always do in separate Go routine.
+			go s.jsClusteredStreamUpdateRequest(ci, acc, subject, reply, copyBytes(rmsg), &cfg, nil, ncfg.Pedantic, ncfg.Token)
+			return
+		}
 
-	mset, err := acc.lookupStream(streamName)
-	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
+		mset, err := acc.lookupStream(streamName)
+		if err != nil {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
 
-	// Update asset version metadata.
-	setStaticStreamMetadata(&cfg, &mset.cfg)
+		// The pause is only changed through the pause and resume API.
+		cfg.Pause = mset.config().Pause
 
-	if err := mset.updatePedantic(&cfg, ncfg.Pedantic); err != nil {
-		resp.Error = NewJSStreamUpdateError(err, Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
+		// Update asset version metadata.
+		setStaticStreamMetadata(&cfg, &mset.cfg)
 
-	msetCfg := mset.config()
-	resp.StreamInfo = &StreamInfo{
-		Created:   mset.createdTime(),
-		State:     mset.state(),
-		Config:    *setDynamicStreamMetadata(&msetCfg),
-		Domain:    s.getOpts().JetStreamDomain,
-		Mirror:    mset.mirrorInfo(),
-		Sources:   mset.sourcesInfo(),
-		TimeStamp: time.Now().UTC(),
-	}
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+		// A retry of an update that was applied already is not applied again.
+		if ncfg.Token == _EMPTY_ || !mset.hasToken(ncfg.Token) {
+			if err := mset.updatePedantic(&cfg, ncfg.Pedantic); err != nil {
+				resp.Error = NewJSStreamUpdateError(err, Unless(err))
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+			mset.addToken(ncfg.Token)
+		}
+
+		msetCfg := mset.config()
+		resp.StreamInfo = &StreamInfo{
+			Created:        mset.createdTime(),
+			State:          mset.state(),
+			Config:         *setDynamicStreamMetadata(&msetCfg),
+			Domain:         s.getOpts().JetStreamDomain,
+			Mirror:         mset.mirrorInfo(),
+			Sources:        mset.sourcesInfo(),
+			PushMirrors:    mset.pushMirrorsInfo(),
+			Rejections:     mset.rejections(),
+			StorageFailure: mset.storageFailure(),
+			Durability:     mset.durability(),
+			Spilled:        mset.isSpilled(),
+			Repair:         mset.storeRepair(),
+			Blocks:         mset.blocks(),
+			TimeStamp:      time.Now().UTC(),
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	}, func(err *ApiError) {
+		resp.Error = err
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
 }
 
 // Request for the list of all stream names.
@@ -1740,6 +2435,7 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 
 	var offset int
 	var filter string
+	var lf *ApiListFilter
 
 	if isJSONObjectOrArray(msg) {
 		var req JSApiStreamNamesRequest
@@ -1752,6 +2448,7 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 		if req.Subject != _EMPTY_ {
 			filter = req.Subject
 		}
+		lf = &req.ApiListFilter
 	}
 
 	// TODO(dlc) - Maybe hold these results for large results that we expect to be paged.
@@ -1768,6 +2465,9 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 			if IsNatsErr(sa.err, JSClusterNotAssignedErr) {
 				continue
 			}
+			if sa.Config == nil || !lf.matches(sa.Config.Description, sa.Config.Metadata) {
+				continue
+			}
 			if filter != _EMPTY_ {
 				// These could not have subjects auto-filled in since they are raw and unprocessed.
 				if len(sa.Config.Subjects) == 0 {
@@ -1802,6 +2502,10 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 		}
 	} else {
 		msets := acc.filteredStreams(filter)
+		msets = slices.DeleteFunc(msets, func(mset *stream) bool {
+			cfg := mset.config()
+			return !lf.matches(cfg.Description, cfg.Metadata)
+		})
 		// Since we page results order matters.
 		if len(msets) > 1 {
 			slices.SortFunc(msets, func(i, j *stream) int { return cmp.Compare(i.cfg.Name, j.cfg.Name) })
@@ -1870,6 +2574,7 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 
 	var offset int
 	var filter string
+	var lf *ApiListFilter
 
 	if isJSONObjectOrArray(msg) {
 		var req JSApiStreamListRequest
@@ -1882,13 +2587,14 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 		if req.Subject != _EMPTY_ {
 			filter = req.Subject
 		}
+		lf = &req.ApiListFilter
 	}
 
 	// Clustered mode will invoke a scatter and gather.
 	if s.JetStreamIsClustered() {
 		// Need to copy these off before sending.. don't move this inside startGoRoutine!!!
 		msg = copyBytes(msg)
-		s.startGoRoutine(func() { s.jsClusteredStreamListRequest(acc, ci, filter, offset, subject, reply, msg) })
+		s.startGoRoutine(func() { s.jsClusteredStreamListRequest(acc, ci, filter, lf, offset, subject, reply, msg) })
 		return
 	}
 
@@ -1900,6 +2606,10 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 	} else {
 		msets = acc.filteredStreams(filter)
 	}
+	msets = slices.DeleteFunc(msets, func(mset *stream) bool {
+		cfg := mset.config()
+		return !lf.matches(cfg.Description, cfg.Metadata)
+	})
 
 	slices.SortFunc(msets, func(i, j *stream) int { return cmp.Compare(i.cfg.Name, j.cfg.Name) })
 
@@ -1911,13 +2621,20 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 	for _, mset := range msets[offset:] {
 		config := mset.config()
 		resp.Streams = append(resp.Streams, &StreamInfo{
-			Created:   mset.createdTime(),
-			State:     mset.state(),
-			Config:    config,
-			Domain:    s.getOpts().JetStreamDomain,
-			Mirror:    mset.mirrorInfo(),
-			Sources:   mset.sourcesInfo(),
-			TimeStamp: time.Now().UTC(),
+			Created:        mset.createdTime(),
+			State:          mset.state(),
+			Config:         config,
+			Domain:         s.getOpts().JetStreamDomain,
+			Mirror:         mset.mirrorInfo(),
+			Sources:        mset.sourcesInfo(),
+			PushMirrors:    mset.pushMirrorsInfo(),
+			Rejections:     mset.rejections(),
+			StorageFailure: mset.storageFailure(),
+			Durability:     mset.durability(),
+			Spilled:        mset.isSpilled(),
+			Repair:         mset.storeRepair(),
+			Blocks:         mset.blocks(),
+			TimeStamp:      time.Now().UTC(),
 		})
 		if len(resp.Streams) >= JSApiListLimit {
 			break
@@ -2038,100 +2755,300 @@ func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, s
 		return
 	}
 
-	var details bool
-	var subjects string
-	var offset int
-	if isJSONObjectOrArray(msg) {
-		var req JSApiStreamInfoRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			resp.Error = NewJSInvalidJSONError(err)
+	var details, tokenStats, ranges, storageStats, partitions bool
+	var subjects string
+	var offset int
+	if isJSONObjectOrArray(msg) {
+		var req JSApiStreamInfoRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		details, subjects = req.DeletedDetails, req.SubjectsFilter
+		offset, tokenStats, ranges = req.Offset, req.TokenStats, req.DeletedRanges
+		storageStats, partitions = req.StorageStats, req.Partitions
+	}
+
+	mset, err := acc.lookupStream(streamName)
+	// Error is not to be expected at this point, but could happen if same stream trying to be created.
+	if err != nil {
+		if cc != nil {
+			// This could be inflight, pause for a short bit and try again.
+			// This will not be inline, so ok.
+			time.Sleep(10 * time.Millisecond)
+			mset, err = acc.lookupStream(streamName)
+		}
+		// Check again.
+		if err != nil {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	config := mset.config()
+	resp.StreamInfo = &StreamInfo{
+		Created:        mset.createdTime(),
+		State:          mset.stateWithDetail(details),
+		Config:         *setDynamicStreamMetadata(&config),
+		Domain:         s.getOpts().JetStreamDomain,
+		Cluster:        js.clusterInfo(mset.raftGroup()),
+		Mirror:         mset.mirrorInfo(),
+		Sources:        mset.sourcesInfo(),
+		PushMirrors:    mset.pushMirrorsInfo(),
+		Rejections:     mset.rejections(),
+		StorageFailure: mset.storageFailure(),
+		Durability:     mset.durability(),
+		Spilled:        mset.isSpilled(),
+		Repair:         mset.storeRepair(),
+		Blocks:         mset.blocks(),
+		Alternates:     js.streamAlternates(ci, config.Name),
+		TimeStamp:      time.Now().UTC(),
+	}
+	if clusterWideConsCount > 0 {
+		resp.StreamInfo.State.Consumers = clusterWideConsCount
+	}
+
+	// Check if they have asked for subject details.
+	if subjects != _EMPTY_ {
+		st := mset.store.SubjectsTotals(subjects)
+		if lst := len(st); lst > 0 {
+			// Common for both cases.
+			resp.Offset = offset
+			resp.Limit = JSMaxSubjectDetails
+			resp.Total = lst
+
+			if offset == 0 && lst <= JSMaxSubjectDetails {
+				resp.StreamInfo.State.Subjects = st
+			} else {
+				// Here we have to filter list due to offset or maximum constraints.
+				subjs := make([]string, 0, len(st))
+				for subj := range st {
+					subjs = append(subjs, subj)
+				}
+				// Sort it
+				slices.Sort(subjs)
+
+				if offset > len(subjs) {
+					offset = len(subjs)
+				}
+
+				end := offset + JSMaxSubjectDetails
+				if end > len(subjs) {
+					end = len(subjs)
+				}
+				actualSize := end - offset
+				var sd map[string]uint64
+
+				if actualSize > 0 {
+					sd = make(map[string]uint64, actualSize)
+					for _, ss := range subjs[offset:end] {
+						sd[ss] = st[ss]
+					}
+				}
+				resp.StreamInfo.State.Subjects = sd
+			}
+		}
+	}
+	if tokenStats {
+		resp.StreamInfo.TokenStats = mset.tokenStats()
+	}
+	if ranges {
+		resp.StreamInfo.State.DeletedRanges = mset.deletedRanges()
+	}
+	if storageStats {
+		resp.StreamInfo.StorageStats = mset.storageStats()
+	}
+	if partitions {
+		resp.StreamInfo.Partitions = mset.partitions()
+	}
+	resp.StreamInfo.EventTime = mset.eventTime()
+	// Check for out of band catchups.
+	if mset.hasCatchupPeers() {
+		mset.checkClusterInfo(resp.StreamInfo.Cluster)
+	}
+	js.checkScaleInfo(mset.streamAssignment(), resp.StreamInfo.Cluster)
+
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Request to have a stream that is read-only after a failure of its storage accept new messages again.
+// In clustered mode every server with a replica of the stream will recover it, the stream leader responds.
+func (s *Server) jsStreamRecoverRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamRecoverResponse{ApiResponse: ApiResponse{Type: JSApiStreamRecoverResponseType}}
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	isLeader := true
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isMetaLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isMetaLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+		// Our storage failures are our own, so every replica recovers, but only the stream leader responds.
+		isLeader = acc.JetStreamIsStreamLeader(stream)
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr && isLeader {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		if isLeader {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	failure, err := s.recoverStreamStorage(mset)
+	if !isLeader {
+		if err != nil {
+			s.Warnf("JetStream stream '%s > %s' could not recover from storage failure: %v", acc.Name, stream, err)
+		}
+		return
+	}
+	if err != nil {
+		resp.Failure = failure
+		resp.Error = NewJSStreamStorageRecoverFailedError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Recovered, resp.Failure = failure != nil, failure
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
+
+// Request to verify the messages of a stream against their checksums.
+// In clustered mode every server with a replica of the stream verifies its own, the stream leader responds.
+func (s *Server) jsStreamScrubRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamScrubResponse{ApiResponse: ApiResponse{Type: JSApiStreamScrubResponseType}}
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	isLeader := true
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isMetaLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isMetaLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+		// Every replica verifies its own storage, but only the stream leader responds.
+		isLeader = acc.JetStreamIsStreamLeader(stream)
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr && isLeader {
+			resp.Error = NewJSNotEnabledForAccountError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
 		}
-		details, subjects = req.DeletedDetails, req.SubjectsFilter
-		offset = req.Offset
+		return
 	}
 
-	mset, err := acc.lookupStream(streamName)
-	// Error is not to be expected at this point, but could happen if same stream trying to be created.
+	mset, err := acc.lookupStream(stream)
 	if err != nil {
-		if cc != nil {
-			// This could be inflight, pause for a short bit and try again.
-			// This will not be inline, so ok.
-			time.Sleep(10 * time.Millisecond)
-			mset, err = acc.lookupStream(streamName)
-		}
-		// Check again.
-		if err != nil {
+		if isLeader {
 			resp.Error = NewJSStreamNotFoundError(Unless(err))
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
 		}
+		return
 	}
 
-	config := mset.config()
-	resp.StreamInfo = &StreamInfo{
-		Created:    mset.createdTime(),
-		State:      mset.stateWithDetail(details),
-		Config:     *setDynamicStreamMetadata(&config),
-		Domain:     s.getOpts().JetStreamDomain,
-		Cluster:    js.clusterInfo(mset.raftGroup()),
-		Mirror:     mset.mirrorInfo(),
-		Sources:    mset.sourcesInfo(),
-		Alternates: js.streamAlternates(ci, config.Name),
-		TimeStamp:  time.Now().UTC(),
-	}
-	if clusterWideConsCount > 0 {
-		resp.StreamInfo.State.Consumers = clusterWideConsCount
-	}
-
-	// Check if they have asked for subject details.
-	if subjects != _EMPTY_ {
-		st := mset.store.SubjectsTotals(subjects)
-		if lst := len(st); lst > 0 {
-			// Common for both cases.
-			resp.Offset = offset
-			resp.Limit = JSMaxSubjectDetails
-			resp.Total = lst
-
-			if offset == 0 && lst <= JSMaxSubjectDetails {
-				resp.StreamInfo.State.Subjects = st
-			} else {
-				// Here we have to filter list due to offset or maximum constraints.
-				subjs := make([]string, 0, len(st))
-				for subj := range st {
-					subjs = append(subjs, subj)
-				}
-				// Sort it
-				slices.Sort(subjs)
-
-				if offset > len(subjs) {
-					offset = len(subjs)
-				}
-
-				end := offset + JSMaxSubjectDetails
-				if end > len(subjs) {
-					end = len(subjs)
-				}
-				actualSize := end - offset
-				var sd map[string]uint64
-
-				if actualSize > 0 {
-					sd = make(map[string]uint64, actualSize)
-					for _, ss := range subjs[offset:end] {
-						sd[ss] = st[ss]
-					}
-				}
-				resp.StreamInfo.State.Subjects = sd
-			}
-		}
+	err = mset.scrubStore()
+	if !isLeader {
+		return
 	}
-	// Check for out of band catchups.
-	if mset.hasCatchupPeers() {
-		mset.checkClusterInfo(resp.StreamInfo.Cluster)
+	if err != nil {
+		resp.Error = NewJSStreamScrubNotSupportedError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
-
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	resp.Started = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 }
 
 // Request to have a stream leader stepdown.
@@ -2703,7 +3620,7 @@ func (s *Server) jsLeaderServerStreamMoveRequest(sub *subscription, c *client, _
 
 	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
 	// We should be fine ignoring pedantic mode here. as we do not touch configuration.
-	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false)
+	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false, _EMPTY_)
 }
 
 // Request to have the metaleader move a stream on a peer to another
@@ -2809,7 +3726,7 @@ func (s *Server) jsLeaderServerStreamCancelMoveRequest(sub *subscription, c *cli
 		cfg.Replicas, streamName, accName, s.peerSetToNames(currPeers), s.peerSetToNames(peers))
 
 	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
-	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false)
+	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false, _EMPTY_)
 }
 
 // Request to have an account purged
@@ -3062,26 +3979,33 @@ func (s *Server) jsStreamDeleteRequest(sub *subscription, c *client, _ *Account,
 	}
 	stream := streamNameFromSubject(subject)
 
-	// Clustered.
-	if s.JetStreamIsClustered() {
-		s.jsClusteredStreamDeleteRequest(ci, acc, stream, subject, reply, msg)
-		return
-	}
+	// Deleting may need to be approved by a lifecycle hook first.
+	msg = copyBytes(msg)
+	s.approveStreamOp(ci, acc, stream, streamHookDelete, msg, nil, func() {
+		// Clustered.
+		if s.JetStreamIsClustered() {
+			s.jsClusteredStreamDeleteRequest(ci, acc, stream, subject, reply, msg)
+			return
+		}
 
-	mset, err := acc.lookupStream(stream)
-	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
+		mset, err := acc.lookupStream(stream)
+		if err != nil {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
 
-	if err := mset.delete(); err != nil {
-		resp.Error = NewJSStreamDeleteError(err, Unless(err))
+		if err := mset.delete(); err != nil {
+			resp.Error = NewJSStreamDeleteError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		resp.Success = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	}, func(err *ApiError) {
+		resp.Error = err
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-	resp.Success = true
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	})
 }
 
 // Request to delete a message.
@@ -3178,7 +4102,7 @@ func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, su
 		return
 	}
 	if mset.cfg.DenyDelete {
-		resp.Error = NewJSStreamMsgDeleteFailedError(errors.New("message delete not permitted"))
+		resp.Error = NewJSStreamMsgDeleteFailedError(errStreamDenyDelete)
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
@@ -3447,24 +4371,31 @@ func (s *Server) jsStreamPurgeRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 	if mset.cfg.DenyPurge {
-		resp.Error = NewJSStreamPurgeFailedError(errors.New("stream purge not permitted"))
+		resp.Error = NewJSStreamPurgeFailedError(errStreamDenyPurge)
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if s.JetStreamIsClustered() {
-		s.jsClusteredStreamPurgeRequest(ci, acc, mset, stream, subject, reply, rmsg, purgeRequest)
-		return
-	}
+	// Purging may need to be approved by a lifecycle hook first.
+	msg, rmsg = copyBytes(msg), copyBytes(rmsg)
+	s.approveStreamOp(ci, acc, stream, streamHookPurge, msg, nil, func() {
+		if s.JetStreamIsClustered() {
+			s.jsClusteredStreamPurgeRequest(ci, acc, mset, stream, subject, reply, rmsg, purgeRequest)
+			return
+		}
 
-	purged, err := mset.purge(purgeRequest)
-	if err != nil {
-		resp.Error = NewJSStreamGeneralError(err, Unless(err))
-	} else {
-		resp.Purged = purged
-		resp.Success = true
-	}
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+		purged, err := mset.purge(purgeRequest)
+		if err != nil {
+			resp.Error = NewJSStreamGeneralError(err, Unless(err))
+		} else {
+			resp.Purged = purged
+			resp.Success = true
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	}, func(err *ApiError) {
+		resp.Error = err
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
 }
 
 func (acc *Account) jsNonClusteredStreamLimitsCheck(cfg *StreamConfig) *ApiError {
@@ -3518,6 +4449,12 @@ func (s *Server) jsStreamRestoreRequest(sub *subscription, c *client, _ *Account
 		return
 	}
 
+	if req.EphemeralsTTL < 0 {
+		resp.Error = NewJSStreamRestoreError(errors.New("ephemerals ttl can not be negative"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	stream := streamNameFromSubject(subject)
 
 	if stream != req.Config.Name && req.Config.Name == _EMPTY_ {
@@ -3532,6 +4469,20 @@ func (s *Server) jsStreamRestoreRequest(sub *subscription, c *client, _ *Account
 		return
 	}
 
+	// Verifying does not create the stream, so this is always handled by us and
+	// there is no need to check limits or if the stream already exists.
+	if req.VerifyOnly {
+		s.processStreamRestore(ci, acc, &req.Config, &req.State, &req.StreamRestoreOptions, subject, reply, string(msg))
+		return
+	}
+
+	// A restore creates a new stream.
+	if acc.JetStreamFrozen() {
+		resp.Error = NewJSAccountFrozenError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	if s.JetStreamIsClustered() {
 		s.jsClusteredStreamRestoreRequest(ci, acc, &req, subject, reply, rmsg)
 		return
@@ -3557,45 +4508,135 @@ func (s *Server) jsStreamRestoreRequest(sub *subscription, c *client, _ *Account
 		return
 	}
 
-	s.processStreamRestore(ci, acc, &req.Config, subject, reply, string(msg))
+	s.processStreamRestore(ci, acc, &req.Config, &req.State, &req.StreamRestoreOptions, subject, reply, string(msg))
+}
+
+// How long the staged snapshot of an interrupted restore is kept so the restore can be resumed.
+var restoreResumeWindow = 5 * time.Minute
+
+// How often restore progress advisories are sent while receiving a snapshot.
+var restoreProgressInterval = time.Second
+
+// If we receive nothing for this long the restore is considered interrupted.
+var restoreActivityInterval = 5 * time.Second
+
+// stagedRestore is the partially received snapshot of an interrupted restore.
+type stagedRestore struct {
+	acc    string
+	stream string
+	path   string
+	size   int64
+	timer  *time.Timer
+}
+
+// Keeps the partially received snapshot of an interrupted restore around for restoreResumeWindow.
+func (js *jetStream) stageRestore(id string, sr *stagedRestore) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.restores == nil {
+		js.restores = make(map[string]*stagedRestore)
+	}
+	js.restores[id] = sr
+	sr.timer = time.AfterFunc(restoreResumeWindow, func() {
+		js.mu.Lock()
+		if js.restores[id] == sr {
+			delete(js.restores, id)
+			os.Remove(sr.path)
+		}
+		js.mu.Unlock()
+	})
+}
+
+// Takes the staged snapshot of an interrupted restore of this stream so it can be resumed.
+func (js *jetStream) takeStagedRestore(id, acc, stream string) *stagedRestore {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	sr := js.restores[id]
+	if sr == nil || sr.acc != acc || sr.stream != stream {
+		return nil
+	}
+	sr.timer.Stop()
+	delete(js.restores, id)
+	return sr
 }
 
-func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamConfig, subject, reply, msg string) <-chan error {
+func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamConfig, state *StreamState, opts *StreamRestoreOptions, subject, reply, msg string) <-chan error {
 	js := s.getJetStream()
 
 	var resp = JSApiStreamRestoreResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreResponseType}}
 
-	snapDir := filepath.Join(js.config.StoreDir, snapStagingDir)
-	if _, err := os.Stat(snapDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(snapDir, defaultDirPerms); err != nil {
-			resp.Error = &ApiError{Code: 503, Description: "JetStream unable to create temp storage for restore"}
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	if opts == nil {
+		opts = &StreamRestoreOptions{}
+	}
+	streamName := cfg.Name
+
+	var tfile *os.File
+	var offset int64
+	restoreID := opts.Resume
+	if restoreID != _EMPTY_ {
+		sr := js.takeStagedRestore(restoreID, acc.Name, streamName)
+		if sr == nil {
+			resp.Error = NewJSRestoreResumeNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
+			return nil
+		}
+		f, err := os.OpenFile(sr.path, os.O_RDWR|os.O_APPEND, defaultFilePerms)
+		if err != nil {
+			os.Remove(sr.path)
+			resp.Error = NewJSTempStorageFailedError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
+			return nil
+		}
+		tfile, offset = f, sr.size
+	} else {
+		snapDir := filepath.Join(js.config.StoreDir, snapStagingDir)
+		if _, err := os.Stat(snapDir); os.IsNotExist(err) {
+			if err := os.MkdirAll(snapDir, defaultDirPerms); err != nil {
+				resp.Error = &ApiError{Code: 503, Description: "JetStream unable to create temp storage for restore"}
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return nil
+			}
+		}
+
+		f, err := os.CreateTemp(snapDir, "js-restore-")
+		if err != nil {
+			resp.Error = NewJSTempStorageFailedError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
 			return nil
 		}
+		tfile, restoreID = f, nuid.Next()
 	}
 
-	tfile, err := os.CreateTemp(snapDir, "js-restore-")
-	if err != nil {
-		resp.Error = NewJSTempStorageFailedError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
-		return nil
+	// The server can limit the rate of restores, requests can only lower it.
+	rate := opts.RateLimit
+	if max := s.getOpts().JetStreamMaxRestoreRate; max > 0 && (rate <= 0 || rate > max) {
+		rate = max
 	}
 
-	streamName := cfg.Name
-	s.Noticef("Starting restore for stream '%s > %s'", acc.Name, streamName)
+	op := "restore"
+	if opts.VerifyOnly {
+		op = "snapshot verification"
+	}
+	if offset > 0 {
+		s.Noticef("Resuming %s for stream '%s > %s' at %s", op, acc.Name, streamName, friendlyBytes(offset))
+	} else {
+		s.Noticef("Starting %s for stream '%s > %s'", op, acc.Name, streamName)
+	}
 
 	start := time.Now().UTC()
 	domain := s.getOpts().JetStreamDomain
-	s.publishAdvisory(acc, JSAdvisoryStreamRestoreCreatePre+"."+streamName, &JSRestoreCreateAdvisory{
-		TypedEvent: TypedEvent{
-			Type: JSRestoreCreateAdvisoryType,
-			ID:   nuid.Next(),
-			Time: start,
-		},
-		Stream: streamName,
-		Client: ci,
-		Domain: domain,
-	})
+	if !opts.VerifyOnly {
+		s.publishAdvisory(acc, JSAdvisoryStreamRestoreCreatePre+"."+streamName, &JSRestoreCreateAdvisory{
+			TypedEvent: TypedEvent{
+				Type: JSRestoreCreateAdvisoryType,
+				ID:   nuid.Next(),
+				Time: start,
+			},
+			Stream: streamName,
+			Client: ci,
+			Domain: domain,
+		})
+	}
 
 	// Create our internal subscription to accept the snapshot.
 	restoreSubj := fmt.Sprintf(jsRestoreDeliverT, streamName, nuid.Next())
@@ -3605,11 +4646,17 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 		reply string
 	}
 
+	// A chunk that was written, the ack is sent by the Go routine below so it can throttle.
+	type chunk struct {
+		n     int
+		reply string
+	}
+
 	// For signaling to upper layers.
 	resultCh := make(chan result, 1)
-	activeQ := newIPQueue[int](s, fmt.Sprintf("[ACC:%s] stream '%s' restore", acc.Name, streamName)) // of int
+	activeQ := newIPQueue[chunk](s, fmt.Sprintf("[ACC:%s] stream '%s' restore", acc.Name, streamName))
 
-	var total int
+	total := int(offset)
 
 	// FIXME(dlc) - Probably take out of network path eventually due to disk I/O?
 	processChunk := func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
@@ -3637,7 +4684,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 		// This means we are complete with our transfer from the client.
 		if len(msg) == 0 {
 			s.Debugf("Finished staging restore for stream '%s > %s'", acc.Name, streamName)
-			resultCh <- result{err, reply}
+			resultCh <- result{nil, reply}
 			return
 		}
 
@@ -3659,9 +4706,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 			return
 		}
 
-		activeQ.push(len(msg))
-
-		s.sendInternalAccountMsg(acc, reply, nil)
+		activeQ.push(chunk{len(msg), reply})
 	}
 
 	sub, err := acc.subscribeInternal(restoreSubj, processChunk)
@@ -3674,7 +4719,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 	}
 
 	// Mark the subject so the end user knows where to send the snapshot chunks.
-	resp.DeliverSubject = restoreSubj
+	resp.DeliverSubject, resp.RestoreID, resp.Offset = restoreSubj, restoreID, offset
 	s.sendAPIResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
 
 	doneCh := make(chan error, 1)
@@ -3682,29 +4727,65 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 	// Monitor the progress from another Go routine.
 	s.startGoRoutine(func() {
 		defer s.grWG.Done()
+
+		// Set if the transfer was interrupted, in which case we keep what we have so far.
+		var interrupted bool
 		defer func() {
-			tfile.Close()
-			os.Remove(tfile.Name())
 			sub.client.processUnsub(sub.sid)
 			activeQ.unregister()
+			if interrupted {
+				if fi, err := tfile.Stat(); err == nil {
+					tfile.Close()
+					js.stageRestore(restoreID, &stagedRestore{acc: acc.Name, stream: streamName, path: tfile.Name(), size: fi.Size()})
+					return
+				}
+			}
+			tfile.Close()
+			os.Remove(tfile.Name())
 		}()
 
-		const activityInterval = 5 * time.Second
-		notActive := time.NewTimer(activityInterval)
+		notActive := time.NewTimer(restoreActivityInterval)
 		defer notActive.Stop()
+		progress := time.NewTicker(restoreProgressInterval)
+		defer progress.Stop()
 
-		total := 0
+		total, reported := offset, offset
 		for {
 			select {
 			case result := <-resultCh:
+				// Account for anything we have not gotten to yet.
+				for _, c := range activeQ.pop() {
+					total += int64(c.n)
+				}
+
 				err := result.err
+
+				// When only verifying, report back and we are done.
+				if opts.VerifyOnly {
+					var resp = JSApiStreamRestoreVerifyResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreVerifyResponseType}}
+					if err == nil {
+						tfile.Seek(0, 0)
+						resp.Report, err = acc.VerifyStreamSnapshot(cfg, state, tfile)
+					}
+					if err != nil {
+						resp.Error = NewJSStreamRestoreError(err, Unless(err))
+						s.Warnf("Verifying snapshot for stream '%s > %s' failed: %v", acc.Name, streamName, err)
+					} else {
+						s.Noticef("Verified snapshot of %s for stream '%s > %s', valid: %v",
+							friendlyBytes(total), acc.Name, streamName, resp.Report.Valid)
+					}
+					s.sendInternalAccountMsg(acc, result.reply, s.jsonResponse(&resp))
+					doneCh <- err
+					return
+				}
+
 				var mset *stream
 
 				// If we staged properly go ahead and do restore now.
 				if err == nil {
 					s.Debugf("Finalizing restore for stream '%s > %s'", acc.Name, streamName)
 					tfile.Seek(0, 0)
-					mset, err = acc.RestoreStream(cfg, tfile)
+					mset, err = acc.restoreStream(cfg, tfile, opts)
 				} else {
 					errStr := err.Error()
 					tmp := []rune(errStr)
@@ -3724,7 +4805,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 					Stream: streamName,
 					Start:  start,
 					End:    end,
-					Bytes:  int64(total),
+					Bytes:  total,
 					Client: ci,
 					Domain: domain,
 				})
@@ -3734,7 +4815,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 				if err != nil {
 					resp.Error = NewJSStreamRestoreError(err, Unless(err))
 					s.Warnf("Restore failed for %s for stream '%s > %s' in %v",
-						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start))
+						friendlyBytes(total), streamName, acc.Name, end.Sub(start))
 				} else {
 					msetCfg := mset.config()
 					resp.StreamInfo = &StreamInfo{
@@ -3744,7 +4825,7 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 						TimeStamp: time.Now().UTC(),
 					}
 					s.Noticef("Completed restore of %s for stream '%s > %s' in %v",
-						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start).Round(time.Millisecond))
+						friendlyBytes(total), streamName, acc.Name, end.Sub(start).Round(time.Millisecond))
 				}
 
 				// On the last EOF, send back the stream info or error status.
@@ -3753,12 +4834,32 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 				doneCh <- err
 				return
 			case <-activeQ.ch:
-				if n, ok := activeQ.popOne(); ok {
-					total += n
-					notActive.Reset(activityInterval)
+				if c, ok := activeQ.popOne(); ok {
+					total += int64(c.n)
+					// Hold back the ack until we are within our rate, the client waits for it before sending more.
+					if rate > 0 {
+						due := start.Add(time.Duration(float64(total-offset) / float64(rate) * float64(time.Second)))
+						if wait := time.Until(due); wait > 0 {
+							select {
+							case <-time.After(wait):
+							case <-s.quitCh:
+								doneCh <- ErrServerNotRunning
+								return
+							}
+						}
+					}
+					s.sendInternalAccountMsg(acc, c.reply, nil)
+					notActive.Reset(restoreActivityInterval)
 				}
+			case <-progress.C:
+				if total == reported {
+					continue
+				}
+				reported = total
+				s.publishAdvisory(acc, JSAdvisoryStreamRestoreProgressPre+"."+streamName, restoreProgress(streamName, ci, domain, state, opts.Size, total, offset, start))
 			case <-notActive.C:
-				err := fmt.Errorf("restore for stream '%s > %s' is stalled", acc, streamName)
+				interrupted = true
+				err := fmt.Errorf("restore for stream '%s > %s' is stalled, it can be resumed with id %q", acc, streamName, restoreID)
 				doneCh <- err
 				return
 			}
@@ -3768,6 +4869,36 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 	return doneCh
 }
 
+// Builds the progress advisory of a restore that has received total bytes, offset of them before it was resumed.
+func restoreProgress(stream string, ci *ClientInfo, domain string, state *StreamState, size, total, offset int64, start time.Time) *JSRestoreProgressAdvisory {
+	now := time.Now().UTC()
+	adv := &JSRestoreProgressAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSRestoreProgressAdvisoryType,
+			ID:   nuid.Next(),
+			Time: now,
+		},
+		Stream: stream,
+		Bytes:  total,
+		Size:   size,
+		Client: ci,
+		Domain: domain,
+	}
+	if elapsed := now.Sub(start); elapsed > 0 {
+		adv.Rate = int64(float64(total-offset) / elapsed.Seconds())
+	}
+	if size > 0 {
+		done := min(float64(total)/float64(size), 1)
+		if state != nil {
+			adv.Messages = uint64(done * float64(state.Msgs))
+		}
+		if adv.Rate > 0 && total < size {
+			adv.ETA = time.Duration(float64(size-total) / float64(adv.Rate) * float64(time.Second))
+		}
+	}
+	return adv
+}
+
 // Process a snapshot request.
 func (s *Server) jsStreamSnapshotRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
@@ -3999,6 +5130,26 @@ const (
 // Request to create a consumer where stream and optional consumer name are part of the subject, and optional
 // filtered subjects can be at the tail end.
 // Assumes stream and consumer names are single tokens.
+// checkConsumersSoftLimit will warn if a new consumer made the stream reach its soft limit of consumers.
+func (s *Server) checkConsumersSoftLimit(acc *Account, cfg *StreamConfig, numConsumers int) {
+	if cfg.MaxConsumersWarn <= 0 || numConsumers < cfg.MaxConsumersWarn {
+		return
+	}
+	s.RateLimitWarnf("JetStream stream '%s > %s' has %d consumers, reaching its soft limit of %d", acc.Name, cfg.Name, numConsumers, cfg.MaxConsumersWarn)
+	s.publishAdvisory(acc, JSAdvisoryStreamMaxConsumersWarnPre+"."+cfg.Name, &JSStreamMaxConsumersWarnAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamMaxConsumersWarnAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:           cfg.Name,
+		Consumers:        numConsumers,
+		MaxConsumersWarn: cfg.MaxConsumersWarn,
+		MaxConsumers:     cfg.MaxConsumers,
+		Domain:           s.getOpts().JetStreamDomain,
+	})
+}
+
 func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
@@ -4186,6 +5337,16 @@ func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Accoun
 		// If the consumer already exists then don't allow updating the PauseUntil, just set
 		// it back to whatever the current configured value is.
 		req.Config.PauseUntil = o.cfg.PauseUntil
+	} else if s.JetStreamInMaintenance() {
+		// No new consumers while in maintenance.
+		resp.Error = NewJSMaintenanceModeError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if !req.Config.Direct && acc.JetStreamFrozen() {
+		// No new consumers while the account is frozen, the ones of mirrors and sources are not ours to block.
+		resp.Error = NewJSAccountFrozenError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
 
 	// Initialize/update asset version metadata.
@@ -4206,6 +5367,14 @@ func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Accoun
 	resp.ConsumerInfo = setDynamicConsumerInfoMetadata(o.initialInfo())
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 
+	if oldCfg == nil && !o.cfg.Direct {
+		stream.mu.RLock()
+		numConsumers := stream.numPublicConsumers()
+		stream.mu.RUnlock()
+		scfg := stream.config()
+		s.checkConsumersSoftLimit(acc, &scfg, numConsumers)
+	}
+
 	if o.cfg.PauseUntil != nil && !o.cfg.PauseUntil.IsZero() && time.Now().Before(*o.cfg.PauseUntil) {
 		o.sendPauseAdvisoryLocked(&o.cfg)
 	}
@@ -4253,6 +5422,8 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 	}
 
 	var offset int
+	var filter string
+	var lf *ApiListFilter
 	if isJSONObjectOrArray(msg) {
 		var req JSApiConsumersRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
@@ -4261,6 +5432,7 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			return
 		}
 		offset = req.Offset
+		filter, lf = req.Subject, &req.ApiListFilter
 	}
 
 	streamName := streamNameFromSubject(subject)
@@ -4287,8 +5459,10 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		for consumer := range sa.consumers {
-			resp.Consumers = append(resp.Consumers, consumer)
+		for consumer, ca := range sa.consumers {
+			if consumerMatchesListFilter(ca.Config, filter, lf) {
+				resp.Consumers = append(resp.Consumers, consumer)
+			}
 		}
 		if len(resp.Consumers) > 1 {
 			slices.Sort(resp.Consumers)
@@ -4312,6 +5486,10 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 		}
 
 		obs := mset.getPublicConsumers()
+		obs = slices.DeleteFunc(obs, func(o *consumer) bool {
+			cfg := o.config()
+			return !consumerMatchesListFilter(&cfg, filter, lf)
+		})
 		slices.SortFunc(obs, func(i, j *consumer) int { return cmp.Compare(i.name, j.name) })
 
 		numConsumers = len(obs)
@@ -4375,6 +5553,8 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 	}
 
 	var offset int
+	var filter string
+	var lf *ApiListFilter
 	if isJSONObjectOrArray(msg) {
 		var req JSApiConsumersRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
@@ -4383,6 +5563,7 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 			return
 		}
 		offset = req.Offset
+		filter, lf = req.Subject, &req.ApiListFilter
 	}
 
 	streamName := streamNameFromSubject(subject)
@@ -4392,7 +5573,7 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 		// Need to copy these off before sending.. don't move this inside startGoRoutine!!!
 		msg = copyBytes(msg)
 		s.startGoRoutine(func() {
-			s.jsClusteredConsumerListRequest(acc, ci, offset, streamName, subject, reply, msg)
+			s.jsClusteredConsumerListRequest(acc, ci, filter, lf, offset, streamName, subject, reply, msg)
 		})
 		return
 	}
@@ -4405,6 +5586,10 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 	}
 
 	obs := mset.getPublicConsumers()
+	obs = slices.DeleteFunc(obs, func(o *consumer) bool {
+		cfg := o.config()
+		return !consumerMatchesListFilter(&cfg, filter, lf)
+	})
 	slices.SortFunc(obs, func(i, j *consumer) int { return cmp.Compare(i.name, j.name) })
 
 	ocnt := len(obs)
@@ -4638,16 +5823,19 @@ func (s *Server) jsConsumerDeleteRequest(sub *subscription, c *client, _ *Accoun
 		}
 		return
 	}
+	var req JSApiConsumerDeleteRequest
 	if !isEmptyRequest(msg) {
-		resp.Error = NewJSNotEmptyRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
 	}
 	stream := streamNameFromSubject(subject)
 	consumer := consumerNameFromSubject(subject)
 
 	if s.JetStreamIsClustered() {
-		s.jsClusteredConsumerDeleteRequest(ci, acc, stream, consumer, subject, reply, rmsg)
+		s.jsClusteredConsumerDeleteRequest(ci, acc, stream, consumer, subject, reply, rmsg, req.Force)
 		return
 	}
 
@@ -4664,6 +5852,11 @@ func (s *Server) jsConsumerDeleteRequest(sub *subscription, c *client, _ *Accoun
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	if obs.config().Protected && !req.Force {
+		resp.Error = NewJSConsumerProtectedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 	if err := obs.delete(); err != nil {
 		resp.Error = NewJSStreamGeneralError(err, Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
@@ -0,0 +1,104 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/nats-io/nuid"
+)
+
+// Headers used for chunked JetStream API responses.
+const (
+	// JSResponseChunked is set on an API request to accept a chunked response.
+	// The value is the maximum size of a chunk, or any other value for the server limit.
+	JSResponseChunked = "Nats-Response-Chunked"
+	// JSResponseId identifies all the chunks of the same response.
+	JSResponseId = "Nats-Response-Id"
+	// JSResponseChunk is the position of the chunk in the response, starting at 1.
+	JSResponseChunk = "Nats-Response-Chunk"
+	// JSResponseChunks is only set on the empty message terminating a chunked response,
+	// and holds the number of chunks that were sent.
+	JSResponseChunks = "Nats-Response-Chunks"
+)
+
+// Returns the configured maximum size of an API response, or zero if not limited.
+func (s *Server) jsApiResponseLimit() int {
+	return s.getOpts().JetStreamLimits.MaxResponseSize
+}
+
+// Returns the maximum size of a chunk of an API response, which is the
+// configured response limit or otherwise the max payload.
+func (s *Server) jsApiResponseChunkLimit() int {
+	if limit := s.jsApiResponseLimit(); limit > 0 {
+		return limit
+	}
+	if mp := s.getOpts().MaxPayload; mp > 0 {
+		return int(mp)
+	}
+	return MAX_PAYLOAD_SIZE
+}
+
+// Returns the size of the chunks of an API response from the value of the
+// request header, or zero if no chunked response was requested.
+func (s *Server) jsApiResponseChunkSize(v []byte) int {
+	if v == nil {
+		return 0
+	}
+	limit := s.jsApiResponseChunkLimit()
+	if n, err := strconv.Atoi(string(v)); err == nil && n > 0 && n < limit {
+		return n
+	}
+	return limit
+}
+
+// Sends an API response to the reply subject. Responses over the chunk size
+// are sent in chunks if the request asked for it. Otherwise responses are only
+// replaced with an error when over the configured limit.
+func (s *Server) sendAPIReply(ci *ClientInfo, reply, response string) {
+	if ci != nil && ci.ResponseChunk > 0 {
+		if len(response) > ci.ResponseChunk {
+			s.sendAPIReplyChunks(reply, response, ci.ResponseChunk)
+			return
+		}
+	} else if limit := s.jsApiResponseLimit(); limit > 0 && len(response) > limit {
+		// Keep the type of the response so the requester can decode the error.
+		var resp ApiResponse
+		json.Unmarshal([]byte(response), &resp)
+		resp.Error = NewJSApiResponseTooLargeError(limit, len(response))
+		s.sendInternalAccountMsg(nil, reply, s.jsonResponse(&resp))
+		return
+	}
+	s.sendInternalAccountMsg(nil, reply, response)
+}
+
+// Sends an API response in chunks of at most size bytes, followed by an
+// empty message holding the number of chunks.
+func (s *Server) sendAPIReplyChunks(reply, response string, size int) {
+	id, n := nuid.Next(), 0
+	for len(response) > 0 {
+		chunk := response
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		response = response[len(chunk):]
+		n++
+		hdr := map[string]string{JSResponseId: id, JSResponseChunk: strconv.Itoa(n)}
+		s.sendInternalAccountMsgWithReply(nil, reply, _EMPTY_, hdr, chunk, false)
+	}
+	// Terminate the response.
+	hdr := map[string]string{JSResponseId: id, JSResponseChunks: strconv.Itoa(n)}
+	s.sendInternalAccountMsgWithReply(nil, reply, _EMPTY_, hdr, nil, false)
+}
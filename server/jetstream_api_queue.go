@@ -0,0 +1,344 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// JSAccountIsolation bounds what a single account can use of the processing of
+// JetStream API requests that arrive over routes, gateways and leafnodes.
+// These are always scheduled round robin between accounts, so a noisy account
+// can not starve the others, the limits also bound its queue and concurrency.
+// API requests of clients connected to this server are processed by their own
+// connection. It can also bound how many streams of an account deliver at the
+// same time, see jsDeliveryBudget, and schedule the raft proposals of the
+// streams and consumers on this server, see nrgProposalScheduler.
+type JSAccountIsolation struct {
+	// APIMaxPending is the most requests an account can have queued, further ones are dropped.
+	APIMaxPending int `json:"api_max_pending,omitempty"`
+	// APIMaxInflight is the most requests of an account that are processed at the same time.
+	APIMaxInflight int `json:"api_max_inflight,omitempty"`
+	// ProposalMaxInflight is the most raft groups that append proposals at the same time,
+	// others wait for their turn. Zero does not schedule proposals.
+	ProposalMaxInflight int `json:"proposal_max_inflight,omitempty"`
+	// DeliveryMaxInflight is the most streams of an account whose send loops deliver
+	// messages at the same time, others wait for their turn. Zero does not schedule deliveries.
+	DeliveryMaxInflight int `json:"delivery_max_inflight,omitempty"`
+}
+
+// How long the scheduling statistics of an account without routed requests are kept.
+const jsAPIAccountQueueIdle = 5 * time.Minute
+
+// JSAccountDeliveryStats shows how long the streams of an account waited for their
+// turn to deliver. Long waits indicate the account delivers more than its budget allows.
+type JSAccountDeliveryStats struct {
+	Batches uint64        `json:"batches"`
+	AvgWait time.Duration `json:"avg_wait"`
+	MaxWait time.Duration `json:"max_wait"`
+}
+
+// JSAccountAPIQueueStats shows how the routed API requests of an account were scheduled.
+// Long waits while other accounts are served indicate starvation.
+type JSAccountAPIQueueStats struct {
+	Pending   int           `json:"pending"`
+	Inflight  int           `json:"inflight"`
+	Processed uint64        `json:"processed"`
+	Dropped   uint64        `json:"dropped"`
+	AvgWait   time.Duration `json:"avg_wait"`
+	MaxWait   time.Duration `json:"max_wait"`
+}
+
+// jsAPIQueue holds the routed API requests per account and hands them out
+// to the workers round robin between the accounts.
+type jsAPIQueue struct {
+	mu    sync.Mutex
+	ch    chan struct{}
+	accs  map[string]*jsAPIAccountQueue
+	ready []*jsAPIAccountQueue // Accounts with requests that can be processed, in turn.
+	n     int                  // Requests queued over all accounts.
+	lim   JSAccountIsolation
+	// Totals over all accounts, for the ipqueuesz monitoring.
+	inflight int
+	dropped  uint64
+	pruned   time.Time
+}
+
+type jsAPIAccountQueue struct {
+	name      string
+	reqs      []*jsAPIRoutedReq
+	inflight  int
+	ready     bool
+	processed uint64
+	dropped   uint64
+	waited    time.Duration
+	maxWait   time.Duration
+	last      time.Time // Last time a request was queued or processed.
+}
+
+func newJSAPIQueue(lim JSAccountIsolation) *jsAPIQueue {
+	return &jsAPIQueue{
+		ch:   make(chan struct{}, 1),
+		accs: make(map[string]*jsAPIAccountQueue),
+		lim:  lim,
+	}
+}
+
+// Returns the name of the account a routed API request is made for.
+func jsAPIRequestAccount(acc *Account, hdr []byte) string {
+	var ci struct {
+		Account string `json:"acc,omitempty"`
+		Service string `json:"svc,omitempty"`
+	}
+	if len(hdr) > 0 {
+		json.Unmarshal(getHeader(ClientInfoHdr, hdr), &ci)
+	}
+	if ci.Service != _EMPTY_ {
+		return ci.Service
+	} else if ci.Account != _EMPTY_ {
+		return ci.Account
+	} else if acc != nil {
+		return acc.Name
+	}
+	return _EMPTY_
+}
+
+// Signal a worker, without blocking.
+func (q *jsAPIQueue) signal() {
+	select {
+	case q.ch <- struct{}{}:
+	default:
+	}
+}
+
+// Lock should be held.
+func (q *jsAPIQueue) canProcess(aq *jsAPIAccountQueue) bool {
+	return !aq.ready && len(aq.reqs) > 0 && (q.lim.APIMaxInflight <= 0 || aq.inflight < q.lim.APIMaxInflight)
+}
+
+// Lock should be held.
+func (q *jsAPIQueue) makeReady(aq *jsAPIAccountQueue) {
+	if q.canProcess(aq) {
+		aq.ready = true
+		q.ready = append(q.ready, aq)
+		q.signal()
+	}
+}
+
+// push queues the request of the account. Returns the number of requests queued
+// over all accounts, and false if the request was dropped since the account has
+// too many queued.
+func (q *jsAPIQueue) push(account string, r *jsAPIRoutedReq) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if now.Sub(q.pruned) >= jsAPIAccountQueueIdle {
+		q.prune(now)
+	}
+	aq := q.accs[account]
+	if aq == nil {
+		aq = &jsAPIAccountQueue{name: account}
+		q.accs[account] = aq
+	}
+	aq.last = now
+	if q.lim.APIMaxPending > 0 && len(aq.reqs) >= q.lim.APIMaxPending {
+		aq.dropped++
+		q.dropped++
+		return q.n, false
+	}
+	r.account, r.queued = account, now
+	aq.reqs = append(aq.reqs, r)
+	q.n++
+	q.makeReady(aq)
+	return q.n, true
+}
+
+// pop returns the next request to process, from the account whose turn it is.
+// Returns nil if there is none. Call done when the request was processed.
+func (q *jsAPIQueue) pop() *jsAPIRoutedReq {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.ready) == 0 {
+		return nil
+	}
+	aq := q.ready[0]
+	q.ready[0] = nil
+	q.ready = q.ready[1:]
+	aq.ready = false
+
+	r := aq.reqs[0]
+	aq.reqs[0] = nil
+	aq.reqs = aq.reqs[1:]
+	aq.inflight++
+	q.inflight++
+	q.n--
+
+	wait := time.Since(r.queued)
+	aq.waited += wait
+	if wait > aq.maxWait {
+		aq.maxWait = wait
+	}
+	// To the back of the line if it has more.
+	q.makeReady(aq)
+	if len(q.ready) > 0 {
+		q.signal()
+	}
+	return r
+}
+
+// done marks a request returned by pop as processed.
+func (q *jsAPIQueue) done(r *jsAPIRoutedReq) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if aq := q.accs[r.account]; aq != nil {
+		aq.inflight--
+		aq.processed++
+		aq.last = time.Now()
+		q.makeReady(aq)
+	}
+	q.inflight--
+}
+
+// Removes the accounts that have had no requests for a while, along with their statistics.
+// Lock should be held.
+func (q *jsAPIQueue) prune(now time.Time) {
+	q.pruned = now
+	for name, aq := range q.accs {
+		if len(aq.reqs) == 0 && aq.inflight == 0 && now.Sub(aq.last) >= jsAPIAccountQueueIdle {
+			delete(q.accs, name)
+		}
+	}
+}
+
+// len returns the number of requests queued over all accounts.
+func (q *jsAPIQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// drain drops all queued requests. Returns how many were dropped.
+func (q *jsAPIQueue) drain() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.n
+	for _, aq := range q.accs {
+		aq.dropped += uint64(len(aq.reqs))
+		aq.reqs, aq.ready = nil, false
+	}
+	q.ready, q.n = nil, 0
+	q.dropped += uint64(n)
+	return n
+}
+
+// inProgress returns the number of requests being processed over all accounts.
+func (q *jsAPIQueue) inProgress() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(q.inflight)
+}
+
+// limitStats returns the number of requests dropped over all accounts. None are rejected.
+func (q *jsAPIQueue) limitStats() (uint64, uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped, 0
+}
+
+// accountStats returns the scheduling statistics of the account, nil if it had no routed requests.
+func (q *jsAPIQueue) accountStats(account string) *JSAccountAPIQueueStats {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	aq := q.accs[account]
+	if aq == nil {
+		return nil
+	}
+	stats := &JSAccountAPIQueueStats{
+		Pending:   len(aq.reqs),
+		Inflight:  aq.inflight,
+		Processed: aq.processed,
+		Dropped:   aq.dropped,
+		MaxWait:   aq.maxWait,
+	}
+	if started := aq.processed + uint64(aq.inflight); started > 0 {
+		stats.AvgWait = aq.waited / time.Duration(started)
+	}
+	return stats
+}
+
+// jsDeliveryBudget bounds how many streams of an account deliver the messages of their
+// outbound queues at the same time. Streams that have to wait are given turns round robin,
+// each turn allowing a number of bytes, the same way as the raft proposals of groups are.
+// This keeps a single account with busy streams from taking over the send loops.
+type jsDeliveryBudget struct {
+	sc      *nrgProposalScheduler
+	mu      sync.Mutex
+	batches uint64
+	waited  time.Duration
+	maxWait time.Duration
+}
+
+// Returns nil if deliveries are not bounded.
+func newJSDeliveryBudget(max int) *jsDeliveryBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &jsDeliveryBudget{sc: newNRGProposalScheduler(max)}
+}
+
+// acquire asks for a turn to deliver the given number of bytes, without waiting for it.
+// Returns nil if the stream may deliver right away, otherwise the turn to wait for.
+func (b *jsDeliveryBudget) acquire(size int) *nrgProposalTurn {
+	return b.sc.acquire(1, size)
+}
+
+// release gives up the turn once the stream delivered.
+func (b *jsDeliveryBudget) release() {
+	b.sc.release()
+}
+
+// cancel gives up a turn returned by acquire, whether still waiting or already given.
+func (b *jsDeliveryBudget) cancel(t *nrgProposalTurn) {
+	b.sc.cancel(t)
+}
+
+// delivered records how long a stream waited for its turn to deliver.
+func (b *jsDeliveryBudget) delivered(wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches++
+	b.waited += wait
+	if wait > b.maxWait {
+		b.maxWait = wait
+	}
+}
+
+// stats returns the delivery statistics of the account, nil if deliveries are not bounded.
+func (b *jsDeliveryBudget) stats() *JSAccountDeliveryStats {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := &JSAccountDeliveryStats{Batches: b.batches, MaxWait: b.maxWait}
+	if b.batches > 0 {
+		stats.AvgWait = b.waited / time.Duration(b.batches)
+	}
+	return stats
+}
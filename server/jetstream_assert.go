@@ -0,0 +1,226 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	assertFirstSeq      = "first_seq"
+	assertLastSeq       = "last_seq"
+	assertMinMsgs       = "min_msgs"
+	assertMaxMsgs       = "max_msgs"
+	assertLastBySubject = "last_by_subject"
+
+	// Digests are of the form "SHA-256=<base64 url encoded hash>".
+	assertDigestPrefix = "SHA-256="
+	// Shown for subjects that have no message.
+	assertNoMsg = "none"
+)
+
+var errStreamAssertNone = errors.New("no assertions")
+
+// Returns the digest of the data of a message as used in stream assertions.
+func streamAssertDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return assertDigestPrefix + base64.URLEncoding.EncodeToString(sum[:])
+}
+
+// Checks that the request holds valid assertions.
+func (req *JSApiStreamAssertRequest) validate() error {
+	if req.FirstSeq == nil && req.LastSeq == nil && req.MinMsgs == nil && req.MaxMsgs == nil && len(req.LastBySubject) == 0 {
+		return errStreamAssertNone
+	}
+	for _, sa := range req.LastBySubject {
+		if !IsValidSubject(sa.Subject) {
+			return fmt.Errorf("invalid subject %q", sa.Subject)
+		}
+		if sa.Digest != _EMPTY_ && !strings.HasPrefix(sa.Digest, assertDigestPrefix) {
+			return fmt.Errorf("invalid digest for subject %q", sa.Subject)
+		}
+	}
+	return nil
+}
+
+// checkAssertions will check all assertions against the same state of the stream.
+// Returns the results and the last sequence they were checked against.
+func (mset *stream) checkAssertions(req *JSApiStreamAssertRequest) ([]StreamAssertionResult, uint64, error) {
+	// Holding the lock keeps new messages from being stored while we look.
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+
+	if mset.store == nil {
+		return nil, 0, ErrStoreClosed
+	}
+	var state StreamState
+	mset.store.FastState(&state)
+
+	var results []StreamAssertionResult
+	addResult := func(assertion, expected string, actual uint64, passed bool) {
+		results = append(results, StreamAssertionResult{
+			Assertion: assertion,
+			Expected:  expected,
+			Actual:    strconv.FormatUint(actual, 10),
+			Passed:    passed,
+		})
+	}
+	if req.FirstSeq != nil {
+		addResult(assertFirstSeq, strconv.FormatUint(*req.FirstSeq, 10), state.FirstSeq, state.FirstSeq == *req.FirstSeq)
+	}
+	if req.LastSeq != nil {
+		addResult(assertLastSeq, strconv.FormatUint(*req.LastSeq, 10), state.LastSeq, state.LastSeq == *req.LastSeq)
+	}
+	if req.MinMsgs != nil {
+		addResult(assertMinMsgs, ">= "+strconv.FormatUint(*req.MinMsgs, 10), state.Msgs, state.Msgs >= *req.MinMsgs)
+	}
+	if req.MaxMsgs != nil {
+		addResult(assertMaxMsgs, "<= "+strconv.FormatUint(*req.MaxMsgs, 10), state.Msgs, state.Msgs <= *req.MaxMsgs)
+	}
+
+	var smv StoreMsg
+	for _, sa := range req.LastBySubject {
+		actual := assertNoMsg
+		sm, err := mset.store.LoadLastMsg(sa.Subject, &smv)
+		if err == nil {
+			actual = streamAssertDigest(sm.msg)
+		} else if err != ErrStoreMsgNotFound {
+			return nil, 0, err
+		}
+		expected := sa.Digest
+		if expected == _EMPTY_ {
+			expected = assertNoMsg
+		}
+		results = append(results, StreamAssertionResult{
+			Assertion: assertLastBySubject,
+			Subject:   sa.Subject,
+			Expected:  expected,
+			Actual:    actual,
+			Passed:    actual == expected,
+		})
+	}
+	return results, state.LastSeq, nil
+}
+
+// Request to check assertions about the state of a stream.
+func (s *Server) jsStreamAssertRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamAssertResponse{ApiResponse: ApiResponse{Type: JSApiStreamAssertResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamAssertRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if err := req.validate(); err != nil {
+		resp.Error = NewJSStreamAssertInvalidError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	results, lseq, err := mset.checkAssertions(&req)
+	if err != nil {
+		resp.Error = NewJSStreamGeneralError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	resp.Passed, resp.Results, resp.LastSeq = true, results, lseq
+	for _, r := range results {
+		if !r.Passed {
+			resp.Passed = false
+			break
+		}
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
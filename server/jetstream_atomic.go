@@ -0,0 +1,960 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// Maximum number of messages in a single atomic publish.
+	maxAtomicPublishMsgs = 256
+	// File in the store directory of the account recording the atomic publish in progress.
+	atomicIntentFile = "atomic.intent"
+)
+
+var (
+	errAtomicPublishNoMsgs   = errors.New("no messages")
+	errAtomicPublishTooMany  = fmt.Errorf("more than %d messages", maxAtomicPublishMsgs)
+	errAtomicPublishRollup   = errors.New("rollups are not permitted")
+	errAtomicPublishDup      = errors.New("message is a duplicate")
+	errAtomicPublishNoStream = errors.New("no stream matches subject")
+	errAtomicPublishLimits   = errors.New("stream limits would remove messages to store the batch")
+)
+
+// atomicIntent records where an atomic publish stores its messages in file streams,
+// so a publish the server went down in the middle of is removed again on recovery.
+type atomicIntent struct {
+	Streams []atomicIntentRange `json:"streams"`
+}
+
+// The sequences an atomic publish stores its messages at in a stream.
+type atomicIntentRange struct {
+	Stream   string `json:"stream"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+}
+
+// A message of an atomic publish along with the stream it will be stored in.
+type atomicPubMsg struct {
+	mset     *stream
+	subject  string
+	hdr, msg []byte
+	msgId    string
+	seq      uint64
+	ts       int64
+	stored   bool
+	// For republish.
+	tsubj     string
+	tlseq     uint64
+	thdrsOnly bool
+}
+
+// Checks the messages of the request before looking at any stream.
+func (req *JSApiStreamAtomicPublishRequest) validate() error {
+	if len(req.Messages) == 0 {
+		return errAtomicPublishNoMsgs
+	}
+	if len(req.Messages) > maxAtomicPublishMsgs {
+		return errAtomicPublishTooMany
+	}
+	ids := make(map[string]struct{})
+	for i, m := range req.Messages {
+		if m == nil || !IsValidPublishSubject(m.Subject) {
+			return fmt.Errorf("message %d: invalid subject", i)
+		}
+		if len(m.Header) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(m.Header, []byte(hdrLine)) || !bytes.HasSuffix(m.Header, []byte(_CRLF_+_CRLF_)) {
+			return fmt.Errorf("message %d: invalid header", i)
+		}
+		if getRollup(m.Header) != _EMPTY_ {
+			return fmt.Errorf("message %d: %w", i, errAtomicPublishRollup)
+		}
+		if msgId := getMsgId(m.Header); msgId != _EMPTY_ {
+			if _, ok := ids[msgId]; ok {
+				return fmt.Errorf("message %d: duplicate message id %q", i, msgId)
+			}
+			ids[msgId] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Returns true if a stream with this configuration stores messages published to the subject.
+func (cfg *StreamConfig) storesSubject(subject string) bool {
+	if cfg.Sharding != nil && !cfg.Sharding.owns(subject) {
+		return false
+	}
+	for _, subj := range cfg.Subjects {
+		if subjectIsSubsetMatch(subject, subj) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the stream that will store messages published to the subject.
+func (jsa *jsAccount) streamForSubject(subject string) *stream {
+	jsa.mu.RLock()
+	defer jsa.mu.RUnlock()
+
+	for _, mset := range jsa.streams {
+		mset.mu.RLock()
+		stores := mset.cfg.storesSubject(subject)
+		mset.mu.RUnlock()
+		if stores {
+			return mset
+		}
+	}
+	return nil
+}
+
+// Returns the name of the stream assigned to store messages published to the subject.
+// Lock should be held.
+func (js *jetStream) streamNameForSubject(accName, subject string) string {
+	for name, sa := range js.cluster.streams[accName] {
+		if sa.Config != nil && sa.Config.storesSubject(subject) {
+			return name
+		}
+	}
+	return _EMPTY_
+}
+
+// atomicPublish will store all messages in their streams or none of them.
+// All streams are locked for the whole time, so others will either see none
+// of the messages or all of them once consumers are signaled.
+// If a message fails to store, all messages stored before it are removed again.
+// Streams whose limits would remove messages to make room for the batch reject
+// it, as removed messages could not be put back.
+// An intent record is kept while storing, should the server go down before all
+// messages are written out those stored are removed when the account recovers.
+// In clustered mode the messages are stored through the groups of their streams
+// instead, see jsClusteredAtomicPublishRequest.
+func (jsa *jsAccount) atomicPublish(msgs []*AtomicMsg, domain string) ([]*PubAck, *ApiError) {
+	pms, apiErr := jsa.checkAtomicPublish(msgs)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return jsa.storeAtomicMsgs(pms, domain)
+}
+
+// Returns the error to fail an atomic publish with, for the message at index i.
+func atomicPublishFailed(i int, name string, err error) *ApiError {
+	if name == _EMPTY_ {
+		return NewJSAtomicPublishFailedError(fmt.Errorf("message %d: %w", i, err))
+	}
+	return NewJSAtomicPublishFailedError(fmt.Errorf("message %d on stream %q: %w", i, name, err))
+}
+
+// The message that failed an atomic publish is rejected like any other published message.
+// Only the leader counts the rejection, replicas store the same messages.
+func rejectAtomicMsg(pms []*atomicPubMsg, i int, reason int, err error) *ApiError {
+	pm := pms[i]
+	if pm.mset.isLeader() {
+		pm.mset.rejected(reason)
+	}
+	pm.mset.quarantineMsg(pm.subject, pm.hdr, pm.msg, err)
+	return atomicPublishFailed(i, pm.mset.name(), err)
+}
+
+// checkAtomicPublish finds the streams for the messages of an atomic publish, and has
+// the streams check that they take the messages before any of them is stored.
+func (jsa *jsAccount) checkAtomicPublish(msgs []*AtomicMsg) ([]*atomicPubMsg, *ApiError) {
+	pms := make([]*atomicPubMsg, 0, len(msgs))
+	msets := make(map[*stream]struct{})
+	for i, m := range msgs {
+		mset := jsa.streamForSubject(m.Subject)
+		if mset == nil {
+			return nil, atomicPublishFailed(i, _EMPTY_, errAtomicPublishNoStream)
+		}
+		pms = append(pms, newAtomicPubMsg(mset, m))
+		msets[mset] = struct{}{}
+	}
+
+	// Streams need to take the messages at all, and their validators to accept them.
+	for i, pm := range pms {
+		if reason, err := pm.mset.admitInbound(pm.hdr, pm.msg); err != nil {
+			return nil, rejectAtomicMsg(pms, i, reason, err)
+		}
+	}
+	for mset := range msets {
+		if i, err := mset.validateAtomicMsgs(pms); err != nil {
+			return nil, rejectAtomicMsg(pms, i, rejectValidation, err)
+		}
+	}
+	return pms, nil
+}
+
+func newAtomicPubMsg(mset *stream, m *AtomicMsg) *atomicPubMsg {
+	return &atomicPubMsg{mset: mset, subject: m.Subject, hdr: m.Header, msg: m.Data, msgId: getMsgId(m.Header)}
+}
+
+// storeAtomicMsgs stores checked messages of an atomic publish in their streams, or none of them.
+func (jsa *jsAccount) storeAtomicMsgs(pms []*atomicPubMsg, domain string) ([]*PubAck, *ApiError) {
+	reject := func(i int, reason int, err error) *ApiError {
+		return rejectAtomicMsg(pms, i, reason, err)
+	}
+	names := make(map[*stream]string)
+	for _, pm := range pms {
+		names[pm.mset] = pm.mset.name()
+	}
+
+	// Always lock in the same order to not deadlock with other atomic publishes.
+	locked := make([]*stream, 0, len(names))
+	for mset := range names {
+		locked = append(locked, mset)
+	}
+	sort.Slice(locked, func(i, j int) bool { return names[locked[i]] < names[locked[j]] })
+	for _, mset := range locked {
+		mset.mu.Lock()
+	}
+	unlock := func() {
+		for _, mset := range locked {
+			mset.mu.Unlock()
+		}
+	}
+
+	for i, pm := range pms {
+		mset := pm.mset
+		if mset.closed.Load() {
+			unlock()
+			return nil, atomicPublishFailed(i, mset.cfg.Name, errStreamClosed)
+		}
+		if mset.roErr != nil {
+			unlock()
+			return nil, atomicPublishFailed(i, mset.cfg.Name, NewJSStreamStorageReadOnlyError(mset.roErr))
+		}
+		if mset.cfg.Sealed {
+			unlock()
+			return nil, atomicPublishFailed(i, mset.cfg.Name, ApiErrors[JSStreamSealedErr])
+		}
+	}
+
+	// A retry of an atomic publish that was stored before is acknowledged as a duplicate.
+	var ndups int
+	acks := make([]*PubAck, len(pms))
+	for i, pm := range pms {
+		if pm.msgId == _EMPTY_ {
+			continue
+		}
+		if dde := pm.mset.checkMsgId(pm.msgId); dde != nil {
+			acks[i] = &PubAck{Stream: pm.mset.cfg.Name, Sequence: dde.seq, Domain: domain, Duplicate: true}
+			ndups++
+		}
+	}
+	if ndups == len(pms) {
+		unlock()
+		return acks, nil
+	} else if ndups > 0 {
+		for i, ack := range acks {
+			if ack != nil {
+				unlock()
+				return nil, atomicPublishFailed(i, ack.Stream, errAtomicPublishDup)
+			}
+		}
+	}
+
+	// Have the messages as they will be stored checked first.
+	for i, pm := range pms {
+		if reason, err := pm.mset.prepareAtomicMsg(pm); err != nil {
+			unlock()
+			return nil, reject(i, reason, err)
+		}
+	}
+	checked := make(map[*stream]struct{}, len(locked))
+	for i, pm := range pms {
+		if _, ok := checked[pm.mset]; ok {
+			continue
+		}
+		checked[pm.mset] = struct{}{}
+		if err := pm.mset.checkAtomicLimits(pms); err != nil {
+			unlock()
+			return nil, atomicPublishFailed(i, pm.mset.cfg.Name, err)
+		}
+	}
+
+	// Remember where the streams were to be able to roll back.
+	lmsgIds := make(map[*stream]string, len(locked))
+	for _, mset := range locked {
+		lmsgIds[mset] = mset.lmsgId
+	}
+	rollback := func() {
+		for i := len(pms) - 1; i >= 0; i-- {
+			if pm := pms[i]; pm.stored {
+				pm.mset.store.RemoveMsg(pm.seq)
+			}
+		}
+		for _, mset := range locked {
+			var state StreamState
+			mset.store.FastState(&state)
+			mset.lseq, mset.lmsgId = state.LastSeq, lmsgIds[mset]
+		}
+		// The intent only covers the messages just removed, so is safe to leave behind.
+		if err := jsa.clearAtomicIntent(locked); err != nil {
+			jsa.js.srv.Warnf("Failed to clear intent of atomic publish on account %q: %v", jsa.account.Name, err)
+		}
+	}
+
+	if err := jsa.writeAtomicIntent(pms, locked); err != nil {
+		unlock()
+		return nil, NewJSAtomicPublishFailedError(err)
+	}
+	for i, pm := range pms {
+		mset := pm.mset
+		if reason, err := mset.storeAtomicMsg(pm); err != nil {
+			rollback()
+			unlock()
+			return nil, reject(i, reason, err)
+		}
+		acks[i] = &PubAck{Stream: mset.cfg.Name, Sequence: pm.seq, Domain: domain}
+	}
+	// Only acknowledge once all messages are written out and the intent is gone.
+	if err := jsa.clearAtomicIntent(locked); err != nil {
+		rollback()
+		unlock()
+		return nil, NewJSAtomicPublishFailedError(err)
+	}
+
+	// Everything is stored, so make it known.
+	numConsumers := make(map[*stream]int, len(locked))
+	for _, mset := range locked {
+		numConsumers[mset] = mset.storedAtomicMsgs(pms)
+	}
+	unlock()
+
+	for _, mset := range locked {
+		mset.signalAtomicMsgs(pms, numConsumers[mset])
+	}
+	return acks, nil
+}
+
+// storedAtomicMsgs records our stored messages of an atomic publish for deduplication
+// and lets push mirrors know. Returns the number of consumers to signal.
+// Lock should be held.
+func (mset *stream) storedAtomicMsgs(pms []*atomicPubMsg) int {
+	for _, pm := range pms {
+		if pm.mset == mset && pm.msgId != _EMPTY_ {
+			mset.storeMsgIdLocked(&ddentry{pm.msgId, pm.seq, pm.ts})
+		}
+	}
+	mset.signalPushMirrors()
+	return len(mset.consumers)
+}
+
+// signalAtomicMsgs republishes our stored messages of an atomic publish and signals our consumers.
+// Lock should not be held.
+func (mset *stream) signalAtomicMsgs(pms []*atomicPubMsg, numConsumers int) {
+	name := mset.name()
+	for _, pm := range pms {
+		if pm.mset != mset || !pm.stored {
+			continue
+		}
+		if pm.tsubj != _EMPTY_ {
+			mset.republishMsg(name, pm.tsubj, pm.subject, pm.hdr, pm.msg, pm.seq, pm.ts, pm.tlseq, pm.thdrsOnly)
+		}
+		if numConsumers > 0 {
+			mset.sigq.push(newCMsg(pm.subject, pm.seq))
+			select {
+			case mset.sch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// writeAtomicIntent records the sequences the messages of an atomic publish will be
+// stored at in the file streams, before any of them is stored.
+// Locks of the streams should be held.
+func (jsa *jsAccount) writeAtomicIntent(pms []*atomicPubMsg, locked []*stream) error {
+	var intent atomicIntent
+	for _, mset := range locked {
+		if mset.stype != FileStorage {
+			continue
+		}
+		var n uint64
+		for _, pm := range pms {
+			if pm.mset == mset {
+				n++
+			}
+		}
+		var state StreamState
+		mset.store.FastState(&state)
+		intent.Streams = append(intent.Streams, atomicIntentRange{mset.cfg.Name, state.LastSeq + 1, state.LastSeq + n})
+	}
+	if len(intent.Streams) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(&intent)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(jsa.storeDir, atomicIntentFile), b)
+}
+
+// clearAtomicIntent writes out what the file streams of an atomic publish stored,
+// after which its intent record is removed.
+// Locks of the streams should be held.
+func (jsa *jsAccount) clearAtomicIntent(locked []*stream) error {
+	var flushed bool
+	for _, mset := range locked {
+		if fs, ok := mset.store.(*fileStore); ok {
+			if err := fs.flushPending(); err != nil {
+				return err
+			}
+			flushed = true
+		}
+	}
+	if !flushed {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(jsa.storeDir, atomicIntentFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// recoverAtomicPublish removes the messages of an atomic publish the server went
+// down in the middle of. Called once the streams of the account are recovered.
+func (jsa *jsAccount) recoverAtomicPublish() {
+	fn := filepath.Join(jsa.storeDir, atomicIntentFile)
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return
+	}
+	s := jsa.js.srv
+	var intent atomicIntent
+	if err := json.Unmarshal(b, &intent); err != nil {
+		s.Warnf("  Error unmarshalling intent of atomic publish %q: %v", fn, err)
+		return
+	}
+	for _, r := range intent.Streams {
+		jsa.mu.RLock()
+		mset := jsa.streams[r.Stream]
+		jsa.mu.RUnlock()
+		if mset == nil {
+			continue
+		}
+		var removed int
+		for seq := r.FirstSeq; seq <= r.LastSeq; seq++ {
+			if ok, _ := mset.store.RemoveMsg(seq); ok {
+				removed++
+			}
+		}
+		if fs, ok := mset.store.(*fileStore); ok {
+			if err := fs.flushPending(); err != nil {
+				s.Warnf("  Error removing messages of atomic publish from stream '%s > %s': %v", mset.accName(), r.Stream, err)
+				return
+			}
+		}
+		if removed > 0 {
+			s.Noticef("  Removed %d messages of an interrupted atomic publish from stream '%s > %s'", removed, mset.accName(), r.Stream)
+		}
+	}
+	os.Remove(fn)
+}
+
+// validateAtomicMsgs has our validator, if any, check our messages of an atomic publish.
+// Returns the index of the first message rejected and why.
+func (mset *stream) validateAtomicMsgs(pms []*atomicPubMsg) (int, error) {
+	sv := mset.validator.Load()
+	if sv == nil {
+		return 0, nil
+	}
+	var idx []int
+	var ims []*inMsg
+	for i, pm := range pms {
+		if pm.mset == mset {
+			idx = append(idx, i)
+			ims = append(ims, &inMsg{subj: pm.subject, hdr: pm.hdr, msg: pm.msg})
+		}
+	}
+
+	mset.mu.RLock()
+	s, acc, qch := mset.srv, mset.acc, mset.qch
+	mset.mu.RUnlock()
+	c := s.createInternalJetStreamClient()
+	c.registerWithAccount(acc)
+	defer c.closeConnection(ClientClosed)
+
+	for i, err := range sv.validate(mset, c, ims, qch) {
+		if err != nil {
+			return idx[i], err
+		}
+	}
+	return 0, nil
+}
+
+// prepareAtomicMsg turns a message of an atomic publish into what will be
+// stored, and checks it the same as any published message.
+// Lock should be held.
+func (mset *stream) prepareAtomicMsg(pm *atomicPubMsg) (int, error) {
+	if len(pm.hdr) > 0 {
+		pm.hdr = mset.processClientInfoHdr(copyBytes(pm.hdr))
+	}
+	// Apply the input subject transform if any.
+	if mset.itr != nil {
+		if ts, err := mset.itr.Match(pm.subject); err == nil {
+			pm.subject = ts
+		}
+	}
+	var reason int
+	var apiErr *ApiError
+	if pm.hdr, pm.msg, reason, apiErr = mset.checkInboundMsg(pm.subject, pm.hdr, pm.msg, false, false); apiErr != nil {
+		return reason, apiErr
+	}
+	return 0, nil
+}
+
+// checkAtomicLimits returns an error if storing our messages of an atomic publish would
+// remove messages to stay within our limits, as those could not be restored on a rollback.
+// Lock should be held.
+func (mset *stream) checkAtomicLimits(pms []*atomicPubMsg) error {
+	cfg, store := &mset.cfg, mset.store
+	discardOld := cfg.Discard == DiscardOld
+	if cfg.MaxBlocks > 0 && discardOld {
+		return errAtomicPublishLimits
+	}
+
+	var msgs, nbytes uint64
+	subjects := make(map[string]uint64)
+	for _, pm := range pms {
+		if pm.mset != mset {
+			continue
+		}
+		msgs++
+		if mset.stype == FileStorage {
+			nbytes += fileStoreMsgSize(pm.subject, pm.hdr, pm.msg)
+		} else {
+			nbytes += memStoreMsgSize(pm.subject, pm.hdr, pm.msg)
+		}
+		subjects[pm.subject]++
+	}
+	if msgs == 0 {
+		return nil
+	}
+
+	var state StreamState
+	store.FastState(&state)
+	if discardOld && cfg.MaxMsgs > 0 && state.Msgs+msgs > uint64(cfg.MaxMsgs) {
+		return errAtomicPublishLimits
+	}
+	if discardOld && cfg.MaxBytes > 0 && state.Bytes+nbytes > uint64(cfg.MaxBytes) {
+		return errAtomicPublishLimits
+	}
+	if cfg.MaxMsgsPer > 0 && !(cfg.Discard == DiscardNew && cfg.DiscardNewPer) {
+		for subj, n := range subjects {
+			if store.SubjectsTotals(subj)[subj]+n > uint64(cfg.MaxMsgsPer) {
+				return errAtomicPublishLimits
+			}
+		}
+	}
+	for _, sl := range cfg.SubjectLimits {
+		var n uint64
+		for subj, sn := range subjects {
+			if subjectIsSubsetMatch(subj, sl.Filter) {
+				n += sn
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		for _, total := range store.SubjectsTotals(sl.Filter) {
+			n += total
+		}
+		if n > uint64(sl.MaxMsgs) {
+			return errAtomicPublishLimits
+		}
+	}
+	return nil
+}
+
+// storeAtomicMsg checks a prepared message of an atomic publish against the
+// expectations in its headers and our limits, and will store it.
+// Returns the reason and error to reject the message with if it can not be stored.
+// Lock should be held.
+func (mset *stream) storeAtomicMsg(pm *atomicPubMsg) (int, error) {
+	if reason, err := mset.checkAtomicMsg(pm, mset.lseq, mset.lmsgId, nil); err != nil {
+		return reason, err
+	}
+	return mset.writeAtomicMsg(pm)
+}
+
+// checkAtomicMsg checks a prepared message of an atomic publish against the expectations
+// in its headers and our limits. The last sequence and message ID are where we will be at
+// when the message is stored, and lseqs holds the last sequences of subjects that messages
+// of the same publish not stored yet will take.
+// Lock should be held.
+func (mset *stream) checkAtomicMsg(pm *atomicPubMsg, lseq uint64, lmsgId string, lseqs map[string]uint64) (int, error) {
+	store, subject, hdr, msg := mset.store, pm.subject, pm.hdr, pm.msg
+
+	if len(hdr) > 0 {
+		if sname := getExpectedStream(hdr); sname != _EMPTY_ && sname != mset.cfg.Name {
+			return rejectOther, NewJSStreamNotMatchError()
+		}
+		if seq, exists := getExpectedLastSeqPerSubject(hdr); exists {
+			seqSubj := subject
+			if optSubj := getExpectedLastSeqPerSubjectForSubject(hdr); optSubj != _EMPTY_ {
+				seqSubj = optSubj
+			}
+			if fseq, ok := lseqs[seqSubj]; ok {
+				if fseq != seq {
+					return rejectWrongLastSeq, NewJSStreamWrongLastSequenceError(fseq)
+				}
+			} else {
+				var smv StoreMsg
+				var fseq uint64
+				sm, err := store.LoadLastMsg(seqSubj, &smv)
+				if sm != nil {
+					fseq = sm.seq
+				}
+				if err == ErrStoreMsgNotFound && seq == 0 {
+					fseq, err = 0, nil
+				}
+				if err != nil || fseq != seq {
+					return rejectWrongLastSeq, NewJSStreamWrongLastSequenceError(fseq)
+				}
+			}
+		}
+		if seq, exists := getExpectedLastSeq(hdr); exists && seq != lseq {
+			return rejectWrongLastSeq, NewJSStreamWrongLastSequenceError(lseq)
+		}
+		if elmsgId := getExpectedLastMsgId(hdr); elmsgId != _EMPTY_ {
+			if lmsgId == _EMPTY_ && lseqs == nil && !mset.ddloaded {
+				mset.rebuildDedupe()
+				lmsgId = mset.lmsgId
+			}
+			if elmsgId != lmsgId {
+				return rejectWrongLastMsgId, NewJSStreamWrongLastMsgIDError(lmsgId)
+			}
+		}
+	}
+
+	if mset.js.limitsExceeded(mset.stype) {
+		return rejectLimits, NewJSInsufficientResourcesError()
+	}
+	if exceeded, err := mset.jsa.wouldExceedLimits(mset.stype, mset.tier, mset.cfg.Replicas, subject, hdr, msg); exceeded {
+		if err == nil {
+			err = NewJSAccountResourcesExceededError()
+		}
+		return rejectLimits, err
+	}
+	return 0, nil
+}
+
+// writeAtomicMsg stores a checked message of an atomic publish.
+// Lock should be held.
+func (mset *stream) writeAtomicMsg(pm *atomicPubMsg) (int, error) {
+	store, subject, hdr, msg := mset.store, pm.subject, pm.hdr, pm.msg
+
+	// If we are interest based retention and have no consumers then we can skip.
+	if mset.cfg.Retention == InterestPolicy {
+		mset.clsMu.RLock()
+		noInterest := len(mset.consumers) == 0 || mset.csl == nil || !mset.csl.HasInterest(subject)
+		mset.clsMu.RUnlock()
+		if noInterest {
+			pm.seq, pm.ts = store.SkipMsg(), time.Now().UnixNano()
+			mset.lseq, mset.lmsgId = pm.seq, pm.msgId
+			return 0, nil
+		}
+	}
+
+	if mset.tr != nil {
+		pm.tsubj, _ = mset.tr.Match(subject)
+		if mset.cfg.RePublish != nil {
+			pm.thdrsOnly = mset.cfg.RePublish.HeadersOnly
+		}
+		if pm.tsubj != _EMPTY_ {
+			var smv StoreMsg
+			if sm, _ := store.LoadLastMsg(subject, &smv); sm != nil {
+				pm.tlseq = sm.seq
+			}
+		}
+	}
+
+	seq, ts, err := store.StoreMsg(subject, hdr, msg)
+	if err != nil {
+		return storeErrRejectReason(err), NewJSStreamStoreFailedError(err, Unless(err))
+	}
+	pm.seq, pm.ts, pm.stored = seq, ts, true
+	mset.lseq, mset.lmsgId = seq, pm.msgId
+	return 0, nil
+}
+
+// Request to store messages in one or more streams atomically.
+func (s *Server) jsStreamAtomicPublishRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamAtomicPublishResponse{ApiResponse: ApiResponse{Type: JSApiStreamAtomicPublishResponseType}}
+
+	// In clustered mode the leader of the stream answers once the messages are proposed,
+	// and the meta leader answers requests that do not get that far.
+	isClustered := s.JetStreamIsClustered()
+	canRespond := !isClustered || s.JetStreamIsLeader()
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr && canRespond {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamAtomicPublishRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		if canRespond {
+			resp.Error = NewJSInvalidJSONError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if err := req.validate(); err != nil {
+		if canRespond {
+			resp.Error = NewJSAtomicPublishInvalidError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if isClustered {
+		s.jsClusteredAtomicPublishRequest(ci, acc, subject, reply, msg, req.Messages, canRespond)
+		return
+	}
+
+	acc.mu.RLock()
+	jsa := acc.js
+	acc.mu.RUnlock()
+	if jsa == nil {
+		resp.Error = NewJSNotEnabledForAccountError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	acks, apiErr := jsa.atomicPublish(req.Messages, s.getOpts().JetStreamDomain)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Acks = acks
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
+
+// streamAtomicPublish is what the stream leader replicates for an atomic publish.
+type streamAtomicPublish struct {
+	Client *ClientInfo `json:"client,omitempty"`
+	Stream string      `json:"stream"`
+	// Last is the sequence the leader expected the stream at, including failed proposals.
+	Last     uint64       `json:"last"`
+	Messages []*AtomicMsg `json:"msgs"`
+	Subject  string       `json:"subject"`
+	Reply    string       `json:"reply"`
+}
+
+func encodeStreamAtomicPublish(ap *streamAtomicPublish) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(atomicPublishOp))
+	json.NewEncoder(&bb).Encode(ap)
+	return bb.Bytes()
+}
+
+func decodeStreamAtomicPublish(buf []byte) (*streamAtomicPublish, error) {
+	var ap streamAtomicPublish
+	err := json.Unmarshal(buf, &ap)
+	return &ap, err
+}
+
+// In clustered mode the messages of an atomic publish to a single stream are checked by
+// its leader and proposed as a single entry, which every replica applies as a whole.
+// An atomic publish to more than one stream is coordinated by the meta group instead,
+// see jsClusteredAtomicTxnRequest.
+func (s *Server) jsClusteredAtomicPublishRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, msgs []*AtomicMsg, isMetaLeader bool) {
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+
+	var resp = JSApiStreamAtomicPublishResponse{ApiResponse: ApiResponse{Type: JSApiStreamAtomicPublishResponseType}}
+
+	// We may not be part of the group of the stream, so look at the assignments.
+	js.mu.RLock()
+	var stream string
+	var multiple bool
+	var apiErr *ApiError
+	streams := make([]string, 0, len(msgs))
+	for i, m := range msgs {
+		name := js.streamNameForSubject(acc.Name, m.Subject)
+		if name == _EMPTY_ {
+			apiErr = atomicPublishFailed(i, _EMPTY_, errAtomicPublishNoStream)
+			break
+		}
+		if stream != _EMPTY_ && name != stream {
+			multiple = true
+		}
+		stream = name
+		streams = append(streams, name)
+	}
+	var sa *streamAssignment
+	if apiErr == nil {
+		sa = js.streamAssignment(acc.Name, stream)
+	}
+	js.mu.RUnlock()
+
+	if apiErr != nil {
+		if isMetaLeader {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if multiple {
+		if isMetaLeader {
+			s.jsClusteredAtomicTxnRequest(ci, acc, subject, reply, rmsg, msgs, streams)
+		}
+		return
+	}
+	if js.isGroupLeaderless(sa.Group) {
+		if isMetaLeader {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	// We have the stream assigned and a leader, so only the stream leader should answer.
+	if !acc.JetStreamIsStreamLeader(stream) {
+		return
+	}
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+	node := mset.raftNode()
+	if node == nil {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Our validators and limits check the messages before they are proposed.
+	pms := make([]*atomicPubMsg, 0, len(msgs))
+	for _, m := range msgs {
+		pms = append(pms, newAtomicPubMsg(mset, m))
+	}
+	for i, pm := range pms {
+		if reason, err := mset.admitInbound(pm.hdr, pm.msg); err != nil {
+			resp.Error = rejectAtomicMsg(pms, i, reason, err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+	}
+	if i, err := mset.validateAtomicMsgs(pms); err != nil {
+		resp.Error = rejectAtomicMsg(pms, i, rejectValidation, err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Every message takes a sequence, so stamp where the stream is expected at
+	// and move past the messages for the ones proposed after us.
+	mset.clMu.Lock()
+	if mset.atxnLock != _EMPTY_ {
+		mset.clMu.Unlock()
+		resp.Error = NewJSAtomicPublishInProgressError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+	if last := mset.lastSeq() + mset.clfs; mset.clseq < last {
+		mset.clseq = last
+	}
+	ap := &streamAtomicPublish{Client: ci, Stream: stream, Last: mset.clseq, Messages: msgs, Subject: subject, Reply: reply}
+	err = node.Propose(encodeStreamAtomicPublish(ap))
+	if err == nil {
+		mset.clseq += uint64(len(msgs))
+	}
+	mset.clMu.Unlock()
+
+	if err != nil {
+		resp.Error = NewJSAtomicPublishFailedError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+	}
+}
+
+// Applies a replicated atomic publish, storing all of its messages or none of them.
+// The sequences of messages not stored are accounted as failed proposals, so the
+// sequences the leader expects for the messages proposed after it still line up.
+func (mset *stream) applyAtomicPublish(buf []byte, isRecovering bool) {
+	s := mset.srv
+	ap, err := decodeStreamAtomicPublish(buf)
+	if err != nil {
+		if node := mset.raftNode(); node != nil {
+			s.Errorf("JetStream cluster could not decode atomic publish for '%s > %s' [%s]",
+				mset.account(), mset.name(), node.Group())
+		}
+		panic(err.Error())
+	}
+
+	last, clfs := mset.lastSeqAndCLFS()
+	// We can skip if we know this was applied already.
+	if ap.Last-clfs < last {
+		return
+	}
+
+	var acks []*PubAck
+	var apiErr *ApiError
+	n := uint64(len(ap.Messages))
+	if last+clfs != ap.Last {
+		apiErr = ApiErrors[JSStreamSequenceNotMatchErr]
+	} else if jsa := mset.jsa; jsa == nil {
+		apiErr = NewJSNotEnabledForAccountError()
+	} else {
+		pms := make([]*atomicPubMsg, 0, n)
+		for _, m := range ap.Messages {
+			pms = append(pms, newAtomicPubMsg(mset, m))
+		}
+		acks, apiErr = jsa.storeAtomicMsgs(pms, s.getOpts().JetStreamDomain)
+	}
+	// Messages that were not stored, or stored and removed again, take no sequence.
+	if used := mset.lastSeq() - last; used < n {
+		mset.setCLFS(clfs + n - used)
+	}
+
+	if isRecovering || !mset.isLeader() {
+		return
+	}
+	var resp = JSApiStreamAtomicPublishResponse{ApiResponse: ApiResponse{Type: JSApiStreamAtomicPublishResponseType}}
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ap.Client, mset.account(), ap.Subject, ap.Reply, _EMPTY_, s.jsonResponse(resp))
+	} else {
+		resp.Acks = acks
+		s.sendAPIResponse(ap.Client, mset.account(), ap.Subject, ap.Reply, _EMPTY_, s.jsonResponse(resp))
+	}
+}
@@ -0,0 +1,877 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Replicated streams each commit through their own group, so in clustered mode an
+// atomic publish to more than one stream is coordinated by the meta group:
+//
+//  1. The meta leader proposes the publish to begin.
+//  2. The leader of every stream involved proposes its messages to its group to be prepared.
+//     Applying that checks the messages would be stored, and from then on the leader holds
+//     back any other message for the stream until the publish is resolved.
+//  3. The stream leaders vote on the outcome through the meta group, and the meta leader
+//     proposes to commit once all streams are prepared, or to abort as soon as one is not.
+//  4. The stream leaders propose to store the prepared messages or drop them, and report
+//     back when done. The meta leader answers the request once every stream is done.
+//
+// The meta leader re-drives publishes that do not make progress, and aborts those not
+// prepared in time. Snapshots are held off while a publish is pending, so it is replayed
+// from the log on recovery.
+
+const (
+	// How long streams have to prepare, and the meta leader waits before re-driving a decision.
+	atomicTxnTimeout = 10 * time.Second
+)
+
+var (
+	errAtomicPublishTimeout = errors.New("timed out waiting for streams to prepare")
+	errAtomicPublishRemoved = errors.New("stream was removed")
+)
+
+// Steps of an atomic publish across streams in the meta group.
+type atomicTxnStep uint8
+
+const (
+	atomicTxnBegin atomicTxnStep = iota
+	atomicTxnVote
+	atomicTxnCommit
+	atomicTxnAbort
+	atomicTxnDone
+)
+
+// atomicTxnUpdate is what is proposed to the meta group for a step of an atomic publish across streams.
+type atomicTxnUpdate struct {
+	Step atomicTxnStep `json:"step"`
+	ID   string        `json:"id"`
+	// Set when the publish begins.
+	Account  string       `json:"account,omitempty"`
+	Client   *ClientInfo  `json:"client,omitempty"`
+	Subject  string       `json:"subject,omitempty"`
+	Reply    string       `json:"reply,omitempty"`
+	Messages []*AtomicMsg `json:"msgs,omitempty"`
+	Streams  []string     `json:"streams,omitempty"`
+	// Set by a stream voting or done.
+	Stream string    `json:"stream,omitempty"`
+	Seqs   []uint64  `json:"seqs,omitempty"`
+	Dup    bool      `json:"dup,omitempty"`
+	Error  *ApiError `json:"error,omitempty"`
+}
+
+func encodeAtomicTxnUpdate(tu *atomicTxnUpdate) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(atomicTxnOp))
+	json.NewEncoder(&bb).Encode(tu)
+	return bb.Bytes()
+}
+
+func decodeAtomicTxnUpdate(buf []byte) (*atomicTxnUpdate, error) {
+	var tu atomicTxnUpdate
+	err := json.Unmarshal(buf, &tu)
+	return &tu, err
+}
+
+// atomicTxn is the state of an atomic publish across streams in the meta group.
+type atomicTxn struct {
+	begin   *atomicTxnUpdate
+	votes   map[string]*atomicTxnUpdate
+	done    map[string]*atomicTxnUpdate
+	decided bool
+	commit  bool
+	err     *ApiError
+	// Only used by the meta leader.
+	timer *time.Timer
+}
+
+// Returns the streams of the publish, in the order of their first message.
+func (tu *atomicTxnUpdate) streams() []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, name := range tu.Streams {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the messages of the publish for the stream, along with their index in the publish.
+func (tu *atomicTxnUpdate) streamMsgs(stream string) ([]*AtomicMsg, []int) {
+	var msgs []*AtomicMsg
+	var idx []int
+	for i, name := range tu.Streams {
+		if name == stream {
+			msgs = append(msgs, tu.Messages[i])
+			idx = append(idx, i)
+		}
+	}
+	return msgs, idx
+}
+
+// decide returns the decision to propose once the votes allow for one.
+func (txn *atomicTxn) decide() *atomicTxnUpdate {
+	streams := txn.begin.streams()
+	var ndups int
+	for _, name := range streams {
+		if v := txn.votes[name]; v != nil && v.Error != nil {
+			return &atomicTxnUpdate{Step: atomicTxnAbort, ID: txn.begin.ID, Error: v.Error}
+		} else if v != nil && v.Dup {
+			ndups++
+		}
+	}
+	if len(txn.votes) < len(streams) {
+		return nil
+	}
+	// A retry is only acknowledged as a duplicate when stored in all streams before.
+	if ndups > 0 && ndups < len(streams) {
+		for i, name := range txn.begin.Streams {
+			if txn.votes[name].Dup {
+				return &atomicTxnUpdate{Step: atomicTxnAbort, ID: txn.begin.ID, Error: atomicPublishFailed(i, name, errAtomicPublishDup)}
+			}
+		}
+	}
+	return &atomicTxnUpdate{Step: atomicTxnCommit, ID: txn.begin.ID}
+}
+
+// acks returns the acks for a committed publish once every stream is done.
+func (txn *atomicTxn) acks(domain string) ([]*PubAck, *ApiError) {
+	acks := make([]*PubAck, len(txn.begin.Messages))
+	next := make(map[string]int)
+	for i, name := range txn.begin.Streams {
+		d := txn.done[name]
+		if d.Error != nil {
+			return nil, d.Error
+		}
+		k := next[name]
+		if k >= len(d.Seqs) {
+			return nil, atomicPublishFailed(i, name, errAtomicPublishRemoved)
+		}
+		next[name]++
+		acks[i] = &PubAck{Stream: name, Sequence: d.Seqs[k], Domain: domain, Duplicate: d.Dup}
+	}
+	return acks, nil
+}
+
+// jsClusteredAtomicTxnRequest has the meta group coordinate an atomic publish to more than one stream.
+// Should only be called by the meta leader.
+func (s *Server) jsClusteredAtomicTxnRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, msgs []*AtomicMsg, streams []string) {
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+
+	var resp = JSApiStreamAtomicPublishResponse{ApiResponse: ApiResponse{Type: JSApiStreamAtomicPublishResponseType}}
+
+	tu := &atomicTxnUpdate{
+		Step:     atomicTxnBegin,
+		ID:       nuid.Next(),
+		Account:  acc.Name,
+		Client:   ci,
+		Subject:  subject,
+		Reply:    reply,
+		Messages: msgs,
+		Streams:  streams,
+	}
+
+	// Every stream needs a leader to prepare its messages.
+	js.mu.RLock()
+	var groups []*raftGroup
+	for _, name := range tu.streams() {
+		if sa := js.streamAssignment(acc.Name, name); sa != nil {
+			groups = append(groups, sa.Group)
+		}
+	}
+	meta := cc.meta
+	js.mu.RUnlock()
+	for _, rg := range groups {
+		if js.isGroupLeaderless(rg) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	if err := meta.Propose(encodeAtomicTxnUpdate(tu)); err != nil {
+		resp.Error = NewJSAtomicPublishFailedError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+	}
+}
+
+// proposeAtomicTxn proposes a step of an atomic publish across streams to the meta group,
+// forwarding it to the meta leader if we are not.
+func (js *jetStream) proposeAtomicTxn(tu *atomicTxnUpdate) {
+	js.mu.RLock()
+	cc := js.cluster
+	if cc == nil || cc.meta == nil {
+		js.mu.RUnlock()
+		return
+	}
+	meta, isLeader := cc.meta, cc.isLeader()
+	js.mu.RUnlock()
+
+	if isLeader {
+		meta.Propose(encodeAtomicTxnUpdate(tu))
+	} else {
+		meta.ForwardProposal(encodeAtomicTxnUpdate(tu))
+	}
+}
+
+// processAtomicTxn applies a step of an atomic publish across streams.
+func (js *jetStream) processAtomicTxn(tu *atomicTxnUpdate, isRecovering bool) {
+	js.mu.Lock()
+	s, cc := js.srv, js.cluster
+	if cc == nil {
+		js.mu.Unlock()
+		return
+	}
+	txn := cc.atomicTxns[tu.ID]
+	isLeader := cc.isLeader() && !isRecovering
+
+	switch tu.Step {
+	case atomicTxnBegin:
+		if txn != nil {
+			js.mu.Unlock()
+			return
+		}
+		txn = &atomicTxn{begin: tu, votes: make(map[string]*atomicTxnUpdate), done: make(map[string]*atomicTxnUpdate)}
+		if cc.atomicTxns == nil {
+			cc.atomicTxns = make(map[string]*atomicTxn)
+		}
+		cc.atomicTxns[tu.ID] = txn
+		if isLeader {
+			js.scheduleAtomicTxnCheck(txn)
+		}
+		js.mu.Unlock()
+
+		if !isRecovering {
+			for _, mset := range js.atomicTxnStreamsLed(tu) {
+				mset := mset
+				s.startGoRoutine(func() {
+					defer s.grWG.Done()
+					mset.proposeAtomicPrepare(tu)
+				})
+			}
+		}
+
+	case atomicTxnVote:
+		if txn == nil || txn.decided {
+			js.mu.Unlock()
+			return
+		}
+		txn.votes[tu.Stream] = tu
+		var decision *atomicTxnUpdate
+		if isLeader {
+			decision = txn.decide()
+		}
+		meta := cc.meta
+		js.mu.Unlock()
+
+		if decision != nil {
+			meta.Propose(encodeAtomicTxnUpdate(decision))
+		}
+
+	case atomicTxnCommit, atomicTxnAbort:
+		if txn == nil {
+			js.mu.Unlock()
+			return
+		}
+		first := !txn.decided
+		if first {
+			txn.decided, txn.commit, txn.err = true, tu.Step == atomicTxnCommit, tu.Error
+		}
+		if isLeader {
+			js.scheduleAtomicTxnCheck(txn)
+		}
+		commit, apiErr := txn.commit, txn.err
+		js.mu.Unlock()
+
+		// An aborted publish is answered right away, a committed one once stored everywhere.
+		if first && isLeader && !commit {
+			js.respondAtomicTxn(txn.begin, nil, apiErr)
+		}
+		if !isRecovering {
+			for _, mset := range js.atomicTxnStreamsLed(txn.begin) {
+				mset.proposeAtomicResolve(tu.ID, commit)
+			}
+		}
+
+	case atomicTxnDone:
+		if txn == nil || !txn.decided || txn.done[tu.Stream] != nil {
+			js.mu.Unlock()
+			return
+		}
+		txn.done[tu.Stream] = tu
+		if len(txn.done) < len(txn.begin.streams()) {
+			js.mu.Unlock()
+			return
+		}
+		delete(cc.atomicTxns, tu.ID)
+		if txn.timer != nil {
+			txn.timer.Stop()
+		}
+		js.mu.Unlock()
+
+		if isLeader && txn.commit {
+			acks, apiErr := txn.acks(s.getOpts().JetStreamDomain)
+			js.respondAtomicTxn(txn.begin, acks, apiErr)
+		}
+	}
+}
+
+// Returns the streams of an atomic publish across streams that we are the leader of.
+func (js *jetStream) atomicTxnStreamsLed(tu *atomicTxnUpdate) []*stream {
+	acc, err := js.srv.LookupAccount(tu.Account)
+	if err != nil {
+		return nil
+	}
+	var msets []*stream
+	for _, name := range tu.streams() {
+		if !acc.JetStreamIsStreamLeader(name) {
+			continue
+		}
+		if mset, err := acc.lookupStream(name); err == nil {
+			msets = append(msets, mset)
+		}
+	}
+	return msets
+}
+
+// Answers the request of an atomic publish across streams.
+func (js *jetStream) respondAtomicTxn(tu *atomicTxnUpdate, acks []*PubAck, apiErr *ApiError) {
+	s := js.srv
+	acc, err := s.LookupAccount(tu.Account)
+	if err != nil {
+		return
+	}
+	var resp = JSApiStreamAtomicPublishResponse{ApiResponse: ApiResponse{Type: JSApiStreamAtomicPublishResponseType}}
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(tu.Client, acc, tu.Subject, tu.Reply, _EMPTY_, s.jsonResponse(&resp))
+	} else {
+		resp.Acks = acks
+		s.sendAPIResponse(tu.Client, acc, tu.Subject, tu.Reply, _EMPTY_, s.jsonResponse(&resp))
+	}
+}
+
+// scheduleAtomicTxnCheck has the meta leader check on the atomic publish in a while.
+// Lock should be held.
+func (js *jetStream) scheduleAtomicTxnCheck(txn *atomicTxn) {
+	if txn.timer != nil {
+		txn.timer.Reset(atomicTxnTimeout)
+		return
+	}
+	id := txn.begin.ID
+	txn.timer = time.AfterFunc(atomicTxnTimeout, func() { js.checkAtomicTxn(id) })
+}
+
+// scheduleAtomicTxnChecks has a new meta leader check on all pending atomic publishes.
+// Lock should be held.
+func (js *jetStream) scheduleAtomicTxnChecks() {
+	for _, txn := range js.cluster.atomicTxns {
+		js.scheduleAtomicTxnCheck(txn)
+	}
+}
+
+// checkAtomicTxn aborts an atomic publish that was not prepared in time, and re-drives
+// the decision of one that some streams did not resolve yet.
+func (js *jetStream) checkAtomicTxn(id string) {
+	js.mu.Lock()
+	cc := js.cluster
+	if cc == nil || !cc.isLeader() {
+		js.mu.Unlock()
+		return
+	}
+	txn := cc.atomicTxns[id]
+	if txn == nil {
+		js.mu.Unlock()
+		return
+	}
+	var props []*atomicTxnUpdate
+	if !txn.decided {
+		props = append(props, &atomicTxnUpdate{Step: atomicTxnAbort, ID: id, Error: NewJSAtomicPublishFailedError(errAtomicPublishTimeout)})
+	} else {
+		var redo bool
+		for _, name := range txn.begin.streams() {
+			if txn.done[name] != nil {
+				continue
+			}
+			// A stream removed in the meantime has nothing left to resolve.
+			if js.streamAssignment(txn.begin.Account, name) == nil {
+				props = append(props, &atomicTxnUpdate{Step: atomicTxnDone, ID: id, Stream: name})
+			} else {
+				redo = true
+			}
+		}
+		if redo {
+			step := atomicTxnAbort
+			if txn.commit {
+				step = atomicTxnCommit
+			}
+			props = append(props, &atomicTxnUpdate{Step: step, ID: id, Error: txn.err})
+		}
+	}
+	js.scheduleAtomicTxnCheck(txn)
+	meta := cc.meta
+	js.mu.Unlock()
+
+	for _, tu := range props {
+		meta.Propose(encodeAtomicTxnUpdate(tu))
+	}
+}
+
+// Returns true if atomic publishes across streams are pending, which the meta snapshot does not hold.
+func (js *jetStream) hasAtomicTxns() bool {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	return js.cluster != nil && len(js.cluster.atomicTxns) > 0
+}
+
+// Returns whether the atomic publish is decided and committed, and false for ok if it is unknown.
+func (js *jetStream) atomicTxnDecision(id string) (decided, commit, ok bool) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	if js.cluster == nil {
+		return false, false, false
+	}
+	txn := js.cluster.atomicTxns[id]
+	if txn == nil {
+		return false, false, false
+	}
+	return txn.decided, txn.commit, true
+}
+
+// The messages of an atomic publish across streams a stream is prepared to store.
+type atomicTxnPrepared struct {
+	id  string
+	pms []*atomicPubMsg
+	// Set if all messages were stored before.
+	dup  bool
+	seqs []uint64
+}
+
+// streamAtomicPrepare is what the stream leader replicates to prepare an atomic publish across streams.
+type streamAtomicPrepare struct {
+	ID       string       `json:"id"`
+	Index    []int        `json:"index"`
+	Messages []*AtomicMsg `json:"msgs"`
+}
+
+// streamAtomicResolve is what the stream leader replicates to store or drop prepared messages.
+type streamAtomicResolve struct {
+	ID     string `json:"id"`
+	Commit bool   `json:"commit,omitempty"`
+	// Last is the sequence the leader expected the stream at, including failed proposals.
+	Last uint64 `json:"last"`
+	// Msgs is the number of sequences the leader set aside for the messages.
+	Msgs uint64 `json:"msgs,omitempty"`
+}
+
+func encodeStreamAtomicPrepare(ap *streamAtomicPrepare) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(atomicPrepareOp))
+	json.NewEncoder(&bb).Encode(ap)
+	return bb.Bytes()
+}
+
+func encodeStreamAtomicResolve(ar *streamAtomicResolve) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(atomicResolveOp))
+	json.NewEncoder(&bb).Encode(ar)
+	return bb.Bytes()
+}
+
+// Rejects our message at i of an atomic publish across streams, reporting its index in the publish.
+func rejectAtomicTxnMsg(pms []*atomicPubMsg, idx []int, i int, reason int, err error) *ApiError {
+	rejectAtomicMsg(pms, i, reason, err)
+	return atomicPublishFailed(idx[i], pms[i].mset.name(), err)
+}
+
+// proposeAtomicPrepare checks our messages of an atomic publish across streams the same as
+// for a single stream, and has our group prepare them, or votes to abort if they are not taken.
+// Should only be called by the stream leader.
+func (mset *stream) proposeAtomicPrepare(tu *atomicTxnUpdate) {
+	if !mset.isLeader() {
+		return
+	}
+	js, name, node := mset.js, mset.name(), mset.raftNode()
+	vote := &atomicTxnUpdate{Step: atomicTxnVote, ID: tu.ID, Stream: name}
+	if node == nil {
+		vote.Error = NewJSClusterNotAvailError()
+		js.proposeAtomicTxn(vote)
+		return
+	}
+
+	msgs, idx := tu.streamMsgs(name)
+	pms := make([]*atomicPubMsg, 0, len(msgs))
+	for _, m := range msgs {
+		pms = append(pms, newAtomicPubMsg(mset, m))
+	}
+	for i, pm := range pms {
+		if reason, err := mset.admitInbound(pm.hdr, pm.msg); err != nil {
+			vote.Error = rejectAtomicTxnMsg(pms, idx, i, reason, err)
+			js.proposeAtomicTxn(vote)
+			return
+		}
+	}
+	if i, err := mset.validateAtomicMsgs(pms); err != nil {
+		vote.Error = rejectAtomicTxnMsg(pms, idx, i, rejectValidation, err)
+		js.proposeAtomicTxn(vote)
+		return
+	}
+
+	// Hold back other messages from when we propose, the prepare checks the stream as it will be.
+	mset.clMu.Lock()
+	if mset.atxnLock == tu.ID {
+		mset.clMu.Unlock()
+		return
+	} else if mset.atxnLock != _EMPTY_ {
+		mset.clMu.Unlock()
+		vote.Error = NewJSAtomicPublishInProgressError()
+		js.proposeAtomicTxn(vote)
+		return
+	}
+	err := node.Propose(encodeStreamAtomicPrepare(&streamAtomicPrepare{ID: tu.ID, Index: idx, Messages: msgs}))
+	if err == nil {
+		mset.atxnLock = tu.ID
+	}
+	mset.clMu.Unlock()
+
+	if err != nil {
+		vote.Error = NewJSAtomicPublishFailedError(err)
+		js.proposeAtomicTxn(vote)
+	}
+}
+
+// Applies the prepare of an atomic publish across streams. The leader votes on the outcome.
+func (mset *stream) applyAtomicPrepare(buf []byte, isRecovering bool) {
+	s := mset.srv
+	var ap streamAtomicPrepare
+	if err := json.Unmarshal(buf, &ap); err != nil {
+		if node := mset.raftNode(); node != nil {
+			s.Errorf("JetStream cluster could not decode atomic prepare for '%s > %s' [%s]",
+				mset.account(), mset.name(), node.Group())
+		}
+		panic(err.Error())
+	}
+
+	prep := &atomicTxnPrepared{id: ap.ID, pms: make([]*atomicPubMsg, 0, len(ap.Messages))}
+	for _, m := range ap.Messages {
+		prep.pms = append(prep.pms, newAtomicPubMsg(mset, m))
+	}
+	apiErr := mset.prepareAtomicTxn(prep, ap.Index)
+	if apiErr != nil {
+		mset.clMu.Lock()
+		if mset.atxnLock == ap.ID {
+			mset.atxnLock = _EMPTY_
+		}
+		mset.clMu.Unlock()
+	}
+
+	if isRecovering || !mset.isLeader() {
+		return
+	}
+	js := mset.js
+	js.proposeAtomicTxn(&atomicTxnUpdate{Step: atomicTxnVote, ID: ap.ID, Stream: mset.name(), Dup: prep.dup, Seqs: prep.seqs, Error: apiErr})
+	// The publish may have been decided without waiting for us.
+	if apiErr == nil {
+		if decided, commit, ok := js.atomicTxnDecision(ap.ID); !ok || decided {
+			mset.proposeAtomicResolve(ap.ID, ok && commit)
+		}
+	}
+}
+
+// prepareAtomicTxn checks we would store our messages of an atomic publish across streams,
+// the same as we would for a single stream, and keeps them until the publish is resolved.
+func (mset *stream) prepareAtomicTxn(prep *atomicTxnPrepared, idx []int) *ApiError {
+	var reject bool
+	var reason int
+	i, err := func() (i int, err error) {
+		mset.mu.Lock()
+		defer mset.mu.Unlock()
+
+		if mset.atxn != nil && mset.atxn.id != prep.id {
+			return -1, NewJSAtomicPublishInProgressError()
+		}
+		if mset.closed.Load() {
+			return 0, errStreamClosed
+		}
+		if mset.roErr != nil {
+			return 0, NewJSStreamStorageReadOnlyError(mset.roErr)
+		}
+		if mset.cfg.Sealed {
+			return 0, ApiErrors[JSStreamSealedErr]
+		}
+
+		// A retry of an atomic publish that was stored before is acknowledged as a duplicate.
+		pms, seqs, ndups := prep.pms, make([]uint64, len(prep.pms)), 0
+		for i, pm := range pms {
+			if pm.msgId == _EMPTY_ {
+				continue
+			}
+			if dde := mset.checkMsgId(pm.msgId); dde != nil {
+				seqs[i] = dde.seq
+				ndups++
+			}
+		}
+		if ndups == len(pms) {
+			prep.dup, prep.seqs = true, seqs
+			mset.atxn = prep
+			return 0, nil
+		} else if ndups > 0 {
+			for i, seq := range seqs {
+				if seq > 0 {
+					return i, errAtomicPublishDup
+				}
+			}
+		}
+
+		for i, pm := range pms {
+			if reason, err = mset.prepareAtomicMsg(pm); err != nil {
+				reject = true
+				return i, err
+			}
+		}
+		if err := mset.checkAtomicLimits(pms); err != nil {
+			return 0, err
+		}
+		// Check expectations against where the stream will be at for each message.
+		lseq, lmsgId := mset.lseq, mset.lmsgId
+		if lmsgId == _EMPTY_ && !mset.ddloaded {
+			mset.rebuildDedupe()
+			lmsgId = mset.lmsgId
+		}
+		lseqs := make(map[string]uint64)
+		for i, pm := range pms {
+			if reason, err = mset.checkAtomicMsg(pm, lseq, lmsgId, lseqs); err != nil {
+				reject = true
+				return i, err
+			}
+			lseq, lmsgId = lseq+1, pm.msgId
+			lseqs[pm.subject] = lseq
+		}
+		mset.atxn = prep
+		return 0, nil
+	}()
+
+	if err == nil {
+		return nil
+	} else if reject {
+		return rejectAtomicTxnMsg(prep.pms, idx, i, reason, err)
+	} else if i < 0 {
+		return err.(*ApiError)
+	}
+	return atomicPublishFailed(idx[i], mset.name(), err)
+}
+
+// proposeAtomicResolve has our group store or drop the prepared messages of a decided
+// atomic publish across streams. Reports back as done if we have nothing prepared.
+// Should only be called by the stream leader.
+func (mset *stream) proposeAtomicResolve(id string, commit bool) {
+	if !mset.isLeader() {
+		return
+	}
+	mset.mu.RLock()
+	prep, node := mset.atxn, mset.node
+	mset.mu.RUnlock()
+
+	if prep == nil || prep.id != id {
+		// Our prepare may still have to be applied, which resolves the publish then.
+		mset.clMu.Lock()
+		pending := mset.atxnLock == id
+		mset.clMu.Unlock()
+		if !pending {
+			mset.js.proposeAtomicTxn(&atomicTxnUpdate{Step: atomicTxnDone, ID: id, Stream: mset.name()})
+		}
+		return
+	}
+	if node == nil {
+		return
+	}
+
+	// Every message stored takes a sequence, so stamp where the stream is expected at
+	// and move past the messages for the ones proposed after us.
+	var n uint64
+	if commit && !prep.dup {
+		n = uint64(len(prep.pms))
+	}
+	mset.clMu.Lock()
+	if last := mset.lastSeq() + mset.clfs; mset.clseq < last {
+		mset.clseq = last
+	}
+	ar := &streamAtomicResolve{ID: id, Commit: commit, Last: mset.clseq, Msgs: n}
+	if err := node.Propose(encodeStreamAtomicResolve(ar)); err == nil {
+		mset.clseq += n
+	}
+	mset.clMu.Unlock()
+}
+
+// Applies the resolve of an atomic publish across streams, storing the prepared messages
+// if committed. The sequences not used are accounted as failed proposals, the same as for
+// an atomic publish to a single stream. The leader reports back as done.
+func (mset *stream) applyAtomicResolve(buf []byte, isRecovering bool) {
+	s := mset.srv
+	var ar streamAtomicResolve
+	if err := json.Unmarshal(buf, &ar); err != nil {
+		if node := mset.raftNode(); node != nil {
+			s.Errorf("JetStream cluster could not decode atomic resolve for '%s > %s' [%s]",
+				mset.account(), mset.name(), node.Group())
+		}
+		panic(err.Error())
+	}
+
+	last, clfs := mset.lastSeqAndCLFS()
+	// We can skip storing if we know this was applied already.
+	applied := ar.Last-clfs < last
+
+	var seqs []uint64
+	var apiErr *ApiError
+	var numConsumers int
+	var stored bool
+
+	mset.mu.Lock()
+	prep := mset.atxn
+	if prep != nil && prep.id == ar.ID {
+		mset.atxn = nil
+	} else {
+		prep = nil
+	}
+	if prep != nil && ar.Commit {
+		if prep.dup {
+			seqs = prep.seqs
+		} else if !applied {
+			lmsgId := mset.lmsgId
+			for i, pm := range prep.pms {
+				if _, err := mset.writeAtomicMsg(pm); err != nil {
+					s.Errorf("JetStream failed to store atomic publish %q for '%s > %s': %v", ar.ID, mset.acc.Name, mset.cfg.Name, err)
+					for j := i - 1; j >= 0; j-- {
+						if pm := prep.pms[j]; pm.stored {
+							mset.store.RemoveMsg(pm.seq)
+						}
+					}
+					var state StreamState
+					mset.store.FastState(&state)
+					mset.lseq, mset.lmsgId = state.LastSeq, lmsgId
+					apiErr, seqs = NewJSAtomicPublishFailedError(fmt.Errorf("stream %q: %w", mset.cfg.Name, err)), nil
+					break
+				}
+				seqs = append(seqs, pm.seq)
+			}
+			if apiErr == nil {
+				numConsumers, stored = mset.storedAtomicMsgs(prep.pms), true
+			}
+		}
+	}
+	mset.mu.Unlock()
+
+	if stored {
+		mset.signalAtomicMsgs(prep.pms, numConsumers)
+	}
+	mset.clMu.Lock()
+	if mset.atxnLock == ar.ID {
+		mset.atxnLock = _EMPTY_
+	}
+	mset.clMu.Unlock()
+	// Messages that were not stored take no sequence.
+	if !applied {
+		if used := mset.lastSeq() - last; used < ar.Msgs {
+			mset.setCLFS(clfs + ar.Msgs - used)
+		}
+	}
+
+	if isRecovering || !mset.isLeader() {
+		return
+	}
+	mset.js.proposeAtomicTxn(&atomicTxnUpdate{Step: atomicTxnDone, ID: ar.ID, Stream: mset.name(), Seqs: seqs, Dup: prep != nil && prep.dup, Error: apiErr})
+}
+
+// Returns true if we are prepared for an atomic publish across streams, which our snapshot does not hold.
+func (mset *stream) hasAtomicTxn() bool {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	return mset.atxn != nil
+}
+
+// atomicTxnLeaderChange has a new stream leader hold back messages while we are prepared
+// for an atomic publish across streams, and pick up where the previous leader left off.
+func (mset *stream) atomicTxnLeaderChange(isLeader bool) {
+	mset.mu.RLock()
+	prep, js, s, accName, name := mset.atxn, mset.js, mset.srv, mset.acc.Name, mset.cfg.Name
+	mset.mu.RUnlock()
+
+	mset.clMu.Lock()
+	mset.atxnLock = _EMPTY_
+	if isLeader && prep != nil {
+		mset.atxnLock = prep.id
+	}
+	mset.clMu.Unlock()
+
+	if !isLeader || js == nil {
+		return
+	}
+
+	type pending struct {
+		begin           *atomicTxnUpdate
+		decided, commit bool
+		voted           bool
+	}
+	var txns []pending
+	var known bool
+	js.mu.RLock()
+	if cc := js.cluster; cc != nil {
+		for _, txn := range cc.atomicTxns {
+			if txn.begin.Account != accName {
+				continue
+			}
+			if msgs, _ := txn.begin.streamMsgs(name); len(msgs) == 0 {
+				continue
+			}
+			if prep != nil && prep.id == txn.begin.ID {
+				known = true
+			}
+			txns = append(txns, pending{txn.begin, txn.decided, txn.commit, txn.votes[name] != nil})
+		}
+	}
+	js.mu.RUnlock()
+	if len(txns) == 0 && (prep == nil || known) {
+		return
+	}
+
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		// A publish the meta group no longer knows about was resolved elsewhere, so drop it.
+		if prep != nil && !known {
+			mset.proposeAtomicResolve(prep.id, false)
+		}
+		for _, p := range txns {
+			switch {
+			case p.decided:
+				mset.proposeAtomicResolve(p.begin.ID, p.commit)
+			case prep != nil && prep.id == p.begin.ID:
+				js.proposeAtomicTxn(&atomicTxnUpdate{Step: atomicTxnVote, ID: prep.id, Stream: name, Dup: prep.dup, Seqs: prep.seqs})
+			case !p.voted:
+				mset.proposeAtomicPrepare(p.begin)
+			}
+		}
+	})
+}
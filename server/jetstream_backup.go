@@ -0,0 +1,720 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// StreamBackup schedules snapshots of a stream that are taken by the stream leader.
+// Backups are written either below the server's backup directory or into an object store
+// bucket of the stream's account, and can be restored like any other stream snapshot.
+type StreamBackup struct {
+	// Schedule is a cron expression with five fields evaluated in UTC, one of
+	// @hourly, @daily, @weekly, @monthly, @yearly or "@every <duration>".
+	Schedule string `json:"schedule"`
+	// Path is a directory relative to the account's directory in the server's backup directory.
+	Path string `json:"path,omitempty"`
+	// ObjectStore is the name of an object store bucket in the stream's account.
+	ObjectStore string `json:"object_store,omitempty"`
+	// Retain is the number of backups to keep, zero keeps all of them.
+	Retain int `json:"retain,omitempty"`
+}
+
+const (
+	// Suffix of backup files and objects, these are s2 compressed tar archives.
+	backupSuffix = ".tar.s2"
+	// Time layout of backup names so they sort by the time they were taken.
+	backupTimeLayout = "20060102T150405.000Z"
+	// Size of the chunks of backups written to object stores.
+	backupObjChunkSize = 128 * 1024
+	// How many chunks can be waiting for their ack.
+	backupObjMaxPending = 32
+	// How long we wait for acks and API responses.
+	backupAckWait = 10 * time.Second
+	// Reply subject for acks and API responses, with the stream name and a unique token.
+	jsBackupReplyT = "$JS.BACKUP.%s.%s."
+	// Subjects of object store chunks and meta data.
+	objChunksSubjectT = "$O.%s.C.%s"
+	objMetaSubjectT   = "$O.%s.M.%s"
+	objStreamT        = "OBJ_%s"
+)
+
+// Checks the backup configuration is valid.
+func (sb *StreamBackup) validate(cfg *StreamConfig, hasBackupDir bool) error {
+	if _, err := parseBackupSchedule(sb.Schedule); err != nil {
+		return err
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("backups require file storage")
+	}
+	if sb.Retain < 0 {
+		return errors.New("retain can not be negative")
+	}
+	switch {
+	case sb.Path != _EMPTY_ && sb.ObjectStore != _EMPTY_:
+		return errors.New("path and object store are mutually exclusive")
+	case sb.Path != _EMPTY_:
+		if !hasBackupDir {
+			return errors.New("server has no backup directory configured")
+		}
+		if !filepath.IsLocal(sb.Path) {
+			return fmt.Errorf("path %q has to be local to the backup directory", sb.Path)
+		}
+	case sb.ObjectStore != _EMPTY_:
+		if !isValidBucketName(sb.ObjectStore) {
+			return fmt.Errorf("invalid object store name %q", sb.ObjectStore)
+		}
+	default:
+		return errors.New("path or object store is required")
+	}
+	return nil
+}
+
+// Returns a description of where backups are written for advisories and logs.
+func (sb *StreamBackup) destination() string {
+	if sb.ObjectStore != _EMPTY_ {
+		return "object store " + sb.ObjectStore
+	}
+	return "path " + sb.Path
+}
+
+// Object store bucket names are restricted to letters, numbers, dashes and underscores.
+func isValidBucketName(name string) bool {
+	if name == _EMPTY_ {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// backupSchedule returns the first time after t a backup should be taken.
+// The zero time is returned if there is none.
+type backupSchedule interface {
+	next(t time.Time) time.Time
+}
+
+// everySchedule takes backups at a fixed interval.
+type everySchedule time.Duration
+
+func (es everySchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(es))
+}
+
+// cronSchedule holds the allowed values of each cron field as a bit set.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether the day of month or day of week fields were a star.
+	// If both are restricted, a day matching either one is selected.
+	anyDom, anyDow bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// parseBackupSchedule parses a cron expression or one of the supported shortcuts.
+func parseBackupSchedule(spec string) (backupSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == _EMPTY_ {
+		return nil, errors.New("schedule is required")
+	}
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least one second", spec)
+		}
+		return everySchedule(d), nil
+	}
+	if full, ok := cronShortcuts[spec]; ok {
+		spec = full
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+	limits := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, limits[i][0], limits[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		sets[i] = set
+	}
+	cs := &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		// Sunday can be 0 or 7.
+		dow:    sets[4] | (sets[4]>>7)&1,
+		anyDom: strings.HasPrefix(fields[2], "*"),
+		anyDow: strings.HasPrefix(fields[4], "*"),
+	}
+	// Catch schedules that can never run, like the 30th of February.
+	if cs.next(time.Now().UTC()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: never runs", spec)
+	}
+	return cs, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps.
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		inc := 1
+		if hasStep {
+			var err error
+			if inc, err = strconv.Atoi(step); err != nil || inc <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		start, end := lo, hi
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if !hasStep {
+				end = start
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += inc {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (cs *cronSchedule) matchDay(t time.Time) bool {
+	domOk := cs.dom&(1<<uint(t.Day())) != 0
+	dowOk := cs.dow&(1<<uint(t.Weekday())) != 0
+	if cs.anyDom || cs.anyDow {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Anything that matches at all does so within a few years.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case cs.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+		case !cs.matchDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+		case cs.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case cs.minute&(1<<uint(t.Minute())) == 0:
+			// Skip ahead to the next allowed minute in this hour, if any.
+			if rest := cs.minute >> uint(t.Minute()); rest != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			} else {
+				t = t.Truncate(time.Hour).Add(time.Hour)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// backupInfo tracks the running backup schedule of a stream.
+type backupInfo struct {
+	cfg   StreamBackup
+	sched backupSchedule
+	qch   chan struct{} // Quit channel.
+}
+
+// Start the backup schedule if configured and not already running with the same configuration.
+// Lock should be held.
+func (mset *stream) startBackup(sb *StreamBackup) {
+	if sb == nil {
+		mset.stopBackup()
+		return
+	}
+	if bi := mset.backup; bi != nil {
+		if bi.cfg == *sb {
+			return
+		}
+		// Configuration changed, restart.
+		mset.stopBackup()
+	}
+	sched, err := parseBackupSchedule(sb.Schedule)
+	if err != nil {
+		mset.srv.Warnf("JetStream backup schedule for '%s > %s' is invalid: %v", mset.acc.Name, mset.cfg.Name, err)
+		return
+	}
+	bi := &backupInfo{cfg: *sb, sched: sched, qch: make(chan struct{})}
+	mset.backup = bi
+	mset.srv.startGoRoutine(
+		func() { mset.runBackups(bi) },
+		pprofLabels{
+			"type":    "backup",
+			"account": mset.acc.Name,
+			"stream":  mset.cfg.Name,
+		},
+	)
+}
+
+// Stop the backup schedule.
+// Lock should be held.
+func (mset *stream) stopBackup() {
+	if bi := mset.backup; bi != nil {
+		close(bi.qch)
+		mset.backup = nil
+	}
+}
+
+// Will run as a Go routine and take a backup each time the schedule fires.
+func (mset *stream) runBackups(bi *backupInfo) {
+	s := mset.srv
+	defer s.grWG.Done()
+
+	mset.mu.RLock()
+	qch := mset.qch
+	mset.mu.RUnlock()
+
+	for {
+		next := bi.sched.next(time.Now().UTC())
+		if next.IsZero() {
+			return
+		}
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-t.C:
+		case <-bi.qch:
+			t.Stop()
+			return
+		case <-qch:
+			t.Stop()
+			return
+		case <-s.quitCh:
+			t.Stop()
+			return
+		}
+		mset.runBackup(bi)
+	}
+}
+
+// Takes a single backup, applies retention and sends the advisory.
+func (mset *stream) runBackup(bi *backupInfo) {
+	mset.mu.RLock()
+	s, accName, name, outq := mset.srv, mset.acc.Name, mset.cfg.Name, mset.outq
+	mset.mu.RUnlock()
+
+	start := time.Now().UTC()
+	bname := start.Format(backupTimeLayout) + backupSuffix
+
+	var n int64
+	sr, err := mset.snapshot(0, false, true)
+	if err == nil {
+		if bi.cfg.ObjectStore != _EMPTY_ {
+			n, err = mset.backupToObjectStore(bi, name+"/"+bname, sr.Reader)
+		} else {
+			n, err = mset.backupToPath(bi, bname, sr.Reader)
+		}
+		sr.Reader.Close()
+	}
+
+	m := JSStreamBackupAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamBackupAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      name,
+		Destination: bi.cfg.destination(),
+		Name:        bname,
+		Bytes:       n,
+		Start:       start,
+		End:         time.Now().UTC(),
+		Domain:      s.getOpts().JetStreamDomain,
+	}
+	if err != nil {
+		m.Error = err.Error()
+		s.Warnf("JetStream backup of '%s > %s' to %s failed: %v", accName, name, m.Destination, err)
+	} else {
+		s.Noticef("JetStream backup of '%s > %s' to %s completed: %s (%s)", accName, name, m.Destination, bname, friendlyBytes(n))
+	}
+
+	if outq == nil {
+		return
+	}
+	if j, err := json.Marshal(m); err == nil {
+		outq.sendMsg(JSAdvisoryStreamBackupPre+"."+name, j)
+	}
+}
+
+// Writes the backup below the server's backup directory and removes backups past our retention.
+// Returns the number of bytes written.
+func (mset *stream) backupToPath(bi *backupInfo, bname string, r io.Reader) (int64, error) {
+	bdir := mset.srv.getOpts().JetStreamBackupDir
+	if bdir == _EMPTY_ {
+		return 0, errors.New("server has no backup directory configured")
+	}
+	dir := filepath.Join(bdir, mset.accName(), bi.cfg.Path, mset.name())
+	if err := os.MkdirAll(dir, defaultDirPerms); err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first so an interrupted backup is never mistaken for a complete one.
+	fn := filepath.Join(dir, bname)
+	tmp := fn + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFilePerms)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, fn)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if bi.cfg.Retain > 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return n, err
+		}
+		var backups []string
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), backupSuffix) {
+				backups = append(backups, e.Name())
+			}
+		}
+		// Directory entries are sorted by name, which is the time they were taken.
+		for len(backups) > bi.cfg.Retain {
+			if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+				return n, err
+			}
+			backups = backups[1:]
+		}
+	}
+	return n, nil
+}
+
+// objectMeta is the meta data of an object, compatible with the object store in the clients.
+type objectMeta struct {
+	Name    string             `json:"name"`
+	Bucket  string             `json:"bucket"`
+	NUID    string             `json:"nuid"`
+	Size    uint64             `json:"size"`
+	ModTime time.Time          `json:"mtime"`
+	Chunks  uint32             `json:"chunks"`
+	Digest  string             `json:"digest,omitempty"`
+	Deleted bool               `json:"deleted,omitempty"`
+	Options *objectMetaOptions `json:"options,omitempty"`
+}
+
+type objectMetaOptions struct {
+	ChunkSize uint32 `json:"max_chunk_size,omitempty"`
+}
+
+// backupReply is an ack or API response received on our reply subject.
+type backupReply struct {
+	token string
+	msg   []byte
+}
+
+// backupClient publishes into the stream's account and receives the replies.
+type backupClient struct {
+	mset    *stream
+	reply   string
+	replies chan backupReply
+	qch     chan struct{}
+}
+
+func (mset *stream) newBackupClient(qch chan struct{}) (*backupClient, *subscription, error) {
+	bc := &backupClient{
+		mset:    mset,
+		reply:   fmt.Sprintf(jsBackupReplyT, mset.name(), nuid.Next()),
+		replies: make(chan backupReply, backupObjMaxPending),
+		qch:     qch,
+	}
+	sub, err := mset.subscribeInternal(bc.reply+fwcs, func(_ *subscription, c *client, _ *Account, subject, _ string, rmsg []byte) {
+		_, msg := c.msgParts(rmsg)
+		select {
+		case bc.replies <- backupReply{strings.TrimPrefix(subject, bc.reply), copyBytes(msg)}:
+		case <-bc.qch:
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return bc, sub, nil
+}
+
+// Waits for the next reply.
+func (bc *backupClient) next() (backupReply, error) {
+	timeout := time.NewTimer(backupAckWait)
+	defer timeout.Stop()
+	select {
+	case r := <-bc.replies:
+		return r, nil
+	case <-timeout.C:
+		return backupReply{}, errors.New("timeout waiting for response")
+	case <-bc.qch:
+		return backupReply{}, errCatchupStreamStopped
+	}
+}
+
+// Sends a JetStream API request and waits for the response.
+// No acks are expected while a request is outstanding.
+func (bc *backupClient) request(subject string, req any, resp any) error {
+	var b []byte
+	if req != nil {
+		b, _ = json.Marshal(req)
+	}
+	bc.mset.outq.send(newJSPubMsg(subject, _EMPTY_, bc.reply+"api", nil, b, nil, 0))
+	for {
+		r, err := bc.next()
+		if err != nil {
+			return fmt.Errorf("%v to %q", err, subject)
+		}
+		if r.token == "api" {
+			return json.Unmarshal(r.msg, resp)
+		}
+	}
+}
+
+// Checks a publish ack for errors.
+func checkBackupAck(msg []byte) error {
+	var pa JSPubAckResponse
+	if err := json.Unmarshal(msg, &pa); err != nil {
+		return err
+	}
+	if pa.Error != nil {
+		return pa.Error
+	}
+	return nil
+}
+
+// Writes the backup as an object into the configured object store bucket and removes backups past our retention.
+// Returns the number of bytes written.
+func (mset *stream) backupToObjectStore(bi *backupInfo, oname string, r io.Reader) (int64, error) {
+	// Stop waiting for acks if the schedule is stopped or we lose leadership.
+	mset.mu.RLock()
+	s, sqch := mset.srv, mset.qch
+	mset.mu.RUnlock()
+	done, fin := make(chan struct{}), make(chan struct{})
+	defer close(fin)
+	go func() {
+		select {
+		case <-bi.qch:
+		case <-sqch:
+		case <-s.quitCh:
+		case <-fin:
+		}
+		close(done)
+	}()
+
+	bc, sub, err := mset.newBackupClient(done)
+	if err != nil {
+		return 0, err
+	}
+	defer mset.unsubscribe(sub)
+
+	bucket := bi.cfg.ObjectStore
+	var si JSApiStreamInfoResponse
+	if err := bc.request(fmt.Sprintf(JSApiStreamInfoT, fmt.Sprintf(objStreamT, bucket)), nil, &si); err != nil {
+		return 0, err
+	}
+	if si.Error != nil {
+		return 0, fmt.Errorf("object store %q: %v", bucket, si.Error)
+	}
+
+	id := nuid.Next()
+	chunkSubj := fmt.Sprintf(objChunksSubjectT, bucket, id)
+	h := sha256.New()
+	buf := make([]byte, backupObjChunkSize)
+	var size uint64
+	var chunks uint32
+	var pending int
+
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			size += uint64(n)
+			chunks++
+			for pending >= backupObjMaxPending {
+				r, err := bc.next()
+				if err != nil {
+					return 0, err
+				}
+				if err := checkBackupAck(r.msg); err != nil {
+					return 0, err
+				}
+				pending--
+			}
+			bc.mset.outq.send(newJSPubMsg(chunkSubj, _EMPTY_, bc.reply+"ack", nil, copyBytes(buf[:n]), nil, 0))
+			pending++
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return 0, rerr
+		}
+	}
+	for ; pending > 0; pending-- {
+		r, err := bc.next()
+		if err != nil {
+			return 0, err
+		}
+		if err := checkBackupAck(r.msg); err != nil {
+			return 0, err
+		}
+	}
+
+	meta := &objectMeta{
+		Name:    oname,
+		Bucket:  bucket,
+		NUID:    id,
+		Size:    size,
+		ModTime: time.Now().UTC(),
+		Chunks:  chunks,
+		Digest:  "SHA-256=" + base64.URLEncoding.EncodeToString(h.Sum(nil)),
+		Options: &objectMetaOptions{ChunkSize: backupObjChunkSize},
+	}
+	mb, _ := json.Marshal(meta)
+	hdr := genHeader(nil, JSMsgRollup, JSMsgRollupSubject)
+	metaSubj := fmt.Sprintf(objMetaSubjectT, bucket, base64.URLEncoding.EncodeToString([]byte(oname)))
+	bc.mset.outq.send(newJSPubMsg(metaSubj, _EMPTY_, bc.reply+"ack", hdr, mb, nil, 0))
+	ack, err := bc.next()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkBackupAck(ack.msg); err != nil {
+		return 0, err
+	}
+
+	if bi.cfg.Retain > 0 {
+		if err := bc.applyObjectRetention(bucket, mset.name()+"/", bi.cfg.Retain); err != nil {
+			return int64(size), err
+		}
+	}
+	return int64(size), nil
+}
+
+// Removes the oldest of our backups in the bucket until at most retain are left.
+func (bc *backupClient) applyObjectRetention(bucket, prefix string, retain int) error {
+	stream := fmt.Sprintf(objStreamT, bucket)
+	req := &JSApiStreamInfoRequest{SubjectsFilter: fmt.Sprintf(objMetaSubjectT, bucket, fwcs)}
+	var si JSApiStreamInfoResponse
+	if err := bc.request(fmt.Sprintf(JSApiStreamInfoT, stream), req, &si); err != nil {
+		return err
+	}
+	if si.Error != nil {
+		return si.Error
+	}
+	if si.StreamInfo == nil {
+		return nil
+	}
+
+	// Map object names back to their meta subjects.
+	backups := make(map[string]string)
+	var names []string
+	for subj := range si.State.Subjects {
+		tokens := strings.Split(subj, tsep)
+		if len(tokens) != 4 {
+			continue
+		}
+		name, err := base64.URLEncoding.DecodeString(tokens[3])
+		if err != nil || !strings.HasPrefix(string(name), prefix) || !strings.HasSuffix(string(name), backupSuffix) {
+			continue
+		}
+		backups[string(name)] = subj
+		names = append(names, string(name))
+	}
+	if len(names) <= retain {
+		return nil
+	}
+	sort.Strings(names)
+
+	for _, name := range names[:len(names)-retain] {
+		metaSubj := backups[name]
+		var mr JSApiMsgGetResponse
+		if err := bc.request(fmt.Sprintf(JSApiMsgGetT, stream), &JSApiMsgGetRequest{LastFor: metaSubj}, &mr); err != nil {
+			return err
+		}
+		if mr.Error != nil || mr.Message == nil {
+			continue
+		}
+		var meta objectMeta
+		if err := json.Unmarshal(mr.Message.Data, &meta); err != nil {
+			continue
+		}
+		for _, subj := range []string{fmt.Sprintf(objChunksSubjectT, bucket, meta.NUID), metaSubj} {
+			var pr JSApiStreamPurgeResponse
+			if err := bc.request(fmt.Sprintf(JSApiStreamPurgeT, stream), &JSApiStreamPurgeRequest{Subject: subj}, &pr); err != nil {
+				return err
+			}
+			if pr.Error != nil {
+				return pr.Error
+			}
+		}
+	}
+	return nil
+}
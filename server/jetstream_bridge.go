@@ -0,0 +1,298 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// StreamBridge allows a stream source to ingest messages from an endpoint
+// outside of this server's JetStream, without deploying a separate connector.
+type StreamBridge struct {
+	// Type selects the kind of external endpoint, e.g. "nats".
+	Type string `json:"type"`
+	// Remote is the name of the external system, as configured by the operator
+	// in the JetStream remotes of the server.
+	Remote string `json:"remote"`
+	// Subject to receive messages on from the external endpoint.
+	Subject string `json:"subject"`
+}
+
+const (
+	// StreamBridgeNATS subscribes to a subject on an external NATS system.
+	StreamBridgeNATS = "nats"
+)
+
+// bridgeHandler receives the events of a running bridgeSource.
+type bridgeHandler interface {
+	// connected is called once the external endpoint has been connected.
+	connected()
+	// alive is called on any activity from the external endpoint.
+	alive()
+	// deliver is called for each message received. The buffers are owned by the handler.
+	deliver(subject string, hdr, msg []byte)
+}
+
+// bridgeSource is implemented by each type of external endpoint.
+type bridgeSource interface {
+	// run connects to the endpoint and delivers messages to the handler.
+	// It blocks until qch is closed, in which case it returns nil, or an error occurs.
+	run(qch <-chan struct{}, h bridgeHandler) error
+}
+
+// The bridge types compiled in. Alternative types register here.
+var bridgeTypes = map[string]func(s *Server, accName string, cfg *StreamBridge) (bridgeSource, error){
+	StreamBridgeNATS: newNATSBridgeSource,
+}
+
+// Creates the bridgeSource for this configuration, for a stream of this account.
+func (b *StreamBridge) newSource(s *Server, accName string) (bridgeSource, error) {
+	create, ok := bridgeTypes[b.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown bridge type %q", b.Type)
+	}
+	return create(s, accName, b)
+}
+
+// Checks the bridge configuration is valid for a stream of this account.
+func (b *StreamBridge) validate(s *Server, accName string) error {
+	if !IsValidSubject(b.Subject) {
+		return fmt.Errorf("%w %q", ErrBadSubject, b.Subject)
+	}
+	if _, err := s.jsRemote(accName, b.Remote); err != nil {
+		return err
+	}
+	_, err := b.newSource(s, accName)
+	return err
+}
+
+// bridgeInfo tracks a running bridge for one of our sources.
+type bridgeInfo struct {
+	mset  *stream
+	name  string           // The name of the source.
+	iname string           // The unique index name of the source.
+	cfg   StreamBridge     // The bridge configuration.
+	msgs  *ipQueue[*inMsg] // The stream's ingest queue.
+	qch   chan struct{}    // Quit channel.
+	last  atomic.Int64     // Time of last activity from the external endpoint.
+	err   *ApiError        // The error that caused the last connection to fail.
+	fails int              // The number of consecutive failures.
+}
+
+func (bi *bridgeInfo) connected() {
+	mset := bi.mset
+	mset.mu.Lock()
+	bi.err, bi.fails = nil, 0
+	mset.mu.Unlock()
+	bi.alive()
+}
+
+func (bi *bridgeInfo) alive() {
+	bi.last.Store(time.Now().UnixNano())
+}
+
+func (bi *bridgeInfo) deliver(subject string, hdr, msg []byte) {
+	bi.mset.queueInbound(bi.msgs, subject, _EMPTY_, hdr, msg, nil, nil)
+}
+
+// Start the bridges configured for our sources.
+// Lock should be held.
+func (mset *stream) startBridges() {
+	for _, ssi := range mset.cfg.Sources {
+		if ssi.Bridge != nil {
+			mset.startBridge(ssi)
+		}
+	}
+}
+
+// Start the bridge for this source if not already running.
+// Lock should be held.
+func (mset *stream) startBridge(ssi *StreamSource) {
+	if ssi.iname == _EMPTY_ {
+		ssi.setIndexName()
+	}
+	if _, ok := mset.bridges[ssi.iname]; ok {
+		return
+	}
+	if mset.bridges == nil {
+		mset.bridges = make(map[string]*bridgeInfo)
+	}
+	bi := &bridgeInfo{
+		mset:  mset,
+		name:  ssi.Name,
+		iname: ssi.iname,
+		cfg:   *ssi.Bridge,
+		msgs:  mset.msgs,
+		qch:   make(chan struct{}),
+	}
+	mset.bridges[ssi.iname] = bi
+	mset.srv.startGoRoutine(
+		func() { mset.runBridge(bi) },
+		pprofLabels{
+			"type":    "bridge",
+			"account": mset.acc.Name,
+			"stream":  mset.cfg.Name,
+		},
+	)
+}
+
+// Stop the bridge with this index name.
+// Lock should be held.
+func (mset *stream) stopBridge(iname string) {
+	if bi := mset.bridges[iname]; bi != nil {
+		close(bi.qch)
+		delete(mset.bridges, iname)
+	}
+}
+
+// Stop all of our bridges.
+// Lock should be held.
+func (mset *stream) stopBridges() {
+	for iname := range mset.bridges {
+		mset.stopBridge(iname)
+	}
+}
+
+// Start bridges that were added and stop the ones that were removed.
+// Lock should be held.
+func (mset *stream) updateBridges(sources []*StreamSource) {
+	keep := make(map[string]struct{})
+	for _, ssi := range sources {
+		if ssi.Bridge == nil {
+			continue
+		}
+		ssi.setIndexName()
+		keep[ssi.iname] = struct{}{}
+		mset.startBridge(ssi)
+	}
+	for iname := range mset.bridges {
+		if _, ok := keep[iname]; !ok {
+			mset.stopBridge(iname)
+		}
+	}
+}
+
+// Lock should be held.
+func (mset *stream) bridgeSourceInfo(bi *bridgeInfo) *StreamSourceInfo {
+	ssi := &StreamSourceInfo{
+		Name:    bi.name,
+		Error:   bi.err,
+		Retries: bi.fails,
+		Bridge:  &bi.cfg,
+	}
+	if last := bi.last.Load(); last == 0 {
+		ssi.Active = -1
+	} else {
+		ssi.Active = time.Since(time.Unix(0, last))
+	}
+	return ssi
+}
+
+// Will run as a Go routine and keep the bridge connected, backing off on failures.
+func (mset *stream) runBridge(bi *bridgeInfo) {
+	s := mset.srv
+	defer s.grWG.Done()
+
+	mset.mu.RLock()
+	qch, accName, sname := mset.qch, mset.acc.Name, mset.cfg.Name
+	mset.mu.RUnlock()
+
+	// Merge our quit channels so the bridge source only needs to watch one.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-bi.qch:
+		case <-qch:
+		case <-s.quitCh:
+		}
+		close(done)
+	}()
+
+	for {
+		src, err := bi.cfg.newSource(s, accName)
+		if err == nil {
+			err = src.run(done, bi)
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if err == nil {
+			err = errors.New("bridge connection closed")
+		}
+		s.RateLimitWarnf("JetStream bridge for '%s > %s' source '%s' failed: %v", accName, sname, bi.name, err)
+
+		mset.mu.Lock()
+		bi.fails++
+		bi.err = NewJSSourceBridgeFailedError(err)
+		backoff := calculateRetryBackoff(bi.fails)
+		mset.mu.Unlock()
+
+		select {
+		case <-time.After(backoff + calculateRetryJitter(backoff)):
+		case <-done:
+			return
+		}
+	}
+}
+
+// How often we check the remote is still connected.
+const bridgeCheckInterval = time.Second
+
+// natsBridgeSource subscribes to a subject on an external NATS system,
+// over the leafnode connection of a remote.
+type natsBridgeSource struct {
+	s       *Server
+	accName string
+	remote  string
+	subject string
+}
+
+func newNATSBridgeSource(s *Server, accName string, cfg *StreamBridge) (bridgeSource, error) {
+	return &natsBridgeSource{s: s, accName: accName, remote: cfg.Remote, subject: cfg.Subject}, nil
+}
+
+func (b *natsBridgeSource) run(qch <-chan struct{}, h bridgeHandler) error {
+	rc, err := b.s.connectJSRemote(b.accName, b.remote)
+	if err != nil {
+		return err
+	}
+	defer rc.close()
+
+	err = rc.subscribe(b.subject, func(subject, _ string, hdr, msg []byte) {
+		h.alive()
+		h.deliver(subject, hdr, msg)
+	})
+	if err != nil {
+		return err
+	}
+	h.connected()
+
+	t := time.NewTicker(bridgeCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if !rc.connected() {
+				return fmt.Errorf("remote %q is not connected", b.remote)
+			}
+		case <-qch:
+			return nil
+		}
+	}
+}
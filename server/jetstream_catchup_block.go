@@ -0,0 +1,174 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/minio/highwayhash"
+)
+
+// catchupBlock is a file store message block sent whole to a replica that is far
+// behind, instead of message by message. The records are sent as stored, so the
+// replica checks them against their checksums before storing the messages.
+type catchupBlock struct {
+	index   uint32   // Index of the block, the checksums are keyed by it.
+	first   uint64   // First sequence covered, anything before the first record was deleted.
+	last    uint64   // Last sequence covered.
+	deleted []uint64 // Sequences of records that were deleted.
+	buf     []byte   // The records.
+}
+
+// Flags of an encoded catchup block.
+const catchupBlockCompressed = 1 << 0
+
+func encodeCatchupBlock(cb *catchupBlock, compress bool) []byte {
+	var le = binary.LittleEndian
+	var flags byte
+	buf := cb.buf
+	if compress {
+		flags |= catchupBlockCompressed
+		buf = s2.Encode(nil, buf)
+	}
+
+	b := make([]byte, 0, 30+len(cb.deleted)*binary.MaxVarintLen64+len(buf))
+	b = append(b, byte(catchupBlockOp), flags)
+	b = le.AppendUint32(b, cb.index)
+	b = le.AppendUint64(b, cb.first)
+	b = le.AppendUint64(b, cb.last)
+	b = binary.AppendUvarint(b, uint64(len(cb.deleted)))
+	for _, seq := range cb.deleted {
+		b = binary.AppendUvarint(b, seq-cb.first)
+	}
+	return append(b, buf...)
+}
+
+func decodeCatchupBlock(buf []byte) (*catchupBlock, error) {
+	var le = binary.LittleEndian
+	if len(buf) < 21 {
+		return nil, errCatchupBadMsg
+	}
+	flags := buf[0]
+	cb := &catchupBlock{
+		index: le.Uint32(buf[1:]),
+		first: le.Uint64(buf[5:]),
+		last:  le.Uint64(buf[13:]),
+	}
+	buf = buf[21:]
+	num, n := binary.Uvarint(buf)
+	if n <= 0 || num > uint64(len(buf)) {
+		return nil, errCatchupBadMsg
+	}
+	buf = buf[n:]
+	cb.deleted = make([]uint64, 0, num)
+	for i := uint64(0); i < num; i++ {
+		d, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errCatchupBadMsg
+		}
+		cb.deleted = append(cb.deleted, cb.first+d)
+		buf = buf[n:]
+	}
+	if flags&catchupBlockCompressed != 0 {
+		var err error
+		if buf, err = s2.Decode(nil, buf); err != nil {
+			return nil, errCatchupBadMsg
+		}
+	}
+	cb.buf = buf
+	return cb, nil
+}
+
+// forEachMsg calls fn for the messages of the block in order, skipping the deleted ones.
+// Every record is checked against its checksum, keyed like the blocks of the stream.
+func (cb *catchupBlock) forEachMsg(stream string, fn func(sm *StoreMsg) error) error {
+	var le = binary.LittleEndian
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", stream, cb.index)))
+	hh, err := highwayhash.New64(key[:])
+	if err != nil {
+		return err
+	}
+	deleted := make(map[uint64]struct{}, len(cb.deleted))
+	for _, seq := range cb.deleted {
+		deleted[seq] = struct{}{}
+	}
+
+	next := cb.first
+	for buf := cb.buf; len(buf) > 0; {
+		if len(buf) < msgHdrSize {
+			return errCatchupBadMsg
+		}
+		rl := le.Uint32(buf[0:]) &^ hbit
+		seq := le.Uint64(buf[4:])
+		if rl < emptyRecordLen || int(rl) > len(buf) {
+			return errCatchupBadMsg
+		}
+		rec := buf[:rl]
+		buf = buf[rl:]
+
+		// Tombstones, erased and deleted messages, and anything outside of our range are skipped.
+		if seq&(tbit|ebit) != 0 || seq < next || seq > cb.last {
+			continue
+		}
+		if _, ok := deleted[seq]; ok {
+			continue
+		}
+		sm, err := msgFromBuf(rec, nil, hh)
+		if err != nil || sm.seq != seq {
+			return errCatchupBadMsg
+		}
+		if err := fn(sm); err != nil {
+			return err
+		}
+		next = seq + 1
+	}
+	return nil
+}
+
+// processCatchupBlock stores the messages of a block sent by the leader on catchup,
+// and skips the sequences in between. Returns the last sequence of the block.
+func (mset *stream) processCatchupBlock(buf []byte) (uint64, error) {
+	cb, err := decodeCatchupBlock(buf)
+	if err != nil {
+		return 0, err
+	}
+	next := cb.first
+	skipTo := func(seq uint64) error {
+		if seq <= next {
+			return nil
+		}
+		_, err := mset.skipCatchupMsgs(next, seq-next)
+		return err
+	}
+	err = cb.forEachMsg(mset.name(), func(sm *StoreMsg) error {
+		if err := skipTo(sm.seq); err != nil {
+			return err
+		}
+		if _, err := mset.storeCatchupMsg(sm.subj, sm.hdr, sm.msg, sm.seq, sm.ts); err != nil {
+			return err
+		}
+		next = sm.seq + 1
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := skipTo(cb.last + 1); err != nil {
+		return 0, err
+	}
+	return cb.last, nil
+}
@@ -0,0 +1,345 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ConsumerCheckpoint is the position of a durable consumer in a portable format.
+// Pipelines can store it alongside their own state and restore both together,
+// on the same consumer or on one with the same stream sequences elsewhere.
+type ConsumerCheckpoint struct {
+	Stream   string `json:"stream_name"`
+	Consumer string `json:"consumer_name"`
+	// Delivered is the last message delivered to the consumer.
+	Delivered SequencePair `json:"delivered"`
+	// AckFloor is the message up to which all messages have been acknowledged.
+	AckFloor SequencePair `json:"ack_floor"`
+	// Pending are the messages delivered but not yet acknowledged, ordered by stream sequence.
+	Pending []SequencePair `json:"pending,omitempty"`
+	// PendingDigest is a digest of the pending messages, verified on import.
+	PendingDigest string `json:"pending_digest"`
+	// Time is when the checkpoint was taken.
+	Time time.Time `json:"ts"`
+}
+
+var (
+	errCheckpointDigest       = errors.New("pending digest does not match")
+	errCheckpointAckFloor     = errors.New("ack floor is above the delivered sequences")
+	errCheckpointPendingRange = errors.New("pending message out of range")
+	errCheckpointPendingDup   = errors.New("duplicate pending message")
+	errCheckpointStreamRange  = errors.New("stream sequence out of range")
+)
+
+// Returns the digest of the pending messages of a checkpoint.
+// The pending messages have to be ordered by stream sequence.
+func checkpointPendingDigest(pending []SequencePair) string {
+	h := sha256.New()
+	var b [16]byte
+	for _, p := range pending {
+		binary.BigEndian.PutUint64(b[:8], p.Stream)
+		binary.BigEndian.PutUint64(b[8:], p.Consumer)
+		h.Write(b[:])
+	}
+	return "SHA-256=" + base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Returns the checkpoint for our current state.
+// Lock should be held.
+func (o *consumer) checkpoint() *ConsumerCheckpoint {
+	cp := &ConsumerCheckpoint{
+		Stream:    o.stream,
+		Consumer:  o.name,
+		Delivered: SequencePair{Consumer: o.dseq - 1, Stream: o.sseq - 1},
+		AckFloor:  SequencePair{Consumer: o.adflr, Stream: o.asflr},
+		Time:      time.Now().UTC(),
+	}
+	// When not in FIFO order we may have skipped ahead, but nothing after
+	// the ack floor that is not pending has been delivered yet.
+	if o.isOrdered() {
+		cp.Delivered = cp.AckFloor
+		for seq, p := range o.pending {
+			if seq > cp.Delivered.Stream {
+				cp.Delivered.Stream = seq
+			}
+			if p.Sequence > cp.Delivered.Consumer {
+				cp.Delivered.Consumer = p.Sequence
+			}
+		}
+	}
+	if len(o.pending) > 0 {
+		cp.Pending = make([]SequencePair, 0, len(o.pending))
+		for seq, p := range o.pending {
+			cp.Pending = append(cp.Pending, SequencePair{Consumer: p.Sequence, Stream: seq})
+		}
+		sort.Slice(cp.Pending, func(i, j int) bool { return cp.Pending[i].Stream < cp.Pending[j].Stream })
+	}
+	cp.PendingDigest = checkpointPendingDigest(cp.Pending)
+	return cp
+}
+
+// Verifies the checkpoint against the first and last sequence of the stream and returns
+// the consumer state it represents. The delivered and ack floor stream sequences have to be
+// within the stream, or just before its first sequence if nothing of it was delivered or
+// acknowledged. Pending messages will be redelivered once their ack wait expires from now.
+func (cp *ConsumerCheckpoint) state(first, last uint64) (*ConsumerState, error) {
+	if cp.AckFloor.Stream > cp.Delivered.Stream || cp.AckFloor.Consumer > cp.Delivered.Consumer {
+		return nil, errCheckpointAckFloor
+	}
+	if first > 0 {
+		first--
+	}
+	for _, p := range []struct {
+		name string
+		seq  uint64
+	}{{"delivered", cp.Delivered.Stream}, {"ack floor", cp.AckFloor.Stream}} {
+		if p.seq < first || p.seq > last {
+			return nil, fmt.Errorf("%w: %s %d not in %d..%d", errCheckpointStreamRange, p.name, p.seq, first, last)
+		}
+	}
+	pending := append([]SequencePair(nil), cp.Pending...)
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Stream < pending[j].Stream })
+	if checkpointPendingDigest(pending) != cp.PendingDigest {
+		return nil, errCheckpointDigest
+	}
+
+	state := &ConsumerState{Delivered: cp.Delivered, AckFloor: cp.AckFloor}
+	if len(pending) > 0 {
+		ts := time.Now().UnixNano()
+		state.Pending = make(map[uint64]*Pending, len(pending))
+		for _, p := range pending {
+			if p.Stream <= cp.AckFloor.Stream || p.Stream > cp.Delivered.Stream ||
+				p.Consumer <= cp.AckFloor.Consumer || p.Consumer > cp.Delivered.Consumer {
+				return nil, fmt.Errorf("%w: stream sequence %d", errCheckpointPendingRange, p.Stream)
+			}
+			if _, ok := state.Pending[p.Stream]; ok {
+				return nil, fmt.Errorf("%w: stream sequence %d", errCheckpointPendingDup, p.Stream)
+			}
+			state.Pending[p.Stream] = &Pending{Sequence: p.Consumer, Timestamp: ts}
+		}
+	}
+	return state, nil
+}
+
+// resetState will replace our state with the one given, even if that moves us backwards.
+// Lock should be held.
+func (o *consumer) resetState(state *ConsumerState) error {
+	if o.store == nil {
+		return nil
+	}
+	if err := o.store.Reset(state); err != nil {
+		return err
+	}
+	o.applyState(state)
+	o.sseq = state.Delivered.Stream + 1
+	o.rdc = nil
+	o.rdq = nil
+	o.rdqi.Empty()
+
+	if o.isLeader() {
+		// When not in FIFO order we have to look again at all messages not yet acknowledged.
+		if o.isOrdered() {
+			o.resetOrdered()
+		}
+		o.streamNumPending()
+		o.signalNewMessages()
+	}
+	return nil
+}
+
+// importCheckpoint restores our state from a checkpoint.
+func (o *consumer) importCheckpoint(cp *ConsumerCheckpoint) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.mset == nil {
+		return errBadConsumer
+	}
+	var ss StreamState
+	o.mset.store.FastState(&ss)
+	state, err := cp.state(ss.FirstSeq, ss.LastSeq)
+	if err != nil {
+		return err
+	}
+
+	if err := o.resetState(state); err != nil {
+		return err
+	}
+	// Have our followers do the same.
+	if o.node != nil {
+		o.propose(append([]byte{byte(resetConsumerStateOp)}, encodeConsumerState(state)...))
+	}
+	return nil
+}
+
+// Returns the consumer to export or import a checkpoint for if we should answer the request.
+// In clustered mode only the consumer leader will answer.
+func (s *Server) jsCheckpointConsumer(ci *ClientInfo, acc *Account, subject, reply, msg string, resp *ApiResponse, respond func() string) *consumer {
+	stream := streamNameFromSubject(subject)
+	consumer := consumerNameFromSubject(subject)
+
+	sendErr := func(err *ApiError) {
+		resp.Error = err
+		s.sendAPIErrResponse(ci, acc, subject, reply, msg, respond())
+	}
+
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return nil
+		}
+		if js.isLeaderless() {
+			sendErr(NewJSClusterNotAvailError())
+			return nil
+		}
+
+		js.mu.RLock()
+		isLeader, sa, ca := cc.isLeader(), js.streamAssignment(acc.Name, stream), js.consumerAssignment(acc.Name, stream, consumer)
+		js.mu.RUnlock()
+
+		if isLeader && ca == nil {
+			// We can't find the consumer, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					sendErr(NewJSNotEnabledForAccountError())
+				}
+				return nil
+			}
+			if sa == nil {
+				sendErr(NewJSStreamNotFoundError())
+				return nil
+			}
+			sendErr(NewJSConsumerNotFoundError())
+			return nil
+		} else if ca == nil {
+			return nil
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(ca.Group) {
+			sendErr(NewJSClusterNotAvailError())
+			return nil
+		}
+
+		// We have the consumer assigned and a leader, so only the consumer leader should answer.
+		if !acc.JetStreamIsConsumerLeader(stream, consumer) {
+			return nil
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			sendErr(NewJSNotEnabledForAccountError())
+		}
+		return nil
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		sendErr(NewJSStreamNotFoundError(Unless(err)))
+		return nil
+	}
+	o := mset.lookupConsumer(consumer)
+	if o == nil {
+		sendErr(NewJSConsumerNotFoundError())
+		return nil
+	}
+	if !o.isDurable() {
+		sendErr(NewJSConsumerCheckpointRequiresDurableError())
+		return nil
+	}
+	return o
+}
+
+// Request to export the checkpoint of a durable consumer.
+func (s *Server) jsConsumerExportRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiConsumerExportResponse{ApiResponse: ApiResponse{Type: JSApiConsumerExportResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	o := s.jsCheckpointConsumer(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond)
+	if o == nil {
+		return
+	}
+
+	o.mu.RLock()
+	resp.Checkpoint = o.checkpoint()
+	o.mu.RUnlock()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+}
+
+// Request to restore a durable consumer from a checkpoint.
+func (s *Server) jsConsumerImportRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var req JSApiConsumerImportRequest
+	var resp = JSApiConsumerImportResponse{ApiResponse: ApiResponse{Type: JSApiConsumerImportResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	if req.Checkpoint == nil {
+		resp.Error = NewJSConsumerCheckpointInvalidError(errors.New("checkpoint is required"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	o := s.jsCheckpointConsumer(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond)
+	if o == nil {
+		return
+	}
+
+	if err := o.importCheckpoint(req.Checkpoint); err != nil {
+		resp.Error = NewJSConsumerCheckpointInvalidError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	o.mu.RLock()
+	resp.Checkpoint = o.checkpoint()
+	o.mu.RUnlock()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+}
@@ -69,6 +69,8 @@ type jetStreamCluster struct {
 	peerStreamCancelMove *subscription
 	// To pop out the monitorCluster before the raft layer.
 	qch chan struct{}
+	// Pending atomic publishes across streams.
+	atomicTxns map[string]*atomicTxn
 }
 
 // Used to track inflight stream add requests to properly re-use same group and sync subject.
@@ -113,6 +115,23 @@ const (
 	compressedStreamMsgOp
 	// For sending deleted gaps on catchups for replicas.
 	deleteRangeOp
+	// For restoring a consumer from a checkpoint.
+	resetConsumerStateOp
+	// For sending whole message blocks on catchups for replicas.
+	catchupBlockOp
+	// Rename Stream.
+	renameStreamOp
+	// Truncate Stream.
+	truncateStreamOp
+	// Atomic publish to a stream.
+	atomicPublishOp
+	// Cumulative acks of a consumer.
+	updateAcksUpToOp
+	// Atomic publish across streams, coordinated by the meta group.
+	atomicTxnOp
+	// Prepare and resolve an atomic publish across streams in a stream.
+	atomicPrepareOp
+	atomicResolveOp
 )
 
 // raftGroups are controlled by the metagroup controller.
@@ -123,6 +142,8 @@ type raftGroup struct {
 	Storage   StorageType `json:"store"`
 	Cluster   string      `json:"cluster,omitempty"`
 	Preferred string      `json:"preferred,omitempty"`
+	// Servers outside of the group that hold read only copies of a stream.
+	Readers []string `json:"readers,omitempty"`
 	// Internal
 	node RaftNode
 }
@@ -137,11 +158,16 @@ type streamAssignment struct {
 	Subject string        `json:"subject"`
 	Reply   string        `json:"reply"`
 	Restore *StreamState  `json:"restore_state,omitempty"`
+	// Options for receiving the snapshot of a restore.
+	RestoreOpts *StreamRestoreOptions `json:"restore_opts,omitempty"`
+	// Recent idempotency tokens of create and update requests.
+	Tokens []string `json:"tokens,omitempty"`
 	// Internal
 	consumers  map[string]*consumerAssignment
 	responded  bool
 	recovering bool
 	err        error
+	scale      *streamScale
 }
 
 // consumerAssignment is what the meta controller uses to assign consumers to streams.
@@ -645,13 +671,17 @@ func (js *jetStream) isConsumerHealthy(mset *stream, consumer string, ca *consum
 // subjectsOverlap checks all existing stream assignments for the account cross-cluster for subject overlap
 // Use only for clustered JetStream
 // Read lock should be held.
-func (jsc *jetStreamCluster) subjectsOverlap(acc string, subjects []string, osa *streamAssignment) bool {
+func (jsc *jetStreamCluster) subjectsOverlap(acc string, subjects []string, sharding *StreamSharding, osa *streamAssignment) bool {
 	asa := jsc.streams[acc]
 	for _, sa := range asa {
 		// can't overlap yourself, assume osa pre-checked for deep equal if passed
 		if osa != nil && sa == osa {
 			continue
 		}
+		// Shards of the same stream share their subjects.
+		if sharding.isSibling(sa.Config.Sharding) {
+			continue
+		}
 		for _, subj := range sa.Config.Subjects {
 			for _, tsubj := range subjects {
 				if SubjectsCollide(tsubj, subj) {
@@ -1326,6 +1356,10 @@ func (js *jetStream) monitorCluster() {
 		if js.isMetaRecovering() {
 			return
 		}
+		// Pending atomic publishes across streams are not part of the snapshot.
+		if js.hasAtomicTxns() {
+			return
+		}
 		// For the meta layer we want to snapshot when asked if we need one or have any entries that we can compact.
 		if ne, _ := n.Size(); ne > 0 || n.NeedSnapshot() {
 			if err := n.InstallSnapshot(js.metaSnapshot()); err == nil {
@@ -1710,6 +1744,7 @@ func (sa *streamAssignment) copyGroup() *streamAssignment {
 	csa, cg := *sa, *sa.Group
 	csa.Group = &cg
 	csa.Group.Peers = copyStrings(sa.Group.Peers)
+	csa.Group.Readers = copyStrings(sa.Group.Readers)
 	return &csa
 }
 
@@ -1999,6 +2034,22 @@ func (js *jetStream) applyMetaEntries(entries []*Entry, ru *recoveryUpdates) (bo
 					// similar to a removal and snapshot to collapse old entries.
 					didRemoveStream = true
 				}
+			case renameStreamOp:
+				sr, err := decodeStreamRename(buf[1:])
+				if err != nil {
+					js.srv.Errorf("JetStream cluster failed to decode stream rename: %q", buf[1:])
+					return didSnap, didRemoveStream, didRemoveConsumer, err
+				}
+				js.processStreamRename(sr, ru)
+				// Snapshot right away, a replay would bring back the stream under its old name first.
+				didRemoveStream = true
+			case atomicTxnOp:
+				tu, err := decodeAtomicTxnUpdate(buf[1:])
+				if err != nil {
+					js.srv.Errorf("JetStream cluster failed to decode atomic publish update: %q", buf[1:])
+					return didSnap, didRemoveStream, didRemoveConsumer, err
+				}
+				js.processAtomicTxn(tu, isRecovering)
 			default:
 				panic(fmt.Sprintf("JetStream Cluster Unknown meta entry op type: %v", entryOp(buf[0])))
 			}
@@ -2019,6 +2070,18 @@ func (rg *raftGroup) isMember(id string) bool {
 	return false
 }
 
+func (rg *raftGroup) isReader(id string) bool {
+	if rg == nil {
+		return false
+	}
+	for _, peer := range rg.Readers {
+		if peer == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (rg *raftGroup) setPreferred() {
 	if rg == nil || len(rg.Peers) == 0 {
 		return
@@ -2077,9 +2140,14 @@ func (js *jetStream) createRaftGroup(accName string, rg *raftGroup, storage Stor
 
 	storeDir := filepath.Join(js.config.StoreDir, sysAcc.Name, defaultStoreDirName, rg.Name)
 	var store StreamStore
-	if storage == FileStorage {
+	if storage.accounting() == FileStorage {
+		wal := s.getOpts().JetStreamRaftWAL
+		bs := uint64(defaultMediumBlockSize)
+		if wal.BlockSize > 0 {
+			bs = wal.BlockSize
+		}
 		fs, err := newFileStoreWithCreated(
-			FileStoreConfig{StoreDir: storeDir, BlockSize: defaultMediumBlockSize, AsyncFlush: false, SyncInterval: 5 * time.Minute, srv: s},
+			FileStoreConfig{StoreDir: storeDir, BlockSize: bs, AsyncFlush: false, SyncInterval: 5 * time.Minute, Compression: wal.Compression, srv: s},
 			StreamConfig{Name: rg.Name, Storage: FileStorage, Metadata: labels},
 			time.Now().UTC(),
 			s.jsKeyGen(s.getOpts().JetStreamKey, rg.Name),
@@ -2286,10 +2354,10 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 
 	const (
 		compactInterval = 2 * time.Minute
-		compactSizeMin  = 8 * 1024 * 1024
-		compactNumMin   = 65536
 		minSnapDelta    = 10 * time.Second
 	)
+	compactSizeMin, compactNumMin := s.getOpts().JetStreamRaftWAL.Stream.limits(8*1024*1024, 65536)
+	wcch := mset.compactWALC()
 
 	// Spread these out for large numbers on server restart.
 	rci := time.Duration(rand.Int63n(int64(time.Minute)))
@@ -2321,8 +2389,12 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 	isRecovering := true
 
 	// Should only to be called from leader.
-	doSnapshot := func() {
-		if mset == nil || isRecovering || isRestore || time.Since(lastSnapTime) < minSnapDelta {
+	doSnapshot := func(force bool) {
+		if mset == nil || isRecovering || isRestore || (!force && time.Since(lastSnapTime) < minSnapDelta) {
+			return
+		}
+		// Messages prepared for an atomic publish across streams are not part of the snapshot.
+		if mset.hasAtomicTxn() {
 			return
 		}
 
@@ -2335,7 +2407,7 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 		// This shouldn't happen for streams like it can for pull
 		// consumers on idle streams but better to be safe than sorry!
 		ne, nb := n.Size()
-		if curState == lastState && ne < compactNumMin && nb < compactSizeMin {
+		if !force && curState == lastState && ne < compactNumMin && nb < compactSizeMin {
 			return
 		}
 
@@ -2471,9 +2543,9 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 							aq.recycle(&ces)
 							return
 						}
-					} else if isOutOfSpaceErr(err) {
+					} else {
 						// If applicable this will tear all of this down, but don't assume so and return.
-						s.handleOutOfSpace(mset)
+						s.handleStorageError(mset, err)
 					}
 				}
 			}
@@ -2488,7 +2560,7 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 					lastState.firstNeedsUpdate = true
 					lastSnapTime = time.Time{}
 				}
-				doSnapshot()
+				doSnapshot(false)
 			}
 
 		case isLeader = <-lch:
@@ -2501,10 +2573,10 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 				}
 				if isRestore {
 					acc, _ := s.LookupAccount(sa.Client.serviceAccount())
-					restoreDoneCh = s.processStreamRestore(sa.Client, acc, sa.Config, _EMPTY_, sa.Reply, _EMPTY_)
+					restoreDoneCh = s.processStreamRestore(sa.Client, acc, sa.Config, sa.Restore, sa.RestoreOpts, _EMPTY_, sa.Reply, _EMPTY_)
 					continue
 				} else if n != nil && n.NeedSnapshot() {
-					doSnapshot()
+					doSnapshot(false)
 				}
 				// Always cancel if this was running.
 				stopDirectMonitoring()
@@ -2584,7 +2656,11 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 			stopDirectMonitoring()
 
 		case <-t.C:
-			doSnapshot()
+			doSnapshot(false)
+
+		case done := <-wcch:
+			doSnapshot(true)
+			close(done)
 
 		case <-uch:
 			// keep stream assignment current
@@ -3011,8 +3087,8 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 						// and what we got.
 					}
 
-					// Only return in place if we are going to reset our stream or we are out of space, or we are closed.
-					if isClusterResetErr(err) || isOutOfSpaceErr(err) || err == errStreamClosed {
+					// Only return in place if we are going to reset our stream or our storage failed, or we are closed.
+					if isClusterResetErr(err) || classifyStorageError(err) != StorageErrorNone || err == errStreamClosed {
 						return err
 					}
 					s.Debugf("Apply stream entries for '%s > %s' got error processing message: %v",
@@ -3108,6 +3184,14 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 						s.sendAPIResponse(sp.Client, mset.account(), sp.Subject, sp.Reply, _EMPTY_, s.jsonResponse(resp))
 					}
 				}
+			case truncateStreamOp:
+				mset.applyStreamTruncate(buf[1:], isRecovering)
+			case atomicPublishOp:
+				mset.applyAtomicPublish(buf[1:], isRecovering)
+			case atomicPrepareOp:
+				mset.applyAtomicPrepare(buf[1:], isRecovering)
+			case atomicResolveOp:
+				mset.applyAtomicResolve(buf[1:], isRecovering)
 			default:
 				panic(fmt.Sprintf("JetStream Cluster Unknown group entry op type: %v", op))
 			}
@@ -3234,6 +3318,8 @@ func (js *jetStream) processStreamLeaderChange(mset *stream, isLeader bool) {
 	mset.clMu.Lock()
 	mset.inflight = nil
 	mset.clMu.Unlock()
+	// Hold back messages while prepared for an atomic publish across streams.
+	mset.atomicTxnLeaderChange(isLeader)
 
 	js.mu.Lock()
 	s, account, err := js.srv, sa.Client.serviceAccount(), sa.err
@@ -3287,13 +3373,20 @@ func (js *jetStream) processStreamLeaderChange(mset *stream, isLeader bool) {
 	} else {
 		msetCfg := mset.config()
 		resp.StreamInfo = &StreamInfo{
-			Created:   mset.createdTime(),
-			State:     mset.state(),
-			Config:    *setDynamicStreamMetadata(&msetCfg),
-			Cluster:   js.clusterInfo(mset.raftGroup()),
-			Sources:   mset.sourcesInfo(),
-			Mirror:    mset.mirrorInfo(),
-			TimeStamp: time.Now().UTC(),
+			Created:        mset.createdTime(),
+			State:          mset.state(),
+			Config:         *setDynamicStreamMetadata(&msetCfg),
+			Cluster:        js.clusterInfo(mset.raftGroup()),
+			Sources:        mset.sourcesInfo(),
+			PushMirrors:    mset.pushMirrorsInfo(),
+			Rejections:     mset.rejections(),
+			StorageFailure: mset.storageFailure(),
+			Durability:     mset.durability(),
+			Spilled:        mset.isSpilled(),
+			Repair:         mset.storeRepair(),
+			Blocks:         mset.blocks(),
+			Mirror:         mset.mirrorInfo(),
+			TimeStamp:      time.Now().UTC(),
 		}
 		resp.DidCreate = true
 		s.sendAPIResponse(client, acc, subject, reply, _EMPTY_, s.jsonResponse(&resp))
@@ -3463,7 +3556,10 @@ func (js *jetStream) processStreamAssignment(sa *streamAssignment) bool {
 
 	// Check if this is for us..
 	if isMember {
+		s.removeReadReplica(acc, sa.Config.Name)
 		js.processClusterCreateStream(acc, sa)
+	} else if sa.Group.isReader(ourID) {
+		js.processReadReplica(acc, sa)
 	} else if mset, _ := acc.lookupStream(sa.Config.Name); mset != nil {
 		// We have one here even though we are not a member. This can happen on re-assignment.
 		s.removeStream(ourID, mset, sa)
@@ -3522,6 +3618,12 @@ func (js *jetStream) processUpdateStreamAssignment(sa *streamAssignment) {
 	}
 	sa.consumers = osa.consumers
 	sa.err = osa.err
+	sa.scale = osa.scale
+
+	// Track the progress of replicas we are adding.
+	if sa.Config.Replicas != osa.Config.Replicas && !sa.recovering {
+		sa.scale = newStreamScale(osa.Config.Replicas, sa.Config.Replicas)
+	}
 
 	// If we detect we are scaling down to 1, non-clustered, and we had a previous node, clear it here.
 	if sa.Config.Replicas == 1 && sa.Group.node != nil {
@@ -3551,7 +3653,10 @@ func (js *jetStream) processUpdateStreamAssignment(sa *streamAssignment) {
 
 	// Check if this is for us..
 	if isMember {
+		s.removeReadReplica(acc, sa.Config.Name)
 		js.processClusterUpdateStream(acc, osa, sa)
+	} else if sa.Group.isReader(ourID) {
+		js.processReadReplica(acc, sa)
 	} else if mset, _ := acc.lookupStream(sa.Config.Name); mset != nil {
 		// We have one here even though we are not a member. This can happen on re-assignment.
 		s.removeStream(ourID, mset, sa)
@@ -3718,13 +3823,20 @@ func (js *jetStream) processClusterUpdateStream(acc *Account, osa, sa *streamAss
 	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
 	msetCfg := mset.config()
 	resp.StreamInfo = &StreamInfo{
-		Created:   mset.createdTime(),
-		State:     mset.state(),
-		Config:    *setDynamicStreamMetadata(&msetCfg),
-		Cluster:   js.clusterInfo(mset.raftGroup()),
-		Mirror:    mset.mirrorInfo(),
-		Sources:   mset.sourcesInfo(),
-		TimeStamp: time.Now().UTC(),
+		Created:        mset.createdTime(),
+		State:          mset.state(),
+		Config:         *setDynamicStreamMetadata(&msetCfg),
+		Cluster:        js.clusterInfo(mset.raftGroup()),
+		Mirror:         mset.mirrorInfo(),
+		Sources:        mset.sourcesInfo(),
+		PushMirrors:    mset.pushMirrorsInfo(),
+		Rejections:     mset.rejections(),
+		StorageFailure: mset.storageFailure(),
+		Durability:     mset.durability(),
+		Spilled:        mset.isSpilled(),
+		Repair:         mset.storeRepair(),
+		Blocks:         mset.blocks(),
+		TimeStamp:      time.Now().UTC(),
 	}
 
 	s.sendAPIResponse(client, acc, subject, reply, _EMPTY_, s.jsonResponse(&resp))
@@ -3786,13 +3898,20 @@ func (js *jetStream) processClusterCreateStream(acc *Account, sa *streamAssignme
 							var resp = JSApiStreamCreateResponse{ApiResponse: ApiResponse{Type: JSApiStreamCreateResponseType}}
 							msetCfg := mset.config()
 							resp.StreamInfo = &StreamInfo{
-								Created:   mset.createdTime(),
-								State:     mset.state(),
-								Config:    *setDynamicStreamMetadata(&msetCfg),
-								Cluster:   js.clusterInfo(mset.raftGroup()),
-								Sources:   mset.sourcesInfo(),
-								Mirror:    mset.mirrorInfo(),
-								TimeStamp: time.Now().UTC(),
+								Created:        mset.createdTime(),
+								State:          mset.state(),
+								Config:         *setDynamicStreamMetadata(&msetCfg),
+								Cluster:        js.clusterInfo(mset.raftGroup()),
+								Sources:        mset.sourcesInfo(),
+								PushMirrors:    mset.pushMirrorsInfo(),
+								Rejections:     mset.rejections(),
+								StorageFailure: mset.storageFailure(),
+								Durability:     mset.durability(),
+								Spilled:        mset.isSpilled(),
+								Repair:         mset.storeRepair(),
+								Blocks:         mset.blocks(),
+								Mirror:         mset.mirrorInfo(),
+								TimeStamp:      time.Now().UTC(),
 							}
 							s.sendAPIResponse(client, acc, subject, reply, _EMPTY_, s.jsonResponse(&resp))
 						}
@@ -3903,7 +4022,7 @@ func (js *jetStream) processClusterCreateStream(acc *Account, sa *streamAssignme
 		// If we are restoring, process that first.
 		if sa.Restore != nil {
 			// We are restoring a stream here.
-			restoreDoneCh := s.processStreamRestore(sa.Client, acc, sa.Config, _EMPTY_, sa.Reply, _EMPTY_)
+			restoreDoneCh := s.processStreamRestore(sa.Client, acc, sa.Config, sa.Restore, sa.RestoreOpts, _EMPTY_, sa.Reply, _EMPTY_)
 			s.startGoRoutine(func() {
 				defer s.grWG.Done()
 				select {
@@ -4736,10 +4855,11 @@ func (js *jetStream) monitorConsumer(o *consumer, ca *consumerAssignment) {
 
 	const (
 		compactInterval = 2 * time.Minute
-		compactSizeMin  = 64 * 1024 // What is stored here is always small for consumers.
-		compactNumMin   = 1024
 		minSnapDelta    = 10 * time.Second
 	)
+	// What is stored here is always small for consumers.
+	compactSizeMin, compactNumMin := s.getOpts().JetStreamRaftWAL.Consumer.limits(64*1024, 1024)
+	wcch := o.compactWALC()
 
 	// Spread these out for large numbers on server restart.
 	rci := time.Duration(rand.Int63n(int64(time.Minute)))
@@ -4951,6 +5071,12 @@ func (js *jetStream) monitorConsumer(o *consumer, ca *consumerAssignment) {
 
 		case <-t.C:
 			doSnapshot(false)
+
+		case done := <-wcch:
+			// Clear the hash of the last snapshot so we install one even if the state did not change.
+			lastSnap = nil
+			doSnapshot(true)
+			close(done)
 		}
 	}
 }
@@ -5055,6 +5181,19 @@ func (js *jetStream) applyConsumerEntries(o *consumer, ce *CommittedEntry, isLea
 				if err := o.processReplicatedAck(dseq, sseq); err == errConsumerClosed {
 					return err
 				}
+			case updateAcksUpToOp:
+				sseq, n := binary.Uvarint(buf[1:])
+				if n <= 0 {
+					if mset, node := o.streamAndNode(); mset != nil && node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode consumer ack update for '%s > %s > %s' [%s]",
+							mset.account(), mset.name(), o, node.Group())
+					}
+					panic(errBadAckUpdate.Error())
+				}
+				if err := o.processReplicatedAcksUpTo(sseq); err == errConsumerClosed {
+					return err
+				}
 			case updateSkipOp:
 				o.mu.Lock()
 				if !o.isLeader() {
@@ -5081,6 +5220,30 @@ func (js *jetStream) applyConsumerEntries(o *consumer, ce *CommittedEntry, isLea
 					}
 				}
 				o.mu.Unlock()
+			case resetConsumerStateOp:
+				// These are handled in place in leaders.
+				if !isLeader {
+					state, err := decodeConsumerState(buf[1:])
+					if err != nil {
+						if mset, node := o.streamAndNode(); mset != nil && node != nil {
+							s := js.srv
+							s.Errorf("JetStream cluster could not decode consumer state reset for '%s > %s > %s' [%s]",
+								mset.account(), mset.name(), o, node.Group())
+						}
+						panic(err.Error())
+					}
+					o.mu.Lock()
+					err = o.resetState(state)
+					o.mu.Unlock()
+					if err != nil {
+						o.mu.RLock()
+						s, acc, mset, name := o.srv, o.acc, o.mset, o.name
+						o.mu.RUnlock()
+						if s != nil && mset != nil {
+							s.Warnf("Consumer '%s > %s > %s' error on state reset: %v", acc, mset.name(), name, err)
+						}
+					}
+				}
 			default:
 				panic(fmt.Sprintf("JetStream Cluster Unknown group entry op type: %v", entryOp(buf[0])))
 			}
@@ -5148,6 +5311,50 @@ func (o *consumer) processReplicatedAck(dseq, sseq uint64) error {
 	return nil
 }
 
+// Applies a cumulative ack, acknowledging all pending messages up to and including sseq.
+func (o *consumer) processReplicatedAcksUpTo(sseq uint64) error {
+	o.mu.Lock()
+	// Update activity.
+	o.lat = time.Now()
+
+	// Gather what is acknowledged before the store drops it from pending.
+	var acked []uint64
+	if o.retention != LimitsPolicy {
+		if state, err := o.store.BorrowState(); err == nil && sseq > state.AckFloor.Stream {
+			for seq := range state.Pending {
+				if seq <= sseq {
+					acked = append(acked, seq)
+				}
+			}
+		}
+	}
+	// Do actual ack update to store.
+	o.store.UpdateAcksUpTo(sseq)
+
+	mset := o.mset
+	if o.closed || mset == nil {
+		o.mu.Unlock()
+		return errConsumerClosed
+	}
+	if mset.closed.Load() {
+		o.mu.Unlock()
+		return errStreamClosed
+	}
+
+	// Check if we have a reply that was requested.
+	if reply := o.replies[sseq]; reply != _EMPTY_ {
+		o.outq.sendMsg(reply, nil)
+		delete(o.replies, sseq)
+	}
+	o.mu.Unlock()
+
+	slices.Sort(acked)
+	for _, seq := range acked {
+		mset.ackMsg(o, seq)
+	}
+	return nil
+}
+
 var errBadAckUpdate = errors.New("jetstream cluster bad replicated ack update")
 var errBadDeliveredUpdate = errors.New("jetstream cluster bad replicated delivered update")
 
@@ -5588,6 +5795,7 @@ func (js *jetStream) processLeaderChange(isLeader bool) {
 
 	if isLeader {
 		js.startUpdatesSub()
+		js.scheduleAtomicTxnChecks()
 	} else {
 		js.stopUpdatesSub()
 		// TODO(dlc) - stepdown.
@@ -5601,7 +5809,7 @@ func (js *jetStream) processLeaderChange(isLeader bool) {
 			for _, sa := range asa {
 				if sa.Sync == _EMPTY_ {
 					s.Warnf("Stream assignment corrupt for stream '%s > %s'", acc, sa.Config.Name)
-					nsa := &streamAssignment{Group: sa.Group, Config: sa.Config, Subject: sa.Subject, Reply: sa.Reply, Client: sa.Client}
+					nsa := &streamAssignment{Group: sa.Group, Config: sa.Config, Subject: sa.Subject, Reply: sa.Reply, Client: sa.Client, Tokens: sa.Tokens}
 					nsa.Sync = syncSubjForStream()
 					cc.meta.Propose(encodeUpdateStreamAssignment(nsa))
 				}
@@ -5652,6 +5860,7 @@ func (cc *jetStreamCluster) remapStreamAssignment(sa *streamAssignment, removePe
 type selectPeerError struct {
 	excludeTag  bool
 	offline     bool
+	maintenance bool
 	noStorage   bool
 	uniqueTag   bool
 	misc        bool
@@ -5670,6 +5879,7 @@ func (e *selectPeerError) Error() string {
 	}
 	b.WriteString("no suitable peers for placement")
 	writeBoolErrReason(e.offline, "peer offline")
+	writeBoolErrReason(e.maintenance, "peer in maintenance")
 	writeBoolErrReason(e.excludeTag, "exclude tag set")
 	writeBoolErrReason(e.noStorage, "insufficient storage")
 	writeBoolErrReason(e.uniqueTag, "server tag not unique")
@@ -5709,6 +5919,7 @@ func (e *selectPeerError) accumulate(eAdd *selectPeerError) {
 		}
 	}
 	acc(&e.offline, eAdd.offline)
+	acc(&e.maintenance, eAdd.maintenance)
 	acc(&e.excludeTag, eAdd.excludeTag)
 	acc(&e.noStorage, eAdd.noStorage)
 	acc(&e.uniqueTag, eAdd.uniqueTag)
@@ -5862,6 +6073,13 @@ func (cc *jetStreamCluster) selectPeerGroup(r int, cluster string, cfg *StreamCo
 			continue
 		}
 
+		// Peers in maintenance keep what they have, but do not take on anything new.
+		if ni.maintenance {
+			s.Debugf("Peer selection: discard %s@%s reason: in maintenance", ni.name, ni.cluster)
+			err.maintenance = true
+			continue
+		}
+
 		if ni.tags.Contains(jsExcludePlacement) {
 			s.Debugf("Peer selection: discard %s@%s tags: %v reason: %s present",
 				ni.name, ni.cluster, ni.tags, jsExcludePlacement)
@@ -5887,7 +6105,7 @@ func (cc *jetStreamCluster) selectPeerGroup(r int, cluster string, cfg *StreamCo
 
 		var available uint64
 		if ni.stats != nil {
-			switch cfg.Storage {
+			switch cfg.Storage.accounting() {
 			case MemoryStorage:
 				used := ni.stats.ReservedMemory
 				if ni.stats.Memory > used {
@@ -6112,13 +6330,21 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 
 	// Capture if we have existing assignment first.
 	if osa := js.streamAssignment(acc.Name, cfg.Name); osa != nil {
-		if !reflect.DeepEqual(osa.Config, cfg) {
+		// A retry of a create that was applied already gets the current stream.
+		if config.Token != _EMPTY_ && slices.Contains(osa.Tokens, config.Token) {
+			cfg = osa.Config
+		} else if !reflect.DeepEqual(osa.Config, cfg) {
 			resp.Error = NewJSStreamNameExistError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 			return
 		}
 		// This is an equal assignment.
 		self, rg, syncSubject = osa, osa.Group, osa.Sync
+	} else if acc.JetStreamFrozen() {
+		// No new streams while the account is frozen.
+		resp.Error = NewJSAccountFrozenError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
 	}
 
 	if cfg.Sealed {
@@ -6128,7 +6354,7 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 	}
 
 	// Check for subject collisions here.
-	if cc.subjectsOverlap(acc.Name, cfg.Subjects, self) {
+	if cc.subjectsOverlap(acc.Name, cfg.Subjects, cfg.Sharding, self) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -6171,6 +6397,14 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 		rg = nrg
 		// Pick a preferred leader.
 		rg.setPreferred()
+		// Place any read replicas outside of the group.
+		readers, err := cc.selectReadReplicas(cfg, rg)
+		if err != nil {
+			resp.Error = NewJSClusterNoPeersError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+		rg.Readers = readers
 	}
 
 	if syncSubject == _EMPTY_ {
@@ -6178,6 +6412,10 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 	}
 	// Sync subject for post snapshot sync.
 	sa := &streamAssignment{Group: rg, Sync: syncSubject, Config: cfg, Subject: subject, Reply: reply, Client: ci, Created: time.Now().UTC()}
+	if self != nil {
+		sa.Tokens = self.Tokens
+	}
+	sa.Tokens = addIdempotencyToken(sa.Tokens, config.Token)
 	if err := cc.meta.Propose(encodeAddStreamAssignment(sa)); err == nil {
 		// On success, add this as an inflight proposal so we can apply limits
 		// on concurrent create requests while this stream assignment has
@@ -6238,7 +6476,7 @@ func sysRequest[T any](s *Server, subjFormat string, args ...any) (*T, error) {
 	}
 }
 
-func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, cfg *StreamConfig, peerSet []string, pedantic bool) {
+func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, cfg *StreamConfig, peerSet []string, pedantic bool, token string) {
 	js, cc := s.getJetStreamCluster()
 	if js == nil || cc == nil {
 		return
@@ -6262,6 +6500,18 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 		return
 	}
 
+	// A retry of an update that was applied already is not applied again,
+	// we re-propose the current assignment for the stream leader to respond.
+	if token != _EMPTY_ && slices.Contains(osa.Tokens, token) {
+		sa := osa.copyGroup()
+		sa.Subject, sa.Reply, sa.Client = subject, reply, ci
+		meta.Propose(encodeUpdateStreamAssignment(sa))
+		return
+	}
+
+	// The pause is only changed through the pause and resume API.
+	cfg.Pause = osa.Config.Pause
+
 	// Update asset version metadata.
 	setStaticStreamMetadata(cfg, osa.Config)
 
@@ -6282,6 +6532,18 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
 	}
+	// Changing the retention policy needs the consumers to allow the new one.
+	if newCfg.Retention != osa.Config.Retention {
+		consumers := make(map[string]*ConsumerConfig, len(osa.consumers))
+		for _, ca := range osa.consumers {
+			consumers[ca.Name] = ca.Config
+		}
+		if err := checkRetentionMigration(newCfg, consumers); err != nil {
+			resp.Error = NewJSStreamUpdateError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+	}
 	// Check for mirror changes which are not allowed.
 	if !reflect.DeepEqual(newCfg.Mirror, osa.Config.Mirror) {
 		resp.Error = NewJSStreamMirrorNotUpdatableError()
@@ -6290,7 +6552,7 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 	}
 
 	// Check for subject collisions here.
-	if cc.subjectsOverlap(acc.Name, cfg.Subjects, osa) {
+	if cc.subjectsOverlap(acc.Name, cfg.Subjects, cfg.Sharding, osa) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -6365,8 +6627,29 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 		return
 	}
 
+	// Every replica converts its store when applying the update. The raft group keeps running
+	// with the log it was created with, and uses the new storage type once created again.
+	if newCfg.Storage != osa.Config.Storage {
+		if isMoveRequest || isReplicaChange {
+			resp.Error = NewJSStreamUpdateError(errors.New("stream configuration update can not convert storage while moving or scaling"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+		rg.Storage = newCfg.Storage
+	}
+
 	if isReplicaChange {
 		isScaleUp := newCfg.Replicas > len(rg.Peers)
+		// Shared consumers are only arbitrated on streams that are not replicated.
+		if newCfg.Replicas > 1 {
+			for _, ca := range osa.consumers {
+				if ca.Config != nil && ca.Config.Shared {
+					resp.Error = NewJSConsumerSharedReplicatedStreamError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+					return
+				}
+			}
+		}
 		// We are adding new peers here.
 		if isScaleUp {
 			// Check that we have the allocation available.
@@ -6598,7 +6881,17 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 		rg.Preferred = _EMPTY_
 	}
 
+	// Now that the peers are settled, make sure our read replicas stay outside of the group.
+	readers, perr := cc.selectReadReplicas(newCfg, rg)
+	if perr != nil {
+		resp.Error = NewJSClusterNoPeersError(perr)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+	rg.Readers = readers
+
 	sa := &streamAssignment{Group: rg, Sync: osa.Sync, Created: osa.Created, Config: newCfg, Subject: subject, Reply: reply, Client: ci}
+	sa.Tokens = addIdempotencyToken(osa.Tokens, token)
 	meta.Propose(encodeUpdateStreamAssignment(sa))
 
 	// Process any staged consumers.
@@ -6724,6 +7017,10 @@ func (s *Server) jsClusteredStreamRestoreRequest(
 	sa := &streamAssignment{Group: rg, Sync: syncSubjForStream(), Config: cfg, Subject: subject, Reply: reply, Client: ci, Created: time.Now().UTC()}
 	// Now add in our restore state and pre-select a peer to handle the actual receipt of the snapshot.
 	sa.Restore = &req.State
+	if req.StreamRestoreOptions != (StreamRestoreOptions{}) {
+		opts := req.StreamRestoreOptions
+		sa.RestoreOpts = &opts
+	}
 	cc.meta.Propose(encodeAddStreamAssignment(sa))
 }
 
@@ -6745,7 +7042,7 @@ func (s *Server) allPeersOffline(rg *raftGroup) bool {
 
 // This will do a scatter and gather operation for all streams for this account. This is only called from metadata leader.
 // This will be running in a separate Go routine.
-func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filter string, offset int, subject, reply string, rmsg []byte) {
+func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filter string, lf *ApiListFilter, offset int, subject, reply string, rmsg []byte) {
 	defer s.grWG.Done()
 
 	js, cc := s.getJetStreamCluster()
@@ -6760,6 +7057,9 @@ func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filt
 		if IsNatsErr(sa.err, JSClusterNotAssignedErr) {
 			continue
 		}
+		if sa.Config == nil || !lf.matches(sa.Config.Description, sa.Config.Metadata) {
+			continue
+		}
 
 		if filter != _EMPTY_ {
 			// These could not have subjects auto-filled in since they are raw and unprocessed.
@@ -6907,7 +7207,7 @@ LOOP:
 
 // This will do a scatter and gather operation for all consumers for this stream and account.
 // This will be running in a separate Go routine.
-func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, offset int, stream, subject, reply string, rmsg []byte) {
+func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, filter string, lf *ApiListFilter, offset int, stream, subject, reply string, rmsg []byte) {
 	defer s.grWG.Done()
 
 	js, cc := s.getJetStreamCluster()
@@ -6922,7 +7222,9 @@ func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, of
 		if sa := sas[stream]; sa != nil {
 			// Copy over since we need to sort etc.
 			for _, ca := range sa.consumers {
-				consumers = append(consumers, ca)
+				if consumerMatchesListFilter(ca.Config, filter, lf) {
+					consumers = append(consumers, ca)
+				}
 			}
 		}
 	}
@@ -7061,7 +7363,7 @@ func decodeStreamPurge(buf []byte) (*streamPurge, error) {
 	return &sp, err
 }
 
-func (s *Server) jsClusteredConsumerDeleteRequest(ci *ClientInfo, acc *Account, stream, consumer, subject, reply string, rmsg []byte) {
+func (s *Server) jsClusteredConsumerDeleteRequest(ci *ClientInfo, acc *Account, stream, consumer, subject, reply string, rmsg []byte, force bool) {
 	js, cc := s.getJetStreamCluster()
 	if js == nil || cc == nil {
 		return
@@ -7094,6 +7396,11 @@ func (s *Server) jsClusteredConsumerDeleteRequest(ci *ClientInfo, acc *Account,
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
 	}
+	if oca.Config != nil && oca.Config.Protected && !force {
+		resp.Error = NewJSConsumerProtectedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
 	oca.deleted = true
 	ca := &consumerAssignment{Group: oca.Group, Stream: stream, Name: consumer, Config: oca.Config, Subject: subject, Reply: reply, Client: ci}
 	cc.meta.Propose(encodeDeleteConsumerAssignment(ca))
@@ -7235,6 +7542,16 @@ func (cc *jetStreamCluster) createGroupForConsumer(cfg *ConsumerConfig, sa *stre
 		}
 		// First shuffle the active peers and then select to account for replica = 1.
 		rand.Shuffle(len(active), func(i, j int) { active[i], active[j] = active[j], active[i] })
+		// Prefer peers that are not in maintenance.
+		slices.SortStableFunc(active, func(a, b string) int {
+			ma, mb := cc.s.peerInMaintenance(a), cc.s.peerInMaintenance(b)
+			if ma == mb {
+				return 0
+			} else if mb {
+				return -1
+			}
+			return 1
+		})
 		peers = active[:cfg.Replicas]
 	}
 	storage := sa.Config.Storage
@@ -7389,6 +7706,12 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 	setStaticConsumerMetadata(cfg, oldCfg)
 
 	// If this is new consumer.
+	isNew := ca == nil
+	if isNew && acc.JetStreamFrozen() {
+		resp.Error = NewJSAccountFrozenError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
 	if ca == nil {
 		if action == ActionUpdate {
 			resp.Error = NewJSConsumerDoesNotExistError()
@@ -7576,6 +7899,16 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 
 	// Do formal proposal.
 	cc.meta.Propose(encodeAddConsumerAssignment(ca))
+
+	if isNew && !cfg.Direct && sa.Config.MaxConsumersWarn > 0 {
+		var total int
+		for _, oca := range sa.consumers {
+			if oca.Config != nil && !oca.Config.Direct && !oca.deleted {
+				total++
+			}
+		}
+		s.checkConsumersSoftLimit(acc, sa.Config, total)
+	}
 }
 
 func encodeAddConsumerAssignment(ca *consumerAssignment) []byte {
@@ -7844,11 +8177,14 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 
 	mset.mu.RLock()
 	canRespond := !mset.cfg.NoAck && len(reply) > 0
-	name, stype, store := mset.cfg.Name, mset.cfg.Storage, mset.store
-	s, js, jsa, st, r, tierName, outq, node := mset.srv, mset.js, mset.jsa, mset.cfg.Storage, mset.cfg.Replicas, mset.tier, mset.outq, mset.node
+	name, stype, store := mset.cfg.Name, mset.stype, mset.store
+	s, js, jsa, st, r, tierName, outq, node := mset.srv, mset.js, mset.jsa, mset.stype, mset.cfg.Replicas, mset.tier, mset.outq, mset.node
+	// Replicas spill over to disk when applying instead of us rejecting at the memory limits.
+	spill := mset.canSpill()
 	maxMsgSize, lseq := int(mset.cfg.MaxMsgSize), mset.lseq
 	interestPolicy, discard, maxMsgs, maxBytes := mset.cfg.Retention != LimitsPolicy, mset.cfg.Discard, mset.cfg.MaxMsgs, mset.cfg.MaxBytes
 	isLeader, isSealed, compressOK := mset.isLeader(), mset.cfg.Sealed, mset.compressOK
+	hot, itr, headersOnly, subjectTokens := mset.hot, mset.itr, mset.cfg.HeadersOnly, mset.cfg.SubjectTokens
 	mset.mu.RUnlock()
 
 	// This should not happen but possible now that we allow scale up, and scale down where this could trigger.
@@ -7878,19 +8214,59 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 
 	// Bail here if sealed.
 	if isSealed {
+		mset.rejected(rejectOther)
 		var resp = JSPubAckResponse{PubAck: &PubAck{Stream: mset.name()}, Error: NewJSStreamSealedError()}
 		b, _ := json.Marshal(resp)
 		mset.outq.sendMsg(reply, b)
+		mset.quarantineMsg(subject, hdr, msg, NewJSStreamSealedError())
 		return NewJSStreamSealedError()
 	}
 
+	// The subject as it will be stored.
+	tsubj := subject
+	if itr != nil && (hot != nil || subjectTokens > 0) {
+		if ts, err := itr.Match(subject); err == nil {
+			tsubj = ts
+		}
+	}
+
+	// Check the tokens of the subject, as it will be stored.
+	if subjectTokens > 0 && numTokens(tsubj) != subjectTokens {
+		err := NewJSStreamSubjectTokensError(tsubj, subjectTokens)
+		mset.rejected(rejectSubjectTokens)
+		if canRespond {
+			b, _ := json.Marshal(&JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: err})
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, b, nil, 0))
+		}
+		mset.quarantineMsg(subject, hdr, msg, err)
+		return err
+	}
+
+	// Check the rate of the subject, as it will be stored.
+	if hot != nil && hot.track(tsubj) {
+		mset.rejected(rejectSubjectRate)
+		if canRespond {
+			b, _ := json.Marshal(&JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: NewJSStreamSubjectRateExceededError()})
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, b, nil, 0))
+		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSStreamSubjectRateExceededError())
+		return NewJSStreamSubjectRateExceededError()
+	}
+
+	// Drop the payload before the limit checks and the proposal if we only store headers.
+	if headersOnly {
+		hdr, msg = stripPayload(hdr, msg)
+	}
+
 	// Check here pre-emptively if we have exceeded this server limits.
-	if js.limitsExceeded(stype) {
+	if !spill && js.limitsExceeded(stype) {
 		s.resourcesExceededError()
+		mset.rejected(rejectLimits)
 		if canRespond {
 			b, _ := json.Marshal(&JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: NewJSInsufficientResourcesError()})
 			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, b, nil, 0))
 		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSInsufficientResourcesError())
 		// Stepdown regardless.
 		if node := mset.raftNode(); node != nil {
 			node.StepDown()
@@ -7899,17 +8275,19 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	}
 
 	// Check here pre-emptively if we have exceeded our account limits.
-	if exceeded, err := jsa.wouldExceedLimits(st, tierName, r, subject, hdr, msg); exceeded {
+	if exceeded, err := jsa.wouldExceedLimits(st, tierName, r, subject, hdr, msg); exceeded && !spill {
 		if err == nil {
 			err = NewJSAccountResourcesExceededError()
 		}
 		s.RateLimitWarnf("JetStream account limits exceeded for '%s': %s", jsa.acc().GetName(), err.Error())
+		mset.rejected(rejectLimits)
 		if canRespond {
 			var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 			resp.Error = err
 			response, _ = json.Marshal(resp)
 			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 		}
+		mset.quarantineMsg(subject, hdr, msg, err)
 		return err
 	}
 
@@ -7917,12 +8295,14 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	if maxMsgSize >= 0 && (len(hdr)+len(msg)) > maxMsgSize {
 		err := fmt.Errorf("JetStream message size exceeds limits for '%s > %s'", jsa.acc().Name, mset.cfg.Name)
 		s.RateLimitWarnf("%s", err.Error())
+		mset.rejected(rejectMaxSize)
 		if canRespond {
 			var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 			resp.Error = NewJSStreamMessageExceedsMaximumError()
 			response, _ = json.Marshal(resp)
 			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSStreamMessageExceedsMaximumError())
 		return err
 	}
 
@@ -7934,12 +8314,14 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		if len(hdr) > math.MaxUint16 {
 			err := fmt.Errorf("JetStream header size exceeds limits for '%s > %s'", jsa.acc().Name, mset.cfg.Name)
 			s.RateLimitWarnf("%s", err.Error())
+			mset.rejected(rejectMaxSize)
 			if canRespond {
 				var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 				resp.Error = NewJSStreamHeaderExceedsMaximumError()
 				response, _ = json.Marshal(resp)
 				outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 			}
+			mset.quarantineMsg(subject, hdr, msg, NewJSStreamHeaderExceedsMaximumError())
 			return err
 		}
 		// Expected last sequence per subject.
@@ -7961,6 +8343,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 				fseq, err = 0, nil
 			}
 			if err != nil || fseq != seq {
+				mset.rejected(rejectWrongLastSeq)
 				if canRespond {
 					var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 					resp.PubAck = &PubAck{Stream: name}
@@ -7968,11 +8351,13 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamWrongLastSequenceError(fseq))
 				return fmt.Errorf("last sequence by subject mismatch: %d vs %d", seq, fseq)
 			}
 		}
 		// Expected stream name can also be pre-checked.
 		if sname := getExpectedStream(hdr); sname != _EMPTY_ && sname != name {
+			mset.rejected(rejectOther)
 			if canRespond {
 				var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 				resp.PubAck = &PubAck{Stream: name}
@@ -7980,6 +8365,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 				b, _ := json.Marshal(resp)
 				outq.sendMsg(reply, b)
 			}
+			mset.quarantineMsg(subject, hdr, msg, NewJSStreamNotMatchError())
 			return errStreamMismatch
 		}
 		// Check for MsgIds here at the cluster level to avoid excessive CLFS accounting.
@@ -7991,6 +8377,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 				pubAck := append(buf[:0], mset.pubAck...)
 				seq := dde.seq
 				mset.mu.Unlock()
+				mset.rejected(rejectDuplicate)
 				// Should not return an invalid sequence, in that case timeout.
 				if canRespond {
 					if seq > 0 {
@@ -8018,6 +8405,18 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	// We only use mset.clseq for clustering and in case we run ahead of actual commits.
 	// Check if we need to set initial value here
 	mset.clMu.Lock()
+	// Bail here if held back by an atomic publish across streams.
+	if mset.atxnLock != _EMPTY_ {
+		mset.clMu.Unlock()
+		mset.rejected(rejectOther)
+		if canRespond {
+			var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: NewJSAtomicPublishInProgressError()}
+			response, _ = json.Marshal(resp)
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
+		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSAtomicPublishInProgressError())
+		return NewJSAtomicPublishInProgressError()
+	}
 	if mset.clseq == 0 || mset.clseq < lseq+mset.clfs {
 		// Re-capture
 		lseq = mset.lastSeq()
@@ -8058,12 +8457,14 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		if err != nil {
 			delete(mset.inflight, mset.clseq)
 			mset.clMu.Unlock()
+			mset.rejected(rejectLimits)
 			if canRespond {
 				var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
 				resp.Error = NewJSStreamStoreFailedError(err, Unless(err))
 				response, _ = json.Marshal(resp)
 				outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 			}
+			mset.quarantineMsg(subject, hdr, msg, NewJSStreamStoreFailedError(err, Unless(err)))
 			return err
 		}
 	}
@@ -8093,6 +8494,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	mset.clMu.Unlock()
 
 	if err != nil {
+		mset.rejected(rejectNoQuorum)
 		if mt != nil {
 			mset.getAndDeleteMsgTrace(mtKey)
 		}
@@ -8103,9 +8505,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 			// If we errored out respond here.
 			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 		}
-		if isOutOfSpaceErr(err) {
-			s.handleOutOfSpace(mset)
-		}
+		s.handleStorageError(mset, err)
 	}
 
 	return err
@@ -8131,6 +8531,11 @@ type streamSyncRequest struct {
 	FirstSeq       uint64 `json:"first_seq"`
 	LastSeq        uint64 `json:"last_seq"`
 	DeleteRangesOk bool   `json:"delete_ranges"`
+	ReadReplica    bool   `json:"read_replica,omitempty"`
+	// State of a read replica asking for what was removed from the messages it has.
+	State *readReplicaState `json:"state,omitempty"`
+	// Blocks signals we can take whole message blocks for older ranges.
+	Blocks bool `json:"blocks,omitempty"`
 }
 
 // Given a stream state that represents a snapshot, calculate the sync request based on our current state.
@@ -8145,7 +8550,7 @@ func (mset *stream) calculateSyncRequest(state *StreamState, snap *StreamReplica
 	if state.LastSeq >= snap.LastSeq {
 		return nil
 	}
-	return &streamSyncRequest{FirstSeq: state.LastSeq + 1, LastSeq: snap.LastSeq, Peer: mset.node.ID(), DeleteRangesOk: true}
+	return &streamSyncRequest{FirstSeq: state.LastSeq + 1, LastSeq: snap.LastSeq, Peer: mset.node.ID(), DeleteRangesOk: true, Blocks: true}
 }
 
 // processSnapshotDeletes will update our current store based on the snapshot
@@ -8439,7 +8844,10 @@ RETRY:
 		s.sendInternalMsgLocked(mrec.reply, _EMPTY_, nil, err.Error())
 	}
 
-	msgsQ := newIPQueue[*im](s, qname)
+	msgsQ := newIPQueue[*im](s, qname,
+		ipqSizeCalculation(func(mrec *im) uint64 { return uint64(len(mrec.msg) + len(mrec.reply)) }),
+		ipqLimits[*im](s.getOpts().JetStreamQueueLimits.Catchup),
+	)
 	defer msgsQ.unregister()
 
 	// Send our catchup request here.
@@ -8543,7 +8951,7 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 		return 0, errCatchupBadMsg
 	}
 	op := entryOp(msg[0])
-	if op != streamMsgOp && op != compressedStreamMsgOp && op != deleteRangeOp {
+	if op != streamMsgOp && op != compressedStreamMsgOp && op != deleteRangeOp && op != catchupBlockOp {
 		return 0, errCatchupBadMsg
 	}
 
@@ -8554,21 +8962,10 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 			return 0, errCatchupBadMsg
 		}
 		// Handle the delete range.
-		// Make sure the sequences match up properly.
-		mset.mu.Lock()
-		if len(mset.preAcks) > 0 {
-			for seq := dr.First; seq < dr.First+dr.Num; seq++ {
-				mset.clearAllPreAcks(seq)
-			}
-		}
-		if err = mset.store.SkipMsgs(dr.First, dr.Num); err != nil {
-			mset.mu.Unlock()
-			return 0, errCatchupWrongSeqForSkip
-		}
-		mset.lseq = dr.First + dr.Num - 1
-		lseq := mset.lseq
-		mset.mu.Unlock()
-		return lseq, nil
+		return mset.skipCatchupMsgs(dr.First, dr.Num)
+	}
+	if op == catchupBlockOp {
+		return mset.processCatchupBlock(mbuf)
 	}
 
 	if op == compressedStreamMsgOp {
@@ -8583,7 +8980,28 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 	if err != nil {
 		return 0, errCatchupBadMsg
 	}
+	return mset.storeCatchupMsg(subj, hdr, msg, seq, ts)
+}
+
+// Skips a range of deleted sequences on catchup.
+func (mset *stream) skipCatchupMsgs(first, num uint64) (uint64, error) {
+	// Make sure the sequences match up properly.
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	if len(mset.preAcks) > 0 {
+		for seq := first; seq < first+num; seq++ {
+			mset.clearAllPreAcks(seq)
+		}
+	}
+	if err := mset.store.SkipMsgs(first, num); err != nil {
+		return 0, errCatchupWrongSeqForSkip
+	}
+	mset.lseq = first + num - 1
+	return mset.lseq, nil
+}
 
+// Stores a message on catchup, messages to be skipped have no subject or timestamp.
+func (mset *stream) storeCatchupMsg(subj string, hdr, msg []byte, seq uint64, ts int64) (uint64, error) {
 	mset.mu.Lock()
 	st := mset.cfg.Storage
 	ddloaded := mset.ddloaded
@@ -8640,6 +9058,22 @@ func (mset *stream) handleClusterSyncRequest(sub *subscription, c *client, _ *Ac
 		// Log error.
 		return
 	}
+	// Read replicas do not know our last sequence, so they get whatever we have past theirs.
+	if sreq.ReadReplica {
+		if sreq.State != nil {
+			b, _ := json.Marshal(mset.readReplicaStateFor(sreq.State))
+			mset.srv.sendInternalMsgLocked(reply, _EMPTY_, nil, b)
+			return
+		}
+		var state StreamState
+		mset.store.FastState(&state)
+		if sreq.FirstSeq > state.LastSeq {
+			// EOF
+			mset.srv.sendInternalMsgLocked(reply, _EMPTY_, nil, nil)
+			return
+		}
+		sreq.LastSeq = state.LastSeq
+	}
 	mset.srv.startGoRoutine(func() { mset.runCatchup(reply, &sreq) })
 }
 
@@ -8740,6 +9174,49 @@ func (mset *stream) checkClusterInfo(ci *ClusterInfo) {
 	}
 }
 
+// streamScale tracks an increase of the replicas of a stream.
+type streamScale struct {
+	from, to int
+	start    time.Time
+}
+
+// Returns the tracking of added replicas, nil when scaling down.
+func newStreamScale(from, to int) *streamScale {
+	if to <= from {
+		return nil
+	}
+	return &streamScale{from: from, to: to, start: time.Now()}
+}
+
+// Reports the progress of added replicas, until all of them are current.
+func (js *jetStream) checkScaleInfo(sa *streamAssignment, ci *ClusterInfo) {
+	if js == nil || sa == nil || ci == nil {
+		return
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	sc := sa.scale
+	if sc == nil {
+		return
+	}
+	var current int
+	var lag uint64
+	if ci.Leader != _EMPTY_ {
+		current++
+	}
+	for _, r := range ci.Replicas {
+		if r.Current {
+			current++
+		}
+		lag += r.Lag
+	}
+	if current >= sc.to {
+		sa.scale = nil
+		return
+	}
+	ci.Scale = &ClusterScaleInfo{From: sc.from, To: sc.to, Current: current, Lag: lag, Elapsed: time.Since(sc.start)}
+}
+
 // Return a list of alternates, ranked by preference order to the request, of stream mirrors.
 // This allows clients to select or get more information about read replicas that could be a
 // better option to connect to versus the original source.
@@ -8815,19 +9292,28 @@ func (mset *stream) processClusterStreamInfoRequest(reply string) {
 	}
 
 	si := &StreamInfo{
-		Created:   mset.createdTime(),
-		State:     mset.state(),
-		Config:    config,
-		Cluster:   js.clusterInfo(mset.raftGroup()),
-		Sources:   mset.sourcesInfo(),
-		Mirror:    mset.mirrorInfo(),
-		TimeStamp: time.Now().UTC(),
+		Created:        mset.createdTime(),
+		State:          mset.state(),
+		Config:         config,
+		Cluster:        js.clusterInfo(mset.raftGroup()),
+		Sources:        mset.sourcesInfo(),
+		PushMirrors:    mset.pushMirrorsInfo(),
+		Rejections:     mset.rejections(),
+		StorageFailure: mset.storageFailure(),
+		Durability:     mset.durability(),
+		Spilled:        mset.isSpilled(),
+		Repair:         mset.storeRepair(),
+		Blocks:         mset.blocks(),
+		Mirror:         mset.mirrorInfo(),
+		EventTime:      mset.eventTime(),
+		TimeStamp:      time.Now().UTC(),
 	}
 
 	// Check for out of band catchups.
 	if mset.hasCatchupPeers() {
 		mset.checkClusterInfo(si.Cluster)
 	}
+	js.checkScaleInfo(mset.streamAssignment(), si.Cluster)
 
 	sysc.sendInternalMsg(reply, _EMPTY_, nil, si)
 }
@@ -8968,16 +9454,36 @@ func (mset *stream) runCatchup(sendSubject string, sreq *streamSyncRequest) {
 	seq, last := sreq.FirstSeq, sreq.LastSeq
 	mset.setCatchupPeer(sreq.Peer, last-seq)
 
+	// Read replicas can be far behind our first sequence, so move them up in one go.
+	if sreq.ReadReplica && sreq.DeleteRangesOk && seq < state.FirstSeq {
+		dr := DeleteRange{First: seq, Num: state.FirstSeq - seq}
+		s.sendInternalMsgLocked(sendSubject, _EMPTY_, nil, encodeDeleteRange(&dr))
+		seq = state.FirstSeq
+	}
+
+	// Read replicas sync continuously, so only log completion for peers.
+	logComplete := func() {
+		if !sreq.ReadReplica {
+			s.Noticef("Catchup for stream '%s > %s' complete", mset.account(), mset.name())
+		}
+	}
+
 	// Check if we can compress during this.
 	compressOk := mset.compressAllowed()
 
+	// Check if we can send whole message blocks for the older ranges.
+	var fs *fileStore
+	if sreq.Blocks && sreq.DeleteRangesOk {
+		fs, _ = mset.store.(*fileStore)
+	}
+
 	var spb int
 	const minWait = 5 * time.Second
 
 	sendNextBatchAndContinue := func(qch chan struct{}) bool {
 		// Check if we know we will not enter the loop because we are done.
 		if seq > last {
-			s.Noticef("Catchup for stream '%s > %s' complete", mset.account(), mset.name())
+			logComplete()
 			// EOF
 			s.sendInternalMsgLocked(sendSubject, _EMPTY_, nil, nil)
 			return false
@@ -9050,6 +9556,25 @@ func (mset *stream) runCatchup(sendSubject string, sreq *streamSyncRequest) {
 
 		var smv StoreMsg
 		for ; seq <= last && atomic.LoadInt64(&outb) <= maxOutBytes && atomic.LoadInt32(&outm) <= maxOutMsgs && s.gcbBelowMax(); seq++ {
+			// Blocks we no longer write to go whole, the tail of the stream goes message by message.
+			if fs != nil {
+				if cb := fs.catchupBlock(seq, last); cb != nil {
+					if dr.First > 0 {
+						sendDR()
+					}
+					sendEM(encodeCatchupBlock(cb, compressOk))
+					// The ack only accounts for one of the sequences of the block.
+					mset.decrementCatchupPeer(sreq.Peer, cb.last-seq)
+					if seq = cb.last; seq == last {
+						logComplete()
+						// EOF
+						s.sendInternalMsgLocked(sendSubject, _EMPTY_, nil, nil)
+						return false
+					}
+					continue
+				}
+			}
+
 			var sm *StoreMsg
 			var err error
 			// Is we should use load next do so here.
@@ -9127,7 +9652,7 @@ func (mset *stream) runCatchup(sendSubject string, sreq *streamSyncRequest) {
 				if drOk && dr.First > 0 {
 					sendDR()
 				}
-				s.Noticef("Catchup for stream '%s > %s' complete", mset.account(), mset.name())
+				logComplete()
 				// EOF
 				s.sendInternalMsgLocked(sendSubject, _EMPTY_, nil, nil)
 				return false
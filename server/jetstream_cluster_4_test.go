@@ -17,6 +17,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -33,6 +34,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -4452,3 +4454,2012 @@ func TestJetStreamClusterPreserveWALDuringCatchupWithMatchingTerm(t *testing.T)
 		}
 	}
 }
+
+func TestJetStreamClusterQuarantineRejectedMessages(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	req, err := json.Marshal(&StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo"},
+		Storage:    FileStorage,
+		Replicas:   3,
+		Quarantine: true,
+	})
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 2*time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		_, err := js.StreamInfo(JSQuarantineStream)
+		return err
+	})
+
+	// Rejected before proposing.
+	_, err = js.Publish("foo", []byte("WRONG STREAM"), nats.ExpectStream("OTHER"))
+	require_Error(t, err)
+	// Rejected when applied.
+	_, err = js.Publish("foo", []byte("BAD SEQ"), nats.ExpectLastSequence(22))
+	require_Error(t, err)
+
+	// Only the leader quarantines, so we should not have copies from the followers.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		si, err := js.StreamInfo(JSQuarantineStream)
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 2 {
+			return fmt.Errorf("expected 2 quarantined msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	time.Sleep(250 * time.Millisecond)
+	si, err := js.StreamInfo(JSQuarantineStream)
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+}
+
+func TestJetStreamClusterReadReplicas(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R5S", 5)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	streamRequest := func(api string, cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(api, cfg.Name), req, 2*time.Second)
+		require_NoError(t, err)
+		var scResp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+		return scResp.Error
+	}
+
+	// Check validation first.
+	apiErr := streamRequest(JSApiStreamCreateT, &StreamConfig{Name: "BAD", Storage: FileStorage, ReadReplicas: &StreamReadReplicas{}})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamReadReplicasInvalidErrF))
+	apiErr = streamRequest(JSApiStreamCreateT, &StreamConfig{Name: "BAD", Storage: FileStorage, Retention: InterestPolicy, ReadReplicas: &StreamReadReplicas{Replicas: 1}})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamReadReplicasInvalidErrF))
+
+	cfg := &StreamConfig{
+		Name:         "TEST",
+		Subjects:     []string{"foo.*"},
+		Storage:      FileStorage,
+		Replicas:     3,
+		ReadReplicas: &StreamReadReplicas{Replicas: 1},
+	}
+	require_True(t, streamRequest(JSApiStreamCreateT, cfg) == nil)
+
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish(fmt.Sprintf("foo.%d", i%2), []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	readReplica := func(s *Server) *stream {
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		if err != nil {
+			return nil
+		}
+		mset.mu.RLock()
+		defer mset.mu.RUnlock()
+		if !mset.readReplica {
+			return nil
+		}
+		return mset
+	}
+
+	// Exactly one server outside of the group should hold a read replica.
+	var rs *Server
+	var rr *stream
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		rs, rr = nil, nil
+		for _, s := range c.servers {
+			if mset := readReplica(s); mset != nil {
+				if rr != nil {
+					return errors.New("more than one read replica")
+				}
+				rs, rr = s, mset
+			}
+		}
+		if rr == nil {
+			return errors.New("no read replica")
+		}
+		if state := rr.state(); state.Msgs != 10 {
+			return fmt.Errorf("expected 10 msgs on read replica, got %d", state.Msgs)
+		}
+		return nil
+	})
+	require_False(t, rr.isLeader())
+	require_False(t, rr.isClustered())
+
+	// Direct gets are served by the read replica.
+	resp, err := nc.Request(fmt.Sprintf(JSReadReplicaMsgGetT, "TEST"), []byte(`{"seq":5}`), time.Second)
+	require_NoError(t, err)
+	require_Equal(t, resp.Header.Get(JSSequence), "5")
+	resp, err = nc.Request(fmt.Sprintf(JSReadReplicaGetLastBySubjectT, "TEST", "foo.0"), nil, time.Second)
+	require_NoError(t, err)
+	require_Equal(t, resp.Header.Get(JSSequence), "9")
+
+	// Local consumers see everything, including new messages.
+	inbox := nats.NewInbox()
+	sub := natsSubSync(t, nc, inbox)
+	req, err := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: ConsumerConfig{DeliverSubject: inbox, AckPolicy: AckNone}})
+	require_NoError(t, err)
+	resp, err = nc.Request(fmt.Sprintf(JSReadReplicaConsumerCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var ccResp JSApiConsumerCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+	require_True(t, ccResp.Error == nil)
+	require_True(t, ccResp.ConsumerInfo != nil)
+
+	for i := 0; i < 5; i++ {
+		_, err := js.Publish("foo.0", []byte("MORE"))
+		require_NoError(t, err)
+	}
+	checkSubsPending(t, sub, 15)
+
+	// The group does not know about this consumer.
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Consumers, 0)
+
+	// Messages removed from the stream are removed from the read replica.
+	checkReadReplica := func() {
+		t.Helper()
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			state := rr.state()
+			if state.Msgs != si.State.Msgs || state.FirstSeq != si.State.FirstSeq || state.LastSeq != si.State.LastSeq {
+				return fmt.Errorf("expected read replica state %+v, got %+v", si.State, state)
+			}
+			return nil
+		})
+	}
+	require_NoError(t, js.DeleteMsg("TEST", 5))
+	checkReadReplica()
+	_, err = rr.getMsg(5)
+	require_Error(t, err)
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Subject: "foo.1"}))
+	checkReadReplica()
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Sequence: 12}))
+	checkReadReplica()
+	require_NoError(t, js.PurgeStream("TEST"))
+	checkReadReplica()
+	require_Equal(t, rr.state().Msgs, 0)
+
+	// Dropping read replicas removes the copy.
+	cfg.ReadReplicas = nil
+	require_True(t, streamRequest(JSApiStreamUpdateT, cfg) == nil)
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		if readReplica(rs) != nil {
+			return errors.New("read replica still present")
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterConsumerCheckpointImport(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe("foo", "dlc", nats.Bind("TEST", "dlc"))
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 10)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	// Rewind to a checkpoint with one message pending.
+	pending := []SequencePair{{Consumer: 4, Stream: 4}}
+	cp := &ConsumerCheckpoint{
+		Delivered:     SequencePair{Consumer: 5, Stream: 5},
+		AckFloor:      SequencePair{Consumer: 3, Stream: 3},
+		Pending:       pending,
+		PendingDigest: checkpointPendingDigest(pending),
+	}
+	req, err := json.Marshal(&JSApiConsumerImportRequest{Checkpoint: cp})
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiConsumerImportT, "TEST", "dlc"), req, 2*time.Second)
+	require_NoError(t, err)
+	var iResp JSApiConsumerImportResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &iResp))
+	require_True(t, iResp.Error == nil)
+
+	// All replicas should have the state of the checkpoint.
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			o := mset.lookupConsumer("dlc")
+			if o == nil {
+				return fmt.Errorf("consumer not found on %s", s)
+			}
+			state, err := o.store.State()
+			if err != nil {
+				return err
+			}
+			if state.Delivered != cp.Delivered || state.AckFloor != cp.AckFloor || len(state.Pending) != 1 {
+				return fmt.Errorf("unexpected state on %s: %+v", s, state)
+			}
+		}
+		return nil
+	})
+
+	// A new leader should continue from the checkpoint.
+	cl := c.consumerLeader(globalAccountName, "TEST", "dlc")
+	_, err = nc.Request(fmt.Sprintf(JSApiConsumerLeaderStepDownT, "TEST", "dlc"), nil, 2*time.Second)
+	require_NoError(t, err)
+	c.waitOnConsumerLeader(globalAccountName, "TEST", "dlc")
+	require_NotEqual(t, cl, c.consumerLeader(globalAccountName, "TEST", "dlc"))
+
+	resp, err = nc.Request(fmt.Sprintf(JSApiConsumerExportT, "TEST", "dlc"), nil, 2*time.Second)
+	require_NoError(t, err)
+	var eResp JSApiConsumerExportResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &eResp))
+	require_True(t, eResp.Error == nil)
+	require_Equal(t, eResp.Checkpoint.Delivered, cp.Delivered)
+	require_Equal(t, eResp.Checkpoint.AckFloor, cp.AckFloor)
+	require_Equal(t, eResp.Checkpoint.PendingDigest, cp.PendingDigest)
+
+	msgs, err = sub.Fetch(1)
+	require_NoError(t, err)
+	meta, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	require_Equal(t, meta.Sequence.Stream, 6)
+}
+
+func TestJetStreamClusterShardedStream(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Subjects: []string{"orders.*.*"},
+		Storage:  FileStorage,
+		Replicas: 3,
+		Sharding: &StreamSharding{Shards: 3, Token: 3},
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), req, 5*time.Second)
+	require_NoError(t, err)
+	var cResp JSApiShardedStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &cResp))
+	require_True(t, cResp.Error == nil)
+	require_Len(t, len(cResp.Shards), 3)
+
+	// Shards have their own groups and leaders.
+	for i := 0; i < 3; i++ {
+		c.waitOnStreamLeader(globalAccountName, shardStreamName("ORDERS", i))
+	}
+
+	for i := 0; i < 60; i++ {
+		_, err := js.Publish(fmt.Sprintf("orders.eu.%d", i), []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		resp, err := nc.Request(fmt.Sprintf(JSApiShardedStreamInfoT, "ORDERS"), nil, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		var iResp JSApiShardedStreamInfoResponse
+		if err := json.Unmarshal(resp.Data, &iResp); err != nil {
+			return err
+		}
+		if iResp.Error != nil {
+			return iResp.Error
+		}
+		if iResp.Msgs != 60 {
+			return fmt.Errorf("expected 60 messages, got %d", iResp.Msgs)
+		}
+		for _, si := range iResp.Shards {
+			if si.State.Msgs == 0 || si.State.Msgs == 60 {
+				return fmt.Errorf("messages not spread over shards: %d on %q", si.State.Msgs, si.Config.Name)
+			}
+		}
+		return nil
+	})
+
+	resp, err = nc.Request(fmt.Sprintf(JSApiShardedStreamDeleteT, "ORDERS"), nil, 5*time.Second)
+	require_NoError(t, err)
+	var dResp JSApiShardedStreamDeleteResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &dResp))
+	require_True(t, dResp.Error == nil && dResp.Success)
+}
+
+func TestJetStreamClusterStreamAtomicPublish(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}, Replicas: 3})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"bar"}, Replicas: 3})
+	require_NoError(t, err)
+
+	atomicPublish := func(msgs ...*AtomicMsg) *JSApiStreamAtomicPublishResponse {
+		t.Helper()
+		b, err := json.Marshal(&JSApiStreamAtomicPublishRequest{Messages: msgs})
+		require_NoError(t, err)
+		resp, err := nc.Request(JSApiStreamAtomicPublish, b, 2*time.Second)
+		require_NoError(t, err)
+		var aResp JSApiStreamAtomicPublishResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &aResp))
+		return &aResp
+	}
+	hdr := func(k, v string) []byte {
+		return []byte(fmt.Sprintf("%s%s: %s\r\n\r\n", hdrLine, k, v))
+	}
+	checkStreamMsgs := func(stream string, msgs, lastSeq uint64) {
+		t.Helper()
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.GlobalAccount().lookupStream(stream)
+				if err != nil {
+					return err
+				}
+				var state StreamState
+				mset.store.FastState(&state)
+				if state.Msgs != msgs || state.LastSeq != lastSeq {
+					return fmt.Errorf("expected %d msgs up to %d in %q on %s, got %+v", msgs, lastSeq, stream, s, state)
+				}
+			}
+			return nil
+		})
+	}
+	checkMsgs := func(msgs, lastSeq uint64) {
+		t.Helper()
+		checkStreamMsgs("TEST", msgs, lastSeq)
+	}
+
+	// All messages are stored on every replica.
+	aResp := atomicPublish(
+		&AtomicMsg{Subject: "foo.1", Header: hdr(JSMsgId, "1"), Data: []byte("one")},
+		&AtomicMsg{Subject: "foo.2", Data: []byte("two")},
+		&AtomicMsg{Subject: "foo.3", Data: []byte("three")},
+	)
+	require_True(t, aResp.Error == nil)
+	require_Len(t, len(aResp.Acks), 3)
+	for i, ack := range aResp.Acks {
+		require_Equal(t, *ack, PubAck{Stream: "TEST", Sequence: uint64(i + 1)})
+	}
+	checkMsgs(3, 3)
+
+	// A failed expectation of a later message stores nothing, the sequences of the messages
+	// removed again are skipped, and messages published afterwards still line up.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "foo.4", Data: []byte("four")},
+		&AtomicMsg{Subject: "foo.1", Header: hdr(JSExpectedLastSubjSeq, "0"), Data: []byte("one")},
+	)
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	pa, err := js.Publish("foo.5", nil)
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 5)
+	checkMsgs(4, 5)
+
+	// A retry is acknowledged as a duplicate.
+	aResp = atomicPublish(&AtomicMsg{Subject: "foo.1", Header: hdr(JSMsgId, "1"), Data: []byte("one")})
+	require_True(t, aResp.Error == nil)
+	require_True(t, aResp.Acks[0].Duplicate)
+	require_Equal(t, aResp.Acks[0].Sequence, 1)
+	pa, err = js.Publish("foo.6", nil)
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 6)
+
+	aResp = atomicPublish(&AtomicMsg{Subject: "missing"})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs(5, 6)
+
+	// Messages to more than one stream are coordinated by the meta group and stored in all of them.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "foo.7", Header: hdr(JSMsgId, "7"), Data: []byte("seven")},
+		&AtomicMsg{Subject: "bar", Header: hdr(JSMsgId, "b1"), Data: []byte("bar")},
+		&AtomicMsg{Subject: "foo.8", Data: []byte("eight")},
+	)
+	require_True(t, aResp.Error == nil)
+	require_Len(t, len(aResp.Acks), 3)
+	require_Equal(t, *aResp.Acks[0], PubAck{Stream: "TEST", Sequence: 7})
+	require_Equal(t, *aResp.Acks[1], PubAck{Stream: "OTHER", Sequence: 1})
+	require_Equal(t, *aResp.Acks[2], PubAck{Stream: "TEST", Sequence: 8})
+	checkMsgs(7, 8)
+	checkStreamMsgs("OTHER", 1, 1)
+
+	// A failed expectation in one stream stores nothing in any of them.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "foo.9", Data: []byte("nine")},
+		&AtomicMsg{Subject: "bar", Header: hdr(JSExpectedLastSeq, "5"), Data: []byte("bar")},
+	)
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs(7, 8)
+	checkStreamMsgs("OTHER", 1, 1)
+
+	// The streams take messages again once the publish is resolved, and they still line up.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		_, err := js.Publish("foo.9", nil)
+		return err
+	})
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		_, err := js.Publish("bar", nil)
+		return err
+	})
+	checkMsgs(8, 9)
+	checkStreamMsgs("OTHER", 2, 2)
+
+	// A retry is acknowledged as a duplicate when stored in all streams before.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "foo.7", Header: hdr(JSMsgId, "7"), Data: []byte("seven")},
+		&AtomicMsg{Subject: "bar", Header: hdr(JSMsgId, "b1"), Data: []byte("bar")},
+	)
+	require_True(t, aResp.Error == nil)
+	require_Equal(t, *aResp.Acks[0], PubAck{Stream: "TEST", Sequence: 7, Duplicate: true})
+	require_Equal(t, *aResp.Acks[1], PubAck{Stream: "OTHER", Sequence: 1, Duplicate: true})
+	checkMsgs(8, 9)
+	checkStreamMsgs("OTHER", 2, 2)
+
+	// Survives a leader change.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	sl.JetStreamStepdownStream(globalAccountName, "TEST")
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	aResp = atomicPublish(&AtomicMsg{Subject: "foo.10"}, &AtomicMsg{Subject: "foo.11"})
+	require_True(t, aResp.Error == nil)
+	require_Equal(t, aResp.Acks[1].Sequence, 11)
+	checkMsgs(10, 11)
+	c.waitOnAllCurrent()
+	aResp = atomicPublish(&AtomicMsg{Subject: "bar"}, &AtomicMsg{Subject: "foo.12"})
+	require_True(t, aResp.Error == nil)
+	require_Equal(t, *aResp.Acks[0], PubAck{Stream: "OTHER", Sequence: 3})
+	require_Equal(t, *aResp.Acks[1], PubAck{Stream: "TEST", Sequence: 12})
+	checkMsgs(11, 12)
+	checkStreamMsgs("OTHER", 3, 3)
+}
+
+func TestJetStreamClusterStreamRejections(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", nil, nats.MsgId("1"))
+	require_NoError(t, err)
+	pa, err := js.Publish("foo", nil, nats.MsgId("1"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+	// Checked pre proposal.
+	_, err = js.Publish("foo", nil, nats.ExpectLastSequencePerSubject(0))
+	require_Error(t, err)
+	// Checked when applied, by all peers.
+	_, err = js.Publish("foo", nil, nats.ExpectLastSequence(5))
+	require_Error(t, err)
+
+	// Only the leader counts.
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	for _, s := range c.servers {
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		if s == c.streamLeader(globalAccountName, "TEST") {
+			require_Equal(t, *mset.rejections(), StreamRejections{Duplicate: 1, WrongLastSeq: 2})
+		} else {
+			require_True(t, mset.rejections() == nil)
+		}
+	}
+}
+
+func TestJetStreamClusterListFilters(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	testJetStreamListFilters(t, nc, js)
+}
+
+func TestJetStreamClusterStreamStorageFailureRecover(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	// Every replica failed, each keeps its own state.
+	for _, s := range c.servers {
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		require_True(t, s.handleStorageError(mset, &fs.PathError{Op: "write", Path: "1.blk", Err: syscall.EIO}))
+	}
+	_, err = js.Publish("foo", []byte("NOPE"))
+	require_Error(t, err)
+
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamRecoverT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamRecoverResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Recovered)
+	require_Equal(t, resp.Failure.Class, StorageErrorIO)
+
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if mset.storageFailure() != nil {
+				return fmt.Errorf("stream on %s still read-only", s)
+			}
+		}
+		return nil
+	})
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+}
+
+func TestJetStreamClusterMaxConsumersSoftLimit(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	testJetStreamMaxConsumersSoftLimit(t, nc, js, 3)
+}
+
+func TestJetStreamClusterTokenPlacementDirectGet(t *testing.T) {
+	regions := map[string]string{"S-1": "eu", "S-2": "us", "S-3": "ap"}
+	c := createJetStreamClusterWithTemplateAndModHook(t, jsClusterTempl, "R3S", 3,
+		func(serverName, clusterName, storeDir, conf string) string {
+			return fmt.Sprintf("%s\nserver_tags: [region:%s]", conf, regions[serverName])
+		})
+	defer c.shutdown()
+
+	eu, us := c.serverByName("S-1"), c.serverByName("S-2")
+
+	nc, js := jsClientConnect(t, us)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"orders.>"}, Replicas: 3, AllowDirect: true})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	// Now enable routing of direct gets by region.
+	req, err := json.Marshal(&StreamConfig{
+		Name: "TEST", Subjects: []string{"orders.>"}, Replicas: 3, Storage: FileStorage, AllowDirect: true,
+		TokenPlacement: &StreamTokenPlacement{Token: 2, TagPrefix: "region:", DirectGet: true},
+	})
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, 2*time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	_, err = js.Publish("orders.eu.1", []byte("EU"))
+	require_NoError(t, err)
+	_, err = js.Publish("orders.us.1", []byte("US"))
+	require_NoError(t, err)
+
+	// All replicas need to serve direct gets.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			mset.mu.RLock()
+			ok := mset.routeSub != nil
+			mset.mu.RUnlock()
+			if !ok {
+				return fmt.Errorf("direct gets not ready on %s", s)
+			}
+		}
+		return nil
+	})
+
+	// The us replica needs to know the region of the eu one to route to it.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		si, ok := us.nodeToInfo.Load(eu.Node())
+		if !ok || si == nil {
+			return fmt.Errorf("%s not known yet", eu)
+		}
+		if ni := si.(nodeInfo); !ni.tags.Contains("region:eu") {
+			return fmt.Errorf("region of %s not known yet", eu)
+		}
+		return nil
+	})
+
+	// Any replica serves the messages of all regions.
+	m, err := js.GetLastMsg("TEST", "orders.us.1", nats.DirectGet())
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "US")
+	m, err = js.GetLastMsg("TEST", "orders.eu.1", nats.DirectGet())
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "EU")
+
+	// The us replica serves its own region, and routes the eu region to the replica there.
+	mset, err := us.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_False(t, mset.routeDirectGet("orders.us.1", _EMPTY_, &JSApiMsgGetRequest{LastFor: "orders.us.1"}))
+
+	routed := natsSubSync(t, nc, fmt.Sprintf(jsDirectGetRouteT, "TEST", eu.Node()))
+	reply := natsSubSync(t, nc, nats.NewInbox())
+	natsFlush(t, nc)
+	require_True(t, mset.routeDirectGet("orders.eu.1", reply.Subject, &JSApiMsgGetRequest{LastFor: "orders.eu.1"}))
+	_, err = routed.NextMsg(time.Second)
+	require_NoError(t, err)
+	rmsg, err := reply.NextMsg(time.Second)
+	require_NoError(t, err)
+	require_Equal(t, string(rmsg.Data), "EU")
+}
+
+func TestJetStreamClusterConsumerCumulativeAck(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	testJetStreamConsumerCumulativeAck(t, nc, js, 3)
+
+	// The cumulative acks are replicated to the store of every replica.
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			o := mset.lookupConsumer("C")
+			if o == nil {
+				return fmt.Errorf("consumer not found on %s", s)
+			}
+			state, err := o.store.State()
+			if err != nil {
+				return err
+			}
+			if len(state.Pending) != 0 || state.AckFloor.Stream != 10 || state.AckFloor.Consumer != 13 {
+				return fmt.Errorf("unexpected ack state on %s: pending %d, floor %+v", s, len(state.Pending), state.AckFloor)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterCompactWAL(t *testing.T) {
+	tmpl := strings.Replace(jsClusterTempl, "store_dir: '%s'}", `store_dir: '%s'
+		raft_wal: {
+			compression: s2
+			block_size: 1MB
+			stream: { compact_msgs: 1000000, compact_bytes: 1GB }
+			consumer: { compact_msgs: 1000000, compact_bytes: 1GB }
+		}
+	}`, 1)
+	c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "R1", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+
+	for i := 0; i < 500; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(100)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	// The WALs use the configured block size and compression.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	wal := mset.raftNode().(*raft).wal.(*fileStore)
+	require_Equal(t, wal.fcfg.Compression, S2Compression)
+	require_Equal(t, wal.fcfg.BlockSize, 1024*1024)
+
+	compact := func(subject string) JSApiCompactWALResponse {
+		t.Helper()
+		msg, err := nc.Request(subject, nil, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiCompactWALResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp
+	}
+
+	// The WALs only compact at the configured size, or when asked to.
+	checkWAL := func(subject string, n RaftNode) {
+		t.Helper()
+		before, _ := n.Size()
+		require_True(t, before >= 100)
+		resp := compact(subject)
+		require_True(t, resp.Error == nil)
+		require_True(t, resp.Entries < before)
+		require_Equal(t, resp.Type, JSApiStreamCompactWALResponseType)
+	}
+	checkWAL(fmt.Sprintf(JSApiStreamCompactWALT, "TEST"), mset.raftNode())
+
+	ol := c.consumerLeader(globalAccountName, "TEST", "C")
+	mset, err = ol.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	n := mset.lookupConsumer("C").raftNode()
+	before, _ := n.Size()
+	require_True(t, before >= 100)
+	resp := compact(fmt.Sprintf(JSApiConsumerCompactWALT, "TEST", "C"))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Entries < before)
+	require_Equal(t, resp.Type, JSApiConsumerCompactWALResponseType)
+
+	// The followers compact as well.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if ne, _ := mset.raftNode().Size(); ne >= 100 {
+				return fmt.Errorf("%s has %d WAL entries", s, ne)
+			}
+		}
+		return nil
+	})
+
+	resp = compact(fmt.Sprintf(JSApiStreamCompactWALT, "R1"))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSRaftWALCompactErrF))
+	resp = compact(fmt.Sprintf(JSApiStreamCompactWALT, "MISSING"))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamNotFoundErr))
+	resp = compact(fmt.Sprintf(JSApiConsumerCompactWALT, "TEST", "MISSING"))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNotFoundErr))
+}
+
+func TestJetStreamClusterRaftWALConfig(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		jetstream: {
+			raft_wal: {
+				compression: s2
+				block_size: 4MB
+				stream: { compact_bytes: 16MB }
+				consumer: { compact_msgs: 4096 }
+			}
+		}
+	`))
+	opts, err := ProcessConfigFile(conf)
+	require_NoError(t, err)
+	require_Equal(t, opts.JetStreamRaftWAL, JSRaftWAL{
+		Compression: S2Compression,
+		BlockSize:   4 * 1024 * 1024,
+		Stream:      JSRaftWALCompact{Bytes: 16 * 1024 * 1024},
+		Consumer:    JSRaftWALCompact{Msgs: 4096},
+	})
+
+	// Unset thresholds keep the defaults.
+	bytes, msgs := opts.JetStreamRaftWAL.Stream.limits(8*1024*1024, 65536)
+	require_Equal(t, bytes, 16*1024*1024)
+	require_Equal(t, msgs, 65536)
+
+	conf = createConfFile(t, []byte(`
+		jetstream: {
+			raft_wal: { stream: { compact_msgs: -1 } }
+		}
+	`))
+	_, err = ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "Expected a non-negative size"))
+}
+
+func TestJetStreamClusterStreamScaleUpProgress(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}}
+	_, err := js.AddStream(cfg)
+	require_NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	cfg.Replicas = 3
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+
+	// The servers track the new replicas.
+	scale := func(s *Server) *streamScale {
+		js := s.getJetStream()
+		js.mu.RLock()
+		defer js.mu.RUnlock()
+		return js.streamAssignment(globalAccountName, "TEST").scale
+	}
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			if sc := scale(s); sc == nil || sc.from != 1 || sc.to != 3 {
+				return fmt.Errorf("%s not tracking the new replicas", s)
+			}
+		}
+		return nil
+	})
+
+	// Progress is reported until all replicas are current.
+	checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+		var resp JSApiStreamInfoResponse
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(msg.Data, &resp); err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if sc := resp.Cluster.Scale; sc != nil {
+			require_Equal(t, sc.From, 1)
+			require_Equal(t, sc.To, 3)
+			require_True(t, sc.Current < 3)
+			return fmt.Errorf("scaling, %d of %d current", sc.Current, sc.To)
+		}
+		for _, r := range resp.Cluster.Replicas {
+			if !r.Current {
+				return fmt.Errorf("replica %s not current", r.Name)
+			}
+		}
+		return nil
+	})
+
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	require_True(t, scale(c.streamLeader(globalAccountName, "TEST")) == nil)
+
+	// Scaling down does not report progress.
+	cfg.Replicas = 1
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			if scale(s) != nil {
+				return fmt.Errorf("%s still tracking replicas", s)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterStreamIdempotencyTokens(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, _ := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	testStreamIdempotencyTokens(t, nc, 3)
+
+	// The tokens are kept by the meta layer of all servers.
+	for _, s := range c.servers {
+		js := s.getJetStream()
+		js.mu.RLock()
+		tokens := js.streamAssignment(globalAccountName, "TEST").Tokens
+		js.mu.RUnlock()
+		require_Equal(t, strings.Join(tokens, ","), "c1,u1,u2")
+	}
+}
+
+func TestJetStreamClusterStreamHotSubjects(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"kv.>"}, Replicas: 3})
+	require_NoError(t, err)
+
+	// The client does not know about hot subjects yet, so update with our config.
+	cfg := StreamConfig{
+		Name:        "TEST",
+		Subjects:    []string{"kv.>"},
+		Storage:     FileStorage,
+		Replicas:    3,
+		HotSubjects: &StreamHotSubjects{MaxRate: 1, Window: 10 * time.Second},
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("kv.a", nil)
+		require_NoError(t, err)
+	}
+	_, err = js.Publish("kv.a", nil)
+	require_Error(t, err, NewJSStreamSubjectRateExceededError())
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 10)
+
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	rej := mset.rejections()
+	require_True(t, rej != nil)
+	require_Equal(t, rej.SubjectRate, 1)
+}
+
+func TestJetStreamClusterProtectedConsumer(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+
+	req, err := json.Marshal(&CreateConsumerRequest{
+		Stream: "TEST",
+		Config: ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, Protected: true},
+	})
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", "C"), req, 5*time.Second)
+	require_NoError(t, err)
+	var cresp JSApiConsumerCreateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &cresp))
+	require_True(t, cresp.Error == nil)
+	require_True(t, cresp.Config.Protected)
+
+	deleteConsumer := func(req string) *ApiError {
+		t.Helper()
+		msg, err := nc.Request(fmt.Sprintf(JSApiConsumerDeleteT, "TEST", "C"), []byte(req), 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerDeleteResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+	require_Error(t, deleteConsumer(_EMPTY_), NewJSConsumerProtectedError())
+	_, err = js.ConsumerInfo("TEST", "C")
+	require_NoError(t, err)
+
+	require_True(t, deleteConsumer(`{"force":true}`) == nil)
+	_, err = js.ConsumerInfo("TEST", "C")
+	require_Error(t, err, nats.ErrConsumerNotFound)
+}
+
+func TestJetStreamClusterStreamHeadersOnly(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: 3, HeadersOnly: true}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("hello world"))
+		require_NoError(t, err)
+	}
+	c.waitOnStreamCurrent(c.streamLeader(globalAccountName, "TEST"), globalAccountName, "TEST")
+
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if state := mset.state(); state.Msgs != 10 {
+				return fmt.Errorf("expected 10 msgs, got %d", state.Msgs)
+			}
+			sm, err := mset.getMsg(10)
+			if err != nil {
+				return err
+			}
+			if len(sm.Data) != 0 {
+				return fmt.Errorf("expected no payload, got %q", sm.Data)
+			}
+			if size := getHeader(JSMsgSize, sm.Header); string(size) != "11" {
+				return fmt.Errorf("expected a size of 11, got %q", size)
+			}
+			if n := bytes.Count(sm.Header, []byte(JSMsgSize)); n != 1 {
+				return fmt.Errorf("expected one size header, got %d", n)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterProposalScheduling(t *testing.T) {
+	tmpl := strings.Replace(jsClusterTempl, "store_dir:", "account_isolation: {proposal_max_inflight: 1}, store_dir:", 1)
+	tmpl = strings.Replace(tmpl, "accounts {", `accounts {
+		A { jetstream: { proposal_weight: 4 }, users = [ { user: "a", pass: "a" } ] }
+	`, 1)
+	c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer(), nats.UserInfo("a", "a"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo"},
+		Replicas: 3,
+	})
+	require_NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+
+	sl := c.streamLeader("A", "TEST")
+	require_True(t, sl.nrgProposals != nil)
+	acc, err := sl.lookupAccount("A")
+	require_NoError(t, err)
+	mset, err := acc.lookupStream("TEST")
+	require_NoError(t, err)
+	n := mset.raftNode().(*raft)
+	require_Equal(t, n.proposalWeight(), 4)
+
+	n.RLock()
+	stats := n.proposalStats()
+	n.RUnlock()
+	require_True(t, stats != nil)
+	require_True(t, stats.Batches > 0)
+	require_True(t, stats.MaxLatency >= stats.AvgLatency)
+
+	// Waiting for a turn does not hold up the leader, which keeps taking proposals.
+	require_True(t, sl.nrgProposals.acquire(1, 0) == nil)
+	var pafs []nats.PubAckFuture
+	for i := 0; i < 2; i++ {
+		paf, err := js.PublishAsync("foo", []byte("ok"))
+		require_NoError(t, err)
+		pafs = append(pafs, paf)
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if n := n.prop.len(); n > 0 {
+				return fmt.Errorf("%d proposals not taken", n)
+			}
+			return nil
+		})
+	}
+	sl.nrgProposals.release()
+	for _, paf := range pafs {
+		select {
+		case <-paf.Ok():
+		case err := <-paf.Err():
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Did not receive the ack")
+		}
+	}
+	require_Equal(t, mset.state().Msgs, 102)
+}
+
+func TestJetStreamClusterStreamMaxIngestRate(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// The client does not know about the ingest rate yet, so create with our config.
+	cfg := StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"foo"},
+		Storage:       FileStorage,
+		Replicas:      3,
+		MaxIngestRate: &StreamIngestRate{Msgs: 5},
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Config.MaxIngestRate != nil)
+	require_Equal(t, resp.Config.MaxIngestRate.Msgs, 5)
+
+	var accepted int
+	for ; accepted < 20; accepted++ {
+		if _, err = js.Publish("foo", nil); err != nil {
+			break
+		}
+	}
+	require_Error(t, err, NewJSStreamIngestRateExceededError())
+	require_True(t, accepted >= 5 && accepted < 20)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, uint64(accepted))
+
+	// A new leader enforces the rate as well.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.rejections().IngestRate, 1)
+	require_NoError(t, mset.raftNode().StepDown())
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	nl := c.streamLeader(globalAccountName, "TEST")
+	mset, err = nl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, mset.ingest.Load() != nil)
+}
+
+func TestJetStreamClusterStreamValidation(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// The validator may be connected to any server.
+	vnc, _ := jsClientConnect(t, c.randomServer())
+	defer vnc.Close()
+	_, err := vnc.Subscribe("validate", func(m *nats.Msg) {
+		reply := nats.NewMsg(m.Reply)
+		if string(m.Data) != "ok" {
+			reply.Header.Set(JSValidationError, "not ok")
+		}
+		m.RespondMsg(reply)
+	})
+	require_NoError(t, err)
+	require_NoError(t, vnc.Flush())
+
+	cfg := StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo"},
+		Storage:    FileStorage,
+		Replicas:   3,
+		Validation: &StreamValidation{Subject: "validate"},
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Config.Validation != nil)
+
+	check := func() {
+		t.Helper()
+		_, err := js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+		_, err = js.Publish("foo", []byte("nok"))
+		require_Error(t, err, NewJSStreamValidationRejectedError(errors.New("not ok")))
+	}
+	check()
+
+	// A new leader validates as well.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_NoError(t, mset.raftNode().StepDown())
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	check()
+
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if msgs := mset.state().Msgs; msgs != 2 {
+				return fmt.Errorf("expected 2 messages on %s, got %d", s, msgs)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterDeadLetterStream(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	req, err := json.Marshal(&StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo"},
+		Storage:    FileStorage,
+		Replicas:   3,
+		MaxMsgs:    1,
+		Discard:    DiscardNew,
+		DeadLetter: "DLQ",
+	})
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 2*time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		_, err := js.StreamInfo("DLQ")
+		return err
+	})
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	// Rejected before proposing.
+	_, err = js.Publish("foo", []byte("WRONG STREAM"), nats.ExpectStream("OTHER"))
+	require_Error(t, err)
+	// Rejected by the store of every replica when applied.
+	_, err = js.Publish("foo", []byte("FULL"))
+	require_Error(t, err)
+
+	// Only the leader copies, so we should not have copies from the followers.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		si, err := js.StreamInfo("DLQ")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 2 {
+			return fmt.Errorf("expected 2 dead letters, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	time.Sleep(250 * time.Millisecond)
+	si, err := js.StreamInfo("DLQ")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+
+	m, err := js.GetMsg("DLQ", 2)
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "FULL")
+}
+
+func TestJetStreamClusterStreamCatchupWithBlocks(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// Small limits give us small blocks, so we have a lot of them.
+	cfg := &nats.StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo.*"},
+		MaxBytes: 120_000,
+	}
+	_, err := js.AddStream(cfg)
+	require_NoError(t, err)
+
+	msg := bytes.Repeat([]byte("Z"), 1024)
+	for i := 0; i < 200; i++ {
+		m := nats.NewMsg(fmt.Sprintf("foo.%d", i%10))
+		m.Header.Set("N", strconv.Itoa(i))
+		m.Data = msg
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	for _, seq := range []uint64{120, 121, 150, 199} {
+		require_NoError(t, js.DeleteMsg("TEST", seq))
+	}
+
+	// Now scale up to R3, the new replicas catch up from the leader.
+	cfg.Replicas = 3
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	sl := c.streamLeader(globalAccountName, "TEST")
+	lmset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	lstate := lmset.state()
+
+	for _, s := range c.servers {
+		if s == sl {
+			continue
+		}
+		c.waitOnStreamCurrent(s, globalAccountName, "TEST")
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			if state := mset.state(); state.Msgs != lstate.Msgs || state.FirstSeq != lstate.FirstSeq || state.LastSeq != lstate.LastSeq {
+				return fmt.Errorf("expected %+v, got %+v", lstate, state)
+			}
+			return nil
+		})
+		var smv, lsmv StoreMsg
+		for seq := lstate.FirstSeq; seq <= lstate.LastSeq; seq++ {
+			lsm, lerr := lmset.store.LoadMsg(seq, &lsmv)
+			sm, err := mset.store.LoadMsg(seq, &smv)
+			if lerr != nil {
+				require_Error(t, err)
+				continue
+			}
+			require_NoError(t, err)
+			require_Equal(t, sm.subj, lsm.subj)
+			require_True(t, bytes.Equal(sm.hdr, lsm.hdr))
+			require_True(t, bytes.Equal(sm.msg, lsm.msg))
+			require_Equal(t, sm.ts, lsm.ts)
+		}
+	}
+}
+
+func TestJetStreamClusterAccountFreeze(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C1", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+
+	ncSys := natsConnect(t, c.randomServer().ClientURL(), nats.UserInfo("admin", "s3cr3t!"))
+	defer ncSys.Close()
+
+	freeze := func(enable bool) {
+		t.Helper()
+		req := fmt.Sprintf(`{"enable": %t}`, enable)
+		_, err := ncSys.Request(fmt.Sprintf(accDirectReqSubj, globalAccountName, "JSFREEZE"), []byte(req), time.Second)
+		require_NoError(t, err)
+		// Every server applies the freeze, wait for all of them.
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				if s.GlobalAccount().JetStreamFrozen() != enable {
+					return fmt.Errorf("server %s not updated", s)
+				}
+			}
+			return nil
+		})
+	}
+
+	freeze(true)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}, Replicas: 3})
+	require_Error(t, err, NewJSAccountFrozenError())
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy})
+	require_Error(t, err, NewJSAccountFrozenError())
+
+	// Existing assets keep working, also after a meta leader change.
+	c.waitOnLeader()
+	require_NoError(t, c.leader().getJetStream().getMetaGroup().StepDown())
+	c.waitOnLeader()
+
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}, Replicas: 3})
+	require_Error(t, err, NewJSAccountFrozenError())
+
+	freeze(false)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}, Replicas: 3})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+}
+
+func TestJetStreamClusterStreamSubjectTokens(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// The subject is checked as it is stored, after the transform.
+	addStream(t, nc, &StreamConfig{
+		Name:             "TEST",
+		Subjects:         []string{"in.>"},
+		SubjectTransform: &SubjectTransformConfig{Source: "in.>", Destination: "orders.>"},
+		Replicas:         3,
+		Storage:          FileStorage,
+		SubjectTokens:    3,
+	})
+
+	_, err := js.Publish("in.eu.1", nil)
+	require_NoError(t, err)
+	_, err = js.Publish("in.eu", nil)
+	require_Error(t, err, NewJSStreamSubjectTokensError("orders.eu", 3))
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.rejections().SubjectTokens, 1)
+}
+
+func TestJetStreamClusterStreamPause(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+
+	pause := func(subj string) {
+		t.Helper()
+		msg, err := nc.Request(fmt.Sprintf(subj, "TEST"), nil, 2*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamPauseResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+	}
+	checkPaused := func(paused bool) {
+		t.Helper()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.GlobalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				if mset.isPaused() != paused {
+					return fmt.Errorf("expected paused %v on %s", paused, s)
+				}
+			}
+			return nil
+		})
+		_, err := js.Publish("foo", []byte("OK"))
+		if paused {
+			require_Error(t, err, NewJSStreamPausedError())
+		} else {
+			require_NoError(t, err)
+		}
+	}
+
+	pause(JSApiStreamPauseT)
+	checkPaused(true)
+
+	// The pause is kept on a new stream leader.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_NoError(t, mset.raftNode().StepDown())
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	checkPaused(true)
+
+	// And when the whole cluster restarts.
+	nc.Close()
+	c.stopAll()
+	c.restartAllSamePorts()
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	nc, js = jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+	checkPaused(true)
+
+	pause(JSApiStreamResumeT)
+	checkPaused(false)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+}
+
+func TestJetStreamClusterStreamHooks(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo"},
+		Storage:  FileStorage,
+		Replicas: 3,
+		Hooks:    &StreamHooks{Delete: "hooks.delete", Purge: "hooks.purge"},
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	sendStreamMsg(t, nc, "foo", "OK")
+
+	var approve atomic.Bool
+	_, err = nc.Subscribe("hooks.*", func(msg *nats.Msg) {
+		reply := nats.NewMsg(msg.Reply)
+		if !approve.Load() {
+			reply.Header.Set(JSValidationError, "not now")
+		}
+		msg.RespondMsg(reply)
+	})
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	// Purges are approved on the stream leader, deletes on the meta leader.
+	err = js.PurgeStream("TEST")
+	require_Error(t, err, NewJSStreamHookRejectedError(errors.New("not now"), streamHookPurge))
+	err = js.DeleteStream("TEST")
+	require_Error(t, err, NewJSStreamHookRejectedError(errors.New("not now"), streamHookDelete))
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+
+	approve.Store(true)
+	require_NoError(t, js.PurgeStream("TEST"))
+	require_NoError(t, js.DeleteStream("TEST"))
+	_, err = js.StreamInfo("TEST")
+	require_Error(t, err, nats.ErrStreamNotFound)
+}
+
+func TestJetStreamClusterStreamInactiveThreshold(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:              "TEST",
+		Subjects:          []string{"foo"},
+		Storage:           FileStorage,
+		Replicas:          3,
+		InactiveThreshold: 2 * time.Second,
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	sendStreamMsg(t, nc, "foo", "OK")
+
+	// The stream leader has the meta leader remove the stream from all servers.
+	checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+		if _, err := js.StreamInfo("TEST"); err != nats.ErrStreamNotFound {
+			return fmt.Errorf("stream not removed: %v", err)
+		}
+		for _, s := range c.servers {
+			if _, err := s.GlobalAccount().lookupStream("TEST"); err == nil {
+				return fmt.Errorf("stream still on %s", s)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterStreamRename(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(4)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	req, err := json.Marshal(&JSApiStreamRenameRequest{Name: "RENAMED"})
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamRenameT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamRenameResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Success)
+
+	c.waitOnStreamLeader(globalAccountName, "RENAMED")
+	c.waitOnConsumerLeader(globalAccountName, "RENAMED", "C")
+
+	// All servers have the messages and the consumer under the new name.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			if _, err := s.GlobalAccount().lookupStream("TEST"); err == nil {
+				return fmt.Errorf("old stream still on %s", s)
+			}
+			mset, err := s.GlobalAccount().lookupStream("RENAMED")
+			if err != nil {
+				return fmt.Errorf("renamed stream not on %s", s)
+			}
+			if state := mset.state(); state.Msgs != 10 {
+				return fmt.Errorf("expected 10 messages on %s, got %d", s, state.Msgs)
+			}
+			if o := mset.lookupConsumer("C"); o == nil {
+				return fmt.Errorf("consumer not on %s", s)
+			}
+		}
+		return nil
+	})
+
+	ci, err := js.ConsumerInfo("RENAMED", "C")
+	require_NoError(t, err)
+	require_Equal(t, ci.AckFloor.Stream, 4)
+
+	pa, err := js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Stream, "RENAMED")
+	require_Equal(t, pa.Sequence, 11)
+
+	// The rename is kept across restarts of the cluster.
+	c.stopAll()
+	c.restartAll()
+	c.waitOnStreamLeader(globalAccountName, "RENAMED")
+
+	nc, js = jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		si, err := js.StreamInfo("RENAMED")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 11 {
+			return fmt.Errorf("expected 11 messages, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	_, err = js.StreamInfo("TEST")
+	require_Error(t, err, nats.ErrStreamNotFound)
+}
+
+func TestJetStreamClusterStreamRenameRespondsWhenStale(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	for _, name := range []string{"A", "B"} {
+		_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}, Replicas: 3})
+		require_NoError(t, err)
+	}
+
+	// A successful rename does not stay inflight.
+	req, err := json.Marshal(&JSApiStreamRenameRequest{Name: "C"})
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamRenameT, "A"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamRenameResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+
+	ml := c.leader()
+	js2, cc := ml.getJetStreamCluster()
+	js2.mu.RLock()
+	inflight := cc.inflight[globalAccountName]["C"]
+	js2.mu.RUnlock()
+	require_True(t, inflight == nil)
+
+	// Renames are checked when proposed, but the streams may have changed once they are applied.
+	// Propose directly to skip those checks, the leader still has to respond.
+	// Responses go out from the system account, as requests are imported from it.
+	snc, _ := jsClientConnect(t, c.randomServer(), nats.UserInfo("admin", "s3cr3t!"))
+	defer snc.Close()
+	ci := &ClientInfo{Account: globalAccountName}
+	for _, test := range []struct {
+		stream, name string
+		code         ErrorIdentifier
+	}{
+		{"MISSING", "D", JSStreamNotFoundErr},
+		{"B", "C", JSStreamNameExistErr},
+	} {
+		inbox := nats.NewInbox()
+		sub, err := snc.SubscribeSync(inbox)
+		require_NoError(t, err)
+		require_NoError(t, snc.Flush())
+
+		subject := fmt.Sprintf(JSApiStreamRenameT, test.stream)
+		sr := &streamRename{Client: ci, Stream: test.stream, Name: test.name, Subject: subject, Reply: inbox}
+		require_NoError(t, cc.meta.Propose(encodeStreamRename(sr)))
+
+		msg, err := sub.NextMsg(5 * time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamRenameResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error != nil)
+		require_True(t, IsNatsErr(resp.Error, test.code))
+		require_NoError(t, sub.Unsubscribe())
+	}
+
+	_, err = js.StreamInfo("B")
+	require_NoError(t, err)
+}
+
+func TestJetStreamClusterStreamTruncate(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OLD")
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	req, err := json.Marshal(&JSApiStreamTruncateRequest{Sequence: 5})
+	require_NoError(t, err)
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamTruncateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamTruncateResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Success)
+	require_Equal(t, resp.Removed, 5)
+
+	// The consumer is moved back on all replicas.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			o := mset.lookupConsumer("C")
+			if o == nil {
+				return fmt.Errorf("consumer not found on %s", s)
+			}
+			state, err := o.store.State()
+			if err != nil {
+				return err
+			}
+			if state.Delivered.Stream != 5 || state.AckFloor.Stream != 5 {
+				return fmt.Errorf("expected consumer moved back on %s, got %+v", s, state)
+			}
+		}
+		return nil
+	})
+
+	// Messages published afterwards take over the removed sequences on all replicas.
+	for i := 0; i < 3; i++ {
+		pa, err := js.Publish("foo", []byte("NEW"))
+		require_NoError(t, err)
+		require_Equal(t, pa.Sequence, uint64(6+i))
+	}
+	checkReplicas := func() {
+		t.Helper()
+		checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.GlobalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				if state := mset.state(); state.Msgs != 8 || state.LastSeq != 8 {
+					return fmt.Errorf("expected 8 messages on %s, got %+v", s, state)
+				}
+				sm, err := mset.getMsg(6)
+				if err != nil {
+					return err
+				}
+				if string(sm.Data) != "NEW" {
+					return fmt.Errorf("expected new message on %s, got %q", s, sm.Data)
+				}
+			}
+			return nil
+		})
+	}
+	checkReplicas()
+
+	// Replaying the truncate does not remove the messages published after it.
+	c.stopAll()
+	c.restartAll()
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	checkReplicas()
+
+	nc, js = jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+	pa, err := js.Publish("foo", []byte("NEW"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 9)
+}
+
+func TestJetStreamClusterStreamConvertStorage(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	for _, replicas := range []int{1, 3} {
+		name := fmt.Sprintf("R%d", replicas)
+		cfg := &nats.StreamConfig{Name: name, Subjects: []string{name}, Storage: nats.MemoryStorage, Replicas: replicas}
+		_, err := js.AddStream(cfg)
+		require_NoError(t, err)
+		for i := 0; i < 10; i++ {
+			sendStreamMsg(t, nc, name, "ok")
+		}
+
+		checkConverted := func(storage StorageType, msgs uint64) {
+			t.Helper()
+			checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+				for _, s := range c.servers {
+					mset, err := s.GlobalAccount().lookupStream(name)
+					if err != nil {
+						continue
+					}
+					mset.mu.RLock()
+					store := mset.store
+					mset.mu.RUnlock()
+					if store.Type() != storage {
+						return fmt.Errorf("expected %v store on %s, got %v", storage, s, store.Type())
+					}
+					var state StreamState
+					store.FastState(&state)
+					if state.Msgs != msgs {
+						return fmt.Errorf("expected %d msgs on %s, got %d", msgs, s, state.Msgs)
+					}
+				}
+				return nil
+			})
+		}
+
+		// Every replica converts its store, and keeps taking messages.
+		cfg.Storage = nats.FileStorage
+		si, err := js.UpdateStream(cfg)
+		require_NoError(t, err)
+		require_Equal(t, si.Config.Storage, nats.FileStorage)
+		require_Equal(t, si.State.Msgs, 10)
+		checkConverted(FileStorage, 10)
+		pa, err := js.Publish(name, []byte("ok"))
+		require_NoError(t, err)
+		require_Equal(t, pa.Sequence, 11)
+		checkConverted(FileStorage, 11)
+
+		// The assignment records the new storage, so the group is created for it again.
+		sl := c.streamLeader(globalAccountName, name)
+		sjs := sl.getJetStream()
+		sjs.mu.RLock()
+		sa := sjs.streamAssignment(globalAccountName, name)
+		sjs.mu.RUnlock()
+		require_NotNil(t, sa)
+		require_Equal(t, sa.Group.Storage, FileStorage)
+
+		// Converting while scaling is rejected.
+		cfg.Storage, cfg.Replicas = nats.MemoryStorage, 3-replicas+1
+		_, err = js.UpdateStream(cfg)
+		require_Error(t, err)
+		require_Contains(t, err.Error(), "can not convert storage while moving or scaling")
+
+		cfg.Replicas = replicas
+		_, err = js.UpdateStream(cfg)
+		require_NoError(t, err)
+		checkConverted(MemoryStorage, 11)
+	}
+
+	// A replica restarted after the conversion catches up again.
+	sl := c.streamLeader(globalAccountName, "R3")
+	var rs *Server
+	for _, s := range c.servers {
+		if s != sl {
+			rs = s
+			break
+		}
+	}
+	rs.Shutdown()
+	rs = c.restartServer(rs)
+	c.waitOnServerCurrent(rs)
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		mset, err := rs.GlobalAccount().lookupStream("R3")
+		if err != nil {
+			return err
+		}
+		if state := mset.state(); state.Msgs != 11 {
+			return fmt.Errorf("expected 11 msgs, got %d", state.Msgs)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterApiChunkedResponse(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, _ := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// The create response is sent by the stream leader after the assignment was
+	// proposed, so it depends on the chunk size being kept with the client info.
+	cfg := &StreamConfig{Name: "TEST", Storage: FileStorage, Replicas: 3}
+	for i := 0; i < 50; i++ {
+		cfg.Subjects = append(cfg.Subjects, fmt.Sprintf("foo.%d", i))
+	}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	m := nats.NewMsg(fmt.Sprintf(JSApiStreamCreateT, "TEST"))
+	m.Reply = inbox
+	m.Data = req
+	m.Header.Set(JSResponseChunked, "128")
+	require_NoError(t, nc.PublishMsg(m))
+
+	var data []byte
+	for n := 1; ; n++ {
+		msg, err := sub.NextMsg(5 * time.Second)
+		require_NoError(t, err)
+		if chunks := msg.Header.Get(JSResponseChunks); chunks != _EMPTY_ {
+			require_Equal(t, chunks, strconv.Itoa(n-1))
+			break
+		}
+		require_Equal(t, msg.Header.Get(JSResponseChunk), strconv.Itoa(n))
+		require_True(t, len(msg.Data) <= 128)
+		data = append(data, msg.Data...)
+	}
+
+	var resp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(data, &resp))
+	require_True(t, resp.Error == nil)
+	require_Len(t, len(resp.Config.Subjects), 50)
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// Lowest interval of the consumer SLA reports.
+	minConsumerSLAReportInterval = time.Second
+	// Max number of ack times kept for the percentiles of a report.
+	// Past this the ack times are sampled, so memory stays bounded for high volume consumers.
+	maxConsumerSLASamples = 10_000
+)
+
+// consumerSLA aggregates the ack times and deliveries of a consumer between two reports.
+// Protected by the consumer lock.
+type consumerSLA struct {
+	start       time.Time
+	acks        uint64
+	samples     []int64
+	max         int64
+	delivered   uint64
+	redelivered uint64
+}
+
+func newConsumerSLA() *consumerSLA {
+	return &consumerSLA{start: time.Now().UTC()}
+}
+
+// Records the time a message took to be acked.
+func (sla *consumerSLA) ack(delay int64) {
+	if delay < 0 {
+		delay = 0
+	}
+	sla.acks++
+	if delay > sla.max {
+		sla.max = delay
+	}
+	if len(sla.samples) < maxConsumerSLASamples {
+		sla.samples = append(sla.samples, delay)
+	} else if i := rand.Int63n(int64(sla.acks)); i < maxConsumerSLASamples {
+		// Reservoir sampling, every ack has the same chance to be kept.
+		sla.samples[i] = delay
+	}
+}
+
+// Records the delivery of a message with its delivery count.
+func (sla *consumerSLA) deliver(dc uint64) {
+	sla.delivered++
+	if dc > 1 {
+		sla.redelivered++
+	}
+}
+
+// Returns the percentile p of the ack times, using the nearest rank.
+// Samples need to be sorted.
+func (sla *consumerSLA) percentile(p int) time.Duration {
+	if len(sla.samples) == 0 {
+		return 0
+	}
+	rank := (p*len(sla.samples) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return time.Duration(sla.samples[rank-1])
+}
+
+// Restarts the SLA reports, only the leader keeps the stats and publishes them.
+// Lock should be held.
+func (o *consumer) resetSLA() {
+	stopAndClearTimer(&o.slatmr)
+	o.sla = nil
+	if o.cfg.SLAReportInterval <= 0 {
+		return
+	}
+	o.sla = newConsumerSLA()
+	o.slatmr = time.AfterFunc(o.cfg.SLAReportInterval, o.sendSLAReport)
+}
+
+// Publishes the SLA report of the interval that just ended and starts the next one.
+func (o *consumer) sendSLAReport() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sla := o.sla
+	if o.closed || sla == nil || o.slatmr == nil || !o.isLeader() {
+		return
+	}
+	o.sla = newConsumerSLA()
+	o.slatmr.Reset(o.cfg.SLAReportInterval)
+
+	slices.Sort(sla.samples)
+	now := time.Now().UTC()
+	e := JSConsumerSLAMetric{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerSLAMetricType,
+			ID:   nuid.Next(),
+			Time: now,
+		},
+		Stream:      o.stream,
+		Consumer:    o.name,
+		Start:       sla.start,
+		Interval:    now.Sub(sla.start),
+		Acks:        sla.acks,
+		AckTimeP50:  sla.percentile(50),
+		AckTimeP95:  sla.percentile(95),
+		AckTimeP99:  sla.percentile(99),
+		AckTimeMax:  time.Duration(sla.max),
+		Delivered:   sla.delivered,
+		Redelivered: sla.redelivered,
+		Domain:      o.srv.getOpts().JetStreamDomain,
+	}
+	if sla.delivered > 0 {
+		e.RedeliveryRate = float64(sla.redelivered) / float64(sla.delivered)
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	o.sendAdvisory(JSMetricConsumerSLAPre+"."+o.stream+"."+o.name, j)
+}
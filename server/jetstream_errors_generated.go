@@ -5,9 +5,24 @@ package server
 import "strings"
 
 const (
+	// JSAccountFrozenErr jetstream asset creation is frozen for this account
+	JSAccountFrozenErr ErrorIdentifier = 10196
+
 	// JSAccountResourcesExceededErr resource limits exceeded for account
 	JSAccountResourcesExceededErr ErrorIdentifier = 10002
 
+	// JSApiResponseTooLargeErrF api response of {size} bytes exceeds the limit of {limit} bytes
+	JSApiResponseTooLargeErrF ErrorIdentifier = 10199
+
+	// JSAtomicPublishFailedErrF no message of the request was stored (atomic publish failed: {err})
+	JSAtomicPublishFailedErrF ErrorIdentifier = 10177
+
+	// JSAtomicPublishInProgressErr stream is locked by an atomic publish in progress
+	JSAtomicPublishInProgressErr ErrorIdentifier = 10178
+
+	// JSAtomicPublishInvalidErrF atomic publish request invalid: {err}
+	JSAtomicPublishInvalidErrF ErrorIdentifier = 10176
+
 	// JSBadRequestErr bad request
 	JSBadRequestErr ErrorIdentifier = 10003
 
@@ -50,6 +65,15 @@ const (
 	// JSConsumerBadDurableNameErr durable name can not contain '.', '*', '>'
 	JSConsumerBadDurableNameErr ErrorIdentifier = 10103
 
+	// JSConsumerCheckpointInvalidErrF consumer checkpoint is invalid: {err}
+	JSConsumerCheckpointInvalidErrF ErrorIdentifier = 10171
+
+	// JSConsumerCheckpointRequiresDurableErr consumer checkpoints require a durable consumer
+	JSConsumerCheckpointRequiresDurableErr ErrorIdentifier = 10172
+
+	// JSConsumerCompressionInvalidErrF consumer compression is invalid: {err}
+	JSConsumerCompressionInvalidErrF ErrorIdentifier = 10179
+
 	// JSConsumerConfigRequiredErr consumer config required
 	JSConsumerConfigRequiredErr ErrorIdentifier = 10078
 
@@ -65,6 +89,9 @@ const (
 	// JSConsumerDeliverCycleErr consumer deliver subject forms a cycle
 	JSConsumerDeliverCycleErr ErrorIdentifier = 10081
 
+	// JSConsumerDeliverOrderInvalidErrF consumer delivery order is invalid: {err}
+	JSConsumerDeliverOrderInvalidErrF ErrorIdentifier = 10170
+
 	// JSConsumerDeliverToWildcardsErr consumer deliver subject has wildcards
 	JSConsumerDeliverToWildcardsErr ErrorIdentifier = 10079
 
@@ -173,6 +200,15 @@ const (
 	// JSConsumerOverlappingSubjectFilters consumer subject filters cannot overlap
 	JSConsumerOverlappingSubjectFilters ErrorIdentifier = 10138
 
+	// JSConsumerProgressHeartbeatsRequiresAckErr consumer progress heartbeats require acks
+	JSConsumerProgressHeartbeatsRequiresAckErr ErrorIdentifier = 10183
+
+	// JSConsumerProtectedErr consumer is protected, deletion requires force
+	JSConsumerProtectedErr ErrorIdentifier = 10191
+
+	// JSConsumerProtectedInvalidErrF protected consumer configuration is invalid: {err}
+	JSConsumerProtectedInvalidErrF ErrorIdentifier = 10192
+
 	// JSConsumerPullNotDurableErr consumer in pull mode requires a durable name
 	JSConsumerPullNotDurableErr ErrorIdentifier = 10085
 
@@ -188,12 +224,21 @@ const (
 	// JSConsumerReplacementWithDifferentNameErr consumer replacement durable config not the same
 	JSConsumerReplacementWithDifferentNameErr ErrorIdentifier = 10106
 
+	// JSConsumerReplaySpeedInvalidErrF consumer replay speed is invalid: {err}
+	JSConsumerReplaySpeedInvalidErrF ErrorIdentifier = 10185
+
 	// JSConsumerReplicasExceedsStream consumer config replica count exceeds parent stream
 	JSConsumerReplicasExceedsStream ErrorIdentifier = 10126
 
 	// JSConsumerReplicasShouldMatchStream consumer config replicas must match interest retention stream's replicas
 	JSConsumerReplicasShouldMatchStream ErrorIdentifier = 10134
 
+	// JSConsumerSharedReplicatedStreamErr shared consumers are not supported on replicated streams
+	JSConsumerSharedReplicatedStreamErr ErrorIdentifier = 10169
+
+	// JSConsumerSharedRequiresWorkQueueErr shared consumers require a stream with WorkQueue retention
+	JSConsumerSharedRequiresWorkQueueErr ErrorIdentifier = 10168
+
 	// JSConsumerSmallHeartbeatErr consumer idle heartbeat needs to be >= 100ms
 	JSConsumerSmallHeartbeatErr ErrorIdentifier = 10083
 
@@ -221,6 +266,9 @@ const (
 	// JSInvalidJSONErr invalid JSON: {err}
 	JSInvalidJSONErr ErrorIdentifier = 10025
 
+	// JSMaintenanceModeErr jetstream is in maintenance mode
+	JSMaintenanceModeErr ErrorIdentifier = 10181
+
 	// JSMaximumConsumersLimitErr maximum consumers limit reached
 	JSMaximumConsumersLimitErr ErrorIdentifier = 10026
 
@@ -230,6 +278,12 @@ const (
 	// JSMemoryResourcesExceededErr insufficient memory resources available
 	JSMemoryResourcesExceededErr ErrorIdentifier = 10028
 
+	// JSMessageTTLDisabledErr per-message TTL is disabled
+	JSMessageTTLDisabledErr ErrorIdentifier = 10187
+
+	// JSMessageTTLInvalidErr invalid per-message TTL
+	JSMessageTTLInvalidErr ErrorIdentifier = 10186
+
 	// JSMirrorConsumerSetupFailedErrF generic mirror consumer setup failure string ({err})
 	JSMirrorConsumerSetupFailedErrF ErrorIdentifier = 10029
 
@@ -293,18 +347,33 @@ const (
 	// JSRaftGeneralErrF General RAFT error string ({err})
 	JSRaftGeneralErrF ErrorIdentifier = 10041
 
+	// JSRaftWALCompactErrF raft WAL compaction failed: {err}
+	JSRaftWALCompactErrF ErrorIdentifier = 10188
+
 	// JSReplicasCountCannotBeNegative replicas count cannot be negative
 	JSReplicasCountCannotBeNegative ErrorIdentifier = 10133
 
+	// JSRestoreResumeNotFoundErr restore to resume not found
+	JSRestoreResumeNotFoundErr ErrorIdentifier = 10166
+
 	// JSRestoreSubscribeFailedErrF JetStream unable to subscribe to restore snapshot {subject}: {err}
 	JSRestoreSubscribeFailedErrF ErrorIdentifier = 10042
 
 	// JSSequenceNotFoundErrF sequence {seq} not found
 	JSSequenceNotFoundErrF ErrorIdentifier = 10043
 
+	// JSShardedStreamNotFoundErr sharded stream not found
+	JSShardedStreamNotFoundErr ErrorIdentifier = 10175
+
 	// JSSnapshotDeliverSubjectInvalidErr deliver subject not valid
 	JSSnapshotDeliverSubjectInvalidErr ErrorIdentifier = 10015
 
+	// JSSourceBridgeFailedErrF stream source bridge failed: {err}
+	JSSourceBridgeFailedErrF ErrorIdentifier = 10160
+
+	// JSSourceBridgeInvalidErrF stream source bridge invalid: {err}
+	JSSourceBridgeInvalidErrF ErrorIdentifier = 10159
+
 	// JSSourceConsumerSetupFailedErrF General source consumer setup failure string ({err})
 	JSSourceConsumerSetupFailedErrF ErrorIdentifier = 10045
 
@@ -332,9 +401,15 @@ const (
 	// JSStorageResourcesExceededErr insufficient storage resources available
 	JSStorageResourcesExceededErr ErrorIdentifier = 10047
 
+	// JSStreamAssertInvalidErrF stream assertion is invalid: {err}
+	JSStreamAssertInvalidErrF ErrorIdentifier = 10173
+
 	// JSStreamAssignmentErrF Generic stream assignment error string ({err})
 	JSStreamAssignmentErrF ErrorIdentifier = 10048
 
+	// JSStreamBackupInvalidErrF stream backup configuration is invalid: {err}
+	JSStreamBackupInvalidErrF ErrorIdentifier = 10165
+
 	// JSStreamCreateErrF Generic stream creation error string ({err})
 	JSStreamCreateErrF ErrorIdentifier = 10049
 
@@ -356,9 +431,21 @@ const (
 	// JSStreamHeaderExceedsMaximumErr header size exceeds maximum allowed of 64k
 	JSStreamHeaderExceedsMaximumErr ErrorIdentifier = 10097
 
+	// JSStreamHookRejectedErrF stream {op} rejected by lifecycle hook: {err}
+	JSStreamHookRejectedErrF ErrorIdentifier = 10200
+
+	// JSStreamHookTimeoutErrF stream {op} lifecycle hook did not reply in time
+	JSStreamHookTimeoutErrF ErrorIdentifier = 10201
+
+	// JSStreamHotSubjectsInvalidErrF hot subjects configuration is invalid: {err}
+	JSStreamHotSubjectsInvalidErrF ErrorIdentifier = 10189
+
 	// JSStreamInfoMaxSubjectsErr subject details would exceed maximum allowed
 	JSStreamInfoMaxSubjectsErr ErrorIdentifier = 10117
 
+	// JSStreamIngestRateExceededErr stream ingest rate limit exceeded
+	JSStreamIngestRateExceededErr ErrorIdentifier = 10193
+
 	// JSStreamInvalidConfigF Stream configuration validation error string ({err})
 	JSStreamInvalidConfigF ErrorIdentifier = 10052
 
@@ -416,9 +503,27 @@ const (
 	// JSStreamOfflineErr stream is offline
 	JSStreamOfflineErr ErrorIdentifier = 10118
 
+	// JSStreamPausedErr stream paused
+	JSStreamPausedErr ErrorIdentifier = 10198
+
 	// JSStreamPurgeFailedF Generic stream purge failure error string ({err})
 	JSStreamPurgeFailedF ErrorIdentifier = 10110
 
+	// JSStreamPushMirrorFailedErrF push mirror failed: {err}
+	JSStreamPushMirrorFailedErrF ErrorIdentifier = 10162
+
+	// JSStreamPushMirrorInvalidErrF push mirror invalid: {err}
+	JSStreamPushMirrorInvalidErrF ErrorIdentifier = 10161
+
+	// JSStreamPushMirrorRejectedErrF push mirror message {seq} rejected by remote stream: {err}
+	JSStreamPushMirrorRejectedErrF ErrorIdentifier = 10206
+
+	// JSStreamReadReplicasInvalidErrF stream read replicas are invalid: {err}
+	JSStreamReadReplicasInvalidErrF ErrorIdentifier = 10164
+
+	// JSStreamRenameErrF stream rename failed: {err}
+	JSStreamRenameErrF ErrorIdentifier = 10202
+
 	// JSStreamReplicasNotSupportedErr replicas > 1 not supported in non-clustered mode
 	JSStreamReplicasNotSupportedErr ErrorIdentifier = 10074
 
@@ -431,21 +536,48 @@ const (
 	// JSStreamRollupFailedF Generic stream rollup failure error string ({err})
 	JSStreamRollupFailedF ErrorIdentifier = 10111
 
+	// JSStreamScrubInProgressErr stream scrub already in progress
+	JSStreamScrubInProgressErr ErrorIdentifier = 10203
+
+	// JSStreamScrubNotSupportedErr stream storage does not support scrubbing
+	JSStreamScrubNotSupportedErr ErrorIdentifier = 10204
+
 	// JSStreamSealedErr invalid operation on sealed stream
 	JSStreamSealedErr ErrorIdentifier = 10109
 
+	// JSStreamSearchInvalidErrF stream search is invalid: {err}
+	JSStreamSearchInvalidErrF ErrorIdentifier = 10184
+
 	// JSStreamSequenceNotMatchErr expected stream sequence does not match
 	JSStreamSequenceNotMatchErr ErrorIdentifier = 10063
 
+	// JSStreamShardingInvalidErrF stream sharding is invalid: {err}
+	JSStreamShardingInvalidErrF ErrorIdentifier = 10174
+
 	// JSStreamSnapshotErrF snapshot failed: {err}
 	JSStreamSnapshotErrF ErrorIdentifier = 10064
 
+	// JSStreamStatsNotEnabledErr stream statistics sampling is not enabled
+	JSStreamStatsNotEnabledErr ErrorIdentifier = 10167
+
+	// JSStreamStorageReadOnlyErrF stream is read-only after a storage failure: {err}
+	JSStreamStorageReadOnlyErrF ErrorIdentifier = 10163
+
+	// JSStreamStorageRecoverFailedErrF stream storage could not be recovered: {err}
+	JSStreamStorageRecoverFailedErrF ErrorIdentifier = 10180
+
 	// JSStreamStoreFailedF Generic error when storing a message failed ({err})
 	JSStreamStoreFailedF ErrorIdentifier = 10077
 
 	// JSStreamSubjectOverlapErr subjects overlap with an existing stream
 	JSStreamSubjectOverlapErr ErrorIdentifier = 10065
 
+	// JSStreamSubjectRateExceededErr subject rate limit exceeded
+	JSStreamSubjectRateExceededErr ErrorIdentifier = 10190
+
+	// JSStreamSubjectTokensErrF subject {subject} does not have the {tokens} tokens required by the stream
+	JSStreamSubjectTokensErrF ErrorIdentifier = 10197
+
 	// JSStreamTemplateCreateErrF Generic template creation failed string ({err})
 	JSStreamTemplateCreateErrF ErrorIdentifier = 10066
 
@@ -455,15 +587,27 @@ const (
 	// JSStreamTemplateNotFoundErr template not found
 	JSStreamTemplateNotFoundErr ErrorIdentifier = 10068
 
+	// JSStreamTokenPlacementInvalidErrF stream token placement is invalid: {err}
+	JSStreamTokenPlacementInvalidErrF ErrorIdentifier = 10182
+
 	// JSStreamTransformInvalidDestination stream transform: {err}
 	JSStreamTransformInvalidDestination ErrorIdentifier = 10156
 
 	// JSStreamTransformInvalidSource stream transform source: {err}
 	JSStreamTransformInvalidSource ErrorIdentifier = 10155
 
+	// JSStreamTruncateErrF stream truncate failed: {err}
+	JSStreamTruncateErrF ErrorIdentifier = 10205
+
 	// JSStreamUpdateErrF Generic stream update error string ({err})
 	JSStreamUpdateErrF ErrorIdentifier = 10069
 
+	// JSStreamValidationRejectedErrF message rejected by validator: {err}
+	JSStreamValidationRejectedErrF ErrorIdentifier = 10194
+
+	// JSStreamValidationTimeoutErr message validation timed out
+	JSStreamValidationTimeoutErr ErrorIdentifier = 10195
+
 	// JSStreamWrongLastMsgIDErrF wrong last msg ID: {id}
 	JSStreamWrongLastMsgIDErrF ErrorIdentifier = 10070
 
@@ -479,7 +623,12 @@ const (
 
 var (
 	ApiErrors = map[ErrorIdentifier]*ApiError{
+		JSAccountFrozenErr:                         {Code: 403, ErrCode: 10196, Description: "jetstream asset creation is frozen for this account"},
 		JSAccountResourcesExceededErr:              {Code: 400, ErrCode: 10002, Description: "resource limits exceeded for account"},
+		JSApiResponseTooLargeErrF:                  {Code: 400, ErrCode: 10199, Description: "api response of {size} bytes exceeds the limit of {limit} bytes"},
+		JSAtomicPublishFailedErrF:                  {Code: 400, ErrCode: 10177, Description: "atomic publish failed: {err}"},
+		JSAtomicPublishInProgressErr:               {Code: 503, ErrCode: 10178, Description: "stream is locked by an atomic publish in progress"},
+		JSAtomicPublishInvalidErrF:                 {Code: 400, ErrCode: 10176, Description: "atomic publish request invalid: {err}"},
 		JSBadRequestErr:                            {Code: 400, ErrCode: 10003, Description: "bad request"},
 		JSClusterIncompleteErr:                     {Code: 503, ErrCode: 10004, Description: "incomplete results"},
 		JSClusterNoPeersErrF:                       {Code: 400, ErrCode: 10005, Description: "{err}"},
@@ -494,11 +643,15 @@ var (
 		JSClusterUnSupportFeatureErr:               {Code: 503, ErrCode: 10036, Description: "not currently supported in clustered mode"},
 		JSConsumerAlreadyExists:                    {Code: 400, ErrCode: 10148, Description: "consumer already exists"},
 		JSConsumerBadDurableNameErr:                {Code: 400, ErrCode: 10103, Description: "durable name can not contain '.', '*', '>'"},
+		JSConsumerCheckpointInvalidErrF:            {Code: 400, ErrCode: 10171, Description: "consumer checkpoint is invalid: {err}"},
+		JSConsumerCheckpointRequiresDurableErr:     {Code: 400, ErrCode: 10172, Description: "consumer checkpoints require a durable consumer"},
+		JSConsumerCompressionInvalidErrF:           {Code: 400, ErrCode: 10179, Description: "consumer compression is invalid: {err}"},
 		JSConsumerConfigRequiredErr:                {Code: 400, ErrCode: 10078, Description: "consumer config required"},
 		JSConsumerCreateDurableAndNameMismatch:     {Code: 400, ErrCode: 10132, Description: "Consumer Durable and Name have to be equal if both are provided"},
 		JSConsumerCreateErrF:                       {Code: 500, ErrCode: 10012, Description: "{err}"},
 		JSConsumerCreateFilterSubjectMismatchErr:   {Code: 400, ErrCode: 10131, Description: "Consumer create request did not match filtered subject from create subject"},
 		JSConsumerDeliverCycleErr:                  {Code: 400, ErrCode: 10081, Description: "consumer deliver subject forms a cycle"},
+		JSConsumerDeliverOrderInvalidErrF:          {Code: 400, ErrCode: 10170, Description: "consumer delivery order is invalid: {err}"},
 		JSConsumerDeliverToWildcardsErr:            {Code: 400, ErrCode: 10079, Description: "consumer deliver subject has wildcards"},
 		JSConsumerDescriptionTooLongErrF:           {Code: 400, ErrCode: 10107, Description: "consumer description is too long, maximum allowed is {max}"},
 		JSConsumerDirectRequiresEphemeralErr:       {Code: 400, ErrCode: 10091, Description: "consumer direct requires an ephemeral consumer"},
@@ -535,13 +688,19 @@ var (
 		JSConsumerOfflineErr:                       {Code: 500, ErrCode: 10119, Description: "consumer is offline"},
 		JSConsumerOnMappedErr:                      {Code: 400, ErrCode: 10092, Description: "consumer direct on a mapped consumer"},
 		JSConsumerOverlappingSubjectFilters:        {Code: 400, ErrCode: 10138, Description: "consumer subject filters cannot overlap"},
+		JSConsumerProgressHeartbeatsRequiresAckErr: {Code: 400, ErrCode: 10183, Description: "consumer progress heartbeats require acks"},
+		JSConsumerProtectedErr:                     {Code: 400, ErrCode: 10191, Description: "consumer is protected, deletion requires force"},
+		JSConsumerProtectedInvalidErrF:             {Code: 400, ErrCode: 10192, Description: "protected consumer configuration is invalid: {err}"},
 		JSConsumerPullNotDurableErr:                {Code: 400, ErrCode: 10085, Description: "consumer in pull mode requires a durable name"},
 		JSConsumerPullRequiresAckErr:               {Code: 400, ErrCode: 10084, Description: "consumer in pull mode requires ack policy on workqueue stream"},
 		JSConsumerPullWithRateLimitErr:             {Code: 400, ErrCode: 10086, Description: "consumer in pull mode can not have rate limit set"},
 		JSConsumerPushMaxWaitingErr:                {Code: 400, ErrCode: 10080, Description: "consumer in push mode can not set max waiting"},
 		JSConsumerReplacementWithDifferentNameErr:  {Code: 400, ErrCode: 10106, Description: "consumer replacement durable config not the same"},
+		JSConsumerReplaySpeedInvalidErrF:           {Code: 400, ErrCode: 10185, Description: "consumer replay speed is invalid: {err}"},
 		JSConsumerReplicasExceedsStream:            {Code: 400, ErrCode: 10126, Description: "consumer config replica count exceeds parent stream"},
 		JSConsumerReplicasShouldMatchStream:        {Code: 400, ErrCode: 10134, Description: "consumer config replicas must match interest retention stream's replicas"},
+		JSConsumerSharedReplicatedStreamErr:        {Code: 400, ErrCode: 10169, Description: "shared consumers are not supported on replicated streams"},
+		JSConsumerSharedRequiresWorkQueueErr:       {Code: 400, ErrCode: 10168, Description: "shared consumers require a stream with WorkQueue retention"},
 		JSConsumerSmallHeartbeatErr:                {Code: 400, ErrCode: 10083, Description: "consumer idle heartbeat needs to be >= 100ms"},
 		JSConsumerStoreFailedErrF:                  {Code: 500, ErrCode: 10104, Description: "error creating store for consumer: {err}"},
 		JSConsumerWQConsumerNotDeliverAllErr:       {Code: 400, ErrCode: 10101, Description: "consumer must be deliver all on workqueue stream"},
@@ -551,9 +710,12 @@ var (
 		JSConsumerWithFlowControlNeedsHeartbeats:   {Code: 400, ErrCode: 10108, Description: "consumer with flow control also needs heartbeats"},
 		JSInsufficientResourcesErr:                 {Code: 503, ErrCode: 10023, Description: "insufficient resources"},
 		JSInvalidJSONErr:                           {Code: 400, ErrCode: 10025, Description: "invalid JSON: {err}"},
+		JSMaintenanceModeErr:                       {Code: 503, ErrCode: 10181, Description: "jetstream is in maintenance mode"},
 		JSMaximumConsumersLimitErr:                 {Code: 400, ErrCode: 10026, Description: "maximum consumers limit reached"},
 		JSMaximumStreamsLimitErr:                   {Code: 400, ErrCode: 10027, Description: "maximum number of streams reached"},
 		JSMemoryResourcesExceededErr:               {Code: 500, ErrCode: 10028, Description: "insufficient memory resources available"},
+		JSMessageTTLDisabledErr:                    {Code: 400, ErrCode: 10187, Description: "per-message TTL is disabled"},
+		JSMessageTTLInvalidErr:                     {Code: 400, ErrCode: 10186, Description: "invalid per-message TTL"},
 		JSMirrorConsumerSetupFailedErrF:            {Code: 500, ErrCode: 10029, Description: "{err}"},
 		JSMirrorInvalidStreamName:                  {Code: 400, ErrCode: 10142, Description: "mirrored stream name is invalid"},
 		JSMirrorInvalidSubjectFilter:               {Code: 400, ErrCode: 10151, Description: "mirror transform source: {err}"},
@@ -575,10 +737,15 @@ var (
 		JSPedanticErrF:                             {Code: 400, ErrCode: 10157, Description: "pedantic mode: {err}"},
 		JSPeerRemapErr:                             {Code: 503, ErrCode: 10075, Description: "peer remap failed"},
 		JSRaftGeneralErrF:                          {Code: 500, ErrCode: 10041, Description: "{err}"},
+		JSRaftWALCompactErrF:                       {Code: 500, ErrCode: 10188, Description: "raft WAL compaction failed: {err}"},
 		JSReplicasCountCannotBeNegative:            {Code: 400, ErrCode: 10133, Description: "replicas count cannot be negative"},
+		JSRestoreResumeNotFoundErr:                 {Code: 404, ErrCode: 10166, Description: "restore to resume not found"},
 		JSRestoreSubscribeFailedErrF:               {Code: 500, ErrCode: 10042, Description: "JetStream unable to subscribe to restore snapshot {subject}: {err}"},
 		JSSequenceNotFoundErrF:                     {Code: 400, ErrCode: 10043, Description: "sequence {seq} not found"},
+		JSShardedStreamNotFoundErr:                 {Code: 404, ErrCode: 10175, Description: "sharded stream not found"},
 		JSSnapshotDeliverSubjectInvalidErr:         {Code: 400, ErrCode: 10015, Description: "deliver subject not valid"},
+		JSSourceBridgeFailedErrF:                   {Code: 500, ErrCode: 10160, Description: "stream source bridge failed: {err}"},
+		JSSourceBridgeInvalidErrF:                  {Code: 400, ErrCode: 10159, Description: "stream source bridge invalid: {err}"},
 		JSSourceConsumerSetupFailedErrF:            {Code: 500, ErrCode: 10045, Description: "{err}"},
 		JSSourceDuplicateDetected:                  {Code: 400, ErrCode: 10140, Description: "duplicate source configuration detected"},
 		JSSourceInvalidStreamName:                  {Code: 400, ErrCode: 10141, Description: "sourced stream name is invalid"},
@@ -588,7 +755,9 @@ var (
 		JSSourceMultipleFiltersNotAllowed:          {Code: 400, ErrCode: 10144, Description: "source with multiple subject transforms cannot also have a single subject filter"},
 		JSSourceOverlappingSubjectFilters:          {Code: 400, ErrCode: 10147, Description: "source filters can not overlap"},
 		JSStorageResourcesExceededErr:              {Code: 500, ErrCode: 10047, Description: "insufficient storage resources available"},
+		JSStreamAssertInvalidErrF:                  {Code: 400, ErrCode: 10173, Description: "stream assertion is invalid: {err}"},
 		JSStreamAssignmentErrF:                     {Code: 500, ErrCode: 10048, Description: "{err}"},
+		JSStreamBackupInvalidErrF:                  {Code: 400, ErrCode: 10165, Description: "stream backup configuration is invalid: {err}"},
 		JSStreamCreateErrF:                         {Code: 500, ErrCode: 10049, Description: "{err}"},
 		JSStreamDeleteErrF:                         {Code: 500, ErrCode: 10050, Description: "{err}"},
 		JSStreamDuplicateMessageConflict:           {Code: 409, ErrCode: 10158, Description: "duplicate message id is in process"},
@@ -596,7 +765,11 @@ var (
 		JSStreamExternalDelPrefixOverlapsErrF:      {Code: 400, ErrCode: 10022, Description: "stream external delivery prefix {prefix} overlaps with stream subject {subject}"},
 		JSStreamGeneralErrorF:                      {Code: 500, ErrCode: 10051, Description: "{err}"},
 		JSStreamHeaderExceedsMaximumErr:            {Code: 400, ErrCode: 10097, Description: "header size exceeds maximum allowed of 64k"},
+		JSStreamHookRejectedErrF:                   {Code: 403, ErrCode: 10200, Description: "stream {op} rejected by lifecycle hook: {err}"},
+		JSStreamHookTimeoutErrF:                    {Code: 503, ErrCode: 10201, Description: "stream {op} lifecycle hook did not reply in time"},
+		JSStreamHotSubjectsInvalidErrF:             {Code: 400, ErrCode: 10189, Description: "hot subjects configuration is invalid: {err}"},
 		JSStreamInfoMaxSubjectsErr:                 {Code: 500, ErrCode: 10117, Description: "subject details would exceed maximum allowed"},
+		JSStreamIngestRateExceededErr:              {Code: 429, ErrCode: 10193, Description: "stream ingest rate limit exceeded"},
 		JSStreamInvalidConfigF:                     {Code: 500, ErrCode: 10052, Description: "{err}"},
 		JSStreamInvalidErr:                         {Code: 500, ErrCode: 10096, Description: "stream not valid"},
 		JSStreamInvalidExternalDeliverySubjErrF:    {Code: 400, ErrCode: 10024, Description: "stream external delivery prefix {prefix} must not contain wildcards"},
@@ -616,22 +789,41 @@ var (
 		JSStreamNotFoundErr:                        {Code: 404, ErrCode: 10059, Description: "stream not found"},
 		JSStreamNotMatchErr:                        {Code: 400, ErrCode: 10060, Description: "expected stream does not match"},
 		JSStreamOfflineErr:                         {Code: 500, ErrCode: 10118, Description: "stream is offline"},
+		JSStreamPausedErr:                          {Code: 503, ErrCode: 10198, Description: "stream paused"},
 		JSStreamPurgeFailedF:                       {Code: 500, ErrCode: 10110, Description: "{err}"},
+		JSStreamPushMirrorFailedErrF:               {Code: 500, ErrCode: 10162, Description: "push mirror failed: {err}"},
+		JSStreamPushMirrorInvalidErrF:              {Code: 400, ErrCode: 10161, Description: "push mirror invalid: {err}"},
+		JSStreamPushMirrorRejectedErrF:             {Code: 500, ErrCode: 10206, Description: "push mirror message {seq} rejected by remote stream: {err}"},
+		JSStreamReadReplicasInvalidErrF:            {Code: 400, ErrCode: 10164, Description: "stream read replicas are invalid: {err}"},
+		JSStreamRenameErrF:                         {Code: 400, ErrCode: 10202, Description: "stream rename failed: {err}"},
 		JSStreamReplicasNotSupportedErr:            {Code: 500, ErrCode: 10074, Description: "replicas > 1 not supported in non-clustered mode"},
 		JSStreamReplicasNotUpdatableErr:            {Code: 400, ErrCode: 10061, Description: "Replicas configuration can not be updated"},
 		JSStreamRestoreErrF:                        {Code: 500, ErrCode: 10062, Description: "restore failed: {err}"},
 		JSStreamRollupFailedF:                      {Code: 500, ErrCode: 10111, Description: "{err}"},
+		JSStreamScrubInProgressErr:                 {Code: 409, ErrCode: 10203, Description: "stream scrub already in progress"},
+		JSStreamScrubNotSupportedErr:               {Code: 400, ErrCode: 10204, Description: "stream storage does not support scrubbing"},
 		JSStreamSealedErr:                          {Code: 400, ErrCode: 10109, Description: "invalid operation on sealed stream"},
+		JSStreamSearchInvalidErrF:                  {Code: 400, ErrCode: 10184, Description: "stream search is invalid: {err}"},
 		JSStreamSequenceNotMatchErr:                {Code: 503, ErrCode: 10063, Description: "expected stream sequence does not match"},
+		JSStreamShardingInvalidErrF:                {Code: 400, ErrCode: 10174, Description: "stream sharding is invalid: {err}"},
 		JSStreamSnapshotErrF:                       {Code: 500, ErrCode: 10064, Description: "snapshot failed: {err}"},
+		JSStreamStatsNotEnabledErr:                 {Code: 400, ErrCode: 10167, Description: "stream statistics sampling is not enabled"},
+		JSStreamStorageReadOnlyErrF:                {Code: 500, ErrCode: 10163, Description: "stream is read-only after a storage failure: {err}"},
+		JSStreamStorageRecoverFailedErrF:           {Code: 500, ErrCode: 10180, Description: "stream storage could not be recovered: {err}"},
 		JSStreamStoreFailedF:                       {Code: 503, ErrCode: 10077, Description: "{err}"},
 		JSStreamSubjectOverlapErr:                  {Code: 400, ErrCode: 10065, Description: "subjects overlap with an existing stream"},
+		JSStreamSubjectRateExceededErr:             {Code: 429, ErrCode: 10190, Description: "subject rate limit exceeded"},
+		JSStreamSubjectTokensErrF:                  {Code: 400, ErrCode: 10197, Description: "subject {subject} does not have the {tokens} tokens required by the stream"},
 		JSStreamTemplateCreateErrF:                 {Code: 500, ErrCode: 10066, Description: "{err}"},
 		JSStreamTemplateDeleteErrF:                 {Code: 500, ErrCode: 10067, Description: "{err}"},
 		JSStreamTemplateNotFoundErr:                {Code: 404, ErrCode: 10068, Description: "template not found"},
+		JSStreamTokenPlacementInvalidErrF:          {Code: 400, ErrCode: 10182, Description: "stream token placement is invalid: {err}"},
 		JSStreamTransformInvalidDestination:        {Code: 400, ErrCode: 10156, Description: "stream transform: {err}"},
 		JSStreamTransformInvalidSource:             {Code: 400, ErrCode: 10155, Description: "stream transform source: {err}"},
+		JSStreamTruncateErrF:                       {Code: 500, ErrCode: 10205, Description: "stream truncate failed: {err}"},
 		JSStreamUpdateErrF:                         {Code: 500, ErrCode: 10069, Description: "{err}"},
+		JSStreamValidationRejectedErrF:             {Code: 400, ErrCode: 10194, Description: "message rejected by validator: {err}"},
+		JSStreamValidationTimeoutErr:               {Code: 503, ErrCode: 10195, Description: "message validation timed out"},
 		JSStreamWrongLastMsgIDErrF:                 {Code: 400, ErrCode: 10070, Description: "wrong last msg ID: {id}"},
 		JSStreamWrongLastSequenceErrF:              {Code: 400, ErrCode: 10071, Description: "wrong last sequence: {seq}"},
 		JSTempStorageFailedErr:                     {Code: 500, ErrCode: 10072, Description: "JetStream unable to open temp storage for restore"},
@@ -661,6 +853,16 @@ var (
 	ErrReplicasNotSupported = ApiErrors[JSStreamReplicasNotSupportedErr]
 )
 
+// NewJSAccountFrozenError creates a new JSAccountFrozenErr error: "jetstream asset creation is frozen for this account"
+func NewJSAccountFrozenError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSAccountFrozenErr]
+}
+
 // NewJSAccountResourcesExceededError creates a new JSAccountResourcesExceededErr error: "resource limits exceeded for account"
 func NewJSAccountResourcesExceededError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -671,6 +873,64 @@ func NewJSAccountResourcesExceededError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSAccountResourcesExceededErr]
 }
 
+// NewJSApiResponseTooLargeError creates a new JSApiResponseTooLargeErrF error: "api response of {size} bytes exceeds the limit of {limit} bytes"
+func NewJSApiResponseTooLargeError(limit interface{}, size interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSApiResponseTooLargeErrF]
+	args := e.toReplacerArgs([]interface{}{"{limit}", limit, "{size}", size})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSAtomicPublishFailedError creates a new JSAtomicPublishFailedErrF error: "atomic publish failed: {err}"
+func NewJSAtomicPublishFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSAtomicPublishFailedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSAtomicPublishInProgressError creates a new JSAtomicPublishInProgressErr error: "stream is locked by an atomic publish in progress"
+func NewJSAtomicPublishInProgressError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSAtomicPublishInProgressErr]
+}
+
+// NewJSAtomicPublishInvalidError creates a new JSAtomicPublishInvalidErrF error: "atomic publish request invalid: {err}"
+func NewJSAtomicPublishInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSAtomicPublishInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSBadRequestError creates a new JSBadRequestErr error: "bad request"
 func NewJSBadRequestError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -817,6 +1077,48 @@ func NewJSConsumerBadDurableNameError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerBadDurableNameErr]
 }
 
+// NewJSConsumerCheckpointInvalidError creates a new JSConsumerCheckpointInvalidErrF error: "consumer checkpoint is invalid: {err}"
+func NewJSConsumerCheckpointInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerCheckpointInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerCheckpointRequiresDurableError creates a new JSConsumerCheckpointRequiresDurableErr error: "consumer checkpoints require a durable consumer"
+func NewJSConsumerCheckpointRequiresDurableError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerCheckpointRequiresDurableErr]
+}
+
+// NewJSConsumerCompressionInvalidError creates a new JSConsumerCompressionInvalidErrF error: "consumer compression is invalid: {err}"
+func NewJSConsumerCompressionInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerCompressionInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerConfigRequiredError creates a new JSConsumerConfigRequiredErr error: "consumer config required"
 func NewJSConsumerConfigRequiredError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -873,6 +1175,22 @@ func NewJSConsumerDeliverCycleError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerDeliverCycleErr]
 }
 
+// NewJSConsumerDeliverOrderInvalidError creates a new JSConsumerDeliverOrderInvalidErrF error: "consumer delivery order is invalid: {err}"
+func NewJSConsumerDeliverOrderInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerDeliverOrderInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerDeliverToWildcardsError creates a new JSConsumerDeliverToWildcardsErr error: "consumer deliver subject has wildcards"
 func NewJSConsumerDeliverToWildcardsError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1281,6 +1599,42 @@ func NewJSConsumerOverlappingSubjectFiltersError(opts ...ErrorOption) *ApiError
 	return ApiErrors[JSConsumerOverlappingSubjectFilters]
 }
 
+// NewJSConsumerProgressHeartbeatsRequiresAckError creates a new JSConsumerProgressHeartbeatsRequiresAckErr error: "consumer progress heartbeats require acks"
+func NewJSConsumerProgressHeartbeatsRequiresAckError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerProgressHeartbeatsRequiresAckErr]
+}
+
+// NewJSConsumerProtectedError creates a new JSConsumerProtectedErr error: "consumer is protected, deletion requires force"
+func NewJSConsumerProtectedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerProtectedErr]
+}
+
+// NewJSConsumerProtectedInvalidError creates a new JSConsumerProtectedInvalidErrF error: "protected consumer configuration is invalid: {err}"
+func NewJSConsumerProtectedInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerProtectedInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerPullNotDurableError creates a new JSConsumerPullNotDurableErr error: "consumer in pull mode requires a durable name"
 func NewJSConsumerPullNotDurableError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1331,6 +1685,22 @@ func NewJSConsumerReplacementWithDifferentNameError(opts ...ErrorOption) *ApiErr
 	return ApiErrors[JSConsumerReplacementWithDifferentNameErr]
 }
 
+// NewJSConsumerReplaySpeedInvalidError creates a new JSConsumerReplaySpeedInvalidErrF error: "consumer replay speed is invalid: {err}"
+func NewJSConsumerReplaySpeedInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerReplaySpeedInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerReplicasExceedsStreamError creates a new JSConsumerReplicasExceedsStream error: "consumer config replica count exceeds parent stream"
 func NewJSConsumerReplicasExceedsStreamError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1351,6 +1721,26 @@ func NewJSConsumerReplicasShouldMatchStreamError(opts ...ErrorOption) *ApiError
 	return ApiErrors[JSConsumerReplicasShouldMatchStream]
 }
 
+// NewJSConsumerSharedReplicatedStreamError creates a new JSConsumerSharedReplicatedStreamErr error: "shared consumers are not supported on replicated streams"
+func NewJSConsumerSharedReplicatedStreamError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerSharedReplicatedStreamErr]
+}
+
+// NewJSConsumerSharedRequiresWorkQueueError creates a new JSConsumerSharedRequiresWorkQueueErr error: "shared consumers require a stream with WorkQueue retention"
+func NewJSConsumerSharedRequiresWorkQueueError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerSharedRequiresWorkQueueErr]
+}
+
 // NewJSConsumerSmallHeartbeatError creates a new JSConsumerSmallHeartbeatErr error: "consumer idle heartbeat needs to be >= 100ms"
 func NewJSConsumerSmallHeartbeatError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1453,6 +1843,16 @@ func NewJSInvalidJSONError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSMaintenanceModeError creates a new JSMaintenanceModeErr error: "jetstream is in maintenance mode"
+func NewJSMaintenanceModeError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMaintenanceModeErr]
+}
+
 // NewJSMaximumConsumersLimitError creates a new JSMaximumConsumersLimitErr error: "maximum consumers limit reached"
 func NewJSMaximumConsumersLimitError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1483,6 +1883,26 @@ func NewJSMemoryResourcesExceededError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSMemoryResourcesExceededErr]
 }
 
+// NewJSMessageTTLDisabledError creates a new JSMessageTTLDisabledErr error: "per-message TTL is disabled"
+func NewJSMessageTTLDisabledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessageTTLDisabledErr]
+}
+
+// NewJSMessageTTLInvalidError creates a new JSMessageTTLInvalidErr error: "invalid per-message TTL"
+func NewJSMessageTTLInvalidError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessageTTLInvalidErr]
+}
+
 // NewJSMirrorConsumerSetupFailedError creates a new JSMirrorConsumerSetupFailedErrF error: "{err}"
 func NewJSMirrorConsumerSetupFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1723,6 +2143,22 @@ func NewJSRaftGeneralError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSRaftWALCompactError creates a new JSRaftWALCompactErrF error: "raft WAL compaction failed: {err}"
+func NewJSRaftWALCompactError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSRaftWALCompactErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSReplicasCountCannotBeNegativeError creates a new JSReplicasCountCannotBeNegative error: "replicas count cannot be negative"
 func NewJSReplicasCountCannotBeNegativeError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1733,6 +2169,16 @@ func NewJSReplicasCountCannotBeNegativeError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSReplicasCountCannotBeNegative]
 }
 
+// NewJSRestoreResumeNotFoundError creates a new JSRestoreResumeNotFoundErr error: "restore to resume not found"
+func NewJSRestoreResumeNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSRestoreResumeNotFoundErr]
+}
+
 // NewJSRestoreSubscribeFailedError creates a new JSRestoreSubscribeFailedErrF error: "JetStream unable to subscribe to restore snapshot {subject}: {err}"
 func NewJSRestoreSubscribeFailedError(err error, subject interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1765,6 +2211,16 @@ func NewJSSequenceNotFoundError(seq uint64, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSShardedStreamNotFoundError creates a new JSShardedStreamNotFoundErr error: "sharded stream not found"
+func NewJSShardedStreamNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSShardedStreamNotFoundErr]
+}
+
 // NewJSSnapshotDeliverSubjectInvalidError creates a new JSSnapshotDeliverSubjectInvalidErr error: "deliver subject not valid"
 func NewJSSnapshotDeliverSubjectInvalidError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1775,14 +2231,14 @@ func NewJSSnapshotDeliverSubjectInvalidError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSSnapshotDeliverSubjectInvalidErr]
 }
 
-// NewJSSourceConsumerSetupFailedError creates a new JSSourceConsumerSetupFailedErrF error: "{err}"
-func NewJSSourceConsumerSetupFailedError(err error, opts ...ErrorOption) *ApiError {
+// NewJSSourceBridgeFailedError creates a new JSSourceBridgeFailedErrF error: "stream source bridge failed: {err}"
+func NewJSSourceBridgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
 	if ae, ok := eopts.err.(*ApiError); ok {
 		return ae
 	}
 
-	e := ApiErrors[JSSourceConsumerSetupFailedErrF]
+	e := ApiErrors[JSSourceBridgeFailedErrF]
 	args := e.toReplacerArgs([]interface{}{"{err}", err})
 	return &ApiError{
 		Code:        e.Code,
@@ -1791,16 +2247,48 @@ func NewJSSourceConsumerSetupFailedError(err error, opts ...ErrorOption) *ApiErr
 	}
 }
 
-// NewJSSourceDuplicateDetectedError creates a new JSSourceDuplicateDetected error: "duplicate source configuration detected"
-func NewJSSourceDuplicateDetectedError(opts ...ErrorOption) *ApiError {
+// NewJSSourceBridgeInvalidError creates a new JSSourceBridgeInvalidErrF error: "stream source bridge invalid: {err}"
+func NewJSSourceBridgeInvalidError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
 	if ae, ok := eopts.err.(*ApiError); ok {
 		return ae
 	}
 
-	return ApiErrors[JSSourceDuplicateDetected]
-}
-
+	e := ApiErrors[JSSourceBridgeInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSSourceConsumerSetupFailedError creates a new JSSourceConsumerSetupFailedErrF error: "{err}"
+func NewJSSourceConsumerSetupFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSSourceConsumerSetupFailedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSSourceDuplicateDetectedError creates a new JSSourceDuplicateDetected error: "duplicate source configuration detected"
+func NewJSSourceDuplicateDetectedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSSourceDuplicateDetected]
+}
+
 // NewJSSourceInvalidStreamNameError creates a new JSSourceInvalidStreamName error: "sourced stream name is invalid"
 func NewJSSourceInvalidStreamNameError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1883,6 +2371,22 @@ func NewJSStorageResourcesExceededError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStorageResourcesExceededErr]
 }
 
+// NewJSStreamAssertInvalidError creates a new JSStreamAssertInvalidErrF error: "stream assertion is invalid: {err}"
+func NewJSStreamAssertInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamAssertInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamAssignmentError creates a new JSStreamAssignmentErrF error: "{err}"
 func NewJSStreamAssignmentError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1899,6 +2403,22 @@ func NewJSStreamAssignmentError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamBackupInvalidError creates a new JSStreamBackupInvalidErrF error: "stream backup configuration is invalid: {err}"
+func NewJSStreamBackupInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamBackupInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamCreateError creates a new JSStreamCreateErrF error: "{err}"
 func NewJSStreamCreateError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1999,6 +2519,54 @@ func NewJSStreamHeaderExceedsMaximumError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamHeaderExceedsMaximumErr]
 }
 
+// NewJSStreamHookRejectedError creates a new JSStreamHookRejectedErrF error: "stream {op} rejected by lifecycle hook: {err}"
+func NewJSStreamHookRejectedError(err error, op interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamHookRejectedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err, "{op}", op})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamHookTimeoutError creates a new JSStreamHookTimeoutErrF error: "stream {op} lifecycle hook did not reply in time"
+func NewJSStreamHookTimeoutError(op interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamHookTimeoutErrF]
+	args := e.toReplacerArgs([]interface{}{"{op}", op})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamHotSubjectsInvalidError creates a new JSStreamHotSubjectsInvalidErrF error: "hot subjects configuration is invalid: {err}"
+func NewJSStreamHotSubjectsInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamHotSubjectsInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamInfoMaxSubjectsError creates a new JSStreamInfoMaxSubjectsErr error: "subject details would exceed maximum allowed"
 func NewJSStreamInfoMaxSubjectsError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2009,6 +2577,16 @@ func NewJSStreamInfoMaxSubjectsError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamInfoMaxSubjectsErr]
 }
 
+// NewJSStreamIngestRateExceededError creates a new JSStreamIngestRateExceededErr error: "stream ingest rate limit exceeded"
+func NewJSStreamIngestRateExceededError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamIngestRateExceededErr]
+}
+
 // NewJSStreamInvalidConfigError creates a new JSStreamInvalidConfigF error: "{err}"
 func NewJSStreamInvalidConfigError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2229,6 +2807,16 @@ func NewJSStreamOfflineError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamOfflineErr]
 }
 
+// NewJSStreamPausedError creates a new JSStreamPausedErr error: "stream paused"
+func NewJSStreamPausedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamPausedErr]
+}
+
 // NewJSStreamPurgeFailedError creates a new JSStreamPurgeFailedF error: "{err}"
 func NewJSStreamPurgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2245,6 +2833,86 @@ func NewJSStreamPurgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamPushMirrorFailedError creates a new JSStreamPushMirrorFailedErrF error: "push mirror failed: {err}"
+func NewJSStreamPushMirrorFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamPushMirrorFailedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamPushMirrorInvalidError creates a new JSStreamPushMirrorInvalidErrF error: "push mirror invalid: {err}"
+func NewJSStreamPushMirrorInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamPushMirrorInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamPushMirrorRejectedError creates a new JSStreamPushMirrorRejectedErrF error: "push mirror message {seq} rejected by remote stream: {err}"
+func NewJSStreamPushMirrorRejectedError(err error, seq uint64, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamPushMirrorRejectedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err, "{seq}", seq})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamReadReplicasInvalidError creates a new JSStreamReadReplicasInvalidErrF error: "stream read replicas are invalid: {err}"
+func NewJSStreamReadReplicasInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamReadReplicasInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamRenameError creates a new JSStreamRenameErrF error: "stream rename failed: {err}"
+func NewJSStreamRenameError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamRenameErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamReplicasNotSupportedError creates a new JSStreamReplicasNotSupportedErr error: "replicas > 1 not supported in non-clustered mode"
 func NewJSStreamReplicasNotSupportedError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2297,6 +2965,26 @@ func NewJSStreamRollupFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamScrubInProgressError creates a new JSStreamScrubInProgressErr error: "stream scrub already in progress"
+func NewJSStreamScrubInProgressError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamScrubInProgressErr]
+}
+
+// NewJSStreamScrubNotSupportedError creates a new JSStreamScrubNotSupportedErr error: "stream storage does not support scrubbing"
+func NewJSStreamScrubNotSupportedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamScrubNotSupportedErr]
+}
+
 // NewJSStreamSealedError creates a new JSStreamSealedErr error: "invalid operation on sealed stream"
 func NewJSStreamSealedError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2307,6 +2995,22 @@ func NewJSStreamSealedError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamSealedErr]
 }
 
+// NewJSStreamSearchInvalidError creates a new JSStreamSearchInvalidErrF error: "stream search is invalid: {err}"
+func NewJSStreamSearchInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamSearchInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamSequenceNotMatchError creates a new JSStreamSequenceNotMatchErr error: "expected stream sequence does not match"
 func NewJSStreamSequenceNotMatchError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2317,6 +3021,22 @@ func NewJSStreamSequenceNotMatchError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamSequenceNotMatchErr]
 }
 
+// NewJSStreamShardingInvalidError creates a new JSStreamShardingInvalidErrF error: "stream sharding is invalid: {err}"
+func NewJSStreamShardingInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamShardingInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamSnapshotError creates a new JSStreamSnapshotErrF error: "snapshot failed: {err}"
 func NewJSStreamSnapshotError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2333,6 +3053,48 @@ func NewJSStreamSnapshotError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamStatsNotEnabledError creates a new JSStreamStatsNotEnabledErr error: "stream statistics sampling is not enabled"
+func NewJSStreamStatsNotEnabledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamStatsNotEnabledErr]
+}
+
+// NewJSStreamStorageReadOnlyError creates a new JSStreamStorageReadOnlyErrF error: "stream is read-only after a storage failure: {err}"
+func NewJSStreamStorageReadOnlyError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamStorageReadOnlyErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamStorageRecoverFailedError creates a new JSStreamStorageRecoverFailedErrF error: "stream storage could not be recovered: {err}"
+func NewJSStreamStorageRecoverFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamStorageRecoverFailedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamStoreFailedError creates a new JSStreamStoreFailedF error: "{err}"
 func NewJSStreamStoreFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2359,6 +3121,32 @@ func NewJSStreamSubjectOverlapError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamSubjectOverlapErr]
 }
 
+// NewJSStreamSubjectRateExceededError creates a new JSStreamSubjectRateExceededErr error: "subject rate limit exceeded"
+func NewJSStreamSubjectRateExceededError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamSubjectRateExceededErr]
+}
+
+// NewJSStreamSubjectTokensError creates a new JSStreamSubjectTokensErrF error: "subject {subject} does not have the {tokens} tokens required by the stream"
+func NewJSStreamSubjectTokensError(subject interface{}, tokens interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamSubjectTokensErrF]
+	args := e.toReplacerArgs([]interface{}{"{subject}", subject, "{tokens}", tokens})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamTemplateCreateError creates a new JSStreamTemplateCreateErrF error: "{err}"
 func NewJSStreamTemplateCreateError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2401,6 +3189,22 @@ func NewJSStreamTemplateNotFoundError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamTemplateNotFoundErr]
 }
 
+// NewJSStreamTokenPlacementInvalidError creates a new JSStreamTokenPlacementInvalidErrF error: "stream token placement is invalid: {err}"
+func NewJSStreamTokenPlacementInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamTokenPlacementInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamTransformInvalidDestinationError creates a new JSStreamTransformInvalidDestination error: "stream transform: {err}"
 func NewJSStreamTransformInvalidDestinationError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2433,6 +3237,22 @@ func NewJSStreamTransformInvalidSourceError(err error, opts ...ErrorOption) *Api
 	}
 }
 
+// NewJSStreamTruncateError creates a new JSStreamTruncateErrF error: "stream truncate failed: {err}"
+func NewJSStreamTruncateError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamTruncateErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamUpdateError creates a new JSStreamUpdateErrF error: "{err}"
 func NewJSStreamUpdateError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2449,6 +3269,32 @@ func NewJSStreamUpdateError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamValidationRejectedError creates a new JSStreamValidationRejectedErrF error: "message rejected by validator: {err}"
+func NewJSStreamValidationRejectedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamValidationRejectedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamValidationTimeoutError creates a new JSStreamValidationTimeoutErr error: "message validation timed out"
+func NewJSStreamValidationTimeoutError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamValidationTimeoutErr]
+}
+
 // NewJSStreamWrongLastMsgIDError creates a new JSStreamWrongLastMsgIDErrF error: "wrong last msg ID: {id}"
 func NewJSStreamWrongLastMsgIDError(id interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -92,6 +92,19 @@ type JSConsumerPauseAdvisory struct {
 
 const JSConsumerPauseAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_pause"
 
+// JSConsumerRecreatedAdvisory indicates that a protected consumer lost its state and was
+// recreated from its configuration, starting over at the stream sequence StartSeq.
+type JSConsumerRecreatedAdvisory struct {
+	TypedEvent
+	Stream   string `json:"stream"`
+	Consumer string `json:"consumer"`
+	StartSeq uint64 `json:"start_seq"`
+	Error    string `json:"error,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+const JSConsumerRecreatedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_recreated"
+
 // JSConsumerAckMetric is a metric published when a user acknowledges a message, the
 // number of these that will be published is dependent on SampleFrequency
 type JSConsumerAckMetric struct {
@@ -108,6 +121,28 @@ type JSConsumerAckMetric struct {
 // JSConsumerAckMetricType is the schema type for JSConsumerAckMetricType
 const JSConsumerAckMetricType = "io.nats.jetstream.metric.v1.consumer_ack"
 
+// JSConsumerSLAMetric is a metric published by the consumer leader every SLAReportInterval,
+// aggregating the ack times and redeliveries of the messages of that interval.
+type JSConsumerSLAMetric struct {
+	TypedEvent
+	Stream         string        `json:"stream"`
+	Consumer       string        `json:"consumer"`
+	Start          time.Time     `json:"start"`
+	Interval       time.Duration `json:"interval"`
+	Acks           uint64        `json:"acks"`
+	AckTimeP50     time.Duration `json:"ack_time_p50"`
+	AckTimeP95     time.Duration `json:"ack_time_p95"`
+	AckTimeP99     time.Duration `json:"ack_time_p99"`
+	AckTimeMax     time.Duration `json:"ack_time_max"`
+	Delivered      uint64        `json:"delivered"`
+	Redelivered    uint64        `json:"redelivered"`
+	RedeliveryRate float64       `json:"redelivery_rate"`
+	Domain         string        `json:"domain,omitempty"`
+}
+
+// JSConsumerSLAMetricType is the schema type for JSConsumerSLAMetric
+const JSConsumerSLAMetricType = "io.nats.jetstream.metric.v1.consumer_sla"
+
 // JSConsumerDeliveryExceededAdvisory is an advisory informing that a message hit
 // its MaxDeliver threshold and so might be a candidate for DLQ handling
 type JSConsumerDeliveryExceededAdvisory struct {
@@ -178,6 +213,20 @@ type JSSnapshotCompleteAdvisory struct {
 // JSSnapshotCompleteAdvisoryType is the schema type for JSSnapshotCreateAdvisory
 const JSSnapshotCompleteAdvisoryType = "io.nats.jetstream.advisory.v1.snapshot_complete"
 
+// JSStreamMaxConsumersWarnAdvisory is an advisory sent when a new consumer made a stream
+// reach or go past its soft limit of consumers.
+type JSStreamMaxConsumersWarnAdvisory struct {
+	TypedEvent
+	Stream           string `json:"stream"`
+	Consumers        int    `json:"consumers"`
+	MaxConsumersWarn int    `json:"max_consumers_warn"`
+	MaxConsumers     int    `json:"max_consumers"`
+	Domain           string `json:"domain,omitempty"`
+}
+
+// JSStreamMaxConsumersWarnAdvisoryType is the schema type for JSStreamMaxConsumersWarnAdvisory
+const JSStreamMaxConsumersWarnAdvisoryType = "io.nats.jetstream.advisory.v1.stream_max_consumers_warn"
+
 // JSRestoreCreateAdvisory is an advisory sent after a snapshot is successfully started
 type JSRestoreCreateAdvisory struct {
 	TypedEvent
@@ -203,6 +252,157 @@ type JSRestoreCompleteAdvisory struct {
 // JSRestoreCompleteAdvisoryType is the schema type for JSSnapshotCreateAdvisory
 const JSRestoreCompleteAdvisoryType = "io.nats.jetstream.advisory.v1.restore_complete"
 
+// JSRestoreProgressAdvisory is an advisory sent periodically while the snapshot of a restore is received.
+// Size and ETA are only known when the size of the snapshot was given in the restore request,
+// and the number of messages is estimated from the stream state in the request.
+type JSRestoreProgressAdvisory struct {
+	TypedEvent
+	Stream   string        `json:"stream"`
+	Bytes    int64         `json:"bytes"`
+	Size     int64         `json:"size,omitempty"`
+	Messages uint64        `json:"msgs,omitempty"`
+	Rate     int64         `json:"rate"`
+	ETA      time.Duration `json:"eta,omitempty"`
+	Client   *ClientInfo   `json:"client"`
+	Domain   string        `json:"domain,omitempty"`
+}
+
+// JSRestoreProgressAdvisoryType is the schema type for JSRestoreProgressAdvisory
+const JSRestoreProgressAdvisoryType = "io.nats.jetstream.advisory.v1.restore_progress"
+
+// JSStreamBackupAdvisory is an advisory sent after a scheduled backup of a stream succeeded or failed
+type JSStreamBackupAdvisory struct {
+	TypedEvent
+	Stream      string    `json:"stream"`
+	Destination string    `json:"destination"`
+	Name        string    `json:"name,omitempty"`
+	Bytes       int64     `json:"bytes"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Error       string    `json:"error,omitempty"`
+	Domain      string    `json:"domain,omitempty"`
+}
+
+// JSStreamBackupAdvisoryType is the schema type for JSStreamBackupAdvisory
+const JSStreamBackupAdvisoryType = "io.nats.jetstream.advisory.v1.stream_backup"
+
+// JSStreamHotSubjectAdvisory is an advisory sent when a subject received more than
+// the threshold share of a stream's messages in the current window
+type JSStreamHotSubjectAdvisory struct {
+	TypedEvent
+	Stream    string        `json:"stream"`
+	Subject   string        `json:"subject"`
+	Msgs      uint64        `json:"msgs"`
+	Total     uint64        `json:"total"`
+	Threshold float64       `json:"threshold"`
+	Window    time.Duration `json:"window"`
+	Domain    string        `json:"domain,omitempty"`
+}
+
+// JSStreamHotSubjectAdvisoryType is the schema type for JSStreamHotSubjectAdvisory
+const JSStreamHotSubjectAdvisoryType = "io.nats.jetstream.advisory.v1.stream_hot_subject"
+
+// JSStreamSourceGapAdvisory is an advisory sent when the origin of a mirror or source
+// removed messages, e.g. by its limits, before the stream ingested them
+type JSStreamSourceGapAdvisory struct {
+	TypedEvent
+	Stream   string `json:"stream"`
+	Source   string `json:"source"`
+	Mirror   bool   `json:"mirror,omitempty"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+// JSStreamSourceGapAdvisoryType is the schema type for JSStreamSourceGapAdvisory
+const JSStreamSourceGapAdvisoryType = "io.nats.jetstream.advisory.v1.stream_source_gap"
+
+// JSStreamRetentionMigratedAdvisory is an advisory sent when an update changed the retention
+// policy of a stream, with the messages that were removed as consumed already
+type JSStreamRetentionMigratedAdvisory struct {
+	TypedEvent
+	Stream       string          `json:"stream"`
+	From         RetentionPolicy `json:"from"`
+	To           RetentionPolicy `json:"to"`
+	RemovedMsgs  uint64          `json:"removed_msgs"`
+	RemovedBytes uint64          `json:"removed_bytes"`
+	FirstSeq     uint64          `json:"first_seq"`
+	Domain       string          `json:"domain,omitempty"`
+}
+
+// JSStreamRetentionMigratedAdvisoryType is the schema type for JSStreamRetentionMigratedAdvisory
+const JSStreamRetentionMigratedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_retention_migrated"
+
+// JSStreamCompactedAdvisory is an advisory sent when the storage of a stream compacted
+// sparse message blocks in the background, reclaiming the space of deleted messages
+type JSStreamCompactedAdvisory struct {
+	TypedEvent
+	Stream         string `json:"stream"`
+	Blocks         int    `json:"blocks"`
+	Reclaimed      uint64 `json:"reclaimed_bytes"`
+	TotalReclaimed uint64 `json:"total_reclaimed_bytes"`
+	Domain         string `json:"domain,omitempty"`
+}
+
+// JSStreamCompactedAdvisoryType is the schema type for JSStreamCompactedAdvisory
+const JSStreamCompactedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_compacted"
+
+// JSStreamScrubAdvisory is an advisory sent when a server verified the messages
+// it stores for a stream against their checksums
+type JSStreamScrubAdvisory struct {
+	TypedEvent
+	Stream string             `json:"stream"`
+	Server string             `json:"server"`
+	Result *StreamScrubResult `json:"result"`
+	Domain string             `json:"domain,omitempty"`
+}
+
+// JSStreamScrubAdvisoryType is the schema type for JSStreamScrubAdvisory
+const JSStreamScrubAdvisoryType = "io.nats.jetstream.advisory.v1.stream_scrub"
+
+// JSStreamQuotaWarningAdvisory is an advisory sent to the system account when the usage of
+// a stream crossed its quota warning threshold of one of its limits
+type JSStreamQuotaWarningAdvisory struct {
+	TypedEvent
+	Server    string `json:"server"`
+	Account   string `json:"account"`
+	Stream    string `json:"stream"`
+	Limit     string `json:"limit"`
+	Threshold int    `json:"threshold"`
+	Used      uint64 `json:"used"`
+	Max       uint64 `json:"max"`
+	Cluster   string `json:"cluster,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+}
+
+// JSStreamQuotaWarningAdvisoryType is the schema type for JSStreamQuotaWarningAdvisory
+const JSStreamQuotaWarningAdvisoryType = "io.nats.jetstream.advisory.v1.stream_quota_warning"
+
+// JSStreamRepairAdvisory is an advisory sent when the storage of a stream was repaired on recovery
+type JSStreamRepairAdvisory struct {
+	TypedEvent
+	Stream string        `json:"stream"`
+	Server string        `json:"server"`
+	Repair *StreamRepair `json:"repair"`
+	Domain string        `json:"domain,omitempty"`
+}
+
+// JSStreamRepairAdvisoryType is the schema type for JSStreamRepairAdvisory
+const JSStreamRepairAdvisoryType = "io.nats.jetstream.advisory.v1.stream_repair"
+
+// JSStreamOversizedMsgsRemovedAdvisory is an advisory sent when an update lowered the max
+// message size of a stream and the stored messages over it were removed
+type JSStreamOversizedMsgsRemovedAdvisory struct {
+	TypedEvent
+	Stream      string `json:"stream"`
+	MaxMsgSize  int32  `json:"max_msg_size"`
+	RemovedMsgs uint64 `json:"removed_msgs"`
+	Domain      string `json:"domain,omitempty"`
+}
+
+// JSStreamOversizedMsgsRemovedAdvisoryType is the schema type for JSStreamOversizedMsgsRemovedAdvisory
+const JSStreamOversizedMsgsRemovedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_oversized_msgs_removed"
+
 // Clustering specific.
 
 // JSClusterLeaderElectedAdvisoryType is sent when the system elects a new meta leader.
@@ -284,6 +484,39 @@ type JSServerOutOfSpaceAdvisory struct {
 	Domain   string `json:"domain,omitempty"`
 }
 
+// JSServerStorageErrorAdvisoryType is sent when the server hits a failure of its storage.
+const JSServerStorageErrorAdvisoryType = "io.nats.jetstream.advisory.v1.server_storage_error"
+
+// JSServerStorageErrorAdvisory indicates that the storage of a server failed and what was done about it.
+type JSServerStorageErrorAdvisory struct {
+	TypedEvent
+	Server   string             `json:"server"`
+	ServerID string             `json:"server_id"`
+	Account  string             `json:"account,omitempty"`
+	Stream   string             `json:"stream,omitempty"`
+	Class    StorageErrorClass  `json:"class"`
+	Action   StorageErrorAction `json:"action"`
+	Error    string             `json:"error"`
+	Cluster  string             `json:"cluster"`
+	Domain   string             `json:"domain,omitempty"`
+}
+
+// JSServerStorageRecoveredAdvisoryType is sent when a stream that was read-only after a storage failure was recovered.
+const JSServerStorageRecoveredAdvisoryType = "io.nats.jetstream.advisory.v1.server_storage_recovered"
+
+// JSServerStorageRecoveredAdvisory indicates that a stream accepts new messages again after a storage failure.
+type JSServerStorageRecoveredAdvisory struct {
+	TypedEvent
+	Server   string            `json:"server"`
+	ServerID string            `json:"server_id"`
+	Account  string            `json:"account"`
+	Stream   string            `json:"stream"`
+	Class    StorageErrorClass `json:"class"`
+	Since    time.Time         `json:"since"`
+	Cluster  string            `json:"cluster"`
+	Domain   string            `json:"domain,omitempty"`
+}
+
 // JSServerRemovedAdvisoryType is sent when the server has been removed and JS disabled.
 const JSServerRemovedAdvisoryType = "io.nats.jetstream.advisory.v1.server_removed"
 
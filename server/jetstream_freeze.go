@@ -0,0 +1,101 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JetStreamFreeze is the freeze of an account. While frozen the account can not create
+// new streams or consumers, the existing ones keep working and can still be updated or deleted.
+type JetStreamFreeze struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// JSFreezeReq is the request to freeze or unfreeze the creation of JetStream assets of an account.
+// An empty request only reports the current freeze.
+type JSFreezeReq struct {
+	Enable bool `json:"enable"`
+}
+
+// Returns the freeze of the account, nil if it is not frozen.
+func (a *Account) jetStreamFreeze() *JetStreamFreeze {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.jsFrozen.IsZero() {
+		return nil
+	}
+	return &JetStreamFreeze{Enabled: true, Since: a.jsFrozen}
+}
+
+// JetStreamFrozen returns true if the creation of new JetStream assets is frozen for the account.
+func (a *Account) JetStreamFrozen() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return !a.jsFrozen.IsZero()
+}
+
+// SetJetStreamFreeze freezes or unfreezes the creation of new JetStream assets for the account.
+// The freeze is not persisted, and only applies to this server.
+func (a *Account) SetJetStreamFreeze(enable bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if enable == !a.jsFrozen.IsZero() {
+		return
+	}
+	if enable {
+		a.jsFrozen = time.Now().UTC()
+	} else {
+		a.jsFrozen = time.Time{}
+	}
+}
+
+// Request to freeze or unfreeze the creation of JetStream assets of an account.
+// Every server answers, so the freeze is applied to the meta leader wherever it is.
+func (s *Server) jsFreezeReq(c *client, name, reply string, hdr, msg []byte) {
+	if !s.eventsRunning() {
+		return
+	}
+
+	var req *JSFreezeReq
+	if len(msg) > 0 {
+		req = &JSFreezeReq{}
+		if err := json.Unmarshal(msg, req); err != nil {
+			s.sys.client.Errorf("Error unmarshalling JetStream freeze request: %v", err)
+			return
+		}
+	}
+
+	optz := &EventFilterOptions{}
+	s.zReq(c, reply, hdr, msg, optz, optz, func() (any, error) {
+		acc, err := s.lookupAccount(name)
+		if err != nil {
+			return nil, err
+		}
+		if req != nil && req.Enable != acc.JetStreamFrozen() {
+			acc.SetJetStreamFreeze(req.Enable)
+			if req.Enable {
+				s.Noticef("JetStream asset creation frozen for account %q", name)
+			} else {
+				s.Noticef("JetStream asset creation unfrozen for account %q", name)
+			}
+		}
+		if f := acc.jetStreamFreeze(); f != nil {
+			return f, nil
+		}
+		return &JetStreamFreeze{}, nil
+	})
+}
@@ -17,6 +17,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -1427,3 +1428,110 @@ func TestJetStreamLeafNodeJSClusterMigrateRecoveryWithDelay(t *testing.T) {
 	// long election timer. Now this should work reliably.
 	lnc.waitOnStreamLeader(globalAccountName, "TEST")
 }
+
+func TestJetStreamLeafNodeSourceFromRemoteDomain(t *testing.T) {
+	owt := srcConsumerWaitTime
+	srcConsumerWaitTime = time.Second
+	defer func() { srcConsumerWaitTime = owt }()
+
+	tmplH := `
+		listen: 127.0.0.1:%d
+		server_name: HUB
+		jetstream { store_dir: '%s', domain: hub }
+		accounts { JSY { users = [ { user: "y", pass: "p" } ]; jetstream: true } }
+		leaf { listen: 127.0.0.1:%d }
+	`
+	sd := t.TempDir()
+	confH := createConfFile(t, []byte(fmt.Sprintf(tmplH, -1, sd, -1)))
+	sH, oH := RunServerWithConfig(confH)
+	defer sH.Shutdown()
+
+	confL := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		server_name: LEAF
+		jetstream { store_dir: '%s', domain: leaf }
+		accounts { JSY { users = [ { user: "y", pass: "p" } ]; jetstream: true } }
+		leaf { reconnect: "100ms", remotes [ { urls: [ "nats://y:p@127.0.0.1:%d" ], account: "JSY" } ] }
+	`, t.TempDir(), oH.LeafNode.Port)))
+	sL, _ := RunServerWithConfig(confL)
+	defer sL.Shutdown()
+	checkLeafNodeConnectedCount(t, sL, 1)
+
+	ncH, jsH := jsClientConnect(t, sH, nats.UserInfo("y", "p"))
+	defer ncH.Close()
+	_, err := jsH.AddStream(&nats.StreamConfig{Name: "ORIGIN", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	ncL, _ := jsClientConnect(t, sL, nats.UserInfo("y", "p"))
+	defer ncL.Close()
+	addStream(t, ncL, &StreamConfig{
+		Name:    "S",
+		Storage: FileStorage,
+		Sources: []*StreamSource{{
+			Name:     "ORIGIN",
+			External: &ExternalStream{ApiPrefix: "$JS.hub.API", DeliverPrefix: "deliver.hub"},
+		}},
+	})
+
+	sourceInfo := func() (*StreamInfo, error) {
+		var resp JSApiStreamInfoResponse
+		rmsg, err := ncL.Request(fmt.Sprintf(JSApiStreamInfoT, "S"), nil, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(rmsg.Data, &resp); err != nil {
+			return nil, err
+		}
+		if resp.StreamInfo == nil || len(resp.Sources) != 1 {
+			return nil, fmt.Errorf("unexpected response: %+v", resp)
+		}
+		return resp.StreamInfo, nil
+	}
+	checkSourced := func(msgs uint64) {
+		t.Helper()
+		checkFor(t, 30*time.Second, 100*time.Millisecond, func() error {
+			si, err := sourceInfo()
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != msgs || si.Sources[0].Lag != 0 || si.Sources[0].Retries != 0 {
+				return fmt.Errorf("source not caught up: %d msgs, %+v", si.State.Msgs, si.Sources[0])
+			}
+			return nil
+		})
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := jsH.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	checkSourced(10)
+
+	// While the remote domain is unreachable the consumer is retried with a backoff.
+	ncH.Close()
+	sH.Shutdown()
+	checkFor(t, 30*time.Second, 250*time.Millisecond, func() error {
+		si, err := sourceInfo()
+		if err != nil {
+			return err
+		}
+		if si.Sources[0].Retries == 0 {
+			return fmt.Errorf("no retries yet: %+v", si.Sources[0])
+		}
+		return nil
+	})
+
+	// Once reachable again the source catches up on what it missed.
+	confH = createConfFile(t, []byte(fmt.Sprintf(tmplH, oH.Port, sd, oH.LeafNode.Port)))
+	sH, _ = RunServerWithConfig(confH)
+	defer sH.Shutdown()
+	checkLeafNodeConnectedCount(t, sL, 1)
+
+	ncH, jsH = jsClientConnect(t, sH, nats.UserInfo("y", "p"))
+	defer ncH.Close()
+	for i := 0; i < 5; i++ {
+		_, err := jsH.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	checkSourced(15)
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// JetStreamMaintenance is the maintenance mode of JetStream on a server.
+// In maintenance a server does not take on new assets or leaderships,
+// but keeps serving the replicas it already has.
+type JetStreamMaintenance struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// JSMaintenanceReq is the request to put JetStream on a server in or out of maintenance mode.
+// An empty request only reports the current mode.
+type JSMaintenanceReq struct {
+	Enable bool `json:"enable"`
+}
+
+// The maintenance state has its own lock, since raft nodes are
+// started while holding the jetStream lock.
+type jsMaintenance struct {
+	mu    sync.Mutex
+	since time.Time
+	// The raft nodes we made observers, which are reverted when the maintenance is over.
+	nodes map[RaftNode]struct{}
+}
+
+// Returns our maintenance mode, nil if we are not in maintenance.
+func (js *jetStream) maintenance() *JetStreamMaintenance {
+	if js == nil {
+		return nil
+	}
+	js.maint.mu.Lock()
+	defer js.maint.mu.Unlock()
+	if js.maint.since.IsZero() {
+		return nil
+	}
+	return &JetStreamMaintenance{Enabled: true, Since: js.maint.since}
+}
+
+// Will make the raft node an observer if we are in maintenance.
+// Returns true in that case.
+func (js *jetStream) observeForMaintenance(n RaftNode) bool {
+	js.maint.mu.Lock()
+	defer js.maint.mu.Unlock()
+	if js.maint.since.IsZero() || n.IsObserver() {
+		return false
+	}
+	n.SetObserver(true)
+	js.maint.nodes[n] = struct{}{}
+	return true
+}
+
+// JetStreamInMaintenance returns true if JetStream on this server is in maintenance mode.
+func (s *Server) JetStreamInMaintenance() bool {
+	return s.getJetStream().maintenance() != nil
+}
+
+// SetJetStreamMaintenance puts JetStream on this server in or out of maintenance mode.
+// Entering maintenance transfers all our leaderships away.
+func (s *Server) SetJetStreamMaintenance(enable bool) error {
+	js := s.getJetStream()
+	if js == nil {
+		return NewJSNotEnabledError()
+	}
+
+	s.rnMu.RLock()
+	nodes := make([]RaftNode, 0, len(s.raftNodes))
+	for _, n := range s.raftNodes {
+		nodes = append(nodes, n)
+	}
+	s.rnMu.RUnlock()
+
+	js.maint.mu.Lock()
+	if enable == !js.maint.since.IsZero() {
+		js.maint.mu.Unlock()
+		return nil
+	}
+	if enable {
+		js.maint.since = time.Now().UTC()
+		js.maint.nodes = make(map[RaftNode]struct{})
+		// Nodes that are observers already, e.g. because of a leafnode migration, are left alone.
+		for _, n := range nodes {
+			if n.IsObserver() {
+				continue
+			}
+			if n.Leader() {
+				n.StepDown()
+			}
+			n.SetObserver(true)
+			js.maint.nodes[n] = struct{}{}
+		}
+		s.Noticef("JetStream entering maintenance, transferred leadership of %d raft groups", len(js.maint.nodes))
+	} else {
+		for n := range js.maint.nodes {
+			n.SetObserver(false)
+		}
+		js.maint.since, js.maint.nodes = time.Time{}, nil
+		s.Noticef("JetStream leaving maintenance")
+	}
+	js.maint.mu.Unlock()
+
+	// Let the meta leader know right away so it will not place new assets on us.
+	s.wrapChk(s.resetLastStatsz)()
+	s.sendStatszUpdate()
+	return nil
+}
+
+// Returns true if the peer is known to be in maintenance mode.
+func (s *Server) peerInMaintenance(peer string) bool {
+	if ni, ok := s.nodeToInfo.Load(peer); ok && ni != nil {
+		return ni.(nodeInfo).maintenance
+	}
+	return false
+}
+
+// Request to put JetStream on this server in or out of maintenance mode.
+func (s *Server) jsMaintenanceReq(sub *subscription, c *client, _ *Account, subject, reply string, hdr, msg []byte) {
+	if !s.eventsRunning() {
+		return
+	}
+
+	var req *JSMaintenanceReq
+	if len(msg) > 0 {
+		req = &JSMaintenanceReq{}
+		if err := json.Unmarshal(msg, req); err != nil {
+			s.sys.client.Errorf("Error unmarshalling JetStream maintenance request: %v", err)
+			return
+		}
+	}
+
+	optz := &EventFilterOptions{}
+	s.zReq(c, reply, hdr, msg, optz, optz, func() (any, error) {
+		if s.getJetStream() == nil {
+			return nil, NewJSNotEnabledError()
+		}
+		if req != nil {
+			if err := s.SetJetStreamMaintenance(req.Enable); err != nil {
+				return nil, err
+			}
+		}
+		if m := s.getJetStream().maintenance(); m != nil {
+			return m, nil
+		}
+		return &JetStreamMaintenance{}, nil
+	})
+}
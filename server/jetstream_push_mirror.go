@@ -0,0 +1,502 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// StreamPushMirror pushes all messages of a stream to a stream in a separate
+// NATS system. Unlike mirrors and sources, the leafnode connection is initiated
+// by us, so the remote side does not need to be able to reach this server.
+type StreamPushMirror struct {
+	// Name identifies the push mirror in stream info and health reports.
+	Name string `json:"name"`
+	// Remote is the name of the external system, as configured by the operator
+	// in the JetStream remotes of the server.
+	Remote string `json:"remote"`
+	// ApiPrefix is the JetStream API prefix of the remote domain, e.g. $JS.<domain>.API.
+	ApiPrefix string `json:"api"`
+	// Stream is the name of the remote stream. It has to capture the subjects of our messages.
+	Stream string `json:"stream"`
+}
+
+// StreamPushMirrorInfo shows information about a push mirror of a stream.
+type StreamPushMirrorInfo struct {
+	Name     string        `json:"name"`
+	Remote   string        `json:"remote"`
+	Stream   string        `json:"stream"`
+	Lag      uint64        `json:"lag"`
+	Active   time.Duration `json:"active"`
+	Error    *ApiError     `json:"error,omitempty"`
+	Retries  int           `json:"retries,omitempty"`
+	Rejected uint64        `json:"rejected,omitempty"` // Our message the remote stream keeps rejecting.
+}
+
+// JSPushMirrorSource is set on each pushed message with our stream name and sequence.
+// It allows us to resume from the last message the remote stream has stored.
+const JSPushMirrorSource = "Nats-Push-Mirror-Source"
+
+const (
+	// How many published messages can be waiting for their ack.
+	pushMirrorMaxPending = 256
+	// How long we wait for acks and API responses from the remote system.
+	pushMirrorAckWait = 10 * time.Second
+)
+
+// Checks the push mirror configuration is valid for a stream of this account.
+func (pm *StreamPushMirror) validate(s *Server, accName string) error {
+	if pm.Name == _EMPTY_ {
+		return errors.New("name is required")
+	}
+	if !isValidName(pm.Stream) {
+		return fmt.Errorf("invalid remote stream name %q", pm.Stream)
+	}
+	// Our own JetStream API is not forwarded over leafnode connections.
+	if !IsValidPublishSubject(pm.ApiPrefix) || SubjectsCollide(pm.ApiPrefix, JSApiPrefix) {
+		return fmt.Errorf("invalid remote api prefix %q", pm.ApiPrefix)
+	}
+	_, err := s.jsRemote(accName, pm.Remote)
+	return err
+}
+
+// pushMirrorInfo tracks a running push mirror.
+type pushMirrorInfo struct {
+	mset  *stream
+	cfg   StreamPushMirror
+	sig   chan struct{} // Signaled when new messages are stored.
+	qch   chan struct{} // Quit channel.
+	last  atomic.Int64  // Time of last activity from the remote system.
+	sseq  atomic.Uint64 // Our last sequence acknowledged by the remote stream.
+	err   *ApiError     // The error that caused the last connection to fail.
+	fails int           // The number of consecutive failures.
+	rseq  atomic.Uint64 // Our sequence the remote stream rejected, until it stores it.
+}
+
+// pushMirrorReply is a response received on our inbox.
+type pushMirrorReply struct {
+	token string
+	msg   []byte
+}
+
+// pushMirrorConn is a single connection of a push mirror to the remote system.
+type pushMirrorConn struct {
+	pi      *pushMirrorInfo
+	rc      *jsRemoteConn
+	inbox   string
+	replies chan pushMirrorReply
+	done    <-chan struct{}
+}
+
+func (pc *pushMirrorConn) alive() {
+	pc.pi.last.Store(time.Now().UnixNano())
+}
+
+// Called from the connection that delivers replies, so must not block.
+// There is room for all the acks we can wait for, anything else is dropped.
+func (pc *pushMirrorConn) deliver(subject string, msg []byte) {
+	token, ok := strings.CutPrefix(subject, pc.inbox)
+	if !ok {
+		return
+	}
+	pc.alive()
+	select {
+	case pc.replies <- pushMirrorReply{token, msg}:
+	default:
+	}
+}
+
+// Returns the subject of the remote JetStream API for this one of ours.
+func (pc *pushMirrorConn) apiSubject(subject string) string {
+	return strings.Replace(subject, JSApiPrefix, pc.pi.cfg.ApiPrefix, 1)
+}
+
+// Sends an API request to the remote system and waits for the response.
+// Acks for pushed messages are not expected while a request is outstanding.
+func (pc *pushMirrorConn) request(subject string, req []byte, resp any) error {
+	pc.rc.publish(pc.apiSubject(subject), pc.inbox+"api", nil, req)
+	timeout := time.NewTimer(pushMirrorAckWait)
+	defer timeout.Stop()
+	for {
+		select {
+		case r := <-pc.replies:
+			if r.token == "api" {
+				return json.Unmarshal(r.msg, resp)
+			}
+		case <-timeout.C:
+			return fmt.Errorf("timeout waiting for response to %q", subject)
+		case <-pc.done:
+			return nil
+		}
+	}
+}
+
+// Asks the remote stream for its last message to find where we left off.
+// Returns the first of our sequences that still needs to be pushed.
+func (pc *pushMirrorConn) resumeSequence() (uint64, error) {
+	mset, remote := pc.pi.mset, pc.pi.cfg.Stream
+
+	var sir JSApiStreamInfoResponse
+	if err := pc.request(fmt.Sprintf(JSApiStreamInfoT, remote), nil, &sir); err != nil {
+		return 0, err
+	}
+	if sir.Error != nil {
+		return 0, sir.Error
+	}
+	if sir.StreamInfo == nil {
+		return 0, fmt.Errorf("no stream info for remote stream %q", remote)
+	}
+
+	mset.mu.RLock()
+	name := mset.cfg.Name
+	mset.mu.RUnlock()
+	first := mset.state().FirstSeq
+
+	if sir.State.LastSeq == 0 {
+		return first, nil
+	}
+	req, _ := json.Marshal(&JSApiMsgGetRequest{Seq: sir.State.LastSeq})
+	var mgr JSApiMsgGetResponse
+	if err := pc.request(fmt.Sprintf(JSApiMsgGetT, remote), req, &mgr); err != nil {
+		return 0, err
+	}
+	// The last message may have been removed or may not be ours, start over in that case.
+	if mgr.Error != nil || mgr.Message == nil {
+		return first, nil
+	}
+	src := string(getHeader(JSPushMirrorSource, mgr.Message.Header))
+	sname, sseq, ok := strings.Cut(src, " ")
+	if !ok || sname != name {
+		return first, nil
+	}
+	seq, err := strconv.ParseUint(sseq, 10, 64)
+	if err != nil {
+		return first, nil
+	}
+	pc.pi.sseq.Store(seq)
+	return max(seq+1, first), nil
+}
+
+// Publishes our messages to the remote stream, keeping up to pushMirrorMaxPending
+// of them waiting for acks. Returns nil when done is closed.
+func (pc *pushMirrorConn) pushMsgs(next uint64) error {
+	pi, store, sname := pc.pi, pc.pi.mset.store, pc.pi.mset.name()
+
+	var smv StoreMsg
+	var pending int
+	var progress time.Time
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		for pending < pushMirrorMaxPending {
+			sm, _, err := store.LoadNextMsg(fwcs, true, next, &smv)
+			if err == ErrStoreEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			hdr := copyBytes(sm.hdr)
+			for _, key := range []string{JSExpectedStream, JSExpectedLastSeq, JSExpectedLastSubjSeq, JSExpectedLastSubjSeqSubj, JSExpectedLastMsgId, JSPushMirrorSource} {
+				hdr = removeHeaderIfPresent(hdr, key)
+			}
+			hdr = genHeader(hdr, JSExpectedStream, pi.cfg.Stream)
+			hdr = genHeader(hdr, JSPushMirrorSource, fmt.Sprintf("%s %d", sname, sm.seq))
+			pc.rc.publish(sm.subj, pc.inbox+strconv.FormatUint(sm.seq, 10), hdr, sm.msg)
+			if pending == 0 {
+				progress = time.Now()
+			}
+			next = sm.seq + 1
+			pending++
+		}
+
+		select {
+		case r := <-pc.replies:
+			seq, err := strconv.ParseUint(r.token, 10, 64)
+			if err != nil {
+				continue
+			}
+			var resp JSPubAckResponse
+			if err := json.Unmarshal(r.msg, &resp); err != nil {
+				return err
+			}
+			if resp.Error != nil {
+				// Unavailable is temporary, anything else the remote stream will keep rejecting.
+				if resp.Error.Code == http.StatusServiceUnavailable {
+					return resp.Error
+				}
+				return &pushMirrorRejection{seq: seq, err: resp.Error}
+			}
+			if seq > pi.sseq.Load() {
+				pi.sseq.Store(seq)
+			}
+			pi.accepted(seq)
+			pending--
+			progress = time.Now()
+		case <-pi.sig:
+		case <-ticker.C:
+			if !pc.rc.connected() {
+				return fmt.Errorf("remote %q is not connected", pi.cfg.Remote)
+			}
+			if pending > 0 && time.Since(progress) > pushMirrorAckWait {
+				return errors.New("timeout waiting for acks from remote stream")
+			}
+		case <-pc.done:
+			return nil
+		}
+	}
+}
+
+// pushMirrorRejection is returned when the remote stream rejects one of our messages.
+// Pushing it again will fail the same way, until the remote stream is fixed.
+type pushMirrorRejection struct {
+	seq uint64
+	err *ApiError
+}
+
+func (r *pushMirrorRejection) Error() string {
+	return fmt.Sprintf("message %d rejected by remote stream: %v", r.seq, r.err)
+}
+
+// Clears a rejection once the remote stream stored the rejected message, or a later one.
+func (pi *pushMirrorInfo) accepted(seq uint64) {
+	if rseq := pi.rseq.Load(); rseq == 0 || seq < rseq {
+		return
+	}
+	mset := pi.mset
+	mset.mu.Lock()
+	pi.rseq.Store(0)
+	pi.err, pi.fails = nil, 0
+	mset.mu.Unlock()
+}
+
+// Connects to the remote system and pushes messages until done is closed or an error occurs.
+func (pi *pushMirrorInfo) run(done <-chan struct{}) error {
+	mset := pi.mset
+	rc, err := mset.srv.connectJSRemote(mset.accName(), pi.cfg.Remote)
+	if err != nil {
+		return err
+	}
+	defer rc.close()
+
+	pc := &pushMirrorConn{
+		pi:      pi,
+		rc:      rc,
+		inbox:   fmt.Sprintf("_INBOX.%s.", nuid.Next()),
+		replies: make(chan pushMirrorReply, pushMirrorMaxPending+1),
+		done:    done,
+	}
+	err = rc.subscribe(pc.inbox+"*", func(subject, _ string, _, msg []byte) {
+		pc.deliver(subject, msg)
+	})
+	if err != nil {
+		return err
+	}
+	pc.alive()
+
+	next, err := pc.resumeSequence()
+	if err != nil {
+		return err
+	}
+	// We are connected and know where to resume from, so reset our failures.
+	// A rejected message is only resolved once the remote stream stores it.
+	mset.mu.Lock()
+	if pi.rseq.Load() == 0 {
+		pi.err, pi.fails = nil, 0
+	}
+	mset.mu.Unlock()
+
+	return pc.pushMsgs(next)
+}
+
+// Will run as a Go routine and keep the push mirror connected, backing off on failures.
+func (mset *stream) runPushMirror(pi *pushMirrorInfo) {
+	s := mset.srv
+	defer s.grWG.Done()
+
+	mset.mu.RLock()
+	qch, accName, sname := mset.qch, mset.acc.Name, mset.cfg.Name
+	mset.mu.RUnlock()
+
+	// Merge our quit channels so the connection only needs to watch one.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-pi.qch:
+		case <-qch:
+		case <-s.quitCh:
+		}
+		close(done)
+	}()
+
+	for {
+		err := pi.run(done)
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if err == nil {
+			err = errors.New("push mirror connection closed")
+		}
+		s.RateLimitWarnf("JetStream push mirror for '%s > %s' to '%s' failed: %v", accName, sname, pi.cfg.Name, err)
+
+		mset.mu.Lock()
+		pi.fails++
+		if rej, ok := err.(*pushMirrorRejection); ok {
+			pi.rseq.Store(rej.seq)
+			pi.err = NewJSStreamPushMirrorRejectedError(rej.err, rej.seq)
+		} else {
+			pi.err = NewJSStreamPushMirrorFailedError(err)
+		}
+		backoff := calculateRetryBackoff(pi.fails)
+		mset.mu.Unlock()
+
+		select {
+		case <-time.After(backoff + calculateRetryJitter(backoff)):
+		case <-done:
+			return
+		}
+	}
+}
+
+// Start our configured push mirrors that are not already running.
+// Lock should be held.
+func (mset *stream) startPushMirrors() {
+	for _, pm := range mset.cfg.PushMirrors {
+		mset.startPushMirror(pm)
+	}
+}
+
+// Start the push mirror if not already running.
+// Lock should be held.
+func (mset *stream) startPushMirror(pm *StreamPushMirror) {
+	if pi, ok := mset.pushMirrors[pm.Name]; ok {
+		if pi.cfg == *pm {
+			return
+		}
+		// Configuration changed, restart.
+		mset.stopPushMirror(pm.Name)
+	}
+	if mset.pushMirrors == nil {
+		mset.pushMirrors = make(map[string]*pushMirrorInfo)
+	}
+	pi := &pushMirrorInfo{
+		mset: mset,
+		cfg:  *pm,
+		sig:  make(chan struct{}, 1),
+		qch:  make(chan struct{}),
+	}
+	mset.pushMirrors[pm.Name] = pi
+	mset.srv.startGoRoutine(
+		func() { mset.runPushMirror(pi) },
+		pprofLabels{
+			"type":    "push_mirror",
+			"account": mset.acc.Name,
+			"stream":  mset.cfg.Name,
+		},
+	)
+}
+
+// Stop the push mirror with this name.
+// Lock should be held.
+func (mset *stream) stopPushMirror(name string) {
+	if pi := mset.pushMirrors[name]; pi != nil {
+		close(pi.qch)
+		delete(mset.pushMirrors, name)
+	}
+}
+
+// Stop all of our push mirrors.
+// Lock should be held.
+func (mset *stream) stopPushMirrors() {
+	for name := range mset.pushMirrors {
+		mset.stopPushMirror(name)
+	}
+}
+
+// Start push mirrors that were added or changed and stop the ones that were removed.
+// Lock should be held.
+func (mset *stream) updatePushMirrors(pms []*StreamPushMirror) {
+	keep := make(map[string]struct{})
+	for _, pm := range pms {
+		keep[pm.Name] = struct{}{}
+		mset.startPushMirror(pm)
+	}
+	for name := range mset.pushMirrors {
+		if _, ok := keep[name]; !ok {
+			mset.stopPushMirror(name)
+		}
+	}
+}
+
+// Signal our push mirrors that new messages have been stored.
+// Lock should be held.
+func (mset *stream) signalPushMirrors() {
+	for _, pi := range mset.pushMirrors {
+		select {
+		case pi.sig <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Lock should be held.
+func (mset *stream) pushMirrorLag(pi *pushMirrorInfo) uint64 {
+	if sseq := pi.sseq.Load(); mset.lseq > sseq {
+		return mset.lseq - sseq
+	}
+	return 0
+}
+
+// Returns information about our push mirrors.
+func (mset *stream) pushMirrorsInfo() []*StreamPushMirrorInfo {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+
+	var pis []*StreamPushMirrorInfo
+	for _, pm := range mset.cfg.PushMirrors {
+		pi := mset.pushMirrors[pm.Name]
+		if pi == nil {
+			continue
+		}
+		info := &StreamPushMirrorInfo{
+			Name:     pm.Name,
+			Remote:   pm.Remote,
+			Stream:   pm.Stream,
+			Lag:      mset.pushMirrorLag(pi),
+			Error:    pi.err,
+			Retries:  pi.fails,
+			Rejected: pi.rseq.Load(),
+		}
+		if last := pi.last.Load(); last == 0 {
+			info.Active = -1
+		} else {
+			info.Active = time.Since(time.Unix(0, last))
+		}
+		pis = append(pis, info)
+	}
+	return pis
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Streams with quarantine enabled will copy messages they reject to the
+// account's quarantine stream, so producers can inspect what they sent.
+const (
+	// JSQuarantineStream is the name of the per account quarantine stream.
+	JSQuarantineStream = "$QUARANTINE"
+	// JSQuarantinePrefix is the subject prefix rejected messages are published on,
+	// followed by the name of the stream that rejected them.
+	JSQuarantinePrefix = "$JS.QUARANTINE"
+
+	jsQuarantineSubjects = JSQuarantinePrefix + ".>"
+	jsQuarantineSubjectT = JSQuarantinePrefix + ".%s"
+	jsQuarantineMaxBytes = 64 * 1024 * 1024
+	jsQuarantineMaxAge   = 7 * 24 * time.Hour
+)
+
+// Streams with a dead letter stream configured will copy messages they reject
+// to it as well, with the same headers as quarantined messages.
+const (
+	// JSDeadLetterPrefix is the subject prefix rejected messages are published on,
+	// followed by the name of the dead letter stream and the stream that rejected them.
+	JSDeadLetterPrefix = "$JS.DLQ"
+
+	jsDeadLetterSubjectsT = JSDeadLetterPrefix + ".%s.>"
+	jsDeadLetterSubjectT  = JSDeadLetterPrefix + ".%s.%s"
+)
+
+// Headers set on quarantined messages.
+const (
+	JSQuarantineStreamHdr  = "Nats-Quarantine-Stream"
+	JSQuarantineSubjectHdr = "Nats-Quarantine-Subject"
+	JSQuarantineReasonHdr  = "Nats-Quarantine-Reason"
+)
+
+// Returns the configuration of the quarantine stream.
+func quarantineStreamConfig() *StreamConfig {
+	return &StreamConfig{
+		Name:        JSQuarantineStream,
+		Description: "Messages rejected by streams with quarantine enabled",
+		Subjects:    []string{jsQuarantineSubjects},
+		Retention:   LimitsPolicy,
+		MaxMsgs:     -1,
+		MaxBytes:    jsQuarantineMaxBytes,
+		MaxAge:      jsQuarantineMaxAge,
+		MaxMsgsPer:  -1,
+		Discard:     DiscardOld,
+		Storage:     FileStorage,
+		Replicas:    1,
+		// Our subjects live under $JS, and there is nobody to ack anyway.
+		NoAck: true,
+	}
+}
+
+// Returns the configuration a dead letter stream is created with. It has the
+// limits of the quarantine stream, but is kept until removed by the user.
+func deadLetterStreamConfig(name string) *StreamConfig {
+	cfg := quarantineStreamConfig()
+	cfg.Name = name
+	cfg.Description = "Messages rejected by streams with this dead letter stream"
+	cfg.Subjects = []string{fmt.Sprintf(jsDeadLetterSubjectsT, name)}
+	cfg.MaxAge = 0
+	return cfg
+}
+
+// Asks the JetStream API to create the dead letter stream, if it does not exist
+// already. One created by the user should capture the dead letter subjects without
+// acks, as in deadLetterStreamConfig.
+// Lock should be held.
+func (mset *stream) ensureDeadLetterStream(name string) {
+	if mset.outq == nil || name == _EMPTY_ {
+		return
+	}
+	req, _ := json.Marshal(&StreamConfigRequest{StreamConfig: *deadLetterStreamConfig(name)})
+	subj := fmt.Sprintf(JSApiStreamCreateT, name)
+	mset.outq.send(newJSPubMsg(subj, _EMPTY_, _EMPTY_, nil, req, nil, 0))
+}
+
+// Asks the JetStream API to create the quarantine stream for our account.
+// This is a no-op if it exists already, so we can do this each time we become leader.
+// Lock should be held.
+func (mset *stream) ensureQuarantineStream() {
+	if mset.outq == nil || mset.cfg.Name == JSQuarantineStream {
+		return
+	}
+	req, _ := json.Marshal(&StreamConfigRequest{StreamConfig: *quarantineStreamConfig()})
+	subj := fmt.Sprintf(JSApiStreamCreateT, JSQuarantineStream)
+	mset.outq.send(newJSPubMsg(subj, _EMPTY_, _EMPTY_, nil, req, nil, 0))
+}
+
+// Publishes a message we rejected to the quarantine stream and the dead letter
+// stream, if enabled. Only the leader does this, so we do not end up with a copy
+// per replica. Copies that were rejected in turn are not copied again.
+// Lock should not be held.
+func (mset *stream) quarantineMsg(subject string, hdr, msg []byte, reason error) {
+	mset.mu.RLock()
+	quarantine, dlq := mset.cfg.Quarantine, mset.cfg.DeadLetter
+	isLeader, name, outq := mset.isLeader(), mset.cfg.Name, mset.outq
+	mset.mu.RUnlock()
+
+	if (!quarantine && dlq == _EMPTY_) || !isLeader || outq == nil {
+		return
+	}
+	if len(getHeader(JSQuarantineReasonHdr, hdr)) > 0 {
+		return
+	}
+
+	// Drop any headers that would make the quarantine stream reject the message as well.
+	var qhdr []byte
+	if len(hdr) > 0 && len(hdr) < math.MaxUint16/2 {
+		qhdr = removeHeaderIfPrefixPresent(copyBytes(hdr), "Nats-Expected-")
+		qhdr = removeHeaderIfPresent(qhdr, JSMsgId)
+		qhdr = removeHeaderIfPresent(qhdr, JSMsgRollup)
+	}
+	qhdr = genHeader(qhdr, JSQuarantineStreamHdr, name)
+	qhdr = genHeader(qhdr, JSQuarantineSubjectHdr, subject)
+	qhdr = genHeader(qhdr, JSQuarantineReasonHdr, reason.Error())
+
+	if quarantine {
+		outq.send(newJSPubMsg(fmt.Sprintf(jsQuarantineSubjectT, name), _EMPTY_, _EMPTY_, qhdr, copyBytes(msg), nil, 0))
+	}
+	if dlq != _EMPTY_ {
+		outq.send(newJSPubMsg(fmt.Sprintf(jsDeadLetterSubjectT, dlq, name), _EMPTY_, _EMPTY_, copyBytes(qhdr), copyBytes(msg), nil, 0))
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"time"
+)
+
+// JSRaftWAL tunes the write ahead logs of the raft groups of streams and consumers.
+type JSRaftWAL struct {
+	// Compression of the blocks of file based WALs.
+	Compression StoreCompression `json:"compression,omitempty"`
+	// BlockSize of file based WALs.
+	BlockSize uint64 `json:"block_size,omitempty"`
+	// Stream and Consumer are when the groups of that kind snapshot and compact their WAL.
+	Stream   JSRaftWALCompact `json:"stream,omitempty"`
+	Consumer JSRaftWALCompact `json:"consumer,omitempty"`
+}
+
+// JSRaftWALCompact is the size of a WAL from which on it is compacted, zero keeps the default.
+type JSRaftWALCompact struct {
+	Bytes uint64 `json:"compact_bytes,omitempty"`
+	Msgs  uint64 `json:"compact_msgs,omitempty"`
+}
+
+// Returns the WAL size thresholds, or the defaults when not set.
+func (c JSRaftWALCompact) limits(bytes, msgs uint64) (uint64, uint64) {
+	if c.Bytes > 0 {
+		bytes = c.Bytes
+	}
+	if c.Msgs > 0 {
+		msgs = c.Msgs
+	}
+	return bytes, msgs
+}
+
+// How long the leader waits for its own compaction before it responds.
+const compactWALTimeout = 10 * time.Second
+
+// Asks the monitor routine of the group to snapshot and compact the WAL. The returned
+// channel is closed when done, it is nil if there is no WAL or a compaction is pending.
+func requestCompactWAL(wcch chan chan struct{}) chan struct{} {
+	if wcch == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	select {
+	case wcch <- done:
+		return done
+	default:
+		return nil
+	}
+}
+
+// Returns the channel the monitor routine receives compaction requests on.
+func (mset *stream) compactWALC() chan chan struct{} {
+	if mset == nil {
+		return nil
+	}
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	return mset.wcch
+}
+
+// Returns the channel the monitor routine receives compaction requests on.
+func (o *consumer) compactWALC() chan chan struct{} {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.wcch
+}
+
+// Waits for the compaction of our WAL and responds with its size after.
+func (s *Server) sendCompactWALResponse(done chan struct{}, n RaftNode, resp *JSApiCompactWALResponse, ci *ClientInfo, acc *Account, subject, reply, msg string) {
+	select {
+	case <-done:
+	case <-time.After(compactWALTimeout):
+		resp.Error = NewJSRaftWALCompactError(errors.New("timeout"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
+		return
+	case <-s.quitCh:
+		return
+	}
+	resp.Entries, resp.Bytes = n.Size()
+	s.sendAPIResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
+}
+
+// Request to have all replicas of a stream snapshot and compact their raft WAL, e.g. when it grew abnormally large.
+func (s *Server) jsStreamCompactWALRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiCompactWALResponse{ApiResponse: ApiResponse{Type: JSApiStreamCompactWALResponseType}}
+
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+	js.mu.RUnlock()
+
+	if isLeader && sa == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if sa == nil {
+		return
+	}
+	if !isEmptyRequest(msg) {
+		if isLeader {
+			resp.Error = NewJSBadRequestError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	// Every replica compacts its own WAL, the leader responds.
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return
+	}
+	n := mset.raftNode()
+	if n == nil {
+		if mset.IsLeader() {
+			resp.Error = NewJSRaftWALCompactError(errors.New("stream is not replicated"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	done := requestCompactWAL(mset.compactWALC())
+	if !n.Leader() {
+		return
+	}
+	if done == nil {
+		resp.Error = NewJSRaftWALCompactError(errors.New("compaction already pending"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	go s.sendCompactWALResponse(done, n, &resp, ci, acc, subject, reply, string(msg))
+}
+
+// Request to have all replicas of a consumer snapshot and compact their raft WAL, e.g. when it grew abnormally large.
+func (s *Server) jsConsumerCompactWALRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiCompactWALResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCompactWALResponseType}}
+
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	stream, consumer := tokenAt(subject, 6), tokenAt(subject, 7)
+
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+	var ca *consumerAssignment
+	if sa != nil && sa.consumers != nil {
+		ca = sa.consumers[consumer]
+	}
+	js.mu.RUnlock()
+
+	if isLeader && sa == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if isLeader && ca == nil {
+		resp.Error = NewJSConsumerNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if ca == nil {
+		return
+	}
+	if !isEmptyRequest(msg) {
+		if isLeader {
+			resp.Error = NewJSBadRequestError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	// Every replica compacts its own WAL, the leader responds.
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return
+	}
+	o := mset.lookupConsumer(consumer)
+	if o == nil {
+		return
+	}
+	n := o.raftNode()
+	if n == nil {
+		if o.isLeader() {
+			resp.Error = NewJSRaftWALCompactError(errors.New("consumer is not replicated"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	done := requestCompactWAL(o.compactWALC())
+	if !n.Leader() {
+		return
+	}
+	if done == nil {
+		resp.Error = NewJSRaftWALCompactError(errors.New("compaction already pending"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	go s.sendCompactWALResponse(done, n, &resp, ci, acc, subject, reply, string(msg))
+}
@@ -0,0 +1,444 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// StreamReadReplicas places read only copies of a stream on servers outside of its group.
+// Read replicas do not take part in the stream's raft group, so heavy reads against them can
+// not impact the latency of the group. They are fed from the stream leader with the same
+// catchup mechanism group members use, and serve direct gets and local consumers.
+// Read replicas only take effect in clustered mode.
+type StreamReadReplicas struct {
+	// Replicas is the number of read replicas.
+	Replicas int `json:"num_replicas"`
+	// Tags designate the servers that can hold read replicas.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// How often read replicas ask the stream leader for new messages.
+var readReplicaSyncInterval = time.Second
+
+// readReplicaState is exchanged with the stream leader so read replicas learn about
+// the messages removed from the stream, e.g. by deletes, purges, limits or truncates.
+type readReplicaState struct {
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	// Msgs is the number of messages the read replica has.
+	Msgs uint64 `json:"msgs,omitempty"`
+	// Deleted are the ranges of messages the stream removed from those of the read replica.
+	Deleted []DeleteRange `json:"deleted,omitempty"`
+}
+
+func (rr *StreamReadReplicas) validate(cfg *StreamConfig) error {
+	if rr.Replicas < 1 {
+		return errors.New("number of read replicas must be at least 1")
+	}
+	// Read replicas only follow the stream's messages, acks are not replicated to them.
+	if cfg.Retention != LimitsPolicy {
+		return errors.New("read replicas require limits based retention")
+	}
+	for _, tag := range rr.Tags {
+		if tag == _EMPTY_ {
+			return errors.New("tags can not be empty")
+		}
+	}
+	return nil
+}
+
+// selectReadReplicas selects the servers for the read replicas of a stream.
+// These are never members of the group, and existing read replicas are kept where possible.
+// Lock should be held.
+func (cc *jetStreamCluster) selectReadReplicas(cfg *StreamConfig, rg *raftGroup) ([]string, *selectPeerError) {
+	rr := cfg.ReadReplicas
+	if rr == nil {
+		return nil, nil
+	}
+
+	var existing []string
+	for _, peer := range rg.Readers {
+		if rg.isMember(peer) {
+			continue
+		}
+		// Only keep the ones that still match our tags.
+		if si, ok := cc.s.nodeToInfo.Load(peer); ok && si != nil {
+			ni, matched := si.(nodeInfo), true
+			for _, tag := range rr.Tags {
+				if !ni.tags.Contains(tag) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				existing = append(existing, peer)
+			}
+		}
+	}
+
+	rcfg := *cfg
+	rcfg.Placement = &Placement{Cluster: rg.Cluster, Tags: rr.Tags}
+	return cc.selectPeerGroup(rr.Replicas, rg.Cluster, &rcfg, existing, 0, rg.Peers)
+}
+
+// processReadReplica creates or updates the read replica of a stream on this server.
+func (js *jetStream) processReadReplica(acc *Account, sa *streamAssignment) {
+	js.mu.RLock()
+	s, cfg := js.srv, sa.Config
+	var ourID string
+	if cc := js.cluster; cc != nil && cc.meta != nil {
+		ourID = cc.meta.ID()
+	}
+	js.mu.RUnlock()
+
+	mset, err := acc.lookupStream(cfg.Name)
+	if err == nil && mset != nil && mset.isClustered() {
+		// We were a member of the group, so step away from it first.
+		s.removeStream(ourID, mset, sa)
+		mset = nil
+	}
+
+	if mset != nil {
+		mset.setStreamAssignment(sa)
+		if ocfg := mset.config(); !reflect.DeepEqual(&ocfg, cfg) {
+			if err = mset.updateWithAdvisory(cfg, false, false); err != nil {
+				s.Warnf("JetStream error updating read replica for stream '%s > %s': %v", acc.Name, cfg.Name, err)
+			}
+		}
+	} else if mset, err = acc.addStreamWithAssignment(cfg, nil, sa, false); err != nil {
+		s.Warnf("JetStream error creating read replica for stream '%s > %s': %v", acc.Name, cfg.Name, err)
+		return
+	}
+	mset.setCreatedTime(sa.Created)
+
+	if err = mset.startReadReplica(); err != nil {
+		s.Warnf("JetStream error starting read replica for stream '%s > %s': %v", acc.Name, cfg.Name, err)
+	}
+}
+
+// removeReadReplica removes the read replica of a stream from this server, if we have one.
+// This is done when we become a member of the group instead.
+func (s *Server) removeReadReplica(acc *Account, name string) {
+	mset, _ := acc.lookupStream(name)
+	if mset == nil {
+		return
+	}
+	mset.mu.RLock()
+	isReader := mset.readReplica
+	mset.mu.RUnlock()
+	if isReader {
+		s.Debugf("JetStream removing read replica for stream '%s > %s' from this server", acc.Name, name)
+		mset.stop(true, false)
+	}
+}
+
+// startReadReplica starts serving reads and syncing from the stream leader.
+// This is a no-op if we are already running.
+func (mset *stream) startReadReplica() error {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if !mset.readReplica || mset.rrRunning || mset.closed.Load() {
+		return nil
+	}
+
+	name := mset.cfg.Name
+	if _, err := mset.queueSubscribeInternal(fmt.Sprintf(JSReadReplicaMsgGetT, name), dgetGroup, mset.processDirectGetRequest); err != nil {
+		return err
+	}
+	if _, err := mset.queueSubscribeInternal(fmt.Sprintf(JSReadReplicaGetLastBySubjectT, name, fwcs), dgetGroup, mset.processDirectGetLastBySubjectRequest); err != nil {
+		return err
+	}
+	if _, err := mset.queueSubscribeInternal(fmt.Sprintf(JSReadReplicaConsumerCreateT, name), dgetGroup, mset.processReadReplicaConsumerCreate); err != nil {
+		return err
+	}
+
+	mset.rrRunning = true
+	mset.srv.startGoRoutine(mset.runReadReplica, pprofLabels{
+		"type":    "read_replica",
+		"account": mset.acc.Name,
+		"stream":  name,
+	})
+	return nil
+}
+
+// runReadReplica keeps us in sync with the stream leader by asking
+// for anything past our last sequence on each interval.
+func (mset *stream) runReadReplica() {
+	s := mset.srv
+	defer s.grWG.Done()
+
+	mset.mu.RLock()
+	qch := mset.qch
+	mset.mu.RUnlock()
+	if qch == nil {
+		return
+	}
+
+	t := time.NewTicker(readReplicaSyncInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.quitCh:
+			return
+		case <-qch:
+			return
+		case <-t.C:
+			if err := mset.syncReadReplica(qch); err != nil && err != errCatchupStreamStopped && err != ErrServerNotRunning {
+				s.RateLimitWarnf("Read replica sync for stream '%s > %s' failed: %v", mset.account(), mset.name(), err)
+			}
+		}
+	}
+}
+
+// syncReadReplica sends a single sync request to the stream leader and stores
+// everything it sends back until it signals we are caught up.
+func (mset *stream) syncReadReplica(qch chan struct{}) error {
+	mset.mu.RLock()
+	s, sa := mset.srv, mset.sa
+	qname := fmt.Sprintf("[ACC:%s] stream '%s' read replica", mset.acc.Name, mset.cfg.Name)
+	mset.mu.RUnlock()
+
+	if sa == nil || sa.Sync == _EMPTY_ {
+		return nil
+	}
+
+	// Used to transfer message from the wire to another Go routine internally.
+	type im struct {
+		msg   []byte
+		reply string
+	}
+	msgsQ := newIPQueue[*im](s, qname,
+		ipqSizeCalculation(func(mrec *im) uint64 { return uint64(len(mrec.msg) + len(mrec.reply)) }),
+		ipqLimits[*im](s.getOpts().JetStreamQueueLimits.Catchup),
+	)
+	defer msgsQ.unregister()
+
+	reply := syncReplySubject()
+	sub, err := s.sysSubscribe(reply, func(_ *subscription, _ *client, _ *Account, _, reply string, msg []byte) {
+		// Make copy since we are using a buffer from the inbound client/route.
+		msgsQ.push(&im{copyBytes(msg), reply})
+	})
+	if err != nil {
+		return err
+	}
+	defer s.sysUnsubscribe(sub)
+
+	const (
+		startInterval    = 5 * time.Second
+		activityInterval = 30 * time.Second
+	)
+	notActive := time.NewTimer(startInterval)
+	defer notActive.Stop()
+
+	// Make sure our consumers know about anything we stored or removed.
+	var stored bool
+	defer func() {
+		if stored {
+			mset.signalReadReplicaConsumers()
+		}
+	}()
+
+	// First remove what the stream removed from the messages we already have.
+	var state StreamState
+	mset.store.FastState(&state)
+	b, _ := json.Marshal(&streamSyncRequest{
+		ReadReplica: true,
+		State:       &readReplicaState{FirstSeq: state.FirstSeq, LastSeq: state.LastSeq, Msgs: state.Msgs},
+	})
+	s.sendInternalMsgLocked(sa.Sync, reply, nil, b)
+	select {
+	case <-msgsQ.ch:
+		mrecs := msgsQ.pop()
+		var ls readReplicaState
+		err := json.Unmarshal(mrecs[0].msg, &ls)
+		msgsQ.recycle(&mrecs)
+		if err != nil {
+			return err
+		}
+		if stored, err = mset.applyReadReplicaState(&ls); err != nil {
+			return err
+		}
+	case <-notActive.C:
+		return errCatchupStalled
+	case <-s.quitCh:
+		return ErrServerNotRunning
+	case <-qch:
+		return errCatchupStreamStopped
+	}
+
+	mset.mu.RLock()
+	lseq := mset.lseq
+	mset.mu.RUnlock()
+	b, _ = json.Marshal(&streamSyncRequest{FirstSeq: lseq + 1, DeleteRangesOk: true, ReadReplica: true})
+	s.sendInternalMsgLocked(sa.Sync, reply, nil, b)
+	notActive.Reset(startInterval)
+
+	for {
+		select {
+		case <-msgsQ.ch:
+			mrecs := msgsQ.pop()
+			for _, mrec := range mrecs {
+				// Check for eof signaling.
+				if len(mrec.msg) == 0 {
+					msgsQ.recycle(&mrecs)
+					return nil
+				}
+				if _, err := mset.processCatchupMsg(mrec.msg); err != nil {
+					// Let the leader know to stop sending.
+					if mrec.reply != _EMPTY_ {
+						s.sendInternalMsgLocked(mrec.reply, _EMPTY_, nil, err.Error())
+					}
+					msgsQ.recycle(&mrecs)
+					return err
+				}
+				stored = true
+				if mrec.reply != _EMPTY_ {
+					s.sendInternalMsgLocked(mrec.reply, _EMPTY_, nil, nil)
+				}
+			}
+			msgsQ.recycle(&mrecs)
+			if stored {
+				mset.signalReadReplicaConsumers()
+			}
+			notActive.Reset(activityInterval)
+		case <-notActive.C:
+			return errCatchupStalled
+		case <-s.quitCh:
+			return ErrServerNotRunning
+		case <-qch:
+			return errCatchupStreamStopped
+		}
+	}
+}
+
+// readReplicaStateFor returns our state for a read replica, along with the ranges of
+// the messages it has that we removed.
+func (mset *stream) readReplicaStateFor(rs *readReplicaState) *readReplicaState {
+	var state StreamState
+	mset.store.FastState(&state)
+	ls := &readReplicaState{FirstSeq: state.FirstSeq, LastSeq: state.LastSeq}
+
+	// Messages before our first or past our last sequence are removed by the read replica
+	// on its own, so only look at what it has in between.
+	first, last := max(rs.FirstSeq, state.FirstSeq), min(rs.LastSeq, state.LastSeq)
+	if rs.Msgs == 0 || first > last {
+		return ls
+	}
+	// Nothing to look for if we have as many messages as the read replica.
+	total, _ := mset.store.NumPending(first, fwcs, false)
+	if last < state.LastSeq {
+		past, _ := mset.store.NumPending(last+1, fwcs, false)
+		total -= past
+	}
+	if total >= rs.Msgs {
+		return ls
+	}
+	state = mset.store.State()
+	for _, seq := range state.Deleted {
+		if seq < first || seq > last {
+			continue
+		}
+		if n := len(ls.Deleted); n > 0 && ls.Deleted[n-1].First+ls.Deleted[n-1].Num == seq {
+			ls.Deleted[n-1].Num++
+		} else {
+			ls.Deleted = append(ls.Deleted, DeleteRange{First: seq, Num: 1})
+		}
+	}
+	return ls
+}
+
+// applyReadReplicaState removes the messages the stream removed, given its state.
+// Returns true if any messages were removed.
+func (mset *stream) applyReadReplicaState(ls *readReplicaState) (bool, error) {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	store := mset.store
+	var state StreamState
+	store.FastState(&state)
+	msgs := state.Msgs
+
+	// The stream was truncated.
+	if ls.LastSeq < state.LastSeq {
+		if err := store.Truncate(ls.LastSeq); err != nil {
+			return false, err
+		}
+	}
+	// The stream was purged, or messages expired or hit its limits.
+	if ls.FirstSeq > state.FirstSeq {
+		if _, err := store.Compact(ls.FirstSeq); err != nil {
+			return false, err
+		}
+	}
+	for _, dr := range ls.Deleted {
+		for seq := dr.First; seq < dr.First+dr.Num; seq++ {
+			if _, err := store.RemoveMsg(seq); err != nil && err != ErrStoreMsgNotFound && err != ErrStoreEOF {
+				return false, err
+			}
+		}
+	}
+
+	store.FastState(&state)
+	mset.lseq = state.LastSeq
+	return state.Msgs < msgs, nil
+}
+
+// signalReadReplicaConsumers wakes up our local consumers after new messages were synced.
+func (mset *stream) signalReadReplicaConsumers() {
+	for _, o := range mset.getConsumers() {
+		o.mu.Lock()
+		if o.mset != nil {
+			o.streamNumPending()
+			o.signalNewMessages()
+		}
+		o.mu.Unlock()
+	}
+}
+
+// processReadReplicaConsumerCreate creates a consumer local to this read replica.
+// These are always direct consumers, so they are ephemeral push consumers that are not replicated.
+func (mset *stream) processReadReplicaConsumerCreate(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if len(reply) == 0 {
+		return
+	}
+	_, msg := c.msgParts(rmsg)
+
+	mset.mu.RLock()
+	s, name := mset.srv, mset.cfg.Name
+	mset.mu.RUnlock()
+
+	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
+	var req CreateConsumerRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+	} else if req.Stream != _EMPTY_ && req.Stream != name {
+		resp.Error = NewJSStreamMismatchError()
+	} else {
+		cfg := req.Config
+		cfg.Direct = true
+		if o, err := mset.addConsumerWithAction(&cfg, ActionCreate, req.Pedantic); err != nil {
+			resp.Error = NewJSConsumerCreateError(err, Unless(err))
+		} else {
+			resp.ConsumerInfo = setDynamicConsumerInfoMetadata(o.initialInfo())
+		}
+	}
+	mset.outq.sendMsg(reply, []byte(s.jsonResponse(&resp)))
+}
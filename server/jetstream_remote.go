@@ -0,0 +1,114 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Returns the options of the remote with this name, if streams of the account may use it.
+// Remotes are configured by the operator, so streams can only reach the external
+// systems the operator connected this server to with a leafnode remote.
+func (s *Server) jsRemote(accName, name string) (*JSRemoteOpts, error) {
+	r := s.getOpts().JetStreamRemotes[name]
+	if r == nil {
+		return nil, fmt.Errorf("remote %q is not configured", name)
+	}
+	if !slices.Contains(r.Accounts, accName) {
+		return nil, fmt.Errorf("account %q is not allowed to use remote %q", accName, name)
+	}
+	return r, nil
+}
+
+// jsRemoteConn subscribes and publishes on behalf of a stream in the account of
+// a remote, which the leafnode remote connects to the external system.
+type jsRemoteConn struct {
+	mu  sync.Mutex
+	c   *client
+	acc *Account
+	sid uint64
+}
+
+// Connects a stream of this account to the remote. Fails if the remote can not be
+// used by the account or none of its leafnode connections are up.
+func (s *Server) connectJSRemote(accName, name string) (*jsRemoteConn, error) {
+	r, err := s.jsRemote(accName, name)
+	if err != nil {
+		return nil, err
+	}
+	acc, err := s.LookupAccount(r.Account)
+	if err != nil {
+		return nil, err
+	}
+	if acc.NumLeafNodes() == 0 {
+		return nil, fmt.Errorf("remote %q is not connected", name)
+	}
+	c := s.createInternalJetStreamClient()
+	c.registerWithAccount(acc)
+	return &jsRemoteConn{c: c, acc: acc}, nil
+}
+
+// Returns true while a leafnode connection to the external system is up.
+func (rc *jsRemoteConn) connected() bool {
+	return rc.acc.NumLeafNodes() > 0
+}
+
+// Subscribes to messages from the external system. The callback owns the buffers.
+// Our interest is propagated to the external system by the leafnode connection.
+func (rc *jsRemoteConn) subscribe(subject string, cb func(subject, reply string, hdr, msg []byte)) error {
+	rc.mu.Lock()
+	rc.sid++
+	sid := strconv.FormatUint(rc.sid, 10)
+	rc.mu.Unlock()
+
+	_, err := rc.c.processSub([]byte(subject), nil, []byte(sid), func(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+		hdr, msg := c.msgParts(rmsg)
+		cb(subject, reply, copyBytes(hdr), copyBytes(msg))
+	}, false)
+	return err
+}
+
+// Publishes a message, which is delivered to the external system over the leafnode connection.
+func (rc *jsRemoteConn) publish(subject, reply string, hdr, msg []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	c := rc.c
+	c.pa.subject = []byte(subject)
+	c.pa.reply = nil
+	if reply != _EMPTY_ {
+		c.pa.reply = []byte(reply)
+	}
+	c.pa.size = len(hdr) + len(msg)
+	c.pa.szb = []byte(strconv.Itoa(c.pa.size))
+	if len(hdr) > 0 {
+		c.pa.hdr = len(hdr)
+		c.pa.hdb = []byte(strconv.Itoa(c.pa.hdr))
+	} else {
+		c.pa.hdr, c.pa.hdb = -1, nil
+	}
+	buf := make([]byte, 0, len(hdr)+len(msg)+LEN_CR_LF)
+	buf = append(append(append(buf, hdr...), msg...), _CRLF_...)
+	c.processInboundClientMsg(buf)
+	c.pa.szb, c.pa.subject, c.pa.reply = nil, nil, nil
+	c.flushClients(0)
+}
+
+// Closes the connection, which removes its subscriptions.
+func (rc *jsRemoteConn) close() {
+	rc.c.closeConnection(ClientClosed)
+}
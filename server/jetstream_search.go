@@ -0,0 +1,243 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// JSMaxSearchBytes is the most bytes a single search will scan.
+	JSMaxSearchBytes = 64 * 1024 * 1024
+	// JSMaxSearchMatches is the most matches a single search will return.
+	JSMaxSearchMatches = 1024
+)
+
+// Checks the request and applies the server limits.
+func (req *JSApiStreamSearchRequest) validate() error {
+	if req.Headers == nil && req.Contains == _EMPTY_ {
+		return errors.New("headers or contains is required")
+	}
+	if req.StartSeq > 0 && req.StartTime != nil {
+		return errors.New("start sequence and start time are mutually exclusive")
+	}
+	if req.EndSeq > 0 && req.EndTime != nil {
+		return errors.New("end sequence and end time are mutually exclusive")
+	}
+	if req.EndSeq > 0 && req.EndSeq < req.StartSeq {
+		return errors.New("end sequence is before start sequence")
+	}
+	if req.Subject != _EMPTY_ && !IsValidSubject(req.Subject) {
+		return errors.New("invalid subject")
+	}
+	for k := range req.Headers {
+		if k == _EMPTY_ {
+			return errors.New("header names can not be empty")
+		}
+	}
+	if req.MaxBytes < 0 || req.MaxMatches < 0 {
+		return errors.New("limits can not be negative")
+	}
+	if req.MaxBytes == 0 || req.MaxBytes > JSMaxSearchBytes {
+		req.MaxBytes = JSMaxSearchBytes
+	}
+	if req.MaxMatches == 0 || req.MaxMatches > JSMaxSearchMatches {
+		req.MaxMatches = JSMaxSearchMatches
+	}
+	return nil
+}
+
+// Returns true if the message matches the criteria of the search.
+func (req *JSApiStreamSearchRequest) matches(sm *StoreMsg) bool {
+	for k, v := range req.Headers {
+		if hv := getHeader(k, sm.hdr); hv == nil || string(hv) != v {
+			return false
+		}
+	}
+	return req.Contains == _EMPTY_ || bytes.Contains(sm.msg, []byte(req.Contains))
+}
+
+// search scans the window of the stream in the request for matching messages.
+// The request has to be validated.
+func (mset *stream) search(req *JSApiStreamSearchRequest) (*JSApiStreamSearchResponse, error) {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+	if store == nil {
+		return nil, ErrStoreClosed
+	}
+
+	var state StreamState
+	store.FastState(&state)
+
+	seq, end := req.StartSeq, req.EndSeq
+	if req.StartTime != nil {
+		seq = store.GetSeqFromTime(req.StartTime.UTC())
+	}
+	if seq < state.FirstSeq {
+		seq = state.FirstSeq
+	}
+	if end == 0 || end > state.LastSeq {
+		end = state.LastSeq
+	}
+	var endTs int64
+	if req.EndTime != nil {
+		endTs = req.EndTime.UnixNano()
+	}
+
+	filter, wc := req.Subject, subjectHasWildcard(req.Subject)
+	if filter == _EMPTY_ {
+		filter, wc = fwcs, true
+	}
+
+	resp := &JSApiStreamSearchResponse{}
+	var smv StoreMsg
+	for seq <= end {
+		sm, nseq, err := store.LoadNextMsg(filter, wc, seq, &smv)
+		if err == ErrStoreEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if nseq > end || (endTs > 0 && sm.ts > endTs) {
+			break
+		}
+		// Always scan at least one message, so every search makes progress.
+		size := uint64(len(sm.hdr) + len(sm.msg))
+		if resp.Scanned > 0 && resp.ScannedBytes+size > uint64(req.MaxBytes) {
+			resp.NextSeq = nseq
+			break
+		}
+		resp.Scanned++
+		resp.ScannedBytes += size
+		seq = nseq + 1
+
+		if req.matches(sm) {
+			resp.Matches = append(resp.Matches, StreamSearchMatch{
+				Sequence: nseq,
+				Subject:  sm.subj,
+				Time:     time.Unix(0, sm.ts).UTC(),
+			})
+			if len(resp.Matches) >= req.MaxMatches {
+				if seq <= end {
+					resp.NextSeq = seq
+				}
+				break
+			}
+		}
+	}
+	return resp, nil
+}
+
+// Request to search a window of a stream for messages with matching headers or payloads.
+func (s *Server) jsStreamSearchRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamSearchResponse{ApiResponse: ApiResponse{Type: JSApiStreamSearchResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamSearchRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if err := req.validate(); err != nil {
+		resp.Error = NewJSStreamSearchInvalidError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	sr, err := mset.search(&req)
+	if err != nil {
+		resp.Error = NewJSStreamGeneralError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	sr.ApiResponse = resp.ApiResponse
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(sr))
+}
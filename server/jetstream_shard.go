@@ -0,0 +1,571 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// StreamSharding makes a stream one of the shards of a sharded stream.
+// A sharded stream is one logical stream backed by a number of physical streams,
+// each storing the messages of its subjects for which the hash of one token
+// selects the shard. This allows for more throughput than a single stream.
+// All shards have the same subjects and use the same hash as the partition
+// subject mapping function.
+type StreamSharding struct {
+	// Stream is the name of the sharded stream.
+	Stream string `json:"stream"`
+	// Shards is the number of shards.
+	Shards int `json:"shards"`
+	// Token is the position, starting at 1, of the subject token that selects the shard.
+	Token int `json:"token"`
+	// Shard is the index of this shard.
+	Shard int `json:"shard"`
+}
+
+const (
+	// Maximum number of shards of a sharded stream.
+	maxStreamShards = 64
+	// Shards are named after the sharded stream and their index.
+	shardStreamNameT = "%s-shard-%d"
+	// Replies to requests sent to the shards.
+	jsShardReplyT = "$JS.SHARD.%s"
+	// Consumers are created on the shards with their name in the subject.
+	jsShardConsumerCreateT = "$JS.API.CONSUMER.CREATE.%s.%s"
+	// How long we wait for all shards to respond.
+	jsShardRequestTimeout = 5 * time.Second
+)
+
+var errShardRequestTimeout = errors.New("timeout waiting for shards to respond")
+
+// Returns the name of a shard of a sharded stream.
+func shardStreamName(stream string, shard int) string {
+	return fmt.Sprintf(shardStreamNameT, stream, shard)
+}
+
+func (sh *StreamSharding) validate(cfg *StreamConfig) error {
+	if !isValidName(sh.Stream) {
+		return errors.New("sharded stream name is required and can not contain '.', '*', '>'")
+	}
+	if sh.Shards < 2 || sh.Shards > maxStreamShards {
+		return fmt.Errorf("number of shards must be between 2 and %d", maxStreamShards)
+	}
+	if sh.Shard < 0 || sh.Shard >= sh.Shards {
+		return errors.New("shard index out of range")
+	}
+	if cfg.Name != shardStreamName(sh.Stream, sh.Shard) {
+		return fmt.Errorf("shard stream name must be %q", shardStreamName(sh.Stream, sh.Shard))
+	}
+	if sh.Token < 1 || sh.Token > math.MaxUint8 {
+		return fmt.Errorf("token position must be between 1 and %d", math.MaxUint8)
+	}
+	if len(cfg.Subjects) == 0 {
+		return errors.New("subjects are required")
+	}
+	for _, subj := range cfg.Subjects {
+		if numTokens(subj) < sh.Token {
+			return fmt.Errorf("subject %q does not have a token at position %d", subj, sh.Token)
+		}
+	}
+	if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+		return errors.New("shards can not be a mirror or have sources")
+	}
+	return nil
+}
+
+// Returns true if both are shards of the same sharded stream, which share their subjects.
+func (sh *StreamSharding) isSibling(osh *StreamSharding) bool {
+	return sh != nil && osh != nil && sh.Stream == osh.Stream &&
+		sh.Shards == osh.Shards && sh.Token == osh.Token && sh.Shard != osh.Shard
+}
+
+// Returns true if messages on this subject are stored by this shard.
+func (sh *StreamSharding) owns(subject string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(tokenAt(subject, uint8(sh.Token))))
+	return int(h.Sum32()%uint32(sh.Shards)) == sh.Shard
+}
+
+// Returns the sharding of a sharded stream as found on its shards, if any.
+func (s *Server) jsStreamSharding(acc *Account, stream string) *StreamSharding {
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return nil
+		}
+		js.mu.RLock()
+		defer js.mu.RUnlock()
+		for _, sa := range cc.streams[acc.Name] {
+			if sh := sa.Config.Sharding; sh != nil && sh.Stream == stream {
+				shc := *sh
+				return &shc
+			}
+		}
+		return nil
+	}
+	for _, mset := range acc.streams() {
+		if sh := mset.shard; sh != nil && sh.Stream == stream {
+			return sh
+		}
+	}
+	return nil
+}
+
+// Sends JetStream API requests into the account, one per shard,
+// and returns the responses in shard order.
+func (s *Server) jsShardRequests(acc *Account, subjects []string, reqs [][]byte) ([][]byte, error) {
+	reply := fmt.Sprintf(jsShardReplyT, nuid.Next())
+	resps := make([][]byte, len(subjects))
+	done := make(chan struct{})
+
+	var mu sync.Mutex
+	var n int
+	sub, err := acc.subscribeInternal(reply+".*", func(_ *subscription, c *client, _ *Account, subject, _ string, rmsg []byte) {
+		_, msg := c.msgParts(rmsg)
+		i, err := strconv.Atoi(subject[len(reply)+1:])
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil || i < 0 || i >= len(resps) || resps[i] != nil {
+			return
+		}
+		resps[i] = copyBytes(msg)
+		if n++; n == len(resps) {
+			close(done)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer acc.unsubscribeInternal(sub)
+
+	for i, subj := range subjects {
+		if err := s.sendInternalAccountMsgWithReply(acc, subj, fmt.Sprintf("%s.%d", reply, i), nil, reqs[i], false); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := time.NewTimer(jsShardRequestTimeout)
+	defer timeout.Stop()
+	select {
+	case <-done:
+		return resps, nil
+	case <-timeout.C:
+		return nil, errShardRequestTimeout
+	case <-s.quitCh:
+		return nil, ErrServerNotRunning
+	}
+}
+
+// Sends the same request to all shards and decodes the responses, which have to embed an ApiResponse.
+// Returns the first error reported by a shard.
+func jsShardResponses[T any](s *Server, acc *Account, sh *StreamSharding, subjectT string, req []byte, apiResp func(*T) *ApiResponse) ([]*T, *ApiError) {
+	subjects := make([]string, sh.Shards)
+	reqs := make([][]byte, sh.Shards)
+	for i := range subjects {
+		subjects[i], reqs[i] = fmt.Sprintf(subjectT, shardStreamName(sh.Stream, i)), req
+	}
+	return jsShardResponsesEx(s, acc, subjects, reqs, apiResp)
+}
+
+// Like jsShardResponses, but with a subject and request per shard.
+func jsShardResponsesEx[T any](s *Server, acc *Account, subjects []string, reqs [][]byte, apiResp func(*T) *ApiResponse) ([]*T, *ApiError) {
+	msgs, err := s.jsShardRequests(acc, subjects, reqs)
+	if err != nil {
+		return nil, NewJSStreamGeneralError(err, Unless(err))
+	}
+	resps := make([]*T, len(msgs))
+	for i, msg := range msgs {
+		var resp T
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			return nil, NewJSStreamGeneralError(err, Unless(err))
+		}
+		if ar := apiResp(&resp); ar.Error != nil {
+			return nil, ar.Error
+		}
+		resps[i] = &resp
+	}
+	return resps, nil
+}
+
+// Returns true if we should answer a sharded stream request.
+// In clustered mode these are answered by the meta leader.
+func (s *Server) jsShardedRequestCheck(ci *ClientInfo, acc *Account, subject, reply, msg string, resp *ApiResponse, respond func() string) bool {
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return false
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, msg, respond())
+			return false
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return false
+		}
+	}
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, msg, respond())
+		}
+		return false
+	}
+	return true
+}
+
+// Returns the combined info of the shards of a sharded stream.
+func newShardedStreamInfo(stream string, shards []*StreamInfo) *ShardedStreamInfo {
+	ssi := &ShardedStreamInfo{Stream: stream, Shards: shards}
+	for _, si := range shards {
+		ssi.Msgs += si.State.Msgs
+		ssi.Bytes += si.State.Bytes
+		ssi.Consumers += si.State.Consumers
+	}
+	return ssi
+}
+
+// Request to create the shards of a sharded stream.
+func (s *Server) jsShardedStreamCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamCreateResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamCreateResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	var cfg StreamConfig
+	if err := json.Unmarshal(msg, &cfg); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	stream := tokenAt(subject, 6)
+	if cfg.Name != _EMPTY_ && cfg.Name != stream {
+		resp.Error = NewJSStreamMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	if cfg.Sharding == nil {
+		resp.Error = NewJSStreamShardingInvalidError(errors.New("sharding is required"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	if cfg.Sharding.Shards < 2 || cfg.Sharding.Shards > maxStreamShards {
+		resp.Error = NewJSStreamShardingInvalidError(fmt.Errorf("number of shards must be between 2 and %d", maxStreamShards))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	// Each shard is created with its own name and index, the rest of the validation is done there.
+	subjects := make([]string, cfg.Sharding.Shards)
+	reqs := make([][]byte, cfg.Sharding.Shards)
+	for i := range subjects {
+		scfg := cfg.clone()
+		scfg.Name = shardStreamName(stream, i)
+		scfg.Sharding.Stream, scfg.Sharding.Shard = stream, i
+		subjects[i] = fmt.Sprintf(JSApiStreamCreateT, scfg.Name)
+		reqs[i], _ = json.Marshal(scfg)
+	}
+
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		shards, apiErr := jsShardResponsesEx(s, acc, subjects, reqs, func(r *JSApiStreamCreateResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		sis := make([]*StreamInfo, 0, len(shards))
+		for _, r := range shards {
+			sis = append(sis, r.StreamInfo)
+		}
+		resp.ShardedStreamInfo = newShardedStreamInfo(stream, sis)
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
+
+// Request for information on all shards of a sharded stream.
+func (s *Server) jsShardedStreamInfoRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamInfoResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamInfoResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+	sh := s.jsStreamSharding(acc, stream)
+	if sh == nil {
+		resp.Error = NewJSShardedStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	// The request, e.g. a subjects filter, is passed on to all shards.
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		shards, apiErr := jsShardResponses(s, acc, sh, JSApiStreamInfoT, msg, func(r *JSApiStreamInfoResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		sis := make([]*StreamInfo, 0, len(shards))
+		for _, r := range shards {
+			sis = append(sis, r.StreamInfo)
+		}
+		resp.ShardedStreamInfo = newShardedStreamInfo(stream, sis)
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
+
+// Request to purge all shards of a sharded stream.
+func (s *Server) jsShardedStreamPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamPurgeResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamPurgeResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+	sh := s.jsStreamSharding(acc, stream)
+	if sh == nil {
+		resp.Error = NewJSShardedStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	// The purge request, e.g. a subject filter, is passed on to all shards.
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		shards, apiErr := jsShardResponses(s, acc, sh, JSApiStreamPurgeT, msg, func(r *JSApiStreamPurgeResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		for _, r := range shards {
+			resp.Purged += r.Purged
+		}
+		resp.Success = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
+
+// Request to delete all shards of a sharded stream.
+func (s *Server) jsShardedStreamDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamDeleteResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+	sh := s.jsStreamSharding(acc, stream)
+	if sh == nil {
+		resp.Error = NewJSShardedStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		_, apiErr := jsShardResponses(s, acc, sh, JSApiStreamDeleteT, nil, func(r *JSApiStreamDeleteResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		resp.Success = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
+
+// Request to create a consumer on all shards of a sharded stream. Push consumers
+// deliver the messages of all shards to the same subject, pull consumers are
+// pulled from per shard.
+func (s *Server) jsShardedConsumerCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiShardedConsumerCreateResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	var req CreateConsumerRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	stream, consumer := tokenAt(subject, 6), tokenAt(subject, 7)
+	if req.Stream != _EMPTY_ && req.Stream != stream {
+		resp.Error = NewJSStreamMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	// Names are checked against the subject by the shards.
+	if req.Config.Durable == _EMPTY_ && req.Config.Name == _EMPTY_ {
+		req.Config.Name = consumer
+	}
+
+	sh := s.jsStreamSharding(acc, stream)
+	if sh == nil {
+		resp.Error = NewJSShardedStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	subjects := make([]string, sh.Shards)
+	reqs := make([][]byte, sh.Shards)
+	for i := range subjects {
+		req.Stream = shardStreamName(stream, i)
+		subjects[i] = fmt.Sprintf(jsShardConsumerCreateT, req.Stream, consumer)
+		reqs[i], _ = json.Marshal(&req)
+	}
+
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		shards, apiErr := jsShardResponsesEx(s, acc, subjects, reqs, func(r *JSApiConsumerCreateResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		resp.Stream, resp.Name = stream, consumer
+		for _, r := range shards {
+			resp.Shards = append(resp.Shards, r.ConsumerInfo)
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
+
+// Request to delete a consumer from all shards of a sharded stream.
+func (s *Server) jsShardedConsumerDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedConsumerDeleteResponse{ApiResponse: ApiResponse{Type: JSApiShardedConsumerDeleteResponseType}}
+	respond := func() string { return s.jsonResponse(&resp) }
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+	if !s.jsShardedRequestCheck(ci, acc, subject, reply, string(msg), &resp.ApiResponse, respond) {
+		return
+	}
+
+	stream, consumer := tokenAt(subject, 6), tokenAt(subject, 7)
+	sh := s.jsStreamSharding(acc, stream)
+	if sh == nil {
+		resp.Error = NewJSShardedStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+		return
+	}
+
+	subjects := make([]string, sh.Shards)
+	reqs := make([][]byte, sh.Shards)
+	for i := range subjects {
+		subjects[i] = fmt.Sprintf(JSApiConsumerDeleteT, shardStreamName(stream, i), consumer)
+	}
+
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		_, apiErr := jsShardResponsesEx(s, acc, subjects, reqs, func(r *JSApiConsumerDeleteResponse) *ApiResponse { return &r.ApiResponse })
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), respond())
+			return
+		}
+		resp.Success = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), respond())
+	})
+}
@@ -0,0 +1,281 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StreamStatsSample is a single sample of the statistics of a stream.
+type StreamStatsSample struct {
+	Time    time.Time `json:"ts"`
+	Msgs    uint64    `json:"messages"`
+	Bytes   uint64    `json:"bytes"`
+	LastSeq uint64    `json:"last_seq"`
+	// IngestRate is the number of messages per second stored since the previous sample.
+	IngestRate float64 `json:"ingest_rate"`
+	// GrowthRate is the change of the stream's size in bytes per second since the previous sample.
+	GrowthRate float64 `json:"growth_rate"`
+	// ConsumerLag is the number of messages pending for each consumer led by the same server.
+	ConsumerLag map[string]uint64 `json:"consumer_lag,omitempty"`
+}
+
+// The number of samples kept per stream if not configured.
+const defaultStreamStatsSamples = 360
+
+// statsRing is a fixed size ring buffer of stream statistics samples.
+type statsRing struct {
+	samples []StreamStatsSample
+	next    int
+	full    bool
+}
+
+func newStatsRing(size int) *statsRing {
+	return &statsRing{samples: make([]StreamStatsSample, size)}
+}
+
+func (r *statsRing) add(sample StreamStatsSample) {
+	r.samples[r.next] = sample
+	if r.next = (r.next + 1) % len(r.samples); r.next == 0 {
+		r.full = true
+	}
+}
+
+// Returns the most recent sample, if any.
+func (r *statsRing) last() *StreamStatsSample {
+	if !r.full && r.next == 0 {
+		return nil
+	}
+	return &r.samples[(r.next+len(r.samples)-1)%len(r.samples)]
+}
+
+// Returns the samples taken after since, oldest first.
+func (r *statsRing) since(since time.Time) []StreamStatsSample {
+	var ordered []StreamStatsSample
+	if r.full {
+		ordered = append(ordered, r.samples[r.next:]...)
+	}
+	ordered = append(ordered, r.samples[:r.next]...)
+
+	samples := make([]StreamStatsSample, 0, len(ordered))
+	for _, sample := range ordered {
+		if sample.Time.After(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// startStreamStatsSampling starts sampling the statistics of all our streams, if configured.
+func (s *Server) startStreamStatsSampling() {
+	opts := s.getOpts()
+	interval, size := opts.JetStreamStatsInterval, opts.JetStreamStatsSamples
+	if interval <= 0 {
+		return
+	}
+	if size <= 0 {
+		size = defaultStreamStatsSamples
+	}
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.quitCh:
+				return
+			case now := <-t.C:
+				js := s.getJetStream()
+				if js == nil {
+					return
+				}
+				js.mu.RLock()
+				accounts := make([]*Account, 0, len(js.accounts))
+				for _, jsa := range js.accounts {
+					accounts = append(accounts, jsa.account)
+				}
+				js.mu.RUnlock()
+
+				for _, acc := range accounts {
+					for _, mset := range acc.streams() {
+						mset.sampleStats(now.UTC(), size)
+					}
+				}
+			}
+		}
+	}, pprofLabels{"type": "stream_stats"})
+}
+
+// sampleStats adds a sample of our current statistics.
+func (mset *stream) sampleStats(now time.Time, size int) {
+	if mset.closed.Load() {
+		return
+	}
+	store := mset.store
+	if store == nil {
+		return
+	}
+	var ss StreamState
+	store.FastState(&ss)
+
+	// Only consumer leaders know their pending count.
+	var lag map[string]uint64
+	for _, o := range mset.getConsumers() {
+		if !o.isLeader() {
+			continue
+		}
+		if lag == nil {
+			lag = make(map[string]uint64)
+		}
+		o.mu.RLock()
+		lag[o.name] = o.numPending()
+		o.mu.RUnlock()
+	}
+
+	sample := StreamStatsSample{
+		Time:        now,
+		Msgs:        ss.Msgs,
+		Bytes:       ss.Bytes,
+		LastSeq:     ss.LastSeq,
+		ConsumerLag: lag,
+	}
+
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if mset.stats == nil {
+		mset.stats = newStatsRing(size)
+	}
+	if prev := mset.stats.last(); prev != nil {
+		if elapsed := now.Sub(prev.Time).Seconds(); elapsed > 0 {
+			if ss.LastSeq > prev.LastSeq {
+				sample.IngestRate = float64(ss.LastSeq-prev.LastSeq) / elapsed
+			}
+			sample.GrowthRate = (float64(ss.Bytes) - float64(prev.Bytes)) / elapsed
+		}
+	}
+	mset.stats.add(sample)
+}
+
+// statsSamples returns our samples taken after since.
+func (mset *stream) statsSamples(since time.Time) []StreamStatsSample {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.stats == nil {
+		return nil
+	}
+	return mset.stats.since(since)
+}
+
+// Request the statistics samples of a stream.
+func (s *Server) jsStreamStatsRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamStatsResponse{ApiResponse: ApiResponse{Type: JSApiStreamStatsResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamStatsRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	interval := s.getOpts().JetStreamStatsInterval
+	if interval <= 0 {
+		resp.Error = NewJSStreamStatsNotEnabledError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	resp.Stream = stream
+	resp.Interval = interval
+	resp.Samples = mset.statsSamples(req.Since)
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
@@ -17,7 +17,9 @@
 package server
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	crand "crypto/rand"
 	"encoding/base64"
@@ -25,9 +27,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -39,9 +43,11 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats-server/v2/server/sysmem"
 	"github.com/nats-io/nats.go"
@@ -942,6 +948,86 @@ func TestJetStreamMaxConsumers(t *testing.T) {
 	}
 }
 
+func TestJetStreamMaxConsumersSoftLimit(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	testJetStreamMaxConsumersSoftLimit(t, nc, js, 1)
+}
+
+func testJetStreamMaxConsumersSoftLimit(t *testing.T, nc *nats.Conn, js nats.JetStreamContext, replicas int) {
+	t.Helper()
+	sendStreamRequest := func(subj string, cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(subj, cfg.Name), req, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: replicas, MaxConsumers: 3, MaxConsumersWarn: 2}
+	// The soft limit has to be below the hard limit.
+	bad := *cfg
+	bad.MaxConsumersWarn = 4
+	require_True(t, sendStreamRequest(JSApiStreamCreateT, &bad) != nil)
+	bad.MaxConsumersWarn = -1
+	require_True(t, sendStreamRequest(JSApiStreamCreateT, &bad) != nil)
+	require_True(t, sendStreamRequest(JSApiStreamCreateT, cfg) == nil)
+
+	sub := natsSubSync(t, nc, JSAdvisoryStreamMaxConsumersWarnPre+".TEST")
+	require_NoError(t, nc.Flush())
+
+	addConsumer := func(name string) error {
+		t.Helper()
+		_, err := js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: name, AckPolicy: nats.AckExplicitPolicy})
+		return err
+	}
+
+	// Below the soft limit there is no advisory.
+	require_NoError(t, addConsumer("C1"))
+	_, err := sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Reaching the soft limit warns but still creates the consumer.
+	require_NoError(t, addConsumer("C2"))
+	var adv JSStreamMaxConsumersWarnAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &adv))
+	require_Equal(t, adv.Type, JSStreamMaxConsumersWarnAdvisoryType)
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.Consumers, 2)
+	require_Equal(t, adv.MaxConsumersWarn, 2)
+	require_Equal(t, adv.MaxConsumers, 3)
+
+	// Updating an existing consumer does not warn.
+	_, err = js.UpdateConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy, Description: "updated"})
+	require_NoError(t, err)
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	require_NoError(t, addConsumer("C3"))
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &adv))
+	require_Equal(t, adv.Consumers, 3)
+
+	// The hard limit rejects.
+	err = addConsumer("C4")
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "maximum consumers limit reached"))
+
+	// The limits can be raised on update.
+	cfg.MaxConsumers, cfg.MaxConsumersWarn = 5, 4
+	require_True(t, sendStreamRequest(JSApiStreamUpdateT, cfg) == nil)
+	require_NoError(t, addConsumer("C4"))
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &adv))
+	require_Equal(t, adv.Consumers, 4)
+	require_Equal(t, adv.MaxConsumers, 5)
+}
+
 func TestJetStreamAddStreamOverlappingSubjects(t *testing.T) {
 	mconfig := &StreamConfig{
 		Name:     "ok",
@@ -8075,21 +8161,31 @@ func TestJetStreamUpdateStream(t *testing.T) {
 			if err := mset.update(&cfg); err == nil || !strings.Contains(err.Error(), "name must match") {
 				t.Fatalf("Expected error trying to update name")
 			}
-			// Can't change max consumers for now.
+			// Can change max consumers.
 			cfg = *c.mconfig
 			cfg.MaxConsumers = 10
-			if err := mset.update(&cfg); err == nil || !strings.Contains(err.Error(), "can not change") {
-				t.Fatalf("Expected error trying to change MaxConsumers")
+			if err := mset.update(&cfg); err != nil {
+				t.Fatalf("Unexpected error trying to change MaxConsumers: %v", err)
+			}
+			if mc := mset.config().MaxConsumers; mc != 10 {
+				t.Fatalf("Expected MaxConsumers of 10, got %d", mc)
 			}
-			// Can't change storage types.
+			// Can convert between storage types and back.
 			cfg = *c.mconfig
 			if cfg.Storage == FileStorage {
 				cfg.Storage = MemoryStorage
 			} else {
 				cfg.Storage = FileStorage
 			}
-			if err := mset.update(&cfg); err == nil || !strings.Contains(err.Error(), "can not change") {
-				t.Fatalf("Expected error trying to change Storage")
+			if err := mset.update(&cfg); err != nil {
+				t.Fatalf("Unexpected error trying to change Storage: %v", err)
+			}
+			if st := mset.store.Type(); st != cfg.Storage {
+				t.Fatalf("Expected storage of %v, got %v", cfg.Storage, st)
+			}
+			cfg = *c.mconfig
+			if err := mset.update(&cfg); err != nil {
+				t.Fatalf("Unexpected error trying to change Storage: %v", err)
 			}
 			// Can't change replicas > 1 for now.
 			cfg = *c.mconfig
@@ -8103,11 +8199,15 @@ func TestJetStreamUpdateStream(t *testing.T) {
 			if err := mset.update(&cfg); err == nil || !strings.Contains(err.Error(), "template") {
 				t.Fatalf("Expected error trying to change Template owner")
 			}
-			// Can't change limits policy.
+			// Can change retention policy without consumers, and back.
 			cfg = *c.mconfig
 			cfg.Retention = WorkQueuePolicy
-			if err := mset.update(&cfg); err == nil || !strings.Contains(err.Error(), "can not change") {
-				t.Fatalf("Expected error trying to change Retention")
+			if err := mset.update(&cfg); err != nil {
+				t.Fatalf("Unexpected error trying to change Retention: %v", err)
+			}
+			cfg = *c.mconfig
+			if err := mset.update(&cfg); err != nil {
+				t.Fatalf("Unexpected error trying to change Retention: %v", err)
 			}
 
 			// Now test changing limits.
@@ -16796,6 +16896,84 @@ func TestJetStreamRecoverSealedAfterServerRestart(t *testing.T) {
 	require_True(t, si.State.Msgs == 100)
 }
 
+func TestJetStreamSealedStreamRejectsChanges(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "foo"})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "foo", Sealed: true})
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_Error(t, err, NewJSStreamSealedError())
+	require_Error(t, js.DeleteMsg("foo", 1), NewJSStreamSealedError())
+	require_Error(t, js.PurgeStream("foo"), NewJSStreamSealedError())
+
+	// The stream itself rejects removals as well, not only the API.
+	mset, err := s.GlobalAccount().lookupStream("foo")
+	require_NoError(t, err)
+	_, err = mset.removeMsg(1)
+	require_Error(t, err, errStreamSealed)
+	_, err = mset.eraseMsg(1)
+	require_Error(t, err, errStreamSealed)
+	_, err = mset.purge(nil)
+	require_Error(t, err, errStreamSealed)
+
+	// Sealing is one way.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "foo"})
+	require_Error(t, err)
+
+	si, err := js.StreamInfo("foo")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 10)
+}
+
+func TestJetStreamDenyDeleteAndPurge(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "foo", DenyDelete: true, DenyPurge: true})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	require_Error(t, js.DeleteMsg("foo", 1), NewJSStreamMsgDeleteFailedError(errStreamDenyDelete))
+	require_Error(t, js.PurgeStream("foo"), NewJSStreamPurgeFailedError(errStreamDenyPurge))
+
+	// The stream itself rejects them as well, not only the API.
+	mset, err := s.GlobalAccount().lookupStream("foo")
+	require_NoError(t, err)
+	_, err = mset.removeMsg(1)
+	require_Error(t, err, errStreamDenyDelete)
+	_, err = mset.eraseMsg(1)
+	require_Error(t, err, errStreamDenyDelete)
+	_, err = mset.purge(&JSApiStreamPurgeRequest{Keep: 1})
+	require_Error(t, err, errStreamDenyPurge)
+
+	// The flags can not be removed.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "foo", DenyPurge: true})
+	require_Error(t, err)
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "foo", DenyDelete: true})
+	require_Error(t, err)
+
+	si, err := js.StreamInfo("foo")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 10)
+}
+
 func TestJetStreamImportConsumerStreamSubjectRemapSingle(t *testing.T) {
 	conf := createConfFile(t, []byte(fmt.Sprintf(`
 		listen: 127.0.0.1:-1
@@ -20791,6 +20969,172 @@ func TestJetStreamConsumerAndStreamMetadata(t *testing.T) {
 	}
 }
 
+func TestJetStreamStreamDescriptionAndMetadataUpdate(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{
+		Name:        "TEST",
+		Storage:     FileStorage,
+		Description: "orders",
+		Metadata:    map[string]string{"team": "sales"},
+	})
+	require_NoError(t, err)
+
+	cfg := mset.config()
+	cfg.Description = "orders and returns"
+	cfg.Metadata = map[string]string{"team": "ops", "purpose": "audit"}
+	require_NoError(t, mset.update(&cfg))
+
+	// Persisted with the stream and returned in the stream info.
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.Config.Description, "orders and returns")
+	require_Equal(t, si.Config.Metadata["team"], "ops")
+	require_Equal(t, si.Config.Metadata["purpose"], "audit")
+}
+
+func TestJetStreamStreamConvertStorage(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := &nats.StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo.*"},
+		Storage:  nats.FileStorage,
+	}
+	_, err := js.AddStream(cfg)
+	require_NoError(t, err)
+
+	for i := 1; i <= 10; i++ {
+		sendStreamMsg(t, nc, fmt.Sprintf("foo.%d", i), "ok")
+	}
+	require_NoError(t, js.DeleteMsg("TEST", 3))
+
+	sub, err := js.PullSubscribe("foo.*", "dlc", nats.AckExplicit())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	msgs, err := sub.Fetch(4)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 4)
+	require_NoError(t, msgs[0].AckSync())
+	require_NoError(t, msgs[1].AckSync())
+
+	checkState := func(storage nats.StorageType, msgs, lastSeq uint64) {
+		t.Helper()
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_Equal(t, si.Config.Storage, storage)
+		require_Equal(t, si.State.Msgs, msgs)
+		require_Equal(t, si.State.FirstSeq, 1)
+		require_Equal(t, si.State.LastSeq, lastSeq)
+		require_Equal(t, si.State.NumDeleted, 1)
+
+		ci, err := js.ConsumerInfo("TEST", "dlc")
+		require_NoError(t, err)
+		require_Equal(t, ci.Delivered.Stream, 5)
+		require_Equal(t, ci.AckFloor.Stream, 3)
+		require_Equal(t, ci.NumAckPending, 2)
+
+		ai, err := js.AccountInfo()
+		require_NoError(t, err)
+		if storage == nats.MemoryStorage {
+			require_True(t, ai.Memory > 0)
+			require_Equal(t, ai.Store, 0)
+		} else {
+			require_True(t, ai.Store > 0)
+			require_Equal(t, ai.Memory, 0)
+		}
+	}
+
+	checkState(nats.FileStorage, 9, 10)
+
+	// Convert to memory.
+	cfg.Storage = nats.MemoryStorage
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	checkState(nats.MemoryStorage, 9, 10)
+
+	// New messages should continue where we left off.
+	sendStreamMsg(t, nc, "foo.11", "ok")
+	checkState(nats.MemoryStorage, 10, 11)
+
+	// Convert back to file.
+	cfg.Storage = nats.FileStorage
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	checkState(nats.FileStorage, 10, 11)
+
+	// Make sure it is all recovered from disk.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	checkState(nats.FileStorage, 10, 11)
+
+	m, err := js.GetMsg("TEST", 11)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "foo.11")
+}
+
+func TestJetStreamStreamConvertStorageCatchUp(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: nats.FileStorage})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "ok")
+	}
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	mset.mu.Lock()
+	cfg := mset.cfg.clone()
+	cfg.Storage = MemoryStorage
+	sc, err := mset.newStoreConversion(cfg, _EMPTY_, _EMPTY_)
+	mset.mu.Unlock()
+	require_NoError(t, err)
+	require_NoError(t, sc.copy())
+
+	// Change the stream while the messages were copied without the lock.
+	sendStreamMsg(t, nc, "foo", "ok")
+	sendStreamMsg(t, nc, "foo", "ok")
+	require_NoError(t, js.DeleteMsg("TEST", 5))
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Sequence: 3}))
+
+	mset.mu.Lock()
+	err = sc.finish()
+	_, ok := mset.store.(*memStore)
+	state := mset.store.State()
+	mset.mu.Unlock()
+	require_NoError(t, err)
+	require_True(t, ok)
+	require_Equal(t, state.Msgs, 9)
+	require_Equal(t, state.FirstSeq, 3)
+	require_Equal(t, state.LastSeq, 12)
+	require_Len(t, len(state.Deleted), 1)
+	require_Equal(t, state.Deleted[0], 5)
+}
+
 func TestJetStreamConsumerPurge(t *testing.T) {
 	s := RunBasicJetStreamServer(t)
 	defer s.Shutdown()
@@ -24542,3 +24886,6476 @@ func TestJetStreamDelayedAPIResponses(t *testing.T) {
 	s.sendDelayedAPIErrResponse(nil, acc, "I", _EMPTY_, "request9", "response9", nil, 100*time.Millisecond)
 	check("request9", "response9")
 }
+
+func TestJetStreamMirrorAndSourceHealthz(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "O", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "O"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S", Sources: []*nats.StreamSource{{Name: "O"}}})
+	require_NoError(t, err)
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		if hs := s.healthz(&HealthzOptions{Sources: true}); hs.Error != _EMPTY_ {
+			return errors.New(hs.Error)
+		}
+		return nil
+	})
+
+	// Now add a mirror for an origin that does not exist.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "BAD", Mirror: &nats.StreamSource{Name: "NOPE"}})
+	require_NoError(t, err)
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		hs := s.healthz(&HealthzOptions{Sources: true, Details: true})
+		if len(hs.Errors) != 1 {
+			return fmt.Errorf("expected 1 error, got %+v", hs.Errors)
+		}
+		if hs.Errors[0].Stream != "BAD" || hs.Errors[0].Type != HealthzErrorStream {
+			return fmt.Errorf("unexpected error: %+v", hs.Errors[0])
+		}
+		return nil
+	})
+
+	// Without asking for sources we should still be healthy.
+	hs := s.healthz(nil)
+	require_Equal(t, hs.Status, "ok")
+	require_Equal(t, hs.Error, _EMPTY_)
+
+	// An impossibly small inactive threshold trips healthy mirrors too.
+	hs = s.healthz(&HealthzOptions{Account: globalAccountName, Stream: "M", Sources: true, SourceMaxInactive: time.Nanosecond})
+	require_True(t, hs.Error != _EMPTY_)
+}
+
+func TestJetStreamMirrorRetryCanceledOnDelete(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "NOPE"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("M")
+	require_NoError(t, err)
+
+	// Wait for the first failure, a retry should then be scheduled.
+	checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+		mset.mu.RLock()
+		defer mset.mu.RUnlock()
+		if mset.mirror == nil || mset.mirror.fails == 0 {
+			return errors.New("mirror consumer create has not failed yet")
+		}
+		if mset.sourceSetupSchedules[mset.mirror.iname] == nil {
+			return errors.New("expected a mirror retry to be scheduled")
+		}
+		return nil
+	})
+	si, err := js.StreamInfo("M")
+	require_NoError(t, err)
+	require_True(t, si.Mirror != nil)
+
+	require_NoError(t, js.DeleteStream("M"))
+
+	mset.mu.RLock()
+	pending := len(mset.sourceSetupSchedules)
+	mset.mu.RUnlock()
+	require_Equal(t, pending, 0)
+}
+
+// Runs an external system and a server that streams of account A can reach it from,
+// as the remote named "ext", over a leafnode remote of account LINK.
+func runJSRemoteServers(t *testing.T) (*Server, *Server) {
+	t.Helper()
+	hconf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		server_name: HUB
+		jetstream: {store_dir: %q, domain: DR}
+		leafnodes { listen: 127.0.0.1:-1 }
+	`, t.TempDir())))
+	hub, hopts := RunServerWithConfig(hconf)
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		server_name: LOCAL
+		jetstream: {store_dir: %q, remotes: { ext: { account: LINK, accounts: [A] } } }
+		accounts: {
+			A: { jetstream: enabled, users: [{user: a, password: a}] }
+			B: { jetstream: enabled, users: [{user: b, password: b}] }
+			LINK: { users: [{user: link, password: link}] }
+		}
+		leafnodes { remotes [{ url: "nats-leaf://127.0.0.1:%d", account: LINK }] }
+	`, t.TempDir(), hopts.LeafNode.Port)))
+	s, _ := RunServerWithConfig(conf)
+	checkLeafNodeConnected(t, s)
+	return hub, s
+}
+
+func TestJetStreamRemotesRequireLeafNodeRemote(t *testing.T) {
+	opts := DefaultOptions()
+	opts.JetStreamRemotes = map[string]*JSRemoteOpts{"ext": {Account: "LINK", Accounts: []string{"A"}}}
+	require_Error(t, validateJetStreamOptions(opts))
+
+	opts.LeafNode.Remotes = []*RemoteLeafOpts{{LocalAccount: "LINK"}}
+	require_NoError(t, validateJetStreamOptions(opts))
+}
+
+func TestJetStreamSourceBridgeNATS(t *testing.T) {
+	hub, s := runJSRemoteServers(t)
+	defer hub.Shutdown()
+	defer s.Shutdown()
+
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	bridge := &StreamBridge{Type: StreamBridgeNATS, Remote: "ext", Subject: "ext.>"}
+
+	// Remotes the operator did not configure are rejected.
+	_, err = acc.addStream(&StreamConfig{
+		Name:    "BAD",
+		Sources: []*StreamSource{{Name: "EXT", Bridge: &StreamBridge{Type: StreamBridgeNATS, Remote: "other", Subject: "ext.>"}}},
+	})
+	require_True(t, err != nil)
+
+	// So are accounts the remote is not allowed for.
+	bacc, err := s.LookupAccount("B")
+	require_NoError(t, err)
+	_, err = bacc.addStream(&StreamConfig{Name: "BAD", Sources: []*StreamSource{{Name: "EXT", Bridge: bridge}}})
+	require_True(t, err != nil)
+
+	// Unknown bridge types should be rejected.
+	_, err = acc.addStream(&StreamConfig{
+		Name:    "BAD",
+		Sources: []*StreamSource{{Name: "EXT", Bridge: &StreamBridge{Type: "carrier-pigeon", Remote: "ext", Subject: "ext.>"}}},
+	})
+	require_True(t, err != nil)
+
+	// So should bridges on mirrors.
+	_, err = acc.addStream(&StreamConfig{Name: "BAD", Mirror: &StreamSource{Name: "EXT", Bridge: bridge}})
+	require_True(t, err != nil)
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:     "B",
+		Subjects: []string{"local"},
+		Sources:  []*StreamSource{{Name: "EXT", Bridge: bridge}},
+	})
+	require_NoError(t, err)
+
+	nc := natsConnect(t, hub.ClientURL())
+	defer nc.Close()
+
+	// Keep publishing until the bridge has subscribed and picked up messages.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		m := nats.NewMsg("ext.foo")
+		m.Header.Set("X-Bridge", "yes")
+		m.Data = []byte("hello")
+		require_NoError(t, nc.PublishMsg(m))
+		require_NoError(t, nc.Flush())
+		if state := mset.state(); state.Msgs == 0 {
+			return errors.New("no messages bridged yet")
+		}
+		return nil
+	})
+
+	sm, err := mset.getMsg(1)
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "ext.foo")
+	require_Equal(t, string(sm.Data), "hello")
+	require_True(t, bytes.Contains(sm.Header, []byte("X-Bridge: yes")))
+
+	si := mset.sourcesInfo()
+	require_Equal(t, len(si), 1)
+	require_True(t, si[0].Bridge != nil)
+	require_Equal(t, si[0].Bridge.Remote, "ext")
+	require_True(t, si[0].Active >= 0)
+	require_True(t, si[0].Error == nil)
+
+	// Removing the source tears the bridge down.
+	cfg := mset.config()
+	cfg.Sources = nil
+	require_NoError(t, mset.update(&cfg))
+	mset.mu.RLock()
+	nb := len(mset.bridges)
+	mset.mu.RUnlock()
+	require_Equal(t, nb, 0)
+}
+
+func TestJetStreamPushMirror(t *testing.T) {
+	hub, s := runJSRemoteServers(t)
+	defer hub.Shutdown()
+	defer s.Shutdown()
+
+	rnc, rjs := jsClientConnect(t, hub)
+	defer rnc.Close()
+
+	_, err := rjs.AddStream(&nats.StreamConfig{Name: "R", Subjects: []string{"foo.>"}})
+	require_NoError(t, err)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "a"))
+	defer nc.Close()
+
+	// Invalid configurations are rejected.
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	for _, pm := range []*StreamPushMirror{
+		{Name: "DR", Remote: "other", ApiPrefix: "$JS.DR.API", Stream: "R"},
+		{Name: "DR", Remote: "ext", ApiPrefix: "$JS.DR.API", Stream: "R.*"},
+		{Name: "DR", Remote: "ext", ApiPrefix: JSApiPrefix, Stream: "R"},
+	} {
+		_, err = acc.addStream(&StreamConfig{Name: "BAD", PushMirrors: []*StreamPushMirror{pm}})
+		require_True(t, err != nil)
+	}
+
+	pm := &StreamPushMirror{Name: "DR", Remote: "ext", ApiPrefix: "$JS.DR.API", Stream: "R"}
+	mset, err := acc.addStream(&StreamConfig{
+		Name:        "O",
+		Subjects:    []string{"foo.>"},
+		PushMirrors: []*StreamPushMirror{pm},
+	})
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("foo.bar", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	checkRemote := func(msgs uint64) {
+		t.Helper()
+		checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+			si, err := rjs.StreamInfo("R")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != msgs {
+				return fmt.Errorf("expected %d msgs, got %d", msgs, si.State.Msgs)
+			}
+			pis := mset.pushMirrorsInfo()
+			if len(pis) != 1 || pis[0].Lag != 0 || pis[0].Error != nil {
+				return fmt.Errorf("unexpected push mirror info: %+v", pis)
+			}
+			return nil
+		})
+	}
+	checkRemote(10)
+
+	// Pushed messages only go to the external system.
+	require_Equal(t, mset.state().Msgs, 10)
+
+	m, err := rjs.GetMsg("R", 10)
+	require_NoError(t, err)
+	require_Equal(t, m.Header.Get(JSPushMirrorSource), "O 10")
+
+	hs := s.healthz(&HealthzOptions{Sources: true})
+	require_Equal(t, hs.Error, _EMPTY_)
+
+	// Remove the push mirror, keep publishing, and add it back.
+	// It should resume from where the remote stream left off.
+	cfg := mset.config()
+	cfg.PushMirrors = nil
+	require_NoError(t, mset.update(&cfg))
+	require_True(t, len(mset.pushMirrorsInfo()) == 0)
+
+	for i := 0; i < 5; i++ {
+		_, err := js.Publish("foo.baz", []byte("OK"))
+		require_NoError(t, err)
+	}
+	cfg.PushMirrors = []*StreamPushMirror{pm}
+	require_NoError(t, mset.update(&cfg))
+	checkRemote(15)
+
+	// The remote system going away should be reported.
+	hub.Shutdown()
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		pis := mset.pushMirrorsInfo()
+		if len(pis) != 1 || pis[0].Error == nil {
+			return fmt.Errorf("expected an error, got %+v", pis)
+		}
+		if hs := s.healthz(&HealthzOptions{Sources: true}); hs.Error == _EMPTY_ {
+			return errors.New("expected push mirror to be unhealthy")
+		}
+		return nil
+	})
+}
+
+func TestJetStreamPushMirrorRejections(t *testing.T) {
+	hub, s := runJSRemoteServers(t)
+	defer hub.Shutdown()
+	defer s.Shutdown()
+
+	rnc, rjs := jsClientConnect(t, hub)
+	defer rnc.Close()
+	_, err := rjs.AddStream(&nats.StreamConfig{Name: "R", Subjects: []string{"foo"}, MaxMsgSize: 128})
+	require_NoError(t, err)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "a"))
+	defer nc.Close()
+
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	mset, err := acc.addStream(&StreamConfig{
+		Name:        "O",
+		Subjects:    []string{"foo"},
+		PushMirrors: []*StreamPushMirror{{Name: "DR", Remote: "ext", ApiPrefix: "$JS.DR.API", Stream: "R"}},
+	})
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+		if pis := mset.pushMirrorsInfo(); len(pis) != 1 || pis[0].Lag != 0 || pis[0].Error != nil {
+			return fmt.Errorf("unexpected push mirror info: %+v", pis)
+		}
+		return nil
+	})
+
+	// A message the remote stream rejects is reported, and not pushed again right away.
+	_, err = js.Publish("foo", bytes.Repeat([]byte("Z"), 256))
+	require_NoError(t, err)
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		pis := mset.pushMirrorsInfo()
+		if len(pis) != 1 || pis[0].Rejected != 2 {
+			return fmt.Errorf("expected a rejection, got %+v", pis)
+		}
+		if !IsNatsErr(pis[0].Error, JSStreamPushMirrorRejectedErrF) {
+			return fmt.Errorf("unexpected error: %v", pis[0].Error)
+		}
+		return nil
+	})
+	time.Sleep(500 * time.Millisecond)
+	pis := mset.pushMirrorsInfo()
+	require_Equal(t, pis[0].Retries, 1)
+	si, err := rjs.StreamInfo("R")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+}
+
+func TestJetStreamQuarantineRejectedMessages(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// The quarantine stream can not quarantine itself.
+	_, err := s.GlobalAccount().addStream(&StreamConfig{Name: JSQuarantineStream, Quarantine: true})
+	require_True(t, err != nil)
+
+	req, err := json.Marshal(&StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo"},
+		Storage:    FileStorage,
+		MaxMsgSize: 64,
+		Quarantine: true,
+	})
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	// The quarantine stream should have been created for us.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		_, err := js.StreamInfo(JSQuarantineStream)
+		return err
+	})
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// Wrong expected last sequence.
+	_, err = js.Publish("foo", []byte("BAD SEQ"), nats.ExpectLastSequence(22))
+	require_Error(t, err)
+	// Too big.
+	_, err = js.Publish("foo", bytes.Repeat([]byte("Z"), 128))
+	require_Error(t, err)
+
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		si, err := js.StreamInfo(JSQuarantineStream)
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 2 {
+			return fmt.Errorf("expected 2 quarantined msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	m, err := js.GetMsg(JSQuarantineStream, 1)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "$JS.QUARANTINE.TEST")
+	require_Equal(t, string(m.Data), "BAD SEQ")
+	require_Equal(t, m.Header.Get(JSQuarantineStreamHdr), "TEST")
+	require_Equal(t, m.Header.Get(JSQuarantineSubjectHdr), "foo")
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamWrongLastSequenceError(1).Error())
+	require_Equal(t, m.Header.Get(JSExpectedLastSeq), _EMPTY_)
+
+	m, err = js.GetMsg(JSQuarantineStream, 2)
+	require_NoError(t, err)
+	require_Equal(t, len(m.Data), 128)
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamMessageExceedsMaximumError().Error())
+
+	// Streams without quarantine enabled do not quarantine.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+	_, err = js.Publish("bar", []byte("BAD SEQ"), nats.ExpectLastSequence(22))
+	require_Error(t, err)
+	si, err := js.StreamInfo(JSQuarantineStream)
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+}
+
+func TestJetStreamDeadLetterStream(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, DeadLetter: "TEST"})
+	require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+	_, err = acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, DeadLetter: "D.L.Q"})
+	require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo"},
+		Storage:    FileStorage,
+		MaxMsgs:    1,
+		Discard:    DiscardNew,
+		MaxMsgSize: 64,
+		DeadLetter: "DLQ",
+	})
+	require_NoError(t, err)
+
+	// The dead letter stream should have been created for us.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		_, err := js.StreamInfo("DLQ")
+		return err
+	})
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// Wrong expected last sequence.
+	_, err = js.Publish("foo", []byte("BAD SEQ"), nats.ExpectLastSequence(22))
+	require_Error(t, err)
+	// Too big.
+	_, err = js.Publish("foo", bytes.Repeat([]byte("Z"), 128))
+	require_Error(t, err)
+	// Over the limits of the stream.
+	_, err = js.Publish("foo", []byte("FULL"))
+	require_Error(t, err)
+
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		si, err := js.StreamInfo("DLQ")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 3 {
+			return fmt.Errorf("expected 3 dead letters, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	m, err := js.GetMsg("DLQ", 1)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "$JS.DLQ.DLQ.TEST")
+	require_Equal(t, string(m.Data), "BAD SEQ")
+	require_Equal(t, m.Header.Get(JSQuarantineStreamHdr), "TEST")
+	require_Equal(t, m.Header.Get(JSQuarantineSubjectHdr), "foo")
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamWrongLastSequenceError(1).Error())
+
+	m, err = js.GetMsg("DLQ", 2)
+	require_NoError(t, err)
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamMessageExceedsMaximumError().Error())
+
+	m, err = js.GetMsg("DLQ", 3)
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "FULL")
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamStoreFailedError(ErrMaxMsgs, Unless(ErrMaxMsgs)).Error())
+
+	// A dead letter stream can be provided up front, and is not changed.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OWN", Subjects: []string{"$JS.DLQ.OWN.>"}, MaxMsgs: 10, NoAck: true})
+	require_NoError(t, err)
+	cfg := mset.config()
+	cfg.DeadLetter = "OWN"
+	cfg.Sealed = true
+	require_NoError(t, mset.update(&cfg))
+
+	_, err = js.Publish("foo", []byte("SEALED"))
+	require_Error(t, err)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		si, err := js.StreamInfo("OWN")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 1 {
+			return fmt.Errorf("expected 1 dead letter, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	si, err := js.StreamInfo("OWN")
+	require_NoError(t, err)
+	require_Equal(t, si.Config.MaxMsgs, 10)
+	m, err = js.GetMsg("OWN", 1)
+	require_NoError(t, err)
+	require_Equal(t, m.Header.Get(JSQuarantineReasonHdr), NewJSStreamSealedError().Error())
+}
+
+func TestJetStreamStorageErrorPolicy(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: "`+t.TempDir()+`"
+			storage_errors: { io: read_only, permission: disable }
+		}
+		accounts: {
+			$SYS: { users: [{user: admin, password: s3cr3t}] }
+		}
+	`))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	require_Equal(t, opts.JetStreamStorageErrors[StorageErrorIO], StorageErrorActionReadOnly)
+	require_Equal(t, s.storageErrorAction(StorageErrorIO), StorageErrorActionReadOnly)
+	require_Equal(t, s.storageErrorAction(StorageErrorPermission), StorageErrorActionDisable)
+	// Defaults for classes that were not configured.
+	require_Equal(t, s.storageErrorAction(StorageErrorOutOfSpace), StorageErrorActionDisable)
+	require_Equal(t, s.storageErrorAction(StorageErrorCorruption), StorageErrorActionReadOnly)
+
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t"))
+	defer ncSys.Close()
+	sub := natsSubSync(t, ncSys, JSAdvisoryServerStorageError)
+	require_NoError(t, ncSys.Flush())
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	// Errors that are not storage failures are ignored.
+	require_False(t, s.handleStorageError(mset, ErrMaxMsgs))
+
+	serr := &fs.PathError{Op: "write", Path: "1.blk", Err: syscall.EIO}
+	require_True(t, s.handleStorageError(mset, serr))
+
+	msg := natsNexMsg(t, sub, time.Second)
+	var adv JSServerStorageErrorAdvisory
+	require_NoError(t, json.Unmarshal(msg.Data, &adv))
+	require_Equal(t, adv.Type, JSServerStorageErrorAdvisoryType)
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.Class, StorageErrorIO)
+	require_Equal(t, adv.Action, StorageErrorActionReadOnly)
+
+	// The stream should now reject new messages, but still serve reads.
+	_, err = js.Publish("foo", []byte("NOPE"))
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "read-only"))
+	_, err = js.GetMsg("TEST", 1)
+	require_NoError(t, err)
+
+	// Repeated failures do not flood the system with advisories.
+	require_True(t, s.handleStorageError(mset, serr))
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// JetStream is still enabled.
+	require_True(t, s.JetStreamEnabled())
+}
+
+func TestJetStreamStreamStorageFailureRecover(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: { store_dir: "`+t.TempDir()+`" }
+		accounts: {
+			$SYS: { users: [{user: admin, password: s3cr3t}] }
+		}
+	`))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t"))
+	defer ncSys.Close()
+	sub := natsSubSync(t, ncSys, "$JS.EVENT.ADVISORY.SERVER.>")
+	require_NoError(t, ncSys.Flush())
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+
+	recoverStream := func(name string) *JSApiStreamRecoverResponse {
+		t.Helper()
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamRecoverT, name), nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamRecoverResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return &resp
+	}
+	storageFailure := func(name string) *StreamStorageFailure {
+		t.Helper()
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, name), nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.StorageFailure
+	}
+
+	// Nothing to recover from.
+	resp := recoverStream("TEST")
+	require_True(t, resp.Error == nil)
+	require_False(t, resp.Recovered)
+	require_True(t, recoverStream("NONE").Error != nil)
+
+	// By default an IO error only makes the failed stream read-only.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, s.handleStorageError(mset, &fs.PathError{Op: "write", Path: "1.blk", Err: syscall.EIO}))
+	require_True(t, s.JetStreamEnabled())
+
+	failure := storageFailure("TEST")
+	require_True(t, failure != nil)
+	require_Equal(t, failure.Class, StorageErrorIO)
+	require_True(t, strings.Contains(failure.Error, "input/output error"))
+	require_True(t, storageFailure("OTHER") == nil)
+
+	_, err = js.Publish("foo", []byte("NOPE"))
+	require_Error(t, err)
+	_, err = js.Publish("bar", []byte("OK"))
+	require_NoError(t, err)
+
+	// The stream accepts messages again once recovered.
+	resp = recoverStream("TEST")
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Recovered)
+	require_Equal(t, resp.Failure.Class, StorageErrorIO)
+	require_True(t, storageFailure("TEST") == nil)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	var adv JSServerStorageErrorAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &adv))
+	require_Equal(t, adv.Type, JSServerStorageErrorAdvisoryType)
+	require_Equal(t, adv.Action, StorageErrorActionReadOnly)
+	var radv JSServerStorageRecoveredAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &radv))
+	require_Equal(t, radv.Type, JSServerStorageRecoveredAdvisoryType)
+	require_Equal(t, radv.Stream, "TEST")
+	require_Equal(t, radv.Class, StorageErrorIO)
+
+	// Failing again is reported again.
+	require_True(t, s.handleStorageError(mset, &fs.PathError{Op: "write", Path: "1.blk", Err: syscall.EIO}))
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, time.Second).Data, &adv))
+	require_Equal(t, adv.Type, JSServerStorageErrorAdvisoryType)
+}
+
+func TestJetStreamStorageErrorPolicyBadConfig(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		jetstream: {
+			storage_errors: { io: explode }
+		}
+	`))
+	_, err := ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "Unknown storage error action"))
+}
+
+func TestJetStreamBackupScheduleParse(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 10, 7, 30, 0, time.UTC) // A Friday.
+	for _, test := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"@every 90s", now.Add(90 * time.Second)},
+		{"* * * * *", time.Date(2024, time.March, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2024, time.March, 18, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,20 * *", time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		sched, err := parseBackupSchedule(test.spec)
+		require_NoError(t, err)
+		if next := sched.next(now); !next.Equal(test.next) {
+			t.Fatalf("Expected next of %q to be %v, got %v", test.spec, test.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *", "@every 10ms", "@often"} {
+		_, err := parseBackupSchedule(spec)
+		require_Error(t, err)
+	}
+}
+
+func TestJetStreamStreamBackup(t *testing.T) {
+	backupDir := t.TempDir()
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: "`+t.TempDir()+`"
+			backup_dir: "`+backupDir+`"
+		}
+	`))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+	require_Equal(t, opts.JetStreamBackupDir, backupDir)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	sub := natsSubSync(t, nc, JSAdvisoryStreamBackupPre+".>")
+	require_NoError(t, nc.Flush())
+
+	acc := s.GlobalAccount()
+	for _, cfg := range []*StreamConfig{
+		{Name: "M", Storage: MemoryStorage, Backup: &StreamBackup{Schedule: "@hourly", Path: "p"}},
+		{Name: "F", Storage: FileStorage, Backup: &StreamBackup{Schedule: "@hourly"}},
+		{Name: "F", Storage: FileStorage, Backup: &StreamBackup{Schedule: "@hourly", Path: "../p"}},
+		{Name: "F", Storage: FileStorage, Backup: &StreamBackup{Schedule: "@hourly", Path: "p", ObjectStore: "B"}},
+		{Name: "F", Storage: FileStorage, Backup: &StreamBackup{Schedule: "@hourly", ObjectStore: "B.C"}},
+		{Name: "F", Storage: FileStorage, Backup: &StreamBackup{Schedule: "0 0 31 4 *", Path: "p"}},
+	} {
+		_, err := acc.addStream(cfg)
+		require_True(t, IsNatsErr(err, JSStreamBackupInvalidErrF))
+	}
+
+	waitForBackup := func(stream string) *JSStreamBackupAdvisory {
+		t.Helper()
+		msg, err := sub.NextMsg(5 * time.Second)
+		require_NoError(t, err)
+		var adv JSStreamBackupAdvisory
+		require_NoError(t, json.Unmarshal(msg.Data, &adv))
+		require_Equal(t, adv.Type, JSStreamBackupAdvisoryType)
+		require_Equal(t, adv.Stream, stream)
+		require_Equal(t, adv.Error, _EMPTY_)
+		require_True(t, adv.Bytes > 0)
+		return &adv
+	}
+
+	// Backups to the local backup directory.
+	mset, err := acc.addStream(&StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo"},
+		Storage:  FileStorage,
+		Backup:   &StreamBackup{Schedule: "@every 1s", Path: "nightly", Retain: 2},
+	})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		adv := waitForBackup("TEST")
+		require_Equal(t, adv.Destination, "path nightly")
+	}
+	dir := filepath.Join(backupDir, globalAccountName, "nightly", "TEST")
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 2 {
+			return fmt.Errorf("expected 2 backups, got %d", len(entries))
+		}
+		return nil
+	})
+
+	// Removing the schedule stops backups.
+	cfg := mset.config()
+	cfg.Backup = nil
+	require_NoError(t, mset.update(&cfg))
+	// One could have been in flight.
+	sub.NextMsg(1500 * time.Millisecond)
+	_, err = sub.NextMsg(1500 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Backups to an object store, these can be read back with the clients.
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "BACKUPS"})
+	require_NoError(t, err)
+	cfg.Backup = &StreamBackup{Schedule: "@every 1s", ObjectStore: "BACKUPS", Retain: 1}
+	require_NoError(t, mset.update(&cfg))
+
+	var last *JSStreamBackupAdvisory
+	for i := 0; i < 2; i++ {
+		last = waitForBackup("TEST")
+		require_Equal(t, last.Destination, "object store BACKUPS")
+	}
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		infos, err := obs.List()
+		if err != nil {
+			return err
+		}
+		if len(infos) != 1 {
+			return fmt.Errorf("expected 1 backup, got %d", len(infos))
+		}
+		return nil
+	})
+	data, err := obs.GetBytes("TEST/" + last.Name)
+	require_NoError(t, err)
+	require_Equal(t, int64(len(data)), last.Bytes)
+}
+
+func TestJetStreamRestoreProgressThrottleAndResume(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	msg := make([]byte, 1024)
+	for i := 0; i < 200; i++ {
+		crand.Read(msg)
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+
+	sreq := &JSApiStreamSnapshotRequest{DeliverSubject: nats.NewInbox(), ChunkSize: 4096}
+	req, _ := json.Marshal(sreq)
+	var snapshot []byte
+	done := make(chan bool)
+	sub, err := nc.Subscribe(sreq.DeliverSubject, func(m *nats.Msg) {
+		if len(m.Data) == 0 {
+			done <- true
+			return
+		}
+		snapshot = append(snapshot, m.Data...)
+		m.Respond(nil)
+	})
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamSnapshotT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var sresp JSApiStreamSnapshotResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &sresp))
+	require_True(t, sresp.Error == nil)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive our snapshot in time")
+	}
+	require_NoError(t, js.DeleteStream("TEST"))
+
+	orp, ora := restoreProgressInterval, restoreActivityInterval
+	restoreProgressInterval, restoreActivityInterval = 100*time.Millisecond, 500*time.Millisecond
+	defer func() { restoreProgressInterval, restoreActivityInterval = orp, ora }()
+
+	progress := natsSubSync(t, nc, JSAdvisoryStreamRestoreProgressPre+".TEST")
+	require_NoError(t, nc.Flush())
+
+	size := int64(len(snapshot))
+	restore := func(opts StreamRestoreOptions) *JSApiStreamRestoreResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiStreamRestoreRequest{Config: *sresp.Config, State: *sresp.State, StreamRestoreOptions: opts})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamRestoreT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var rresp JSApiStreamRestoreResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &rresp))
+		return &rresp
+	}
+	send := func(subj string, data []byte) {
+		t.Helper()
+		for len(data) > 0 {
+			n := min(len(data), 1024)
+			_, err := nc.Request(subj, data[:n], 2*time.Second)
+			require_NoError(t, err)
+			data = data[n:]
+		}
+	}
+
+	// Unknown restores can not be resumed.
+	rresp := restore(StreamRestoreOptions{Resume: "BAD"})
+	require_True(t, IsNatsErr(rresp.Error, JSRestoreResumeNotFoundErr))
+
+	// Send half of the snapshot and stop, this stalls the restore.
+	rresp = restore(StreamRestoreOptions{Size: size})
+	require_True(t, rresp.Error == nil)
+	require_True(t, rresp.RestoreID != _EMPTY_)
+	require_Equal(t, rresp.Offset, 0)
+	half := size / 2
+	send(rresp.DeliverSubject, snapshot[:half])
+
+	m, err := progress.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSRestoreProgressAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Type, JSRestoreProgressAdvisoryType)
+	require_Equal(t, adv.Size, size)
+	require_True(t, adv.Bytes > 0 && adv.Bytes <= half)
+	require_True(t, adv.Messages > 0)
+
+	// Resume with a rate limit, the rest should take about half a second.
+	id := rresp.RestoreID
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		if rresp = restore(StreamRestoreOptions{Size: size, Resume: id, RateLimit: size}); rresp.Error != nil {
+			return rresp.Error
+		}
+		return nil
+	})
+	require_Equal(t, rresp.RestoreID, id)
+	require_Equal(t, rresp.Offset, half)
+
+	start := time.Now()
+	send(rresp.DeliverSubject, snapshot[rresp.Offset:])
+	require_True(t, time.Since(start) > 400*time.Millisecond)
+
+	rmsg, err = nc.Request(rresp.DeliverSubject, nil, 2*time.Second)
+	require_NoError(t, err)
+	var cresp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &cresp))
+	require_True(t, cresp.Error == nil)
+	require_Equal(t, cresp.State.Msgs, 200)
+
+	// Resumed restores can not be resumed again.
+	require_NoError(t, js.DeleteStream("TEST"))
+	rresp = restore(StreamRestoreOptions{Resume: id})
+	require_True(t, IsNatsErr(rresp.Error, JSRestoreResumeNotFoundErr))
+}
+
+func TestJetStreamRestoreVerifyOnly(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 100; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	sub, err := js.PullSubscribe("foo", "dlc")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	for _, m := range msgs[:5] {
+		require_NoError(t, m.AckSync())
+	}
+
+	sreq := &JSApiStreamSnapshotRequest{DeliverSubject: nats.NewInbox(), ChunkSize: 4096}
+	req, _ := json.Marshal(sreq)
+	var snapshot []byte
+	done := make(chan bool)
+	ssub, err := nc.Subscribe(sreq.DeliverSubject, func(m *nats.Msg) {
+		if len(m.Data) == 0 {
+			done <- true
+			return
+		}
+		snapshot = append(snapshot, m.Data...)
+		m.Respond(nil)
+	})
+	require_NoError(t, err)
+	defer ssub.Unsubscribe()
+
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamSnapshotT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var sresp JSApiStreamSnapshotResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &sresp))
+	require_True(t, sresp.Error == nil)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive our snapshot in time")
+	}
+
+	// Verify against the live stream, which is not touched.
+	req, _ = json.Marshal(&JSApiStreamRestoreRequest{
+		Config:               *sresp.Config,
+		State:                *sresp.State,
+		StreamRestoreOptions: StreamRestoreOptions{VerifyOnly: true},
+	})
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamRestoreT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var rresp JSApiStreamRestoreResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &rresp))
+	require_True(t, rresp.Error == nil)
+	for r := bytes.NewReader(snapshot); r.Len() > 0; {
+		chunk := make([]byte, min(r.Len(), 1024))
+		r.Read(chunk)
+		_, err = nc.Request(rresp.DeliverSubject, chunk, time.Second)
+		require_NoError(t, err)
+	}
+	rmsg, err = nc.Request(rresp.DeliverSubject, nil, 2*time.Second)
+	require_NoError(t, err)
+	var vresp JSApiStreamRestoreVerifyResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &vresp))
+	require_Equal(t, vresp.Type, JSApiStreamRestoreVerifyResponseType)
+	require_True(t, vresp.Error == nil)
+	report := vresp.Report
+	require_True(t, report.Valid)
+	require_Len(t, len(report.Errors), 0)
+	require_Equal(t, report.State.Msgs, 100)
+	require_Len(t, len(report.Consumers), 1)
+	require_Equal(t, report.Consumers[0].Name, "dlc")
+	require_True(t, report.Consumers[0].Valid)
+	require_Equal(t, report.Consumers[0].Delivered, 10)
+	require_Equal(t, report.Consumers[0].AckFloor, 5)
+	require_Equal(t, report.Consumers[0].Pending, 5)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 100)
+
+	// Rewrites the snapshot, changing files as needed.
+	rewrite := func(change func(name string, data []byte) []byte) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		zw := s2.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		tr := tar.NewReader(s2.NewReader(bytes.NewReader(snapshot)))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require_NoError(t, err)
+			data, err := io.ReadAll(tr)
+			require_NoError(t, err)
+			data = change(hdr.Name, data)
+			hdr.Size = int64(len(data))
+			require_NoError(t, tw.WriteHeader(hdr))
+			_, err = tw.Write(data)
+			require_NoError(t, err)
+		}
+		require_NoError(t, tw.Close())
+		require_NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	verify := func(snap []byte) *StreamSnapshotReport {
+		t.Helper()
+		report, err := s.GlobalAccount().VerifyStreamSnapshot(sresp.Config, sresp.State, bytes.NewReader(snap))
+		require_NoError(t, err)
+		require_False(t, report.Valid)
+		return report
+	}
+
+	// Corrupt message.
+	report = verify(rewrite(func(name string, data []byte) []byte {
+		if name == filepath.Join(msgDir, "1.blk") {
+			data[len(data)/2] ^= 0xff
+		}
+		return data
+	}))
+	require_Contains(t, report.Errors[0], "failed checksum validation")
+
+	// Bad stream metadata.
+	report = verify(rewrite(func(name string, data []byte) []byte {
+		if name == JetStreamMetaFileSum {
+			return []byte("bad")
+		}
+		return data
+	}))
+	require_Contains(t, report.Errors[0], "checksum mismatch")
+
+	// Consumer ahead of the stream.
+	report = verify(rewrite(func(name string, data []byte) []byte {
+		if name == filepath.Join(consumerDir, "dlc", consumerState) {
+			return encodeConsumerState(&ConsumerState{
+				Delivered: SequencePair{Consumer: 500, Stream: 500},
+				AckFloor:  SequencePair{Consumer: 400, Stream: 400},
+			})
+		}
+		return data
+	}))
+	require_Len(t, len(report.Errors), 0)
+	require_False(t, report.Consumers[0].Valid)
+	require_Contains(t, report.Consumers[0].Errors[0], "ahead of stream's last sequence")
+
+	// Truncated archive.
+	report = verify(snapshot[:len(snapshot)/2])
+	require_Contains(t, report.Errors[0], "invalid snapshot archive")
+}
+
+func TestJetStreamStreamStatsSampling(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			stats_interval: 100ms
+			stats_samples: 5
+		}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+	require_Equal(t, opts.JetStreamStatsInterval, 100*time.Millisecond)
+	require_Equal(t, opts.JetStreamStatsSamples, 5)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	getStats := func(req *JSApiStreamStatsRequest) *JSApiStreamStatsResponse {
+		t.Helper()
+		var b []byte
+		if req != nil {
+			b, _ = json.Marshal(req)
+		}
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamStatsT, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamStatsResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return &resp
+	}
+
+	// Publish for a while so we get samples with ingest.
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			_, err = js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	resp := getStats(nil)
+	require_Equal(t, resp.Stream, "TEST")
+	require_Equal(t, resp.Interval, 100*time.Millisecond)
+	// Only the configured number of samples are kept.
+	require_Len(t, len(resp.Samples), 5)
+
+	var ingest bool
+	for i, sample := range resp.Samples {
+		if i > 0 {
+			require_True(t, sample.Time.After(resp.Samples[i-1].Time))
+			require_True(t, sample.LastSeq >= resp.Samples[i-1].LastSeq)
+		}
+		ingest = ingest || sample.IngestRate > 0 && sample.GrowthRate > 0
+	}
+	require_True(t, ingest)
+	last := resp.Samples[len(resp.Samples)-1]
+	require_Equal(t, last.Msgs, 100)
+	require_Equal(t, last.LastSeq, 100)
+	require_Equal(t, last.ConsumerLag["dlc"], 100)
+
+	// Only samples after the given time.
+	since := resp.Samples[2].Time
+	resp = getStats(&JSApiStreamStatsRequest{Since: since})
+	require_True(t, len(resp.Samples) >= 2)
+	for _, sample := range resp.Samples {
+		require_True(t, sample.Time.After(since))
+	}
+
+	// Sampling has to be enabled.
+	sd := RunBasicJetStreamServer(t)
+	defer sd.Shutdown()
+	nc2, js2 := jsClientConnect(t, sd)
+	defer nc2.Close()
+	_, err = js2.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	rmsg, err := nc2.Request(fmt.Sprintf(JSApiStreamStatsT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var eresp JSApiStreamStatsResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &eresp))
+	require_True(t, IsNatsErr(eresp.Error, JSStreamStatsNotEnabledErr))
+}
+
+func TestJetStreamQueueLimits(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: "`+t.TempDir()+`"
+			queue_limits: {
+				raft_proposals: { max_msgs: 10000, max_bytes: 64MB }
+				catchup: { max_bytes: 8MB, policy: backpressure }
+				outbound: { max_msgs: 100, policy: drop_oldest }
+			}
+		}
+	`))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	limits := opts.JetStreamQueueLimits
+	require_Equal(t, limits.RaftProposals, QueueLimit{MaxMsgs: 10000, MaxBytes: 64 * 1024 * 1024})
+	require_Equal(t, limits.Catchup, QueueLimit{MaxBytes: 8 * 1024 * 1024, Policy: QueueBackpressure})
+	require_Equal(t, limits.Outbound, QueueLimit{MaxMsgs: 100, Policy: QueueDropOldest})
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	mset.mu.RLock()
+	outq := mset.outq
+	mset.mu.RUnlock()
+	require_Equal(t, outq.mlen, 100)
+	require_Equal(t, outq.pol, QueueDropOldest)
+
+	// Drops are reported by the ipqueuesz monitoring endpoint.
+	outq.dropped.Add(3)
+	rr := httptest.NewRecorder()
+	s.HandleIPQueuesz(rr, httptest.NewRequest("GET", "/ipqueuesz?queues=TEST", nil))
+	var queues map[string]monitorIPQueue
+	require_NoError(t, json.Unmarshal(rr.Body.Bytes(), &queues))
+	q, ok := queues["[ACC:$G] stream 'TEST' sendQ"]
+	require_True(t, ok)
+	require_Equal(t, q.Dropped, 3)
+}
+
+func TestJetStreamQueueLimitsBadConfig(t *testing.T) {
+	for _, test := range []struct {
+		limits string
+		err    string
+	}{
+		{"raft_proposals: { max_msgs: 10, policy: drop_oldest }", `can only be "backpressure"`},
+		{"outbound: { policy: drop_everything }", "Unknown queue limit policy"},
+		{"outbound: { max_msgs: -1 }", "Expected a non-negative number"},
+		{"outbound: { max_msgs: 10 }", `must be "drop_new" or "drop_oldest"`},
+		{"outbound: { max_bytes: 1MB, policy: backpressure }", `must be "drop_new" or "drop_oldest"`},
+	} {
+		conf := createConfFile(t, []byte(`
+			jetstream: {
+				queue_limits: { `+test.limits+` }
+			}
+		`))
+		_, err := ProcessConfigFile(conf)
+		require_Error(t, err)
+		require_Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestJetStreamWorkQueueSharedConsumers(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      "JOBS",
+		Subjects:  []string{"jobs.>"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require_NoError(t, err)
+
+	createConsumer := func(stream, name, filter string, shared bool) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(&CreateConsumerRequest{
+			Stream: stream,
+			Config: ConsumerConfig{
+				Durable:       name,
+				FilterSubject: filter,
+				AckPolicy:     AckExplicit,
+				Shared:        shared,
+			},
+		})
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, stream, name), req, time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+		return ccResp.Error
+	}
+
+	// Shared consumers may overlap with each other, including unfiltered ones.
+	require_True(t, createConsumer("JOBS", "ALL", _EMPTY_, true) == nil)
+	require_True(t, createConsumer("JOBS", "EMAIL", "jobs.email", true) == nil)
+
+	// But not with consumers that are not shared.
+	apiErr := createConsumer("JOBS", "OTHER", "jobs.sms", false)
+	require_True(t, IsNatsErr(apiErr, JSConsumerWQConsumerNotUniqueErr))
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("jobs.email", []byte("job"))
+		require_NoError(t, err)
+	}
+
+	// Each message is owned by the first consumer it is delivered to.
+	all, err := js.PullSubscribe("jobs.>", "ALL", nats.Bind("JOBS", "ALL"))
+	require_NoError(t, err)
+	email, err := js.PullSubscribe("jobs.email", "EMAIL", nats.Bind("JOBS", "EMAIL"))
+	require_NoError(t, err)
+
+	seen := make(map[uint64]string)
+	fetch := func(sub *nats.Subscription, name string, batch, expected int) {
+		t.Helper()
+		msgs, err := sub.Fetch(batch, nats.MaxWait(250*time.Millisecond))
+		if expected == 0 {
+			require_Error(t, err, nats.ErrTimeout)
+			return
+		}
+		require_NoError(t, err)
+		require_Len(t, len(msgs), expected)
+		for _, m := range msgs {
+			meta, err := m.Metadata()
+			require_NoError(t, err)
+			owner, ok := seen[meta.Sequence.Stream]
+			require_False(t, ok && owner != name)
+			seen[meta.Sequence.Stream] = name
+			require_NoError(t, m.AckSync())
+		}
+	}
+	fetch(all, "ALL", 4, 4)
+	fetch(email, "EMAIL", 10, 6)
+	require_Len(t, len(seen), 10)
+
+	// Nothing is left for either consumer.
+	fetch(all, "ALL", 10, 0)
+	fetch(email, "EMAIL", 10, 0)
+
+	// Acking removed the messages from the stream, and their claims.
+	mset, err := s.GlobalAccount().lookupStream("JOBS")
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if msgs := mset.state().Msgs; msgs != 0 {
+			return fmt.Errorf("expected no messages, got %d", msgs)
+		}
+		return nil
+	})
+	mset.claimsMu.Lock()
+	nclaims := len(mset.claims)
+	mset.claimsMu.Unlock()
+	require_Equal(t, nclaims, 0)
+
+	// Messages owned by a consumer that goes away are delivered to the others that skipped them.
+	for i := 0; i < 4; i++ {
+		_, err = js.Publish("jobs.email", []byte("job"))
+		require_NoError(t, err)
+	}
+	msgs, err := all.Fetch(2, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+	fetch(email, "EMAIL", 10, 2)
+	require_NoError(t, js.DeleteConsumer("JOBS", "ALL"))
+	seen = make(map[uint64]string)
+	fetch(email, "EMAIL", 10, 2)
+	require_True(t, seen[11] == "EMAIL" && seen[12] == "EMAIL")
+
+	// Claims of pending messages are known again after a restart, so those of ALL are not delivered twice.
+	require_True(t, createConsumer("JOBS", "ALL", _EMPTY_, true) == nil)
+	for i := 0; i < 4; i++ {
+		_, err = js.Publish("jobs.email", []byte("job"))
+		require_NoError(t, err)
+	}
+	all, err = js.PullSubscribe("jobs.>", "ALL", nats.Bind("JOBS", "ALL"))
+	require_NoError(t, err)
+	msgs, err = all.Fetch(2, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+
+	u, err := url.Parse(s.ClientURL())
+	require_NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require_NoError(t, err)
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(port, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	email, err = js.PullSubscribe("jobs.email", "EMAIL", nats.Bind("JOBS", "EMAIL"))
+	require_NoError(t, err)
+	seen = make(map[uint64]string)
+	fetch(email, "EMAIL", 10, 2)
+	require_True(t, seen[17] == "EMAIL" && seen[18] == "EMAIL")
+
+	// Shared can not be changed on update.
+	apiErr = createConsumer("JOBS", "EMAIL", "jobs.email", false)
+	require_True(t, apiErr != nil)
+
+	// Shared consumers need a WorkQueue stream.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LIMITS", Subjects: []string{"limits"}})
+	require_NoError(t, err)
+	apiErr = createConsumer("LIMITS", "C", _EMPTY_, true)
+	require_True(t, IsNatsErr(apiErr, JSConsumerSharedRequiresWorkQueueErr))
+}
+
+func TestJetStreamWorkQueueSharedConsumersAckFloor(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      "JOBS",
+		Subjects:  []string{"jobs"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("JOBS")
+	require_NoError(t, err)
+	for _, name := range []string{"A", "B"} {
+		_, err = mset.addConsumer(&ConsumerConfig{Durable: name, AckPolicy: AckExplicit, Shared: true})
+		require_NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err = js.Publish("jobs", []byte("job"))
+		require_NoError(t, err)
+	}
+
+	// B owns the first two messages but does not acknowledge them.
+	b, err := js.PullSubscribe("jobs", "B", nats.Bind("JOBS", "B"))
+	require_NoError(t, err)
+	msgs, err := b.Fetch(2, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+
+	a, err := js.PullSubscribe("jobs", "A", nats.Bind("JOBS", "A"))
+	require_NoError(t, err)
+	msgs, err = a.Fetch(2, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	// The ack floor of A can not pass the messages B still owns.
+	o := mset.lookupConsumer("A")
+	require_NotNil(t, o)
+	state, err := o.store.State()
+	require_NoError(t, err)
+	require_Equal(t, state.AckFloor.Stream, 0)
+
+	mset.checkInterestState()
+	require_Equal(t, mset.state().Msgs, 2)
+}
+func TestJetStreamConsumerDeliverOrder(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      "TASKS",
+		Subjects:  []string{"tasks.*"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require_NoError(t, err)
+
+	createConsumer := func(stream string, cfg ConsumerConfig) *ApiError {
+		t.Helper()
+		cfg.AckPolicy = AckExplicit
+		req, err := json.Marshal(&CreateConsumerRequest{Stream: stream, Config: cfg})
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, stream, cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+		return ccResp.Error
+	}
+	fetchSeqs := func(sub *nats.Subscription, batch int, ack bool) []uint64 {
+		t.Helper()
+		msgs, err := sub.Fetch(batch, nats.MaxWait(250*time.Millisecond))
+		require_NoError(t, err)
+		var seqs []uint64
+		for _, m := range msgs {
+			meta, err := m.Metadata()
+			require_NoError(t, err)
+			seqs = append(seqs, meta.Sequence.Stream)
+			if ack {
+				require_NoError(t, m.AckSync())
+			}
+		}
+		return seqs
+	}
+
+	// Newest first.
+	require_True(t, createConsumer("TASKS", ConsumerConfig{Durable: "LIFO", FilterSubject: "tasks.lifo", DeliverOrder: DeliverOrderLIFO}) == nil)
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("tasks.lifo", nil)
+		require_NoError(t, err)
+	}
+	lifo, err := js.PullSubscribe("tasks.lifo", "LIFO", nats.Bind("TASKS", "LIFO"))
+	require_NoError(t, err)
+	require_Equal(t, fmt.Sprint(fetchSeqs(lifo, 2, true)), "[5 4]")
+	_, err = js.Publish("tasks.lifo", nil)
+	require_NoError(t, err)
+	require_Equal(t, fmt.Sprint(fetchSeqs(lifo, 1, false)), "[6]")
+
+	// Taking over starts from the messages not acknowledged and skips pending ones.
+	mset, err := s.GlobalAccount().lookupStream("TASKS")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("LIFO")
+	require_NotNil(t, o)
+	o.mu.Lock()
+	o.resetOrdered()
+	o.streamNumPending()
+	npc := o.numPending()
+	o.mu.Unlock()
+	require_Equal(t, npc, 3)
+	require_Equal(t, fmt.Sprint(fetchSeqs(lifo, 3, true)), "[3 2 1]")
+
+	// Lowest header value first, then oldest first, and no value last.
+	require_True(t, createConsumer("TASKS", ConsumerConfig{Durable: "PRIO", FilterSubject: "tasks.prio", DeliverOrder: DeliverOrderHeader, OrderHeader: "Priority"}) == nil)
+	for _, prio := range []string{"5", "1", _EMPTY_, "3", "1", "bad"} {
+		m := nats.NewMsg("tasks.prio")
+		if prio != _EMPTY_ {
+			m.Header.Set("Priority", prio)
+		}
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	prio, err := js.PullSubscribe("tasks.prio", "PRIO", nats.Bind("TASKS", "PRIO"))
+	require_NoError(t, err)
+	require_Equal(t, fmt.Sprint(fetchSeqs(prio, 6, true)), "[8 11 10 7 9 12]")
+
+	// Validation.
+	for _, test := range []struct {
+		stream string
+		cfg    ConsumerConfig
+	}{
+		{"TASKS", ConsumerConfig{Durable: "A", FilterSubject: "tasks.a", DeliverOrder: "random"}},
+		{"TASKS", ConsumerConfig{Durable: "B", FilterSubject: "tasks.b", DeliverOrder: DeliverOrderHeader}},
+		{"TASKS", ConsumerConfig{Durable: "C", FilterSubject: "tasks.c", OrderHeader: "Priority"}},
+		{"TASKS", ConsumerConfig{Durable: "D", FilterSubject: "tasks.d", DeliverOrder: DeliverOrderLIFO, DeliverSubject: "push"}},
+		{"LIMITS", ConsumerConfig{Durable: "E", DeliverOrder: DeliverOrderLIFO}},
+	} {
+		if test.stream == "LIMITS" {
+			_, err = js.AddStream(&nats.StreamConfig{Name: "LIMITS", Subjects: []string{"limits"}})
+			require_NoError(t, err)
+		}
+		apiErr := createConsumer(test.stream, test.cfg)
+		require_True(t, IsNatsErr(apiErr, JSConsumerDeliverOrderInvalidErrF))
+	}
+}
+
+func TestJetStreamConsumerDeliverOrderAckFloor(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TASKS", Subjects: []string{"tasks"}, Retention: nats.WorkQueuePolicy})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("TASKS")
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "LIFO", AckPolicy: AckExplicit, DeliverOrder: DeliverOrderLIFO})
+	require_NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("tasks", nil)
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("tasks", "LIFO", nats.Bind("TASKS", "LIFO"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	meta, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	require_Equal(t, meta.Sequence.Stream, 5)
+	require_NoError(t, msgs[0].AckSync())
+
+	// The ack floor stays below the messages not delivered yet, so they are kept.
+	mset.checkInterestState()
+	si, err := js.StreamInfo("TASKS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 4)
+	o := mset.lookupConsumer("LIFO")
+	require_NotNil(t, o)
+	state, err := o.store.State()
+	require_NoError(t, err)
+	require_Equal(t, state.AckFloor.Stream, 0)
+
+	// Also after a restart.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	mset, err = s.GlobalAccount().lookupStream("TASKS")
+	require_NoError(t, err)
+	mset.checkInterestState()
+	si, err = js.StreamInfo("TASKS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 4)
+
+	sub, err = js.PullSubscribe("tasks", "LIFO", nats.Bind("TASKS", "LIFO"))
+	require_NoError(t, err)
+	msgs, err = sub.Fetch(4)
+	require_NoError(t, err)
+	var seqs []uint64
+	for _, m := range msgs {
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		seqs = append(seqs, meta.Sequence.Stream)
+		require_NoError(t, m.AckSync())
+	}
+	require_Equal(t, fmt.Sprint(seqs), "[4 3 2 1]")
+	mset.checkInterestState()
+	si, err = js.StreamInfo("TASKS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 0)
+}
+func TestJetStreamConsumerCheckpointExportImport(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy, AckWait: 250 * time.Millisecond})
+	require_NoError(t, err)
+
+	exportCheckpoint := func(consumer string) *JSApiConsumerExportResponse {
+		t.Helper()
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerExportT, "TEST", consumer), nil, time.Second)
+		require_NoError(t, err)
+		var cpResp JSApiConsumerExportResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &cpResp))
+		return &cpResp
+	}
+	importCheckpoint := func(consumer string, cp *ConsumerCheckpoint) *JSApiConsumerImportResponse {
+		t.Helper()
+		req, err := json.Marshal(&JSApiConsumerImportRequest{Checkpoint: cp})
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerImportT, "TEST", consumer), req, time.Second)
+		require_NoError(t, err)
+		var cpResp JSApiConsumerImportResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &cpResp))
+		return &cpResp
+	}
+
+	sub, err := js.PullSubscribe("foo", "dlc", nats.Bind("TEST", "dlc"))
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Deliver 5 and leave 3 and 5 unacknowledged.
+	msgs, err := sub.Fetch(5)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 5)
+	for _, i := range []int{0, 1, 3} {
+		require_NoError(t, msgs[i].AckSync())
+	}
+
+	cpResp := exportCheckpoint("dlc")
+	require_True(t, cpResp.Error == nil)
+	cp := cpResp.Checkpoint
+	require_Equal(t, cp.Stream, "TEST")
+	require_Equal(t, cp.Consumer, "dlc")
+	require_Equal(t, cp.Delivered, SequencePair{Consumer: 5, Stream: 5})
+	require_Equal(t, cp.AckFloor, SequencePair{Consumer: 2, Stream: 2})
+	require_Len(t, len(cp.Pending), 2)
+	require_Equal(t, cp.Pending[0], SequencePair{Consumer: 3, Stream: 3})
+	require_Equal(t, cp.Pending[1], SequencePair{Consumer: 5, Stream: 5})
+	require_Equal(t, cp.PendingDigest, checkpointPendingDigest(cp.Pending))
+
+	// Move on and process everything.
+	for {
+		msgs, err := sub.Fetch(10, nats.MaxWait(500*time.Millisecond))
+		if err == nats.ErrTimeout {
+			break
+		}
+		require_NoError(t, err)
+		for _, m := range msgs {
+			require_NoError(t, m.AckSync())
+		}
+	}
+	ci, err := js.ConsumerInfo("TEST", "dlc")
+	require_NoError(t, err)
+	require_Equal(t, ci.AckFloor.Stream, 10)
+
+	// A tampered checkpoint should be rejected.
+	bad := *cp
+	bad.Pending = bad.Pending[:1]
+	iResp := importCheckpoint("dlc", &bad)
+	require_True(t, IsNatsErr(iResp.Error, JSConsumerCheckpointInvalidErrF))
+	bad = *cp
+	bad.AckFloor = SequencePair{Consumer: 6, Stream: 6}
+	iResp = importCheckpoint("dlc", &bad)
+	require_True(t, IsNatsErr(iResp.Error, JSConsumerCheckpointInvalidErrF))
+	// As well as one past the end of the stream.
+	bad = *cp
+	bad.Delivered = SequencePair{Consumer: 11, Stream: 11}
+	iResp = importCheckpoint("dlc", &bad)
+	require_True(t, IsNatsErr(iResp.Error, JSConsumerCheckpointInvalidErrF))
+	require_Contains(t, iResp.Error.Description, "delivered 11 not in 0..10")
+
+	// Go back to our checkpoint.
+	iResp = importCheckpoint("dlc", cp)
+	require_True(t, iResp.Error == nil)
+	require_Equal(t, iResp.Checkpoint.Delivered, cp.Delivered)
+	require_Equal(t, iResp.Checkpoint.AckFloor, cp.AckFloor)
+	require_Equal(t, iResp.Checkpoint.PendingDigest, cp.PendingDigest)
+
+	ci, err = js.ConsumerInfo("TEST", "dlc")
+	require_NoError(t, err)
+	require_Equal(t, ci.AckFloor.Stream, 2)
+	require_Equal(t, ci.NumAckPending, 2)
+	require_Equal(t, ci.NumPending, 5)
+
+	// We should get the undelivered messages first, then the pending ones once their ack wait expired.
+	var seqs []uint64
+	for len(seqs) < 7 {
+		msgs, err := sub.Fetch(10, nats.MaxWait(time.Second))
+		require_NoError(t, err)
+		for _, m := range msgs {
+			meta, err := m.Metadata()
+			require_NoError(t, err)
+			seqs = append(seqs, meta.Sequence.Stream)
+			require_NoError(t, m.AckSync())
+		}
+	}
+	require_Equal(t, fmt.Sprint(seqs), "[6 7 8 9 10 3 5]")
+
+	// The checkpoint can also be imported by a new consumer.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "new", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	iResp = importCheckpoint("new", cp)
+	require_True(t, iResp.Error == nil)
+	require_Equal(t, iResp.Checkpoint.Consumer, "new")
+	require_Equal(t, iResp.Checkpoint.Delivered, cp.Delivered)
+
+	// Only durable consumers have checkpoints.
+	esub, err := js.SubscribeSync("foo")
+	require_NoError(t, err)
+	defer esub.Unsubscribe()
+	eci, err := esub.ConsumerInfo()
+	require_NoError(t, err)
+	cpResp = exportCheckpoint(eci.Name)
+	require_True(t, IsNatsErr(cpResp.Error, JSConsumerCheckpointRequiresDurableErr))
+	iResp = importCheckpoint(eci.Name, cp)
+	require_True(t, IsNatsErr(iResp.Error, JSConsumerCheckpointRequiresDurableErr))
+
+	cpResp = exportCheckpoint("missing")
+	require_True(t, IsNatsErr(cpResp.Error, JSConsumerNotFoundErr))
+
+	// Nor one from before the first message of the stream.
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Sequence: 5}))
+	iResp = importCheckpoint("dlc", cp)
+	require_True(t, IsNatsErr(iResp.Error, JSConsumerCheckpointInvalidErrF))
+	require_Contains(t, iResp.Error.Description, "ack floor 2 not in 4..10")
+}
+
+func TestJetStreamStreamAssert(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish(fmt.Sprintf("foo.%d", i%2), []byte(strconv.Itoa(i)))
+		require_NoError(t, err)
+	}
+
+	assertStream := func(stream string, req *JSApiStreamAssertRequest) *JSApiStreamAssertResponse {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamAssertT, stream), b, time.Second)
+		require_NoError(t, err)
+		var aResp JSApiStreamAssertResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &aResp))
+		return &aResp
+	}
+	u64 := func(v uint64) *uint64 { return &v }
+
+	aResp := assertStream("TEST", &JSApiStreamAssertRequest{
+		FirstSeq: u64(1),
+		LastSeq:  u64(10),
+		MinMsgs:  u64(10),
+		MaxMsgs:  u64(20),
+		LastBySubject: []StreamSubjectAssertion{
+			{Subject: "foo.0", Digest: streamAssertDigest([]byte("8"))},
+			{Subject: "foo.1", Digest: streamAssertDigest([]byte("9"))},
+			{Subject: "foo.2"},
+		},
+	})
+	require_True(t, aResp.Error == nil)
+	require_True(t, aResp.Passed)
+	require_Equal(t, aResp.LastSeq, 10)
+	require_Len(t, len(aResp.Results), 7)
+	for _, r := range aResp.Results {
+		require_True(t, r.Passed)
+	}
+
+	aResp = assertStream("TEST", &JSApiStreamAssertRequest{
+		LastSeq: u64(11),
+		MinMsgs: u64(5),
+		LastBySubject: []StreamSubjectAssertion{
+			{Subject: "foo.0", Digest: streamAssertDigest([]byte("6"))},
+		},
+	})
+	require_True(t, aResp.Error == nil)
+	require_False(t, aResp.Passed)
+	require_Len(t, len(aResp.Results), 3)
+	require_Equal(t, aResp.Results[0], StreamAssertionResult{Assertion: "last_seq", Expected: "11", Actual: "10"})
+	require_Equal(t, aResp.Results[1], StreamAssertionResult{Assertion: "min_msgs", Expected: ">= 5", Actual: "10", Passed: true})
+	require_Equal(t, aResp.Results[2].Subject, "foo.0")
+	require_Equal(t, aResp.Results[2].Actual, streamAssertDigest([]byte("8")))
+	require_False(t, aResp.Results[2].Passed)
+
+	// Bad requests.
+	aResp = assertStream("TEST", &JSApiStreamAssertRequest{})
+	require_True(t, IsNatsErr(aResp.Error, JSStreamAssertInvalidErrF))
+	aResp = assertStream("TEST", &JSApiStreamAssertRequest{LastBySubject: []StreamSubjectAssertion{{Subject: "foo..bar"}}})
+	require_True(t, IsNatsErr(aResp.Error, JSStreamAssertInvalidErrF))
+	aResp = assertStream("TEST", &JSApiStreamAssertRequest{LastBySubject: []StreamSubjectAssertion{{Subject: "foo.0", Digest: "abc"}}})
+	require_True(t, IsNatsErr(aResp.Error, JSStreamAssertInvalidErrF))
+	aResp = assertStream("MISSING", &JSApiStreamAssertRequest{LastSeq: u64(1)})
+	require_True(t, IsNatsErr(aResp.Error, JSStreamNotFoundErr))
+}
+
+func TestJetStreamShardedStream(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	shardedRequest := func(subject string, req any, resp any) {
+		t.Helper()
+		var b []byte
+		if req != nil {
+			var err error
+			b, err = json.Marshal(req)
+			require_NoError(t, err)
+		}
+		rmsg, err := nc.Request(subject, b, 2*time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(rmsg.Data, resp))
+	}
+
+	// Check validation first.
+	var cResp JSApiShardedStreamCreateResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), &StreamConfig{Subjects: []string{"orders.*"}, Storage: FileStorage}, &cResp)
+	require_True(t, IsNatsErr(cResp.Error, JSStreamShardingInvalidErrF))
+	cResp = JSApiShardedStreamCreateResponse{}
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), &StreamConfig{Subjects: []string{"orders"}, Storage: FileStorage, Sharding: &StreamSharding{Shards: 3, Token: 2}}, &cResp)
+	require_True(t, IsNatsErr(cResp.Error, JSStreamShardingInvalidErrF))
+
+	cResp = JSApiShardedStreamCreateResponse{}
+	cfg := &StreamConfig{Subjects: []string{"orders.*"}, Storage: FileStorage, Sharding: &StreamSharding{Shards: 3, Token: 2}}
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), cfg, &cResp)
+	require_True(t, cResp.Error == nil)
+	require_Len(t, len(cResp.Shards), 3)
+	for i, si := range cResp.Shards {
+		require_Equal(t, si.Config.Name, fmt.Sprintf("ORDERS-shard-%d", i))
+		require_Equal(t, si.Config.Sharding.Shard, i)
+	}
+
+	// Other streams can still not overlap.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"orders.>"}})
+	require_Error(t, err)
+
+	// Each message is stored once, by the shard its second token hashes to.
+	for i := 0; i < 30; i++ {
+		pa, err := js.Publish(fmt.Sprintf("orders.%d", i), []byte("OK"))
+		require_NoError(t, err)
+		require_True(t, strings.HasPrefix(pa.Stream, "ORDERS-shard-"))
+	}
+	var total uint64
+	for i := 0; i < 3; i++ {
+		mset, err := s.GlobalAccount().lookupStream(shardStreamName("ORDERS", i))
+		require_NoError(t, err)
+		state := mset.state()
+		require_True(t, state.Msgs > 0)
+		total += state.Msgs
+		for seq := state.FirstSeq; seq <= state.LastSeq; seq++ {
+			sm, err := mset.getMsg(seq)
+			require_NoError(t, err)
+			require_True(t, mset.shard.owns(sm.Subject))
+		}
+	}
+	require_Equal(t, total, 30)
+
+	var iResp JSApiShardedStreamInfoResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamInfoT, "ORDERS"), nil, &iResp)
+	require_True(t, iResp.Error == nil)
+	require_Equal(t, iResp.Stream, "ORDERS")
+	require_Equal(t, iResp.Msgs, 30)
+	require_Len(t, len(iResp.Shards), 3)
+	shards := iResp.Shards
+
+	iResp = JSApiShardedStreamInfoResponse{}
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamInfoT, "MISSING"), nil, &iResp)
+	require_True(t, IsNatsErr(iResp.Error, JSShardedStreamNotFoundErr))
+
+	// A push consumer on all shards delivers to the same subject.
+	sub, err := nc.SubscribeSync("deliver.orders")
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	var ccResp JSApiShardedConsumerCreateResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedConsumerCreateT, "ORDERS", "all"), &CreateConsumerRequest{
+		Config: ConsumerConfig{Durable: "all", DeliverSubject: "deliver.orders", AckPolicy: AckNone},
+	}, &ccResp)
+	require_True(t, ccResp.Error == nil)
+	require_Len(t, len(ccResp.Shards), 3)
+	checkSubsPending(t, sub, 30)
+
+	// Consumers on a single shard work as usual.
+	ci, err := js.AddConsumer(shardStreamName("ORDERS", 1), &nats.ConsumerConfig{Durable: "one", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	require_Equal(t, ci.NumPending, shards[1].State.Msgs)
+
+	var cdResp JSApiShardedConsumerDeleteResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedConsumerDeleteT, "ORDERS", "all"), nil, &cdResp)
+	require_True(t, cdResp.Error == nil && cdResp.Success)
+
+	var pResp JSApiShardedStreamPurgeResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamPurgeT, "ORDERS"), &JSApiStreamPurgeRequest{Subject: "orders.7"}, &pResp)
+	require_True(t, pResp.Error == nil)
+	require_Equal(t, pResp.Purged, 1)
+	pResp = JSApiShardedStreamPurgeResponse{}
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamPurgeT, "ORDERS"), nil, &pResp)
+	require_True(t, pResp.Error == nil)
+	require_Equal(t, pResp.Purged, 29)
+
+	// Sharding can not be changed.
+	scfg := cResp.Shards[0].Config
+	scfg.Sharding = &StreamSharding{Stream: "ORDERS", Shards: 4, Token: 2}
+	var uResp JSApiStreamUpdateResponse
+	shardedRequest(fmt.Sprintf(JSApiStreamUpdateT, scfg.Name), &scfg, &uResp)
+	require_True(t, IsNatsErr(uResp.Error, JSStreamShardingInvalidErrF))
+
+	var dResp JSApiShardedStreamDeleteResponse
+	shardedRequest(fmt.Sprintf(JSApiShardedStreamDeleteT, "ORDERS"), nil, &dResp)
+	require_True(t, dResp.Error == nil && dResp.Success)
+	require_Len(t, len(s.GlobalAccount().streams()), 0)
+}
+
+func TestJetStreamStreamAtomicPublish(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "STATE", Subjects: []string{"state.*"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OUTBOX", Subjects: []string{"outbox.*"}, MaxMsgs: 2, Discard: nats.DiscardNew})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("outbox.*", "C")
+	require_NoError(t, err)
+
+	atomicPublish := func(msgs ...*AtomicMsg) *JSApiStreamAtomicPublishResponse {
+		t.Helper()
+		b, err := json.Marshal(&JSApiStreamAtomicPublishRequest{Messages: msgs})
+		require_NoError(t, err)
+		resp, err := nc.Request(JSApiStreamAtomicPublish, b, time.Second)
+		require_NoError(t, err)
+		var aResp JSApiStreamAtomicPublishResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &aResp))
+		return &aResp
+	}
+	hdr := func(kv ...string) []byte {
+		h := []byte(hdrLine)
+		for i := 0; i < len(kv); i += 2 {
+			h = append(h, fmt.Sprintf("%s: %s\r\n", kv[i], kv[i+1])...)
+		}
+		return append(h, _CRLF_...)
+	}
+	checkMsgs := func(stream string, msgs uint64) {
+		t.Helper()
+		si, err := js.StreamInfo(stream)
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, msgs)
+	}
+
+	// State change and its event are stored together.
+	first := []*AtomicMsg{
+		{Subject: "state.1", Header: hdr(JSMsgId, "s1", JSExpectedLastSubjSeq, "0"), Data: []byte("created")},
+		{Subject: "outbox.1", Header: hdr(JSMsgId, "e1"), Data: []byte("order created")},
+	}
+	aResp := atomicPublish(first...)
+	require_True(t, aResp.Error == nil)
+	require_Len(t, len(aResp.Acks), 2)
+	require_Equal(t, *aResp.Acks[0], PubAck{Stream: "STATE", Sequence: 1})
+	require_Equal(t, *aResp.Acks[1], PubAck{Stream: "OUTBOX", Sequence: 1})
+	msgs, err := sub.Fetch(1, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Equal(t, string(msgs[0].Data), "order created")
+	require_NoError(t, msgs[0].AckSync())
+
+	// A retry is acknowledged as a duplicate.
+	aResp = atomicPublish(first...)
+	require_True(t, aResp.Error == nil)
+	require_True(t, aResp.Acks[0].Duplicate && aResp.Acks[1].Duplicate)
+	require_Equal(t, aResp.Acks[1].Sequence, 1)
+
+	// A failed expectation of a later message stores nothing.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "outbox.2", Data: []byte("order updated")},
+		&AtomicMsg{Subject: "state.1", Header: hdr(JSExpectedLastSubjSeq, "0"), Data: []byte("updated")},
+	)
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs("STATE", 1)
+	checkMsgs("OUTBOX", 1)
+
+	// A failed store removes the messages stored before.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "state.1", Header: hdr(JSExpectedLastSubjSeq, "1"), Data: []byte("updated")},
+		&AtomicMsg{Subject: "outbox.2", Data: []byte("order updated")},
+		&AtomicMsg{Subject: "outbox.3", Data: []byte("order updated")},
+	)
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs("STATE", 1)
+	checkMsgs("OUTBOX", 1)
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Some duplicates but not all is an error.
+	aResp = atomicPublish(
+		&AtomicMsg{Subject: "state.2", Data: []byte("created")},
+		&AtomicMsg{Subject: "outbox.2", Header: hdr(JSMsgId, "e1")},
+	)
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs("STATE", 1)
+
+	// Bad requests.
+	aResp = atomicPublish()
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishInvalidErrF))
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.*"})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishInvalidErrF))
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.1", Header: hdr(JSMsgRollup, JSMsgRollupSubject)})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishInvalidErrF))
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.1", Header: []byte("bad")})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishInvalidErrF))
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.3"}, &AtomicMsg{Subject: "missing"})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs("STATE", 1)
+
+	// Messages are checked like any published message, and stored the same.
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.3", Header: hdr(JSMessageTTL, "1s")})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	require_Contains(t, aResp.Error.Description, NewJSMessageTTLDisabledError().Description)
+	checkMsgs("STATE", 1)
+	addStream(t, nc, &StreamConfig{Name: "HDRS", Subjects: []string{"hdrs.*"}, Storage: FileStorage, HeadersOnly: true})
+	aResp = atomicPublish(&AtomicMsg{Subject: "hdrs.1", Data: []byte("payload")})
+	require_True(t, aResp.Error == nil)
+	sm, err := js.GetMsg("HDRS", 1)
+	require_NoError(t, err)
+	require_Len(t, len(sm.Data), 0)
+	require_Equal(t, sm.Header.Get(JSMsgSize), "7")
+	addStream(t, nc, &StreamConfig{Name: "PAUSED", Subjects: []string{"paused.*"}, Storage: FileStorage, Pause: &StreamPause{}})
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.3"}, &AtomicMsg{Subject: "paused.1"})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	checkMsgs("STATE", 1)
+
+	// Limits that would remove messages to make room reject the batch, as a rollback could not restore them.
+	addStream(t, nc, &StreamConfig{Name: "LIMITS", Subjects: []string{"limits.*"}, Storage: FileStorage, MaxMsgs: 2, Discard: DiscardOld})
+	aResp = atomicPublish(&AtomicMsg{Subject: "limits.1"}, &AtomicMsg{Subject: "limits.2"})
+	require_True(t, aResp.Error == nil)
+	aResp = atomicPublish(&AtomicMsg{Subject: "state.3"}, &AtomicMsg{Subject: "limits.3"})
+	require_True(t, IsNatsErr(aResp.Error, JSAtomicPublishFailedErrF))
+	require_Contains(t, aResp.Error.Description, "limits would remove messages")
+	checkMsgs("STATE", 1)
+	checkMsgs("LIMITS", 2)
+	sm, err = js.GetMsg("LIMITS", 1)
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "limits.1")
+}
+
+func TestJetStreamStreamAtomicPublishRecovery(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "STATE", Subjects: []string{"state.*"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OUTBOX", Subjects: []string{"outbox.*"}})
+	require_NoError(t, err)
+
+	atomicPublish := func(msgs ...*AtomicMsg) {
+		t.Helper()
+		b, err := json.Marshal(&JSApiStreamAtomicPublishRequest{Messages: msgs})
+		require_NoError(t, err)
+		resp, err := nc.Request(JSApiStreamAtomicPublish, b, time.Second)
+		require_NoError(t, err)
+		var aResp JSApiStreamAtomicPublishResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &aResp))
+		require_True(t, aResp.Error == nil)
+	}
+	atomicPublish(&AtomicMsg{Subject: "state.1", Data: []byte("created")}, &AtomicMsg{Subject: "outbox.1", Data: []byte("order created")})
+	atomicPublish(&AtomicMsg{Subject: "state.1", Data: []byte("updated")}, &AtomicMsg{Subject: "outbox.1", Data: []byte("order updated")},
+		&AtomicMsg{Subject: "outbox.2", Data: []byte("order shipped")})
+
+	// No intent is left behind once acknowledged.
+	sd := s.JetStreamConfig().StoreDir
+	fn := filepath.Join(sd, globalAccountName, atomicIntentFile)
+	_, err = os.Stat(fn)
+	require_True(t, os.IsNotExist(err))
+
+	// Have the server go down as if in the middle of the second publish.
+	nc.Close()
+	s.Shutdown()
+	b, err := json.Marshal(&atomicIntent{Streams: []atomicIntentRange{{"OUTBOX", 2, 3}, {"STATE", 2, 2}}})
+	require_NoError(t, err)
+	require_NoError(t, os.WriteFile(fn, b, defaultFilePerms))
+
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	for stream, data := range map[string]string{"STATE": "created", "OUTBOX": "order created"} {
+		si, err := js.StreamInfo(stream)
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 1)
+		sm, err := js.GetMsg(stream, 1)
+		require_NoError(t, err)
+		require_Equal(t, string(sm.Data), data)
+	}
+	_, err = os.Stat(fn)
+	require_True(t, os.IsNotExist(err))
+}
+
+func TestJetStreamConsumerDeliverCompression(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"events.*"}})
+	require_NoError(t, err)
+
+	createConsumer := func(cfg ConsumerConfig) *ApiError {
+		t.Helper()
+		cfg.AckPolicy = AckExplicit
+		req, err := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: cfg})
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+		return ccResp.Error
+	}
+
+	// Check validation first.
+	for _, cfg := range []ConsumerConfig{
+		{Durable: "BAD", Compression: "zstd"},
+		{Durable: "BAD", CompressMinSize: 10},
+		{Durable: "BAD", Compression: DeliverCompressionS2, CompressMinSize: -1},
+		{Durable: "BAD", Compression: DeliverCompressionGzip, HeadersOnly: true},
+	} {
+		require_True(t, IsNatsErr(createConsumer(cfg), JSConsumerCompressionInvalidErrF))
+	}
+
+	large := []byte(strings.Repeat(`{"event":"order_created","status":"pending"}`, 100))
+	_, err = js.Publish("events.large", large)
+	require_NoError(t, err)
+	_, err = js.Publish("events.small", []byte(`{"event":"ping"}`))
+	require_NoError(t, err)
+
+	for _, tc := range []struct {
+		compression DeliverCompression
+		decode      func([]byte) ([]byte, error)
+	}{
+		{DeliverCompressionS2, func(b []byte) ([]byte, error) { return s2.Decode(nil, b) }},
+		{DeliverCompressionGzip, func(b []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		}},
+	} {
+		t.Run(string(tc.compression), func(t *testing.T) {
+			name := strings.ToUpper(string(tc.compression))
+			require_True(t, createConsumer(ConsumerConfig{Durable: name, Compression: tc.compression}) == nil)
+			sub, err := js.PullSubscribe(_EMPTY_, name, nats.Bind("TEST", name))
+			require_NoError(t, err)
+			msgs, err := sub.Fetch(2, nats.MaxWait(time.Second))
+			require_NoError(t, err)
+			require_Len(t, len(msgs), 2)
+
+			// Large payloads are compressed and marked as such.
+			require_Equal(t, msgs[0].Header.Get(JSContentEncoding), string(tc.compression))
+			require_True(t, len(msgs[0].Data) < len(large))
+			data, err := tc.decode(msgs[0].Data)
+			require_NoError(t, err)
+			require_True(t, bytes.Equal(data, large))
+
+			// Small ones are not.
+			require_Equal(t, msgs[1].Header.Get(JSContentEncoding), _EMPTY_)
+			require_Equal(t, string(msgs[1].Data), `{"event":"ping"}`)
+		})
+	}
+
+	// Stored data is untouched.
+	sm, err := js.GetMsg("TEST", 1)
+	require_NoError(t, err)
+	require_True(t, bytes.Equal(sm.Data, large))
+}
+
+func TestJetStreamStreamRejections(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo.*"},
+		MaxMsgs:    3,
+		Discard:    nats.DiscardNew,
+		MaxMsgSize: 64,
+	})
+	require_NoError(t, err)
+
+	streamInfo := func() *StreamInfo {
+		t.Helper()
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		require_NoError(t, err)
+		var siResp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &siResp))
+		require_True(t, siResp.Error == nil)
+		return siResp.StreamInfo
+	}
+	require_True(t, streamInfo().Rejections == nil)
+
+	_, err = js.Publish("foo.1", nil, nats.MsgId("1"))
+	require_NoError(t, err)
+	pa, err := js.Publish("foo.1", nil, nats.MsgId("1"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+	_, err = js.Publish("foo.1", nil, nats.ExpectLastSequence(5))
+	require_Error(t, err)
+	_, err = js.Publish("foo.1", nil, nats.ExpectLastSequencePerSubject(5))
+	require_Error(t, err)
+	_, err = js.Publish("foo.1", nil, nats.ExpectLastMsgId("2"))
+	require_Error(t, err)
+	_, err = js.Publish("foo.1", make([]byte, 100))
+	require_Error(t, err)
+	_, err = js.Publish("foo.1", nil, nats.ExpectStream("OTHER"))
+	require_Error(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = js.Publish("foo.2", nil)
+		require_NoError(t, err)
+	}
+	_, err = js.Publish("foo.2", nil)
+	require_Error(t, err)
+
+	expected := StreamRejections{Duplicate: 1, WrongLastSeq: 2, WrongLastMsgId: 1, MaxSize: 1, Limits: 1, Other: 1}
+	require_Equal(t, *streamInfo().Rejections, expected)
+
+	// Also shown in the stream details of jsz.
+	jsz, err := s.Jsz(&JSzOptions{Accounts: true, Streams: true})
+	require_NoError(t, err)
+	require_Len(t, len(jsz.AccountDetails), 1)
+	require_Len(t, len(jsz.AccountDetails[0].Streams), 1)
+	require_Equal(t, *jsz.AccountDetails[0].Streams[0].Rejections, expected)
+}
+
+func TestJetStreamStreamClientInfoPolicy(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		no_auth_user: rip
+		jetstream: {max_mem_store: 64GB, max_file_store: 10TB, store_dir: %q}
+		accounts: {
+			JS: {
+				jetstream: enabled
+				users: [ {user: dlc, password: foo} ]
+				exports [ { service: "audit.>" } ]
+			},
+			IU: {
+				users: [ {user: rip, password: bar} ]
+				imports [ { service: { subject: "audit.>", account: JS }, share: true } ]
+			},
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	acc, err := s.LookupAccount("JS")
+	require_NoError(t, err)
+
+	_, err = acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, ClientInfo: "drop"})
+	require_Error(t, err)
+
+	for name, p := range map[string]ClientInfoPolicy{"DEFAULT": _EMPTY_, "STRIP": ClientInfoStrip, "KEEP": ClientInfoKeep, "MAP": ClientInfoMap} {
+		_, err = acc.addStream(&StreamConfig{Name: name, Subjects: []string{"audit." + strings.ToLower(name)}, ClientInfo: p})
+		require_NoError(t, err)
+	}
+
+	nc, err := nats.Connect(s.ClientURL(), nats.Name("auditor"))
+	require_NoError(t, err)
+	defer nc.Close()
+
+	lastHdr := func(stream, subject string) nats.Header {
+		t.Helper()
+		sendStreamMsg(t, nc, subject, "OK")
+		mset, err := acc.lookupStream(stream)
+		require_NoError(t, err)
+		sm, err := mset.getMsg(1)
+		require_NoError(t, err)
+		if len(sm.Header) == 0 {
+			return nil
+		}
+		m, err := nats.DecodeHeadersMsg(sm.Header)
+		require_NoError(t, err)
+		return nats.Header(m)
+	}
+
+	require_Equal(t, lastHdr("DEFAULT", "audit.default").Get(ClientInfoHdr), _EMPTY_)
+	require_Equal(t, lastHdr("STRIP", "audit.strip").Get(ClientInfoHdr), _EMPTY_)
+
+	var ci ClientInfo
+	require_NoError(t, json.Unmarshal([]byte(lastHdr("KEEP", "audit.keep").Get(ClientInfoHdr)), &ci))
+	require_Equal(t, ci.Account, "IU")
+	require_Equal(t, ci.User, "rip")
+
+	h := lastHdr("MAP", "audit.map")
+	require_Equal(t, h.Get(ClientInfoHdr), _EMPTY_)
+	require_Equal(t, h.Get(JSOriginAccount), "IU")
+	require_Equal(t, h.Get(JSOriginUser), "rip")
+	require_Equal(t, h.Get(JSOriginName), "auditor")
+	require_True(t, h.Get(JSOriginConnection) != _EMPTY_)
+}
+
+func TestJetStreamListFilters(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	testJetStreamListFilters(t, nc, js)
+}
+
+func testJetStreamListFilters(t *testing.T, nc *nats.Conn, js nats.JetStreamContext) {
+	t.Helper()
+	for _, cfg := range []*nats.StreamConfig{
+		{Name: "ORDERS_EU", Subjects: []string{"eu.orders.>"}, Description: "Orders of EU tenants", Metadata: map[string]string{"tenant": "eu", "team": "billing"}},
+		{Name: "ORDERS_US", Subjects: []string{"us.orders.>"}, Description: "Orders of US tenants", Metadata: map[string]string{"tenant": "us", "team": "billing"}},
+		{Name: "AUDIT", Subjects: []string{"audit.>"}, Description: "Audit trail"},
+	} {
+		_, err := js.AddStream(cfg)
+		require_NoError(t, err)
+	}
+	for _, cfg := range []*nats.ConsumerConfig{
+		{Durable: "SHIPPING", FilterSubject: "eu.orders.shipped", Description: "Shipping service"},
+		{Durable: "INVOICES", FilterSubjects: []string{"eu.orders.paid", "eu.orders.refunded"}, Description: "Invoicing service", Metadata: map[string]string{"team": "billing"}},
+		{Durable: "ARCHIVE", Description: "Archiver"},
+	} {
+		_, err := js.AddConsumer("ORDERS_EU", cfg)
+		require_NoError(t, err)
+	}
+
+	streamNames := func(req *JSApiStreamNamesRequest) string {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(JSApiStreams, b, time.Second)
+		require_NoError(t, err)
+		var nResp JSApiStreamNamesResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &nResp))
+		require_True(t, nResp.Error == nil)
+		require_Equal(t, nResp.Total, len(nResp.Streams))
+		return strings.Join(nResp.Streams, ",")
+	}
+	streamList := func(req *JSApiStreamListRequest) string {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(JSApiStreamList, b, time.Second)
+		require_NoError(t, err)
+		var lResp JSApiStreamListResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &lResp))
+		require_True(t, lResp.Error == nil)
+		var names []string
+		for _, si := range lResp.Streams {
+			names = append(names, si.Config.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	consumerNames := func(req *JSApiConsumersRequest) string {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumersT, "ORDERS_EU"), b, time.Second)
+		require_NoError(t, err)
+		var nResp JSApiConsumerNamesResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &nResp))
+		require_True(t, nResp.Error == nil)
+		return strings.Join(nResp.Consumers, ",")
+	}
+	consumerList := func(req *JSApiConsumersRequest) string {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerListT, "ORDERS_EU"), b, time.Second)
+		require_NoError(t, err)
+		var lResp JSApiConsumerListResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &lResp))
+		require_True(t, lResp.Error == nil)
+		var names []string
+		for _, ci := range lResp.Consumers {
+			names = append(names, ci.Name)
+		}
+		slices.Sort(names)
+		return strings.Join(names, ",")
+	}
+
+	// Streams.
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{}), "AUDIT,ORDERS_EU,ORDERS_US")
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{ApiListFilter: ApiListFilter{Description: "orders"}}), "ORDERS_EU,ORDERS_US")
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{ApiListFilter: ApiListFilter{Metadata: map[string]string{"team": _EMPTY_}}}), "ORDERS_EU,ORDERS_US")
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{ApiListFilter: ApiListFilter{Metadata: map[string]string{"tenant": "us"}}}), "ORDERS_US")
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{Subject: "eu.>", ApiListFilter: ApiListFilter{Description: "TENANTS"}}), "ORDERS_EU")
+	require_Equal(t, streamNames(&JSApiStreamNamesRequest{ApiListFilter: ApiListFilter{Description: "nothing"}}), _EMPTY_)
+	require_Equal(t, streamList(&JSApiStreamListRequest{ApiListFilter: ApiListFilter{Description: "audit"}}), "AUDIT")
+	require_Equal(t, streamList(&JSApiStreamListRequest{ApiListFilter: ApiListFilter{Metadata: map[string]string{"team": "billing", "tenant": "eu"}}}), "ORDERS_EU")
+
+	// Consumers, where those without filter subjects match any subject.
+	require_Equal(t, consumerNames(&JSApiConsumersRequest{}), "ARCHIVE,INVOICES,SHIPPING")
+	require_Equal(t, consumerNames(&JSApiConsumersRequest{Subject: "eu.orders.paid"}), "ARCHIVE,INVOICES")
+	require_Equal(t, consumerNames(&JSApiConsumersRequest{ApiListFilter: ApiListFilter{Description: "service"}}), "INVOICES,SHIPPING")
+	require_Equal(t, consumerList(&JSApiConsumersRequest{Subject: "eu.orders.*", ApiListFilter: ApiListFilter{Metadata: map[string]string{"team": "billing"}}}), "INVOICES")
+	require_Equal(t, consumerList(&JSApiConsumersRequest{Subject: "eu.orders.shipped"}), "ARCHIVE,SHIPPING")
+}
+
+func TestJetStreamMaintenanceMode(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: { store_dir: "`+t.TempDir()+`" }
+		accounts: {
+			$SYS: { users: [{user: admin, password: s3cr3t}] }
+		}
+	`))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t"))
+	defer ncSys.Close()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C1", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	maintenance := func(req string) *JetStreamMaintenance {
+		t.Helper()
+		msg, err := ncSys.Request(fmt.Sprintf(jsMaintenanceReqSubj, s.ID()), []byte(req), time.Second)
+		require_NoError(t, err)
+		var resp struct {
+			Data  *JetStreamMaintenance `json:"data"`
+			Error *ApiError             `json:"error"`
+		}
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.Data
+	}
+
+	require_False(t, maintenance(_EMPTY_).Enabled)
+	m := maintenance(`{"enable": true}`)
+	require_True(t, m.Enabled)
+	require_False(t, m.Since.IsZero())
+	require_True(t, s.JetStreamInMaintenance())
+
+	// No new streams or consumers.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}})
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "maintenance"))
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy})
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "maintenance"))
+
+	// Existing assets keep working.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.UpdateConsumer("TEST", &nats.ConsumerConfig{Durable: "C1", AckPolicy: nats.AckExplicitPolicy, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// The state is reported in varz and jsz.
+	v, err := s.Varz(nil)
+	require_NoError(t, err)
+	require_True(t, v.JetStream.Maintenance != nil)
+	jsi, err := s.Jsz(nil)
+	require_NoError(t, err)
+	require_True(t, jsi.Maintenance != nil)
+	require_Equal(t, jsi.Maintenance.Since, m.Since)
+
+	require_False(t, maintenance(`{"enable": false}`).Enabled)
+	require_False(t, s.JetStreamInMaintenance())
+	v, err = s.Varz(nil)
+	require_NoError(t, err)
+	require_True(t, v.JetStream.Maintenance == nil)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+}
+
+func TestJetStreamAccountFreeze(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: { store_dir: "`+t.TempDir()+`" }
+		accounts: {
+			$SYS: { users: [{user: admin, password: s3cr3t}] }
+			A: { jetstream: enabled, users: [{user: a, password: pwd}] }
+			B: { jetstream: enabled, users: [{user: b, password: pwd}] }
+		}
+	`))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t"))
+	defer ncSys.Close()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+	ncb, jsb := jsClientConnect(t, s, nats.UserInfo("b", "pwd"))
+	defer ncb.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C1", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	freeze := func(req string) *JetStreamFreeze {
+		t.Helper()
+		msg, err := ncSys.Request(fmt.Sprintf(accDirectReqSubj, "A", "JSFREEZE"), []byte(req), time.Second)
+		require_NoError(t, err)
+		var resp struct {
+			Data  *JetStreamFreeze `json:"data"`
+			Error *ApiError        `json:"error"`
+		}
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.Data
+	}
+
+	require_False(t, freeze(_EMPTY_).Enabled)
+	f := freeze(`{"enable": true}`)
+	require_True(t, f.Enabled)
+	require_False(t, f.Since.IsZero())
+	acc, err := s.lookupAccount("A")
+	require_NoError(t, err)
+	require_True(t, acc.JetStreamFrozen())
+
+	// No new streams or consumers.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}})
+	require_Error(t, err, NewJSAccountFrozenError())
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy})
+	require_Error(t, err, NewJSAccountFrozenError())
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{AckPolicy: nats.AckExplicitPolicy})
+	require_Error(t, err, NewJSAccountFrozenError())
+
+	// Existing assets keep working.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.UpdateConsumer("TEST", &nats.ConsumerConfig{Durable: "C1", AckPolicy: nats.AckExplicitPolicy, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C1", nats.Bind("TEST", "C1"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 1)
+	require_NoError(t, msgs[0].AckSync())
+
+	// Other accounts are not frozen.
+	_, err = jsb.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+
+	require_False(t, freeze(`{"enable": false}`).Enabled)
+	require_False(t, acc.JetStreamFrozen())
+	_, err = js.AddStream(&nats.StreamConfig{Name: "NEW", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C2", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+}
+
+func TestJetStreamStreamUpdateShrinkLimits(t *testing.T) {
+	for _, storage := range []nats.StorageType{nats.FileStorage, nats.MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			s := RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			cfg := &nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: storage, Duplicates: 100 * time.Millisecond}
+			_, err := js.AddStream(cfg)
+			require_NoError(t, err)
+
+			// Every tenth message is large.
+			small, large := make([]byte, 10), make([]byte, 1000)
+			for i := 0; i < 100; i++ {
+				msg := small
+				if i%10 == 0 {
+					msg = large
+				}
+				_, err = js.Publish("foo", msg)
+				require_NoError(t, err)
+			}
+			_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+			require_NoError(t, err)
+			sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+			require_NoError(t, err)
+			msgs, err := sub.Fetch(5)
+			require_NoError(t, err)
+			require_Len(t, len(msgs), 5)
+
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			require_NoError(t, err)
+
+			// Stream and consumer have to agree with what is left in the store.
+			checkConverged := func(msgs, ackPending uint64) {
+				t.Helper()
+				checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+					state := mset.state()
+					if state.Msgs != msgs {
+						return fmt.Errorf("expected %d msgs, got %d", msgs, state.Msgs)
+					}
+					ci, err := js.ConsumerInfo("TEST", "C")
+					if err != nil {
+						return err
+					}
+					// All messages after the fetched ones are still pending.
+					var pending uint64
+					var smv StoreMsg
+					for seq := uint64(6); seq <= state.LastSeq; seq++ {
+						if _, err := mset.store.LoadMsg(seq, &smv); err == nil {
+							pending++
+						}
+					}
+					if ci.NumPending != pending {
+						return fmt.Errorf("expected %d pending, got %d", pending, ci.NumPending)
+					}
+					if uint64(ci.NumAckPending) != ackPending {
+						return fmt.Errorf("expected %d ack pending, got %d", ackPending, ci.NumAckPending)
+					}
+					return nil
+				})
+			}
+			checkConverged(100, 5)
+
+			// The large messages are removed in the background, also the one pending an ack.
+			asub, err := nc.SubscribeSync(JSAdvisoryStreamOversizedMsgsRemovedPre + ".TEST")
+			require_NoError(t, err)
+			cfg.MaxMsgSize = 100
+			_, err = js.UpdateStream(cfg)
+			require_NoError(t, err)
+			checkConverged(90, 4)
+			_, err = js.Publish("foo", large)
+			require_Error(t, err)
+
+			am, err := asub.NextMsg(time.Second)
+			require_NoError(t, err)
+			var adv JSStreamOversizedMsgsRemovedAdvisory
+			require_NoError(t, json.Unmarshal(am.Data, &adv))
+			require_Equal(t, adv.Type, JSStreamOversizedMsgsRemovedAdvisoryType)
+			require_Equal(t, adv.MaxMsgSize, 100)
+			require_Equal(t, adv.RemovedMsgs, 10)
+
+			// The oldest messages are removed to get below the bytes limit.
+			var state StreamState
+			mset.store.FastState(&state)
+			cfg.MaxBytes = int64(state.Bytes / 2)
+			_, err = js.UpdateStream(cfg)
+			require_NoError(t, err)
+			mset.store.FastState(&state)
+			require_True(t, state.Bytes <= uint64(cfg.MaxBytes))
+			require_True(t, state.FirstSeq > 5)
+			checkConverged(state.Msgs, 0)
+
+			// All messages are older than the new max age.
+			time.Sleep(200 * time.Millisecond)
+			cfg.MaxAge = 100 * time.Millisecond
+			_, err = js.UpdateStream(cfg)
+			require_NoError(t, err)
+			checkConverged(0, 0)
+		})
+	}
+}
+
+func TestJetStreamRestoreEphemeralPolicy(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "DUR", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	ci, err := js.AddConsumer("TEST", &nats.ConsumerConfig{AckPolicy: nats.AckExplicitPolicy, InactiveThreshold: 10 * time.Second})
+	require_NoError(t, err)
+	eph := ci.Name
+
+	acc := s.GlobalAccount()
+	mset, err := acc.lookupStream("TEST")
+	require_NoError(t, err)
+	cfg := mset.config()
+	sr, err := mset.snapshot(5*time.Second, false, true)
+	require_NoError(t, err)
+	snapshot, err := io.ReadAll(sr.Reader)
+	require_NoError(t, err)
+
+	var opts StreamRestoreOptions
+	require_NoError(t, json.Unmarshal([]byte(`{"ephemerals": "durable", "ephemerals_ttl": 2000000000}`), &opts))
+	require_Equal(t, opts.Ephemerals, RestoreEphemeralsAsDurables)
+	require_Equal(t, opts.EphemeralsTTL, 2*time.Second)
+	require_Error(t, json.Unmarshal([]byte(`{"ephemerals": "unknown"}`), &opts))
+
+	for _, test := range []struct {
+		name  string
+		opts  *StreamRestoreOptions
+		check func(o *consumer)
+	}{
+		{"default", nil, func(o *consumer) {
+			require_True(t, o != nil)
+			require_False(t, o.isDurable())
+		}},
+		{"durable", &StreamRestoreOptions{Ephemerals: RestoreEphemeralsAsDurables, EphemeralsTTL: 2 * time.Second}, func(o *consumer) {
+			require_True(t, o != nil)
+			require_True(t, o.isDurable())
+			ocfg := o.config()
+			require_Equal(t, ocfg.Durable, eph)
+			require_Equal(t, ocfg.InactiveThreshold, 2*time.Second)
+		}},
+		{"durable-default-ttl", &StreamRestoreOptions{Ephemerals: RestoreEphemeralsAsDurables}, func(o *consumer) {
+			require_True(t, o != nil)
+			require_True(t, o.isDurable())
+			require_Equal(t, o.config().InactiveThreshold, defaultRestoredEphemeralTTL)
+		}},
+		{"drop", &StreamRestoreOptions{Ephemerals: DropEphemerals}, func(o *consumer) {
+			require_True(t, o == nil)
+			_, err := os.Stat(filepath.Join(s.getJetStream().config.StoreDir, globalAccountName, streamsDir, "TEST", consumerDir, eph))
+			require_True(t, os.IsNotExist(err))
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mset, err := acc.lookupStream("TEST")
+			require_NoError(t, err)
+			require_NoError(t, mset.delete())
+
+			mset, err = acc.restoreStream(&cfg, bytes.NewReader(snapshot), test.opts)
+			require_NoError(t, err)
+			// Durables are always restored as they were.
+			o := mset.lookupConsumer("DUR")
+			require_True(t, o != nil)
+			require_True(t, o.isDurable())
+			test.check(mset.lookupConsumer(eph))
+		})
+	}
+}
+
+func TestJetStreamStreamSubjectTokens(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	for _, cfg := range []*StreamConfig{
+		{Name: "BAD", Subjects: []string{"bad.*"}, SubjectTokens: -1},
+		{Name: "BAD", Subjects: []string{"bad.*"}, SubjectTokens: 3},
+		{Name: "BAD", Subjects: []string{"bad.*.*.>"}, SubjectTokens: 3},
+		{Name: "BAD", Mirror: &StreamSource{Name: "TEST"}, SubjectTokens: 3},
+	} {
+		_, err := acc.addStream(cfg)
+		require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+	}
+
+	mset, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"orders.>"}, SubjectTokens: 3})
+	require_NoError(t, err)
+
+	_, err = js.Publish("orders.eu.1", nil)
+	require_NoError(t, err)
+	_, err = js.Publish("orders.eu", nil)
+	require_Error(t, err, NewJSStreamSubjectTokensError("orders.eu", 3))
+	_, err = js.Publish("orders.eu.1.x", nil)
+	require_Error(t, err, NewJSStreamSubjectTokensError("orders.eu.1.x", 3))
+
+	require_Equal(t, mset.state().Msgs, 1)
+	require_Equal(t, mset.rejections().SubjectTokens, 2)
+
+	// Without the requirement any depth is stored.
+	cfg := mset.config()
+	cfg.SubjectTokens = 0
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.Publish("orders.eu", nil)
+	require_NoError(t, err)
+	require_Equal(t, mset.state().Msgs, 2)
+}
+
+func TestJetStreamConsumerSLAReports(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	for _, cfg := range []*ConsumerConfig{
+		{Durable: "BAD", AckPolicy: AckExplicit, SLAReportInterval: 100 * time.Millisecond},
+		{Durable: "BAD", AckPolicy: AckExplicit, SLAReportInterval: -time.Second},
+		{Durable: "BAD", AckPolicy: AckNone, SLAReportInterval: time.Second},
+	} {
+		_, err := mset.addConsumer(cfg)
+		require_True(t, IsNatsErr(err, JSConsumerInvalidPolicyErrF))
+	}
+
+	sub := natsSubSync(t, nc, JSMetricConsumerSLAPre+".TEST.C")
+	defer sub.Unsubscribe()
+
+	_, err = mset.addConsumer(&ConsumerConfig{
+		Durable:           "C",
+		AckPolicy:         AckExplicit,
+		AckWait:           time.Minute,
+		SLAReportInterval: time.Second,
+	})
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	ps, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := ps.Fetch(10, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 10)
+	for i, m := range msgs {
+		if i < 2 {
+			require_NoError(t, m.Nak())
+		} else {
+			require_NoError(t, m.AckSync())
+		}
+	}
+	msgs, err = ps.Fetch(2, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	// The messages can be spread over more than one report.
+	var acks, delivered, redelivered uint64
+	for acks < 10 {
+		var e JSConsumerSLAMetric
+		require_NoError(t, json.Unmarshal(natsNexMsg(t, sub, 3*time.Second).Data, &e))
+		require_Equal(t, e.Type, JSConsumerSLAMetricType)
+		require_Equal(t, e.Stream, "TEST")
+		require_Equal(t, e.Consumer, "C")
+		require_True(t, e.AckTimeP50 <= e.AckTimeP95)
+		require_True(t, e.AckTimeP95 <= e.AckTimeP99)
+		require_True(t, e.AckTimeP99 <= e.AckTimeMax)
+		if e.Acks > 0 {
+			require_True(t, e.AckTimeMax > 0)
+		}
+		acks += e.Acks
+		delivered += e.Delivered
+		redelivered += e.Redelivered
+	}
+	require_Equal(t, acks, 10)
+	require_Equal(t, delivered, 12)
+	require_Equal(t, redelivered, 2)
+
+	// Without an interval no more reports are sent.
+	o := mset.lookupConsumer("C")
+	cfg := o.config()
+	cfg.SLAReportInterval = 0
+	require_NoError(t, o.updateConfig(&cfg))
+	// Skip a report that could have been in flight.
+	for {
+		if _, err := sub.NextMsg(100 * time.Millisecond); err != nil {
+			break
+		}
+	}
+	_, err = sub.NextMsg(1500 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+}
+
+func TestJetStreamStreamPause(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	pause := func(subj string, p *StreamPause) *JSApiStreamPauseResponse {
+		t.Helper()
+		var req []byte
+		if p != nil {
+			b, err := json.Marshal(p)
+			require_NoError(t, err)
+			req = b
+		}
+		msg, err := nc.Request(fmt.Sprintf(subj, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamPauseResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return &resp
+	}
+
+	// Paused until resumed.
+	resp := pause(JSApiStreamPauseT, nil)
+	require_True(t, resp.Paused)
+	require_Equal(t, resp.PauseRemaining, 0)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_Error(t, err, NewJSStreamPausedError())
+
+	// Updates keep the pause.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Description: "updated"})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_Error(t, err, NewJSStreamPausedError())
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.state().Msgs, 0)
+	require_Equal(t, mset.rejections().Other, 2)
+
+	resp = pause(JSApiStreamResumeT, nil)
+	require_False(t, resp.Paused)
+	require_True(t, mset.config().Pause == nil)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// Paused with the consumers until the deadline.
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	until := time.Now().Add(time.Second)
+	resp = pause(JSApiStreamPauseT, &StreamPause{Until: &until, Consumers: true})
+	require_True(t, resp.Paused)
+	require_True(t, resp.PauseRemaining > 0)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_Error(t, err, NewJSStreamPausedError())
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	// The consumer delivers again once the deadline passed.
+	msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 1)
+	require_True(t, time.Now().After(until))
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// The pause is kept across restarts.
+	pause(JSApiStreamPauseT, nil)
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	_, err = js.Publish("foo", []byte("OK"))
+	require_Error(t, err, NewJSStreamPausedError())
+	resp = pause(JSApiStreamResumeT, nil)
+	require_False(t, resp.Paused)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+}
+
+func TestJetStreamApiChunkedResponse(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, limits: {max_response_size: 1024}}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+	for i := 0; i < 100; i++ {
+		_, err = js.Publish(fmt.Sprintf("foo.%d", i), nil)
+		require_NoError(t, err)
+	}
+
+	req := []byte(`{"subjects_filter":">"}`)
+	subj := fmt.Sprintf(JSApiStreamInfoT, "TEST")
+
+	// Without asking for a chunked response the response is over the limit.
+	msg, err := nc.Request(subj, req, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_Equal(t, resp.Type, JSApiStreamInfoResponseType)
+	require_True(t, resp.Error != nil)
+	require_Equal(t, resp.Error.ErrCode, uint16(JSApiResponseTooLargeErrF))
+
+	// Now ask for chunks of at most 256 bytes.
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	m := nats.NewMsg(subj)
+	m.Reply = inbox
+	m.Data = req
+	m.Header.Set(JSResponseChunked, "256")
+	require_NoError(t, nc.PublishMsg(m))
+
+	var data []byte
+	var id string
+	for n := 1; ; n++ {
+		msg, err = sub.NextMsg(time.Second)
+		require_NoError(t, err)
+		if id == _EMPTY_ {
+			id = msg.Header.Get(JSResponseId)
+		}
+		require_Equal(t, msg.Header.Get(JSResponseId), id)
+		if chunks := msg.Header.Get(JSResponseChunks); chunks != _EMPTY_ {
+			require_Equal(t, chunks, strconv.Itoa(n-1))
+			require_Len(t, len(msg.Data), 0)
+			break
+		}
+		require_Equal(t, msg.Header.Get(JSResponseChunk), strconv.Itoa(n))
+		require_True(t, len(msg.Data) <= 256)
+		data = append(data, msg.Data...)
+	}
+	require_True(t, len(data) > 1024)
+
+	resp = JSApiStreamInfoResponse{}
+	require_NoError(t, json.Unmarshal(data, &resp))
+	require_True(t, resp.Error == nil)
+	require_Len(t, len(resp.State.Subjects), 100)
+}
+
+func TestJetStreamApiResponseNotLimitedByDefault(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		max_payload: 1024
+		jetstream: {store_dir: %q}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+	for i := 0; i < 100; i++ {
+		_, err = js.Publish(fmt.Sprintf("foo.%d", i), nil)
+		require_NoError(t, err)
+	}
+
+	// Without a configured limit a response over the max payload is sent as is.
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), []byte(`{"subjects_filter":">"}`), time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_Len(t, len(resp.State.Subjects), 100)
+}
+
+func TestJetStreamStreamSubjectLimits(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	for _, sl := range []SubjectLimit{
+		{Filter: "orders.eu.>", MaxMsgs: 0},
+		{Filter: "orders..eu", MaxMsgs: 10},
+	} {
+		err := addStream(&StreamConfig{Name: "TEST", Subjects: []string{"orders.>"}, Storage: FileStorage, SubjectLimits: []SubjectLimit{sl}})
+		require_True(t, err != nil)
+		require_Equal(t, err.ErrCode, uint16(JSStreamInvalidConfigF))
+	}
+
+	cfg := &StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"orders.>"},
+		Storage:       FileStorage,
+		SubjectLimits: []SubjectLimit{{Filter: "orders.eu.>", MaxMsgs: 3}},
+	}
+	require_True(t, addStream(cfg) == nil)
+
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "orders.eu.1", "OK")
+		sendStreamMsg(t, nc, "orders.us.1", "OK")
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.state().Msgs, 13)
+	require_Equal(t, mset.store.FilteredState(0, "orders.eu.>").Msgs, 3)
+}
+
+func TestJetStreamPersistDuplicates(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: nats.MemoryStorage})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	cfg := mset.config()
+	cfg.PersistDuplicates = true
+	_, apiErr := s.checkStreamCfg(&cfg, s.GlobalAccount(), false)
+	require_Error(t, apiErr, NewJSStreamInvalidConfigError(errors.New("persisting duplicates requires file storage")))
+	require_NoError(t, js.DeleteStream("TEST"))
+
+	cfg = StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, PersistDuplicates: true}
+	mset, err = s.GlobalAccount().addStream(&cfg)
+	require_NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		_, err = js.Publish("foo", []byte("OK"), nats.MsgId(strconv.Itoa(i)))
+		require_NoError(t, err)
+	}
+	// A message that was removed is only known from the persisted state.
+	require_NoError(t, js.DeleteMsg("TEST", 1))
+
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+
+	dfn := filepath.Join(sd, globalAccountName, streamsDir, "TEST", streamDedupeStateFile)
+	_, err = os.Stat(dfn)
+	require_NoError(t, err)
+
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	mset, err = s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.numMsgIds(), 5)
+	mset.mu.RLock()
+	lmsgId := mset.lmsgId
+	mset.mu.RUnlock()
+	require_Equal(t, lmsgId, "5")
+
+	// The state is consumed once restored.
+	_, err = os.Stat(dfn)
+	require_True(t, os.IsNotExist(err))
+
+	pa, err := js.Publish("foo", []byte("OK"), nats.MsgId("1"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+	require_Equal(t, pa.Sequence, 1)
+}
+
+func TestJetStreamStreamHooks(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo", "bar"},
+		Storage:  FileStorage,
+		Hooks: &StreamHooks{
+			Delete:  "hooks.delete",
+			Purge:   "hooks.purge",
+			Update:  "hooks.update",
+			Timeout: 250 * time.Millisecond,
+		},
+	}
+	_, err := s.GlobalAccount().addStream(cfg)
+	require_NoError(t, err)
+	for i := 0; i < 5; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	// Hook subjects can not overlap the stream subjects.
+	bcfg := cfg.clone()
+	bcfg.Hooks = &StreamHooks{Delete: "foo"}
+	_, apiErr := s.checkStreamCfg(bcfg, s.GlobalAccount(), false)
+	require_True(t, apiErr != nil)
+
+	var approve atomic.Bool
+	requests := make(chan *JSStreamHookRequest, 10)
+	_, err = nc.Subscribe("hooks.*", func(msg *nats.Msg) {
+		var req JSStreamHookRequest
+		if json.Unmarshal(msg.Data, &req) == nil {
+			requests <- &req
+		}
+		// Deletes are never approved in time.
+		if msg.Subject == "hooks.delete" {
+			return
+		}
+		reply := nats.NewMsg(msg.Reply)
+		if !approve.Load() {
+			reply.Header.Set(JSValidationError, "change freeze")
+		}
+		msg.RespondMsg(reply)
+	})
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	update := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamUpdateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	// Purges need approval.
+	err = js.PurgeStream("TEST")
+	require_Error(t, err, NewJSStreamHookRejectedError(errors.New("change freeze"), streamHookPurge))
+	req := <-requests
+	require_Equal(t, req.Stream, "TEST")
+	require_Equal(t, req.Operation, streamHookPurge)
+	require_Equal(t, req.Client.Account, globalAccountName)
+
+	approve.Store(true)
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Subject: "foo", Keep: 2}))
+	req = <-requests
+	require_Equal(t, string(req.Request), `{"filter":"foo","keep":2}`)
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+
+	// Updates only need approval when removing subjects or changing the hooks.
+	approve.Store(false)
+	ncfg := cfg.clone()
+	ncfg.Subjects = []string{"foo", "bar", "baz"}
+	require_True(t, update(ncfg) == nil)
+	require_Len(t, len(requests), 0)
+
+	ncfg.Subjects = []string{"foo"}
+	apiErr = update(ncfg)
+	require_Error(t, apiErr, NewJSStreamHookRejectedError(errors.New("change freeze"), streamHookUpdate))
+	req = <-requests
+	require_Equal(t, req.Operation, streamHookUpdate)
+	require_Equal(t, strings.Join(req.RemovedSubjects, ","), "bar,baz")
+
+	ncfg.Subjects, ncfg.Hooks = []string{"foo", "bar", "baz"}, nil
+	apiErr = update(ncfg)
+	require_Error(t, apiErr, NewJSStreamHookRejectedError(errors.New("change freeze"), streamHookUpdate))
+	<-requests
+
+	// Deletes time out without approval.
+	err = js.DeleteStream("TEST")
+	require_Error(t, err, NewJSStreamHookTimeoutError(streamHookDelete))
+	<-requests
+	_, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+}
+
+func TestJetStreamStreamInactiveThreshold(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, InactiveThreshold: -time.Second}
+	_, apiErr := s.checkStreamCfg(&cfg, s.GlobalAccount(), false)
+	require_Error(t, apiErr, NewJSStreamInvalidConfigError(errors.New("inactive threshold can not be negative")))
+
+	sub, err := nc.SubscribeSync(JSAdvisoryStreamDeletedPre + ".TEST")
+	require_NoError(t, err)
+
+	thresh := 500 * time.Millisecond
+	cfg.InactiveThreshold = thresh
+	_, err = s.GlobalAccount().addStream(&cfg)
+	require_NoError(t, err)
+
+	// Publishes keep the stream around.
+	start := time.Now()
+	for time.Since(start) < 2*thresh {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+		time.Sleep(thresh / 5)
+	}
+	_, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+
+	// So does the activity of consumers.
+	psub, err := js.PullSubscribe("foo", "C")
+	require_NoError(t, err)
+	start = time.Now()
+	for time.Since(start) < 2*thresh {
+		_, err = psub.Fetch(1, nats.MaxWait(thresh/5))
+		if err != nil {
+			require_Error(t, err, nats.ErrTimeout)
+		}
+	}
+	_, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+
+	// Once idle the stream is removed.
+	checkFor(t, 4*thresh, 50*time.Millisecond, func() error {
+		if _, err := js.StreamInfo("TEST"); err != nats.ErrStreamNotFound {
+			return fmt.Errorf("stream not removed: %v", err)
+		}
+		return nil
+	})
+	_, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+}
+
+func TestJetStreamStreamInactiveThresholdHooks(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	var approve atomic.Bool
+	requests := make(chan *JSStreamHookRequest, 100)
+	_, err := nc.Subscribe("hooks.delete", func(msg *nats.Msg) {
+		var req JSStreamHookRequest
+		if json.Unmarshal(msg.Data, &req) == nil {
+			select {
+			case requests <- &req:
+			default:
+			}
+		}
+		reply := nats.NewMsg(msg.Reply)
+		if !approve.Load() {
+			reply.Header.Set(JSValidationError, "keep it")
+		}
+		msg.RespondMsg(reply)
+	})
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	thresh := 250 * time.Millisecond
+	_, err = s.GlobalAccount().addStream(&StreamConfig{
+		Name:              "TEST",
+		Subjects:          []string{"foo"},
+		Storage:           MemoryStorage,
+		InactiveThreshold: thresh,
+		Hooks:             &StreamHooks{Delete: "hooks.delete"},
+	})
+	require_NoError(t, err)
+
+	// Removing the idle stream needs approval.
+	select {
+	case req := <-requests:
+		require_Equal(t, req.Stream, "TEST")
+		require_Equal(t, req.Operation, streamHookDelete)
+	case <-time.After(4 * thresh):
+		t.Fatalf("Did not receive a delete approval request")
+	}
+	time.Sleep(thresh)
+	_, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+
+	// Once approved the stream is removed.
+	approve.Store(true)
+	checkFor(t, 4*thresh, 50*time.Millisecond, func() error {
+		if _, err := js.StreamInfo("TEST"); err != nats.ErrStreamNotFound {
+			return fmt.Errorf("stream not removed: %v", err)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamStreamRename(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	rename := func(stream, name string) *JSApiStreamRenameResponse {
+		t.Helper()
+		req, err := json.Marshal(&JSApiStreamRenameRequest{Name: name})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamRenameT, stream), req, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamRenameResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return &resp
+	}
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "MEM", Subjects: []string{"bar"}, Storage: nats.MemoryStorage})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	sub, err := js.PullSubscribe("foo", "C")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(4)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	resp := rename("MEM", "MEM2")
+	require_Error(t, resp.Error, NewJSStreamRenameError(errors.New("only streams with file storage can be renamed")))
+	resp = rename("TEST", "MEM")
+	require_Error(t, resp.Error, NewJSStreamNameExistError())
+	resp = rename("TEST", "A.B")
+	require_True(t, resp.Error != nil)
+
+	resp = rename("TEST", "RENAMED")
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Success)
+	require_Equal(t, resp.Name, "RENAMED")
+
+	check := func() {
+		t.Helper()
+		_, err := js.StreamInfo("TEST")
+		require_Error(t, err, nats.ErrStreamNotFound)
+		si, err := js.StreamInfo("RENAMED")
+		require_NoError(t, err)
+		require_Equal(t, si.Config.Name, "RENAMED")
+		require_Equal(t, si.State.Msgs, 10)
+		ci, err := js.ConsumerInfo("RENAMED", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.Stream, "RENAMED")
+		require_Equal(t, ci.AckFloor.Stream, 4)
+	}
+	check()
+
+	// The stream keeps capturing its subjects and the consumer continues where it left off.
+	pa, err := js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Stream, "RENAMED")
+	require_Equal(t, pa.Sequence, 11)
+	sub, err = js.PullSubscribe("foo", "C", nats.Bind("RENAMED", "C"))
+	require_NoError(t, err)
+	msgs, err = sub.Fetch(1)
+	require_NoError(t, err)
+	meta, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	require_Equal(t, meta.Sequence.Stream, 5)
+	require_NoError(t, msgs[0].AckSync())
+
+	// Everything is kept across a restart.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err = js.StreamInfo("TEST")
+	require_Error(t, err, nats.ErrStreamNotFound)
+	si, err := js.StreamInfo("RENAMED")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 11)
+	ci, err := js.ConsumerInfo("RENAMED", "C")
+	require_NoError(t, err)
+	require_Equal(t, ci.AckFloor.Stream, 5)
+
+	// Renaming again keeps the data readable.
+	resp = rename("RENAMED", "TEST")
+	require_True(t, resp.Error == nil)
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 11)
+	m, err := js.GetMsg("TEST", 11)
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "OK")
+}
+
+func TestJetStreamStreamRenameInterrupted(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	sd := s.JetStreamConfig().StoreDir
+	sdir := filepath.Join(sd, globalAccountName, streamsDir)
+	odir, ndir := filepath.Join(sdir, "TEST"), filepath.Join(sdir, "RENAMED")
+
+	// Leaves the metadata for the new name behind, like a server that went down in the middle of a rename.
+	prepare := func() {
+		t.Helper()
+		buf, err := os.ReadFile(filepath.Join(odir, JetStreamMetaFile))
+		require_NoError(t, err)
+		var cfg FileStreamInfo
+		require_NoError(t, json.Unmarshal(buf, &cfg))
+		cfg.Name = "RENAMED"
+		buf, err = json.Marshal(cfg)
+		require_NoError(t, err)
+		checksum, err := streamMetaChecksum("RENAMED", buf)
+		require_NoError(t, err)
+		require_NoError(t, writeFileAtomic(filepath.Join(odir, streamOrigNameFile), []byte("TEST")))
+		nmeta, nsum := renameMetaFiles(odir)
+		require_NoError(t, writeFileAtomic(nsum, []byte(checksum)))
+		require_NoError(t, writeFileAtomic(nmeta, buf))
+	}
+	restart := func() {
+		t.Helper()
+		nc.Close()
+		s = RunJetStreamServerOnPort(-1, sd)
+		nc, js = jsClientConnect(t, s)
+	}
+	check := func(name, gone, mdir string) {
+		t.Helper()
+		_, err := js.StreamInfo(gone)
+		require_Error(t, err, nats.ErrStreamNotFound)
+		si, err := js.StreamInfo(name)
+		require_NoError(t, err)
+		require_Equal(t, si.Config.Name, name)
+		require_Equal(t, si.State.Msgs, 10)
+		nmeta, nsum := renameMetaFiles(mdir)
+		for _, fn := range []string{nmeta, nsum} {
+			_, err = os.Stat(fn)
+			require_True(t, os.IsNotExist(err))
+		}
+	}
+
+	// The directory was not moved yet, the stream stays under its old name.
+	s.Shutdown()
+	prepare()
+	restart()
+	check("TEST", "RENAMED", odir)
+
+	// The directory was moved, the rename is finished.
+	s.Shutdown()
+	prepare()
+	require_NoError(t, os.Rename(odir, ndir))
+	restart()
+	check("RENAMED", "TEST", ndir)
+	defer s.Shutdown()
+	defer nc.Close()
+}
+
+func TestJetStreamStreamRetentionMigration(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := &nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}}
+	_, err := js.AddStream(cfg)
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo.bar", []byte("OK"))
+		require_NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo.baz", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	// The consumer acknowledges the first 5 messages.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", FilterSubject: "foo.bar", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	psub, err := js.PullSubscribe("foo.bar", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := psub.Fetch(5)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 5)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	sub, err := nc.SubscribeSync(JSAdvisoryStreamRetentionMigratedPre + ".TEST")
+	require_NoError(t, err)
+
+	// With interest retention, the acknowledged messages are removed.
+	cfg.Retention = nats.InterestPolicy
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 15)
+	require_Equal(t, si.State.FirstSeq, 6)
+
+	m, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSStreamRetentionMigratedAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Type, JSStreamRetentionMigratedAdvisoryType)
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.From, LimitsPolicy)
+	require_Equal(t, adv.To, InterestPolicy)
+	require_Equal(t, adv.RemovedMsgs, 5)
+	require_Equal(t, adv.FirstSeq, 6)
+
+	// Work queue retention needs explicit acks and consumers that do not overlap.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "D", FilterSubject: "foo.*", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	cfg.Retention = nats.WorkQueuePolicy
+	_, err = js.UpdateStream(cfg)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), "overlap")
+	require_NoError(t, js.DeleteConsumer("TEST", "D"))
+
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "D", FilterSubject: "foo.baz", AckPolicy: nats.AckNonePolicy})
+	require_NoError(t, err)
+	_, err = js.UpdateStream(cfg)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), "explicit acks")
+	require_NoError(t, js.DeleteConsumer("TEST", "D"))
+
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	m, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.From, InterestPolicy)
+	require_Equal(t, adv.To, WorkQueuePolicy)
+	require_Equal(t, adv.RemovedMsgs, 0)
+
+	// Messages are removed once acknowledged now, and with all of them acknowledged
+	// the ones no consumer is interested in are too.
+	msgs, err = psub.Fetch(5)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 5)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if si, err := js.StreamInfo("TEST"); err != nil {
+			return err
+		} else if si.State.Msgs != 0 {
+			return fmt.Errorf("expected no messages, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	// And back to limits, which keeps messages around.
+	cfg.Retention = nats.LimitsPolicy
+	_, err = js.UpdateStream(cfg)
+	require_NoError(t, err)
+	_, err = js.Publish("foo.bar", []byte("OK"))
+	require_NoError(t, err)
+	msgs, err = psub.Fetch(1)
+	require_NoError(t, err)
+	require_NoError(t, msgs[0].AckSync())
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+}
+
+func TestJetStreamServerEncryptedSnapshots(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		cstr   string
+		cipher StoreCipher
+	}{
+		{"ChaCha", "chacha", ChaCha},
+		{"AES", "aes", AES},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tmpl := `
+				listen: 127.0.0.1:-1
+				jetstream: {key: %q, cipher: %s, encrypt_snapshots: true, store_dir: %q}
+			`
+			conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, "s3cr3t!!", c.cstr, t.TempDir())))
+			s, opts := RunServerWithConfig(conf)
+			defer s.Shutdown()
+			require_True(t, opts.JetStreamEncryptSnapshots)
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+			require_NoError(t, err)
+			for i := 0; i < 10; i++ {
+				_, err = js.Publish("foo", []byte("ENCRYPTED PAYLOAD!!"))
+				require_NoError(t, err)
+			}
+
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			require_NoError(t, err)
+			cfg := mset.config()
+			sr, err := mset.snapshot(5*time.Second, false, true)
+			require_NoError(t, err)
+			snapshot, err := io.ReadAll(sr.Reader)
+			require_NoError(t, err)
+
+			// The snapshot is encrypted.
+			require_True(t, bytes.HasPrefix(snapshot, snapshotEncMagic))
+			require_Equal(t, StoreCipher(snapshot[len(snapshotEncMagic)]), c.cipher)
+			_, err = io.ReadAll(s2.NewReader(bytes.NewReader(snapshot)))
+			require_Error(t, err)
+
+			// And restores with the key of the server.
+			require_NoError(t, mset.delete())
+			mset, err = s.GlobalAccount().RestoreStream(&cfg, bytes.NewReader(snapshot))
+			require_NoError(t, err)
+			require_Equal(t, mset.state().Msgs, 10)
+			sm, err := mset.getMsg(1)
+			require_NoError(t, err)
+			require_Equal(t, string(sm.Data), "ENCRYPTED PAYLOAD!!")
+			require_NoError(t, mset.delete())
+
+			// But not with a different one.
+			s.Shutdown()
+			conf = createConfFile(t, []byte(fmt.Sprintf(tmpl, "0th3r!!", c.cstr, t.TempDir())))
+			s, _ = RunServerWithConfig(conf)
+			defer s.Shutdown()
+			_, err = s.GlobalAccount().RestoreStream(&cfg, bytes.NewReader(snapshot))
+			require_Error(t, err)
+			require_True(t, errors.Is(err, errSnapshotEncrypted))
+		})
+	}
+}
+
+func TestJetStreamStreamTiering(t *testing.T) {
+	var mu sync.Mutex
+	objs := make(map[string][]byte)
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		key := r.URL.EscapedPath()
+		switch r.Method {
+		case http.MethodPut:
+			objs[key], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			data, ok := objs[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objs, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer s3.Close()
+	numObjs := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(objs)
+	}
+
+	old := tierCheckInterval
+	tierCheckInterval = 50 * time.Millisecond
+	defer func() { tierCheckInterval = old }()
+
+	// Tiering requires a tier store.
+	sn := RunBasicJetStreamServer(t)
+	defer sn.Shutdown()
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Tiering: &StreamTiering{MaxLocalBytes: 1}}
+	_, apiErr := sn.checkStreamCfg(&cfg, sn.GlobalAccount(), false)
+	require_Error(t, apiErr, NewJSStreamInvalidConfigError(errors.New("tiering requires a tier store configured on the server")))
+	sn.Shutdown()
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, tier: {endpoint: %q, bucket: "blocks", prefix: "nats", access_key: "AK", secret_key: "SK"}}
+	`, t.TempDir(), s3.URL)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxBytes: 120_000})
+	require_NoError(t, err)
+	msg := make([]byte, 10_000)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+	require_Equal(t, numObjs(), 0)
+
+	// Once tiered all but the last block are offloaded.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	ncfg := mset.config()
+	ncfg.Tiering = &StreamTiering{MaxLocalBytes: 1}
+	require_NoError(t, mset.update(&ncfg))
+	fs := mset.store.(*fileStore)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if n, nblks := numObjs(), fs.numMsgBlocks(); n != nblks-1 {
+			return fmt.Errorf("expected %d offloaded blocks, got %d", nblks-1, n)
+		}
+		return nil
+	})
+	mu.Lock()
+	for key := range objs {
+		require_True(t, strings.HasPrefix(key, "/blocks/nats/%24G/TEST/"))
+	}
+	mu.Unlock()
+
+	// And messages are fetched back on demand.
+	for seq := uint64(1); seq <= 10; seq++ {
+		rsm, err := js.GetMsg("TEST", seq)
+		require_NoError(t, err)
+		require_Len(t, len(rsm.Data), len(msg))
+	}
+
+	// Removing the stream removes the offloaded blocks.
+	require_NoError(t, js.DeleteStream("TEST"))
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if n := numObjs(); n > 0 {
+			return fmt.Errorf("expected no offloaded blocks, got %d", n)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamStreamDurability(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	for _, test := range []struct {
+		cfg StreamConfig
+		err string
+	}{
+		{StreamConfig{Name: "M", Storage: MemoryStorage, Durability: &StreamDurability{Mode: DurabilitySync}}, "durability requires file storage"},
+		{StreamConfig{Name: "F", Storage: FileStorage, Durability: &StreamDurability{Mode: "never"}}, "durability mode \"never\" is invalid"},
+		{StreamConfig{Name: "F", Storage: FileStorage, Durability: &StreamDurability{Mode: DurabilityAsync, Interval: -time.Second}}, "durability interval can not be negative"},
+		{StreamConfig{Name: "F", Storage: FileStorage, Durability: &StreamDurability{Mode: DurabilityInterval, Interval: 2 * time.Hour}}, "sync interval must be between"},
+	} {
+		_, apiErr := s.checkStreamCfg(&test.cfg, acc, false)
+		require_Error(t, apiErr)
+		require_Contains(t, apiErr.Error(), test.err)
+	}
+
+	info := func(name string) *StreamInfo {
+		t.Helper()
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, name), nil, time.Second)
+		require_NoError(t, err)
+		var si JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &si))
+		require_True(t, si.Error == nil)
+		return si.StreamInfo
+	}
+
+	// Without a durability of its own the stream runs with the server settings.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	si := info("TEST")
+	require_True(t, si.Durability != nil)
+	require_Equal(t, si.Durability.Mode, DurabilityInterval)
+	require_Equal(t, si.Durability.Interval, defaultSyncInterval)
+
+	mset, err := acc.lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+
+	update := func(d *StreamDurability) {
+		t.Helper()
+		cfg := mset.config()
+		cfg.Durability = d
+		require_NoError(t, mset.update(&cfg))
+		for i := 0; i < 10; i++ {
+			_, err := js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+		}
+	}
+
+	// Async flushes in the background and syncs within the window.
+	update(&StreamDurability{Mode: DurabilityAsync, Interval: 100 * time.Millisecond})
+	si = info("TEST")
+	require_Equal(t, si.Config.Durability.Mode, DurabilityAsync)
+	require_Equal(t, *si.Durability, StreamDurability{Mode: DurabilityAsync, Interval: 100 * time.Millisecond})
+	fs.mu.RLock()
+	fip, lmb := fs.fip, fs.lmb
+	fs.mu.RUnlock()
+	require_False(t, fip)
+	lmb.mu.RLock()
+	flusher := lmb.flusher
+	lmb.mu.RUnlock()
+	require_True(t, flusher)
+
+	// Sync syncs every write.
+	update(&StreamDurability{Mode: DurabilitySync})
+	si = info("TEST")
+	require_Equal(t, *si.Durability, StreamDurability{Mode: DurabilitySync})
+	fs.mu.RLock()
+	fip, lmb = fs.fip, fs.lmb
+	fs.mu.RUnlock()
+	require_True(t, fip)
+	lmb.mu.RLock()
+	syncAlways := lmb.syncAlways
+	lmb.mu.RUnlock()
+	require_True(t, syncAlways)
+
+	// And back to the server settings.
+	update(nil)
+	si = info("TEST")
+	require_Equal(t, *si.Durability, StreamDurability{Mode: DurabilityInterval, Interval: defaultSyncInterval})
+	require_Equal(t, si.State.Msgs, 30)
+
+	// The durability is kept on restart.
+	update(&StreamDurability{Mode: DurabilityAsync})
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, _ = jsClientConnect(t, s)
+	defer nc.Close()
+	si = info("TEST")
+	require_Equal(t, *si.Durability, StreamDurability{Mode: DurabilityAsync, Interval: defaultSyncInterval})
+	require_Equal(t, si.State.Msgs, 40)
+}
+
+func TestJetStreamSourcesStartingSequenceBySubject(t *testing.T) {
+	for _, st := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(st.String(), func(t *testing.T) {
+			s := RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			for _, name := range []string{"A", "B"} {
+				_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{strings.ToLower(name) + ".>"}})
+				require_NoError(t, err)
+			}
+			addStream(t, nc, &StreamConfig{
+				Name:     "M",
+				Subjects: []string{"local.>"},
+				Storage:  st,
+				Sources: []*StreamSource{
+					{Name: "A", FilterSubject: "a.>"},
+					{Name: "B", SubjectTransforms: []SubjectTransformConfig{{Source: "b.*", Destination: "from.b.{{wildcard(1)}}"}}},
+				},
+			})
+
+			for i := 0; i < 10; i++ {
+				_, err := js.Publish(fmt.Sprintf("a.%d", i%3), nil)
+				require_NoError(t, err)
+				_, err = js.Publish(fmt.Sprintf("b.%d", i%2), nil)
+				require_NoError(t, err)
+			}
+			checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+				si, err := js.StreamInfo("M")
+				require_NoError(t, err)
+				if si.State.Msgs != 20 {
+					return fmt.Errorf("expected 20 msgs, got %d", si.State.Msgs)
+				}
+				return nil
+			})
+			// Messages stored on other subjects are skipped over.
+			for i := 0; i < 1000; i++ {
+				_, err := js.Publish(fmt.Sprintf("local.%d", i%10), nil)
+				require_NoError(t, err)
+			}
+
+			mset, err := s.GlobalAccount().lookupStream("M")
+			require_NoError(t, err)
+			require_Equal(t, len(mset.sourcesSubjectFilters()), 2)
+
+			mset.mu.Lock()
+			mset.startingSequenceForSources()
+			sseqs := make(map[string]uint64)
+			for _, si := range mset.sources {
+				sseqs[si.name] = si.sseq
+			}
+			mset.mu.Unlock()
+			require_Equal(t, sseqs["A"], 10)
+			require_Equal(t, sseqs["B"], 10)
+		})
+	}
+}
+
+func TestJetStreamStreamCompactedAdvisory(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Retention: nats.WorkQueuePolicy})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	// Small blocks so that the messages span many.
+	fs.mu.Lock()
+	fs.fcfg.BlockSize = 1024
+	fs.mu.Unlock()
+
+	msg := make([]byte, 128)
+	crand.Read(msg)
+	for i := 0; i < 100; i++ {
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+
+	// Acknowledged messages leave holes behind.
+	sub, err := js.PullSubscribe("foo", "C")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(100)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 100)
+	for i, m := range msgs {
+		if (i+1)%4 != 0 {
+			require_NoError(t, m.AckSync())
+		}
+	}
+
+	asub, err := nc.SubscribeSync(JSAdvisoryStreamCompactedPre + ".TEST")
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	fs.syncBlocks()
+
+	m, err := asub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSStreamCompactedAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Type, JSStreamCompactedAdvisoryType)
+	require_Equal(t, adv.Stream, "TEST")
+	require_True(t, adv.Blocks > 0)
+	require_True(t, adv.Reclaimed > 0)
+	require_Equal(t, adv.TotalReclaimed, adv.Reclaimed)
+
+	state := mset.state()
+	require_Equal(t, state.Msgs, 25)
+	require_Equal(t, state.ReclaimedBytes, adv.Reclaimed)
+}
+
+func TestJetStreamStreamInfoDeletedRanges(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, st := range []nats.StorageType{nats.FileStorage, nats.MemoryStorage} {
+		t.Run(st.String(), func(t *testing.T) {
+			_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}, Storage: st})
+			require_NoError(t, err)
+			defer js.DeleteStream("TEST")
+
+			for i := 0; i < 20; i++ {
+				_, err = js.Publish(fmt.Sprintf("foo.%d", i%4), nil)
+				require_NoError(t, err)
+			}
+			for _, seq := range []uint64{3, 4, 5, 10, 20} {
+				require_NoError(t, js.DeleteMsg("TEST", seq))
+			}
+
+			getInfo := func(req *JSApiStreamInfoRequest) *StreamInfo {
+				t.Helper()
+				b, err := json.Marshal(req)
+				require_NoError(t, err)
+				resp, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), b, time.Second)
+				require_NoError(t, err)
+				var si StreamInfo
+				require_NoError(t, json.Unmarshal(resp.Data, &si))
+				return &si
+			}
+
+			// Only when asked for.
+			si := getInfo(&JSApiStreamInfoRequest{})
+			require_Equal(t, si.State.NumDeleted, 5)
+			require_Len(t, len(si.State.DeletedRanges), 0)
+
+			si = getInfo(&JSApiStreamInfoRequest{DeletedRanges: true, SubjectsFilter: ">"})
+			require_Equal(t, si.State.NumSubjects, 4)
+			require_Equal(t, len(si.State.Subjects), 4)
+			require_Equal(t, si.State.Subjects["foo.0"], 4)
+			require_True(t, reflect.DeepEqual(si.State.DeletedRanges, []SequenceRange{
+				{First: 3, Last: 5},
+				{First: 10, Last: 10},
+				{First: 20, Last: 20},
+			}))
+		})
+	}
+}
+
+func TestJetStreamStreamScrub(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, st := range []nats.StorageType{nats.FileStorage, nats.MemoryStorage} {
+		_, err := js.AddStream(&nats.StreamConfig{Name: st.String(), Subjects: []string{st.String()}, Storage: st})
+		require_NoError(t, err)
+		for i := 0; i < 10; i++ {
+			_, err = js.Publish(st.String(), []byte("OK"))
+			require_NoError(t, err)
+		}
+	}
+
+	scrub := func(stream string) *JSApiStreamScrubResponse {
+		t.Helper()
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamScrubT, stream), nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamScrubResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	sub, err := nc.SubscribeSync(JSAdvisoryStreamScrubPre + ".>")
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	resp := scrub("File")
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Started)
+
+	m, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSStreamScrubAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Type, JSStreamScrubAdvisoryType)
+	require_Equal(t, adv.Stream, "File")
+	require_Equal(t, adv.Server, s.Name())
+	require_Equal(t, adv.Result.Msgs, 10)
+	require_Equal(t, adv.Result.NumCorrupt, 0)
+
+	resp = scrub("Memory")
+	require_Error(t, resp.ToError(), NewJSStreamScrubNotSupportedError())
+
+	resp = scrub("NOT-EXIST")
+	require_Error(t, resp.ToError(), NewJSStreamNotFoundError())
+}
+
+func TestJetStreamMemoryStreamSpillToDisk(t *testing.T) {
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 4KB, max_file_store: 1MB, store_dir: %q}
+	`, storeDir)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Only memory streams can spill over.
+	_, apiErr := addStreamWithError(t, nc, &StreamConfig{Name: "FILE", Storage: FileStorage, SpillToDisk: true})
+	require_Error(t, apiErr, NewJSStreamInvalidConfigError(errors.New("spill to disk requires memory storage")))
+
+	si := addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, SpillToDisk: true})
+	require_False(t, si.Spilled)
+
+	sub, err := js.PullSubscribe("foo", "d")
+	require_NoError(t, err)
+
+	// Messages that do not fit in memory while spilling are rejected, so retry those.
+	msg := bytes.Repeat([]byte("Z"), 100)
+	for i := 0; i < 100; i++ {
+		checkFor(t, 5*time.Second, 10*time.Millisecond, func() error {
+			_, err := js.Publish("foo", msg)
+			return err
+		})
+	}
+
+	nsi, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, nsi.State.Msgs, 100)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, mset.isSpilled())
+	mset.mu.RLock()
+	_, ok := mset.store.(*fileStore)
+	stype := mset.stype
+	mset.mu.RUnlock()
+	require_True(t, ok)
+	require_Equal(t, stype, FileStorage)
+
+	// Reported in the stream info.
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.StreamInfo.Spilled)
+	require_Equal(t, resp.StreamInfo.Config.Storage, MemoryStorage)
+
+	// Our usage moved over to file storage.
+	ai, err := js.AccountInfo()
+	require_NoError(t, err)
+	require_Equal(t, ai.Memory, 0)
+	require_True(t, ai.Store > 0)
+
+	// Nothing was lost and the consumer keeps going.
+	msgs, err := sub.Fetch(100, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 100)
+	for i, m := range msgs {
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		require_Equal(t, meta.Sequence.Stream, uint64(i+1))
+		require_True(t, bytes.Equal(m.Data, msg))
+	}
+
+	// The spill over is removed with the stream.
+	dir := filepath.Join(storeDir, JetStreamStoreDir, globalAccountName, spillDir, "TEST")
+	_, err = os.Stat(dir)
+	require_NoError(t, err)
+	require_NoError(t, js.DeleteStream("TEST"))
+	_, err = os.Stat(dir)
+	require_True(t, os.IsNotExist(err))
+}
+
+func TestJetStreamMemoryStreamSpillToDiskNoRoom(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 4KB, max_file_store: 2KB, store_dir: %q}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, SpillToDisk: true})
+
+	// What the stream holds does not fit in file storage, so it stays in memory.
+	msg := bytes.Repeat([]byte("Z"), 100)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = js.Publish("foo", msg)
+	}
+	require_Error(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		mset.mu.RLock()
+		defer mset.mu.RUnlock()
+		if mset.spilling {
+			return errors.New("still spilling")
+		}
+		return nil
+	})
+	require_False(t, mset.isSpilled())
+	mset.mu.RLock()
+	_, ok := mset.store.(*memStore)
+	mset.mu.RUnlock()
+	require_True(t, ok)
+}
+
+func TestJetStreamStreamGroupCommit(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Durability: &StreamDurability{Mode: DurabilitySync}})
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	// Hold the stream so the messages queue up and are stored as a group.
+	const toSend = 500
+	mset.mu.Lock()
+	futures := make([]nats.PubAckFuture, 0, toSend)
+	for i := 0; i < toSend; i++ {
+		pa, err := js.PublishAsync("foo", []byte("OK"))
+		require_NoError(t, err)
+		futures = append(futures, pa)
+	}
+	checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		if n := mset.msgs.len(); n < toSend-1 {
+			return fmt.Errorf("only %d queued", n)
+		}
+		return nil
+	})
+	mset.mu.Unlock()
+
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive all acks")
+	}
+	for i, f := range futures {
+		select {
+		case pa := <-f.Ok():
+			require_Equal(t, pa.Sequence, uint64(i+1))
+		case err := <-f.Err():
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Nothing left behind in a group.
+	mset.mu.RLock()
+	gc := mset.gcommit
+	mset.mu.RUnlock()
+	require_True(t, gc == nil)
+
+	// Everything made it to disk.
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, toSend)
+}
+
+type failingGroupCommitter struct{}
+
+func (failingGroupCommitter) beginGroupCommit() bool { return true }
+func (failingGroupCommitter) commitGroup() error     { return errors.New("sync failed") }
+
+func TestJetStreamStreamGroupCommitFailure(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{
+		Name:        "TEST",
+		Subjects:    []string{"foo"},
+		Storage:     FileStorage,
+		AllowRollup: true,
+		RePublish:   &RePublish{Source: ">", Destination: "rp.>"},
+	})
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("OK"), nats.MsgId("0"))
+	require_NoError(t, err)
+
+	sub := natsSubSync(t, nc, "reply.*")
+	rsub := natsSubSync(t, nc, "rp.>")
+	require_NoError(t, nc.Flush())
+
+	// Store a group that fails to sync, ending with a rollup.
+	mset.mu.Lock()
+	mset.gcommit = &groupCommit{store: failingGroupCommitter{}, seq: mset.lseq, lmsgId: mset.lmsgId}
+	mset.mu.Unlock()
+	for i := 1; i <= 3; i++ {
+		hdr := genHeader(nil, JSMsgId, strconv.Itoa(i))
+		if i == 3 {
+			hdr = genHeader(hdr, JSMsgRollup, JSMsgRollupAll)
+		}
+		require_NoError(t, mset.processJetStreamMsg("foo", fmt.Sprintf("reply.%d", i), hdr, []byte("OK"), 0, 0, nil))
+	}
+	mset.commitGroup()
+
+	for i := 1; i <= 3; i++ {
+		msg := natsNexMsg(t, sub, time.Second)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error != nil)
+	}
+	// Nothing acted on the messages of the group, they were not republished nor rolled up.
+	_, err = rsub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// The messages of the group are gone, and their retries are not duplicates.
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+	for i := 1; i <= 3; i++ {
+		pa, err := js.Publish("foo", []byte("OK"), nats.MsgId(strconv.Itoa(i)))
+		require_NoError(t, err)
+		require_False(t, pa.Duplicate)
+	}
+	pa, err := js.Publish("foo", []byte("OK"), nats.MsgId("0"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 4)
+}
+
+func TestJetStreamStreamUpdateBlockSize(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		cfg *StreamConfig
+		err string
+	}{
+		{&StreamConfig{Name: "M", Storage: MemoryStorage, BlockSize: 64 * 1024}, "block size requires file storage"},
+		{&StreamConfig{Name: "F", Storage: FileStorage, BlockSize: 1024}, "block size must be between"},
+		{&StreamConfig{Name: "F", Storage: FileStorage, BlockSize: 64 * 1024 * 1024}, "block size must be between"},
+	} {
+		_, apiErr := addStreamWithError(t, nc, test.cfg)
+		require_Error(t, apiErr)
+		require_Contains(t, apiErr.Error(), test.err)
+	}
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxBytes: 100 * 1000}
+	addStream(t, nc, cfg)
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	blockSize := func() uint64 {
+		mset.mu.RLock()
+		defer mset.mu.RUnlock()
+		return mset.store.(*fileStore).fileStoreConfig().BlockSize
+	}
+	require_Equal(t, blockSize(), FileStoreMinBlkSize)
+
+	// Tuned again for the new limits.
+	cfg.MaxBytes = 1024 * 1024 * 1024
+	updateStream(t, nc, cfg)
+	require_Equal(t, blockSize(), FileStoreMaxBlkSize)
+
+	// An explicit block size takes precedence.
+	cfg.BlockSize = 256 * 1024
+	updateStream(t, nc, cfg)
+	require_Equal(t, blockSize(), 256*1024)
+
+	// Unrelated updates keep the block size.
+	cfg.Description = "updated"
+	mset.mu.RLock()
+	mset.store.(*fileStore).setBlockSize(128 * 1024)
+	mset.mu.RUnlock()
+	updateStream(t, nc, cfg)
+	require_Equal(t, blockSize(), 128*1024)
+}
+
+func TestJetStreamStreamQuotaWarning(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			$SYS: { users: [{user: admin, password: s3cr3t}] }
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		cfg *StreamConfig
+		err string
+	}{
+		{&StreamConfig{Name: "Q", Storage: FileStorage, MaxMsgs: 10, QuotaWarning: 100}, "quota warning must be a percentage between 1 and 99"},
+		{&StreamConfig{Name: "Q", Storage: FileStorage, MaxMsgs: 10, QuotaWarning: -1}, "quota warning must be a percentage between 1 and 99"},
+		{&StreamConfig{Name: "Q", Storage: FileStorage, QuotaWarning: 80}, "quota warning requires max bytes or max messages"},
+	} {
+		_, apiErr := addStreamWithError(t, nc, test.cfg)
+		require_Error(t, apiErr)
+		require_Contains(t, apiErr.Error(), test.err)
+	}
+
+	ncSys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t"))
+	defer ncSys.Close()
+	sub := natsSubSync(t, ncSys, JSAdvisoryStreamQuotaWarningPre+".>")
+	require_NoError(t, ncSys.Flush())
+
+	addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxMsgs: 10, QuotaWarning: 80})
+
+	publish := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			_, err := js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+		}
+	}
+	publish(7)
+	_, err := sub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Crossing the threshold warns once.
+	publish(5)
+	m, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, JSAdvisoryStreamQuotaWarningPre+"."+globalAccountName+".TEST")
+	var adv JSStreamQuotaWarningAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Type, JSStreamQuotaWarningAdvisoryType)
+	require_Equal(t, adv.Account, globalAccountName)
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.Limit, "max_msgs")
+	require_Equal(t, adv.Threshold, 80)
+	require_Equal(t, adv.Used, 8)
+	require_Equal(t, adv.Max, 10)
+	_, err = sub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Warns again once back below the threshold.
+	require_NoError(t, js.PurgeStream("TEST"))
+	publish(8)
+	m, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_Equal(t, adv.Used, 8)
+}
+
+func TestJetStreamStreamInfoStorageStats(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{Name: "F", Subjects: []string{"f"}, Storage: FileStorage, Durability: &StreamDurability{Mode: DurabilitySync}})
+	addStream(t, nc, &StreamConfig{Name: "M", Subjects: []string{"m"}, Storage: MemoryStorage})
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("f", []byte("OK"))
+		require_NoError(t, err)
+		_, err = js.Publish("m", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	info := func(stream string, stats bool) *StreamInfo {
+		t.Helper()
+		req, err := json.Marshal(&JSApiStreamInfoRequest{StorageStats: stats})
+		require_NoError(t, err)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, stream), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.StreamInfo
+	}
+
+	// Only when asked for.
+	require_True(t, info("F", false).StorageStats == nil)
+
+	// Read the messages back once the cache is gone.
+	mset, err := s.GlobalAccount().lookupStream("F")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.RLock()
+	for _, mb := range fs.blks {
+		mb.mu.Lock()
+		mb.clearCacheAndOffset()
+		mb.mu.Unlock()
+	}
+	fs.mu.RUnlock()
+	for seq := uint64(1); seq <= 10; seq++ {
+		_, err = js.GetMsg("F", seq)
+		require_NoError(t, err)
+	}
+
+	stats := info("F", true).StorageStats
+	require_True(t, stats != nil)
+	require_Equal(t, stats.Writes, 10)
+	require_True(t, stats.WriteLatency > 0)
+	require_True(t, stats.MaxWriteLatency >= stats.WriteLatency)
+	// Synced every write.
+	require_True(t, stats.Syncs >= 10)
+	require_True(t, stats.SyncLatency > 0)
+	require_Equal(t, stats.CacheMisses, 1)
+	require_Equal(t, stats.CacheHits, 9)
+	require_Equal(t, stats.CacheHitRate, 0.9)
+	require_Equal(t, stats.CachedBlocks, 1)
+	require_True(t, stats.CacheBytes > 0)
+
+	// Not kept for memory storage.
+	require_True(t, info("M", true).StorageStats == nil)
+}
+
+func TestJetStreamStreamPartitions(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, apiErr := addStreamWithError(t, nc, &StreamConfig{Name: "M", Subjects: []string{"m"}, Storage: MemoryStorage, PartitionInterval: time.Hour})
+	require_True(t, apiErr != nil)
+	require_Contains(t, apiErr.Description, "requires file storage")
+	_, apiErr = addStreamWithError(t, nc, &StreamConfig{Name: "F", Subjects: []string{"f"}, Storage: FileStorage, PartitionInterval: time.Second})
+	require_True(t, apiErr != nil)
+	require_Contains(t, apiErr.Description, "can not be less than")
+
+	addStream(t, nc, &StreamConfig{Name: "F", Subjects: []string{"f"}, Storage: FileStorage, PartitionInterval: time.Hour, MaxAge: 2 * time.Hour})
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("f", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	info := func(partitions bool) *StreamInfo {
+		t.Helper()
+		req, err := json.Marshal(&JSApiStreamInfoRequest{Partitions: partitions})
+		require_NoError(t, err)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "F"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.StreamInfo
+	}
+
+	// Only when asked for.
+	require_Len(t, len(info(false).Partitions), 0)
+	parts := info(true).Partitions
+	require_Len(t, len(parts), 1)
+	require_Equal(t, parts[0].FirstSeq, 1)
+	require_Equal(t, parts[0].LastSeq, 10)
+	require_Equal(t, parts[0].Msgs, 10)
+	require_Equal(t, parts[0].Blocks, 1)
+	require_False(t, parts[0].Sealed)
+	require_Equal(t, parts[0].Dir, filepath.Join(msgDir, parts[0].Start.Format(partitionDirLayout)))
+	mset, err := s.GlobalAccount().lookupStream("F")
+	require_NoError(t, err)
+	blks, err := filepath.Glob(filepath.Join(mset.store.(*fileStore).fcfg.StoreDir, parts[0].Dir, "*.blk"))
+	require_NoError(t, err)
+	require_Len(t, len(blks), 1)
+	require_True(t, parts[0].Start.Equal(time.Now().Truncate(time.Hour)) || parts[0].Start.Equal(time.Now().Add(-time.Hour).Truncate(time.Hour)))
+}
+
+func TestJetStreamAccountSyncInterval(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			A: { jetstream: { sync_interval: "5s" }, users: [{user: a, password: pwd}] }
+			B: { jetstream: enabled, users: [{user: b, password: pwd}] }
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	for _, test := range []struct {
+		user     string
+		interval time.Duration
+	}{
+		{"a", 5 * time.Second},
+		{"b", defaultSyncInterval},
+	} {
+		nc, _ := jsClientConnect(t, s, nats.UserInfo(test.user, "pwd"))
+		defer nc.Close()
+
+		si := addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+		require_True(t, si.Durability != nil)
+		require_Equal(t, si.Durability.Interval, test.interval)
+
+		// The interval of the stream itself wins.
+		si = updateStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage,
+			Durability: &StreamDurability{Mode: DurabilityInterval, Interval: 10 * time.Minute}})
+		require_Equal(t, si.Durability.Interval, 10*time.Minute)
+	}
+
+	// Account intervals are validated.
+	conf = createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: enabled
+		accounts: { A: { jetstream: { sync_interval: "2h" } } }
+	`))
+	_, err := ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), "sync interval must be between")
+}
+
+func TestJetStreamPreallocateBlocks(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {preallocate: true, store_dir: %q}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+	require_True(t, opts.JetStreamPreallocate)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	require_True(t, fs.fileStoreConfig().Preallocate)
+	require_Equal(t, mset.state().Msgs, 10)
+}
+
+func TestJetStreamAccountReadAhead(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			A: { jetstream: { read_ahead: 1MB }, users: [{user: a, password: pwd}] }
+			B: { jetstream: enabled, users: [{user: b, password: pwd}] }
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	for _, test := range []struct {
+		user, account string
+		budget        int64
+	}{
+		{"a", "A", 1024 * 1024},
+		{"b", "B", 0},
+	} {
+		nc, _ := jsClientConnect(t, s, nats.UserInfo(test.user, "pwd"))
+		defer nc.Close()
+
+		addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+		acc, err := s.lookupAccount(test.account)
+		require_NoError(t, err)
+		mset, err := acc.lookupStream("TEST")
+		require_NoError(t, err)
+		budget := mset.store.(*fileStore).fileStoreConfig().readAhead
+		if test.budget == 0 {
+			require_True(t, budget == nil)
+		} else {
+			require_Equal(t, budget.max, test.budget)
+		}
+	}
+}
+
+func TestJetStreamStreamSecureErase(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		cfg StreamConfig
+		err string
+	}{
+		{StreamConfig{Name: "M", Subjects: []string{"m"}, Storage: MemoryStorage, SecureErase: true}, "requires file storage"},
+		{StreamConfig{Name: "C", Subjects: []string{"c"}, Storage: FileStorage, Compression: S2Compression, SecureErase: true}, "can not be used with compression"},
+	} {
+		_, apiErr := addStreamWithError(t, nc, &test.cfg)
+		require_True(t, apiErr != nil)
+		require_Contains(t, apiErr.Description, test.err)
+	}
+
+	si := addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxMsgs: 5, SecureErase: true})
+	require_True(t, si.Config.SecureErase)
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("foo", []byte(fmt.Sprintf("SECRET-%d", i)))
+		require_NoError(t, err)
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.checkAndFlushAllBlocks()
+	buf, err := os.ReadFile(filepath.Join(fs.fcfg.StoreDir, msgDir, fmt.Sprintf(blkScan, 1)))
+	require_NoError(t, err)
+	require_False(t, bytes.Contains(buf, []byte("SECRET-0")))
+	require_True(t, bytes.Contains(buf, []byte("SECRET-9")))
+}
+
+func TestJetStreamStreamRepairOnRecovery(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	si := addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+	require_True(t, si.Repair == nil)
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	mdir := filepath.Join(mset.store.(*fileStore).fcfg.StoreDir, msgDir)
+	nc.Close()
+
+	// Truncate the last message and drop the stream state so the block has to be rebuilt.
+	u, _ := url.Parse(s.ClientURL())
+	port, _ := strconv.Atoi(u.Port())
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	os.Remove(filepath.Join(mdir, streamStreamStateFile))
+	fn := filepath.Join(mdir, fmt.Sprintf(blkScan, 1))
+	fi, err := os.Stat(fn)
+	require_NoError(t, err)
+	require_NoError(t, os.Truncate(fn, fi.Size()-5))
+	s = RunJetStreamServerOnPort(port, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	nsi, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, nsi.State.Msgs, 9)
+
+	var resp JSApiStreamInfoResponse
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Repair != nil)
+	require_Equal(t, resp.Repair.LastSeq, 9)
+	require_True(t, resp.Repair.Lost != nil)
+}
+
+func TestJetStreamIndexDir(t *testing.T) {
+	sd, idx, aidx := t.TempDir(), t.TempDir(), t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, index_dir: %q}
+		accounts: {
+			A: { jetstream: { index_dir: %q }, users: [{user: a, password: pwd}] }
+			B: { jetstream: enabled, users: [{user: b, password: pwd}] }
+		}
+	`, sd, idx, aidx)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	for _, test := range []struct {
+		user, account, root string
+	}{
+		{"a", "A", aidx},
+		{"b", "B", idx},
+	} {
+		nc, js := jsClientConnect(t, s, nats.UserInfo(test.user, "pwd"))
+		defer nc.Close()
+
+		addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+		for i := 0; i < 10; i++ {
+			_, err := js.Publish("foo", []byte("ok"))
+			require_NoError(t, err)
+		}
+		acc, err := s.lookupAccount(test.account)
+		require_NoError(t, err)
+		mset, err := acc.lookupStream("TEST")
+		require_NoError(t, err)
+		fs := mset.store.(*fileStore)
+		idir := filepath.Join(test.root, test.account, streamsDir, "TEST")
+		require_Equal(t, fs.fileStoreConfig().IndexDir, idir)
+		require_Equal(t, fs.fileStoreConfig().StoreDir, filepath.Join(sd, JetStreamStoreDir, test.account, streamsDir, "TEST"))
+
+		// Snapshots hold the index, which is moved back into place when restored.
+		cfg := mset.config()
+		sr, err := mset.snapshot(5*time.Second, false, true)
+		require_NoError(t, err)
+		snapshot, err := io.ReadAll(sr.Reader)
+		require_NoError(t, err)
+		_, err = os.Stat(filepath.Join(idir, streamStreamStateFile))
+		require_NoError(t, err)
+		require_NoError(t, mset.delete())
+		_, err = os.Stat(idir)
+		require_True(t, os.IsNotExist(err))
+
+		mset, err = acc.RestoreStream(&cfg, bytes.NewReader(snapshot))
+		require_NoError(t, err)
+		require_Equal(t, mset.state().Msgs, 10)
+		_, err = os.Stat(filepath.Join(idir, streamStreamStateFile))
+		require_NoError(t, err)
+		_, err = os.Stat(filepath.Join(mset.store.(*fileStore).fileStoreConfig().StoreDir, msgDir, streamStreamStateFile))
+		require_True(t, os.IsNotExist(err))
+	}
+}
+
+func TestJetStreamStreamTruncate(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	truncate := func(stream string, seq uint64) *JSApiStreamTruncateResponse {
+		t.Helper()
+		req, err := json.Marshal(&JSApiStreamTruncateRequest{Sequence: seq})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamTruncateT, stream), req, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamTruncateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return &resp
+	}
+
+	addStream(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+	for i := 1; i <= 10; i++ {
+		_, err := js.Publish("foo", []byte("OLD"), nats.MsgId(fmt.Sprintf("ID-%d", i)))
+		require_NoError(t, err)
+	}
+	_, err := js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(8)
+	require_NoError(t, err)
+	for _, m := range msgs[:3] {
+		require_NoError(t, m.AckSync())
+	}
+	// Another consumer acknowledges past the sequence we truncate at.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "D", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	dsub, err := js.PullSubscribe("foo", "D", nats.Bind("TEST", "D"))
+	require_NoError(t, err)
+	msgs, err = dsub.Fetch(8)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	resp := truncate("TEST", 0)
+	require_True(t, resp.Error != nil)
+	require_Equal(t, resp.Error.ErrCode, uint16(JSStreamTruncateErrF))
+
+	resp = truncate("TEST", 5)
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Success)
+	require_Equal(t, resp.Removed, 5)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 5)
+	require_Equal(t, si.State.LastSeq, 5)
+
+	// The consumer only has the remaining messages pending.
+	ci, err := js.ConsumerInfo("TEST", "C")
+	require_NoError(t, err)
+	require_Equal(t, ci.Delivered.Stream, 5)
+	require_Equal(t, ci.AckFloor.Stream, 3)
+	require_Equal(t, ci.NumAckPending, 2)
+	ci, err = js.ConsumerInfo("TEST", "D")
+	require_NoError(t, err)
+	require_Equal(t, ci.Delivered.Stream, 5)
+	require_Equal(t, ci.AckFloor.Stream, 5)
+	require_Equal(t, ci.NumAckPending, 0)
+
+	// The sequences and message ids of the removed messages are used again.
+	pa, err := js.Publish("foo", []byte("NEW"), nats.MsgId("ID-6"))
+	require_NoError(t, err)
+	require_False(t, pa.Duplicate)
+	require_Equal(t, pa.Sequence, 6)
+	pa, err = js.Publish("foo", []byte("NEW"), nats.MsgId("ID-5"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+
+	// The consumers keep where they were moved back to over a restart.
+	u, err := url.Parse(s.ClientURL())
+	require_NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require_NoError(t, err)
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(port, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, durable := range []string{"C", "D"} {
+		sub, err = js.PullSubscribe("foo", durable, nats.Bind("TEST", durable))
+		require_NoError(t, err)
+		msgs, err = sub.Fetch(1)
+		require_NoError(t, err)
+		require_Equal(t, string(msgs[0].Data), "NEW")
+		meta, err := msgs[0].Metadata()
+		require_NoError(t, err)
+		require_Equal(t, meta.Sequence.Stream, 6)
+	}
+
+	// Nothing to do past the last sequence, and truncating before the first is a purge.
+	resp = truncate("TEST", 100)
+	require_True(t, resp.Success)
+	require_Equal(t, resp.Removed, 0)
+	err = js.PurgeStream("TEST", &nats.StreamPurgeRequest{Sequence: 3})
+	require_NoError(t, err)
+	resp = truncate("TEST", 1)
+	require_True(t, resp.Error != nil)
+	require_Contains(t, resp.Error.Description, "before the first sequence")
+
+	addStream(t, nc, &StreamConfig{Name: "DENY", Subjects: []string{"bar"}, Storage: FileStorage, DenyPurge: true})
+	resp = truncate("DENY", 1)
+	require_True(t, resp.Error != nil)
+	addStream(t, nc, &StreamConfig{Name: "M", Storage: FileStorage, Mirror: &StreamSource{Name: "TEST"}})
+	resp = truncate("M", 1)
+	require_True(t, resp.Error != nil)
+	require_Contains(t, resp.Error.Description, "mirrors can not be truncated")
+}
+
+func TestJetStreamStreamMaxBlocks(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, max_blocks_per_stream: 4}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, cfg := range []*StreamConfig{
+		{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, MaxBlocks: 2},
+		{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxBlocks: 1},
+		{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxBlocks: -1},
+		{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, MaxBlocks: 5},
+	} {
+		_, apiErr := addStreamWithError(t, nc, cfg)
+		require_True(t, apiErr != nil)
+		require_Equal(t, apiErr.ErrCode, uint16(JSStreamInvalidConfigF))
+	}
+
+	// Small blocks through the maximum bytes, which are not reached before the blocks.
+	si := addStream(t, nc, &StreamConfig{
+		Name:      "TEST",
+		Subjects:  []string{"foo"},
+		Storage:   FileStorage,
+		MaxBytes:  100 * 1024,
+		MaxBlocks: 2,
+		Discard:   DiscardNew,
+	})
+	require_True(t, si.Blocks != nil)
+	require_Equal(t, si.Blocks.Blocks, 1)
+	require_Equal(t, si.Blocks.Max, 2)
+
+	msg := bytes.Repeat([]byte("Z"), 1024)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = js.Publish("foo", msg)
+	}
+	require_Error(t, err)
+	require_Contains(t, err.Error(), ErrMaxBlocks.Error())
+
+	var resp JSApiStreamInfoResponse
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Blocks != nil)
+	require_Equal(t, resp.Blocks.Blocks, 2)
+	require_True(t, resp.Blocks.OpenFiles <= 2)
+}
+
+func TestJetStreamStreamChunkLargeMsgs(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, apiErr := addStreamWithError(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, ChunkLargeMsgs: true})
+	require_True(t, apiErr != nil)
+	require_Equal(t, apiErr.ErrCode, uint16(JSStreamInvalidConfigF))
+
+	addStream(t, nc, &StreamConfig{
+		Name:           "TEST",
+		Subjects:       []string{"foo"},
+		Storage:        FileStorage,
+		BlockSize:      FileStoreMinBlkSize,
+		MaxMsgSize:     256 * 1024,
+		ChunkLargeMsgs: true,
+	})
+
+	var msgs [][]byte
+	for i := 0; i < 5; i++ {
+		msg := bytes.Repeat([]byte{byte('A' + i)}, 100*1024+i)
+		_, err := js.Publish("foo", msg)
+		require_NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+
+	check := func() {
+		t.Helper()
+		for i, msg := range msgs {
+			rm, err := js.GetMsg("TEST", uint64(i+1))
+			require_NoError(t, err)
+			require_True(t, bytes.Equal(rm.Data, msg))
+		}
+		sub, err := js.SubscribeSync("foo", nats.OrderedConsumer())
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+		for _, msg := range msgs {
+			m, err := sub.NextMsg(time.Second)
+			require_NoError(t, err)
+			require_True(t, bytes.Equal(m.Data, msg))
+		}
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_True(t, si.State.Bytes > 500*1024)
+	}
+	check()
+
+	mset, err := s.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.RLock()
+	for _, mb := range fs.blks {
+		mb.mu.RLock()
+		require_True(t, mb.rbytes <= FileStoreMinBlkSize)
+		mb.mu.RUnlock()
+	}
+	fs.mu.RUnlock()
+
+	// Messages are read back from their chunks after a restart.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	check()
+}
+
+func TestJetStreamTokenPlacement(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	streamRequest := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	// Check validation first.
+	apiErr := streamRequest(&StreamConfig{Name: "BAD", Subjects: []string{"orders.>"}, Storage: FileStorage, TokenPlacement: &StreamTokenPlacement{}})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamTokenPlacementInvalidErrF))
+	apiErr = streamRequest(&StreamConfig{Name: "BAD", Subjects: []string{"orders"}, Storage: FileStorage, TokenPlacement: &StreamTokenPlacement{Token: 2}})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamTokenPlacementInvalidErrF))
+	apiErr = streamRequest(&StreamConfig{Name: "BAD", Subjects: []string{"orders.>"}, Storage: FileStorage, TokenPlacement: &StreamTokenPlacement{Token: 2, DirectGet: true}})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamTokenPlacementInvalidErrF))
+
+	require_True(t, streamRequest(&StreamConfig{
+		Name: "TEST", Subjects: []string{"orders.>"}, Storage: FileStorage, AllowDirect: true,
+		TokenPlacement: &StreamTokenPlacement{Token: 2, TagPrefix: "region:", DirectGet: true},
+	}) == nil)
+
+	for _, subj := range []string{"orders.eu.1", "orders.eu.2", "orders.eu.1", "orders.us.1"} {
+		sendStreamMsg(t, nc, subj, "OK")
+	}
+
+	// Without replicas direct gets are served locally.
+	js, err := nc.JetStream()
+	require_NoError(t, err)
+	m, err := js.GetLastMsg("TEST", "orders.eu.2", nats.DirectGet())
+	require_NoError(t, err)
+	require_Equal(t, m.Sequence, 2)
+
+	streamInfo := func(req *JSApiStreamInfoRequest) *StreamInfo {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.StreamInfo
+	}
+
+	require_True(t, streamInfo(&JSApiStreamInfoRequest{}).TokenStats == nil)
+	stats := streamInfo(&JSApiStreamInfoRequest{TokenStats: true}).TokenStats
+	require_Len(t, len(stats), 2)
+	require_Equal(t, *stats["eu"], StreamTokenStats{Msgs: 3, FirstSeq: 1, LastSeq: 3, Subjects: 2})
+	require_Equal(t, *stats["us"], StreamTokenStats{Msgs: 1, FirstSeq: 4, LastSeq: 4, Subjects: 1})
+}
+
+func TestJetStreamConsumerCumulativeAck(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	testJetStreamConsumerCumulativeAck(t, nc, js, 1)
+}
+
+func testJetStreamConsumerCumulativeAck(t *testing.T, nc *nats.Conn, js nats.JetStreamContext, replicas int) {
+	t.Helper()
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: replicas})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{
+		Durable:   "C",
+		AckPolicy: nats.AckExplicitPolicy,
+		AckWait:   500 * time.Millisecond,
+	})
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 10)
+
+	// Ack the 5th on its own, then everything up to the 7th at once.
+	require_NoError(t, msgs[4].AckSync())
+	_, err = nc.Request(msgs[6].Reply, AckCumulative, time.Second)
+	require_NoError(t, err)
+
+	ci, err := js.ConsumerInfo("TEST", "C")
+	require_NoError(t, err)
+	require_Equal(t, ci.NumAckPending, 3)
+	require_Equal(t, ci.AckFloor.Stream, 7)
+	require_Equal(t, ci.AckFloor.Consumer, 7)
+
+	// Only the ones after are redelivered.
+	msgs, err = sub.Fetch(10, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 3)
+	for i, m := range msgs {
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		require_Equal(t, meta.Sequence.Stream, uint64(8+i))
+		require_Equal(t, meta.NumDelivered, 2)
+	}
+	_, err = nc.Request(msgs[2].Reply, AckCumulative, time.Second)
+	require_NoError(t, err)
+
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		ci, err := js.ConsumerInfo("TEST", "C")
+		if err != nil {
+			return err
+		}
+		if ci.NumAckPending != 0 || ci.AckFloor.Stream != 10 {
+			return fmt.Errorf("unexpected ack state: pending %d, floor %d", ci.NumAckPending, ci.AckFloor.Stream)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamConsumerProgressHeartbeats(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	addConsumer := func(cfg *ConsumerConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	apiErr := addConsumer(&ConsumerConfig{Durable: "BAD", AckPolicy: AckNone, ProgressHeartbeats: true})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerProgressHeartbeatsRequiresAckErr))
+	require_True(t, addConsumer(&ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, AckWait: 500 * time.Millisecond, ProgressHeartbeats: true}) == nil)
+
+	for i := 0; i < 2; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	// Two workers get one message each.
+	busy, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	idle, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := busy.Fetch(1)
+	require_NoError(t, err)
+	busySeq, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	_, err = idle.Fetch(1)
+	require_NoError(t, err)
+
+	// Only the busy worker sends heartbeats, for its inbox.
+	hbSubj := fmt.Sprintf(jsAckProgressT, "TEST", "C")
+	stop := time.Now().Add(1500 * time.Millisecond)
+	for time.Now().Before(stop) {
+		require_NoError(t, nc.Publish(hbSubj, []byte(busy.Subject)))
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Its message is still pending, the one of the idle worker was redelivered.
+	msgs, err = idle.Fetch(2, nats.MaxWait(250*time.Millisecond))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 1)
+	meta, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	require_NotEqual(t, meta.Sequence.Stream, busySeq.Sequence.Stream)
+	require_True(t, meta.NumDelivered > 1)
+	require_NoError(t, msgs[0].AckSync())
+
+	// Without heartbeats the message is redelivered after the ack wait.
+	msgs, err = idle.Fetch(1, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	meta, err = msgs[0].Metadata()
+	require_NoError(t, err)
+	require_Equal(t, meta.Sequence.Stream, busySeq.Sequence.Stream)
+	require_Equal(t, meta.NumDelivered, 2)
+}
+
+func TestJetStreamStreamSearch(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"orders.*"}})
+	require_NoError(t, err)
+	for i := 1; i <= 20; i++ {
+		m := nats.NewMsg(fmt.Sprintf("orders.%d", i%2))
+		m.Header.Set("Customer", fmt.Sprintf("c%d", i%4))
+		m.Data = []byte(fmt.Sprintf("order-%d", i))
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+
+	search := func(stream string, req *JSApiStreamSearchRequest) *JSApiStreamSearchResponse {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamSearchT, stream), b, time.Second)
+		require_NoError(t, err)
+		var sResp JSApiStreamSearchResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &sResp))
+		return &sResp
+	}
+	seqs := func(resp *JSApiStreamSearchResponse) []uint64 {
+		var seqs []uint64
+		for _, m := range resp.Matches {
+			seqs = append(seqs, m.Sequence)
+		}
+		return seqs
+	}
+
+	// Headers only.
+	sResp := search("TEST", &JSApiStreamSearchRequest{Headers: map[string]string{"Customer": "c3"}})
+	require_True(t, sResp.Error == nil)
+	require_Equal(t, fmt.Sprint(seqs(sResp)), "[3 7 11 15 19]")
+	require_Equal(t, sResp.Matches[0].Subject, "orders.1")
+	require_Equal(t, sResp.Scanned, 20)
+	require_Equal(t, sResp.NextSeq, 0)
+
+	// Payload within a window and on a subject.
+	sResp = search("TEST", &JSApiStreamSearchRequest{StartSeq: 5, EndSeq: 15, Subject: "orders.0", Contains: "order-1"})
+	require_True(t, sResp.Error == nil)
+	require_Equal(t, fmt.Sprint(seqs(sResp)), "[10 12 14]")
+	require_Equal(t, sResp.Scanned, 5)
+
+	// Limits tell where to continue.
+	sResp = search("TEST", &JSApiStreamSearchRequest{Contains: "order", MaxMatches: 3})
+	require_True(t, sResp.Error == nil)
+	require_Equal(t, fmt.Sprint(seqs(sResp)), "[1 2 3]")
+	require_Equal(t, sResp.NextSeq, 4)
+	sResp = search("TEST", &JSApiStreamSearchRequest{Contains: "order", MaxBytes: 1})
+	require_True(t, sResp.Error == nil)
+	require_Equal(t, sResp.Scanned, 1)
+	require_Equal(t, sResp.NextSeq, 2)
+
+	// Bad requests.
+	sResp = search("TEST", &JSApiStreamSearchRequest{})
+	require_True(t, IsNatsErr(sResp.Error, JSStreamSearchInvalidErrF))
+	sResp = search("TEST", &JSApiStreamSearchRequest{Contains: "x", StartSeq: 10, EndSeq: 5})
+	require_True(t, IsNatsErr(sResp.Error, JSStreamSearchInvalidErrF))
+	sResp = search("MISSING", &JSApiStreamSearchRequest{Contains: "x"})
+	require_True(t, IsNatsErr(sResp.Error, JSStreamNotFoundErr))
+}
+
+func TestJetStreamAPIQueueAccountFairness(t *testing.T) {
+	q := newJSAPIQueue(JSAccountIsolation{APIMaxPending: 5, APIMaxInflight: 2})
+	for i := 0; i < 6; i++ {
+		_, ok := q.push("NOISY", &jsAPIRoutedReq{subject: fmt.Sprintf("noisy.%d", i)})
+		// Only the ones over its pending limit are dropped.
+		require_Equal(t, ok, i < 5)
+	}
+	for i := 0; i < 2; i++ {
+		_, ok := q.push("QUIET", &jsAPIRoutedReq{subject: fmt.Sprintf("quiet.%d", i)})
+		require_True(t, ok)
+	}
+	require_Equal(t, q.len(), 7)
+
+	// Accounts take turns, and the noisy one only gets two at the same time.
+	var popped []*jsAPIRoutedReq
+	for r := q.pop(); r != nil; r = q.pop() {
+		popped = append(popped, r)
+	}
+	var subjects []string
+	for _, r := range popped {
+		subjects = append(subjects, r.subject)
+	}
+	require_Equal(t, strings.Join(subjects, ","), "noisy.0,quiet.0,noisy.1,quiet.1")
+
+	// Finishing requests lets the noisy account continue.
+	q.done(popped[0])
+	r := q.pop()
+	require_True(t, r != nil)
+	require_Equal(t, r.subject, "noisy.2")
+	require_True(t, q.pop() == nil)
+
+	stats := q.accountStats("NOISY")
+	require_Equal(t, stats.Pending, 2)
+	require_Equal(t, stats.Inflight, 2)
+	require_Equal(t, stats.Processed, 1)
+	require_Equal(t, stats.Dropped, 1)
+	require_True(t, q.accountStats("OTHER") == nil)
+
+	require_Equal(t, q.inProgress(), 4)
+	require_Equal(t, q.drain(), 2)
+	require_Equal(t, q.accountStats("NOISY").Dropped, 3)
+	require_Equal(t, q.len(), 0)
+	dropped, rejected := q.limitStats()
+	require_Equal(t, dropped, 3)
+	require_Equal(t, rejected, 0)
+
+	// Accounts without requests for a while are pruned on a later push.
+	q.done(popped[1])
+	q.done(popped[3])
+	require_Equal(t, q.inProgress(), 2)
+	q.mu.Lock()
+	q.accs["QUIET"].last = time.Now().Add(-jsAPIAccountQueueIdle)
+	q.pruned = time.Time{}
+	q.mu.Unlock()
+	_, ok := q.push("OTHER", &jsAPIRoutedReq{subject: "other.0"})
+	require_True(t, ok)
+	require_True(t, q.accountStats("QUIET") == nil)
+	// Still has requests in progress.
+	require_True(t, q.accountStats("NOISY") != nil)
+}
+
+func TestJetStreamDeliveryBudget(t *testing.T) {
+	require_True(t, newJSDeliveryBudget(0) == nil)
+	require_True(t, newJSDeliveryBudget(0).stats() == nil)
+
+	b := newJSDeliveryBudget(1)
+	require_True(t, b.acquire(100) == nil)
+	b.delivered(0)
+
+	// Another stream has to wait until the first one delivered.
+	turn := b.acquire(100)
+	require_True(t, turn != nil)
+	select {
+	case <-turn.turn():
+		t.Fatal("Expected to wait for the turn")
+	default:
+	}
+	b.release()
+	select {
+	case <-turn.turn():
+	case <-time.After(time.Second):
+		t.Fatal("Expected to be given the turn")
+	}
+	b.delivered(10 * time.Millisecond)
+	b.release()
+
+	stats := b.stats()
+	require_Equal(t, stats.Batches, 2)
+	require_Equal(t, stats.AvgWait, 5*time.Millisecond)
+	require_Equal(t, stats.MaxWait, 10*time.Millisecond)
+}
+
+func TestJetStreamAccountIsolationConfig(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: "`+t.TempDir()+`"
+			account_isolation: { api_max_pending: 100, api_max_inflight: 4, delivery_max_inflight: 1 }
+		}
+	`))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	require_Equal(t, opts.JetStreamAccountIsolation, JSAccountIsolation{APIMaxPending: 100, APIMaxInflight: 4, DeliveryMaxInflight: 1})
+	require_Equal(t, s.jsAPIRoutedReqs.lim, opts.JetStreamAccountIsolation)
+
+	// The streams of the account take turns to deliver, here their publish acks.
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+	for _, name := range []string{"A", "B"} {
+		_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}})
+		require_NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err := js.Publish("a", []byte("OK"))
+		require_NoError(t, err)
+		_, err = js.Publish("b", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, jsa, err := s.GlobalAccount().checkForJetStream()
+	require_NoError(t, err)
+	require_True(t, s.accountDetail(jsa, false, false, false, false, false, false).Delivery.Batches >= 20)
+
+	conf = createConfFile(t, []byte(`
+		jetstream: {
+			account_isolation: { api_max_inflight: -1 }
+		}
+	`))
+	_, err = ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "Expected a non-negative number"))
+}
+
+func TestJetStreamStreamUpdateReplicasNotSupported(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := &nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}}
+	_, err := js.AddStream(cfg)
+	require_NoError(t, err)
+
+	cfg.Replicas = 3
+	_, err = js.UpdateStream(cfg)
+	require_Error(t, err, NewJSStreamReplicasNotSupportedError())
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.Config.Replicas, 1)
+}
+
+func TestJetStreamStreamIdempotencyTokens(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	testStreamIdempotencyTokens(t, nc, 1)
+}
+
+func testStreamIdempotencyTokens(t *testing.T, nc *nats.Conn, replicas int) {
+	t.Helper()
+	request := func(subject string, cfg StreamConfig, token string) JSApiStreamCreateResponse {
+		t.Helper()
+		req, err := json.Marshal(StreamConfigRequest{StreamConfig: cfg, Token: token})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(subject, cfg.Name), req, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp
+	}
+
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: replicas}
+	resp := request(JSApiStreamCreateT, cfg, "c1")
+	require_True(t, resp.Error == nil)
+
+	// A retried create with the token gets the stream, even if it differs.
+	ncfg := cfg
+	ncfg.Subjects = []string{"foo", "bar"}
+	resp = request(JSApiStreamCreateT, ncfg, "c1")
+	require_True(t, resp.Error == nil)
+	require_Equal(t, len(resp.Config.Subjects), 1)
+	resp = request(JSApiStreamCreateT, ncfg, "c2")
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamNameExistErr))
+
+	// A retried update with the token is not applied again.
+	cfg.MaxMsgs = 10
+	resp = request(JSApiStreamUpdateT, cfg, "u1")
+	require_True(t, resp.Error == nil)
+	require_Equal(t, resp.Config.MaxMsgs, 10)
+	cfg.MaxMsgs = 20
+	resp = request(JSApiStreamUpdateT, cfg, "u2")
+	require_True(t, resp.Error == nil)
+	require_Equal(t, resp.Config.MaxMsgs, 20)
+	cfg.MaxMsgs = 10
+	resp = request(JSApiStreamUpdateT, cfg, "u1")
+	require_True(t, resp.Error == nil)
+	require_Equal(t, resp.Config.MaxMsgs, 20)
+
+	// Updates without a token always apply.
+	resp = request(JSApiStreamUpdateT, cfg, _EMPTY_)
+	require_True(t, resp.Error == nil)
+	require_Equal(t, resp.Config.MaxMsgs, 10)
+}
+
+func TestJetStreamStreamEventTime(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, EventTimeHeader: "Event Time"})
+	require_Error(t, err)
+
+	mset, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, EventTimeHeader: "Event-Time"})
+	require_NoError(t, err)
+	require_True(t, mset.eventTime() == nil)
+
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	publish := func(et string) {
+		t.Helper()
+		m := nats.NewMsg("foo")
+		if et != _EMPTY_ {
+			m.Header.Set("Event-Time", et)
+		}
+		_, err := js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	// Out of order event times, both formats, and a message without.
+	publish(base.Format(time.RFC3339Nano))
+	publish(strconv.FormatInt(base.Add(2*time.Minute).UnixNano(), 10))
+	publish(base.Add(time.Minute).Format(time.RFC3339Nano))
+	publish(_EMPTY_)
+
+	// The watermark is the latest event time seen.
+	msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &resp))
+	require_True(t, resp.EventTime != nil)
+	require_True(t, resp.EventTime.Equal(base.Add(2*time.Minute)))
+
+	createConsumer := func(stream string, start time.Time) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(&CreateConsumerRequest{Stream: stream, Config: ConsumerConfig{
+			Durable:       "C",
+			AckPolicy:     AckExplicit,
+			DeliverPolicy: DeliverByStartEventTime,
+			OptStartTime:  &start,
+		}})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, stream, "C"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+
+	// Consumers start at the first message at or after the event time.
+	require_True(t, createConsumer("TEST", base.Add(30*time.Second)) == nil)
+	o := mset.lookupConsumer("C")
+	require_True(t, o != nil)
+	o.mu.RLock()
+	sseq := o.sseq
+	o.mu.RUnlock()
+	require_Equal(t, sseq, 2)
+
+	// Streams without an event time header can not.
+	_, err = acc.addStream(&StreamConfig{Name: "OTHER", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+	apiErr := createConsumer("OTHER", base)
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+}
+
+func TestJetStreamSourceAndMirrorGaps(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "O", Subjects: []string{"foo"}, MaxMsgs: 10})
+	require_NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("foo", nil)
+		require_NoError(t, err)
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "O"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S", Sources: []*nats.StreamSource{{Name: "O"}}})
+	require_NoError(t, err)
+
+	checkMsgs := func(stream string, msgs uint64) {
+		t.Helper()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			si, err := js.StreamInfo(stream)
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != msgs {
+				return fmt.Errorf("expected %d msgs, got %d", msgs, si.State.Msgs)
+			}
+			return nil
+		})
+	}
+	checkMsgs("M", 5)
+	checkMsgs("S", 5)
+
+	sub := natsSubSync(t, nc, JSAdvisoryStreamSourceGapPre+".>")
+	require_NoError(t, nc.Flush())
+
+	acc := s.GlobalAccount()
+	mirror, err := acc.lookupStream("M")
+	require_NoError(t, err)
+	source, err := acc.lookupStream("S")
+	require_NoError(t, err)
+
+	// Stop ingesting, while the origin removes messages over its limit.
+	mirror.mu.Lock()
+	mirror.cancelMirrorConsumer()
+	mirror.mu.Unlock()
+	source.mu.Lock()
+	var iname string
+	var sseq uint64
+	for iname = range source.sources {
+		si := source.sources[iname]
+		sseq = si.sseq
+		source.cancelSourceInfo(si)
+	}
+	source.mu.Unlock()
+	require_Equal(t, sseq, 5)
+
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("foo", nil)
+		require_NoError(t, err)
+	}
+
+	require_NoError(t, mirror.retryMirrorConsumer())
+	source.mu.Lock()
+	source.retrySourceConsumerAtSeq(iname, sseq+1)
+	source.mu.Unlock()
+
+	checkMsgs("M", 15)
+	checkMsgs("S", 15)
+
+	// Both lost messages 6 through 15.
+	streams := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		msg := natsNexMsg(t, sub, 5*time.Second)
+		var adv JSStreamSourceGapAdvisory
+		require_NoError(t, json.Unmarshal(msg.Data, &adv))
+		require_Equal(t, adv.Type, JSStreamSourceGapAdvisoryType)
+		require_Equal(t, adv.Source, "O")
+		require_Equal(t, adv.FirstSeq, 6)
+		require_Equal(t, adv.LastSeq, 15)
+		require_Equal(t, adv.Mirror, adv.Stream == "M")
+		streams[adv.Stream] = true
+	}
+	require_True(t, streams["M"] && streams["S"])
+
+	for _, ssi := range append(source.sourcesInfo(), mirror.mirrorInfo()) {
+		require_Equal(t, ssi.Lost, 10)
+		require_True(t, ssi.Gap != nil)
+		require_Equal(t, ssi.Gap.First, 6)
+		require_Equal(t, ssi.Gap.Last, 15)
+	}
+}
+
+func TestJetStreamStreamHeadersOnly(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{
+		Name:        "TEST",
+		Subjects:    []string{"foo"},
+		Storage:     FileStorage,
+		MaxMsgSize:  128,
+		HeadersOnly: true,
+	})
+	require_NoError(t, err)
+
+	m := nats.NewMsg("foo")
+	m.Header.Set("Foo", "bar")
+	m.Data = []byte("hello world")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+	_, err = js.Publish("foo", nil)
+	require_NoError(t, err)
+	// Only what is stored counts towards the max message size.
+	_, err = js.Publish("foo", make([]byte, 1024))
+	require_NoError(t, err)
+
+	for seq, size := range []string{"11", "0", "1024"} {
+		sm, err := mset.getMsg(uint64(seq + 1))
+		require_NoError(t, err)
+		require_Len(t, len(sm.Data), 0)
+		require_Equal(t, string(getHeader(JSMsgSize, sm.Header)), size)
+	}
+	sm, err := mset.getMsg(1)
+	require_NoError(t, err)
+	require_Equal(t, string(getHeader("Foo", sm.Header)), "bar")
+
+	// A stripped message is not stripped again, e.g. when a replica applies it.
+	hdr, msg := stripPayload(sm.Header, nil)
+	require_Len(t, len(msg), 0)
+	require_True(t, bytes.Equal(hdr, sm.Header))
+	hdr, _ = stripPayload(sm.Header, []byte("hi"))
+	require_Equal(t, string(getHeader(JSMsgSize, hdr)), "2")
+	require_Equal(t, bytes.Count(hdr, []byte(JSMsgSize)), 1)
+}
+
+func TestJetStreamProtectedConsumer(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{
+		Name:           "TEST",
+		Subjects:       []string{"foo"},
+		Storage:        FileStorage,
+		ConsumerLimits: StreamConsumerLimits{InactiveThreshold: time.Minute},
+	})
+	require_NoError(t, err)
+
+	for _, cfg := range []*ConsumerConfig{
+		{Name: "E", AckPolicy: AckExplicit, Protected: true},
+		{Durable: "D", AckPolicy: AckExplicit, InactiveThreshold: time.Minute, Protected: true},
+	} {
+		_, err = mset.addConsumer(cfg)
+		require_True(t, IsNatsErr(err, JSConsumerProtectedInvalidErrF))
+	}
+
+	for i := 0; i < 5; i++ {
+		sendStreamMsg(t, nc, "foo", "msg")
+	}
+	o, err := mset.addConsumer(&ConsumerConfig{Durable: "C", DeliverPolicy: DeliverNew, AckPolicy: AckExplicit, Protected: true})
+	require_NoError(t, err)
+	// The inactive threshold of the stream limits does not apply.
+	require_Equal(t, o.config().InactiveThreshold, 0)
+	for i := 0; i < 5; i++ {
+		sendStreamMsg(t, nc, "foo", "msg")
+	}
+
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	for _, m := range fetchMsgs(t, sub, 2, time.Second) {
+		require_NoError(t, m.AckSync())
+	}
+
+	deleteConsumer := func(req string) *ApiError {
+		t.Helper()
+		msg, err := nc.Request(fmt.Sprintf(JSApiConsumerDeleteT, "TEST", "C"), []byte(req), time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerDeleteResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return resp.Error
+	}
+	require_Error(t, deleteConsumer(_EMPTY_), NewJSConsumerProtectedError())
+	require_Error(t, deleteConsumer(`{"force":false}`), NewJSConsumerProtectedError())
+	require_True(t, IsNatsErr(deleteConsumer(`{"force"`), JSInvalidJSONErr))
+
+	// Lose the state of the consumer.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	cstore := filepath.Join(sd, "$G", "streams", "TEST", "obs", "C", "o.dat")
+	require_NoError(t, os.WriteFile(cstore, []byte("corrupt"), defaultFilePerms))
+
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Recreated at the start of the stream, even though it delivers new messages.
+	ci, err := js.ConsumerInfo("TEST", "C")
+	require_NoError(t, err)
+	require_Equal(t, ci.Config.DeliverPolicy, nats.DeliverNewPolicy)
+	require_Equal(t, ci.Delivered.Stream, 0)
+	require_Equal(t, ci.NumPending, 10)
+
+	// The state lost is advised.
+	mset, err = s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o = mset.lookupConsumer("C")
+	require_True(t, o != nil)
+	asub := natsSubSync(t, nc, JSAdvisoryConsumerRecreatedPre+".TEST.C")
+	require_NoError(t, nc.Flush())
+	o.mu.Lock()
+	o.recreateLostState(errCorruptState)
+	o.mu.Unlock()
+	msg := natsNexMsg(t, asub, time.Second)
+	var adv JSConsumerRecreatedAdvisory
+	require_NoError(t, json.Unmarshal(msg.Data, &adv))
+	require_Equal(t, adv.Type, JSConsumerRecreatedAdvisoryType)
+	require_Equal(t, adv.Consumer, "C")
+	require_Equal(t, adv.StartSeq, 1)
+	require_Equal(t, adv.Error, errCorruptState.Error())
+
+	require_True(t, deleteConsumer(`{"force":true}`) == nil)
+	_, err = js.ConsumerInfo("TEST", "C")
+	require_Error(t, err, nats.ErrConsumerNotFound)
+}
+
+func TestJetStreamStreamHotSubjects(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	for _, hs := range []*StreamHotSubjects{
+		{Threshold: 2},
+		{Threshold: 0.5, Window: -time.Second},
+		{Threshold: 0.5, Window: time.Millisecond},
+		{},
+	} {
+		_, err := acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, HotSubjects: hs})
+		require_True(t, IsNatsErr(err, JSStreamHotSubjectsInvalidErrF))
+	}
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:        "TEST",
+		Subjects:    []string{"kv.>"},
+		HotSubjects: &StreamHotSubjects{Threshold: 0.5, Window: time.Minute, MinMsgs: 10, MaxRate: 1},
+	})
+	require_NoError(t, err)
+
+	sub := natsSubSync(t, nc, JSAdvisoryStreamHotSubjectPre+".TEST")
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("kv.a", nil)
+		require_NoError(t, err)
+		if i%4 == 0 {
+			_, err = js.Publish("kv.b", nil)
+			require_NoError(t, err)
+		}
+	}
+
+	// One advisory per window for the hot subject.
+	msg := natsNexMsg(t, sub, time.Second)
+	var adv JSStreamHotSubjectAdvisory
+	require_NoError(t, json.Unmarshal(msg.Data, &adv))
+	require_Equal(t, adv.Type, JSStreamHotSubjectAdvisoryType)
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.Subject, "kv.a")
+	require_True(t, adv.Total >= 10)
+	require_True(t, float64(adv.Msgs)/float64(adv.Total) > 0.5)
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// The rate cap is a max rate of 1 msg/s over the window of a minute.
+	for i := 20; i < 60; i++ {
+		_, err = js.Publish("kv.a", nil)
+		require_NoError(t, err)
+	}
+	_, err = js.Publish("kv.a", nil)
+	require_Error(t, err, NewJSStreamSubjectRateExceededError())
+	_, err = js.Publish("kv.b", nil)
+	require_NoError(t, err)
+
+	rej := mset.rejections()
+	require_True(t, rej != nil)
+	require_Equal(t, rej.SubjectRate, 1)
+
+	// Changing the configuration starts over.
+	cfg := mset.config()
+	cfg.HotSubjects = &StreamHotSubjects{MaxRate: 10}
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.Publish("kv.a", nil)
+	require_NoError(t, err)
+}
+
+func TestJetStreamStreamMaxIngestRate(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, MaxIngestRate: &StreamIngestRate{}})
+	require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"foo"},
+		MaxIngestRate: &StreamIngestRate{Msgs: 5},
+	})
+	require_NoError(t, err)
+
+	// A burst of a second's worth is accepted, after that we are limited.
+	var accepted int
+	for ; accepted < 20; accepted++ {
+		if _, err = js.Publish("foo", nil); err != nil {
+			break
+		}
+	}
+	require_Error(t, err, NewJSStreamIngestRateExceededError())
+	require_True(t, accepted >= 5 && accepted < 20)
+
+	rej := mset.rejections()
+	require_True(t, rej != nil)
+	require_Equal(t, rej.IngestRate, 1)
+	require_Equal(t, mset.state().Msgs, uint64(accepted))
+
+	// Refills over time.
+	time.Sleep(time.Second)
+	_, err = js.Publish("foo", nil)
+	require_NoError(t, err)
+
+	// Limit the bytes instead, larger messages are let through when the bucket is full.
+	cfg := mset.config()
+	cfg.MaxIngestRate = &StreamIngestRate{Bytes: 1000}
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.Publish("foo", make([]byte, 2000))
+	require_NoError(t, err)
+	_, err = js.Publish("foo", make([]byte, 100))
+	require_Error(t, err, NewJSStreamIngestRateExceededError())
+
+	// Removing the limit accepts everything again.
+	cfg.MaxIngestRate = nil
+	require_NoError(t, mset.update(&cfg))
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("foo", nil)
+		require_NoError(t, err)
+	}
+}
+
+func TestJetStreamStreamValidation(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad.>"}, Validation: &StreamValidation{Subject: "bad.validate"}})
+	require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+	_, err = acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, Validation: &StreamValidation{Subject: "validate.*"}})
+	require_True(t, IsNatsErr(err, JSStreamInvalidConfigF))
+
+	// Rejects payloads that are not JSON objects, the way a NATS service returns errors.
+	requests := make(chan *nats.Msg, 10)
+	sub, err := nc.Subscribe("validate", func(m *nats.Msg) {
+		requests <- m
+		reply := nats.NewMsg(m.Reply)
+		if !bytes.HasPrefix(m.Data, []byte("{")) && m.Header.Get(JSMsgSize) == _EMPTY_ {
+			reply.Header.Set(JSValidationError+"-Code", "400")
+			reply.Header.Set(JSValidationError, "not a JSON object")
+		}
+		m.RespondMsg(reply)
+	})
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo.*"},
+		Validation: &StreamValidation{Subject: "validate", Timeout: 250 * time.Millisecond},
+	})
+	require_NoError(t, err)
+
+	m := nats.NewMsg("foo.bar")
+	m.Header.Set("Schema", "order")
+	m.Data = []byte(`{"id":1}`)
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+
+	req := <-requests
+	require_Equal(t, req.Header.Get(JSStream), "TEST")
+	require_Equal(t, req.Header.Get(JSSubject), "foo.bar")
+	require_Equal(t, req.Header.Get("Schema"), "order")
+	require_Equal(t, string(req.Data), `{"id":1}`)
+
+	_, err = js.Publish("foo.bar", []byte("garbage"))
+	require_Error(t, err, NewJSStreamValidationRejectedError(errors.New("not a JSON object")))
+	<-requests
+	require_Equal(t, mset.state().Msgs, 1)
+
+	// Only the headers are sent, with the size of the payload.
+	cfg := mset.config()
+	cfg.Validation = &StreamValidation{Subject: "validate", Timeout: 250 * time.Millisecond, HeadersOnly: true}
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.Publish("foo.bar", []byte("garbage"))
+	require_NoError(t, err)
+	req = <-requests
+	require_Len(t, len(req.Data), 0)
+	require_Equal(t, req.Header.Get(JSMsgSize), "7")
+
+	// Without a validator the messages time out, unless bypassed.
+	require_NoError(t, sub.Unsubscribe())
+	_, err = js.Publish("foo.bar", []byte(`{}`))
+	require_Error(t, err, NewJSStreamValidationTimeoutError())
+
+	cfg.Validation = &StreamValidation{Subject: "validate", Timeout: 250 * time.Millisecond, Bypass: true}
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.Publish("foo.bar", []byte(`{}`))
+	require_NoError(t, err)
+
+	rej := mset.rejections()
+	require_True(t, rej != nil)
+	require_Equal(t, rej.Validation, 2)
+	require_Equal(t, mset.state().Msgs, 3)
+
+	// Removing the validation stores right away.
+	cfg.Validation = nil
+	require_NoError(t, mset.update(&cfg))
+	start := time.Now()
+	_, err = js.Publish("foo.bar", []byte("garbage"))
+	require_NoError(t, err)
+	require_True(t, time.Since(start) < 250*time.Millisecond)
+
+	// The stream keeps serving direct gets while waiting on the validator.
+	held := make(chan *nats.Msg, 1)
+	_, err = nc.Subscribe("slow", func(m *nats.Msg) { held <- m })
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+	cfg.AllowDirect = true
+	cfg.Validation = &StreamValidation{Subject: "slow", Timeout: 5 * time.Second}
+	require_NoError(t, mset.update(&cfg))
+	paf, err := js.PublishAsync("foo.bar", []byte(`{"id":2}`))
+	require_NoError(t, err)
+	req = require_ChanRead(t, held, time.Second)
+
+	start = time.Now()
+	lm, err := js.GetLastMsg("TEST", "foo.bar", nats.DirectGet())
+	require_NoError(t, err)
+	require_Equal(t, string(lm.Data), "garbage")
+	require_True(t, time.Since(start) < time.Second)
+
+	require_NoError(t, req.Respond(nil))
+	select {
+	case <-paf.Ok():
+	case err := <-paf.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the ack")
+	}
+	require_Equal(t, mset.state().Msgs, 5)
+}
+
+func TestJetStreamSubjectTransformOnIngest(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:     "ORDERS",
+		Subjects: []string{"orders.*.*"},
+		SubjectTransform: &nats.SubjectTransformConfig{
+			Source:      "orders.*.created",
+			Destination: "archive.orders.{{wildcard(1)}}",
+		},
+	})
+	require_NoError(t, err)
+
+	// Only matching messages are stored under the new subject.
+	_, err = js.Publish("orders.1.created", nil)
+	require_NoError(t, err)
+	_, err = js.Publish("orders.1.shipped", nil)
+	require_NoError(t, err)
+	m, err := js.GetMsg("ORDERS", 1)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "archive.orders.1")
+	m, err = js.GetMsg("ORDERS", 2)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "orders.1.shipped")
+
+	// The transform can be updated, e.g. to reorder the tokens.
+	_, err = js.UpdateStream(&nats.StreamConfig{
+		Name:     "ORDERS",
+		Subjects: []string{"orders.*.*"},
+		SubjectTransform: &nats.SubjectTransformConfig{
+			Source:      "orders.*.*",
+			Destination: "archive.{{wildcard(2)}}.{{wildcard(1)}}",
+		},
+	})
+	require_NoError(t, err)
+	_, err = js.Publish("orders.2.created", nil)
+	require_NoError(t, err)
+	m, err = js.GetMsg("ORDERS", 3)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "archive.created.2")
+
+	// And removed.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.*.*"}})
+	require_NoError(t, err)
+	_, err = js.Publish("orders.3.created", nil)
+	require_NoError(t, err)
+	m, err = js.GetMsg("ORDERS", 4)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "orders.3.created")
+}
+
+func TestJetStreamConsumerReplaySpeed(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{Name: "DC", Storage: MemoryStorage})
+	require_NoError(t, err)
+	defer mset.delete()
+
+	nc := clientConnectToServer(t, s)
+	defer nc.Close()
+
+	// Speed requires original timing and has to be positive.
+	_, err = mset.addConsumer(&ConsumerConfig{ReplayPolicy: ReplayInstant, ReplaySpeed: 2})
+	require_Error(t, err, NewJSConsumerReplaySpeedInvalidError(errors.New("requires original replay policy")))
+	_, err = mset.addConsumer(&ConsumerConfig{ReplayPolicy: ReplayOriginal, ReplaySpeed: -1})
+	require_Error(t, err, NewJSConsumerReplaySpeedInvalidError(errors.New("must be a positive number")))
+
+	// Three messages, 400ms apart.
+	gap := 400 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(gap)
+		}
+		require_NoError(t, nc.Publish("DC", []byte("OK!")))
+	}
+	require_NoError(t, nc.Flush())
+	checkFor(t, time.Second, 10*time.Millisecond, func() error {
+		if state := mset.state(); state.Msgs != 3 {
+			return fmt.Errorf("expected 3 messages, got %d", state.Msgs)
+		}
+		return nil
+	})
+
+	// At 4x the replay takes a quarter of the original time.
+	sub, err := nc.SubscribeSync(nats.NewInbox())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	require_NoError(t, nc.Flush())
+
+	start := time.Now()
+	o, err := mset.addConsumer(&ConsumerConfig{DeliverSubject: sub.Subject, ReplayPolicy: ReplayOriginal, ReplaySpeed: 4})
+	require_NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = sub.NextMsg(time.Second)
+		require_NoError(t, err)
+	}
+	if elapsed := time.Since(start); elapsed < gap/2 || elapsed > gap {
+		t.Fatalf("Expected replay at 4x to take about %v, took %v", gap/2, elapsed)
+	}
+	o.delete()
+
+	// Paused replay holds the remaining messages until resumed.
+	sub, err = nc.SubscribeSync(nats.NewInbox())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	require_NoError(t, nc.Flush())
+
+	o, err = mset.addConsumer(&ConsumerConfig{Durable: "R", DeliverSubject: sub.Subject, ReplayPolicy: ReplayOriginal, ReplaySpeed: 2})
+	require_NoError(t, err)
+	defer o.delete()
+	_, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+
+	ctrl := fmt.Sprintf(jsReplayControlT, "DC", "R")
+	replayState := func(cmd string) ConsumerReplayState {
+		t.Helper()
+		resp, err := nc.Request(ctrl, []byte(cmd), time.Second)
+		require_NoError(t, err)
+		var state ConsumerReplayState
+		require_NoError(t, json.Unmarshal(resp.Data, &state))
+		return state
+	}
+	state := replayState("PAUSE")
+	require_True(t, state.Replaying)
+	require_True(t, state.Paused)
+	require_Equal(t, state.Speed, 2)
+
+	// The message we may already have been waiting for can still come, the last one can not.
+	sub.NextMsg(gap)
+	_, err = sub.NextMsg(gap)
+	require_Error(t, err, nats.ErrTimeout)
+	require_True(t, replayState(_EMPTY_).Paused)
+
+	require_False(t, replayState("RESUME").Paused)
+	_, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	checkFor(t, time.Second, 10*time.Millisecond, func() error {
+		if replayState(_EMPTY_).Replaying {
+			return errors.New("still replaying")
+		}
+		return nil
+	})
+}
+
+func TestJetStreamConsumerPullStats(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy, MaxRequestBatch: 5})
+	require_NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+
+	// Filled, partially filled and empty, the client asks with no wait so only the empty one expires.
+	msgs, err := sub.Fetch(2)
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+	msgs, err = sub.Fetch(2, nats.MaxWait(250*time.Millisecond))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 1)
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Over the max batch.
+	_, err = sub.Fetch(10, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("C")
+	require_NotNil(t, o)
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		ps := o.info().PullStats
+		if ps == nil {
+			return errors.New("no pull stats")
+		}
+		if ps.Requests != 4 || ps.Msgs != 3 || ps.Conflicts != 1 || ps.Expired != 1 || ps.ExpiredEmpty != 1 {
+			return fmt.Errorf("unexpected pull stats: %+v", ps)
+		}
+		if ps.Bytes == 0 || len(ps.Problems) > 0 {
+			return fmt.Errorf("unexpected pull stats: %+v", ps)
+		}
+		return nil
+	})
+
+	// Problems are reported once there are enough requests.
+	ps := ConsumerPullStats{Requests: pullStatsMinRequests - 1, ExpiredEmpty: pullStatsMinRequests - 1}
+	require_Len(t, len(ps.problems()), 0)
+	ps = ConsumerPullStats{Requests: 200, Expired: 150, ExpiredEmpty: 120, Conflicts: 30}
+	require_Len(t, len(ps.problems()), 2)
+	ps = ConsumerPullStats{Requests: 200, Expired: 120, ExpiredEmpty: 10, Msgs: 500}
+	require_Len(t, len(ps.problems()), 1)
+}
+
+func TestJetStreamMessageTTL(t *testing.T) {
+	for _, storage := range []nats.StorageType{nats.FileStorage, nats.MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			s := RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: storage})
+			require_NoError(t, err)
+
+			publish := func(ttl string) *ApiError {
+				t.Helper()
+				m := nats.NewMsg("foo")
+				if ttl != _EMPTY_ {
+					m.Header.Set(JSMessageTTL, ttl)
+				}
+				resp, err := nc.RequestMsg(m, time.Second)
+				require_NoError(t, err)
+				var pa JSPubAckResponse
+				require_NoError(t, json.Unmarshal(resp.Data, &pa))
+				return pa.Error
+			}
+
+			// Not allowed unless the stream allows it.
+			apiErr := publish("1s")
+			require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSMessageTTLDisabledErr))
+
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			require_NoError(t, err)
+			cfg := mset.config()
+			cfg.AllowMsgTTL = true
+			require_NoError(t, mset.update(&cfg))
+
+			for _, ttl := range []string{"0", "-1s", "500ms", "soon"} {
+				apiErr = publish(ttl)
+				require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSMessageTTLInvalidErr))
+			}
+
+			require_True(t, publish("1") == nil)
+			require_True(t, publish(_EMPTY_) == nil)
+			require_True(t, publish("2s") == nil)
+
+			// Expire in order of their TTL, the message without one stays.
+			checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+				if state := mset.state(); state.Msgs != 2 || state.FirstSeq != 2 {
+					return fmt.Errorf("unexpected state: %+v", state)
+				}
+				return nil
+			})
+			checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+				if state := mset.state(); state.Msgs != 1 {
+					return fmt.Errorf("unexpected state: %+v", state)
+				}
+				return nil
+			})
+			_, err = js.GetMsg("TEST", 2)
+			require_NoError(t, err)
+
+			// Can not be disabled again.
+			_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: storage})
+			require_Error(t, err)
+		})
+	}
+}
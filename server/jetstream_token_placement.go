@@ -0,0 +1,163 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// StreamTokenPlacement declares that one token of the stream's subjects encodes
+// where the data belongs, e.g. a region or a tenant. Stream info can report the
+// messages per token, and direct gets for a subject can be routed to the replica
+// on the server tagged for its token, improving locality for geo-partitioned data.
+type StreamTokenPlacement struct {
+	// Token is the position, starting at 1, of the subject token.
+	Token int `json:"token"`
+	// TagPrefix is prepended to the token to form the server tag, e.g. "region:" for "region:eu".
+	TagPrefix string `json:"tag_prefix,omitempty"`
+	// DirectGet routes direct gets to the replica on the server tagged for the token of the subject.
+	DirectGet bool `json:"direct_get,omitempty"`
+}
+
+// StreamTokenStats are the statistics of the messages with the same placement token.
+type StreamTokenStats struct {
+	Msgs     uint64 `json:"messages"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Subjects int    `json:"num_subjects"`
+}
+
+// Direct gets routed to a replica are sent on a subject with the stream name and peer.
+const jsDirectGetRouteT = "$JSC.DG.%s.%s"
+
+func (tp *StreamTokenPlacement) validate(cfg *StreamConfig) error {
+	if tp.Token < 1 || tp.Token > math.MaxUint8 {
+		return fmt.Errorf("token position must be between 1 and %d", math.MaxUint8)
+	}
+	for _, subj := range cfg.Subjects {
+		if numTokens(subj) < tp.Token && !subjectHasWildcard(subj) {
+			return fmt.Errorf("subject %q does not have a token at position %d", subj, tp.Token)
+		}
+	}
+	if tp.DirectGet && !cfg.AllowDirect {
+		return errors.New("routing direct gets requires allow direct")
+	}
+	return nil
+}
+
+// Returns the placement token of the subject, empty if it has none.
+func (tp *StreamTokenPlacement) token(subject string) string {
+	tok := tokenAt(subject, uint8(tp.Token))
+	if tok == pwcs || tok == fwcs {
+		return _EMPTY_
+	}
+	return tok
+}
+
+// Returns the statistics of our messages by placement token.
+func (mset *stream) tokenStats() map[string]*StreamTokenStats {
+	mset.mu.RLock()
+	tp, store := mset.cfg.TokenPlacement, mset.store
+	mset.mu.RUnlock()
+	if tp == nil || store == nil {
+		return nil
+	}
+
+	stats := make(map[string]*StreamTokenStats)
+	for subj, ss := range store.SubjectsState(fwcs) {
+		tok := tp.token(subj)
+		if tok == _EMPTY_ {
+			continue
+		}
+		ts := stats[tok]
+		if ts == nil {
+			ts = &StreamTokenStats{FirstSeq: ss.First}
+			stats[tok] = ts
+		}
+		ts.Msgs += ss.Msgs
+		ts.Subjects++
+		if ss.First < ts.FirstSeq {
+			ts.FirstSeq = ss.First
+		}
+		if ss.Last > ts.LastSeq {
+			ts.LastSeq = ss.Last
+		}
+	}
+	return stats
+}
+
+// Returns the subject a direct get request is for, if it is for a single subject.
+func directGetSubject(req *JSApiMsgGetRequest) string {
+	if req.LastFor != _EMPTY_ {
+		return req.LastFor
+	}
+	if req.NextFor != _EMPTY_ && subjectIsLiteral(req.NextFor) {
+		return req.NextFor
+	}
+	return _EMPTY_
+}
+
+// Will route the direct get for the subject to the replica on the server tagged for
+// its placement token, unless that is us. Returns true if the request was routed.
+func (mset *stream) routeDirectGet(subject, reply string, req *JSApiMsgGetRequest) bool {
+	if subject == _EMPTY_ {
+		return false
+	}
+	mset.mu.RLock()
+	tp, node, name, s := mset.cfg.TokenPlacement, mset.node, mset.cfg.Name, mset.srv
+	mset.mu.RUnlock()
+	if tp == nil || !tp.DirectGet || node == nil || s == nil {
+		return false
+	}
+
+	tok := tp.token(subject)
+	if tok == _EMPTY_ {
+		return false
+	}
+	tag := tp.TagPrefix + tok
+	if s.getOpts().Tags.Contains(tag) {
+		return false
+	}
+
+	ourID := node.ID()
+	for _, p := range node.Peers() {
+		if p.ID == ourID {
+			continue
+		}
+		si, ok := s.nodeToInfo.Load(p.ID)
+		if !ok || si == nil {
+			continue
+		}
+		if ni := si.(nodeInfo); ni.offline || !ni.tags.Contains(tag) {
+			continue
+		}
+		b, err := json.Marshal(req)
+		if err != nil {
+			return false
+		}
+		mset.outq.send(newJSPubMsg(fmt.Sprintf(jsDirectGetRouteT, name, p.ID), _EMPTY_, reply, nil, b, nil, 0))
+		return true
+	}
+	// No replica tagged for the token, so we serve it ourselves.
+	return false
+}
+
+// processRoutedDirectGetRequest handles direct gets routed to us by another replica.
+// These are never routed again.
+func (mset *stream) processRoutedDirectGetRequest(sub *subscription, c *client, acc *Account, subject, reply string, rmsg []byte) {
+	mset.handleDirectGetRequest(c, reply, rmsg, false)
+}
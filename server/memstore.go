@@ -37,6 +37,9 @@ type memStore struct {
 	maxp        int64
 	scb         StorageUpdateHandler
 	ageChk      *time.Timer
+	ttls        msgTTLs
+	ttlChk      *time.Timer
+	ttlNext     int64
 	consumers   int
 	receivedAny bool
 }
@@ -72,10 +75,23 @@ func (ms *memStore) UpdateConfig(cfg *StreamConfig) error {
 	}
 
 	ms.mu.Lock()
+	ttlEnabled := cfg.AllowMsgTTL && !ms.cfg.AllowMsgTTL
 	ms.cfg = *cfg
+	// Track messages that have a TTL from before it was allowed.
+	if ttlEnabled {
+		for seq, sm := range ms.msgs {
+			if len(sm.hdr) > 0 {
+				if ttl, err := getMessageTTL(sm.hdr); err == nil && ttl > 0 {
+					ms.ttls.add(seq, sm.ts+int64(ttl))
+				}
+			}
+		}
+		ms.resetTTLChk()
+	}
 	// Limits checks and enforcement.
 	ms.enforceMsgLimit()
 	ms.enforceBytesLimit()
+	ms.enforceSubjectLimits(_EMPTY_)
 	// Do age timers.
 	if ms.ageChk == nil && ms.cfg.MaxAge != 0 {
 		ms.startAgeChk()
@@ -206,11 +222,20 @@ func (ms *memStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts int
 	// Limits checks and enforcement.
 	ms.enforceMsgLimit()
 	ms.enforceBytesLimit()
+	ms.enforceSubjectLimits(subj)
 
 	// Check if we have and need the age expiration timer running.
 	if ms.ageChk == nil && ms.cfg.MaxAge != 0 {
 		ms.startAgeChk()
 	}
+
+	// Track the expiration of messages with a TTL.
+	if ms.cfg.AllowMsgTTL && len(hdr) > 0 {
+		if ttl, err := getMessageTTL(hdr); err == nil && ttl > 0 {
+			ms.ttls.add(seq, ts+int64(ttl))
+			ms.resetTTLChk()
+		}
+	}
 	return nil
 }
 
@@ -695,6 +720,22 @@ func (ms *memStore) enforcePerSubjectLimit(subj string, ss *SimpleState) {
 	}
 }
 
+// Will check the limits of the subject groups the subject belongs to and drop
+// the oldest msgs of a group if needed. An empty subject checks all groups.
+// Lock should be held.
+func (ms *memStore) enforceSubjectLimits(subj string) {
+	for _, sl := range ms.cfg.SubjectLimits {
+		if subj != _EMPTY_ && !subjectIsSubsetMatch(subj, sl.Filter) {
+			continue
+		}
+		for ss := ms.filteredStateLocked(0, sl.Filter, false); ss.Msgs > uint64(sl.MaxMsgs); ss = ms.filteredStateLocked(0, sl.Filter, false) {
+			if !ms.removeMsg(ss.First, false) {
+				break
+			}
+		}
+	}
+}
+
 // Will check the msg limit and drop firstSeq msg if needed.
 // Lock should be held.
 func (ms *memStore) enforceMsgLimit() {
@@ -793,6 +834,43 @@ func (ms *memStore) expireMsgs() {
 	}
 }
 
+// Will arm the TTL timer for the earliest expiration, if it is not armed earlier already.
+// Lock should be held.
+func (ms *memStore) resetTTLChk() {
+	next := ms.ttls.next()
+	if next == 0 {
+		if ms.ttlChk != nil {
+			ms.ttlChk.Stop()
+			ms.ttlChk = nil
+		}
+		ms.ttlNext = 0
+		return
+	}
+	if ms.ttlChk != nil && ms.ttlNext != 0 && ms.ttlNext <= next {
+		return
+	}
+	ms.ttlNext = next
+	if fireIn := msgTTLFireIn(next); ms.ttlChk != nil {
+		ms.ttlChk.Reset(fireIn)
+	} else {
+		ms.ttlChk = time.AfterFunc(fireIn, ms.expireTTLs)
+	}
+}
+
+// Will expire msgs whose TTL has passed.
+func (ms *memStore) expireTTLs() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.msgs == nil {
+		return
+	}
+	ms.ttlNext = 0
+	for _, seq := range ms.ttls.expired(time.Now().UnixNano()) {
+		ms.removeMsg(seq, false)
+	}
+	ms.resetTTLChk()
+}
+
 // PurgeEx will remove messages based on subject filters, sequence and number of messages to keep.
 // Will return the number of purged messages.
 func (ms *memStore) PurgeEx(subject string, sequence, keep uint64) (purged uint64, err error) {
@@ -1406,6 +1484,11 @@ func (ms *memStore) Stop() error {
 		ms.ageChk.Stop()
 		ms.ageChk = nil
 	}
+	if ms.ttlChk != nil {
+		ms.ttlChk.Stop()
+		ms.ttlChk = nil
+	}
+	ms.ttls = nil
 	ms.msgs = nil
 	ms.mu.Unlock()
 	return nil
@@ -1569,6 +1652,14 @@ func (o *consumerMemStore) Update(state *ConsumerState) error {
 	return nil
 }
 
+// Reset will replace our state, even if it is older than the one we have.
+func (o *consumerMemStore) Reset(state *ConsumerState) error {
+	o.mu.Lock()
+	o.state.Delivered, o.state.AckFloor = SequencePair{}, SequencePair{}
+	o.mu.Unlock()
+	return o.Update(state)
+}
+
 // SetStarting sets our starting stream sequence.
 func (o *consumerMemStore) SetStarting(sseq uint64) error {
 	o.mu.Lock()
@@ -1606,6 +1697,10 @@ func (o *consumerMemStore) UpdateDelivered(dseq, sseq, dc uint64, ts int64) erro
 			if p = o.state.Pending[sseq]; p != nil {
 				// Do not update p.Sequence, that should be the original delivery sequence.
 				p.Timestamp = ts
+			} else if dc == 1 && (o.cfg.Shared || o.cfg.DeliverOrder == DeliverOrderLIFO || o.cfg.DeliverOrder == DeliverOrderHeader) && sseq > o.state.AckFloor.Stream {
+				// Shared consumers deliver the messages released by another one after later ones,
+				// and consumers not delivering in FIFO order deliver older ones after later ones.
+				o.state.Pending[sseq] = &Pending{dseq, ts}
 			}
 		} else {
 			// Add to pending.
@@ -1727,6 +1822,21 @@ func (o *consumerMemStore) UpdateAcks(dseq, sseq uint64) error {
 	return nil
 }
 
+func (o *consumerMemStore) UpdateAcksUpTo(sseq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cfg.AckPolicy != AckExplicit {
+		return ErrNoAckPolicy
+	}
+	// On restarts the old leader may get a replay from the raft logs that are old.
+	if sseq <= o.state.AckFloor.Stream {
+		return nil
+	}
+	o.state.ackUpTo(sseq)
+	return nil
+}
+
 func (o *consumerMemStore) UpdateConfig(cfg *ConsumerConfig) error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
@@ -1077,6 +1077,42 @@ func TestMemStoreDeleteAllFirstSequenceCheck(t *testing.T) {
 	require_Equal(t, state.Msgs, 0)
 }
 
+func TestMemStoreDiscardNewPerSubject(t *testing.T) {
+	cfg := &StreamConfig{
+		Name:          "zzz",
+		Subjects:      []string{"kv.>"},
+		Storage:       MemoryStorage,
+		Discard:       DiscardNew,
+		DiscardNewPer: true,
+		MaxMsgsPer:    2,
+	}
+	ms, err := newMemStore(cfg)
+	require_NoError(t, err)
+	defer ms.Stop()
+
+	for i := 0; i < 2; i++ {
+		_, _, err = ms.StoreMsg("kv.a", nil, []byte("value"))
+		require_NoError(t, err)
+	}
+	// At its cap the subject rejects new messages instead of evicting the oldest.
+	_, _, err = ms.StoreMsg("kv.a", nil, []byte("value"))
+	require_Error(t, err, ErrMaxMsgsPerSubject)
+	_, _, err = ms.StoreMsg("kv.b", nil, []byte("value"))
+	require_NoError(t, err)
+
+	var state StreamState
+	ms.FastState(&state)
+	require_Equal(t, state.Msgs, 3)
+	require_Equal(t, state.FirstSeq, 1)
+	require_Equal(t, state.LastSeq, 3)
+
+	// Once a message of the subject is removed there is room again.
+	_, err = ms.RemoveMsg(1)
+	require_NoError(t, err)
+	_, _, err = ms.StoreMsg("kv.a", nil, []byte("value"))
+	require_NoError(t, err)
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // Benchmarks
 ///////////////////////////////////////////////////////////////////////////
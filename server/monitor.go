@@ -655,6 +655,20 @@ func decodeInt(w http.ResponseWriter, r *http.Request, param string) (int, error
 	return val, nil
 }
 
+func decodeDuration(w http.ResponseWriter, r *http.Request, param string) (time.Duration, error) {
+	str := r.URL.Query().Get(param)
+	if str == _EMPTY_ {
+		return 0, nil
+	}
+	val, err := time.ParseDuration(str)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Error decoding duration for '%s': %v", param, err)))
+		return 0, err
+	}
+	return val, nil
+}
+
 func decodeState(w http.ResponseWriter, r *http.Request) (ConnState, error) {
 	str := r.URL.Query().Get("state")
 	if str == _EMPTY_ {
@@ -1102,6 +1116,148 @@ func (s *Server) HandleSubsz(w http.ResponseWriter, r *http.Request) {
 	ResponseHandler(w, r, b)
 }
 
+// InterestzOptions are the options passed to Interestz.
+type InterestzOptions struct {
+	// Account the message would be published in.
+	Account string `json:"account"`
+
+	// Subject of the message. Needs to be literal since it signifies a publish subject.
+	Subject string `json:"subject"`
+}
+
+// Interestz shows what on this server has interest in a message published to a
+// subject of an account, the streams that would store it, their consumers that
+// would match it, and the subscriptions and remotes it would be delivered to.
+type Interestz struct {
+	ID            string            `json:"server_id"`
+	Now           time.Time         `json:"now"`
+	Account       string            `json:"account"`
+	Subject       string            `json:"subject"`
+	Streams       []InterestzStream `json:"streams,omitempty"`
+	Subscriptions []SubDetail       `json:"subscriptions,omitempty"`
+	Leafnodes     []InterestzRemote `json:"leafnodes,omitempty"`
+	Routes        []InterestzRemote `json:"routes,omitempty"`
+	Gateways      []InterestzRemote `json:"gateways,omitempty"`
+}
+
+// InterestzStream is a stream that would store the message.
+type InterestzStream struct {
+	Name string `json:"name"`
+	// Subject the message would be stored under, after any subject transform.
+	Subject string `json:"subject"`
+	// Consumers with a filter that matches the stored subject.
+	Consumers []string `json:"consumers,omitempty"`
+}
+
+// InterestzRemote is a leafnode, route or gateway connection the message would be sent to.
+type InterestzRemote struct {
+	Name     string   `json:"name"`
+	Cid      uint64   `json:"cid"`
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+// Interestz returns what on this server has interest in a message published to
+// the subject of the account. This helps to find where messages end up when
+// subject spaces overlap.
+func (s *Server) Interestz(opts *InterestzOptions) (*Interestz, error) {
+	if opts == nil || opts.Account == _EMPTY_ {
+		return nil, fmt.Errorf("account is required")
+	}
+	if !IsValidLiteralSubject(opts.Subject) {
+		return nil, fmt.Errorf("subject %q is not a valid publish subject", opts.Subject)
+	}
+	acc, err := s.lookupAccount(opts.Account)
+	if err != nil {
+		return nil, err
+	}
+	iz := &Interestz{
+		ID:      s.ID(),
+		Now:     time.Now().UTC(),
+		Account: acc.Name,
+		Subject: opts.Subject,
+	}
+	subject := opts.Subject
+
+	// Streams that would store the message, and which of their consumers match.
+	for _, mset := range acc.streams() {
+		mset.mu.RLock()
+		var captured bool
+		for _, subj := range mset.cfg.Subjects {
+			if subjectIsSubsetMatch(subject, subj) {
+				captured = true
+				break
+			}
+		}
+		if !captured || (mset.shard != nil && !mset.shard.owns(subject)) {
+			mset.mu.RUnlock()
+			continue
+		}
+		is := InterestzStream{Name: mset.cfg.Name, Subject: subject}
+		if mset.itr != nil {
+			if tsubj, err := mset.itr.Match(subject); err == nil {
+				is.Subject = tsubj
+			}
+		}
+		for _, o := range mset.consumers {
+			o.mu.RLock()
+			if o.isFilteredMatch(is.Subject) {
+				is.Consumers = append(is.Consumers, o.name)
+			}
+			o.mu.RUnlock()
+		}
+		mset.mu.RUnlock()
+		slices.Sort(is.Consumers)
+		iz.Streams = append(iz.Streams, is)
+	}
+	slices.SortFunc(iz.Streams, func(a, b InterestzStream) int { return strings.Compare(a.Name, b.Name) })
+
+	// Subscriptions of clients, leafnodes and routes.
+	addRemote := func(remotes *[]InterestzRemote, name string, cid uint64, subj string) {
+		for i := range *remotes {
+			if r := &(*remotes)[i]; r.Cid == cid {
+				r.Subjects = append(r.Subjects, subj)
+				return
+			}
+		}
+		*remotes = append(*remotes, InterestzRemote{Name: name, Cid: cid, Subjects: []string{subj}})
+	}
+	addSub := func(sub *subscription) {
+		c := sub.client
+		if c == nil {
+			return
+		}
+		c.mu.Lock()
+		switch c.kind {
+		case CLIENT:
+			iz.Subscriptions = append(iz.Subscriptions, newSubDetail(sub))
+		case LEAF:
+			addRemote(&iz.Leafnodes, c.leaf.remoteServer, c.cid, string(sub.subject))
+		case ROUTER:
+			addRemote(&iz.Routes, c.route.remoteName, c.cid, string(sub.subject))
+		}
+		c.mu.Unlock()
+	}
+	r := acc.sl.Match(subject)
+	for _, sub := range r.psubs {
+		addSub(sub)
+	}
+	for _, qsubs := range r.qsubs {
+		for _, sub := range qsubs {
+			addSub(sub)
+		}
+	}
+
+	// Gateways that would be sent the message.
+	var gws []*client
+	s.getOutboundGatewayConnections(&gws)
+	for _, c := range gws {
+		if psi, qr := c.gatewayInterest(acc.Name, []byte(subject)); psi || (qr != nil && len(qr.qsubs) > 0) {
+			iz.Gateways = append(iz.Gateways, InterestzRemote{Name: c.gw.name, Cid: c.cid})
+		}
+	}
+	return iz, nil
+}
+
 // HandleStacksz processes HTTP requests for getting stacks
 func (s *Server) HandleStacksz(w http.ResponseWriter, r *http.Request) {
 	// Do not get any lock here that would prevent getting the stacks
@@ -1123,8 +1279,10 @@ func (s *Server) HandleStacksz(w http.ResponseWriter, r *http.Request) {
 }
 
 type monitorIPQueue struct {
-	Pending    int `json:"pending"`
-	InProgress int `json:"in_progress,omitempty"`
+	Pending    int    `json:"pending"`
+	InProgress int    `json:"in_progress,omitempty"`
+	Dropped    uint64 `json:"dropped,omitempty"`
+	Rejected   uint64 `json:"rejected,omitempty"`
 }
 
 func (s *Server) HandleIPQueuesz(w http.ResponseWriter, r *http.Request) {
@@ -1138,21 +1296,24 @@ func (s *Server) HandleIPQueuesz(w http.ResponseWriter, r *http.Request) {
 
 	s.ipQueues.Range(func(k, v any) bool {
 		var pending, inProgress int
+		var dropped, rejected uint64
 		name := k.(string)
 		queue, ok := v.(interface {
 			len() int
 			inProgress() int64
+			limitStats() (uint64, uint64)
 		})
 		if ok {
 			pending = queue.len()
 			inProgress = int(queue.inProgress())
+			dropped, rejected = queue.limitStats()
 		}
-		if !all && (pending == 0 && inProgress == 0) {
+		if !all && (pending == 0 && inProgress == 0 && dropped == 0 && rejected == 0) {
 			return true
 		} else if qfilter != _EMPTY_ && !strings.Contains(name, qfilter) {
 			return true
 		}
-		queues[name] = monitorIPQueue{Pending: pending, InProgress: inProgress}
+		queues[name] = monitorIPQueue{Pending: pending, InProgress: inProgress, Dropped: dropped, Rejected: rejected}
 		return true
 	})
 
@@ -1228,10 +1389,26 @@ type Varz struct {
 
 // JetStreamVarz contains basic runtime information about jetstream
 type JetStreamVarz struct {
-	Config *JetStreamConfig `json:"config,omitempty"`
-	Stats  *JetStreamStats  `json:"stats,omitempty"`
-	Meta   *MetaClusterInfo `json:"meta,omitempty"`
-	Limits *JSLimitOpts     `json:"limits,omitempty"`
+	Config      *JetStreamConfig      `json:"config,omitempty"`
+	Stats       *JetStreamStats       `json:"stats,omitempty"`
+	Meta        *MetaClusterInfo      `json:"meta,omitempty"`
+	Limits      *JSLimitOpts          `json:"limits,omitempty"`
+	Maintenance *JetStreamMaintenance `json:"maintenance,omitempty"`
+	Summary     *JetStreamSummary     `json:"summary,omitempty"`
+}
+
+// JetStreamSummary is a compact view of jetstream health on this server,
+// so it can be scraped from varz without a request to jsz.
+type JetStreamSummary struct {
+	Enabled    bool   `json:"enabled"`
+	Domain     string `json:"domain,omitempty"`
+	Streams    int    `json:"streams"`
+	Consumers  int    `json:"consumers"`
+	Memory     uint64 `json:"memory"`
+	MaxMemory  int64  `json:"max_memory"`
+	Store      uint64 `json:"storage"`
+	MaxStore   int64  `json:"max_storage"`
+	MetaLeader string `json:"meta_leader,omitempty"`
 }
 
 // ClusterOptsVarz contains monitoring cluster information
@@ -1448,19 +1625,47 @@ func (s *Server) HandleRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) updateJszVarz(js *jetStream, v *JetStreamVarz, doConfig bool) {
+	js.mu.RLock()
 	if doConfig {
-		js.mu.RLock()
 		// We want to snapshot the config since it will then be available outside
 		// of the js lock. So make a copy first, then point to this copy.
 		cfg := js.config
 		v.Config = &cfg
-		js.mu.RUnlock()
 	}
+	summary := &JetStreamSummary{
+		Enabled:   true,
+		Domain:    js.config.Domain,
+		MaxMemory: js.config.MaxMemory,
+		MaxStore:  js.config.MaxStore,
+	}
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	js.mu.RUnlock()
+
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		streams := make([]*stream, 0, len(jsa.streams))
+		for _, mset := range jsa.streams {
+			streams = append(streams, mset)
+		}
+		jsa.mu.RUnlock()
+		summary.Streams += len(streams)
+		for _, mset := range streams {
+			summary.Consumers += mset.state().Consumers
+		}
+	}
+
 	v.Stats = js.usageStats()
+	summary.Memory, summary.Store = v.Stats.Memory, v.Stats.Store
+	v.Summary = summary
 	v.Limits = &s.getOpts().JetStreamLimits
+	v.Maintenance = js.maintenance()
 	if mg := js.getMetaGroup(); mg != nil {
 		if ci := s.raftNodeToClusterInfo(mg); ci != nil {
 			v.Meta = &MetaClusterInfo{Name: ci.Name, Leader: ci.Leader, Peer: getHash(ci.Leader), Size: mg.ClusterSize()}
+			summary.MetaLeader = ci.Leader
 			if ci.Leader == s.info.Name {
 				v.Meta.Replicas = ci.Replicas
 			}
@@ -1488,6 +1693,8 @@ func (s *Server) Varz(varzOpts *VarzOptions) (*Varz, error) {
 
 	if js := s.getJetStream(); js != nil {
 		s.updateJszVarz(js, &v.JetStream, true)
+	} else {
+		v.JetStream.Summary = &JetStreamSummary{}
 	}
 
 	return v, nil
@@ -1841,6 +2048,12 @@ func (s *Server) HandleVarz(w http.ResponseWriter, r *http.Request) {
 		sv.Stats = v.Stats
 		sv.Meta = v.Meta
 		sv.Limits = v.Limits
+		sv.Maintenance = v.Maintenance
+		sv.Summary = v.Summary
+		s.mu.RUnlock()
+	} else {
+		s.mu.RLock()
+		s.varz.JetStream.Summary = &JetStreamSummary{}
 		s.mu.RUnlock()
 	}
 
@@ -2747,6 +2960,7 @@ type JSzOptions struct {
 	Limit            int    `json:"limit,omitempty"`
 	RaftGroups       bool   `json:"raft,omitempty"`
 	StreamLeaderOnly bool   `json:"stream_leader_only,omitempty"`
+	StorageStats     bool   `json:"storage_stats,omitempty"`
 }
 
 // HealthzOptions are options passed to Healthz
@@ -2759,6 +2973,14 @@ type HealthzOptions struct {
 	Stream        string `json:"stream,omitempty"`
 	Consumer      string `json:"consumer,omitempty"`
 	Details       bool   `json:"details,omitempty"`
+	// Sources will include the status of stream mirrors and sources.
+	Sources bool `json:"sources,omitempty"`
+	// SourceMaxLag is the maximum lag allowed for a mirror or source when
+	// Sources is set. Zero means lag is not checked.
+	SourceMaxLag uint64 `json:"source-max-lag,omitempty"`
+	// SourceMaxInactive is the maximum time a mirror or source can go without
+	// any activity when Sources is set. Zero means use the default.
+	SourceMaxInactive time.Duration `json:"source-max-inactive,omitempty"`
 }
 
 // ProfilezOptions are options passed to Profilez
@@ -2770,16 +2992,19 @@ type ProfilezOptions struct {
 
 // StreamDetail shows information about the stream state and its consumers.
 type StreamDetail struct {
-	Name               string              `json:"name"`
-	Created            time.Time           `json:"created"`
-	Cluster            *ClusterInfo        `json:"cluster,omitempty"`
-	Config             *StreamConfig       `json:"config,omitempty"`
-	State              StreamState         `json:"state,omitempty"`
-	Consumer           []*ConsumerInfo     `json:"consumer_detail,omitempty"`
-	Mirror             *StreamSourceInfo   `json:"mirror,omitempty"`
-	Sources            []*StreamSourceInfo `json:"sources,omitempty"`
-	RaftGroup          string              `json:"stream_raft_group,omitempty"`
-	ConsumerRaftGroups []*RaftGroupDetail  `json:"consumer_raft_groups,omitempty"`
+	Name               string                `json:"name"`
+	Created            time.Time             `json:"created"`
+	Cluster            *ClusterInfo          `json:"cluster,omitempty"`
+	Config             *StreamConfig         `json:"config,omitempty"`
+	State              StreamState           `json:"state,omitempty"`
+	Consumer           []*ConsumerInfo       `json:"consumer_detail,omitempty"`
+	Mirror             *StreamSourceInfo     `json:"mirror,omitempty"`
+	Sources            []*StreamSourceInfo   `json:"sources,omitempty"`
+	RaftGroup          string                `json:"stream_raft_group,omitempty"`
+	ConsumerRaftGroups []*RaftGroupDetail    `json:"consumer_raft_groups,omitempty"`
+	Rejections         *StreamRejections     `json:"rejections,omitempty"`
+	StorageFailure     *StreamStorageFailure `json:"storage_failure,omitempty"`
+	StorageStats       *StreamStorageStats   `json:"storage_stats,omitempty"`
 }
 
 // RaftGroupDetail shows information details about the Raft group.
@@ -2793,6 +3018,10 @@ type AccountDetail struct {
 	Id   string `json:"id"`
 	JetStreamStats
 	Streams []StreamDetail `json:"stream_detail,omitempty"`
+	// APIQueue shows how the routed API requests of the account were scheduled.
+	APIQueue *JSAccountAPIQueueStats `json:"api_queue,omitempty"`
+	// Delivery shows how long the streams of the account waited to deliver, if bounded.
+	Delivery *JSAccountDeliveryStats `json:"delivery,omitempty"`
 }
 
 // MetaClusterInfo shows information about the meta group.
@@ -2812,6 +3041,8 @@ type JSInfo struct {
 	Disabled bool            `json:"disabled,omitempty"`
 	Config   JetStreamConfig `json:"config,omitempty"`
 	Limits   *JSLimitOpts    `json:"limits,omitempty"`
+	// Maintenance is set while JetStream on this server is in maintenance mode.
+	Maintenance *JetStreamMaintenance `json:"maintenance,omitempty"`
 	JetStreamStats
 	Streams   int              `json:"streams"`
 	Consumers int              `json:"consumers"`
@@ -2823,7 +3054,7 @@ type JSInfo struct {
 	AccountDetails []*AccountDetail `json:"account_details,omitempty"`
 }
 
-func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg, optRaft, optStreamLeader bool) *AccountDetail {
+func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg, optRaft, optStreamLeader, optStorage bool) *AccountDetail {
 	jsa.mu.RLock()
 	acc := jsa.account
 	name := acc.GetName()
@@ -2844,7 +3075,9 @@ func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg,
 				Errors: jsa.apiErrors,
 			},
 		},
-		Streams: make([]StreamDetail, 0, len(jsa.streams)),
+		Streams:  make([]StreamDetail, 0, len(jsa.streams)),
+		APIQueue: s.jsAPIRoutedReqs.accountStats(id),
+		Delivery: jsa.delivery.stats(),
 	}
 	if reserved, ok := jsa.limits[_EMPTY_]; ok {
 		detail.JetStreamStats.ReservedMemory = uint64(reserved.MaxMemory)
@@ -2874,13 +3107,18 @@ func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg,
 				continue
 			}
 			sdet := StreamDetail{
-				Name:    stream.name(),
-				Created: stream.createdTime(),
-				State:   stream.state(),
-				Cluster: ci,
-				Config:  cfg,
-				Mirror:  stream.mirrorInfo(),
-				Sources: stream.sourcesInfo(),
+				Name:           stream.name(),
+				Created:        stream.createdTime(),
+				State:          stream.state(),
+				Cluster:        ci,
+				Config:         cfg,
+				Mirror:         stream.mirrorInfo(),
+				Sources:        stream.sourcesInfo(),
+				Rejections:     stream.rejections(),
+				StorageFailure: stream.storageFailure(),
+			}
+			if optStorage {
+				sdet.StorageStats = stream.storageStats()
 			}
 			if optRaft && rgroup != nil {
 				sdet.RaftGroup = rgroup.Name
@@ -2928,7 +3166,7 @@ func (s *Server) JszAccount(opts *JSzOptions) (*AccountDetail, error) {
 	if !ok {
 		return nil, fmt.Errorf("account %q not jetstream enabled", acc)
 	}
-	return s.accountDetail(jsa, opts.Streams, opts.Consumer, opts.Config, opts.RaftGroups, opts.StreamLeaderOnly), nil
+	return s.accountDetail(jsa, opts.Streams, opts.Consumer, opts.Config, opts.RaftGroups, opts.StreamLeaderOnly, opts.StorageStats), nil
 }
 
 // helper to get cluster info from node via dummy group
@@ -2992,6 +3230,8 @@ func (s *Server) Jsz(opts *JSzOptions) (*JSInfo, error) {
 
 	var accounts []*jsAccount
 
+	jsi.Maintenance = js.maintenance()
+
 	js.mu.RLock()
 	jsi.Config = js.config
 	for _, info := range js.accounts {
@@ -3058,7 +3298,7 @@ func (s *Server) Jsz(opts *JSzOptions) (*JSInfo, error) {
 	}
 	// if wanted, obtain accounts/streams/consumer
 	for _, jsa := range accounts {
-		detail := s.accountDetail(jsa, opts.Streams, opts.Consumer, opts.Config, opts.RaftGroups, opts.StreamLeaderOnly)
+		detail := s.accountDetail(jsa, opts.Streams, opts.Consumer, opts.Config, opts.RaftGroups, opts.StreamLeaderOnly, opts.StorageStats)
 		jsi.AccountDetails = append(jsi.AccountDetails, detail)
 	}
 	return jsi, nil
@@ -3107,6 +3347,11 @@ func (s *Server) HandleJsz(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	storage, err := decodeBool(w, r, "storage-stats")
+	if err != nil {
+		return
+	}
+
 	l, err := s.Jsz(&JSzOptions{
 		Account:          r.URL.Query().Get("acc"),
 		Accounts:         accounts,
@@ -3118,6 +3363,7 @@ func (s *Server) HandleJsz(w http.ResponseWriter, r *http.Request) {
 		Limit:            limit,
 		RaftGroups:       rgroups,
 		StreamLeaderOnly: sleader,
+		StorageStats:     storage,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -3228,15 +3474,30 @@ func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+	includeSources, err := decodeBool(w, r, "sources")
+	if err != nil {
+		return
+	}
+	sourceMaxLag, err := decodeUint64(w, r, "source-max-lag")
+	if err != nil {
+		return
+	}
+	sourceMaxInactive, err := decodeDuration(w, r, "source-max-inactive")
+	if err != nil {
+		return
+	}
 
 	hs := s.healthz(&HealthzOptions{
-		JSEnabled:     jsEnabled,
-		JSEnabledOnly: jsEnabledOnly,
-		JSServerOnly:  jsServerOnly,
-		Account:       r.URL.Query().Get("account"),
-		Stream:        r.URL.Query().Get("stream"),
-		Consumer:      r.URL.Query().Get("consumer"),
-		Details:       includeDetails,
+		JSEnabled:         jsEnabled,
+		JSEnabledOnly:     jsEnabledOnly,
+		JSServerOnly:      jsServerOnly,
+		Account:           r.URL.Query().Get("account"),
+		Stream:            r.URL.Query().Get("stream"),
+		Consumer:          r.URL.Query().Get("consumer"),
+		Details:           includeDetails,
+		Sources:           includeSources,
+		SourceMaxLag:      sourceMaxLag,
+		SourceMaxInactive: sourceMaxInactive,
 	})
 
 	code := http.StatusOK
@@ -3417,6 +3678,21 @@ func (s *Server) healthz(opts *HealthzOptions) *HealthStatus {
 					})
 					continue
 				}
+				if opts.Sources {
+					if err := s.checkSourcesHealth(opts.SourceMaxLag, opts.SourceMaxInactive); err != nil {
+						if !details {
+							health.Status = na
+							health.Error = fmt.Sprintf("JetStream stream '%s > %s' %v", acc, stream, err)
+							return health
+						}
+						health.Errors = append(health.Errors, HealthzError{
+							Type:    HealthzErrorStream,
+							Account: acc.Name,
+							Stream:  stream,
+							Error:   fmt.Sprintf("JetStream stream '%s > %s' %v", acc, stream, err),
+						})
+					}
+				}
 				if streamFound {
 					// if consumer option is passed, verify that the consumer exists on stream
 					if opts.Consumer != _EMPTY_ {
@@ -3701,6 +3977,21 @@ func (s *Server) healthz(opts *HealthzOptions) *HealthStatus {
 				continue
 			}
 			mset, _ := acc.lookupStream(stream)
+			if opts.Sources && mset != nil {
+				if err := mset.checkSourcesHealth(opts.SourceMaxLag, opts.SourceMaxInactive); err != nil {
+					if !details {
+						health.Status = na
+						health.Error = fmt.Sprintf("JetStream stream '%s > %s' %v", accName, stream, err)
+						return health
+					}
+					health.Errors = append(health.Errors, HealthzError{
+						Type:    HealthzErrorStream,
+						Account: accName,
+						Stream:  stream,
+						Error:   fmt.Sprintf("JetStream stream '%s > %s' %v", accName, stream, err),
+					})
+				}
+			}
 			// Now check consumers.
 			for consumer, ca := range sa.consumers {
 				if !js.isConsumerHealthy(mset, consumer, ca) {
@@ -3814,6 +4105,7 @@ type RaftzGroup struct {
 	WAL           StreamState               `json:"wal"`
 	WALError      error                     `json:"wal_error,omitempty"`
 	Peers         map[string]RaftzGroupPeer `json:"peers"`
+	Proposals     *RaftzGroupProposals      `json:"proposals,omitempty"`
 }
 
 type RaftzGroupPeer struct {
@@ -3908,6 +4200,7 @@ func (s *Server) HandleRaftz(w http.ResponseWriter, r *http.Request) {
 			IPQApplyLen:   n.apply.len(),
 			WALError:      n.werr,
 			Peers:         map[string]RaftzGroupPeer{},
+			Proposals:     n.proposalStats(),
 		}
 		n.wal.FastState(&info.WAL)
 		for id, p := range n.peers {
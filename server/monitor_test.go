@@ -4113,7 +4113,7 @@ func TestMonitorAccountz(t *testing.T) {
 	body = string(readBody(t, fmt.Sprintf("http://127.0.0.1:%d%s?acc=$SYS", s.MonitorAddr().Port, AccountzPath)))
 	require_Contains(t, body, `"account_detail": {`)
 	require_Contains(t, body, `"account_name": "$SYS",`)
-	require_Contains(t, body, `"subscriptions": 52,`)
+	require_Contains(t, body, `"subscriptions": 55,`)
 	require_Contains(t, body, `"is_system": true,`)
 	require_Contains(t, body, `"system_account": "$SYS"`)
 
@@ -4180,7 +4180,7 @@ func TestMonitorAccountzOperatorMode(t *testing.T) {
 	body = string(readBody(t, fmt.Sprintf("http://127.0.0.1:%d%s?acc=%s", s.MonitorAddr().Port, AccountzPath, sysPub)))
 	require_Contains(t, body, `"account_detail": {`)
 	require_Contains(t, body, fmt.Sprintf(`"account_name": "%s",`, sysPub))
-	require_Contains(t, body, `"subscriptions": 52,`)
+	require_Contains(t, body, `"subscriptions": 55,`)
 	require_Contains(t, body, `"is_system": true,`)
 	require_Contains(t, body, fmt.Sprintf(`"system_account": "%s"`, sysPub))
 
@@ -4408,6 +4408,66 @@ func checkForJSClusterUp(t *testing.T, servers ...*Server) {
 	c.waitOnClusterReady()
 }
 
+func TestMonitorVarzJetStreamSummary(t *testing.T) {
+	resetPreviousHTTPConnections()
+	opts := DefaultMonitorOptions()
+	s := RunServer(opts)
+	defer s.Shutdown()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/varz", s.MonitorAddr().Port)
+	for mode := 0; mode < 2; mode++ {
+		v := pollVarz(t, s, mode, url, nil)
+		require_True(t, v.JetStream.Summary != nil)
+		require_False(t, v.JetStream.Summary.Enabled)
+	}
+	s.Shutdown()
+
+	opts = DefaultMonitorOptions()
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	opts.JetStreamDomain = "HUB"
+	opts.JetStreamMaxMemory = 64 * 1024 * 1024
+	opts.JetStreamMaxStore = 128 * 1024 * 1024
+	s = RunServer(opts)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, name := range []string{"A", "B"} {
+		_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}})
+		require_NoError(t, err)
+	}
+	_, err := js.AddStream(&nats.StreamConfig{Name: "M", Subjects: []string{"m"}, Storage: nats.MemoryStorage})
+	require_NoError(t, err)
+	for _, name := range []string{"C1", "C2"} {
+		_, err = js.AddConsumer("A", &nats.ConsumerConfig{Durable: name, AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("M", &nats.ConsumerConfig{Durable: "C3", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	_, err = js.Publish("a", []byte("hello"))
+	require_NoError(t, err)
+	_, err = js.Publish("m", []byte("hello"))
+	require_NoError(t, err)
+
+	url = fmt.Sprintf("http://127.0.0.1:%d/varz", s.MonitorAddr().Port)
+	for mode := 0; mode < 2; mode++ {
+		sum := pollVarz(t, s, mode, url, nil).JetStream.Summary
+		require_True(t, sum != nil)
+		require_True(t, sum.Enabled)
+		require_Equal(t, sum.Domain, "HUB")
+		require_Equal(t, sum.Streams, 3)
+		require_Equal(t, sum.Consumers, 3)
+		require_True(t, sum.Memory > 0)
+		require_True(t, sum.Store > 0)
+		require_Equal(t, sum.MaxMemory, opts.JetStreamMaxMemory)
+		require_Equal(t, sum.MaxStore, opts.JetStreamMaxStore)
+		// Not clustered, so there is no meta leader.
+		require_Equal(t, sum.MetaLeader, _EMPTY_)
+	}
+}
+
 func TestMonitorJszNonJszServer(t *testing.T) {
 	srv := RunServer(DefaultOptions())
 	defer srv.Shutdown()
@@ -4652,6 +4712,21 @@ func TestMonitorJsz(t *testing.T) {
 			}
 		}
 	})
+	t.Run("storage-stats", func(t *testing.T) {
+		for _, url := range []string{monUrl1, monUrl2} {
+			info := readJsInfo(url + "?acc=ACC&streams=true")
+			require_True(t, len(info.AccountDetails) == 1 && len(info.AccountDetails[0].Streams) > 0)
+			for _, sd := range info.AccountDetails[0].Streams {
+				require_True(t, sd.StorageStats == nil)
+			}
+			info = readJsInfo(url + "?acc=ACC&streams=true&storage-stats=true")
+			require_True(t, len(info.AccountDetails) == 1 && len(info.AccountDetails[0].Streams) > 0)
+			for _, sd := range info.AccountDetails[0].Streams {
+				require_True(t, sd.StorageStats != nil)
+				require_Equal(t, sd.StorageStats.Writes, sd.State.Msgs)
+			}
+		}
+	})
 	t.Run("consumers", func(t *testing.T) {
 		for _, url := range []string{monUrl1, monUrl2} {
 			info := readJsInfo(url + "?acc=ACC&consumers=true")
@@ -4800,6 +4875,19 @@ func TestMonitorJsz(t *testing.T) {
 			require_Equal(t, info.API.Level, JSApiLevel)
 		}
 	})
+	t.Run("varz-summary", func(t *testing.T) {
+		for _, port := range []int{7501, 5501} {
+			info := readJsInfo(fmt.Sprintf("http://127.0.0.1:%d/jsz", port))
+			v := &Varz{}
+			require_NoError(t, json.Unmarshal(readBody(t, fmt.Sprintf("http://127.0.0.1:%d/varz", port)), v))
+			sum := v.JetStream.Summary
+			require_True(t, sum != nil)
+			require_True(t, sum.Enabled)
+			require_Equal(t, sum.Streams, info.Streams)
+			require_Equal(t, sum.Consumers, info.Consumers)
+			require_Equal(t, sum.MetaLeader, info.Meta.Leader)
+		}
+	})
 }
 
 func TestMonitorReloadTLSConfig(t *testing.T) {
@@ -5532,6 +5620,7 @@ func TestIpqzWithGenerics(t *testing.T) {
 	require_NoError(t, json.Unmarshal(body, &queues))
 	require_True(t, len(queues) >= 4)
 	require_True(t, queues["SendQ"] != nil)
+	require_True(t, queues["Routed JS API Requests"] != nil)
 }
 
 func TestVarzSyncInterval(t *testing.T) {
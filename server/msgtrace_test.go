@@ -3793,8 +3793,9 @@ func TestMsgTraceJetStreamWithSuperCluster(t *testing.T) {
 					switch subtest.special {
 					case 1:
 						// Update stream to prevent rollups, and set a max size.
+						// Stored messages over it would be removed, so keep it above those.
 						cfg.AllowRollup = false
-						cfg.MaxMsgSize = 100
+						cfg.MaxMsgSize = 250
 						_, err = js.UpdateStream(cfg)
 						require_NoError(t, err)
 					case 2:
@@ -0,0 +1,103 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Minimum per message TTL.
+const minMsgTTL = time.Second
+
+var errMsgTTLInvalid = errors.New("message TTL is invalid")
+
+// Returns the TTL of the message from the Nats-TTL header, 0 if it has none.
+// The TTL is either a number of seconds or a duration, e.g. "30s" or "1h".
+func getMessageTTL(hdr []byte) (time.Duration, error) {
+	v := getHeader(JSMessageTTL, hdr)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	var ttl time.Duration
+	if secs, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+		if secs > math.MaxInt64/int64(time.Second) {
+			return 0, errMsgTTLInvalid
+		}
+		ttl = time.Duration(secs) * time.Second
+	} else if ttl, err = time.ParseDuration(string(v)); err != nil {
+		return 0, errMsgTTLInvalid
+	}
+	if ttl < minMsgTTL {
+		return 0, errMsgTTLInvalid
+	}
+	return ttl, nil
+}
+
+// msgTTL is the expiration of a message with a TTL.
+type msgTTL struct {
+	seq     uint64
+	expires int64
+}
+
+// msgTTLs tracks the expirations of messages with a TTL, earliest first.
+// Messages removed otherwise are not tracked, so stores ignore expired
+// sequences that are no longer there.
+type msgTTLs []msgTTL
+
+func (t msgTTLs) Len() int           { return len(t) }
+func (t msgTTLs) Less(i, j int) bool { return t[i].expires < t[j].expires }
+func (t msgTTLs) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t *msgTTLs) Push(x any)        { *t = append(*t, x.(msgTTL)) }
+func (t *msgTTLs) Pop() any {
+	old := *t
+	n := len(old)
+	x := old[n-1]
+	*t = old[:n-1]
+	return x
+}
+
+// Tracks the expiration of the message.
+func (t *msgTTLs) add(seq uint64, expires int64) {
+	heap.Push(t, msgTTL{seq, expires})
+}
+
+// Returns the earliest expiration, 0 if none are tracked.
+func (t msgTTLs) next() int64 {
+	if len(t) == 0 {
+		return 0
+	}
+	return t[0].expires
+}
+
+// Removes and returns the sequences that expired by now.
+func (t *msgTTLs) expired(now int64) []uint64 {
+	var seqs []uint64
+	for len(*t) > 0 && (*t)[0].expires <= now {
+		seqs = append(seqs, heap.Pop(t).(msgTTL).seq)
+	}
+	return seqs
+}
+
+// Returns when the sweep of messages expiring at the given time should fire.
+func msgTTLFireIn(expires int64) time.Duration {
+	fireIn := time.Duration(expires - time.Now().UnixNano())
+	if fireIn < 0 {
+		fireIn = 0
+	}
+	return fireIn
+}
@@ -9284,11 +9284,14 @@ func TestNoRaceJetStreamMirrorAndSourceConsumerFailBackoff(t *testing.T) {
 	// Check calculations first.
 	for i := 1; i <= 20; i++ {
 		backoff := calculateRetryBackoff(i)
-		if i < 12 {
-			require_Equal(t, backoff, time.Duration(i)*10*time.Second)
+		if i < 5 {
+			require_Equal(t, backoff, time.Duration(1<<(i-1))*10*time.Second)
 		} else {
 			require_Equal(t, backoff, retryMaximum)
 		}
+		jitter := calculateRetryJitter(backoff)
+		require_True(t, jitter >= 100*time.Millisecond)
+		require_True(t, jitter <= 200*time.Millisecond+backoff/10)
 	}
 
 	c := createJetStreamClusterExplicit(t, "R3S", 3)
@@ -9362,6 +9365,7 @@ func TestNoRaceJetStreamMirrorAndSourceConsumerFailBackoff(t *testing.T) {
 	fails := mset.mirror.fails
 	mset.mu.RUnlock()
 	require_Equal(t, fails, 1)
+	require_Equal(t, mset.mirrorInfo().Retries, 1)
 
 	mset, err = c.streamLeader(globalAccountName, "SOURCE").GlobalAccount().lookupStream("SOURCE")
 	require_NoError(t, err)
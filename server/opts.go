@@ -252,6 +252,17 @@ type JSLimitOpts struct {
 	MaxAckPending   int           `json:"max_ack_pending,omitempty"`
 	MaxHAAssets     int           `json:"max_ha_assets,omitempty"`
 	Duplicates      time.Duration `json:"max_duplicate_window,omitempty"`
+	MaxResponseSize int           `json:"max_response_size,omitempty"`
+}
+
+// JSRemoteOpts allows streams to reach an external NATS system over the
+// leafnode remote that connects this server to it.
+type JSRemoteOpts struct {
+	// Account is the local account of the leafnode remote. Streams subscribe
+	// and publish in this account to reach the external system.
+	Account string `json:"account"`
+	// Accounts whose streams may use this remote.
+	Accounts []string `json:"accounts,omitempty"`
 }
 
 type JSTpmOpts struct {
@@ -261,6 +272,17 @@ type JSTpmOpts struct {
 	Pcr         int
 }
 
+// JSTierOpts configures the S3 compatible object store that file stores
+// offload aged message blocks to, see StreamTiering.
+type JSTierOpts struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
 // AuthCallout option used to map external AuthN to NATS based AuthZ.
 type AuthCallout struct {
 	// Must be a public account Nkey.
@@ -331,9 +353,15 @@ type Options struct {
 	JetStreamKey               string        `json:"-"`
 	JetStreamOldKey            string        `json:"-"`
 	JetStreamCipher            StoreCipher   `json:"-"`
+	JetStreamEncryptSnapshots  bool          `json:"-"`
+	JetStreamPreallocate       bool          `json:"-"`
+	JetStreamIndexDir          string        `json:"-"`
+	JetStreamDirectIO          bool          `json:"-"`
+	JetStreamMaxBlocks         int           `json:"-"`
 	JetStreamUniqueTag         string
 	JetStreamLimits            JSLimitOpts
 	JetStreamTpm               JSTpmOpts
+	JetStreamTier              JSTierOpts
 	JetStreamMaxCatchup        int64
 	JetStreamRequestQueueLimit int64
 	StreamMaxBufferedMsgs      int               `json:"-"`
@@ -406,6 +434,35 @@ type Options struct {
 	// DisableJetStreamBanner will not print the ascii art on startup for JetStream enabled servers
 	DisableJetStreamBanner bool `json:"-"`
 
+	// JetStreamStorageErrors overrides the action taken for each class of storage errors.
+	JetStreamStorageErrors map[StorageErrorClass]StorageErrorAction `json:"-"`
+
+	// JetStreamBackupDir is where scheduled stream backups to local paths are written.
+	JetStreamBackupDir string `json:"-"`
+
+	// JetStreamMaxRestoreRate limits how fast restores receive snapshots in bytes per second.
+	JetStreamMaxRestoreRate int64 `json:"-"`
+
+	// JetStreamStatsInterval enables sampling of stream statistics at this interval.
+	JetStreamStatsInterval time.Duration `json:"-"`
+	// JetStreamStatsSamples is how many samples are kept for each stream.
+	JetStreamStatsSamples int `json:"-"`
+
+	// JetStreamQueueLimits bounds the internal queues used by JetStream.
+	JetStreamQueueLimits JSQueueLimits `json:"-"`
+
+	// JetStreamAccountIsolation bounds what a single account can use of the routed JetStream API processing
+	// and of the message delivery of its streams. Requests of local clients are not covered.
+	JetStreamAccountIsolation JSAccountIsolation `json:"-"`
+
+	// JetStreamRaftWAL tunes the raft write ahead logs of streams and consumers.
+	JetStreamRaftWAL JSRaftWAL `json:"-"`
+
+	// JetStreamRemotes are the external NATS systems streams may ingest from and
+	// push to, by the name streams refer to them with. Streams can not connect
+	// to external systems unless they are listed here.
+	JetStreamRemotes map[string]*JSRemoteOpts `json:"-"`
+
 	// ConnectErrorReports specifies the number of failed attempts
 	// at which point server should report the failure of an initial
 	// connection to a route, gateway or leaf node.
@@ -2164,6 +2221,37 @@ func parseJetStreamForAccount(v any, acc *Account, errors *[]error) error {
 					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
 				}
 				jsLimits.MaxAckPending = int(vv)
+			case "proposal_weight":
+				vv, ok := mv.(int64)
+				if !ok || vv < 1 {
+					return &configErr{tk, fmt.Sprintf("Expected a positive number for %q, got %v", mk, mv)}
+				}
+				acc.nrgWeight = int(vv)
+			case "sync", "sync_interval":
+				vv, ok := mv.(string)
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a duration for %q, got %v", mk, mv)}
+				}
+				dur, err := time.ParseDuration(vv)
+				if err == nil {
+					err = validateSyncInterval(dur)
+				}
+				if err != nil {
+					return &configErr{tk, fmt.Sprintf("Invalid %q: %v", mk, err)}
+				}
+				acc.jsSyncInterval = dur
+			case "read_ahead", "max_read_ahead":
+				vv, err := getStorageSize(mv)
+				if err != nil || vv < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
+				}
+				acc.jsReadAhead = vv
+			case "index_dir":
+				vv, ok := mv.(string)
+				if !ok || vv == _EMPTY_ {
+					return &configErr{tk, fmt.Sprintf("Expected a directory for %q, got %v", mk, mv)}
+				}
+				acc.jsIndexDir = vv
 			case "cluster_traffic":
 				vv, ok := mv.(string)
 				if !ok {
@@ -2251,6 +2339,8 @@ func parseJetStreamLimits(v any, opts *Options, errors *[]error) error {
 			lim.MaxHAAssets = int(mv.(int64))
 		case "max_request_batch":
 			lim.MaxRequestBatch = int(mv.(int64))
+		case "max_response_size":
+			lim.MaxResponseSize = int(mv.(int64))
 		case "duplicate_window":
 			var err error
 			lim.Duplicates, err = time.ParseDuration(mv.(string))
@@ -2274,6 +2364,55 @@ func parseJetStreamLimits(v any, opts *Options, errors *[]error) error {
 	return nil
 }
 
+// Parse the JetStream tier store options.
+func parseJetStreamTier(v any, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	tier := JSTierOpts{}
+
+	vv, ok := v.(map[string]any)
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the JetStream tier store, got %T", v)}
+	}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "endpoint", "url":
+			tier.Endpoint = mv.(string)
+		case "region":
+			tier.Region = mv.(string)
+		case "bucket":
+			tier.Bucket = mv.(string)
+		case "prefix":
+			tier.Prefix = mv.(string)
+		case "access_key":
+			tier.AccessKey = mv.(string)
+		case "secret_key":
+			tier.SecretKey = mv.(string)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+				continue
+			}
+		}
+	}
+	if tier.Endpoint == _EMPTY_ || tier.Bucket == _EMPTY_ {
+		return &configErr{tk, "JetStream tier store requires an endpoint and a bucket"}
+	}
+	if _, err := url.Parse(tier.Endpoint); err != nil {
+		return &configErr{tk, fmt.Sprintf("JetStream tier store endpoint %q is invalid: %v", tier.Endpoint, err)}
+	}
+	opts.JetStreamTier = tier
+	return nil
+}
+
 // Parse the JetStream TPM options.
 func parseJetStreamTPM(v interface{}, opts *Options, errors *[]error) error {
 	var lt token
@@ -2317,6 +2456,332 @@ func parseJetStreamTPM(v interface{}, opts *Options, errors *[]error) error {
 	return nil
 }
 
+// Parses the actions to take for each class of storage errors, e.g.
+// storage_errors { out_of_space: disable, io: read_only, corruption: advisory }
+func parseJetStreamStorageErrors(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define storage error actions, got %T", v)}
+	}
+	policy := make(map[StorageErrorClass]StorageErrorAction, len(vv))
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		class := StorageErrorClass(strings.ToLower(mk))
+		switch class {
+		case StorageErrorOutOfSpace, StorageErrorIO, StorageErrorCorruption, StorageErrorPermission:
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+			continue
+		}
+		sv, ok := mv.(string)
+		if !ok {
+			return &configErr{tk, fmt.Sprintf("Expected a string action for %q, got %T", mk, mv)}
+		}
+		action := StorageErrorAction(strings.ToLower(strings.TrimSpace(sv)))
+		switch action {
+		case StorageErrorActionDisable, StorageErrorActionReadOnly, StorageErrorActionAdvisory:
+			policy[class] = action
+		default:
+			return &configErr{tk, fmt.Sprintf("Unknown storage error action %q for %q", sv, mk)}
+		}
+	}
+	opts.JetStreamStorageErrors = policy
+	return nil
+}
+
+// Parses the limits of the internal JetStream queues, e.g.
+// queue_limits { raft_proposals: { max_msgs: 100000, max_bytes: 64MB }, outbound: { max_bytes: 32MB, policy: drop_oldest } }
+func parseJetStreamQueueLimits(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define queue limits, got %T", v)}
+	}
+	var limits JSQueueLimits
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		var ql *QueueLimit
+		switch strings.ToLower(mk) {
+		case "raft_proposals":
+			ql = &limits.RaftProposals
+		case "catchup":
+			ql = &limits.Catchup
+		case "outbound":
+			ql = &limits.Outbound
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+			continue
+		}
+		lm, ok := mv.(map[string]interface{})
+		if !ok {
+			return &configErr{tk, fmt.Sprintf("Expected a map to define the %q queue limit, got %T", mk, mv)}
+		}
+		for lk, lv := range lm {
+			ltk, lv := unwrapValue(lv, &lt)
+			switch strings.ToLower(lk) {
+			case "max_msgs":
+				n, ok := lv.(int64)
+				if !ok || n < 0 {
+					return &configErr{ltk, fmt.Sprintf("Expected a non-negative number for %q, got %v", lk, lv)}
+				}
+				ql.MaxMsgs = int(n)
+			case "max_bytes":
+				n, ok := lv.(int64)
+				if !ok || n < 0 {
+					return &configErr{ltk, fmt.Sprintf("Expected a parseable size for %q, got %v", lk, lv)}
+				}
+				ql.MaxBytes = n
+			case "policy":
+				sv, ok := lv.(string)
+				if !ok {
+					return &configErr{ltk, fmt.Sprintf("Expected a string policy for %q, got %T", mk, lv)}
+				}
+				pol := QueueLimitPolicy(strings.ToLower(strings.TrimSpace(sv)))
+				switch pol {
+				case QueueBackpressure, QueueDropNew, QueueDropOldest:
+				default:
+					return &configErr{ltk, fmt.Sprintf("Unknown queue limit policy %q for %q", sv, mk)}
+				}
+				ql.Policy = pol
+			default:
+				if !ltk.IsUsedVariable() {
+					err := &unknownConfigFieldErr{
+						field: lk,
+						configErr: configErr{
+							token: ltk,
+						},
+					}
+					*errors = append(*errors, err)
+				}
+			}
+		}
+	}
+	// Dropping proposals would silently lose writes, and dropping catchup
+	// messages would only force the catchup to restart, so both must push back.
+	for name, ql := range map[string]QueueLimit{"raft_proposals": limits.RaftProposals, "catchup": limits.Catchup} {
+		if ql.Policy != _EMPTY_ && ql.Policy != QueueBackpressure {
+			return &configErr{tk, fmt.Sprintf("Queue limit policy for %q can only be %q", name, QueueBackpressure)}
+		}
+	}
+	// Nothing waits on the outbound queue to slow down, so once bounded it has to drop.
+	if ql := limits.Outbound; (ql.MaxMsgs > 0 || ql.MaxBytes > 0) && ql.Policy != QueueDropNew && ql.Policy != QueueDropOldest {
+		return &configErr{tk, fmt.Sprintf("Queue limit policy for %q must be %q or %q", "outbound", QueueDropNew, QueueDropOldest)}
+	}
+	opts.JetStreamQueueLimits = limits
+	return nil
+}
+
+// Parses the limits of a single account on the routed JetStream API processing, e.g.
+// account_isolation { api_max_pending: 1000, api_max_inflight: 4, delivery_max_inflight: 8 }
+func parseJetStreamAccountIsolation(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define account isolation, got %T", v)}
+	}
+	var ai JSAccountIsolation
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		var n *int
+		switch strings.ToLower(mk) {
+		case "api_max_pending":
+			n = &ai.APIMaxPending
+		case "api_max_inflight":
+			n = &ai.APIMaxInflight
+		case "proposal_max_inflight":
+			n = &ai.ProposalMaxInflight
+		case "delivery_max_inflight":
+			n = &ai.DeliveryMaxInflight
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+			continue
+		}
+		v, ok := mv.(int64)
+		if !ok || v < 0 {
+			return &configErr{tk, fmt.Sprintf("Expected a non-negative number for %q, got %v", mk, mv)}
+		}
+		*n = int(v)
+	}
+	opts.JetStreamAccountIsolation = ai
+	return nil
+}
+
+// Parses the external systems streams may use, e.g.
+// remotes { dr: { account: LINK, accounts: [ORDERS] } }
+func parseJetStreamRemotes(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define remotes, got %T", v)}
+	}
+	remotes := make(map[string]*JSRemoteOpts, len(vv))
+	for name, rv := range vv {
+		rtk, rv := unwrapValue(rv, &lt)
+		rm, ok := rv.(map[string]interface{})
+		if !ok {
+			return &configErr{rtk, fmt.Sprintf("Expected a map to define remote %q, got %T", name, rv)}
+		}
+		r := &JSRemoteOpts{}
+		for mk, mv := range rm {
+			tk, mv = unwrapValue(mv, &lt)
+			switch strings.ToLower(mk) {
+			case "account":
+				acc, ok := mv.(string)
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a string account for remote %q, got %T", name, mv)}
+				}
+				r.Account = acc
+			case "accounts":
+				accs, ok := mv.([]interface{})
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a list of accounts for remote %q, got %T", name, mv)}
+				}
+				for _, av := range accs {
+					atk, av := unwrapValue(av, &lt)
+					acc, ok := av.(string)
+					if !ok {
+						return &configErr{atk, fmt.Sprintf("Expected a string account for remote %q, got %T", name, av)}
+					}
+					r.Accounts = append(r.Accounts, acc)
+				}
+			default:
+				if !tk.IsUsedVariable() {
+					err := &unknownConfigFieldErr{
+						field: mk,
+						configErr: configErr{
+							token: tk,
+						},
+					}
+					*errors = append(*errors, err)
+				}
+			}
+		}
+		if r.Account == _EMPTY_ {
+			return &configErr{rtk, fmt.Sprintf("Remote %q requires the account of its leafnode remote", name)}
+		}
+		remotes[name] = r
+	}
+	opts.JetStreamRemotes = remotes
+	return nil
+}
+
+// Parses the tuning of the raft WALs of streams and consumers, e.g.
+// raft_wal { compression: s2, block_size: 8MB, stream { compact_bytes: 16MB, compact_msgs: 100000 } }
+func parseJetStreamRaftWAL(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the raft WAL, got %T", v)}
+	}
+	unknown := func(tk token, field string) {
+		if !tk.IsUsedVariable() {
+			err := &unknownConfigFieldErr{
+				field: field,
+				configErr: configErr{
+					token: tk,
+				},
+			}
+			*errors = append(*errors, err)
+		}
+	}
+	size := func(tk token, name string, v interface{}) (uint64, error) {
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return 0, &configErr{tk, fmt.Sprintf("Expected a non-negative size for %q, got %v", name, v)}
+		}
+		return uint64(n), nil
+	}
+
+	var wal JSRaftWAL
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		var err error
+		switch strings.ToLower(mk) {
+		case "compression":
+			switch strings.ToLower(fmt.Sprint(mv)) {
+			case "s2":
+				wal.Compression = S2Compression
+			case "none", "false":
+				wal.Compression = NoCompression
+			default:
+				return &configErr{tk, fmt.Sprintf("Unknown raft WAL compression: %v", mv)}
+			}
+		case "block_size":
+			if wal.BlockSize, err = size(tk, mk, mv); err != nil {
+				return err
+			}
+			if wal.BlockSize > maxBlockSize {
+				return &configErr{tk, fmt.Sprintf("Raft WAL block size can be at most %s", friendlyBytes(maxBlockSize))}
+			}
+		case "stream", "consumer":
+			gm, ok := mv.(map[string]interface{})
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected a map to define the %s raft WAL, got %T", mk, mv)}
+			}
+			var c JSRaftWALCompact
+			for gk, gv := range gm {
+				gtk, gv := unwrapValue(gv, &lt)
+				switch strings.ToLower(gk) {
+				case "compact_bytes":
+					if c.Bytes, err = size(gtk, gk, gv); err != nil {
+						return err
+					}
+				case "compact_msgs":
+					if c.Msgs, err = size(gtk, gk, gv); err != nil {
+						return err
+					}
+				default:
+					unknown(gtk, gk)
+				}
+			}
+			if strings.ToLower(mk) == "stream" {
+				wal.Stream = c
+			} else {
+				wal.Consumer = c
+			}
+		default:
+			unknown(tk, mk)
+		}
+	}
+	opts.JetStreamRaftWAL = wal
+	return nil
+}
+
 func setJetStreamEkCipher(opts *Options, mv interface{}, tk token) error {
 	switch strings.ToLower(mv.(string)) {
 	case "chacha", "chachapoly":
@@ -2393,6 +2858,20 @@ func parseJetStream(v any, opts *Options, errors *[]error, warnings *[]error) er
 				if err := setJetStreamEkCipher(opts, mv, tk); err != nil {
 					return err
 				}
+			case "encrypt_snapshots":
+				opts.JetStreamEncryptSnapshots = mv.(bool)
+			case "preallocate":
+				opts.JetStreamPreallocate = mv.(bool)
+			case "index_dir":
+				opts.JetStreamIndexDir = mv.(string)
+			case "direct_io":
+				opts.JetStreamDirectIO = mv.(bool)
+			case "max_blocks_per_stream", "max_blocks":
+				vv, ok := mv.(int64)
+				if !ok || vv < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected a non-negative number for %q, got %v", mk, mv)}
+				}
+				opts.JetStreamMaxBlocks = int(vv)
 			case "extension_hint":
 				opts.JetStreamExtHint = mv.(string)
 			case "limits":
@@ -2403,6 +2882,10 @@ func parseJetStream(v any, opts *Options, errors *[]error, warnings *[]error) er
 				if err := parseJetStreamTPM(tk, opts, errors); err != nil {
 					return err
 				}
+			case "tier", "tiering":
+				if err := parseJetStreamTier(tk, opts, errors); err != nil {
+					return err
+				}
 			case "unique_tag":
 				opts.JetStreamUniqueTag = strings.ToLower(strings.TrimSpace(mv.(string)))
 			case "max_outstanding_catchup":
@@ -2429,6 +2912,42 @@ func parseJetStream(v any, opts *Options, errors *[]error, warnings *[]error) er
 					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
 				}
 				opts.JetStreamRequestQueueLimit = lim
+			case "storage_errors", "storage_error_policy":
+				if err := parseJetStreamStorageErrors(tk, opts, errors); err != nil {
+					return err
+				}
+			case "backup_dir":
+				opts.JetStreamBackupDir = mv.(string)
+			case "max_restore_rate":
+				rate, ok := mv.(int64)
+				if !ok || rate < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
+				}
+				opts.JetStreamMaxRestoreRate = rate
+			case "stats_interval":
+				opts.JetStreamStatsInterval = parseDuration("stats_interval", tk, mv, errors, warnings)
+			case "stats_samples":
+				samples, ok := mv.(int64)
+				if !ok || samples < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected a non-negative number for %q, got %v", mk, mv)}
+				}
+				opts.JetStreamStatsSamples = int(samples)
+			case "queue_limits":
+				if err := parseJetStreamQueueLimits(tk, opts, errors); err != nil {
+					return err
+				}
+			case "account_isolation":
+				if err := parseJetStreamAccountIsolation(tk, opts, errors); err != nil {
+					return err
+				}
+			case "raft_wal":
+				if err := parseJetStreamRaftWAL(tk, opts, errors); err != nil {
+					return err
+				}
+			case "remotes":
+				if err := parseJetStreamRemotes(tk, opts, errors); err != nil {
+					return err
+				}
 			default:
 				if !tk.IsUsedVariable() {
 					err := &unknownConfigFieldErr{
@@ -208,6 +208,16 @@ type raft struct {
 	votes *ipQueue[*voteResponse]        // Vote responses
 	leadc chan bool                      // Leader changes
 	quit  chan struct{}                  // Raft group shutdown
+
+	pbatches uint64        // Proposal batches appended as leader
+	pwait    time.Duration // Total time proposal batches waited for their turn
+	pmaxWait time.Duration // Longest time a proposal batch waited for its turn
+	plat     time.Duration // Total time to append proposal batches, including the wait
+	pmaxLat  time.Duration // Longest time to append a proposal batch
+
+	// Only used by the leader loop.
+	pheld []nrgProposalBatch // Proposal batches waiting for their turn
+	pturn *nrgProposalTurn   // The turn the first of them waits for
 }
 
 // cacthupState structure that holds our subscription, and catchup term and index
@@ -277,6 +287,7 @@ var (
 	errTooManyEntries    = errors.New("raft: append entry can contain a max of 64k entries")
 	errBadAppendEntry    = errors.New("raft: append entry corrupt")
 	errNoInternalClient  = errors.New("raft: no internal client")
+	errProposalsLimit    = errors.New("raft: pending proposals limit reached")
 )
 
 // This will bootstrap a raftNode by writing its config into the store directory.
@@ -366,6 +377,11 @@ func (s *Server) initRaftNode(accName string, cfg *RaftConfig, labels pprofLabel
 	}
 
 	qpfx := fmt.Sprintf("[ACC:%s] RAFT '%s' ", accName, cfg.Name)
+	// Pending proposals are bounded by the configured limits, if any.
+	propOpts := []ipQueueOpt[*Entry]{
+		ipqSizeCalculation(func(e *Entry) uint64 { return uint64(len(e.Data)) }),
+		ipqLimits[*Entry](s.getOpts().JetStreamQueueLimits.RaftProposals),
+	}
 	n := &raft{
 		created:  time.Now(),
 		id:       hash[:idLen],
@@ -384,7 +400,7 @@ func (s *Server) initRaftNode(accName string, cfg *RaftConfig, labels pprofLabel
 		quit:     make(chan struct{}),
 		reqs:     newIPQueue[*voteRequest](s, qpfx+"vreq"),
 		votes:    newIPQueue[*voteResponse](s, qpfx+"vresp"),
-		prop:     newIPQueue[*Entry](s, qpfx+"entry"),
+		prop:     newIPQueue(s, qpfx+"entry", propOpts...),
 		entry:    newIPQueue[*appendEntry](s, qpfx+"appendEntry"),
 		resp:     newIPQueue[*appendEntryResponse](s, qpfx+"appendEntryResponse"),
 		apply:    newIPQueue[*CommittedEntry](s, qpfx+"committedEntry"),
@@ -506,6 +522,8 @@ func (s *Server) initRaftNode(accName string, cfg *RaftConfig, labels pprofLabel
 	if s.isLameDuckMode() {
 		n.debug("Will start in observer mode due to lame duck status")
 		n.SetObserver(true)
+	} else if js := s.getJetStream(); js != nil && js.observeForMaintenance(n) {
+		n.debug("Will start in observer mode due to JetStream maintenance")
 	}
 
 	// Set the election timer and lost quorum timers to now, so that we
@@ -814,7 +832,9 @@ func (n *raft) Propose(data []byte) error {
 	if werr := n.werr; werr != nil {
 		return werr
 	}
-	n.prop.push(newEntry(EntryNormal, data))
+	if _, err := n.prop.push(newEntry(EntryNormal, data)); err != nil {
+		return errProposalsLimit
+	}
 	return nil
 }
 
@@ -832,8 +852,9 @@ func (n *raft) ProposeMulti(entries []*Entry) error {
 	if werr := n.werr; werr != nil {
 		return werr
 	}
-	for _, e := range entries {
-		n.prop.push(e)
+	// Queue the entries as one unit, so none of them are proposed if they do not all fit.
+	if _, err := n.prop.pushMany(entries); err != nil {
+		return errProposalsLimit
 	}
 	return nil
 }
@@ -2472,6 +2493,9 @@ func (n *raft) runAsLeader() {
 		n.Unlock()
 	}()
 
+	// Proposals not appended by the time we leave are dropped.
+	defer n.dropProposalBatches()
+
 	// To send out our initial peer state.
 	n.sendPeerState()
 
@@ -2511,16 +2535,18 @@ func (n *raft) runAsLeader() {
 				if sz < maxBatch && len(entries) < maxEntries {
 					continue
 				}
-				n.sendAppendEntry(entries)
+				n.queueProposalBatch(entries, sz)
 				// Reset our sz and entries.
 				// We need to re-create `entries` because there is a reference
 				// to it in the node's pae map.
 				sz, entries = 0, nil
 			}
 			if len(entries) > 0 {
-				n.sendAppendEntry(entries)
+				n.queueProposalBatch(entries, sz)
 			}
 			n.prop.recycle(&es)
+		case <-n.proposalTurn():
+			n.sendProposalBatches()
 
 		case <-hb.C:
 			if n.notActive() {
@@ -3961,10 +3987,9 @@ func (n *raft) setWriteErrLocked(err error) {
 	n.error("Critical write error: %v", err)
 	n.werr = err
 
-	if isOutOfSpaceErr(err) {
-		// For now since this can be happening all under the covers, we will call up and disable JetStream.
-		go n.s.handleOutOfSpace(nil)
-	}
+	// For now since this can be happening all under the covers, we will call up and let the
+	// configured storage error action decide, which by default disables JetStream when out of space.
+	go n.s.handleStorageError(nil, err)
 }
 
 // Helper to check if we are closed when we do not hold a lock already.
@@ -0,0 +1,234 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// How many bytes of proposals a group with a weight of one may append per turn.
+const nrgProposalQuantum = 64 * 1024
+
+// nrgProposalScheduler bounds how many raft groups append their batched
+// proposals at the same time. When groups have to wait, they are given turns
+// round robin, each turn allowing a number of bytes scaled by the weight of
+// the account of the group. This keeps a single hot stream from dominating
+// the raft and disk IO of a server that is shared by many streams.
+type nrgProposalScheduler struct {
+	mu       sync.Mutex
+	max      int
+	inflight int
+	waiting  []*nrgProposalTurn // Groups waiting for a turn, in order.
+	next     int                // Index into waiting of the group that is visited next.
+}
+
+type nrgProposalTurn struct {
+	weight  int
+	size    int
+	deficit int
+	ch      chan struct{}
+}
+
+// RaftzGroupProposals shows how long the proposal batches of a group took to
+// be appended when it was leader, including the wait for its turn when
+// proposals are scheduled between groups.
+type RaftzGroupProposals struct {
+	Batches    uint64        `json:"batches"`
+	AvgWait    time.Duration `json:"avg_wait"`
+	MaxWait    time.Duration `json:"max_wait"`
+	AvgLatency time.Duration `json:"avg_latency"`
+	MaxLatency time.Duration `json:"max_latency"`
+}
+
+func newNRGProposalScheduler(max int) *nrgProposalScheduler {
+	return &nrgProposalScheduler{max: max}
+}
+
+// acquire asks for a turn to append a batch of proposals of the given size, without
+// waiting for it. Returns nil if the batch may be appended right away, otherwise the
+// turn whose channel is closed once it may. Call release once the batch was appended,
+// or cancel to give up a turn not used.
+func (sc *nrgProposalScheduler) acquire(weight, size int) *nrgProposalTurn {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.inflight < sc.max && len(sc.waiting) == 0 {
+		sc.inflight++
+		return nil
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	t := &nrgProposalTurn{weight: weight, size: size, ch: make(chan struct{})}
+	sc.waiting = append(sc.waiting, t)
+	return t
+}
+
+// Returns the channel closed once it is the turn, nil if there is no turn to wait for.
+func (t *nrgProposalTurn) turn() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.ch
+}
+
+// cancel gives up a turn returned by acquire, whether still waiting or already given.
+func (sc *nrgProposalScheduler) cancel(t *nrgProposalTurn) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, wt := range sc.waiting {
+		if wt == t {
+			sc.waiting = append(sc.waiting[:i], sc.waiting[i+1:]...)
+			if sc.next > i {
+				sc.next--
+			}
+			return
+		}
+	}
+	// We were given our turn in the meantime, hand it to the next.
+	sc.inflight--
+	sc.dispatch()
+}
+
+// release gives up the turn handed out by acquire once the batch was appended.
+func (sc *nrgProposalScheduler) release() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.inflight--
+	sc.dispatch()
+}
+
+// Hands out turns while there is room, visiting the waiting groups round robin.
+// Every visit adds to what a group may append, until its batch fits.
+// Lock should be held.
+func (sc *nrgProposalScheduler) dispatch() {
+	for sc.inflight < sc.max && len(sc.waiting) > 0 {
+		if sc.next >= len(sc.waiting) {
+			sc.next = 0
+		}
+		t := sc.waiting[sc.next]
+		if t.deficit += nrgProposalQuantum * t.weight; t.deficit < t.size {
+			sc.next++
+			continue
+		}
+		sc.waiting = append(sc.waiting[:sc.next], sc.waiting[sc.next+1:]...)
+		sc.inflight++
+		close(t.ch)
+	}
+}
+
+// Returns the weight of the proposals of the account of this group.
+func (n *raft) proposalWeight() int {
+	if a, _ := n.s.lookupAccount(n.accName); a != nil {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		if a.nrgWeight > 0 {
+			return a.nrgWeight
+		}
+	}
+	return 1
+}
+
+// A batch of proposals queued by the leader until it is its turn to append it.
+type nrgProposalBatch struct {
+	entries []*Entry
+	size    int
+	start   time.Time
+}
+
+// Queues a batch of proposals to append as leader, behind any still waiting for their turn.
+func (n *raft) queueProposalBatch(entries []*Entry, size int) {
+	n.pheld = append(n.pheld, nrgProposalBatch{entries, size, time.Now()})
+	n.sendProposalBatches()
+}
+
+// Returns the channel closed once it is the turn of the queued proposal batches,
+// nil if none are waiting.
+func (n *raft) proposalTurn() <-chan struct{} {
+	return n.pturn.turn()
+}
+
+// Appends the queued proposal batches as leader, as long as the server, if it schedules
+// proposals between groups, gives us turns. Never waits for a turn so the leader loop
+// keeps going, the batches stay queued until proposalTurn signals it instead.
+func (n *raft) sendProposalBatches() {
+	sc := n.s.nrgProposals
+	for len(n.pheld) > 0 {
+		b := n.pheld[0]
+		if sc != nil {
+			if n.pturn == nil {
+				if n.pturn = sc.acquire(n.proposalWeight(), b.size); n.pturn != nil {
+					return
+				}
+			} else {
+				select {
+				case <-n.pturn.ch:
+					n.pturn = nil
+				default:
+					return
+				}
+			}
+		}
+		n.pheld[0] = nrgProposalBatch{}
+		n.pheld = n.pheld[1:]
+		n.sendProposalBatch(b, sc)
+	}
+	n.pheld = nil
+}
+
+// Gives up our turn and the queued proposal batches once no longer leader.
+func (n *raft) dropProposalBatches() {
+	if n.pturn != nil {
+		n.s.nrgProposals.cancel(n.pturn)
+		n.pturn = nil
+	}
+	n.pheld = nil
+}
+
+// Appends a batch of proposals as leader once it is our turn.
+func (n *raft) sendProposalBatch(b nrgProposalBatch, sc *nrgProposalScheduler) {
+	wait := time.Since(b.start)
+	n.sendAppendEntry(b.entries)
+	if sc != nil {
+		sc.release()
+	}
+	lat := time.Since(b.start)
+
+	n.Lock()
+	n.pbatches++
+	n.pwait += wait
+	if wait > n.pmaxWait {
+		n.pmaxWait = wait
+	}
+	n.plat += lat
+	if lat > n.pmaxLat {
+		n.pmaxLat = lat
+	}
+	n.Unlock()
+}
+
+// Returns the proposal statistics of this group, nil if it never appended any as leader.
+// Lock should be held.
+func (n *raft) proposalStats() *RaftzGroupProposals {
+	if n.pbatches == 0 {
+		return nil
+	}
+	return &RaftzGroupProposals{
+		Batches:    n.pbatches,
+		AvgWait:    n.pwait / time.Duration(n.pbatches),
+		MaxWait:    n.pmaxWait,
+		AvgLatency: n.plat / time.Duration(n.pbatches),
+		MaxLatency: n.pmaxLat,
+	}
+}
@@ -1453,3 +1453,56 @@ func TestNRGCatchupFromNewLeaderWithIncorrectPtermDoesNotTruncateIfCommitted(t *
 	require_True(t, n.catchup == nil)
 
 }
+
+func TestNRGProposalSchedulerFairness(t *testing.T) {
+	sc := newNRGProposalScheduler(1)
+	waiting := func() int {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		return len(sc.waiting)
+	}
+	given := func(t *nrgProposalTurn) bool {
+		select {
+		case <-t.ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Take the only turn so that everyone else has to wait.
+	require_True(t, sc.acquire(1, 0) == nil)
+
+	a := sc.acquire(1, 2*nrgProposalQuantum)
+	b := sc.acquire(4, 2*nrgProposalQuantum)
+	c := sc.acquire(1, 100)
+	require_True(t, a != nil && b != nil && c != nil)
+	require_Equal(t, waiting(), 3)
+
+	// A group leaving gives up its place.
+	sc.cancel(sc.acquire(1, 100))
+	require_Equal(t, waiting(), 3)
+
+	// B is weighted to go first, A needs a second turn for its large batch.
+	sc.release()
+	require_True(t, given(b) && !given(c) && !given(a))
+	sc.release()
+	require_True(t, given(c) && !given(a))
+	sc.release()
+	require_True(t, given(a))
+	sc.release()
+	require_Equal(t, waiting(), 0)
+
+	// A turn given but not used is handed to the next.
+	require_True(t, sc.acquire(1, 0) == nil)
+	a, b = sc.acquire(1, 100), sc.acquire(1, 100)
+	sc.release()
+	require_True(t, given(a) && !given(b))
+	sc.cancel(a)
+	require_True(t, given(b))
+	sc.release()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	require_Equal(t, sc.inflight, 0)
+}
@@ -838,6 +838,36 @@ func (o *profBlockRateReload) Apply(s *Server) {
 	s.Noticef("Reloaded: prof_block_rate = %v", o.newValue)
 }
 
+// jetStreamStorageErrorsReload is applied simply by reading the new options.
+type jetStreamStorageErrorsReload struct {
+	noopOption
+	newValue map[StorageErrorClass]StorageErrorAction
+}
+
+func (o *jetStreamStorageErrorsReload) Apply(s *Server) {
+	s.Noticef("Reloaded: jetstream storage_errors = %v", o.newValue)
+}
+
+// jetStreamBackupDirReload is applied simply by reading the new options.
+type jetStreamBackupDirReload struct {
+	noopOption
+	newValue string
+}
+
+func (o *jetStreamBackupDirReload) Apply(s *Server) {
+	s.Noticef("Reloaded: jetstream backup_dir = %q", o.newValue)
+}
+
+// jetStreamMaxRestoreRateReload is applied simply by reading the new options.
+type jetStreamMaxRestoreRateReload struct {
+	noopOption
+	newValue int64
+}
+
+func (o *jetStreamMaxRestoreRateReload) Apply(s *Server) {
+	s.Noticef("Reloaded: jetstream max_restore_rate = %v", o.newValue)
+}
+
 type leafNodeOption struct {
 	noopOption
 	tlsFirstChanged    bool
@@ -1153,10 +1183,11 @@ func imposeOrder(value any) error {
 		slices.Sort(value.AllowedOrigins)
 	case string, bool, uint8, uint16, int, int32, int64, time.Duration, float64, nil, LeafNodeOpts, ClusterOpts, *tls.Config, PinnedCertSet,
 		*URLAccResolver, *MemAccResolver, *DirAccResolver, *CacheDirAccResolver, Authentication, MQTTOpts, jwt.TagList,
-		*OCSPConfig, map[string]string, JSLimitOpts, StoreCipher, *OCSPResponseCacheConfig:
+		*OCSPConfig, map[string]string, JSLimitOpts, StoreCipher, *OCSPResponseCacheConfig,
+		map[StorageErrorClass]StorageErrorAction, JSQueueLimits, JSAccountIsolation, JSRaftWAL, map[string]*JSRemoteOpts:
 		// explicitly skipped types
 	case *AuthCallout:
-	case JSTpmOpts:
+	case JSTpmOpts, JSTierOpts:
 	default:
 		// this will fail during unit tests
 		return fmt.Errorf("OnReload, sort or explicitly skip type: %s",
@@ -1621,6 +1652,12 @@ func (s *Server) diffOptions(newOpts *Options) ([]option, error) {
 			diffOpts = append(diffOpts, &ocspOption{newValue: newValue.(*OCSPConfig)})
 		case "ocspcacheconfig":
 			diffOpts = append(diffOpts, &ocspResponseCacheOption{newValue: newValue.(*OCSPResponseCacheConfig)})
+		case "jetstreamstorageerrors":
+			diffOpts = append(diffOpts, &jetStreamStorageErrorsReload{newValue: newValue.(map[StorageErrorClass]StorageErrorAction)})
+		case "jetstreambackupdir":
+			diffOpts = append(diffOpts, &jetStreamBackupDirReload{newValue: newValue.(string)})
+		case "jetstreammaxrestorerate":
+			diffOpts = append(diffOpts, &jetStreamMaxRestoreRateReload{newValue: newValue.(int64)})
 		case "profblockrate":
 			new := newValue.(int)
 			old := oldValue.(int)
@@ -360,7 +360,10 @@ type Server struct {
 	syncOutSem chan struct{}
 
 	// Queue to process JS API requests that come from routes (or gateways)
-	jsAPIRoutedReqs *ipQueue[*jsAPIRoutedReq]
+	jsAPIRoutedReqs *jsAPIQueue
+
+	// Schedules the proposals of raft groups between each other, if enabled.
+	nrgProposals *nrgProposalScheduler
 
 	// Delayed API responses.
 	delayedAPIResponses *ipQueue[*delayedAPIResponse]
@@ -385,6 +388,7 @@ type nodeInfo struct {
 	js              bool
 	binarySnapshots bool
 	accountNRG      bool
+	maintenance     bool
 }
 
 // Make sure all are 64bits for atomic use
@@ -741,6 +745,10 @@ func NewServer(opts *Options) (*Server, error) {
 	// By default we'll allow account NRG.
 	s.accountNRGAllowed.Store(true)
 
+	if max := opts.JetStreamAccountIsolation.ProposalMaxInflight; max > 0 {
+		s.nrgProposals = newNRGProposalScheduler(max)
+	}
+
 	// Fill up the maximum in flight syncRequests for this server.
 	// Used in JetStream catchup semantics.
 	for i := 0; i < maxConcurrentSyncRequests; i++ {
@@ -785,7 +793,7 @@ func NewServer(opts *Options) (*Server, error) {
 			opts.Tags,
 			&JetStreamConfig{MaxMemory: opts.JetStreamMaxMemory, MaxStore: opts.JetStreamMaxStore, CompressOK: true},
 			nil,
-			false, true, true, true,
+			false, true, true, true, false,
 		})
 	}
 
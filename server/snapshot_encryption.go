@@ -0,0 +1,146 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// Encrypted snapshots start with this magic, followed by the cipher, the length and the
+// sealed random seed of the snapshot, and the nonce of the stream cipher for the data.
+// The seed is sealed with a key derived from the stream name, like the stream meta key.
+var snapshotEncMagic = []byte("NATSESNP")
+
+const snapshotEncContext = ":snapshot"
+
+var errSnapshotEncrypted = errors.New("snapshot is encrypted")
+
+// Returns the nonce size of the stream cipher for the data of encrypted snapshots.
+func snapshotNonceSize(sc StoreCipher) (int, error) {
+	switch sc {
+	case ChaCha:
+		return chacha20.NonceSize, nil
+	case AES:
+		return aes.BlockSize, nil
+	}
+	return 0, errUnknownCipher
+}
+
+// Writes the header of an encrypted snapshot to w and returns a writer
+// that encrypts the snapshot data written to it.
+func newSnapshotEncrypter(w io.Writer, sc StoreCipher, prf keyGen, stream string) (io.Writer, error) {
+	rb, err := prf([]byte(stream + snapshotEncContext))
+	if err != nil {
+		return nil, err
+	}
+	kek, err := genEncryptionKey(sc, rb)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := snapshotNonceSize(sc)
+	if err != nil {
+		return nil, err
+	}
+	seed := make([]byte, 32)
+	nonce := make([]byte, kek.NonceSize())
+	bnonce := make([]byte, ns)
+	for _, b := range [][]byte{seed, nonce, bnonce} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+	sealed := kek.Seal(nonce, nonce, seed, nil)
+
+	hdr := make([]byte, 0, len(snapshotEncMagic)+3+len(sealed)+len(bnonce))
+	hdr = append(hdr, snapshotEncMagic...)
+	hdr = append(hdr, byte(sc))
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(sealed)))
+	hdr = append(hdr, sealed...)
+	hdr = append(hdr, bnonce...)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+
+	bek, err := genBlockEncryptionKey(sc, seed, bnonce)
+	if err != nil {
+		return nil, err
+	}
+	return &cipher.StreamWriter{S: bek, W: w}, nil
+}
+
+// Returns a reader with the snapshot data of r, decrypting it if the snapshot was encrypted.
+// The current and the previous encryption key of the server are tried.
+func (s *Server) snapshotDecrypter(r io.Reader, acc, stream string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(snapshotEncMagic)); err != nil || !bytes.Equal(magic, snapshotEncMagic) {
+		// Not encrypted, errors are surfaced when reading the snapshot.
+		return br, nil
+	}
+	hdr := make([]byte, len(snapshotEncMagic)+3)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	sc := StoreCipher(hdr[len(snapshotEncMagic)])
+	sealed := make([]byte, binary.BigEndian.Uint16(hdr[len(snapshotEncMagic)+1:]))
+	if _, err := io.ReadFull(br, sealed); err != nil {
+		return nil, err
+	}
+	ns, err := snapshotNonceSize(sc)
+	if err != nil {
+		return nil, err
+	}
+	bnonce := make([]byte, ns)
+	if _, err := io.ReadFull(br, bnonce); err != nil {
+		return nil, err
+	}
+
+	opts := s.getOpts()
+	for _, key := range []string{opts.JetStreamKey, opts.JetStreamOldKey} {
+		prf := s.jsKeyGen(key, acc)
+		if prf == nil {
+			continue
+		}
+		rb, err := prf([]byte(stream + snapshotEncContext))
+		if err != nil {
+			continue
+		}
+		kek, err := genEncryptionKey(sc, rb)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < kek.NonceSize() {
+			return nil, errSnapshotEncrypted
+		}
+		seed, err := kek.Open(nil, sealed[:kek.NonceSize()], sealed[kek.NonceSize():], nil)
+		if err != nil {
+			continue
+		}
+		bek, err := genBlockEncryptionKey(sc, seed, bnonce)
+		if err != nil {
+			return nil, err
+		}
+		return &cipher.StreamReader{S: bek, R: br}, nil
+	}
+	return nil, fmt.Errorf("%w, could not decrypt with the encryption keys of the server", errSnapshotEncrypted)
+}
@@ -18,7 +18,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unsafe"
 
@@ -50,6 +53,8 @@ var (
 	ErrMaxBytes = errors.New("maximum bytes exceeded")
 	// ErrMaxMsgsPerSubject is returned when we have discard new as a policy and we reached the message limit per subject.
 	ErrMaxMsgsPerSubject = errors.New("maximum messages per subject exceeded")
+	// ErrMaxBlocks is returned when we have discard new as a policy and we reached the message block limit.
+	ErrMaxBlocks = errors.New("maximum message blocks exceeded")
 	// ErrStoreSnapshotInProgress is returned when RemoveMsg or EraseMsg is called
 	// while a snapshot is in progress.
 	ErrStoreSnapshotInProgress = errors.New("snapshot in progress")
@@ -158,6 +163,17 @@ type StreamState struct {
 	Deleted     []uint64          `json:"deleted,omitempty"`
 	Lost        *LostStreamData   `json:"lost,omitempty"`
 	Consumers   int               `json:"consumer_count"`
+	// ReclaimedBytes are the bytes on disk reclaimed by compacting the holes of deleted messages
+	// out of the message blocks, since the stream was loaded.
+	ReclaimedBytes uint64 `json:"reclaimed_bytes,omitempty"`
+	// DeletedRanges are the gaps of deleted messages, only filled in when requested.
+	DeletedRanges []SequenceRange `json:"deleted_ranges,omitempty"`
+}
+
+// SequenceRange is an inclusive range of stream sequences.
+type SequenceRange struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
 }
 
 // SimpleState for filtered subject specific state.
@@ -333,14 +349,44 @@ func (dbs DeleteBlocks) NumDeleted() (total uint64) {
 	return total
 }
 
+// Returns the deleted sequences as ranges, merging adjacent ones.
+// The delete blocks need to be in order.
+func (dbs DeleteBlocks) ranges() []SequenceRange {
+	var rs []SequenceRange
+	add := func(first, last uint64) {
+		if n := len(rs); n > 0 && rs[n-1].Last+1 >= first {
+			if last > rs[n-1].Last {
+				rs[n-1].Last = last
+			}
+			return
+		}
+		rs = append(rs, SequenceRange{First: first, Last: last})
+	}
+	for _, db := range dbs {
+		if dr, ok := db.(*DeleteRange); ok {
+			if dr.Num > 0 {
+				add(dr.First, dr.First+dr.Num-1)
+			}
+			continue
+		}
+		db.Range(func(seq uint64) bool {
+			add(seq, seq)
+			return true
+		})
+	}
+	return rs
+}
+
 // ConsumerStore stores state on consumers for streams.
 type ConsumerStore interface {
 	SetStarting(sseq uint64) error
 	HasState() bool
 	UpdateDelivered(dseq, sseq, dc uint64, ts int64) error
 	UpdateAcks(dseq, sseq uint64) error
+	UpdateAcksUpTo(sseq uint64) error
 	UpdateConfig(cfg *ConsumerConfig) error
 	Update(*ConsumerState) error
+	Reset(*ConsumerState) error
 	State() (*ConsumerState, error)
 	BorrowState() (*ConsumerState, error)
 	EncodedState() ([]byte, error)
@@ -370,6 +416,26 @@ type ConsumerState struct {
 	Redelivered map[uint64]uint64 `json:"redelivered,omitempty"`
 }
 
+// Acknowledges all pending messages up to and including the stream sequence,
+// and moves the ack floors up to just below the lowest message still pending.
+func (state *ConsumerState) ackUpTo(sseq uint64) {
+	var low uint64
+	for seq := range state.Pending {
+		if seq <= sseq {
+			delete(state.Pending, seq)
+			delete(state.Redelivered, seq)
+		} else if low == 0 || seq < low {
+			low = seq
+		}
+	}
+	if len(state.Pending) == 0 {
+		state.AckFloor = state.Delivered
+	} else if p := state.Pending[low]; p.Sequence > 0 {
+		state.AckFloor.Consumer = p.Sequence - 1
+		state.AckFloor.Stream = low - 1
+	}
+}
+
 // Encode consumer state.
 func encodeConsumerState(state *ConsumerState) []byte {
 	var hdr [seqsHdrSize]byte
@@ -553,6 +619,9 @@ func (st StorageType) String() string {
 	case AnyStorage:
 		return "Any"
 	default:
+		if b := st.backend(); b != nil {
+			return b.Name
+		}
 		return "Unknown Storage Type"
 	}
 }
@@ -566,6 +635,9 @@ func (st StorageType) MarshalJSON() ([]byte, error) {
 	case AnyStorage:
 		return anyStorageJSONBytes, nil
 	default:
+		if b := st.backend(); b != nil {
+			return []byte(strconv.Quote(b.Name)), nil
+		}
 		return nil, fmt.Errorf("can not marshal %v", st)
 	}
 }
@@ -579,6 +651,12 @@ func (st *StorageType) UnmarshalJSON(data []byte) error {
 	case anyStorageJSONString:
 		*st = AnyStorage
 	default:
+		if name, err := strconv.Unquote(string(data)); err == nil {
+			if bst, ok := storeBackendType(name); ok {
+				*st = bst
+				return nil
+			}
+		}
 		return fmt.Errorf("can not unmarshal %q", data)
 	}
 	return nil
@@ -657,23 +735,25 @@ func (rp *ReplayPolicy) UnmarshalJSON(data []byte) error {
 }
 
 const (
-	deliverAllPolicyJSONString       = `"all"`
-	deliverLastPolicyJSONString      = `"last"`
-	deliverNewPolicyJSONString       = `"new"`
-	deliverByStartSequenceJSONString = `"by_start_sequence"`
-	deliverByStartTimeJSONString     = `"by_start_time"`
-	deliverLastPerPolicyJSONString   = `"last_per_subject"`
-	deliverUndefinedJSONString       = `"undefined"`
+	deliverAllPolicyJSONString        = `"all"`
+	deliverLastPolicyJSONString       = `"last"`
+	deliverNewPolicyJSONString        = `"new"`
+	deliverByStartSequenceJSONString  = `"by_start_sequence"`
+	deliverByStartTimeJSONString      = `"by_start_time"`
+	deliverLastPerPolicyJSONString    = `"last_per_subject"`
+	deliverByStartEventTimeJSONString = `"by_start_event_time"`
+	deliverUndefinedJSONString        = `"undefined"`
 )
 
 var (
-	deliverAllPolicyJSONBytes       = []byte(deliverAllPolicyJSONString)
-	deliverLastPolicyJSONBytes      = []byte(deliverLastPolicyJSONString)
-	deliverNewPolicyJSONBytes       = []byte(deliverNewPolicyJSONString)
-	deliverByStartSequenceJSONBytes = []byte(deliverByStartSequenceJSONString)
-	deliverByStartTimeJSONBytes     = []byte(deliverByStartTimeJSONString)
-	deliverLastPerPolicyJSONBytes   = []byte(deliverLastPerPolicyJSONString)
-	deliverUndefinedJSONBytes       = []byte(deliverUndefinedJSONString)
+	deliverAllPolicyJSONBytes        = []byte(deliverAllPolicyJSONString)
+	deliverLastPolicyJSONBytes       = []byte(deliverLastPolicyJSONString)
+	deliverNewPolicyJSONBytes        = []byte(deliverNewPolicyJSONString)
+	deliverByStartSequenceJSONBytes  = []byte(deliverByStartSequenceJSONString)
+	deliverByStartTimeJSONBytes      = []byte(deliverByStartTimeJSONString)
+	deliverLastPerPolicyJSONBytes    = []byte(deliverLastPerPolicyJSONString)
+	deliverByStartEventTimeJSONBytes = []byte(deliverByStartEventTimeJSONString)
+	deliverUndefinedJSONBytes        = []byte(deliverUndefinedJSONString)
 )
 
 func (p *DeliverPolicy) UnmarshalJSON(data []byte) error {
@@ -690,6 +770,8 @@ func (p *DeliverPolicy) UnmarshalJSON(data []byte) error {
 		*p = DeliverByStartSequence
 	case deliverByStartTimeJSONString:
 		*p = DeliverByStartTime
+	case deliverByStartEventTimeJSONString:
+		*p = DeliverByStartEventTime
 	default:
 		return fmt.Errorf("can not unmarshal %q", data)
 	}
@@ -711,13 +793,84 @@ func (p DeliverPolicy) MarshalJSON() ([]byte, error) {
 		return deliverByStartSequenceJSONBytes, nil
 	case DeliverByStartTime:
 		return deliverByStartTimeJSONBytes, nil
+	case DeliverByStartEventTime:
+		return deliverByStartEventTimeJSONBytes, nil
 	default:
 		return deliverUndefinedJSONBytes, nil
 	}
 }
 
+// StorageErrorClass classifies failures of the underlying storage,
+// so the server can decide how to react to each kind of failure.
+type StorageErrorClass string
+
+const (
+	// StorageErrorNone is used for errors that are not storage failures.
+	StorageErrorNone = StorageErrorClass(_EMPTY_)
+	// StorageErrorOutOfSpace is used when the storage device is full.
+	StorageErrorOutOfSpace = StorageErrorClass("out_of_space")
+	// StorageErrorIO is used for read or write failures of the storage device.
+	StorageErrorIO = StorageErrorClass("io")
+	// StorageErrorCorruption is used when stored data could not be decoded.
+	StorageErrorCorruption = StorageErrorClass("corruption")
+	// StorageErrorPermission is used when the storage can not be accessed or is read-only.
+	StorageErrorPermission = StorageErrorClass("permission")
+)
+
+// StorageError is returned by stores when the underlying storage failed.
+type StorageError struct {
+	Class StorageErrorClass
+	Err   error
+}
+
+func (e *StorageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Will wrap err in a StorageError if it is a failure of the underlying storage.
+func newStorageError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var serr *StorageError
+	if errors.As(err, &serr) {
+		return err
+	}
+	if class := classifyStorageError(err); class != StorageErrorNone {
+		return &StorageError{Class: class, Err: err}
+	}
+	return err
+}
+
+// Returns the class of the storage failure, or StorageErrorNone if err is not one.
+func classifyStorageError(err error) StorageErrorClass {
+	if err == nil {
+		return StorageErrorNone
+	}
+	var serr *StorageError
+	if errors.As(err, &serr) {
+		return serr.Class
+	}
+	var perr *fs.PathError
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return StorageErrorOutOfSpace
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EROFS), errors.Is(err, errNotReadable):
+		return StorageErrorPermission
+	case errors.Is(err, errCorruptState), errors.Is(err, errBadMsg):
+		return StorageErrorCorruption
+	case errors.Is(err, syscall.EIO), errors.As(err, &perr):
+		return StorageErrorIO
+	}
+	return StorageErrorNone
+}
+
 func isOutOfSpaceErr(err error) bool {
-	return err != nil && (strings.Contains(err.Error(), "no space left"))
+	return classifyStorageError(err) == StorageErrorOutOfSpace
 }
 
 // For when our upper layer catchup detects its missing messages from the beginning of the stream.
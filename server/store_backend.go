@@ -0,0 +1,191 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreBackend is an alternative implementation of StreamStore that can be
+// compiled into the server and selected per stream through its StorageType.
+type StoreBackend struct {
+	// Name selects the backend in stream configurations, e.g. "storage": "pebble".
+	Name string
+	// Accounting is how the bytes stored by the backend count against
+	// the JetStream limits, either FileStorage or MemoryStorage.
+	Accounting StorageType
+	// New creates the store of a stream. It is also called when a stream
+	// is recreated, e.g. by the meta layer on restart, so persistent backends
+	// are expected to recover any state they find in the store directory.
+	New func(cfg StoreBackendConfig) (StreamStore, error)
+}
+
+// StoreBackendConfig is what a backend is given to create the store of a stream.
+type StoreBackendConfig struct {
+	// StoreDir is a directory reserved for the stream, which the backend may use.
+	StoreDir string
+	// Config is the configuration of the stream.
+	Config StreamConfig
+	// Created is when the stream was created.
+	Created time.Time
+}
+
+// Registered backends get storage types starting from here.
+const firstStoreBackendType = StorageType(100)
+
+var storeBackends struct {
+	sync.RWMutex
+	byType map[StorageType]*StoreBackend
+	byName map[string]StorageType
+	next   StorageType
+}
+
+var (
+	errStoreBackendInvalid    = errors.New("store backend requires a name and a constructor")
+	errStoreBackendAccounting = errors.New("store backend accounting must be file or memory storage")
+)
+
+// RegisterStoreBackend registers an alternative storage backend and returns
+// the StorageType that selects it. Backends should be registered before any
+// server is started, usually from an init function.
+func RegisterStoreBackend(b StoreBackend) (StorageType, error) {
+	name := strings.ToLower(strings.TrimSpace(b.Name))
+	if name == _EMPTY_ || b.New == nil {
+		return 0, errStoreBackendInvalid
+	}
+	if b.Accounting != FileStorage && b.Accounting != MemoryStorage {
+		return 0, errStoreBackendAccounting
+	}
+	switch strconv.Quote(name) {
+	case fileStorageJSONString, memoryStorageJSONString, anyStorageJSONString:
+		return 0, fmt.Errorf("store backend name %q is reserved", name)
+	}
+	b.Name = name
+
+	storeBackends.Lock()
+	defer storeBackends.Unlock()
+
+	if _, ok := storeBackends.byName[name]; ok {
+		return 0, fmt.Errorf("store backend %q already registered", name)
+	}
+	if storeBackends.byType == nil {
+		storeBackends.byType = make(map[StorageType]*StoreBackend)
+		storeBackends.byName = make(map[string]StorageType)
+		storeBackends.next = firstStoreBackendType
+	}
+	st := storeBackends.next
+	storeBackends.next++
+	storeBackends.byType[st] = &b
+	storeBackends.byName[name] = st
+	return st, nil
+}
+
+// Returns the backend registered for this storage type, if any.
+func (st StorageType) backend() *StoreBackend {
+	if st < firstStoreBackendType {
+		return nil
+	}
+	storeBackends.RLock()
+	defer storeBackends.RUnlock()
+	return storeBackends.byType[st]
+}
+
+// Returns the storage type registered under this name, if any.
+func storeBackendType(name string) (StorageType, bool) {
+	storeBackends.RLock()
+	defer storeBackends.RUnlock()
+	st, ok := storeBackends.byName[name]
+	return st, ok
+}
+
+// Returns how the bytes stored with this storage type are accounted for,
+// which is the storage type itself unless it selects a registered backend.
+func (st StorageType) accounting() StorageType {
+	if b := st.backend(); b != nil {
+		return b.Accounting
+	}
+	return st
+}
+
+// Returns true if this is a storage type that streams can use.
+func (st StorageType) isValid() bool {
+	return st == FileStorage || st == MemoryStorage || st.backend() != nil
+}
+
+// Creates the store of a stream, called with the file store configuration of the stream.
+type storeConstructor func(mset *stream, cfg *StreamConfig, fsCfg FileStoreConfig) (StreamStore, error)
+
+// The constructors of the built-in stores. Registered backends are looked up by their storage type.
+var builtinStores map[StorageType]storeConstructor
+
+func init() {
+	builtinStores = map[StorageType]storeConstructor{
+		MemoryStorage: newStreamMemStore,
+		FileStorage:   newStreamFileStore,
+	}
+}
+
+// Creates the store for the storage type of the configuration.
+// Lock should be held.
+func (mset *stream) newStore(cfg *StreamConfig, fsCfg FileStoreConfig) (StreamStore, error) {
+	if newStore := builtinStores[cfg.Storage]; newStore != nil {
+		return newStore(mset, cfg, fsCfg)
+	}
+	if b := cfg.Storage.backend(); b != nil {
+		return newStreamBackendStore(b, mset, cfg, fsCfg)
+	}
+	return nil, fmt.Errorf("storage type %v not supported", cfg.Storage)
+}
+
+func newStreamMemStore(_ *stream, cfg *StreamConfig, _ FileStoreConfig) (StreamStore, error) {
+	return newMemStore(cfg)
+}
+
+func newStreamFileStore(mset *stream, cfg *StreamConfig, fsCfg FileStoreConfig) (StreamStore, error) {
+	s := mset.srv
+	prf := s.jsKeyGen(s.getOpts().JetStreamKey, mset.acc.Name)
+	if prf != nil {
+		// We are encrypted here, fill in correct cipher selection.
+		fsCfg.Cipher = s.getOpts().JetStreamCipher
+		fsCfg.EncryptSnapshots = s.getOpts().JetStreamEncryptSnapshots
+	}
+	oldprf := s.jsKeyGen(s.getOpts().JetStreamOldKey, mset.acc.Name)
+	fsCfg.Tier = s.streamTierStore(mset.acc.Name, mset.cfg.Name)
+	fsCfg.srv = s
+	fs, err := newFileStoreWithCreated(fsCfg, *cfg, mset.created, prf, oldprf)
+	if err != nil {
+		return nil, err
+	}
+	fs.registerCompactionUpdates(mset.storeCompacted)
+	return fs, nil
+}
+
+func newStreamBackendStore(b *StoreBackend, mset *stream, cfg *StreamConfig, fsCfg FileStoreConfig) (StreamStore, error) {
+	if err := os.MkdirAll(fsCfg.StoreDir, defaultDirPerms); err != nil {
+		return nil, err
+	}
+	return b.New(StoreBackendConfig{StoreDir: fsCfg.StoreDir, Config: *cfg, Created: mset.created})
+}
+
+// Returns true if a stream can be converted from one storage type to the other. The file store
+// and backends may use the store directory, which the old store removes when deleted.
+func canConvertStorage(from, to StorageType) bool {
+	return from == MemoryStorage || to == MemoryStorage
+}
@@ -17,8 +17,16 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"reflect"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server/avl"
 )
 
 func testAllStoreAllPermutations(t *testing.T, compressionAndEncryption bool, cfg StreamConfig, fn func(t *testing.T, fs StreamStore)) {
@@ -109,3 +117,409 @@ func TestStoreMsgLoadNextMsgMulti(t *testing.T) {
 		},
 	)
 }
+
+func TestStoreStorageErrorClassification(t *testing.T) {
+	for _, test := range []struct {
+		err   error
+		class StorageErrorClass
+	}{
+		{nil, StorageErrorNone},
+		{ErrMaxMsgs, StorageErrorNone},
+		{&fs.PathError{Op: "write", Path: "1.blk", Err: syscall.ENOSPC}, StorageErrorOutOfSpace},
+		// Only classified by the error itself, not its text.
+		{errors.New("write 1.blk: no space left on device"), StorageErrorNone},
+		{&fs.PathError{Op: "open", Path: "1.blk", Err: syscall.EACCES}, StorageErrorPermission},
+		{&fs.PathError{Op: "write", Path: "1.blk", Err: syscall.EROFS}, StorageErrorPermission},
+		{fmt.Errorf("recovering: %w", errCorruptState), StorageErrorCorruption},
+		{&fs.PathError{Op: "read", Path: "1.blk", Err: syscall.EIO}, StorageErrorIO},
+		{&StorageError{Class: StorageErrorIO, Err: errors.New("boom")}, StorageErrorIO},
+	} {
+		require_Equal(t, classifyStorageError(test.err), test.class)
+		// Wrapping keeps the original error reachable and does not change the class.
+		if err := newStorageError(test.err); test.class != StorageErrorNone {
+			var serr *StorageError
+			require_True(t, errors.As(err, &serr))
+			require_Equal(t, serr.Class, test.class)
+			require_True(t, errors.Is(err, test.err))
+		} else {
+			require_True(t, err == test.err)
+		}
+	}
+}
+
+// testStreamStoreConformance runs the behaviors every StreamStore is expected
+// to share against stores created by newStore, so that alternative backends
+// can be checked against the file and memory stores.
+func testStreamStoreConformance(t *testing.T, newStore func(t *testing.T, cfg StreamConfig) StreamStore) {
+	cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}}
+
+	t.Run("StoreAndLoad", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		for i := 1; i <= 10; i++ {
+			seq, ts, err := ss.StoreMsg(fmt.Sprintf("foo.%d", i%3), []byte("hdr"), []byte("msg"))
+			require_NoError(t, err)
+			require_Equal(t, seq, uint64(i))
+			require_True(t, ts > 0)
+		}
+		var ss1 StreamState
+		ss.FastState(&ss1)
+		require_Equal(t, ss1.Msgs, 10)
+		require_Equal(t, ss1.FirstSeq, 1)
+		require_Equal(t, ss1.LastSeq, 10)
+
+		sm, err := ss.LoadMsg(5, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "foo.2")
+		require_Equal(t, string(sm.hdr), "hdr")
+		require_Equal(t, string(sm.msg), "msg")
+		require_Equal(t, sm.seq, 5)
+
+		_, err = ss.LoadMsg(11, nil)
+		require_Error(t, err, ErrStoreEOF)
+
+		sm, err = ss.LoadLastMsg("foo.1", nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.seq, 10)
+
+		sm, _, err = ss.LoadNextMsg("foo.0", false, 1, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.seq, 3)
+		sm, _, err = ss.LoadNextMsg("foo.*", true, 4, nil)
+		require_NoError(t, err)
+		require_Equal(t, sm.seq, 4)
+	})
+
+	t.Run("SubjectState", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		for i := 0; i < 9; i++ {
+			_, _, err := ss.StoreMsg(fmt.Sprintf("foo.%d", i%3), nil, []byte("msg"))
+			require_NoError(t, err)
+		}
+		fss := ss.FilteredState(1, "foo.1")
+		require_Equal(t, fss.Msgs, 3)
+		require_Equal(t, fss.First, 2)
+		require_Equal(t, fss.Last, 8)
+
+		subjects := ss.SubjectsState("foo.*")
+		require_Len(t, len(subjects), 3)
+		require_Equal(t, subjects["foo.2"].Msgs, 3)
+
+		totals := ss.SubjectsTotals(">")
+		require_Equal(t, totals["foo.0"], 3)
+
+		total, _ := ss.NumPending(4, "foo.0", false)
+		require_Equal(t, total, 2)
+		total, _ = ss.NumPending(1, "foo.*", true)
+		require_Equal(t, total, 3)
+	})
+
+	t.Run("RemoveAndPurge", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		var md, bd int64
+		ss.RegisterStorageUpdates(func(msgs, bytes int64, _ uint64, _ string) {
+			md, bd = md+msgs, bd+bytes
+		})
+		for i := 0; i < 10; i++ {
+			_, _, err := ss.StoreMsg(fmt.Sprintf("foo.%d", i%2), nil, []byte("msg"))
+			require_NoError(t, err)
+		}
+		require_Equal(t, md, 10)
+		require_True(t, bd > 0)
+
+		removed, err := ss.RemoveMsg(1)
+		require_NoError(t, err)
+		require_True(t, removed)
+		removed, _ = ss.RemoveMsg(1)
+		require_False(t, removed)
+		require_Equal(t, md, 9)
+
+		state := ss.State()
+		require_Equal(t, state.Msgs, 9)
+		require_Equal(t, state.FirstSeq, 2)
+
+		purged, err := ss.PurgeEx("foo.0", 0, 0)
+		require_NoError(t, err)
+		require_Equal(t, purged, 4)
+
+		purged, err = ss.Compact(8)
+		require_NoError(t, err)
+		require_Equal(t, purged, 3)
+		state = ss.State()
+		require_Equal(t, state.FirstSeq, 8)
+		require_Equal(t, state.Msgs, 2)
+
+		purged, err = ss.Purge()
+		require_NoError(t, err)
+		require_Equal(t, purged, 2)
+		state = ss.State()
+		require_Equal(t, state.Msgs, 0)
+		require_Equal(t, state.FirstSeq, 11)
+		require_Equal(t, state.LastSeq, 10)
+		require_Equal(t, md, 0)
+		require_Equal(t, bd, 0)
+	})
+
+	t.Run("SkipAndTruncate", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		_, _, err := ss.StoreMsg("foo.1", nil, []byte("msg"))
+		require_NoError(t, err)
+		require_Equal(t, ss.SkipMsg(), 2)
+		require_NoError(t, ss.SkipMsgs(3, 3))
+		seq, _, err := ss.StoreMsg("foo.1", nil, []byte("msg"))
+		require_NoError(t, err)
+		require_Equal(t, seq, 6)
+		require_NoError(t, ss.StoreRawMsg("foo.2", nil, []byte("msg"), 7, time.Now().UnixNano()))
+
+		state := ss.State()
+		require_Equal(t, state.Msgs, 3)
+		require_Equal(t, state.LastSeq, 7)
+		require_Equal(t, state.NumDeleted, 4)
+
+		require_NoError(t, ss.Truncate(6))
+		state = ss.State()
+		require_Equal(t, state.Msgs, 2)
+		require_Equal(t, state.LastSeq, 6)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		for i := 0; i < 10; i++ {
+			_, _, err := ss.StoreMsg("foo.1", nil, []byte("msg"))
+			require_NoError(t, err)
+		}
+		ucfg := cfg
+		ucfg.Storage = ss.Type()
+		ucfg.MaxMsgs, ucfg.MaxBytes, ucfg.MaxMsgsPer, ucfg.MaxAge = 5, -1, -1, 0
+		require_NoError(t, ss.UpdateConfig(&ucfg))
+		state := ss.State()
+		require_Equal(t, state.Msgs, 5)
+		require_Equal(t, state.FirstSeq, 6)
+
+		// The per subject limit applies to new messages.
+		ucfg.MaxMsgs, ucfg.MaxMsgsPer = -1, 2
+		require_NoError(t, ss.UpdateConfig(&ucfg))
+		_, _, err := ss.StoreMsg("foo.1", nil, []byte("msg"))
+		require_NoError(t, err)
+		state = ss.State()
+		require_Equal(t, state.Msgs, 2)
+		require_Equal(t, state.FirstSeq, 10)
+	})
+
+	t.Run("SeqFromTime", func(t *testing.T) {
+		ss := newStore(t, cfg)
+		defer ss.Stop()
+
+		_, _, err := ss.StoreMsg("foo.1", nil, []byte("msg"))
+		require_NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		start := time.Now()
+		_, _, err = ss.StoreMsg("foo.1", nil, []byte("msg"))
+		require_NoError(t, err)
+		require_Equal(t, ss.GetSeqFromTime(start), 2)
+	})
+}
+
+// Returns the storage type of a test backend that wraps the memory store.
+func testStoreBackendType(t *testing.T) StorageType {
+	t.Helper()
+	if st, ok := storeBackendType("conformance"); ok {
+		return st
+	}
+	st, err := RegisterStoreBackend(StoreBackend{
+		Name:       "conformance",
+		Accounting: MemoryStorage,
+		New: func(cfg StoreBackendConfig) (StreamStore, error) {
+			scfg := cfg.Config
+			scfg.Storage = MemoryStorage
+			return newMemStore(&scfg)
+		},
+	})
+	require_NoError(t, err)
+	return st
+}
+
+func TestStoreConformance(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		testStreamStoreConformance(t, func(t *testing.T, cfg StreamConfig) StreamStore {
+			cfg.Storage = MemoryStorage
+			ms, err := newMemStore(&cfg)
+			require_NoError(t, err)
+			return ms
+		})
+	})
+	t.Run("File", func(t *testing.T) {
+		testStreamStoreConformance(t, func(t *testing.T, cfg StreamConfig) StreamStore {
+			cfg.Storage = FileStorage
+			fs, err := newFileStore(FileStoreConfig{StoreDir: t.TempDir()}, cfg)
+			require_NoError(t, err)
+			return fs
+		})
+	})
+	t.Run("Backend", func(t *testing.T) {
+		st := testStoreBackendType(t)
+		testStreamStoreConformance(t, func(t *testing.T, cfg StreamConfig) StreamStore {
+			cfg.Storage = st
+			ss, err := st.backend().New(StoreBackendConfig{StoreDir: t.TempDir(), Config: cfg, Created: time.Now()})
+			require_NoError(t, err)
+			return ss
+		})
+	})
+}
+
+func TestStoreBackendRegistration(t *testing.T) {
+	st := testStoreBackendType(t)
+	require_True(t, st >= firstStoreBackendType)
+	require_Equal(t, st.String(), "conformance")
+	require_Equal(t, st.accounting(), MemoryStorage)
+	require_True(t, st.isValid())
+	require_False(t, StorageType(99).isValid())
+
+	b, err := json.Marshal(st)
+	require_NoError(t, err)
+	require_Equal(t, string(b), `"conformance"`)
+	var ust StorageType
+	require_NoError(t, json.Unmarshal(b, &ust))
+	require_Equal(t, ust, st)
+	require_Error(t, json.Unmarshal([]byte(`"pebble"`), &ust))
+
+	// Duplicate, reserved and incomplete registrations are rejected.
+	newStore := func(cfg StoreBackendConfig) (StreamStore, error) { return nil, nil }
+	_, err = RegisterStoreBackend(StoreBackend{Name: "Conformance", Accounting: FileStorage, New: newStore})
+	require_Contains(t, err.Error(), "already registered")
+	_, err = RegisterStoreBackend(StoreBackend{Name: "file", Accounting: FileStorage, New: newStore})
+	require_Contains(t, err.Error(), "reserved")
+	_, err = RegisterStoreBackend(StoreBackend{Name: "x", Accounting: AnyStorage, New: newStore})
+	require_Error(t, err, errStoreBackendAccounting)
+	_, err = RegisterStoreBackend(StoreBackend{Name: "x", Accounting: FileStorage})
+	require_Error(t, err, errStoreBackendInvalid)
+}
+
+func TestStoreBackendStream(t *testing.T) {
+	st := testStoreBackendType(t)
+
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	req := []byte(`{"name":"TEST","subjects":["foo"],"storage":"conformance"}`)
+	resp, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+	require_Equal(t, scResp.Config.Storage, st)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("msg"))
+		require_NoError(t, err)
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.state().Msgs, 10)
+
+	// The backend accounts for its bytes as memory.
+	stats := s.GlobalAccount().JetStreamUsage()
+	require_True(t, stats.Memory > 0)
+	require_Equal(t, stats.Store, 0)
+
+	// Streams can be converted between memory storage and a backend.
+	update := func(storage string) *ApiError {
+		t.Helper()
+		req := []byte(fmt.Sprintf(`{"name":"TEST","subjects":["foo"],"storage":%q}`, storage))
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var scResp JSApiStreamUpdateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+		return scResp.Error
+	}
+	require_True(t, update("memory") == nil)
+	require_True(t, mset.config().Storage == MemoryStorage)
+	require_Equal(t, mset.state().Msgs, 10)
+	require_True(t, update("conformance") == nil)
+	require_True(t, mset.config().Storage == st)
+	require_Equal(t, mset.state().Msgs, 10)
+	require_Equal(t, s.GlobalAccount().JetStreamUsage().Memory, stats.Memory)
+
+	// But not to file storage, which shares the store directory.
+	apiErr := update("file")
+	require_True(t, apiErr != nil)
+	require_Contains(t, apiErr.Description, "can not convert")
+
+	// Unknown storage types are rejected.
+	req = []byte(`{"name":"BAD","subjects":["bar"],"storage":"pebble"}`)
+	resp, err = nc.Request(fmt.Sprintf(JSApiStreamCreateT, "BAD"), req, time.Second)
+	require_NoError(t, err)
+	scResp = JSApiStreamCreateResponse{}
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error != nil)
+}
+
+func TestStoreSubjectLimits(t *testing.T) {
+	cfg := StreamConfig{
+		Name:     "zzz",
+		Subjects: []string{"orders.>"},
+		SubjectLimits: []SubjectLimit{
+			{Filter: "orders.eu.>", MaxMsgs: 2},
+			{Filter: "orders.us.>", MaxMsgs: 5},
+		},
+	}
+	testAllStoreAllPermutations(
+		t, false, cfg,
+		func(t *testing.T, fs StreamStore) {
+			for i := 0; i < 10; i++ {
+				for _, subj := range []string{"orders.eu.a", "orders.us.a", "orders.ap.a"} {
+					_, _, err := fs.StoreMsg(subj, nil, nil)
+					require_NoError(t, err)
+				}
+			}
+			require_Equal(t, fs.FilteredState(0, "orders.eu.>").Msgs, 2)
+			require_Equal(t, fs.FilteredState(0, "orders.us.>").Msgs, 5)
+			require_Equal(t, fs.FilteredState(0, "orders.ap.>").Msgs, 10)
+
+			// The oldest messages of a group were removed.
+			ss := fs.FilteredState(0, "orders.eu.>")
+			require_Equal(t, ss.First, 25)
+			require_Equal(t, ss.Last, 28)
+
+			// Lowering a limit enforces it.
+			ncfg := cfg.clone()
+			ncfg.Storage = fs.Type()
+			ncfg.SubjectLimits[1].MaxMsgs = 1
+			require_NoError(t, fs.UpdateConfig(ncfg))
+			require_Equal(t, fs.FilteredState(0, "orders.us.>").Msgs, 1)
+			require_Equal(t, fs.State().Msgs, 13)
+		},
+	)
+}
+
+func TestStoreDeleteBlocksRanges(t *testing.T) {
+	var dmap avl.SequenceSet
+	for _, seq := range []uint64{14, 15, 17, 22} {
+		dmap.Insert(seq)
+	}
+	dbs := DeleteBlocks{
+		&DeleteRange{First: 2, Num: 3},
+		DeleteSlice{5, 9},
+		&DeleteRange{First: 10, Num: 4},
+		&dmap,
+	}
+	require_True(t, reflect.DeepEqual(dbs.ranges(), []SequenceRange{
+		{First: 2, Last: 5},
+		{First: 9, Last: 15},
+		{First: 17, Last: 17},
+		{First: 22, Last: 22},
+	}))
+	require_Len(t, len(DeleteBlocks{}.ranges()), 0)
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,6 +43,26 @@ type StreamConfigRequest struct {
 	// This is not part of the StreamConfig, because its scoped to request,
 	// and not to the stream itself.
 	Pedantic bool `json:"pedantic,omitempty"`
+	// Token makes retries of the request idempotent, a request with a token the
+	// stream recently applied is not applied again and gets the current stream.
+	Token string `json:"idempotency_token,omitempty"`
+}
+
+// How many recent idempotency tokens of create and update requests we keep per stream.
+const maxIdempotencyTokens = 32
+
+// Returns the tokens with the token added, only keeping the most recent ones.
+// The passed tokens are not modified.
+func addIdempotencyToken(tokens []string, token string) []string {
+	if token == _EMPTY_ || slices.Contains(tokens, token) {
+		return tokens
+	}
+	if len(tokens) >= maxIdempotencyTokens {
+		tokens = tokens[len(tokens)-maxIdempotencyTokens+1:]
+	}
+	ntokens := make([]string, 0, len(tokens)+1)
+	ntokens = append(ntokens, tokens...)
+	return append(ntokens, token)
 }
 
 // StreamConfig will determine the name, subjects and retention policy
@@ -69,12 +90,111 @@ type StreamConfig struct {
 	Compression  StoreCompression `json:"compression"`
 	FirstSeq     uint64           `json:"first_seq,omitempty"`
 
+	// PersistDuplicates keeps the tracked message ids of the duplicate window on a clean stop,
+	// so a restart does not need to rescan the messages. Requires file storage.
+	PersistDuplicates bool `json:"persist_duplicates,omitempty"`
+
+	// MaxConsumersWarn is a soft limit on consumers, reaching it warns but does not reject new consumers.
+	MaxConsumersWarn int `json:"max_consumers_warn,omitempty"`
+
 	// Allow applying a subject transform to incoming messages before doing anything else
 	SubjectTransform *SubjectTransformConfig `json:"subject_transform,omitempty"`
 
 	// Allow republish of the message after being sequenced and stored.
 	RePublish *RePublish `json:"republish,omitempty"`
 
+	// Push messages to streams in separate NATS systems.
+	PushMirrors []*StreamPushMirror `json:"push_mirrors,omitempty"`
+
+	// Quarantine copies rejected messages to the account's quarantine stream.
+	Quarantine bool `json:"quarantine,omitempty"`
+
+	// DeadLetter names a stream rejected messages are copied to, created if needed.
+	DeadLetter string `json:"dead_letter,omitempty"`
+
+	// Read only copies of the stream on servers outside of its group.
+	ReadReplicas *StreamReadReplicas `json:"read_replicas,omitempty"`
+
+	// Scheduled backups of the stream taken by the leader.
+	Backup *StreamBackup `json:"backup,omitempty"`
+
+	// Sharding makes this stream one shard of a sharded stream.
+	Sharding *StreamSharding `json:"sharding,omitempty"`
+
+	// TokenPlacement declares the subject token that encodes where messages belong, e.g. a region.
+	TokenPlacement *StreamTokenPlacement `json:"token_placement,omitempty"`
+
+	// ClientInfo determines what is stored of the client info that messages imported from other accounts carry.
+	ClientInfo ClientInfoPolicy `json:"client_info,omitempty"`
+
+	// HotSubjects detects subjects with a disproportionate share of the messages, and caps subject rates.
+	HotSubjects *StreamHotSubjects `json:"hot_subjects,omitempty"`
+
+	// MaxIngestRate caps the messages and bytes per second the stream accepts from publishers.
+	MaxIngestRate *StreamIngestRate `json:"max_ingest_rate,omitempty"`
+
+	// Validation sends published messages to a validator service before they are stored.
+	Validation *StreamValidation `json:"validation,omitempty"`
+
+	// Hooks has a service approve deleting and purging the stream, and removing its subjects.
+	Hooks *StreamHooks `json:"hooks,omitempty"`
+
+	// EventTimeHeader names the header with the event time of messages, the latest
+	// one seen is the event time of the stream that consumers can start from.
+	EventTimeHeader string `json:"event_time_header,omitempty"`
+
+	// HeadersOnly drops the payload of messages at ingest, only the headers are stored
+	// with the size of the payload in the Nats-Msg-Size header.
+	HeadersOnly bool `json:"headers_only,omitempty"`
+
+	// SubjectTokens requires the subjects of stored messages to have exactly this many tokens.
+	SubjectTokens int `json:"subject_tokens,omitempty"`
+
+	// SubjectLimits limits the messages kept for groups of subjects, on top of the limits of the stream.
+	SubjectLimits []SubjectLimit `json:"subject_limits,omitempty"`
+
+	// Pause stops the stream from accepting published messages while set, see StreamPause.
+	// It is only changed through the pause and resume API, updates keep the current pause.
+	Pause *StreamPause `json:"pause,omitempty"`
+
+	// InactiveThreshold removes the stream once nothing was published to it and its consumers
+	// had no activity for this long, e.g. for streams of a session created by a template.
+	InactiveThreshold time.Duration `json:"inactive_threshold,omitempty"`
+
+	// Tiering offloads aged message blocks of the stream to the tier store of the server.
+	Tiering *StreamTiering `json:"tiering,omitempty"`
+
+	// Durability determines when writes are synced to disk, the server sync settings are used if not set.
+	Durability *StreamDurability `json:"durability,omitempty"`
+
+	// BlockSize is the size of the message blocks of file storage, tuned to the limits if not set.
+	// Changing it only applies to newly written blocks.
+	BlockSize uint64 `json:"block_size,omitempty"`
+
+	// PartitionInterval starts a new message block of file storage for every interval, e.g. every hour or day,
+	// so messages expire by MaxAge a whole partition at a time and backups can be made by partition.
+	PartitionInterval time.Duration `json:"partition_interval,omitempty"`
+
+	// SecureErase overwrites the messages removed by limits, age or deletes with random data
+	// instead of only unlinking them, for environments that require data to be erased.
+	SecureErase bool `json:"secure_erase,omitempty"`
+
+	// MaxBlocks is the most message blocks file storage keeps, which bounds the files a stream uses.
+	// With DiscardOld the oldest block is removed for a new one, with DiscardNew new messages are rejected.
+	MaxBlocks int `json:"max_blocks,omitempty"`
+
+	// ChunkLargeMsgs stores messages larger than the block size of file storage in chunks of the block size
+	// apart from the blocks, so MaxMsgSize can exceed the block size without growing blocks to fit them.
+	ChunkLargeMsgs bool `json:"chunk_large_msgs,omitempty"`
+
+	// QuotaWarning is the percentage of MaxBytes and MaxMsgs at which the system account is warned
+	// that the stream nears its limits, before messages get discarded.
+	QuotaWarning int `json:"quota_warning,omitempty"`
+
+	// SpillToDisk moves a memory stream over to a temporary file store once it would exceed the
+	// memory limits of the server or account, instead of rejecting messages.
+	SpillToDisk bool `json:"spill_to_disk,omitempty"`
+
 	// Allow higher performance, direct access to get individual messages. E.g. KeyValue
 	AllowDirect bool `json:"allow_direct"`
 	// Allow higher performance and unified direct access for mirrors as well.
@@ -94,6 +214,8 @@ type StreamConfig struct {
 	// AllowRollup allows messages to be placed into the system and purge
 	// all older messages using a special msg header.
 	AllowRollup bool `json:"allow_rollup_hdrs"`
+	// AllowMsgTTL allows messages to expire before MaxAge using the Nats-TTL header.
+	AllowMsgTTL bool `json:"allow_msg_ttl,omitempty"`
 
 	// The following defaults will apply to consumers when created against
 	// this stream, unless overridden manually.
@@ -131,6 +253,61 @@ func (cfg *StreamConfig) clone() *StreamConfig {
 		rePublish := *cfg.RePublish
 		clone.RePublish = &rePublish
 	}
+	if len(cfg.PushMirrors) > 0 {
+		clone.PushMirrors = make([]*StreamPushMirror, len(cfg.PushMirrors))
+		for i, cfgPushMirror := range cfg.PushMirrors {
+			pushMirror := *cfgPushMirror
+			clone.PushMirrors[i] = &pushMirror
+		}
+	}
+	if cfg.ReadReplicas != nil {
+		readReplicas := *cfg.ReadReplicas
+		readReplicas.Tags = copyStrings(cfg.ReadReplicas.Tags)
+		clone.ReadReplicas = &readReplicas
+	}
+	if cfg.Backup != nil {
+		backup := *cfg.Backup
+		clone.Backup = &backup
+	}
+	if cfg.HotSubjects != nil {
+		hot := *cfg.HotSubjects
+		clone.HotSubjects = &hot
+	}
+	if cfg.MaxIngestRate != nil {
+		ingest := *cfg.MaxIngestRate
+		clone.MaxIngestRate = &ingest
+	}
+	if cfg.Pause != nil {
+		pause := *cfg.Pause
+		clone.Pause = &pause
+	}
+	if cfg.Tiering != nil {
+		tiering := *cfg.Tiering
+		clone.Tiering = &tiering
+	}
+	if cfg.Durability != nil {
+		durability := *cfg.Durability
+		clone.Durability = &durability
+	}
+	if cfg.Validation != nil {
+		validation := *cfg.Validation
+		clone.Validation = &validation
+	}
+	if cfg.Hooks != nil {
+		hooks := *cfg.Hooks
+		clone.Hooks = &hooks
+	}
+	if cfg.Sharding != nil {
+		sharding := *cfg.Sharding
+		clone.Sharding = &sharding
+	}
+	if cfg.TokenPlacement != nil {
+		tokenPlacement := *cfg.TokenPlacement
+		clone.TokenPlacement = &tokenPlacement
+	}
+	if len(cfg.SubjectLimits) > 0 {
+		clone.SubjectLimits = append([]SubjectLimit(nil), cfg.SubjectLimits...)
+	}
 	if cfg.Metadata != nil {
 		clone.Metadata = make(map[string]string, len(cfg.Metadata))
 		for k, v := range cfg.Metadata {
@@ -140,6 +317,13 @@ func (cfg *StreamConfig) clone() *StreamConfig {
 	return &clone
 }
 
+// SubjectLimit limits the number of messages kept for the subjects matching the filter.
+// The oldest messages matching the filter are removed once over the limit.
+type SubjectLimit struct {
+	Filter  string `json:"filter"`
+	MaxMsgs int64  `json:"max_msgs"`
+}
+
 type StreamConsumerLimits struct {
 	InactiveThreshold time.Duration `json:"inactive_threshold,omitempty"`
 	MaxAckPending     int           `json:"max_ack_pending,omitempty"`
@@ -192,10 +376,138 @@ type StreamInfo struct {
 	Mirror     *StreamSourceInfo   `json:"mirror,omitempty"`
 	Sources    []*StreamSourceInfo `json:"sources,omitempty"`
 	Alternates []StreamAlternate   `json:"alternates,omitempty"`
+	// PushMirrors shows the progress of pushing to other NATS systems
+	PushMirrors []*StreamPushMirrorInfo `json:"push_mirrors,omitempty"`
+	// Rejections counts the messages rejected by the stream leader, by reason.
+	Rejections *StreamRejections `json:"rejections,omitempty"`
+	// StorageFailure is set when the stream is read-only after a failure of its storage.
+	StorageFailure *StreamStorageFailure `json:"storage_failure,omitempty"`
+	// Durability is the durability the stream is running with, for file storage.
+	Durability *StreamDurability `json:"durability,omitempty"`
+	// Spilled is set when a memory stream spilled over to disk.
+	Spilled bool `json:"spilled,omitempty"`
+	// Repair is set when the storage of the stream was repaired on recovery.
+	Repair *StreamRepair `json:"repair,omitempty"`
+	// Blocks has the message blocks of file storage and the files they hold open.
+	Blocks *StreamBlocks `json:"blocks,omitempty"`
+	// TokenStats has the statistics by placement token when requested.
+	TokenStats map[string]*StreamTokenStats `json:"token_stats,omitempty"`
+	// StorageStats has the statistics of the storage of the stream when requested.
+	StorageStats *StreamStorageStats `json:"storage_stats,omitempty"`
+	// Partitions has the time partitions of a partitioned stream when requested.
+	Partitions []*StreamPartition `json:"partitions,omitempty"`
+	// EventTime is the latest event time seen when the stream has an event time header.
+	EventTime *time.Time `json:"event_time,omitempty"`
 	// TimeStamp indicates when the info was gathered
 	TimeStamp time.Time `json:"ts"`
 }
 
+// StreamStorageFailure describes the failure of its storage that made a stream read-only.
+// The stream serves reads but rejects new messages until it is recovered.
+type StreamStorageFailure struct {
+	Class StorageErrorClass `json:"class"`
+	Error string            `json:"error"`
+	Since time.Time         `json:"since"`
+}
+
+// ClientInfoPolicy determines what a stream stores of the client info header
+// that messages published from other accounts carry.
+type ClientInfoPolicy string
+
+const (
+	// ClientInfoStrip removes the client info header. This is the default.
+	ClientInfoStrip = ClientInfoPolicy("strip")
+	// ClientInfoKeep stores the client info header as it was received.
+	ClientInfoKeep = ClientInfoPolicy("keep")
+	// ClientInfoMap replaces the client info header with the Nats-Origin-* headers.
+	ClientInfoMap = ClientInfoPolicy("map")
+)
+
+// StreamRejections counts the inbound messages a stream rejected, by reason.
+// Counts are kept in memory by the leader, so they start over on restarts and with a new leader.
+type StreamRejections struct {
+	// Duplicate messages, by message id.
+	Duplicate uint64 `json:"duplicate"`
+	// WrongLastSeq are failed expectations of the last sequence, overall or by subject.
+	WrongLastSeq uint64 `json:"wrong_last_seq"`
+	// WrongLastMsgId are failed expectations of the last message id.
+	WrongLastMsgId uint64 `json:"wrong_last_msg_id"`
+	// MaxSize are messages or headers exceeding their maximum size.
+	MaxSize uint64 `json:"max_size"`
+	// Limits are messages over the limits of the stream, the account or the server.
+	Limits uint64 `json:"limits"`
+	// NoQuorum are messages that could not be proposed to the stream's group.
+	NoQuorum uint64 `json:"no_quorum"`
+	// SubjectRate are messages over the rate cap of their subject.
+	SubjectRate uint64 `json:"subject_rate"`
+	// IngestRate are messages over the ingest rate cap of the stream.
+	IngestRate uint64 `json:"ingest_rate"`
+	// Validation are messages the validator rejected or did not reply to in time.
+	Validation uint64 `json:"validation"`
+	// SubjectTokens are messages with a subject that does not have the tokens the stream requires.
+	SubjectTokens uint64 `json:"subject_tokens"`
+	// Other are all other rejections, like a sealed stream or a failed store.
+	Other uint64 `json:"other"`
+}
+
+// Reasons an inbound message was rejected.
+const (
+	rejectDuplicate = iota
+	rejectWrongLastSeq
+	rejectWrongLastMsgId
+	rejectMaxSize
+	rejectLimits
+	rejectNoQuorum
+	rejectSubjectRate
+	rejectIngestRate
+	rejectValidation
+	rejectSubjectTokens
+	rejectOther
+	numRejectReasons
+)
+
+// rejected counts a rejected inbound message.
+func (mset *stream) rejected(reason int) {
+	mset.rejects[reason].Add(1)
+}
+
+// rejections returns the counts of rejected messages, nil if there were none.
+func (mset *stream) rejections() *StreamRejections {
+	var n [numRejectReasons]uint64
+	var total uint64
+	for i := range n {
+		n[i] = mset.rejects[i].Load()
+		total += n[i]
+	}
+	if total == 0 {
+		return nil
+	}
+	return &StreamRejections{
+		Duplicate:      n[rejectDuplicate],
+		WrongLastSeq:   n[rejectWrongLastSeq],
+		WrongLastMsgId: n[rejectWrongLastMsgId],
+		MaxSize:        n[rejectMaxSize],
+		Limits:         n[rejectLimits],
+		NoQuorum:       n[rejectNoQuorum],
+		SubjectRate:    n[rejectSubjectRate],
+		IngestRate:     n[rejectIngestRate],
+		Validation:     n[rejectValidation],
+		SubjectTokens:  n[rejectSubjectTokens],
+		Other:          n[rejectOther],
+	}
+}
+
+// Returns the reason to count a failure to store a message as.
+func storeErrRejectReason(err error) int {
+	switch err {
+	case ErrMaxMsgs, ErrMaxBytes, ErrMaxMsgsPerSubject, ErrMaxBlocks:
+		return rejectLimits
+	case ErrMsgTooLarge:
+		return rejectMaxSize
+	}
+	return rejectOther
+}
+
 type StreamAlternate struct {
 	Name    string `json:"name"`
 	Domain  string `json:"domain,omitempty"`
@@ -209,6 +521,17 @@ type ClusterInfo struct {
 	RaftGroup string      `json:"raft_group,omitempty"`
 	Leader    string      `json:"leader,omitempty"`
 	Replicas  []*PeerInfo `json:"replicas,omitempty"`
+	// Scale is set while replicas added by changing the replica count catch up.
+	Scale *ClusterScaleInfo `json:"scale,omitempty"`
+}
+
+// ClusterScaleInfo shows the progress of increasing the replicas of a stream.
+type ClusterScaleInfo struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Current int           `json:"current"`
+	Lag     uint64        `json:"lag,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
 }
 
 // PeerInfo shows information about all the peers in the cluster that
@@ -233,6 +556,20 @@ type StreamSourceInfo struct {
 	Error             *ApiError                `json:"error,omitempty"`
 	FilterSubject     string                   `json:"filter_subject,omitempty"`
 	SubjectTransforms []SubjectTransformConfig `json:"subject_transforms,omitempty"`
+	// Retries is the number of consecutive failed attempts to create the consumer.
+	Retries int           `json:"retries,omitempty"`
+	Bridge  *StreamBridge `json:"bridge,omitempty"`
+	// Lost is the number of messages the origin removed before they were ingested, Gap the last range of them.
+	Lost uint64           `json:"lost,omitempty"`
+	Gap  *StreamSourceGap `json:"gap,omitempty"`
+}
+
+// StreamSourceGap is a range of sequences of the origin of a mirror or source that were
+// removed, e.g. by its limits, before they were ingested.
+type StreamSourceGap struct {
+	First uint64    `json:"first_seq"`
+	Last  uint64    `json:"last_seq"`
+	Time  time.Time `json:"ts"`
 }
 
 // StreamSource dictates how streams can source from other streams.
@@ -243,6 +580,7 @@ type StreamSource struct {
 	FilterSubject     string                   `json:"filter_subject,omitempty"`
 	SubjectTransforms []SubjectTransformConfig `json:"subject_transforms,omitempty"`
 	External          *ExternalStream          `json:"external,omitempty"`
+	Bridge            *StreamBridge            `json:"bridge,omitempty"`
 
 	// Internal
 	iname string // For indexing when stream names are the same for multiple sources.
@@ -289,7 +627,13 @@ type stream struct {
 	cfgMu     sync.RWMutex            // Config mutex used to solve some races with consumer code
 	created   time.Time               // Time the stream was created.
 	stype     StorageType             // The storage type.
+	spilled   atomic.Bool             // Whether this memory stream spilled over to disk.
+	spilling  bool                    // Whether this memory stream is spilling over to disk.
+	qwarned   uint8                   // The limits we sent a quota warning for.
+	gcommit   *groupCommit            // The group commit in progress, holding back acknowledgements.
 	tier      string                  // The tier is the number of replicas for the stream (e.g. "R1" or "R3").
+	tokens    []string                // Recent idempotency tokens of create and update requests.
+	etime     int64                   // The event time watermark, the latest event time seen.
 	ddmap     map[string]*ddentry     // The dedupe map.
 	ddarr     []*ddentry              // The dedupe array.
 	ddindex   int                     // The dedupe index.
@@ -310,6 +654,50 @@ type stream struct {
 	sourcesConsumerSetup *time.Timer
 	smsgs                *ipQueue[*inMsg] // Intra-process queue for all incoming sourced messages.
 
+	// Bridges for sources from external systems.
+	bridges map[string]*bridgeInfo
+
+	// Push mirrors to separate NATS systems.
+	pushMirrors map[string]*pushMirrorInfo
+
+	// Set when our storage failed and we are configured to stop accepting messages.
+	roErr  error
+	roTime time.Time
+
+	// Set when we are a read replica, and the go routine feeding us is running.
+	readReplica bool
+	rrRunning   bool
+
+	// Scheduled backups, only running on the leader.
+	backup *backupInfo
+
+	// Traffic per subject, if hot subjects are configured.
+	hot *hotSubjects
+
+	// Rate of published messages, if capped.
+	ingest atomic.Pointer[ingestLimiter]
+
+	// Validator of published messages, if configured, and the batches it validated.
+	validator atomic.Pointer[streamValidator]
+	validated *ipQueue[*validationBatch]
+
+	// Pause of the stream, if paused. The timer kicks paused consumers at the deadline.
+	pause    atomic.Pointer[StreamPause]
+	pausetmr *time.Timer
+
+	// Removes the stream once inactive, if configured. Activity is tracked from lact.
+	itmr *time.Timer
+	lact time.Time
+
+	// Sampled statistics, if enabled.
+	stats *statsRing
+
+	// Set when we are a shard of a sharded stream, does not change.
+	shard *StreamSharding
+
+	// Counts of the inbound messages we rejected, by reason.
+	rejects [numRejectReasons]atomic.Uint64
+
 	// Indicates we have direct consumers.
 	directs int
 
@@ -326,6 +714,13 @@ type stream struct {
 	sigq  *ipQueue[*cMsg] // Intra-process queue for the messages to signal to the consumers.
 	csl   *Sublist        // Consumer subscription list.
 
+	// Owners of the messages delivered to shared consumers.
+	claimsMu sync.Mutex
+	claims   map[uint64]string
+	nclaims  uint64
+	// Set while consumers are recovered, until their claims are known again.
+	claimsRecovering atomic.Bool
+
 	// Leader will store seq/msgTrace in clustering mode. Used in applyStreamEntries
 	// to know if trace event should be sent after processing.
 	mt map[uint64]*msgTrace
@@ -336,24 +731,30 @@ type stream struct {
 
 	// TODO(dlc) - Hide everything below behind two pointers.
 	// Clustered mode.
-	sa         *streamAssignment // What the meta controller uses to assign streams to peers.
-	node       RaftNode          // Our RAFT node for the stream's group.
-	catchup    atomic.Bool       // Used to signal we are in catchup mode.
-	catchups   map[string]uint64 // The number of messages that need to be caught per peer.
-	syncSub    *subscription     // Internal subscription for sync messages (on "$JSC.SYNC").
-	infoSub    *subscription     // Internal subscription for stream info requests.
-	clMu       sync.Mutex        // The mutex for clseq and clfs.
-	clseq      uint64            // The current last seq being proposed to the NRG layer.
-	clfs       uint64            // The count (offset) of the number of failed NRG sequences used to compute clseq.
-	inflight   map[uint64]uint64 // Inflight message sizes per clseq.
-	lqsent     time.Time         // The time at which the last lost quorum advisory was sent. Used to rate limit.
-	uch        chan struct{}     // The channel to signal updates to the monitor routine.
-	compressOK bool              // True if we can do message compression in RAFT and catchup logic
-	inMonitor  bool              // True if the monitor routine has been started.
+	sa         *streamAssignment  // What the meta controller uses to assign streams to peers.
+	node       RaftNode           // Our RAFT node for the stream's group.
+	catchup    atomic.Bool        // Used to signal we are in catchup mode.
+	catchups   map[string]uint64  // The number of messages that need to be caught per peer.
+	syncSub    *subscription      // Internal subscription for sync messages (on "$JSC.SYNC").
+	infoSub    *subscription      // Internal subscription for stream info requests.
+	clMu       sync.Mutex         // The mutex for clseq and clfs.
+	clseq      uint64             // The current last seq being proposed to the NRG layer.
+	clfs       uint64             // The count (offset) of the number of failed NRG sequences used to compute clseq.
+	inflight   map[uint64]uint64  // Inflight message sizes per clseq.
+	atxnLock   string             // The atomic publish across streams holding back proposals, under clMu.
+	atxn       *atomicTxnPrepared // The atomic publish across streams we are prepared for.
+	lqsent     time.Time          // The time at which the last lost quorum advisory was sent. Used to rate limit.
+	uch        chan struct{}      // The channel to signal updates to the monitor routine.
+	compressOK bool               // True if we can do message compression in RAFT and catchup logic
+	inMonitor  bool               // True if the monitor routine has been started.
+
+	// Requests to compact the WAL, for the monitor routine.
+	wcch chan chan struct{}
 
 	// Direct get subscription.
 	directSub *subscription
 	lastBySub *subscription
+	routeSub  *subscription // Direct gets routed to us for our placement tag.
 
 	monitorWg sync.WaitGroup // Wait group for the monitor routine.
 }
@@ -386,6 +787,8 @@ type sourceInfo struct {
 	sf    string              // The subject filter.
 	sfs   []string            // The subject filters.
 	trs   []*subjectTransform // The subject transforms.
+	lost  uint64              // The number of messages the origin removed before we ingested them.
+	gap   *StreamSourceGap    // The last range of messages the origin removed before we ingested them.
 }
 
 // For mirrors and direct get
@@ -408,7 +811,20 @@ const (
 	JSConsumerStalled         = "Nats-Consumer-Stalled"
 	JSMsgRollup               = "Nats-Rollup"
 	JSMsgSize                 = "Nats-Msg-Size"
+	JSMessageTTL              = "Nats-TTL"
 	JSResponseType            = "Nats-Response-Type"
+	JSContentEncoding         = "Content-Encoding"
+)
+
+// Headers stored in place of the client info of imported messages with ClientInfoMap.
+const (
+	JSOriginAccount    = "Nats-Origin-Account"
+	JSOriginUser       = "Nats-Origin-User"
+	JSOriginName       = "Nats-Origin-Name"
+	JSOriginConnection = "Nats-Origin-Connection"
+	JSOriginHost       = "Nats-Origin-Host"
+	JSOriginServer     = "Nats-Origin-Server"
+	JSOriginCluster    = "Nats-Origin-Cluster"
 )
 
 // Headers for republished messages and direct gets.
@@ -604,7 +1020,7 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 
 	// Check for overlapping subjects with other streams.
 	// These are not allowed for now.
-	if jsa.subjectsOverlap(cfg.Subjects, nil) {
+	if jsa.subjectsOverlap(cfg.Subjects, cfg.Sharding, nil) {
 		jsa.mu.Unlock()
 		return nil, NewJSStreamSubjectOverlapError()
 	}
@@ -638,7 +1054,9 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		client:    c,
 		sysc:      ic,
 		tier:      tier,
-		stype:     cfg.Storage,
+		stype:     cfg.Storage.accounting(),
+		shard:     cfg.Sharding,
+		hot:       newHotSubjects(s, a, cfg.Name, cfg.HotSubjects),
 		consumers: make(map[string]*consumer),
 		msgs: newIPQueue[*inMsg](s, qpfx+"messages",
 			ipqSizeCalculation(func(msg *inMsg) uint64 {
@@ -651,17 +1069,22 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		qch:  make(chan struct{}),
 		mqch: make(chan struct{}),
 		uch:  make(chan struct{}, 4),
+		wcch: make(chan chan struct{}, 1),
 		sch:  make(chan struct{}, 1),
 	}
+	mset.ingest.Store(newIngestLimiter(cfg.MaxIngestRate))
+	mset.validator.Store(newStreamValidator(cfg.Validation))
+	mset.validated = newIPQueue[*validationBatch](s, qpfx+"validated messages")
+	mset.setPause(cfg.Pause)
+	mset.setInactiveThreshold(cfg.InactiveThreshold)
 
 	// Start our signaling routine to process consumers.
 	mset.sigq = newIPQueue[*cMsg](s, qpfx+"obs") // of *cMsg
 	go mset.signalConsumersLoop()
 
 	// For no-ack consumers when we are interest retention.
-	if cfg.Retention != LimitsPolicy {
-		mset.ackq = newIPQueue[uint64](s, qpfx+"acks")
-	}
+	// Always created, since the retention can change with an update.
+	mset.ackq = newIPQueue[uint64](s, qpfx+"acks")
 
 	// Check for input subject transform
 	if cfg.SubjectTransform != nil {
@@ -684,6 +1107,7 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		mset.tr = tr
 	}
 	storeDir := filepath.Join(jsa.storeDir, streamsDir, cfg.Name)
+	indexDir := jsa.streamIndexDir(cfg.Name)
 	jsa.mu.Unlock()
 
 	// Bind to the user account.
@@ -702,11 +1126,17 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		}
 	}
 	fsCfg.StoreDir = storeDir
+	fsCfg.IndexDir = indexDir
+	// Streams can opt into async flushes with their durability.
 	fsCfg.AsyncFlush = false
-	// Grab configured sync interval.
-	fsCfg.SyncInterval = s.getOpts().SyncInterval
+	// Grab configured sync interval, which accounts can override.
+	fsCfg.SyncInterval = a.syncInterval(s.getOpts())
 	fsCfg.SyncAlways = s.getOpts().SyncAlways
 	fsCfg.Compression = config.Compression
+	fsCfg.Preallocate = s.getOpts().JetStreamPreallocate
+	fsCfg.DirectIO = s.getOpts().JetStreamDirectIO
+	fsCfg.MaxBlocks = s.getOpts().JetStreamMaxBlocks
+	fsCfg.readAhead = jsa.readAhead
 
 	if err := mset.setupStore(fsCfg); err != nil {
 		mset.stop(true, false)
@@ -729,6 +1159,7 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 	// Possible race with consumer.setLeader during recovery.
 	mset.mu.Lock()
 	mset.lseq = state.LastSeq
+	mset.resetEventTime()
 	mset.mu.Unlock()
 
 	// If no msgs (new stream), set dedupe state loaded to true.
@@ -756,6 +1187,9 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		}
 	}
 
+	// Let everyone know if our storage had to be repaired.
+	mset.sendRepairAdvisory()
+
 	// This is always true in single server mode.
 	if mset.IsLeader() {
 		// Send advisory.
@@ -789,6 +1223,10 @@ func (ssi *StreamSource) composeIName() string {
 	if ssi.External != nil {
 		iName = iName + ":" + getHash(ssi.External.ApiPrefix)
 	}
+	if ssi.Bridge != nil {
+		iName = iName + ":" + getHash(ssi.Bridge.Type+" "+ssi.Bridge.Remote)
+		return strings.Join([]string{iName, ssi.Bridge.Subject, fwcs}, " ")
+	}
 
 	source := ssi.FilterSubject
 	destination := fwcs
@@ -833,9 +1271,24 @@ func (mset *stream) streamAssignment() *streamAssignment {
 	return mset.sa
 }
 
+// Returns if the stream recently applied a request with the idempotency token.
+func (mset *stream) hasToken(token string) bool {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	return slices.Contains(mset.tokens, token)
+}
+
+// Tracks the idempotency token of an applied request.
+func (mset *stream) addToken(token string) {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	mset.tokens = addIdempotencyToken(mset.tokens, token)
+}
+
 func (mset *stream) setStreamAssignment(sa *streamAssignment) {
 	var node RaftNode
 	var peers []string
+	var isReader bool
 
 	mset.mu.RLock()
 	js := mset.js
@@ -846,6 +1299,10 @@ func (mset *stream) setStreamAssignment(sa *streamAssignment) {
 		if sa.Group != nil {
 			node = sa.Group.node
 			peers = sa.Group.Peers
+			if cc := js.cluster; cc != nil && cc.meta != nil {
+				ourID := cc.meta.ID()
+				isReader = !sa.Group.isMember(ourID) && sa.Group.isReader(ourID)
+			}
 		}
 		js.mu.RUnlock()
 	}
@@ -863,9 +1320,11 @@ func (mset *stream) setStreamAssignment(sa *streamAssignment) {
 	if mset.node != nil {
 		mset.node.UpdateKnownPeers(peers)
 	}
+	mset.readReplica = isReader
 
 	// Setup our info sub here as well for all stream members. This is now by design.
-	if mset.infoSub == nil {
+	// Read replicas are not members, so they never answer for the stream.
+	if mset.infoSub == nil && !mset.readReplica {
 		isubj := fmt.Sprintf(clusterStreamInfoT, mset.jsa.acc(), mset.cfg.Name)
 		// Note below the way we subscribe here is so that we can send requests to ourselves.
 		mset.infoSub, _ = mset.srv.systemSubscribe(isubj, _EMPTY_, false, mset.sysc, mset.handleClusterStreamInfoRequest)
@@ -908,7 +1367,8 @@ func (mset *stream) isLeader() bool {
 	if mset.isClustered() {
 		return mset.node.Leader()
 	}
-	return true
+	// Read replicas have no group, but are never the leader.
+	return !mset.readReplica
 }
 
 // TODO(dlc) - Check to see if we can accept being the leader or we should step down.
@@ -1023,6 +1483,12 @@ func (mset *stream) maxMsgSize() uint64 {
 func (mset *stream) autoTuneFileStorageBlockSize(fsCfg *FileStoreConfig) {
 	var totalEstSize uint64
 
+	// An explicit block size takes precedence.
+	if mset.cfg.BlockSize > 0 {
+		fsCfg.BlockSize = mset.cfg.BlockSize
+		return
+	}
+
 	// MaxBytes will take precedence for now.
 	if mset.cfg.MaxBytes > 0 {
 		totalEstSize = uint64(mset.cfg.MaxBytes)
@@ -1052,6 +1518,28 @@ func (mset *stream) autoTuneFileStorageBlockSize(fsCfg *FileStoreConfig) {
 	fsCfg.BlockSize = uint64(blkSize)
 }
 
+// Returns true if the block size of a file store would be tuned differently for the new configuration.
+func blockSizeTuningChanged(ocfg, cfg *StreamConfig) bool {
+	return cfg.BlockSize != ocfg.BlockSize || cfg.MaxBytes != ocfg.MaxBytes || cfg.MaxMsgs != ocfg.MaxMsgs ||
+		cfg.MaxMsgsPer != ocfg.MaxMsgsPer || cfg.MaxMsgSize != ocfg.MaxMsgSize || cfg.Retention != ocfg.Retention
+}
+
+// Tunes the block size of our file store again for the current configuration,
+// the same as a restart would. Existing blocks are kept, new blocks use the new size.
+// Lock should be held.
+func (mset *stream) retuneFileStorageBlockSize() {
+	fs, ok := mset.store.(*fileStore)
+	if !ok {
+		return
+	}
+	var fsCfg FileStoreConfig
+	mset.autoTuneFileStorageBlockSize(&fsCfg)
+	if fsCfg.BlockSize == 0 {
+		fsCfg.BlockSize = dynBlkSize(mset.cfg.Retention, mset.cfg.MaxBytes, fs.prf != nil)
+	}
+	fs.setBlockSize(fsCfg.BlockSize)
+}
+
 // rebuildDedupe will rebuild any dedupe structures needed after recovery of a stream.
 // Will be called lazily to avoid penalizing startup times.
 // TODO(dlc) - Might be good to know if this should be checked at all for streams with no
@@ -1064,15 +1552,22 @@ func (mset *stream) rebuildDedupe() {
 
 	mset.ddloaded = true
 
+	var state StreamState
+	mset.store.FastState(&state)
+
+	// Restore the state kept on a clean stop, only newer messages need to be scanned.
+	last, restored := mset.restoreDedupeState(state.LastSeq)
+
 	// We have some messages. Lookup starting sequence by duplicate time window.
 	sseq := mset.store.GetSeqFromTime(time.Now().Add(-mset.cfg.Duplicates))
 	if sseq == 0 {
 		return
 	}
+	if restored && last >= sseq {
+		sseq = last + 1
+	}
 
 	var smv StoreMsg
-	var state StreamState
-	mset.store.FastState(&state)
 
 	for seq := sseq; seq <= state.LastSeq; seq++ {
 		sm, err := mset.store.LoadMsg(seq, &smv)
@@ -1091,6 +1586,95 @@ func (mset *stream) rebuildDedupe() {
 	}
 }
 
+// Version of the encoded dedupe state.
+const dedupeStateVersion = uint8(1)
+
+// Encodes the message ids of the duplicate window and the last sequence they cover.
+// Lock should be held.
+func (mset *stream) encodeDedupeState() []byte {
+	var state StreamState
+	mset.store.FastState(&state)
+
+	b := []byte{magic, dedupeStateVersion}
+	b = binary.AppendUvarint(b, state.LastSeq)
+	b = binary.AppendUvarint(b, uint64(len(mset.lmsgId)))
+	b = append(b, mset.lmsgId...)
+	b = binary.AppendUvarint(b, uint64(len(mset.ddarr)-mset.ddindex))
+	for _, dde := range mset.ddarr[mset.ddindex:] {
+		b = binary.AppendUvarint(b, uint64(len(dde.id)))
+		b = append(b, dde.id...)
+		b = binary.AppendUvarint(b, dde.seq)
+		b = binary.AppendVarint(b, dde.ts)
+	}
+	return b
+}
+
+// Restores the dedupe state written on a clean stop, if it is still valid for the
+// last sequence of the store. Returns the last sequence covered by the state.
+// Lock should be held.
+func (mset *stream) restoreDedupeState(lseq uint64) (uint64, bool) {
+	fs, ok := mset.store.(*fileStore)
+	if !ok {
+		return 0, false
+	}
+	b, err := fs.readDedupeState()
+	if err != nil || len(b) < 2 || b[0] != magic || b[1] != dedupeStateVersion {
+		return 0, false
+	}
+	b = b[2:]
+
+	// Helpers to decode the state, any error will leave the state as empty.
+	var bad bool
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	str := func() string {
+		l := uvarint()
+		if bad || uint64(len(b)) < l {
+			bad = true
+			return _EMPTY_
+		}
+		s := string(b[:l])
+		b = b[l:]
+		return s
+	}
+
+	last, lmsgId := uvarint(), str()
+	// The store went backwards, so we can not trust the state.
+	if bad || last > lseq {
+		return 0, false
+	}
+	var ddes []*ddentry
+	window := time.Now().Add(-mset.cfg.Duplicates).UnixNano()
+	for i, n := uint64(0), uvarint(); i < n && !bad; i++ {
+		id, seq := str(), uvarint()
+		ts, vn := binary.Varint(b)
+		if bad || vn <= 0 {
+			return 0, false
+		}
+		b = b[vn:]
+		if ts > window {
+			ddes = append(ddes, &ddentry{id, seq, ts})
+		}
+	}
+	if bad {
+		return 0, false
+	}
+	for _, dde := range ddes {
+		mset.storeMsgIdLocked(dde)
+	}
+	if last == lseq {
+		mset.lmsgId = lmsgId
+	}
+	return last, true
+}
+
 func (mset *stream) lastSeqAndCLFS() (uint64, uint64) {
 	return mset.lastSeq(), mset.getCLFS()
 }
@@ -1221,11 +1805,15 @@ func (mset *stream) setCreatedTime(created time.Time) {
 // subjectsOverlap to see if these subjects overlap with existing subjects.
 // Use only for non-clustered JetStream
 // RLock minimum should be held.
-func (jsa *jsAccount) subjectsOverlap(subjects []string, self *stream) bool {
+func (jsa *jsAccount) subjectsOverlap(subjects []string, sharding *StreamSharding, self *stream) bool {
 	for _, mset := range jsa.streams {
 		if self != nil && mset == self {
 			continue
 		}
+		// Shards of the same stream share their subjects.
+		if sharding.isSibling(mset.cfg.Sharding) {
+			continue
+		}
 		for _, subj := range mset.cfg.Subjects {
 			for _, tsubj := range subjects {
 				if SubjectsCollide(tsubj, subj) {
@@ -1240,6 +1828,46 @@ func (jsa *jsAccount) subjectsOverlap(subjects []string, self *stream) bool {
 // StreamDefaultDuplicatesWindow default duplicates window.
 const StreamDefaultDuplicatesWindow = 2 * time.Minute
 
+// Checks that the subjects of the stream can have the number of tokens it requires.
+func checkSubjectTokens(cfg *StreamConfig) error {
+	if cfg.SubjectTokens < 0 {
+		return errors.New("subject tokens can not be negative")
+	}
+	if cfg.Mirror != nil {
+		return errors.New("subject tokens can not be required for a mirror")
+	}
+	// A transform decides what subjects are stored.
+	if cfg.SubjectTransform != nil {
+		return nil
+	}
+	for _, subj := range cfg.Subjects {
+		n := numTokens(subj)
+		if (strings.HasSuffix(subj, fwcs) && n <= cfg.SubjectTokens) || n == cfg.SubjectTokens {
+			continue
+		}
+		return fmt.Errorf("subject %q can not have %d tokens", subj, cfg.SubjectTokens)
+	}
+	return nil
+}
+
+// Checks the limits of the subject groups of the stream.
+func checkSubjectLimits(cfg *StreamConfig) error {
+	filters := make(map[string]struct{}, len(cfg.SubjectLimits))
+	for _, sl := range cfg.SubjectLimits {
+		if !IsValidSubject(sl.Filter) {
+			return fmt.Errorf("subject limit filter %q is not a valid subject", sl.Filter)
+		}
+		if sl.MaxMsgs <= 0 {
+			return fmt.Errorf("subject limit for %q needs max msgs to be > 0", sl.Filter)
+		}
+		if _, ok := filters[sl.Filter]; ok {
+			return fmt.Errorf("duplicate subject limit for %q", sl.Filter)
+		}
+		filters[sl.Filter] = struct{}{}
+	}
+	return nil
+}
+
 func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic bool) (StreamConfig, *ApiError) {
 	lim := &s.getOpts().JetStreamLimits
 
@@ -1270,6 +1898,9 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 	if cfg.Storage == 0 {
 		cfg.Storage = FileStorage
 	}
+	if !cfg.Storage.isValid() {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("storage type %v not supported", cfg.Storage))
+	}
 	if cfg.Replicas == 0 {
 		cfg.Replicas = 1
 	}
@@ -1294,6 +1925,15 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 	if cfg.MaxConsumers == 0 {
 		cfg.MaxConsumers = -1
 	}
+	if cfg.MaxConsumersWarn < 0 {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("max consumers warn can not be negative"))
+	}
+	if cfg.MaxConsumersWarn > 0 && cfg.MaxConsumers > 0 && cfg.MaxConsumersWarn > cfg.MaxConsumers {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("max consumers warn can not be above max consumers"))
+	}
+	if strings.ContainsAny(cfg.EventTimeHeader, " \t\r\n:") {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("event time header is not a valid header name"))
+	}
 	if cfg.Duplicates == 0 && cfg.Mirror == nil {
 		maxWindow := StreamDefaultDuplicatesWindow
 		if lim.Duplicates > 0 && maxWindow > lim.Duplicates {
@@ -1317,6 +1957,58 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 	if cfg.Duplicates < 0 {
 		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("duplicates window can not be negative"))
 	}
+	if cfg.InactiveThreshold < 0 {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("inactive threshold can not be negative"))
+	}
+	if cfg.Durability != nil {
+		if err := cfg.Durability.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+	if cfg.BlockSize > 0 {
+		if cfg.Storage != FileStorage {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("block size requires file storage"))
+		}
+		if cfg.BlockSize < FileStoreMinBlkSize || cfg.BlockSize > FileStoreMaxBlkSize {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("block size must be between %s and %s",
+				friendlyBytes(FileStoreMinBlkSize), friendlyBytes(FileStoreMaxBlkSize)))
+		}
+	}
+	if err := validatePartitionInterval(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+	if err := validateSecureErase(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+	if err := validateMaxBlocks(&cfg, s.getOpts().JetStreamMaxBlocks); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+	if err := validateChunkLargeMsgs(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+	if cfg.QuotaWarning != 0 {
+		if cfg.QuotaWarning < 0 || cfg.QuotaWarning >= 100 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("quota warning must be a percentage between 1 and 99"))
+		}
+		if cfg.MaxBytes <= 0 && cfg.MaxMsgs <= 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("quota warning requires max bytes or max messages"))
+		}
+	}
+	if err := validateSpillToDisk(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+	if cfg.Tiering != nil {
+		var tier TierStore
+		if js := s.getJetStream(); js != nil {
+			tier = js.tier
+		}
+		if err := cfg.Tiering.validate(&cfg, tier); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+	if cfg.PersistDuplicates && cfg.Storage != FileStorage {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("persisting duplicates requires file storage"))
+	}
 	// Check that duplicates is not larger then age if set.
 	if cfg.MaxAge != 0 && cfg.Duplicates > cfg.MaxAge {
 		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("duplicates window can not be larger then max age"))
@@ -1385,6 +2077,9 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 		if cfg.Mirror.FilterSubject != _EMPTY_ && len(cfg.Mirror.SubjectTransforms) != 0 {
 			return StreamConfig{}, NewJSMirrorMultipleFiltersNotAllowedError()
 		}
+		if cfg.Mirror.Bridge != nil {
+			return StreamConfig{}, NewJSSourceBridgeInvalidError(errors.New("bridges are not supported for mirrors"))
+		}
 		// Check subject filters overlap.
 		for outer, tr := range cfg.Mirror.SubjectTransforms {
 			if tr.Source != _EMPTY_ && !IsValidSubject(tr.Source) {
@@ -1462,6 +2157,18 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 		} else {
 			return StreamConfig{}, NewJSSourceDuplicateDetectedError()
 		}
+		// Bridges pull from systems outside of JetStream, so none of the stream checks apply.
+		if src.Bridge != nil {
+			if src.External != nil || src.FilterSubject != _EMPTY_ || len(src.SubjectTransforms) > 0 ||
+				src.OptStartSeq > 0 || src.OptStartTime != nil {
+				return StreamConfig{}, NewJSSourceBridgeInvalidError(
+					errors.New("bridges do not support external, filters, transforms or start positions"))
+			}
+			if err := src.Bridge.validate(s, acc.GetName()); err != nil {
+				return StreamConfig{}, NewJSSourceBridgeInvalidError(err)
+			}
+			continue
+		}
 		// Do not perform checks if External is provided, as it could lead to
 		// checking against itself (if sourced stream name is the same on different JetStream)
 		if src.External == nil {
@@ -1531,6 +2238,109 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 		}
 	}
 
+	// The quarantine stream can not quarantine its own messages.
+	if cfg.Quarantine && cfg.Name == JSQuarantineStream {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(errors.New("quarantine stream can not have quarantine enabled"))
+	}
+
+	// Check the dead letter stream.
+	if cfg.DeadLetter != _EMPTY_ {
+		if !isValidName(cfg.DeadLetter) {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("dead letter stream name %q is not valid", cfg.DeadLetter))
+		}
+		if cfg.DeadLetter == cfg.Name {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(errors.New("stream can not be its own dead letter stream"))
+		}
+	}
+
+	// Check push mirrors.
+	pmNames := make(map[string]struct{})
+	for _, pm := range cfg.PushMirrors {
+		if err := pm.validate(s, acc.GetName()); err != nil {
+			return StreamConfig{}, NewJSStreamPushMirrorInvalidError(err)
+		}
+		if _, ok := pmNames[pm.Name]; ok {
+			return StreamConfig{}, NewJSStreamPushMirrorInvalidError(fmt.Errorf("duplicate name %q", pm.Name))
+		}
+		pmNames[pm.Name] = struct{}{}
+	}
+
+	// Check read replicas.
+	if cfg.ReadReplicas != nil {
+		if err := cfg.ReadReplicas.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamReadReplicasInvalidError(err)
+		}
+	}
+
+	// Check the backup schedule.
+	if cfg.Backup != nil {
+		if err := cfg.Backup.validate(&cfg, s.getOpts().JetStreamBackupDir != _EMPTY_); err != nil {
+			return StreamConfig{}, NewJSStreamBackupInvalidError(err)
+		}
+	}
+
+	// Check hot subjects.
+	if cfg.HotSubjects != nil {
+		if err := cfg.HotSubjects.validate(); err != nil {
+			return StreamConfig{}, NewJSStreamHotSubjectsInvalidError(err)
+		}
+	}
+
+	// Check the ingest rate.
+	if cfg.MaxIngestRate != nil {
+		if err := cfg.MaxIngestRate.validate(); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	// Check the validation.
+	if cfg.Validation != nil {
+		if err := cfg.Validation.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	// Check the lifecycle hooks.
+	if cfg.Hooks != nil {
+		if err := cfg.Hooks.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	// Check the subject tokens.
+	if cfg.SubjectTokens != 0 {
+		if err := checkSubjectTokens(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	// Check the subject limits.
+	if len(cfg.SubjectLimits) > 0 {
+		if err := checkSubjectLimits(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	// Check sharding.
+	if cfg.Sharding != nil {
+		if err := cfg.Sharding.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamShardingInvalidError(err)
+		}
+	}
+
+	// Check token placement.
+	if cfg.TokenPlacement != nil {
+		if err := cfg.TokenPlacement.validate(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamTokenPlacementInvalidError(err)
+		}
+	}
+
+	switch cfg.ClientInfo {
+	case _EMPTY_, ClientInfoStrip, ClientInfoKeep, ClientInfoMap:
+	default:
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("unknown client info policy %q", cfg.ClientInfo))
+	}
+
 	// cycle check for source cycle
 	toVisit := []*StreamConfig{&cfg}
 	visited := make(map[string]struct{})
@@ -1551,7 +2361,7 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account, pedantic boo
 		toVisit = toVisit[1:]
 		visited[cfg.Name] = struct{}{}
 		for _, src := range cfg.Sources {
-			if src.External != nil {
+			if src.External != nil || src.Bridge != nil {
 				continue
 			}
 			// We can detect a cycle between streams, but let's double check that the
@@ -1718,19 +2528,13 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server, pedan
 	if cfg.Name != old.Name {
 		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration name must match original"))
 	}
-	// Can't change MaxConsumers for now.
-	if cfg.MaxConsumers != old.MaxConsumers {
-		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change MaxConsumers"))
-	}
-	// Can't change storage types.
-	if cfg.Storage != old.Storage {
-		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change storage type"))
+	// Stores on disk share the store directory, so only one side of a conversion can be.
+	if cfg.Storage != old.Storage && !canConvertStorage(old.Storage, cfg.Storage) {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not convert between %v and %v storage", old.Storage, cfg.Storage))
 	}
-	// Can only change retention from limits to interest or back, not to/from work queue for now.
-	if cfg.Retention != old.Retention {
-		if old.Retention == WorkQueuePolicy || cfg.Retention == WorkQueuePolicy {
-			return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change retention policy to/from workqueue"))
-		}
+	// Can't scale up without clustering.
+	if cfg.Replicas != old.Replicas && cfg.Replicas > 1 && !s.JetStreamIsClustered() && s.standAloneMode() {
+		return nil, ApiErrors[JSStreamReplicasNotSupportedErr]
 	}
 	// Can not have a template owner for now.
 	if old.Template != _EMPTY_ {
@@ -1751,10 +2555,18 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server, pedan
 	if !cfg.DenyPurge && old.DenyPurge {
 		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not cancel deny purge"))
 	}
+	// Can not change from true to false.
+	if !cfg.AllowMsgTTL && old.AllowMsgTTL {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not disable message TTL"))
+	}
 	// Check for mirror changes which are not allowed.
 	if !reflect.DeepEqual(cfg.Mirror, old.Mirror) {
 		return nil, NewJSStreamMirrorNotUpdatableError()
 	}
+	// Can not change sharding.
+	if !reflect.DeepEqual(cfg.Sharding, old.Sharding) {
+		return nil, NewJSStreamShardingInvalidError(errors.New("sharding can not be changed"))
+	}
 
 	// Check on new discard new per subject.
 	if cfg.DiscardNewPer {
@@ -1779,6 +2591,12 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server, pedan
 
 	// First, let's calculate the difference between the new and old MaxBytes.
 	maxBytesDiff := cfg.MaxBytes - old.MaxBytes
+	convert := cfg.Storage.accounting() != old.Storage.accounting()
+	if convert {
+		// When converting the storage type all of MaxBytes needs to be
+		// reserved against the new storage type.
+		maxBytesDiff = cfg.MaxBytes
+	}
 	if maxBytesDiff < 0 {
 		// If we're updating to a lower MaxBytes (maxBytesDiff is negative),
 		// then set to zero so checkBytesLimits doesn't set addBytes to 1.
@@ -1820,11 +2638,14 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server, pedan
 	if isClustered {
 		_, reserved = tieredStreamAndReservationCount(js.cluster.streams[acc.Name], tier, &cfg)
 	}
-	// reservation does not account for this stream, hence add the old value
-	if tier == _EMPTY_ && old.Replicas > 1 {
-		reserved += old.MaxBytes * int64(old.Replicas)
-	} else {
-		reserved += old.MaxBytes
+	// reservation does not account for this stream, hence add the old value,
+	// unless it was reserved against the storage type we are converting from.
+	if !convert {
+		if tier == _EMPTY_ && old.Replicas > 1 {
+			reserved += old.MaxBytes * int64(old.Replicas)
+		} else {
+			reserved += old.MaxBytes
+		}
 	}
 	if err := js.checkAllLimits(&selected, &cfg, reserved, maxBytesOffset); err != nil {
 		return nil, err
@@ -1866,17 +2687,7 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 		ocfg.ConsumerLimits.MaxAckPending != cfg.ConsumerLimits.MaxAckPending
 	if updateLimits {
 		var errorConsumers []string
-		consumers := map[string]*ConsumerConfig{}
-		if mset.js.isClustered() {
-			for _, c := range mset.sa.consumers {
-				consumers[c.Name] = c.Config
-			}
-		} else {
-			for _, c := range mset.consumers {
-				consumers[c.name] = &c.cfg
-			}
-		}
-		for name, ccfg := range consumers {
+		for name, ccfg := range mset.consumerConfigs() {
 			if ccfg.InactiveThreshold > cfg.ConsumerLimits.InactiveThreshold ||
 				ccfg.MaxAckPending > cfg.ConsumerLimits.MaxAckPending {
 				errorConsumers = append(errorConsumers, name)
@@ -1889,13 +2700,45 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 		}
 	}
 
+	// Changing the retention policy needs the consumers to allow the new one.
+	if cfg.Retention != ocfg.Retention {
+		if err := checkRetentionMigration(cfg, mset.consumerConfigs()); err != nil {
+			return NewJSStreamInvalidConfigError(err)
+		}
+	}
+
 	jsa.mu.RLock()
-	if jsa.subjectsOverlap(cfg.Subjects, mset) {
+	if jsa.subjectsOverlap(cfg.Subjects, cfg.Sharding, mset) {
 		jsa.mu.RUnlock()
 		return NewJSStreamSubjectOverlapError()
 	}
+	storeDir := filepath.Join(jsa.storeDir, streamsDir, cfg.Name)
+	indexDir := jsa.streamIndexDir(cfg.Name)
 	jsa.mu.RUnlock()
 
+	// If the storage type changes, copy the messages over to a new store before taking the
+	// lock, which then only needs to be held to catch up and swap in the new store.
+	var sc *storeConversion
+	if cfg.Storage != ocfg.Storage {
+		mset.mu.Lock()
+		sc, err = mset.newStoreConversion(cfg, storeDir, indexDir)
+		mset.mu.Unlock()
+		if err == nil {
+			err = sc.copy()
+		}
+		if err != nil {
+			if sc != nil {
+				sc.abort()
+			}
+			return NewJSStreamStoreFailedError(err)
+		}
+		defer func() {
+			if sc != nil {
+				sc.abort()
+			}
+		}()
+	}
+
 	mset.mu.Lock()
 	if mset.isLeader() {
 		// Now check for subject interest differences.
@@ -1940,6 +2783,10 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 			}
 			for _, s := range cfg.Sources {
 				s.setIndexName()
+				// Bridges are handled below.
+				if s.Bridge != nil {
+					continue
+				}
 				if _, ok := currentIName[s.iname]; !ok {
 					// new source
 					if mset.sources == nil {
@@ -1987,7 +2834,41 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 			for iName := range neededCopy {
 				mset.setupSourceConsumer(iName, mset.sources[iName].sseq+1, time.Time{})
 			}
+			mset.updateBridges(cfg.Sources)
 		}
+
+		// Check for push mirrors.
+		if len(cfg.PushMirrors) > 0 || len(ocfg.PushMirrors) > 0 {
+			mset.updatePushMirrors(cfg.PushMirrors)
+		}
+
+		// Check for backup schedule changes.
+		mset.startBackup(cfg.Backup)
+
+		// Check if quarantine was enabled.
+		if cfg.Quarantine && !ocfg.Quarantine {
+			mset.ensureQuarantineStream()
+		}
+		if cfg.DeadLetter != ocfg.DeadLetter {
+			mset.ensureDeadLetterStream(cfg.DeadLetter)
+		}
+	}
+
+	// Start over measuring traffic per subject if that changed.
+	if !reflect.DeepEqual(cfg.HotSubjects, ocfg.HotSubjects) {
+		mset.hot = newHotSubjects(mset.srv, mset.acc, cfg.Name, cfg.HotSubjects)
+	}
+	if !reflect.DeepEqual(cfg.MaxIngestRate, ocfg.MaxIngestRate) {
+		mset.ingest.Store(newIngestLimiter(cfg.MaxIngestRate))
+	}
+	if !reflect.DeepEqual(cfg.Validation, ocfg.Validation) {
+		mset.validator.Swap(newStreamValidator(cfg.Validation)).close(mset)
+	}
+	if !reflect.DeepEqual(cfg.Pause, ocfg.Pause) {
+		mset.setPause(cfg.Pause)
+	}
+	if cfg.InactiveThreshold != ocfg.InactiveThreshold {
+		mset.setInactiveThreshold(cfg.InactiveThreshold)
 	}
 
 	// Check for a change in allow direct status.
@@ -2059,15 +2940,17 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 		// a subsequent update to an existing tier will then move from existing past tier to existing new tier
 	}
 
-	if mset.isLeader() && mset.sa != nil && ocfg.Retention != cfg.Retention && cfg.Retention == InterestPolicy {
-		// Before we can update the retention policy for the consumer, we need
-		// the replica count of all consumers to match the stream.
-		for _, c := range mset.sa.consumers {
-			if c.Config.Replicas > 0 && c.Config.Replicas != cfg.Replicas {
-				mset.mu.Unlock()
-				return fmt.Errorf("consumer %q replica count must be %d", c.Name, cfg.Replicas)
-			}
+	// What our reservation is held against, file storage once spilled.
+	rcfg := mset.storeConfig(&ocfg)
+
+	// If the storage type changed, move everything over to a new store.
+	if sc != nil {
+		if err := sc.finish(); err != nil {
+			mset.mu.Unlock()
+			return NewJSStreamStoreFailedError(err)
 		}
+		sc = nil
+		mset.spilled.Store(false)
 	}
 
 	// Now update config and store's version of our config.
@@ -2080,26 +2963,18 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 	mset.cfg = *cfg
 	mset.cfgMu.Unlock()
 
-	// If we're changing retention and haven't errored because of consumer
-	// replicas by now, whip through and update the consumer retention.
-	if ocfg.Retention != cfg.Retention && cfg.Retention == InterestPolicy {
-		toUpdate := make([]*consumer, 0, len(mset.consumers))
-		for _, c := range mset.consumers {
-			toUpdate = append(toUpdate, c)
-		}
-		var ss StreamState
-		mset.store.FastState(&ss)
+	if cfg.EventTimeHeader != ocfg.EventTimeHeader {
+		mset.resetEventTime()
+	}
+
+	if cfg.Storage != ocfg.Storage || blockSizeTuningChanged(&ocfg, cfg) {
+		mset.retuneFileStorageBlockSize()
+	}
+
+	// If we're changing retention, whip through and update the consumer retention.
+	if ocfg.Retention != cfg.Retention {
 		mset.mu.Unlock()
-		for _, c := range toUpdate {
-			c.mu.Lock()
-			c.retention = cfg.Retention
-			c.mu.Unlock()
-			if c.retention == InterestPolicy {
-				// If we're switching to interest, force a check of the
-				// interest of existing stream messages.
-				c.checkStateForInterestStream(&ss)
-			}
-		}
+		mset.migrateRetention(ocfg.Retention, cfg.Retention)
 		mset.mu.Lock()
 	}
 
@@ -2109,28 +2984,106 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 	}
 	mset.mu.Unlock()
 
-	if js != nil {
+	if js != nil && cfg.Storage != ocfg.Storage {
+		// Move the whole reservation over to the new storage type.
+		js.releaseStreamResources(rcfg)
+		js.reserveStreamResources(cfg)
+	} else if js != nil {
 		maxBytesDiff := cfg.MaxBytes - ocfg.MaxBytes
 		if maxBytesDiff > 0 {
 			// Reserve the difference
 			js.reserveStreamResources(&StreamConfig{
 				MaxBytes: maxBytesDiff,
-				Storage:  cfg.Storage,
+				Storage:  rcfg.Storage,
 			})
 		} else if maxBytesDiff < 0 {
 			// Release the difference
 			js.releaseStreamResources(&StreamConfig{
 				MaxBytes: -maxBytesDiff,
-				Storage:  ocfg.Storage,
+				Storage:  rcfg.Storage,
 			})
 		}
 	}
 
-	mset.store.UpdateConfig(cfg)
+	mset.store.UpdateConfig(mset.storeConfig(cfg))
+
+	// The store enforces lowered message, byte and age limits, but not the message size.
+	// This needs a scan of all stored messages, so is not done while updating.
+	if cfg.MaxMsgSize > 0 && (ocfg.MaxMsgSize <= 0 || cfg.MaxMsgSize < ocfg.MaxMsgSize) {
+		s, maxMsgSize := mset.srv, cfg.MaxMsgSize
+		s.startGoRoutine(
+			func() {
+				defer s.grWG.Done()
+				mset.enforceMaxMsgSize(maxMsgSize)
+			},
+			pprofLabels{
+				"type":    "max_msg_size",
+				"account": mset.acc.Name,
+				"stream":  cfg.Name,
+			},
+		)
+	}
 
 	return nil
 }
 
+// Removes the stored messages that exceed a lowered max message size, and sends an
+// advisory with how many were removed. Like other limits this is done by each replica
+// on its own. Will run as a Go routine.
+func (mset *stream) enforceMaxMsgSize(maxMsgSize int32) {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	var state StreamState
+	store.FastState(&state)
+	var removed uint64
+	var smv StoreMsg
+	for seq := state.FirstSeq; state.Msgs > 0 && seq <= state.LastSeq; seq++ {
+		if mset.closed.Load() {
+			return
+		}
+		sm, nseq, err := store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err != nil {
+			break
+		}
+		if len(sm.hdr)+len(sm.msg) > int(maxMsgSize) {
+			if ok, _ := mset.removeMsgOverLimit(sm.seq); ok {
+				removed++
+			}
+		}
+		seq = nseq
+	}
+	if removed == 0 {
+		return
+	}
+
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if !mset.isLeader() || mset.outq == nil {
+		return
+	}
+	m := JSStreamOversizedMsgsRemovedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamOversizedMsgsRemovedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      mset.cfg.Name,
+		MaxMsgSize:  maxMsgSize,
+		RemovedMsgs: removed,
+		Domain:      mset.srv.getOpts().JetStreamDomain,
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamOversizedMsgsRemovedPre + "." + mset.cfg.Name
+		mset.outq.sendMsg(subj, j)
+	}
+}
+
 // Small helper to return the Name field from mset.cfg, protected by
 // the mset.cfgMu mutex. This is simply because we have several places
 // in consumer.go where we need it.
@@ -2149,7 +3102,11 @@ func (mset *stream) purge(preq *JSApiStreamPurgeRequest) (purged uint64, err err
 	}
 	if mset.cfg.Sealed {
 		mset.mu.RUnlock()
-		return 0, errors.New("sealed stream")
+		return 0, errStreamSealed
+	}
+	if mset.cfg.DenyPurge {
+		mset.mu.RUnlock()
+		return 0, errStreamDenyPurge
 	}
 	store, mlseq := mset.store, mset.lseq
 	mset.mu.RUnlock()
@@ -2216,6 +3173,19 @@ func (mset *stream) removeMsg(seq uint64) (bool, error) {
 
 // DeleteMsg will remove a message from a stream.
 func (mset *stream) deleteMsg(seq uint64) (bool, error) {
+	if mset.closed.Load() {
+		return false, errStreamClosed
+	}
+	if err := mset.checkDeleteAllowed(); err != nil {
+		return false, err
+	}
+	return mset.store.RemoveMsg(seq)
+}
+
+// Removes a message that is over one of the limits of the stream. Like for the limits the
+// store enforces, this is allowed when the stream denies deletes. Our consumers are
+// updated by the store callback, same as for deletes.
+func (mset *stream) removeMsgOverLimit(seq uint64) (bool, error) {
 	if mset.closed.Load() {
 		return false, errStreamClosed
 	}
@@ -2227,9 +3197,25 @@ func (mset *stream) eraseMsg(seq uint64) (bool, error) {
 	if mset.closed.Load() {
 		return false, errStreamClosed
 	}
+	if err := mset.checkDeleteAllowed(); err != nil {
+		return false, err
+	}
 	return mset.store.EraseMsg(seq)
 }
 
+// Returns why messages can not be deleted from the stream, nil if they can.
+func (mset *stream) checkDeleteAllowed() error {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.cfg.Sealed {
+		return errStreamSealed
+	}
+	if mset.cfg.DenyDelete {
+		return errStreamDenyDelete
+	}
+	return nil
+}
+
 // Are we a mirror?
 func (mset *stream) isMirror() bool {
 	mset.mu.RLock()
@@ -2243,6 +3229,9 @@ func (mset *stream) sourcesInfo() (sis []*StreamSourceInfo) {
 	for _, si := range mset.sources {
 		sis = append(sis, mset.sourceInfo(si))
 	}
+	for _, bi := range mset.bridges {
+		sis = append(sis, mset.bridgeSourceInfo(bi))
+	}
 	return sis
 }
 
@@ -2252,7 +3241,11 @@ func (mset *stream) sourceInfo(si *sourceInfo) *StreamSourceInfo {
 		return nil
 	}
 
-	var ssi = StreamSourceInfo{Name: si.name, Lag: si.lag, Error: si.err, FilterSubject: si.sf}
+	var ssi = StreamSourceInfo{Name: si.name, Lag: si.lag, Error: si.err, FilterSubject: si.sf, Retries: si.fails, Lost: si.lost}
+	if si.gap != nil {
+		gap := *si.gap
+		ssi.Gap = &gap
+	}
 
 	trConfigs := make([]SubjectTransformConfig, len(si.sfs))
 	for i := range si.sfs {
@@ -2299,8 +3292,82 @@ const (
 	sourceHealthHB = 1 * time.Second
 	// How often we check and our stalled interval.
 	sourceHealthCheckInterval = 10 * time.Second
+	// Default time a mirror or source can go without any activity,
+	// including heartbeats, before it is reported as unhealthy.
+	sourceHealthMaxInactive = 2 * sourceHealthCheckInterval
 )
 
+// checkSourcesHealth will return an error describing the first mirror, source or
+// push mirror that is not connected, has a consumer setup error, is lagging more than maxLag
+// or has not seen any activity within maxInactive. A maxLag of zero skips the lag
+// check and a maxInactive of zero uses sourceHealthMaxInactive.
+// These only run on the leader, so followers are always healthy.
+func (mset *stream) checkSourcesHealth(maxLag uint64, maxInactive time.Duration) error {
+	if maxInactive <= 0 {
+		maxInactive = sourceHealthMaxInactive
+	}
+
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+
+	if !mset.isLeader() {
+		return nil
+	}
+
+	check := func(kind, name string, err *ApiError, last int64, lag uint64) error {
+		if err != nil {
+			return fmt.Errorf("%s '%s' has error: %v", kind, name, err)
+		}
+		if last == 0 {
+			return fmt.Errorf("%s '%s' is not connected", kind, name)
+		}
+		if active := time.Since(time.Unix(0, last)); active > maxInactive {
+			return fmt.Errorf("%s '%s' has been inactive for %v", kind, name, active.Round(time.Millisecond))
+		}
+		if maxLag > 0 && lag > maxLag {
+			return fmt.Errorf("%s '%s' lag of %d exceeds %d", kind, name, lag, maxLag)
+		}
+		return nil
+	}
+
+	if mset.cfg.Mirror != nil {
+		si := mset.mirror
+		if si == nil {
+			return errors.New("mirror is not setup")
+		}
+		if err := check("mirror", si.name, si.err, si.last.Load(), si.lag); err != nil {
+			return err
+		}
+	}
+	for _, ssi := range mset.cfg.Sources {
+		var err error
+		if ssi.Bridge != nil {
+			if bi := mset.bridges[ssi.iname]; bi == nil {
+				err = fmt.Errorf("bridge '%s' is not setup", ssi.Name)
+			} else {
+				err = check("bridge", bi.name, bi.err, bi.last.Load(), 0)
+			}
+		} else if si := mset.sources[ssi.iname]; si == nil {
+			err = fmt.Errorf("source '%s' is not setup", ssi.Name)
+		} else {
+			err = check("source", si.name, si.err, si.last.Load(), si.lag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, pm := range mset.cfg.PushMirrors {
+		pi := mset.pushMirrors[pm.Name]
+		if pi == nil {
+			return fmt.Errorf("push mirror '%s' is not setup", pm.Name)
+		}
+		if err := check("push mirror", pm.Name, pi.err, pi.last.Load(), mset.pushMirrorLag(pi)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Will run as a Go routine to process mirror consumer messages.
 func (mset *stream) processMirrorMsgs(mirror *sourceInfo, ready *sync.WaitGroup) {
 	s := mset.srv
@@ -2376,6 +3443,55 @@ func (si *sourceInfo) isCurrentSub(reply string) bool {
 	return si.cname != _EMPTY_ && strings.HasPrefix(reply, jsAckPre) && si.cname == tokenAt(reply, 4)
 }
 
+// Returns if we receive all messages of the origin, only then are skipped sequences messages we lost.
+func (si *sourceInfo) isUnfiltered() bool {
+	if si.sf != _EMPTY_ && si.sf != fwcs {
+		return false
+	}
+	for _, sf := range si.sfs {
+		if sf != _EMPTY_ && sf != fwcs {
+			return false
+		}
+	}
+	return true
+}
+
+// Records that the origin of a mirror or source removed the messages first through last
+// before we ingested them, and sends an advisory since this is data loss downstream.
+// Lock should be held.
+func (mset *stream) sourceGap(si *sourceInfo, first, last uint64) {
+	if first == 0 || first > last || !si.isUnfiltered() {
+		return
+	}
+	now := time.Now().UTC()
+	si.gap = &StreamSourceGap{First: first, Last: last, Time: now}
+	si.lost += last - first + 1
+	mset.srv.RateLimitWarnf("JetStream stream '%s > %s' lost messages %d through %d of '%s', removed before they were ingested",
+		mset.acc.Name, mset.cfg.Name, first, last, si.name)
+
+	if mset.outq == nil {
+		return
+	}
+	m := JSStreamSourceGapAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamSourceGapAdvisoryType,
+			ID:   nuid.Next(),
+			Time: now,
+		},
+		Stream:   mset.cfg.Name,
+		Source:   si.name,
+		Mirror:   si == mset.mirror,
+		FirstSeq: first,
+		LastSeq:  last,
+		Domain:   mset.srv.getOpts().JetStreamDomain,
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamSourceGapPre + "." + mset.cfg.Name
+		mset.outq.sendMsg(subj, j)
+	}
+}
+
 // processInboundMirrorMsg handles processing messages bound for a stream.
 func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 	mset.mu.Lock()
@@ -2442,6 +3558,7 @@ func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 	} else {
 		// If the deliver sequence matches then the upstream stream has expired or deleted messages.
 		if dseq == mset.mirror.dseq+1 {
+			mset.sourceGap(mset.mirror, mset.mirror.sseq+1, sseq-1)
 			mset.skipMsgs(mset.mirror.sseq+1, sseq-1)
 			mset.mirror.dseq++
 			mset.mirror.sseq = sseq
@@ -2482,7 +3599,7 @@ func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 		}
 	}
 
-	s, js, stype := mset.srv, mset.js, mset.cfg.Storage
+	s, js, stype := mset.srv, mset.js, mset.stype
 	node := mset.node
 	mset.mu.Unlock()
 
@@ -2498,9 +3615,7 @@ func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 		err = mset.processJetStreamMsg(m.subj, _EMPTY_, m.hdr, m.msg, sseq-1, ts, nil)
 	}
 	if err != nil {
-		if strings.Contains(err.Error(), "no space left") {
-			s.Errorf("JetStream out of space, will be DISABLED")
-			s.DisableJetStream()
+		if s.handleStorageError(mset, err) {
 			return false
 		}
 		if err != errLastSeqMismatch {
@@ -2597,14 +3712,32 @@ const (
 )
 
 // Calculate our backoff based on number of failures.
+// The backoff doubles with each consecutive failure up to retryMaximum.
 func calculateRetryBackoff(fails int) time.Duration {
-	backoff := time.Duration(retryBackOff) * time.Duration(fails*2)
+	if fails <= 0 {
+		return 0
+	}
+	backoff := 2 * retryBackOff
+	for i := 1; i < fails && backoff < retryMaximum; i++ {
+		backoff *= 2
+	}
 	if backoff > retryMaximum {
 		backoff = retryMaximum
 	}
 	return backoff
 }
 
+// Calculate the jitter to add to a retry so that many sources failing
+// at the same time do not retry in lockstep. This is a small fixed amount
+// plus up to 10% of the backoff.
+func calculateRetryJitter(backoff time.Duration) time.Duration {
+	jitter := time.Duration(rand.Intn(int(100*time.Millisecond))) + 100*time.Millisecond
+	if backoff > 0 {
+		jitter += time.Duration(rand.Int63n(int64(backoff/10) + 1))
+	}
+	return jitter
+}
+
 // This will schedule a call to setupMirrorConsumer, taking into account the last
 // time it was retried and determine the soonest setupMirrorConsumer can be called
 // without tripping the sourceConsumerRetryThreshold. We will also take into account
@@ -2621,15 +3754,29 @@ func (mset *stream) scheduleSetupMirrorConsumerRetry() {
 		next = 0
 	}
 	// Take into account failures here.
-	next += calculateRetryBackoff(mset.mirror.fails)
+	backoff := calculateRetryBackoff(mset.mirror.fails)
+	next += backoff
 
 	// Add some jitter.
-	next += time.Duration(rand.Intn(int(100*time.Millisecond))) + 100*time.Millisecond
+	next += calculateRetryJitter(backoff)
 
-	time.AfterFunc(next, func() {
+	// The mirror shares the schedules with the sources. It has no index name
+	// so it will use the empty one. This allows cancelSourceInfo() to cancel
+	// a pending retry for the mirror as well.
+	if mset.sourceSetupSchedules == nil {
+		mset.sourceSetupSchedules = map[string]*time.Timer{}
+	}
+	iname := mset.mirror.iname
+	if _, ok := mset.sourceSetupSchedules[iname]; ok {
+		// There is already a retry scheduled.
+		return
+	}
+	mset.sourceSetupSchedules[iname] = time.AfterFunc(next, func() {
 		mset.mu.Lock()
+		defer mset.mu.Unlock()
+
+		delete(mset.sourceSetupSchedules, iname)
 		mset.setupMirrorConsumer()
-		mset.mu.Unlock()
 	})
 }
 
@@ -2867,6 +4014,10 @@ func (mset *stream) setupMirrorConsumer() error {
 				if state.LastSeq != ccr.ConsumerInfo.Delivered.Stream {
 					// Check to see if delivered is past our last and we have no msgs. This will help the
 					// case when mirroring a stream that has a very high starting sequence number.
+					// If we had ingested messages before, the origin removed the ones in between.
+					if state.LastSeq > 0 && ccr.ConsumerInfo.Delivered.Stream > state.LastSeq {
+						mset.sourceGap(mirror, state.LastSeq+1, ccr.ConsumerInfo.Delivered.Stream)
+					}
 					if state.Msgs == 0 && ccr.ConsumerInfo.Delivered.Stream > state.LastSeq {
 						mset.store.PurgeEx(_EMPTY_, ccr.ConsumerInfo.Delivered.Stream+1, 0)
 						mset.lseq = ccr.ConsumerInfo.Delivered.Stream
@@ -2987,7 +4138,7 @@ func (mset *stream) setupSourceConsumer(iname string, seq uint64, startTime time
 	}
 
 	// First calculate the delay until the next time we can
-	var scheduleDelay time.Duration
+	var scheduleDelay, backoff time.Duration
 
 	if !si.lreq.IsZero() { // it's not the very first time we are called, compute the delay
 		// We want to throttle here in terms of how fast we request new consumers
@@ -2996,12 +4147,13 @@ func (mset *stream) setupSourceConsumer(iname string, seq uint64, startTime time
 		}
 		// Is it a retry? If so, add a backoff
 		if si.fails > 0 {
-			scheduleDelay += calculateRetryBackoff(si.fails)
+			backoff = calculateRetryBackoff(si.fails)
+			scheduleDelay += backoff
 		}
 	}
 
 	// Always add some jitter
-	scheduleDelay += time.Duration(rand.Intn(int(100*time.Millisecond))) + 100*time.Millisecond
+	scheduleDelay += calculateRetryJitter(backoff)
 
 	// Schedule the call to trySetupSourceConsumer
 	mset.sourceSetupSchedules[iname] = time.AfterFunc(scheduleDelay, func() {
@@ -3203,6 +4355,10 @@ func (mset *stream) trySetupSourceConsumer(iname string, seq uint64, startTime t
 						)
 					}
 
+					// If we asked to resume at a sequence the origin removed already, we lost the ones in between.
+					if req.Config.DeliverPolicy == DeliverByStartSequence && seq > 1 && ccr.ConsumerInfo.Delivered.Stream >= seq {
+						mset.sourceGap(si, seq, ccr.ConsumerInfo.Delivered.Stream)
+					}
 					// Setup actual subscription to process messages from our source.
 					if si.sseq != ccr.ConsumerInfo.Delivered.Stream {
 						si.sseq = ccr.ConsumerInfo.Delivered.Stream + 1
@@ -3400,6 +4556,10 @@ func (mset *stream) processInboundSourceMsg(si *sourceInfo, m *inMsg) bool {
 
 	// Tracking is done here.
 	if dseq == si.dseq+1 {
+		// If the deliver sequence matches but sequences were skipped, the origin removed messages.
+		if si.dseq > 0 && sseq > si.sseq+1 {
+			mset.sourceGap(si, si.sseq+1, sseq-1)
+		}
 		si.dseq++
 		si.sseq = sseq
 	} else if dseq > si.dseq {
@@ -3460,10 +4620,7 @@ func (mset *stream) processInboundSourceMsg(si *sourceInfo, m *inMsg) bool {
 
 	if err != nil {
 		s := mset.srv
-		if strings.Contains(err.Error(), "no space left") {
-			s.Errorf("JetStream out of space, will be DISABLED")
-			s.DisableJetStream()
-		} else {
+		if !s.handleStorageError(mset, err) {
 			mset.mu.RLock()
 			accName, sname, iName := mset.acc.Name, mset.cfg.Name, si.iname
 			mset.mu.RUnlock()
@@ -3632,6 +4789,10 @@ func (mset *stream) resetSourceInfo() {
 		if ssi.iname == _EMPTY_ {
 			ssi.setIndexName()
 		}
+		// Bridges do not use a source consumer.
+		if ssi.Bridge != nil {
+			continue
+		}
 
 		var si *sourceInfo
 
@@ -3676,7 +4837,7 @@ func (mset *stream) startingSequenceForSources() {
 	}
 
 	// For short circuiting return.
-	expected := len(mset.cfg.Sources)
+	expected := len(mset.sources)
 	seqs := make(map[string]uint64)
 
 	// Stamp our si seq records on the way out.
@@ -3693,26 +4854,24 @@ func (mset *stream) startingSequenceForSources() {
 		}
 	}()
 
-	var smv StoreMsg
-	for seq := state.LastSeq; seq >= state.FirstSeq; seq-- {
-		sm, err := mset.store.LoadMsg(seq, &smv)
-		if err != nil || sm == nil || len(sm.hdr) == 0 {
-			continue
+	var update = func(iName string, seq uint64) {
+		// Only update active in case we have older ones in here that got configured out.
+		if si := mset.sources[iName]; si != nil {
+			if _, ok := seqs[iName]; !ok {
+				seqs[iName] = seq
+			}
+		}
+	}
+
+	// Returns true once all sources have their sequence.
+	check := func(sm *StoreMsg) bool {
+		if len(sm.hdr) == 0 {
+			return false
 		}
 		ss := getHeader(JSStreamSource, sm.hdr)
 		if len(ss) == 0 {
-			continue
-		}
-
-		var update = func(iName string, seq uint64) {
-			// Only update active in case we have older ones in here that got configured out.
-			if si := mset.sources[iName]; si != nil {
-				if _, ok := seqs[iName]; !ok {
-					seqs[iName] = seq
-				}
-			}
+			return false
 		}
-
 		streamName, iName, sseq := streamAndSeq(string(ss))
 		if iName == _EMPTY_ { // Pre-2.10 message header means it's a match for any source using that stream name
 			for _, ssi := range mset.cfg.Sources {
@@ -3723,47 +4882,138 @@ func (mset *stream) startingSequenceForSources() {
 		} else {
 			update(iName, sseq)
 		}
-		if len(seqs) == expected {
+		return len(seqs) == expected
+	}
+
+	// If the sources only store on some subjects we only need to look at those messages.
+	if filters := mset.sourcesSubjectFilters(); len(filters) > 0 {
+		if walkBackBySubjects(mset.store, filters, state.LastSeq, check) {
 			return
 		}
 	}
-}
 
-// Setup our source consumers.
-// Lock should be held.
-func (mset *stream) setupSourceConsumers() error {
-	if mset.outq == nil {
-		return errors.New("outq required")
-	}
-	// Reset if needed.
-	for _, si := range mset.sources {
-		if si.sub != nil {
-			mset.cancelSourceConsumer(si.iname)
+	var smv StoreMsg
+	for seq := state.LastSeq; seq >= state.FirstSeq; seq-- {
+		sm, err := mset.store.LoadMsg(seq, &smv)
+		if err != nil || sm == nil {
+			continue
+		}
+		if check(sm) {
+			return
 		}
 	}
+}
 
-	// If we are no longer the leader, give up
-	if !mset.isLeader() {
+// The most subjects we walk back over using the subject index of the store,
+// past this the messages are walked one by one.
+const maxSourcesIndexedSubjects = 10_000
+
+// Returns the subject filters the messages of the sources of the stream are stored on,
+// or nil if a source can store on any subject or the subjects can not be determined.
+// Lock should be held.
+func (mset *stream) sourcesSubjectFilters() []string {
+	if mset.cfg.SubjectTransform != nil {
 		return nil
 	}
-
-	mset.startingSequenceForSources()
-
-	// Setup our consumers at the proper starting position.
+	var filters []string
 	for _, ssi := range mset.cfg.Sources {
-		if si := mset.sources[ssi.iname]; si != nil {
-			mset.setupSourceConsumer(ssi.iname, si.sseq+1, time.Time{})
+		if len(ssi.SubjectTransforms) == 0 {
+			if ssi.FilterSubject == _EMPTY_ || ssi.FilterSubject == fwcs {
+				return nil
+			}
+			filters = append(filters, ssi.FilterSubject)
+			continue
+		}
+		for _, tr := range ssi.SubjectTransforms {
+			dest := tr.Destination
+			if dest == _EMPTY_ {
+				dest = tr.Source
+			}
+			// Mapping functions other than wildcards can produce any token.
+			subj, _ := transformUntokenize(dest)
+			if subj == _EMPTY_ || subj == fwcs || strings.Contains(subj, "{{") {
+				return nil
+			}
+			filters = append(filters, subj)
 		}
 	}
-
-	return nil
+	return filters
 }
 
-// Will create internal subscriptions for the stream.
-// Lock should be held.
-func (mset *stream) subscribeToStream() error {
-	if mset.active {
-		return nil
+// Walks back from last over the messages stored on subjects matching filters, newest first,
+// using the subject index of the store to skip over all other messages. Stops once cb returns true.
+// Returns false if the walk could not be completed, in which case the messages need to be walked one by one.
+func walkBackBySubjects(store StreamStore, filters []string, last uint64, cb func(sm *StoreMsg) bool) bool {
+	seqs, err := store.MultiLastSeqs(filters, last, maxSourcesIndexedSubjects)
+	if err != nil {
+		return false
+	}
+	// Kept in ascending order, the next message to look at is always the last.
+	slices.Sort(seqs)
+
+	var smv StoreMsg
+	for len(seqs) > 0 {
+		seq := seqs[len(seqs)-1]
+		seqs = seqs[:len(seqs)-1]
+		sm, err := store.LoadMsg(seq, &smv)
+		if err != nil || sm == nil {
+			return false
+		}
+		if cb(sm) {
+			return true
+		}
+		if seq <= 1 {
+			continue
+		}
+		// Replace with the previous message on the same subject.
+		prev, err := store.MultiLastSeqs([]string{sm.subj}, seq-1, 0)
+		if err != nil {
+			return false
+		}
+		if len(prev) > 0 && prev[0] < seq {
+			if i, found := slices.BinarySearch(seqs, prev[0]); !found {
+				seqs = slices.Insert(seqs, i, prev[0])
+			}
+		}
+	}
+	return true
+}
+
+// Setup our source consumers.
+// Lock should be held.
+func (mset *stream) setupSourceConsumers() error {
+	if mset.outq == nil {
+		return errors.New("outq required")
+	}
+	// Reset if needed.
+	for _, si := range mset.sources {
+		if si.sub != nil {
+			mset.cancelSourceConsumer(si.iname)
+		}
+	}
+
+	// If we are no longer the leader, give up
+	if !mset.isLeader() {
+		return nil
+	}
+
+	mset.startingSequenceForSources()
+
+	// Setup our consumers at the proper starting position.
+	for _, ssi := range mset.cfg.Sources {
+		if si := mset.sources[ssi.iname]; si != nil {
+			mset.setupSourceConsumer(ssi.iname, si.sseq+1, time.Time{})
+		}
+	}
+
+	return nil
+}
+
+// Will create internal subscriptions for the stream.
+// Lock should be held.
+func (mset *stream) subscribeToStream() error {
+	if mset.active {
+		return nil
 	}
 	for _, subject := range mset.cfg.Subjects {
 		if _, err := mset.subscribeInternal(subject, mset.processInboundJetStreamMsg); err != nil {
@@ -3801,6 +5051,18 @@ func (mset *stream) subscribeToStream() error {
 			mset.mu.Unlock()
 		})
 	}
+	// Start any bridges for our sources.
+	mset.startBridges()
+	// Start pushing to other systems.
+	mset.startPushMirrors()
+	// Start our backup schedule.
+	mset.startBackup(mset.cfg.Backup)
+	// Make sure there is somewhere to put the messages we reject.
+	if mset.cfg.Quarantine {
+		mset.ensureQuarantineStream()
+	}
+	mset.ensureDeadLetterStream(mset.cfg.DeadLetter)
+
 	// Check for direct get access.
 	// We spin up followers for clustered streams in monitorStream().
 	if mset.cfg.AllowDirect {
@@ -3834,6 +5096,15 @@ func (mset *stream) subscribeToDirect() error {
 			return err
 		}
 	}
+	// Direct gets routed to us by other replicas for our placement tag.
+	if mset.routeSub == nil && mset.node != nil {
+		dsubj := fmt.Sprintf(jsDirectGetRouteT, mset.cfg.Name, mset.node.ID())
+		if sub, err := mset.subscribeInternal(dsubj, mset.processRoutedDirectGetRequest); err == nil {
+			mset.routeSub = sub
+		} else {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -3848,6 +5119,10 @@ func (mset *stream) unsubscribeToDirect() {
 		mset.unsubscribe(mset.lastBySub)
 		mset.lastBySub = nil
 	}
+	if mset.routeSub != nil {
+		mset.unsubscribe(mset.routeSub)
+		mset.routeSub = nil
+	}
 }
 
 // Lock should be held.
@@ -3910,6 +5185,9 @@ func (mset *stream) unsubscribeToStream(stopping bool) error {
 	if len(mset.sources) > 0 {
 		mset.stopSourceConsumers()
 	}
+	mset.stopBridges()
+	mset.stopPushMirrors()
+	mset.stopBackup()
 
 	// In case we had a direct get subscriptions.
 	if stopping {
@@ -3985,38 +5263,192 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig) error {
 	mset.mu.Lock()
 	mset.created = time.Now().UTC()
 
-	switch mset.cfg.Storage {
-	case MemoryStorage:
-		ms, err := newMemStore(&mset.cfg)
+	ss, err := mset.newStore(&mset.cfg, *fsCfg)
+	if err != nil {
+		mset.mu.Unlock()
+		return err
+	}
+	mset.store = ss
+	// This will fire the callback but we do not require the lock since md will be 0 here.
+	mset.store.RegisterStorageUpdates(mset.storeUpdates)
+	mset.mu.Unlock()
+
+	return nil
+}
+
+// A storeConversion moves a stream over to a store of another storage type, along with the
+// state of its consumers. The bulk of the messages can be copied without holding the stream
+// lock, finish then catches up on anything that changed in the meantime and swaps in the new
+// store, removing the old one.
+type storeConversion struct {
+	mset   *stream
+	cfg    *StreamConfig
+	ostore StreamStore
+	nstore StreamStore
+	next   uint64 // Next sequence to copy.
+}
+
+// Creates the new store for a conversion to the storage type of the given configuration.
+// Lock should be held.
+func (mset *stream) newStoreConversion(cfg *StreamConfig, storeDir, indexDir string) (*storeConversion, error) {
+	s := mset.srv
+	fsCfg := FileStoreConfig{
+		StoreDir:     storeDir,
+		IndexDir:     indexDir,
+		SyncInterval: mset.acc.syncInterval(s.getOpts()),
+		SyncAlways:   s.getOpts().SyncAlways,
+		Compression:  cfg.Compression,
+		Preallocate:  s.getOpts().JetStreamPreallocate,
+		DirectIO:     s.getOpts().JetStreamDirectIO,
+		MaxBlocks:    s.getOpts().JetStreamMaxBlocks,
+	}
+	if mset.jsa != nil {
+		fsCfg.readAhead = mset.jsa.readAhead
+	}
+	if cfg.Storage == FileStorage {
+		mset.autoTuneFileStorageBlockSize(&fsCfg)
+	}
+	nstore, err := mset.newStore(cfg, fsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &storeConversion{mset: mset, cfg: cfg, ostore: mset.store, nstore: nstore, next: 1}, nil
+}
+
+// Copies the messages stored since the last copy, keeping sequences and interior deletes intact.
+// Lock does not need to be held, the stores have their own.
+func (sc *storeConversion) copy() error {
+	var state StreamState
+	sc.ostore.FastState(&state)
+	if state.FirstSeq > sc.next {
+		sc.next = state.FirstSeq
+	}
+	var smv StoreMsg
+	for seq := sc.next; seq <= state.LastSeq; seq = sc.next {
+		sm, _, err := sc.ostore.LoadNextMsg(fwcs, true, seq, &smv)
+		if err == ErrStoreEOF || err == nil && sm.seq > state.LastSeq {
+			break
+		} else if err != nil {
+			return err
+		}
+		if sm.seq > sc.next {
+			err = sc.nstore.SkipMsgs(sc.next, sm.seq-sc.next)
+		}
+		if err == nil {
+			err = sc.nstore.StoreRawMsg(sm.subj, sm.hdr, sm.msg, sm.seq, sm.ts)
+		}
 		if err != nil {
-			mset.mu.Unlock()
 			return err
 		}
-		mset.store = ms
-	case FileStorage:
-		s := mset.srv
-		prf := s.jsKeyGen(s.getOpts().JetStreamKey, mset.acc.Name)
-		if prf != nil {
-			// We are encrypted here, fill in correct cipher selection.
-			fsCfg.Cipher = s.getOpts().JetStreamCipher
-		}
-		oldprf := s.jsKeyGen(s.getOpts().JetStreamOldKey, mset.acc.Name)
-		cfg := *fsCfg
-		cfg.srv = s
-		fs, err := newFileStoreWithCreated(cfg, mset.cfg, mset.created, prf, oldprf)
+		sc.next = sm.seq + 1
+	}
+	if state.LastSeq >= sc.next {
+		if err := sc.nstore.SkipMsgs(sc.next, state.LastSeq-sc.next+1); err != nil {
+			return err
+		}
+		sc.next = state.LastSeq + 1
+	}
+	return nil
+}
+
+// Catches up on messages removed and stored since the last copy and swaps in the new store.
+// Lock should be held.
+func (sc *storeConversion) finish() error {
+	mset, ostore, nstore := sc.mset, sc.ostore, sc.nstore
+	if mset.store != ostore {
+		return errors.New("stream store changed during conversion")
+	}
+
+	// Drop what was removed from the old store since it was copied.
+	ostate := ostore.State()
+	if ostate.LastSeq < sc.next-1 {
+		if err := nstore.Truncate(ostate.LastSeq); err != nil {
+			return err
+		}
+		sc.next = ostate.LastSeq + 1
+	}
+	var nstate StreamState
+	nstore.FastState(&nstate)
+	if ostate.FirstSeq > nstate.FirstSeq {
+		if _, err := nstore.Compact(ostate.FirstSeq); err != nil {
+			return err
+		}
+	}
+	for _, seq := range ostate.Deleted {
+		if seq >= sc.next {
+			break
+		}
+		if _, err := nstore.RemoveMsg(seq); err != nil && err != ErrStoreMsgNotFound {
+			return err
+		}
+	}
+	// Then copy over what was stored since.
+	if err := sc.copy(); err != nil {
+		return err
+	}
+
+	// Move our consumers' state over and swap stores while holding all of their locks.
+	consumers := make([]*consumer, 0, len(mset.consumers))
+	for _, o := range mset.consumers {
+		consumers = append(consumers, o)
+	}
+	for _, o := range consumers {
+		o.mu.Lock()
+	}
+	unlockConsumers := func() {
+		for _, o := range consumers {
+			o.mu.Unlock()
+		}
+	}
+	cstores := make([]ConsumerStore, len(consumers))
+	for i, o := range consumers {
+		if o.store == nil {
+			continue
+		}
+		state, err := o.store.State()
+		if err == nil {
+			cstores[i], err = nstore.ConsumerStore(o.name, &o.cfg)
+		}
+		if err == nil {
+			err = cstores[i].Update(state)
+		}
 		if err != nil {
-			mset.mu.Unlock()
+			unlockConsumers()
 			return err
 		}
-		mset.store = fs
 	}
-	// This will fire the callback but we do not require the lock since md will be 0 here.
-	mset.store.RegisterStorageUpdates(mset.storeUpdates)
-	mset.mu.Unlock()
+	for i, o := range consumers {
+		if cstores[i] != nil {
+			o.store = cstores[i]
+		}
+	}
+	mset.store = nstore
+	unlockConsumers()
+
+	// Move our usage over to the new storage type and remove the old store.
+	ostore.RegisterStorageUpdates(nil)
+	if mset.jsa != nil {
+		_, reported, _ := ostore.Utilization()
+		mset.jsa.updateUsage(mset.tier, mset.stype, -int64(reported))
+	}
+	ostore.Delete()
+
+	mset.stype = sc.cfg.Storage.accounting()
+	// The file store reports what it holds when registering, other stores do not.
+	if _, ok := nstore.(*fileStore); !ok && mset.jsa != nil {
+		_, reported, _ := nstore.Utilization()
+		mset.jsa.updateUsage(mset.tier, mset.stype, int64(reported))
+	}
+	nstore.RegisterStorageUpdates(mset.storeUpdates)
 
 	return nil
 }
 
+// Removes the new store of a conversion that did not finish.
+func (sc *storeConversion) abort() {
+	sc.nstore.Delete()
+}
+
 // Called for any updates to the underlying stream. We pass through the bytes to the
 // jetstream account. We do local processing for stream pending for consumers, but only
 // for removals.
@@ -4025,6 +5457,7 @@ func (mset *stream) storeUpdates(md, bd int64, seq uint64, subj string) {
 	// If we have a single negative update then we will process our consumers for stream pending.
 	// Purge and Store handled separately inside individual calls.
 	if md == -1 && seq > 0 && subj != _EMPTY_ {
+		mset.releaseClaim(seq)
 		// We use our consumer list mutex here instead of the main stream lock since it may be held already.
 		mset.clsMu.RLock()
 		// TODO(dlc) - Do sublist like signaling so we do not have to match?
@@ -4134,6 +5567,42 @@ func (mset *stream) storeMsgIdLocked(dde *ddentry) {
 	}
 }
 
+// processClientInfoHdr will apply our client info policy to the header.
+// Lock should be held.
+func (mset *stream) processClientInfoHdr(hdr []byte) []byte {
+	switch mset.cfg.ClientInfo {
+	case ClientInfoKeep:
+		return hdr
+	case ClientInfoMap:
+		cib := getHeader(ClientInfoHdr, hdr)
+		if len(cib) == 0 {
+			return hdr
+		}
+		var ci ClientInfo
+		err := json.Unmarshal(cib, &ci)
+		hdr = removeHeaderIfPresent(hdr, ClientInfoHdr)
+		if err != nil {
+			return hdr
+		}
+		for _, h := range []struct{ key, value string }{
+			{JSOriginAccount, ci.Account},
+			{JSOriginUser, ci.User},
+			{JSOriginName, ci.Name},
+			{JSOriginConnection, strconv.FormatUint(ci.ID, 10)},
+			{JSOriginHost, ci.Host},
+			{JSOriginServer, ci.Server},
+			{JSOriginCluster, ci.Cluster},
+		} {
+			if h.value != _EMPTY_ && h.value != "0" {
+				hdr = genHeader(hdr, h.key, h.value)
+			}
+		}
+		return hdr
+	default:
+		return removeHeaderIfPresent(hdr, ClientInfoHdr)
+	}
+}
+
 // Fast lookup of msgId.
 func getMsgId(hdr []byte) string {
 	return string(getHeader(JSMsgId, hdr))
@@ -4158,6 +5627,21 @@ func getExpectedLastSeq(hdr []byte) (uint64, bool) {
 	return uint64(parseInt64(bseq)), true
 }
 
+// Lookup of the event time in the named header, either RFC 3339 or Unix nanoseconds.
+func getEventTime(name string, hdr []byte) (int64, bool) {
+	v := getHeader(name, hdr)
+	if len(v) == 0 {
+		return 0, false
+	}
+	if t, err := time.Parse(time.RFC3339Nano, string(v)); err == nil {
+		return t.UnixNano(), true
+	}
+	if et := parseInt64(v); et > 0 {
+		return et, true
+	}
+	return 0, false
+}
+
 // Fast lookup of rollups.
 func getRollup(hdr []byte) string {
 	r := getHeader(JSMsgRollup, hdr)
@@ -4181,6 +5665,51 @@ func getExpectedLastSeqPerSubjectForSubject(hdr []byte) string {
 	return string(getHeader(JSExpectedLastSubjSeqSubj, hdr))
 }
 
+// Seeds the event time watermark from the last message. Messages stored
+// before are not scanned, so after a restart the watermark starts there.
+// Lock should be held.
+func (mset *stream) resetEventTime() {
+	mset.etime = 0
+	if mset.cfg.EventTimeHeader == _EMPTY_ || mset.store == nil {
+		return
+	}
+	var smv StoreMsg
+	if sm, _ := mset.store.LoadLastMsg(fwcs, &smv); sm != nil {
+		mset.etime, _ = getEventTime(mset.cfg.EventTimeHeader, sm.hdr)
+	}
+}
+
+// Returns the event time watermark, nil if there is none.
+func (mset *stream) eventTime() *time.Time {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.etime == 0 {
+		return nil
+	}
+	et := time.Unix(0, mset.etime).UTC()
+	return &et
+}
+
+// Returns the first sequence of a message with an event time at or after the
+// given time, or the next sequence if there is none.
+func (mset *stream) seqFromEventTime(name string, t time.Time) uint64 {
+	var state StreamState
+	mset.store.FastState(&state)
+	var smv StoreMsg
+	ets := t.UnixNano()
+	for seq := state.FirstSeq; seq <= state.LastSeq; seq++ {
+		sm, nseq, err := mset.store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err != nil || sm == nil {
+			break
+		}
+		if et, ok := getEventTime(name, sm.hdr); ok && et >= ets {
+			return nseq
+		}
+		seq = nseq
+	}
+	return state.LastSeq + 1
+}
+
 // Signal if we are clustered. Will acquire rlock.
 func (mset *stream) IsClustered() bool {
 	mset.mu.RLock()
@@ -4241,6 +5770,12 @@ type directGetReq struct {
 
 // processDirectGetRequest handles direct get request for stream messages.
 func (mset *stream) processDirectGetRequest(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	mset.handleDirectGetRequest(c, reply, rmsg, true)
+}
+
+// Handles a direct get request, which will be routed to another replica if allowed
+// and configured for the placement token of its subject.
+func (mset *stream) handleDirectGetRequest(c *client, reply string, rmsg []byte, route bool) {
 	if len(reply) == 0 {
 		return
 	}
@@ -4278,6 +5813,10 @@ func (mset *stream) processDirectGetRequest(_ *subscription, c *client, _ *Accou
 		return
 	}
 
+	if route && mset.routeDirectGet(directGetSubject(&req), reply, &req) {
+		return
+	}
+
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
 		dg := dgPool.Get().(*directGetReq)
@@ -4320,6 +5859,9 @@ func (mset *stream) processDirectGetLastBySubjectRequest(_ *subscription, c *cli
 	}
 
 	req := JSApiMsgGetRequest{LastFor: key}
+	if mset.routeDirectGet(key, reply, &req) {
+		return
+	}
 
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
@@ -4572,8 +6114,13 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 
 // processInboundJetStreamMsg handles processing messages bound for a stream.
 func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	// Shards only take the messages of their own partition.
+	if mset.shard != nil && !mset.shard.owns(subject) {
+		return
+	}
 	hdr, msg := c.msgParts(copyBytes(rmsg)) // Need to copy.
-	if mt, traceOnly := c.isMsgTraceEnabled(); mt != nil {
+	mt, traceOnly := c.isMsgTraceEnabled()
+	if mt != nil {
 		// If message is delivered, we need to disable the message trace headers
 		// to prevent a trace event to be generated when a stored message
 		// is delivered to a consumer and routed.
@@ -4586,13 +6133,86 @@ func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Ac
 		// object.
 		mt.addJetStreamEvent(mset.name())
 	}
+	if !traceOnly {
+		if reason, err := mset.admitInbound(hdr, msg); err != nil {
+			mset.rejectInbound(reason, err, subject, reply, hdr, msg, mt)
+			return
+		}
+	}
 	mset.queueInbound(mset.msgs, subject, reply, hdr, msg, nil, c.pa.trace)
 }
 
+// admitInbound checks if the stream takes a published message at all, before it is queued.
+// Returns the reason and error to reject it with.
+func (mset *stream) admitInbound(hdr, msg []byte) (int, *ApiError) {
+	// A paused stream does not accept any messages.
+	if mset.isPaused() {
+		return rejectOther, NewJSStreamPausedError()
+	}
+	// Protect the stream from publish storms before queueing.
+	if l := mset.ingest.Load(); l != nil && !l.allow(len(hdr)+len(msg)) {
+		return rejectIngestRate, NewJSStreamIngestRateExceededError()
+	}
+	return 0, nil
+}
+
+// Rejects an inbound message before it is stored, responding with the error if asked to.
+func (mset *stream) rejectInbound(reason int, err *ApiError, subject, reply string, hdr, msg []byte, mt *msgTrace) {
+	mset.rejected(reason)
+	mt.sendEventFromJetStream(err)
+
+	mset.cfgMu.RLock()
+	name, noAck := mset.cfg.Name, mset.cfg.NoAck
+	mset.cfgMu.RUnlock()
+	if reply != _EMPTY_ && !noAck {
+		b, _ := json.Marshal(&JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: err})
+		mset.outq.sendMsg(reply, b)
+	}
+	mset.quarantineMsg(subject, hdr, msg, err)
+}
+
+// checkInboundMsg prepares a message to be stored and checks it against the configuration
+// of the stream, for what does not depend on the messages stored already. It returns the
+// message as it would be stored, or the reason and error to reject it with. The tokens and
+// rate of the subject were checked before the message was proposed when clustered.
+// Lock should be held.
+func (mset *stream) checkInboundMsg(subject string, hdr, msg []byte, isClustered, traceOnly bool) ([]byte, []byte, int, *ApiError) {
+	// Drop the payload if we only store headers.
+	if mset.cfg.HeadersOnly {
+		hdr, msg = stripPayload(hdr, msg)
+	}
+	if tokens := mset.cfg.SubjectTokens; tokens > 0 && (!isClustered || traceOnly) && numTokens(subject) != tokens {
+		return hdr, msg, rejectSubjectTokens, NewJSStreamSubjectTokensError(subject, tokens)
+	}
+	if hot := mset.hot; hot != nil && !isClustered && !traceOnly && hot.track(subject) {
+		return hdr, msg, rejectSubjectRate, NewJSStreamSubjectRateExceededError()
+	}
+	// Check for a per message TTL. Sourced messages keep theirs, which only applies if allowed.
+	if len(getHeader(JSMessageTTL, hdr)) > 0 {
+		if !mset.cfg.AllowMsgTTL {
+			if len(getHeader(JSStreamSource, hdr)) == 0 {
+				return hdr, msg, rejectOther, NewJSMessageTTLDisabledError()
+			}
+		} else if _, err := getMessageTTL(hdr); err != nil {
+			return hdr, msg, rejectOther, NewJSMessageTTLInvalidError()
+		}
+	}
+	if maxMsgSize := int(mset.cfg.MaxMsgSize); maxMsgSize >= 0 && (len(hdr)+len(msg)) > maxMsgSize {
+		return hdr, msg, rejectMaxSize, NewJSStreamMessageExceedsMaximumError()
+	}
+	if len(hdr) > math.MaxUint16 {
+		return hdr, msg, rejectMaxSize, NewJSStreamHeaderExceedsMaximumError()
+	}
+	return hdr, msg, 0, nil
+}
+
 var (
 	errLastSeqMismatch   = errors.New("last sequence mismatch")
 	errMsgIdDuplicate    = errors.New("msgid is duplicate")
 	errStreamClosed      = errors.New("stream closed")
+	errStreamSealed      = errors.New("sealed stream")
+	errStreamDenyDelete  = errors.New("message delete not permitted")
+	errStreamDenyPurge   = errors.New("stream purge not permitted")
 	errInvalidMsgHandler = errors.New("undefined message handler")
 	errStreamMismatch    = errors.New("expected stream does not match")
 )
@@ -4639,28 +6259,53 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		accName = mset.acc.Name
 	}
 
-	js, jsa, doAck := mset.js, mset.jsa, !mset.cfg.NoAck
-	name, stype := mset.cfg.Name, mset.cfg.Storage
-	maxMsgSize := int(mset.cfg.MaxMsgSize)
+	js, jsa, doAck, gc := mset.js, mset.jsa, !mset.cfg.NoAck, mset.gcommit
+	name, stype := mset.cfg.Name, mset.stype
 	numConsumers := len(mset.consumers)
 	interestRetention := mset.cfg.Retention == InterestPolicy
+	quotaWarning := mset.cfg.QuotaWarning > 0
 	// Snapshot if we are the leader and if we can respond.
 	isLeader, isSealed := mset.isLeader(), mset.cfg.Sealed
 	canRespond := doAck && len(reply) > 0 && isLeader
 
 	var resp = &JSPubAckResponse{}
 
+	// Only the leader counts rejections, followers apply the same messages.
+	reject := func(reason int) {
+		if isLeader && !traceOnly {
+			mset.rejected(reason)
+		}
+	}
+
+	// Bail here if our storage failed and we are read-only.
+	if roErr := mset.roErr; roErr != nil {
+		outq := mset.outq
+		mset.mu.Unlock()
+		bumpCLFS()
+		reject(rejectOther)
+		if canRespond && outq != nil {
+			resp.PubAck = &PubAck{Stream: name}
+			resp.Error = NewJSStreamStorageReadOnlyError(roErr)
+			b, _ := json.Marshal(resp)
+			outq.sendMsg(reply, b)
+		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSStreamStorageReadOnlyError(roErr))
+		return NewJSStreamStorageReadOnlyError(roErr)
+	}
+
 	// Bail here if sealed.
 	if isSealed {
 		outq := mset.outq
 		mset.mu.Unlock()
 		bumpCLFS()
+		reject(rejectOther)
 		if canRespond && outq != nil {
 			resp.PubAck = &PubAck{Stream: name}
 			resp.Error = ApiErrors[JSStreamSealedErr]
 			b, _ := json.Marshal(resp)
 			outq.sendMsg(reply, b)
 		}
+		mset.quarantineMsg(subject, hdr, msg, ApiErrors[JSStreamSealedErr])
 		return ApiErrors[JSStreamSealedErr]
 	}
 
@@ -4691,6 +6336,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		if isMisMatch {
 			outq := mset.outq
 			mset.mu.Unlock()
+			reject(rejectOther)
 			if canRespond && outq != nil {
 				resp.PubAck = &PubAck{Stream: name}
 				resp.Error = ApiErrors[JSStreamSequenceNotMatchErr]
@@ -4702,9 +6348,8 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	}
 
 	// If we have received this message across an account we may have request information attached.
-	// For now remove. TODO(dlc) - Should this be opt-in or opt-out?
 	if len(hdr) > 0 {
-		hdr = removeHeaderIfPresent(hdr, ClientInfoHdr)
+		hdr = mset.processClientInfoHdr(hdr)
 	}
 
 	// Process additional msg headers if still present.
@@ -4712,6 +6357,27 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	var rollupSub, rollupAll bool
 	isClustered := mset.isClustered()
 
+	// Check the message itself against our configuration.
+	var reason int
+	var apiErr *ApiError
+	if hdr, msg, reason, apiErr = mset.checkInboundMsg(subject, hdr, msg, isClustered, traceOnly); apiErr != nil {
+		outq := mset.outq
+		mset.mu.Unlock()
+		bumpCLFS()
+		reject(reason)
+		if canRespond && outq != nil {
+			resp.PubAck = &PubAck{Stream: name}
+			resp.Error = apiErr
+			b, _ := json.Marshal(resp)
+			outq.sendMsg(reply, b)
+		}
+		mset.quarantineMsg(subject, hdr, msg, apiErr)
+		if reason == rejectMaxSize {
+			return ErrMaxPayload
+		}
+		return apiErr
+	}
+
 	if len(hdr) > 0 {
 		outq := mset.outq
 
@@ -4723,12 +6389,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			if sname := getExpectedStream(hdr); sname != _EMPTY_ && sname != name {
 				mset.mu.Unlock()
 				bumpCLFS()
+				reject(rejectOther)
 				if canRespond {
 					resp.PubAck = &PubAck{Stream: name}
 					resp.Error = NewJSStreamNotMatchError()
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamNotMatchError())
 				return errStreamMismatch
 			}
 		}
@@ -4741,6 +6409,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 				if dde := mset.checkMsgId(msgId); dde != nil {
 					mset.mu.Unlock()
 					bumpCLFS()
+					reject(rejectDuplicate)
 					if canRespond {
 						response := append(pubAck, strconv.FormatUint(dde.seq, 10)...)
 						response = append(response, ",\"duplicate\": true}"...)
@@ -4781,12 +6450,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			if err != nil || fseq != seq {
 				mset.mu.Unlock()
 				bumpCLFS()
+				reject(rejectWrongLastSeq)
 				if canRespond {
 					resp.PubAck = &PubAck{Stream: name}
 					resp.Error = NewJSStreamWrongLastSequenceError(fseq)
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamWrongLastSequenceError(fseq))
 				return fmt.Errorf("last sequence by subject mismatch: %d vs %d", seq, fseq)
 			}
 		}
@@ -4796,12 +6467,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			mlseq := mset.lseq
 			mset.mu.Unlock()
 			bumpCLFS()
+			reject(rejectWrongLastSeq)
 			if canRespond {
 				resp.PubAck = &PubAck{Stream: name}
 				resp.Error = NewJSStreamWrongLastSequenceError(mlseq)
 				b, _ := json.Marshal(resp)
 				outq.sendMsg(reply, b)
 			}
+			mset.quarantineMsg(subject, hdr, msg, NewJSStreamWrongLastSequenceError(mlseq))
 			return fmt.Errorf("last sequence mismatch: %d vs %d", seq, mlseq)
 		}
 		// Expected last msgId.
@@ -4813,12 +6486,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 				last := mset.lmsgId
 				mset.mu.Unlock()
 				bumpCLFS()
+				reject(rejectWrongLastMsgId)
 				if canRespond {
 					resp.PubAck = &PubAck{Stream: name}
 					resp.Error = NewJSStreamWrongLastMsgIDError(last)
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamWrongLastMsgIDError(last))
 				return fmt.Errorf("last msgid mismatch: %q vs %q", lmsgId, last)
 			}
 		}
@@ -4827,12 +6502,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			if !mset.cfg.AllowRollup || mset.cfg.DenyPurge {
 				mset.mu.Unlock()
 				bumpCLFS()
+				reject(rejectOther)
 				if canRespond {
 					resp.PubAck = &PubAck{Stream: name}
 					resp.Error = NewJSStreamRollupFailedError(errors.New("rollup not permitted"))
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamRollupFailedError(errors.New("rollup not permitted")))
 				return errors.New("rollup not permitted")
 			}
 			switch rollup {
@@ -4843,6 +6520,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			default:
 				mset.mu.Unlock()
 				bumpCLFS()
+				reject(rejectOther)
 				err := fmt.Errorf("rollup value invalid: %q", rollup)
 				if canRespond {
 					resp.PubAck = &PubAck{Stream: name}
@@ -4850,6 +6528,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 					b, _ := json.Marshal(resp)
 					outq.sendMsg(reply, b)
 				}
+				mset.quarantineMsg(subject, hdr, msg, NewJSStreamRollupFailedError(err))
 				return err
 			}
 		}
@@ -4862,29 +6541,9 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		err      error
 	)
 
-	// Check to see if we are over the max msg size.
-	if maxMsgSize >= 0 && (len(hdr)+len(msg)) > maxMsgSize {
-		mset.mu.Unlock()
-		bumpCLFS()
-		if canRespond {
-			resp.PubAck = &PubAck{Stream: name}
-			resp.Error = NewJSStreamMessageExceedsMaximumError()
-			response, _ = json.Marshal(resp)
-			mset.outq.sendMsg(reply, response)
-		}
-		return ErrMaxPayload
-	}
-
-	if len(hdr) > math.MaxUint16 {
-		mset.mu.Unlock()
-		bumpCLFS()
-		if canRespond {
-			resp.PubAck = &PubAck{Stream: name}
-			resp.Error = NewJSStreamHeaderExceedsMaximumError()
-			response, _ = json.Marshal(resp)
-			mset.outq.sendMsg(reply, response)
-		}
-		return ErrMaxPayload
+	// Memory streams can spill over to disk instead of rejecting messages at their memory limits.
+	if mset.shouldSpill(subject, hdr, msg) {
+		mset.startSpill()
 	}
 
 	// Check to see if we have exceeded our limits.
@@ -4892,12 +6551,14 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		s.resourcesExceededError()
 		mset.mu.Unlock()
 		bumpCLFS()
+		reject(rejectLimits)
 		if canRespond {
 			resp.PubAck = &PubAck{Stream: name}
 			resp.Error = NewJSInsufficientResourcesError()
 			response, _ = json.Marshal(resp)
 			mset.outq.sendMsg(reply, response)
 		}
+		mset.quarantineMsg(subject, hdr, msg, NewJSInsufficientResourcesError())
 		// Stepdown regardless.
 		if node := mset.raftNode(); node != nil {
 			node.StepDown()
@@ -4977,6 +6638,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 				err = NewJSAccountResourcesExceededError()
 			}
 			s.RateLimitWarnf("JetStream resource limits exceeded for account: %q", accName)
+			reject(rejectLimits)
 			if canRespond {
 				resp.PubAck = &PubAck{Stream: name}
 				resp.Error = err
@@ -4984,6 +6646,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 				mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 			}
 			mset.mu.Unlock()
+			mset.quarantineMsg(subject, hdr, msg, err)
 			return err
 		}
 	}
@@ -5011,13 +6674,18 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		mset.lmsgId = olmsgId
 		mset.mu.Unlock()
 		bumpCLFS()
+		reject(storeErrRejectReason(err))
 
 		switch err {
-		case ErrMaxMsgs, ErrMaxBytes, ErrMaxMsgsPerSubject, ErrMsgTooLarge:
+		case ErrMaxMsgs, ErrMaxBytes, ErrMaxMsgsPerSubject, ErrMaxBlocks, ErrMsgTooLarge:
 			s.RateLimitDebugf("JetStream failed to store a msg on stream '%s > %s': %v", accName, name, err)
 		case ErrStoreClosed:
 		default:
 			s.Errorf("JetStream failed to store a msg on stream '%s > %s': %v", accName, name, err)
+			// When clustered this is handled when applying entries.
+			if !isClustered {
+				s.handleStorageError(mset, err)
+			}
 		}
 
 		if canRespond {
@@ -5026,6 +6694,9 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 			response, _ = json.Marshal(resp)
 			mset.outq.sendMsg(reply, response)
 		}
+		if err != ErrStoreClosed {
+			mset.quarantineMsg(subject, hdr, msg, NewJSStreamStoreFailedError(err, Unless(err)))
+		}
 		return err
 	}
 
@@ -5044,64 +6715,110 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		}
 	}
 
+	// Advance the event time watermark.
+	if mset.cfg.EventTimeHeader != _EMPTY_ {
+		if et, ok := getEventTime(mset.cfg.EventTimeHeader, hdr); ok && et > mset.etime {
+			mset.etime = et
+		}
+	}
+
+	// Let our push mirrors know there is something new, once synced when part of a group commit.
+	if gc == nil {
+		mset.signalPushMirrors()
+	}
+
 	// If here we succeeded in storing the message.
 	mset.mu.Unlock()
 
 	// No errors, this is the normal path.
-	if rollupSub {
-		mset.purge(&JSApiStreamPurgeRequest{Subject: subject, Keep: 1})
-	} else if rollupAll {
-		mset.purge(&JSApiStreamPurgeRequest{Keep: 1})
-	}
+	// When part of a group commit nothing acts on the message before it is synced.
+	stored := func() {
+		if rollupSub {
+			mset.purge(&JSApiStreamPurgeRequest{Subject: subject, Keep: 1})
+		} else if rollupAll {
+			mset.purge(&JSApiStreamPurgeRequest{Keep: 1})
+		}
 
-	// Check for republish.
-	if republish {
-		tsStr := time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
-		var rpMsg []byte
-		if len(hdr) == 0 {
-			const ht = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Time-Stamp: %s\r\nNats-Last-Sequence: %d\r\n\r\n"
-			const htho = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Time-Stamp: %s\r\nNats-Last-Sequence: %d\r\nNats-Msg-Size: %d\r\n\r\n"
-			if !thdrsOnly {
-				hdr = fmt.Appendf(nil, ht, name, subject, seq, tsStr, tlseq)
-				rpMsg = copyBytes(msg)
-			} else {
-				hdr = fmt.Appendf(nil, htho, name, subject, seq, tsStr, tlseq, len(msg))
-			}
-		} else {
-			// Slow path.
-			hdr = genHeader(hdr, JSStream, name)
-			hdr = genHeader(hdr, JSSubject, subject)
-			hdr = genHeader(hdr, JSSequence, strconv.FormatUint(seq, 10))
-			hdr = genHeader(hdr, JSTimeStamp, tsStr)
-			hdr = genHeader(hdr, JSLastSequence, strconv.FormatUint(tlseq, 10))
-			if !thdrsOnly {
-				rpMsg = copyBytes(msg)
-			} else {
-				hdr = genHeader(hdr, JSMsgSize, strconv.Itoa(len(msg)))
+		// Check for republish.
+		if republish {
+			mset.republishMsg(name, tsubj, subject, hdr, msg, seq, ts, tlseq, thdrsOnly)
+		}
+
+		// Signal consumers for new messages.
+		if numConsumers > 0 {
+			mset.sigq.push(newCMsg(subject, seq))
+			select {
+			case mset.sch <- struct{}{}:
+			default:
 			}
 		}
-		mset.outq.send(newJSPubMsg(tsubj, _EMPTY_, _EMPTY_, copyBytes(hdr), rpMsg, nil, seq))
+	}
+	if gc != nil {
+		gc.after(stored)
+	} else {
+		stored()
 	}
 
-	// Send response here.
+	// Send response here, or once synced when part of a group commit.
 	if canRespond {
 		response = append(pubAck, strconv.FormatUint(seq, 10)...)
 		response = append(response, '}')
-		mset.outq.sendMsg(reply, response)
+		if gc != nil {
+			gc.add(reply, response)
+		} else {
+			mset.outq.sendMsg(reply, response)
+		}
 	}
 
-	// Signal consumers for new messages.
-	if numConsumers > 0 {
-		mset.sigq.push(newCMsg(subject, seq))
-		select {
-		case mset.sch <- struct{}{}:
-		default:
-		}
+	// Warn before the limits start discarding messages.
+	if quotaWarning && isLeader {
+		mset.checkQuotaWarning()
 	}
 
 	return nil
 }
 
+// Returns the headers with the size of the payload in the Nats-Msg-Size header, and no payload.
+// A message that was stripped already, e.g. by the leader before proposing it, is returned as is.
+func stripPayload(hdr, msg []byte) ([]byte, []byte) {
+	if getHeader(JSMsgSize, hdr) != nil {
+		if len(msg) == 0 {
+			return hdr, nil
+		}
+		hdr = removeHeaderIfPresent(copyBytes(hdr), JSMsgSize)
+	}
+	return genHeader(hdr, JSMsgSize, strconv.Itoa(len(msg))), nil
+}
+
+// republishMsg will republish a stored message to the transformed subject.
+func (mset *stream) republishMsg(name, tsubj, subject string, hdr, msg []byte, seq uint64, ts int64, tlseq uint64, thdrsOnly bool) {
+	tsStr := time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+	var rpMsg []byte
+	if len(hdr) == 0 {
+		const ht = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Time-Stamp: %s\r\nNats-Last-Sequence: %d\r\n\r\n"
+		const htho = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Time-Stamp: %s\r\nNats-Last-Sequence: %d\r\nNats-Msg-Size: %d\r\n\r\n"
+		if !thdrsOnly {
+			hdr = fmt.Appendf(nil, ht, name, subject, seq, tsStr, tlseq)
+			rpMsg = copyBytes(msg)
+		} else {
+			hdr = fmt.Appendf(nil, htho, name, subject, seq, tsStr, tlseq, len(msg))
+		}
+	} else {
+		// Slow path.
+		hdr = genHeader(hdr, JSStream, name)
+		hdr = genHeader(hdr, JSSubject, subject)
+		hdr = genHeader(hdr, JSSequence, strconv.FormatUint(seq, 10))
+		hdr = genHeader(hdr, JSTimeStamp, tsStr)
+		hdr = genHeader(hdr, JSLastSequence, strconv.FormatUint(tlseq, 10))
+		if !thdrsOnly {
+			rpMsg = copyBytes(msg)
+		} else {
+			hdr = genHeader(hdr, JSMsgSize, strconv.Itoa(len(msg)))
+		}
+	}
+	mset.outq.send(newJSPubMsg(tsubj, _EMPTY_, _EMPTY_, copyBytes(hdr), rpMsg, nil, seq))
+}
+
 // Used to signal inbound message to registered consumers.
 type cMsg struct {
 	seq  uint64
@@ -5258,7 +6975,9 @@ func (q *jsOutQ) send(msg *jsPubMsg) {
 	if q == nil || msg == nil {
 		return
 	}
-	q.push(msg)
+	if _, err := q.push(msg); err != nil {
+		msg.returnToPool()
+	}
 }
 
 func (q *jsOutQ) unregister() {
@@ -5286,10 +7005,57 @@ func (mset *stream) setupSendCapabilities() {
 		return
 	}
 	qname := fmt.Sprintf("[ACC:%s] stream '%s' sendQ", mset.acc.Name, mset.cfg.Name)
-	mset.outq = &jsOutQ{newIPQueue[*jsPubMsg](mset.srv, qname)}
+	mset.outq = &jsOutQ{newIPQueue[*jsPubMsg](mset.srv, qname,
+		ipqSizeCalculation(func(pm *jsPubMsg) uint64 { return uint64(pm.size()) }),
+		ipqLimits[*jsPubMsg](mset.srv.getOpts().JetStreamQueueLimits.Outbound),
+		ipqDropHandler((*jsPubMsg).returnToPool),
+	)}
 	go mset.internalLoop()
 }
 
+// Will make the stream reject new messages after a failure of our storage.
+// Returns true if the stream was not read-only already.
+func (mset *stream) setStorageReadOnly(err error) bool {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	if mset.roErr != nil {
+		return false
+	}
+	mset.roErr, mset.roTime = err, time.Now().UTC()
+	return true
+}
+
+// Returns the failure that made the stream read-only, nil if there is none.
+func (mset *stream) storageFailure() *StreamStorageFailure {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.roErr == nil {
+		return nil
+	}
+	return &StreamStorageFailure{
+		Class: classifyStorageError(mset.roErr),
+		Error: mset.roErr.Error(),
+		Since: mset.roTime,
+	}
+}
+
+// Will check that our storage can be written to again and if so
+// have the stream accept new messages.
+func (mset *stream) clearStorageReadOnly() error {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	if mset.roErr == nil {
+		return nil
+	}
+	if fs, ok := mset.store.(*fileStore); ok {
+		if err := fs.checkWritable(); err != nil {
+			return err
+		}
+	}
+	mset.roErr, mset.roTime = nil, time.Time{}
+	return nil
+}
+
 // Returns the associated account name.
 func (mset *stream) accName() string {
 	if mset == nil {
@@ -5321,7 +7087,11 @@ func (mset *stream) internalLoop() {
 	c := s.createInternalJetStreamClient()
 	c.registerWithAccount(mset.acc)
 	defer c.closeConnection(ClientClosed)
-	outq, qch, msgs, gets := mset.outq, mset.qch, mset.msgs, mset.gets
+	outq, qch, msgs, validated, gets := mset.outq, mset.qch, mset.msgs, mset.validated, mset.gets
+	var db *jsDeliveryBudget
+	if mset.jsa != nil {
+		db = mset.jsa.delivery
+	}
 
 	// For the ack msgs queue for interest retention.
 	var (
@@ -5346,77 +7116,110 @@ func (mset *stream) internalLoop() {
 		hdb   [10]byte
 	)
 
-	for {
-		select {
-		case <-outq.ch:
-			pms := outq.pop()
-			for _, pm := range pms {
-				c.pa.subject = append(dsubj[:0], pm.dsubj...)
-				c.pa.deliver = append(subj[:0], pm.subj...)
-				c.pa.size = len(pm.msg) + len(pm.hdr)
-				c.pa.szb = append(szb[:0], strconv.Itoa(c.pa.size)...)
-				if len(pm.reply) > 0 {
-					c.pa.reply = append(rply[:0], pm.reply...)
-				} else {
-					c.pa.reply = nil
-				}
+	// Delivers the messages queued on the outbound queue.
+	deliver := func() {
+		pms := outq.pop()
+		for _, pm := range pms {
+			c.pa.subject = append(dsubj[:0], pm.dsubj...)
+			c.pa.deliver = append(subj[:0], pm.subj...)
+			c.pa.size = len(pm.msg) + len(pm.hdr)
+			c.pa.szb = append(szb[:0], strconv.Itoa(c.pa.size)...)
+			if len(pm.reply) > 0 {
+				c.pa.reply = append(rply[:0], pm.reply...)
+			} else {
+				c.pa.reply = nil
+			}
 
-				// If we have an underlying buf that is the wire contents for hdr + msg, else construct on the fly.
-				var msg []byte
-				if len(pm.buf) > 0 {
-					msg = pm.buf
-				} else {
-					if len(pm.hdr) > 0 {
-						msg = pm.hdr
-						if len(pm.msg) > 0 {
-							msg = _r[:0]
-							msg = append(msg, pm.hdr...)
-							msg = append(msg, pm.msg...)
-						}
-					} else if len(pm.msg) > 0 {
-						// We own this now from a low level buffer perspective so can use directly here.
-						msg = pm.msg
+			// If we have an underlying buf that is the wire contents for hdr + msg, else construct on the fly.
+			var msg []byte
+			if len(pm.buf) > 0 {
+				msg = pm.buf
+			} else {
+				if len(pm.hdr) > 0 {
+					msg = pm.hdr
+					if len(pm.msg) > 0 {
+						msg = _r[:0]
+						msg = append(msg, pm.hdr...)
+						msg = append(msg, pm.msg...)
 					}
+				} else if len(pm.msg) > 0 {
+					// We own this now from a low level buffer perspective so can use directly here.
+					msg = pm.msg
 				}
+			}
 
-				if len(pm.hdr) > 0 {
-					c.pa.hdr = len(pm.hdr)
-					c.pa.hdb = []byte(strconv.Itoa(c.pa.hdr))
-					c.pa.hdb = append(hdb[:0], strconv.Itoa(c.pa.hdr)...)
-				} else {
-					c.pa.hdr = -1
-					c.pa.hdb = nil
-				}
+			if len(pm.hdr) > 0 {
+				c.pa.hdr = len(pm.hdr)
+				c.pa.hdb = []byte(strconv.Itoa(c.pa.hdr))
+				c.pa.hdb = append(hdb[:0], strconv.Itoa(c.pa.hdr)...)
+			} else {
+				c.pa.hdr = -1
+				c.pa.hdb = nil
+			}
+
+			msg = append(msg, _CRLF_...)
+
+			didDeliver, _ := c.processInboundClientMsg(msg)
+			c.pa.szb, c.pa.subject, c.pa.deliver = nil, nil, nil
 
-				msg = append(msg, _CRLF_...)
+			// Check to see if this is a delivery for a consumer and
+			// we failed to deliver the message. If so alert the consumer.
+			if pm.o != nil && pm.seq > 0 && !didDeliver {
+				pm.o.didNotDeliver(pm.seq, pm.dsubj)
+			}
+			pm.returnToPool()
+		}
+		// TODO: Move in the for-loop?
+		c.flushClients(0)
+		outq.recycle(&pms)
+	}
 
-				didDeliver, _ := c.processInboundClientMsg(msg)
-				c.pa.szb, c.pa.subject, c.pa.deliver = nil, nil, nil
+	// The streams of the account may have to take turns to deliver.
+	var dturn *nrgProposalTurn
+	var dstart time.Time
+	defer func() {
+		if dturn != nil {
+			db.cancel(dturn)
+		}
+	}()
 
-				// Check to see if this is a delivery for a consumer and
-				// we failed to deliver the message. If so alert the consumer.
-				if pm.o != nil && pm.seq > 0 && !didDeliver {
-					pm.o.didNotDeliver(pm.seq, pm.dsubj)
+	for {
+		select {
+		case <-outq.ch:
+			if db == nil {
+				deliver()
+			} else if dturn == nil {
+				// Whatever is queued while waiting is delivered with this turn.
+				if dturn, dstart = db.acquire(int(outq.size())), time.Now(); dturn == nil {
+					db.delivered(0)
+					deliver()
+					db.release()
 				}
-				pm.returnToPool()
 			}
-			// TODO: Move in the for-loop?
-			c.flushClients(0)
-			outq.recycle(&pms)
+		case <-dturn.turn():
+			dturn = nil
+			db.delivered(time.Since(dstart))
+			deliver()
+			db.release()
 		case <-msgs.ch:
 			// This can possibly change now so needs to be checked here.
 			isClustered := mset.IsClustered()
 			ims := msgs.pop()
-			for _, im := range ims {
-				// If we are clustered we need to propose this message to the underlying raft group.
-				if isClustered {
-					mset.processClusteredInboundMsg(im.subj, im.rply, im.hdr, im.msg, im.mt)
-				} else {
-					mset.processJetStreamMsg(im.subj, im.rply, im.hdr, im.msg, 0, 0, im.mt)
-				}
-				im.returnToPool()
+			// Have the messages validated before they are stored or proposed,
+			// without waiting for the validator here.
+			if sv := mset.validator.Load(); sv != nil {
+				sv.start(mset, c, slices.Clone(ims), func(b *validationBatch) { validated.push(b) })
+			} else {
+				mset.processInboundMsgs(ims, nil, isClustered)
 			}
 			msgs.recycle(&ims)
+		case <-validated.ch:
+			isClustered := mset.IsClustered()
+			bs := validated.pop()
+			for _, b := range bs {
+				mset.processInboundMsgs(b.ims, b.errs, isClustered)
+			}
+			validated.recycle(&bs)
 		case <-gets.ch:
 			dgs := gets.pop()
 			for _, dg := range dgs {
@@ -5439,6 +7242,29 @@ func (mset *stream) internalLoop() {
 	}
 }
 
+// Stores or proposes a batch of inbound messages, rejecting the ones the validator did not accept.
+func (mset *stream) processInboundMsgs(ims []*inMsg, verrs []*ApiError, isClustered bool) {
+	// Sync all messages we store at once before acknowledging them.
+	gcommit := !isClustered && len(ims) > 1 && mset.beginGroupCommit()
+	for i, im := range ims {
+		if verrs != nil && verrs[i] != nil {
+			mset.rejectInbound(rejectValidation, verrs[i], im.subj, im.rply, im.hdr, im.msg, im.mt)
+			im.returnToPool()
+			continue
+		}
+		// If we are clustered we need to propose this message to the underlying raft group.
+		if isClustered {
+			mset.processClusteredInboundMsg(im.subj, im.rply, im.hdr, im.msg, im.mt)
+		} else {
+			mset.processJetStreamMsg(im.subj, im.rply, im.hdr, im.msg, 0, 0, im.mt)
+		}
+		im.returnToPool()
+	}
+	if gcommit {
+		mset.commitGroup()
+	}
+}
+
 // Used to break consumers out of their monitorConsumer go routines.
 func (mset *stream) resetAndWaitOnConsumers() {
 	mset.mu.RLock()
@@ -5570,6 +7396,15 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 		}
 	}
 
+	// Keep the dedupe state, so a restart does not need to rescan the messages.
+	if !deleteFlag && mset.cfg.PersistDuplicates && mset.ddloaded {
+		if fs, ok := mset.store.(*fileStore); ok {
+			if err := fs.writeDedupeState(mset.encodeDedupeState()); err != nil {
+				mset.srv.Warnf("Error writing dedupe state for '%s > %s': %v", mset.acc.Name, mset.cfg.Name, err)
+			}
+		}
+	}
+
 	// Cleanup duplicate timer if running.
 	if mset.ddtmr != nil {
 		mset.ddtmr.Stop()
@@ -5579,6 +7414,18 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 		mset.ddindex = 0
 	}
 
+	// Cleanup the pause timer if running.
+	if mset.pausetmr != nil {
+		mset.pausetmr.Stop()
+		mset.pausetmr = nil
+	}
+
+	// Cleanup the inactivity timer if running.
+	if mset.itmr != nil {
+		mset.itmr.Stop()
+		mset.itmr = nil
+	}
+
 	sysc := mset.sysc
 	mset.sysc = nil
 
@@ -5586,6 +7433,7 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 		// Unregistering ipQueues do not prevent them from push/pop
 		// just will remove them from the central monitoring map
 		mset.msgs.unregister()
+		mset.validated.unregister()
 		mset.ackq.unregister()
 		mset.outq.unregister()
 		mset.sigq.unregister()
@@ -5593,7 +7441,7 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 	}
 
 	// Snapshot store.
-	store := mset.store
+	store, spilled := mset.store, mset.spilled.Load()
 	c := mset.client
 
 	// Clustered cleanup.
@@ -5623,7 +7471,7 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 			store.Delete()
 		}
 		// Release any resources.
-		js.releaseStreamResources(&mset.cfg)
+		js.releaseStreamResources(mset.storeConfig(&mset.cfg))
 		// cleanup directories after the stream
 		accDir := filepath.Join(js.config.StoreDir, accName)
 		// Do cleanup in separate go routine similar to how fs will use purge here..
@@ -5634,7 +7482,12 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 		}()
 	} else if store != nil {
 		// Ignore errors.
-		store.Stop()
+		if spilled {
+			// Memory streams do not survive a restart, neither does their spill over.
+			store.Delete()
+		} else {
+			store.Stop()
+		}
 	}
 
 	return nil
@@ -5741,6 +7594,9 @@ func (mset *stream) removeConsumer(o *consumer) {
 	if o.cfg.Direct && mset.directs > 0 {
 		mset.directs--
 	}
+	if o.cfg.Shared {
+		mset.releaseConsumerClaims(o.name)
+	}
 	if mset.consumers != nil {
 		delete(mset.consumers, o.name)
 		// Now update consumers list as well
@@ -5849,16 +7705,33 @@ func (mset *stream) stateWithDetail(details bool) StreamState {
 		return StreamState{}
 	}
 
+	var state StreamState
 	// Currently rely on store for details.
 	if details {
-		return store.State()
+		state = store.State()
+	} else {
+		// Here we do the fast version.
+		store.FastState(&state)
+	}
+	if fs, ok := store.(*fileStore); ok {
+		state.ReclaimedBytes = fs.reclaimed.Load()
 	}
-	// Here we do the fast version.
-	var state StreamState
-	store.FastState(&state)
 	return state
 }
 
+// Returns the gaps of deleted messages of the stream as ranges.
+func (mset *stream) deletedRanges() []SequenceRange {
+	store := mset.store
+	if store == nil {
+		return nil
+	}
+	if fs, ok := store.(*fileStore); ok {
+		return fs.deletedRanges()
+	}
+	// Other stores only have the deleted sequences.
+	return DeleteBlocks{DeleteSlice(store.State().Deleted)}.ranges()
+}
+
 func (mset *stream) Store() StreamStore {
 	mset.mu.RLock()
 	defer mset.mu.RUnlock()
@@ -5866,14 +7739,23 @@ func (mset *stream) Store() StreamStore {
 }
 
 // Determines if the new proposed partition is unique amongst all consumers.
+// Shared consumers may overlap with other shared consumers.
 // Lock should be held.
-func (mset *stream) partitionUnique(name string, partitions []string) bool {
+func (mset *stream) partitionUnique(name string, partitions []string, shared bool) bool {
+	// An unfiltered shared consumer collides with every non shared consumer.
+	if len(partitions) == 0 && shared {
+		partitions = []string{fwcs}
+	}
 	for _, partition := range partitions {
 		for n, o := range mset.consumers {
 			// Skip the consumer being checked.
 			if n == name {
 				continue
 			}
+			// Shared consumers may overlap each other.
+			if shared && o.cfg.Shared {
+				continue
+			}
 			if o.subjf == nil {
 				return false
 			}
@@ -5887,6 +7769,122 @@ func (mset *stream) partitionUnique(name string, partitions []string) bool {
 	return true
 }
 
+// How many messages are claimed between checks for claims of messages that were purged.
+const claimsPruneInterval = 1024
+
+// claimMsg records that the shared consumer name owns the message at seq
+// unless another shared consumer was delivered it first.
+// Returns true if name owns the message.
+func (mset *stream) claimMsg(seq uint64, name string) bool {
+	mset.claimsMu.Lock()
+	defer mset.claimsMu.Unlock()
+	if owner, ok := mset.claims[seq]; ok {
+		return owner == name
+	}
+	if mset.claims == nil {
+		mset.claims = make(map[uint64]string)
+	}
+	mset.claims[seq] = name
+
+	// Messages that are acked release their claim, but purges do not, so check here.
+	if mset.nclaims++; mset.nclaims%claimsPruneInterval == 0 {
+		var state StreamState
+		mset.store.FastState(&state)
+		for cseq := range mset.claims {
+			if cseq < state.FirstSeq {
+				delete(mset.claims, cseq)
+			}
+		}
+	}
+	return true
+}
+
+// releaseClaim forgets the owner of a message that was removed from the stream.
+func (mset *stream) releaseClaim(seq uint64) {
+	mset.claimsMu.Lock()
+	defer mset.claimsMu.Unlock()
+	delete(mset.claims, seq)
+}
+
+// releaseConsumerClaims forgets the messages owned by a shared consumer that is going away,
+// and hands the ones not acknowledged to the other shared consumers, which skipped them.
+// Lock should be held.
+func (mset *stream) releaseConsumerClaims(name string) {
+	var seqs []uint64
+	mset.claimsMu.Lock()
+	for seq, owner := range mset.claims {
+		if owner == name {
+			delete(mset.claims, seq)
+			seqs = append(seqs, seq)
+		}
+	}
+	mset.claimsMu.Unlock()
+	if len(seqs) == 0 {
+		return
+	}
+	slices.Sort(seqs)
+
+	var peers []*consumer
+	for _, o := range mset.consumers {
+		if o.cfg.Shared && o.name != name {
+			peers = append(peers, o)
+		}
+	}
+	// Consumers can not be locked while we are.
+	go func() {
+		for _, o := range peers {
+			o.addReleased(seqs)
+		}
+	}()
+}
+
+// claimPending records that a recovered shared consumer owns the messages it has pending.
+func (mset *stream) claimPending(name string, pending map[uint64]*Pending) {
+	mset.claimsMu.Lock()
+	defer mset.claimsMu.Unlock()
+	if mset.claims == nil {
+		mset.claims = make(map[uint64]string, len(pending))
+	}
+	for seq := range pending {
+		mset.claims[seq] = name
+	}
+}
+
+// isClaimed returns if a shared consumer owns the message at seq.
+func (mset *stream) isClaimed(seq uint64) bool {
+	mset.claimsMu.Lock()
+	defer mset.claimsMu.Unlock()
+	_, ok := mset.claims[seq]
+	return ok
+}
+
+// lowestClaim returns the lowest message at or below seq owned by a shared consumer
+// other than name, or 0 if there is none.
+func (mset *stream) lowestClaim(name string, seq uint64) uint64 {
+	mset.claimsMu.Lock()
+	defer mset.claimsMu.Unlock()
+	var lowest uint64
+	for cseq, owner := range mset.claims {
+		if owner != name && cseq <= seq && (lowest == 0 || cseq < lowest) {
+			lowest = cseq
+		}
+	}
+	return lowest
+}
+
+// claimsRecovered lets shared consumers deliver again once all consumers were recovered,
+// and hands them the messages they skipped that no consumer owns anymore.
+func (mset *stream) claimsRecovered() {
+	if !mset.claimsRecovering.Swap(false) {
+		return
+	}
+	for _, o := range mset.getConsumers() {
+		if o.cfg.Shared {
+			o.releaseUnclaimed()
+		}
+	}
+}
+
 // Lock should be held.
 func (mset *stream) potentialFilteredConsumers() bool {
 	numSubjects := len(mset.cfg.Subjects)
@@ -6095,38 +8093,31 @@ func (mset *stream) snapshot(deadline time.Duration, checkMsgs, includeConsumers
 
 const snapsDir = "__snapshots__"
 
-// RestoreStream will restore a stream from a snapshot.
-func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error) {
-	if ncfg == nil {
-		return nil, errors.New("nil config on stream restore")
-	}
-
-	s, jsa, err := a.checkForJetStream()
-	if err != nil {
-		return nil, err
-	}
-
-	cfg, apiErr := s.checkStreamCfg(ncfg, a, false)
-	if apiErr != nil {
-		return nil, apiErr
-	}
-
+// unpackSnapshot unpacks a stream snapshot into a new directory in the account's snapshots directory.
+// The caller is responsible for removing the directory.
+func (a *Account) unpackSnapshot(jsa *jsAccount, r io.Reader) (string, error) {
 	sd := filepath.Join(jsa.storeDir, snapsDir)
 	if _, err := os.Stat(sd); os.IsNotExist(err) {
 		if err := os.MkdirAll(sd, defaultDirPerms); err != nil {
-			return nil, fmt.Errorf("could not create snapshots directory - %v", err)
+			return _EMPTY_, fmt.Errorf("could not create snapshots directory - %v", err)
 		}
 	}
 	sdir, err := os.MkdirTemp(sd, "snap-")
 	if err != nil {
-		return nil, err
+		return _EMPTY_, err
 	}
 	if _, err := os.Stat(sdir); os.IsNotExist(err) {
 		if err := os.MkdirAll(sdir, defaultDirPerms); err != nil {
-			return nil, fmt.Errorf("could not create snapshots directory - %v", err)
+			return _EMPTY_, fmt.Errorf("could not create snapshots directory - %v", err)
 		}
 	}
-	defer os.RemoveAll(sdir)
+	// Cleanup if we fail to unpack.
+	var ok bool
+	defer func() {
+		if !ok {
+			os.RemoveAll(sdir)
+		}
+	}()
 
 	logAndReturnError := func() error {
 		a.mu.RLock()
@@ -6146,27 +8137,63 @@ func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error
 			break // End of snapshot
 		}
 		if err != nil {
-			return nil, err
+			return _EMPTY_, err
 		}
 		if hdr.Typeflag != tar.TypeReg {
-			return nil, logAndReturnError()
+			return _EMPTY_, logAndReturnError()
 		}
 		fpath := filepath.Join(sdir, filepath.Clean(hdr.Name))
 		if !strings.HasPrefix(fpath, sdirCheck) {
-			return nil, logAndReturnError()
+			return _EMPTY_, logAndReturnError()
 		}
 		os.MkdirAll(filepath.Dir(fpath), defaultDirPerms)
 		fd, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0600)
 		if err != nil {
-			return nil, err
+			return _EMPTY_, err
 		}
 		_, err = io.Copy(fd, tr)
 		fd.Close()
 		if err != nil {
-			return nil, err
+			return _EMPTY_, err
 		}
 	}
 
+	ok = true
+	return sdir, nil
+}
+
+// RestoreStream will restore a stream from a snapshot.
+func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error) {
+	return a.restoreStream(ncfg, r, nil)
+}
+
+func (a *Account) restoreStream(ncfg *StreamConfig, r io.Reader, opts *StreamRestoreOptions) (*stream, error) {
+	if opts == nil {
+		opts = &StreamRestoreOptions{}
+	}
+	if ncfg == nil {
+		return nil, errors.New("nil config on stream restore")
+	}
+
+	s, jsa, err := a.checkForJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, apiErr := s.checkStreamCfg(ncfg, a, false)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if r, err = s.snapshotDecrypter(r, a.Name, cfg.Name); err != nil {
+		return nil, err
+	}
+	sdir, err := a.unpackSnapshot(jsa, r)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(sdir)
+
 	// Check metadata.
 	// The cfg passed in will be the new identity for the stream.
 	var fcfg FileStreamInfo
@@ -6193,6 +8220,13 @@ func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error
 	if _, err := os.Stat(ndir); err == nil {
 		os.RemoveAll(ndir)
 	}
+	// Same for an index placed apart, the restored one is moved there once recovered.
+	jsa.mu.RLock()
+	idir := jsa.streamIndexDir(cfg.Name)
+	jsa.mu.RUnlock()
+	if idir != _EMPTY_ {
+		os.RemoveAll(idir)
+	}
 	// Make sure our destination streams directory exists.
 	if err := os.MkdirAll(filepath.Join(jsa.storeDir, streamsDir), defaultDirPerms); err != nil {
 		return nil, err
@@ -6251,8 +8285,20 @@ func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error
 		}
 		isEphemeral := !isDurableConsumer(&cfg.ConsumerConfig)
 		if isEphemeral {
-			// This is an ephermal consumer and this could fail on restart until
-			// the consumer can reconnect. We will create it as a durable and switch it.
+			switch opts.Ephemerals {
+			case DropEphemerals:
+				os.RemoveAll(filepath.Join(odir, ofi.Name()))
+				continue
+			case RestoreEphemeralsAsDurables:
+				// Kept as a durable until no client used it for the TTL.
+				isEphemeral = false
+				cfg.ConsumerConfig.InactiveThreshold = opts.EphemeralsTTL
+				if cfg.ConsumerConfig.InactiveThreshold == 0 {
+					cfg.ConsumerConfig.InactiveThreshold = defaultRestoredEphemeralTTL
+				}
+			}
+			// Restoring an ephemeral could fail until the consumer can reconnect.
+			// We will create it as a durable and switch it, unless it is kept as durable.
 			cfg.ConsumerConfig.Durable = ofi.Name()
 		}
 		obs, err := mset.addConsumer(&cfg.ConsumerConfig)
@@ -6277,6 +8323,157 @@ func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error
 	return mset, nil
 }
 
+// StreamSnapshotReport is the result of verifying a stream snapshot without restoring it.
+type StreamSnapshotReport struct {
+	Stream    string                    `json:"stream"`
+	Valid     bool                      `json:"valid"`
+	State     StreamState               `json:"state"`
+	Consumers []*ConsumerSnapshotReport `json:"consumers,omitempty"`
+	Errors    []string                  `json:"errors,omitempty"`
+}
+
+// ConsumerSnapshotReport is the result of verifying the state of a consumer in a stream snapshot.
+type ConsumerSnapshotReport struct {
+	Name      string   `json:"name"`
+	Valid     bool     `json:"valid"`
+	Delivered uint64   `json:"delivered_seq"`
+	AckFloor  uint64   `json:"ack_floor_seq"`
+	Pending   int      `json:"num_ack_pending"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// VerifyStreamSnapshot unpacks and checks a snapshot like RestoreStream would, without creating the stream.
+// The metadata and message checksums and the consumer states are checked, and the stream state is compared
+// to the expected state if given. Problems with the snapshot are reported, errors are only returned if the
+// snapshot could not be checked at all.
+func (a *Account) VerifyStreamSnapshot(ncfg *StreamConfig, expected *StreamState, r io.Reader) (*StreamSnapshotReport, error) {
+	if ncfg == nil {
+		return nil, errors.New("nil config on stream verify")
+	}
+
+	s, jsa, err := a.checkForJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, apiErr := s.checkStreamCfg(ncfg, a, false)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	report := &StreamSnapshotReport{Stream: cfg.Name}
+	addErr := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+	finish := func() (*StreamSnapshotReport, error) {
+		report.Valid = len(report.Errors) == 0
+		for _, cr := range report.Consumers {
+			report.Valid = report.Valid && cr.Valid
+		}
+		return report, nil
+	}
+
+	r, err = s.snapshotDecrypter(r, a.Name, cfg.Name)
+	if err != nil {
+		addErr("invalid snapshot archive: %v", err)
+		return finish()
+	}
+	sdir, err := a.unpackSnapshot(jsa, r)
+	if err != nil {
+		addErr("invalid snapshot archive: %v", err)
+		return finish()
+	}
+	defer os.RemoveAll(sdir)
+
+	// Check metadata.
+	var fcfg FileStreamInfo
+	buf, err := checkMetaFile(sdir, cfg.Name)
+	if err == nil {
+		err = json.Unmarshal(buf, &fcfg)
+	}
+	if err != nil {
+		addErr("invalid stream metadata: %v", err)
+		return finish()
+	}
+	if fcfg.Name != cfg.Name {
+		addErr("stream names do not match")
+		return finish()
+	}
+
+	// Check messages, recovering the store gives us the state and we check the checksum of each message.
+	fs, err := newFileStoreWithCreated(FileStoreConfig{StoreDir: sdir, srv: s}, fcfg.StreamConfig, fcfg.Created, nil, nil)
+	if err != nil {
+		addErr("invalid message store: %v", err)
+		return finish()
+	}
+	lost := fs.checkMsgs()
+	report.State = fs.State()
+	fs.Stop()
+	if lost != nil && len(lost.Msgs) > 0 {
+		report.State.Lost = lost
+		addErr("%d messages failed checksum validation", len(lost.Msgs))
+	}
+	if expected != nil {
+		if st := report.State; st.Msgs != expected.Msgs || st.FirstSeq != expected.FirstSeq || st.LastSeq != expected.LastSeq {
+			addErr("stream state does not match, expected %d messages [%d-%d], found %d messages [%d-%d]",
+				expected.Msgs, expected.FirstSeq, expected.LastSeq, st.Msgs, st.FirstSeq, st.LastSeq)
+		}
+	}
+
+	// Now do consumers.
+	odir := filepath.Join(sdir, consumerDir)
+	ofis, _ := os.ReadDir(odir)
+	for _, ofi := range ofis {
+		report.Consumers = append(report.Consumers, verifyConsumerSnapshot(filepath.Join(odir, ofi.Name()), cfg.Name, ofi.Name(), &report.State))
+	}
+	return finish()
+}
+
+// Checks the metadata and state of a consumer in an unpacked snapshot against the stream's state.
+func verifyConsumerSnapshot(dir, stream, name string, ss *StreamState) *ConsumerSnapshotReport {
+	cr := &ConsumerSnapshotReport{Name: name}
+	addErr := func(format string, args ...any) {
+		cr.Errors = append(cr.Errors, fmt.Sprintf(format, args...))
+	}
+	defer func() { cr.Valid = len(cr.Errors) == 0 }()
+
+	var ocfg FileConsumerInfo
+	buf, err := checkMetaFile(dir, stream+"/"+name)
+	if err == nil {
+		err = json.Unmarshal(buf, &ocfg)
+	}
+	if err != nil {
+		addErr("invalid consumer metadata: %v", err)
+		return cr
+	}
+
+	buf, err = os.ReadFile(filepath.Join(dir, consumerState))
+	if err != nil {
+		addErr("missing consumer state: %v", err)
+		return cr
+	}
+	state, err := decodeConsumerState(buf)
+	if err != nil {
+		addErr("invalid consumer state: %v", err)
+		return cr
+	}
+	cr.Delivered, cr.AckFloor, cr.Pending = state.Delivered.Stream, state.AckFloor.Stream, len(state.Pending)
+
+	if state.AckFloor.Stream > state.Delivered.Stream {
+		addErr("ack floor %d is ahead of delivered sequence %d", state.AckFloor.Stream, state.Delivered.Stream)
+	}
+	if state.Delivered.Stream > ss.LastSeq {
+		addErr("delivered sequence %d is ahead of stream's last sequence %d", state.Delivered.Stream, ss.LastSeq)
+	}
+	for seq := range state.Pending {
+		if seq <= state.AckFloor.Stream || seq > state.Delivered.Stream {
+			addErr("pending sequence %d is outside of ack floor %d and delivered sequence %d", seq, state.AckFloor.Stream, state.Delivered.Stream)
+			break
+		}
+	}
+	return cr
+}
+
 // This is to check for dangling messages on interest retention streams. Only called on account enable.
 // Issue https://github.com/nats-io/nats-server/issues/3612
 func (mset *stream) checkForOrphanMsgs() {
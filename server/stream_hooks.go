@@ -0,0 +1,224 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// How long to wait for the approver of a lifecycle hook when no timeout is configured.
+	defaultStreamHookTimeout = 2 * time.Second
+	// The longest the approver of a lifecycle hook may take.
+	maxStreamHookTimeout = 30 * time.Second
+)
+
+// The operations that lifecycle hooks are called for.
+const (
+	streamHookDelete   = "delete"
+	streamHookPurge    = "purge"
+	streamHookTruncate = "truncate"
+	streamHookUpdate   = "update"
+)
+
+// StreamHooks has the destructive operations on a stream approved by a service first.
+// An approval request is sent to the subject of the operation, and the operation only
+// proceeds if the approver replies in time. A reply with a Nats-Service-Error header
+// rejects the operation, with the value of the header as the reason.
+type StreamHooks struct {
+	// Delete is the subject that approves deleting the stream.
+	Delete string `json:"delete,omitempty"`
+	// Purge is the subject that approves purging or truncating the stream.
+	Purge string `json:"purge,omitempty"`
+	// Update is the subject that approves updates that remove subjects from the stream or change its hooks.
+	Update string `json:"update,omitempty"`
+	// Timeout is how long to wait for the approval, defaults to two seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// JSStreamHookRequest is sent to the approver of a lifecycle hook.
+type JSStreamHookRequest struct {
+	TypedEvent
+	Stream    string          `json:"stream"`
+	Operation string          `json:"operation"`
+	Client    *ClientInfo     `json:"client,omitempty"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	// RemovedSubjects are the subjects an update removes from the stream.
+	RemovedSubjects []string `json:"removed_subjects,omitempty"`
+}
+
+const JSStreamHookRequestType = "io.nats.jetstream.hook.v1.stream_request"
+
+func (sh *StreamHooks) validate(cfg *StreamConfig) error {
+	if sh.Delete == _EMPTY_ && sh.Purge == _EMPTY_ && sh.Update == _EMPTY_ {
+		return errors.New("lifecycle hooks need at least one subject")
+	}
+	for _, subj := range []string{sh.Delete, sh.Purge, sh.Update} {
+		if subj == _EMPTY_ {
+			continue
+		}
+		if !IsValidLiteralSubject(subj) {
+			return fmt.Errorf("lifecycle hook subject %q is not a valid literal subject", subj)
+		}
+		// The requests would otherwise be stored by the stream itself.
+		for _, ssubj := range cfg.Subjects {
+			if subjectIsSubsetMatch(subj, ssubj) {
+				return fmt.Errorf("lifecycle hook subject %q overlaps stream subject %q", subj, ssubj)
+			}
+		}
+	}
+	if sh.Timeout < 0 || sh.Timeout > maxStreamHookTimeout {
+		return fmt.Errorf("lifecycle hook timeout must be between 0 and %v", maxStreamHookTimeout)
+	}
+	return nil
+}
+
+// Returns the subject that approves the operation, if any.
+func (sh *StreamHooks) subject(op string) string {
+	if sh == nil {
+		return _EMPTY_
+	}
+	switch op {
+	case streamHookDelete:
+		return sh.Delete
+	case streamHookPurge, streamHookTruncate:
+		return sh.Purge
+	case streamHookUpdate:
+		return sh.Update
+	}
+	return _EMPTY_
+}
+
+// Returns the subjects of the old configuration that are not in the new one.
+func removedStreamSubjects(ocfg, ncfg *StreamConfig) []string {
+	var removed []string
+	for _, osubj := range ocfg.Subjects {
+		var found bool
+		for _, nsubj := range ncfg.Subjects {
+			if subjectIsSubsetMatch(osubj, nsubj) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, osubj)
+		}
+	}
+	return removed
+}
+
+// Returns the configuration of a stream, from its assignment when clustered.
+func (s *Server) streamConfigForHooks(acc *Account, stream string) *StreamConfig {
+	if s.JetStreamIsClustered() {
+		js := s.getJetStream()
+		if js == nil {
+			return nil
+		}
+		js.mu.RLock()
+		defer js.mu.RUnlock()
+		if sa := js.streamAssignment(acc.Name, stream); sa != nil && sa.Config != nil {
+			return sa.Config.clone()
+		}
+		return nil
+	}
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return nil
+	}
+	cfg := mset.config()
+	return &cfg
+}
+
+// Has the lifecycle hook of the stream approve the operation before calling proceed.
+// Without a hook for the operation proceed is called in place, otherwise from a
+// Go routine once approved, so the caller is not blocked while waiting. When not
+// approved, reject is called with the error instead.
+// For updates ncfg is the new configuration, only updates removing subjects or changing
+// the hooks need approval.
+func (s *Server) approveStreamOp(ci *ClientInfo, acc *Account, stream, op string, req []byte, ncfg *StreamConfig, proceed func(), reject func(*ApiError)) {
+	cfg := s.streamConfigForHooks(acc, stream)
+	if cfg == nil || cfg.Hooks.subject(op) == _EMPTY_ {
+		proceed()
+		return
+	}
+	var removed []string
+	if op == streamHookUpdate {
+		if removed = removedStreamSubjects(cfg, ncfg); len(removed) == 0 && reflect.DeepEqual(cfg.Hooks, ncfg.Hooks) {
+			proceed()
+			return
+		}
+	}
+
+	hreq := &JSStreamHookRequest{
+		TypedEvent: TypedEvent{
+			Type: JSStreamHookRequestType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:          stream,
+		Operation:       op,
+		Client:          ci,
+		RemovedSubjects: removed,
+	}
+	if isJSONObjectOrArray(req) {
+		hreq.Request = json.RawMessage(copyBytes(req))
+	}
+	subj, timeout := cfg.Hooks.subject(op), cfg.Hooks.Timeout
+	if timeout <= 0 {
+		timeout = defaultStreamHookTimeout
+	}
+
+	// The replies only need the headers.
+	replies := make(chan []byte, 1)
+	inbox := syncSubject("$JS.HOOK")
+	sub, err := acc.subscribeInternal(inbox, func(_ *subscription, c *client, _ *Account, _, _ string, rmsg []byte) {
+		hdr, _ := c.msgParts(rmsg)
+		select {
+		// Copied into a non-nil slice, as a reply without headers still counts.
+		case replies <- append([]byte{}, hdr...):
+		default:
+		}
+	})
+	if err != nil {
+		reject(NewJSStreamHookTimeoutError(op))
+		return
+	}
+
+	go func() {
+		defer acc.unsubscribeInternal(sub)
+		s.sendInternalAccountMsgWithReply(acc, subj, inbox, nil, hreq, false)
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case hdr := <-replies:
+			// Services may set an error code header as well, which would hide the error itself.
+			hdr = removeHeaderIfPresent(hdr, JSValidationError+"-Code")
+			if reason := getHeader(JSValidationError, hdr); len(reason) > 0 {
+				reject(NewJSStreamHookRejectedError(errors.New(string(reason)), op))
+				return
+			}
+			proceed()
+		case <-timer.C:
+			reject(NewJSStreamHookTimeoutError(op))
+		case <-s.quitCh:
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// StreamHotSubjects detects subjects that receive a disproportionate share of the
+// messages of a stream, and optionally caps the rate of messages per subject.
+// Traffic is measured by the stream leader over consecutive windows.
+type StreamHotSubjects struct {
+	// Threshold is the share of the messages in a window, e.g. 0.5, above which
+	// a subject is hot and an advisory is sent. Zero disables the advisories.
+	Threshold float64 `json:"threshold,omitempty"`
+	// Window is the period traffic is measured over, defaults to 10s.
+	Window time.Duration `json:"window,omitempty"`
+	// MinMsgs is how many messages a window needs before subjects can be hot, defaults to 100.
+	MinMsgs uint64 `json:"min_msgs,omitempty"`
+	// MaxRate caps the messages per second of each subject, zero for no cap.
+	MaxRate uint64 `json:"max_rate,omitempty"`
+}
+
+const (
+	defaultHotSubjectsWindow  = 10 * time.Second
+	defaultHotSubjectsMinMsgs = 100
+)
+
+func (hs *StreamHotSubjects) validate() error {
+	if hs.Threshold < 0 || hs.Threshold > 1 {
+		return errors.New("threshold must be between 0 and 1")
+	}
+	if hs.Window < 0 {
+		return errors.New("window can not be negative")
+	}
+	if hs.Window > 0 && hs.Window < time.Second {
+		return errors.New("window must be at least 1s")
+	}
+	if hs.Threshold == 0 && hs.MaxRate == 0 {
+		return errors.New("threshold or max rate is required")
+	}
+	return nil
+}
+
+// hotSubjects tracks the traffic per subject of the current window.
+type hotSubjects struct {
+	mu      sync.Mutex
+	srv     *Server
+	acc     *Account
+	stream  string
+	cfg     StreamHotSubjects
+	start   time.Time
+	total   uint64
+	counts  map[string]uint64
+	advised map[string]struct{}
+}
+
+// Returns the tracking for the configuration, nil if there is none.
+func newHotSubjects(s *Server, acc *Account, stream string, cfg *StreamHotSubjects) *hotSubjects {
+	if cfg == nil {
+		return nil
+	}
+	hs := &hotSubjects{srv: s, acc: acc, stream: stream, cfg: *cfg}
+	if hs.cfg.Window == 0 {
+		hs.cfg.Window = defaultHotSubjectsWindow
+	}
+	if hs.cfg.MinMsgs == 0 {
+		hs.cfg.MinMsgs = defaultHotSubjectsMinMsgs
+	}
+	return hs
+}
+
+// Counts an inbound message for the subject and returns if it is over the rate cap.
+// Sends an advisory the first time in a window the subject is hot.
+func (hs *hotSubjects) track(subject string) bool {
+	hs.mu.Lock()
+	now := time.Now()
+	if now.Sub(hs.start) >= hs.cfg.Window {
+		hs.start, hs.total = now, 0
+		hs.counts = make(map[string]uint64)
+		hs.advised = nil
+	}
+	hs.total++
+	n := hs.counts[subject] + 1
+	hs.counts[subject] = n
+	total := hs.total
+
+	limited := hs.cfg.MaxRate > 0 && float64(n) > float64(hs.cfg.MaxRate)*hs.cfg.Window.Seconds()
+
+	var advise bool
+	if hs.cfg.Threshold > 0 && total >= hs.cfg.MinMsgs && float64(n)/float64(total) > hs.cfg.Threshold {
+		if _, ok := hs.advised[subject]; !ok {
+			if hs.advised == nil {
+				hs.advised = make(map[string]struct{})
+			}
+			hs.advised[subject] = struct{}{}
+			advise = true
+		}
+	}
+	hs.mu.Unlock()
+
+	if advise {
+		hs.srv.publishAdvisory(hs.acc, JSAdvisoryStreamHotSubjectPre+"."+hs.stream, &JSStreamHotSubjectAdvisory{
+			TypedEvent: TypedEvent{
+				Type: JSStreamHotSubjectAdvisoryType,
+				ID:   nuid.Next(),
+				Time: now.UTC(),
+			},
+			Stream:    hs.stream,
+			Subject:   subject,
+			Msgs:      n,
+			Total:     total,
+			Threshold: hs.cfg.Threshold,
+			Window:    hs.cfg.Window,
+			Domain:    hs.srv.getOpts().JetStreamDomain,
+		})
+	}
+	return limited
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+)
+
+// Sets the inactivity threshold of the stream, the stream is removed once
+// inactive for longer. Changing the threshold starts over tracking activity.
+// Lock should be held.
+func (mset *stream) setInactiveThreshold(thresh time.Duration) {
+	if mset.itmr != nil {
+		mset.itmr.Stop()
+		mset.itmr = nil
+	}
+	if thresh <= 0 {
+		return
+	}
+	mset.lact = time.Now()
+	mset.itmr = time.AfterFunc(thresh, mset.checkInactive)
+}
+
+// Returns when the consumer was last active, or now if it has interest.
+func (o *consumer) lastActivity() time.Time {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.isPushMode() && o.active {
+		return time.Now()
+	}
+	last := o.ldt
+	if o.lat.After(last) {
+		last = o.lat
+	}
+	if o.waiting != nil && o.waiting.last.After(last) {
+		last = o.waiting.last
+	}
+	return last
+}
+
+// Returns when the stream was last active, the latest of its last stored message,
+// the activity of its consumers, and when its inactivity threshold was set.
+func (mset *stream) lastActivity() time.Time {
+	mset.mu.RLock()
+	last, store := mset.lact, mset.store
+	mset.mu.RUnlock()
+
+	if store != nil {
+		var state StreamState
+		store.FastState(&state)
+		if state.LastTime.After(last) {
+			last = state.LastTime
+		}
+	}
+	for _, o := range mset.getConsumers() {
+		if lat := o.lastActivity(); lat.After(last) {
+			last = lat
+		}
+	}
+	return last
+}
+
+// Called by the inactivity timer, removes the stream if it was inactive for longer than
+// its threshold, otherwise checks again once the threshold would be reached.
+func (mset *stream) checkInactive() {
+	if mset.closed.Load() {
+		return
+	}
+	elapsed := time.Since(mset.lastActivity())
+
+	mset.mu.Lock()
+	thresh := mset.cfg.InactiveThreshold
+	if mset.itmr == nil || thresh <= 0 {
+		mset.mu.Unlock()
+		return
+	}
+	if elapsed < thresh {
+		mset.itmr.Reset(thresh - elapsed)
+		mset.mu.Unlock()
+		return
+	}
+	// Only the leader removes the stream, the replicas keep checking in case they take over.
+	if !mset.isLeader() {
+		mset.itmr.Reset(thresh)
+		mset.mu.Unlock()
+		return
+	}
+	// Keep checking, in case the removal does not go through.
+	mset.itmr.Reset(thresh)
+	s, acc, accName, name := mset.srv, mset.acc, mset.acc.Name, mset.cfg.Name
+	mset.mu.Unlock()
+
+	// Removing the stream may need to be approved by a lifecycle hook first, like any delete.
+	s.approveStreamOp(nil, acc, name, streamHookDelete, nil, nil, func() {
+		s.Noticef("Removing stream '%s > %s' after being inactive for %v", accName, name, elapsed.Round(time.Millisecond))
+
+		// If we are clustered forward a proposal to delete ourselves to the metacontroller leader.
+		if s.JetStreamIsClustered() {
+			js, cc := s.getJetStreamCluster()
+			if js == nil || cc == nil {
+				return
+			}
+			js.mu.RLock()
+			if sa := js.streamAssignment(accName, name); sa != nil && cc.meta != nil {
+				csa := *sa
+				csa.Reply = _EMPTY_
+				cc.meta.ForwardProposal(encodeDeleteStreamAssignment(&csa))
+			}
+			js.mu.RUnlock()
+			return
+		}
+		// This also sends the delete advisory.
+		mset.delete()
+	}, func(err *ApiError) {
+		s.Warnf("Not removing inactive stream '%s > %s': %v", accName, name, err)
+	})
+}
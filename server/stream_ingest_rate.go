@@ -0,0 +1,88 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// StreamIngestRate caps the rate at which a stream accepts published messages.
+// Messages over the rate are rejected, allowing bursts of up to a second's worth.
+type StreamIngestRate struct {
+	// Msgs is the most messages per second, zero for no cap.
+	Msgs uint64 `json:"msgs,omitempty"`
+	// Bytes is the most bytes of headers and payload per second, zero for no cap.
+	Bytes uint64 `json:"bytes,omitempty"`
+}
+
+func (ir *StreamIngestRate) validate() error {
+	if ir.Msgs == 0 && ir.Bytes == 0 {
+		return errors.New("max ingest rate requires msgs or bytes")
+	}
+	return nil
+}
+
+// ingestLimiter is a token bucket for the messages and bytes published to a stream.
+type ingestLimiter struct {
+	mu    sync.Mutex
+	rate  StreamIngestRate
+	msgs  float64
+	bytes float64
+	last  time.Time
+}
+
+// Returns the limiter for the configured rate, nil if there is none.
+func newIngestLimiter(rate *StreamIngestRate) *ingestLimiter {
+	if rate == nil {
+		return nil
+	}
+	return &ingestLimiter{
+		rate:  *rate,
+		msgs:  float64(rate.Msgs),
+		bytes: float64(rate.Bytes),
+		last:  time.Now(),
+	}
+}
+
+// allow returns if a message of the given size is within the rate, and if so takes it from the bucket.
+// A message larger than the bytes per second is allowed once the bucket is full.
+func (l *ingestLimiter) allow(size int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+
+	if l.rate.Msgs > 0 {
+		if l.msgs = min(l.msgs+elapsed*float64(l.rate.Msgs), float64(l.rate.Msgs)); l.msgs < 1 {
+			return false
+		}
+	}
+	if l.rate.Bytes > 0 {
+		capacity := float64(l.rate.Bytes)
+		if l.bytes = min(l.bytes+elapsed*capacity, capacity); l.bytes < float64(size) && l.bytes < capacity {
+			return false
+		}
+	}
+	if l.rate.Msgs > 0 {
+		l.msgs--
+	}
+	if l.rate.Bytes > 0 {
+		l.bytes -= float64(size)
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StreamPause stops a stream from accepting published messages, and optionally its consumers
+// from delivering messages, until the deadline or until the stream is resumed.
+type StreamPause struct {
+	// Until is the deadline of the pause, without one the stream stays paused until resumed.
+	Until *time.Time `json:"until,omitempty"`
+	// Consumers also pauses the delivery of the consumers of the stream.
+	Consumers bool `json:"consumers,omitempty"`
+}
+
+// Returns if the pause is in effect at the given time.
+func (p *StreamPause) active(now time.Time) bool {
+	return p != nil && (p.Until == nil || now.Before(*p.Until))
+}
+
+// Returns if the stream is paused and rejects published messages.
+func (mset *stream) isPaused() bool {
+	return mset.pause.Load().active(time.Now())
+}
+
+// Returns if the consumers of the stream are paused.
+func (mset *stream) consumersPaused() bool {
+	p := mset.pause.Load()
+	return p != nil && p.Consumers && p.active(time.Now())
+}
+
+// Sets the pause of the stream from its configuration.
+// Lock should be held.
+func (mset *stream) setPause(p *StreamPause) {
+	old := mset.pause.Swap(p)
+	if mset.pausetmr != nil {
+		mset.pausetmr.Stop()
+		mset.pausetmr = nil
+	}
+	now := time.Now()
+	// Consumers that were paused need to be kicked, otherwise they wait for a new message.
+	if old != nil && old.Consumers && !(p != nil && p.Consumers && p.active(now)) {
+		go mset.signalPausedConsumers()
+	}
+	if p != nil && p.Consumers && p.Until != nil && p.active(now) {
+		mset.pausetmr = time.AfterFunc(p.Until.Sub(now), mset.signalPausedConsumers)
+	}
+}
+
+// Kicks the consumers of the stream once their pause ended.
+func (mset *stream) signalPausedConsumers() {
+	for _, o := range mset.getConsumers() {
+		o.signalNewMessages()
+	}
+}
+
+// Request to pause a stream.
+func (s *Server) jsStreamPauseRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	s.jsStreamSetPause(c, subject, reply, rmsg, true)
+}
+
+// Request to resume a paused stream.
+func (s *Server) jsStreamResumeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	s.jsStreamSetPause(c, subject, reply, rmsg, false)
+}
+
+// Pauses or resumes a stream. The pause is part of the stream configuration,
+// so it is kept across restarts and leader changes.
+func (s *Server) jsStreamSetPause(c *client, subject, reply string, rmsg []byte, pause bool) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamPauseResponse{ApiResponse: ApiResponse{Type: JSApiStreamPauseResponseType}}
+
+	var p *StreamPause
+	if pause {
+		p = &StreamPause{}
+		if isJSONObjectOrArray(msg) {
+			if err := json.Unmarshal(msg, p); err != nil {
+				resp.Error = NewJSInvalidJSONError(err)
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+		}
+		// Make sure we always store the deadline in UTC.
+		if p.Until != nil {
+			until := p.Until.UTC()
+			p.Until = &until
+		}
+	}
+
+	// Determine if we should proceed here when we are in clustered mode.
+	isClustered := s.JetStreamIsClustered()
+	js, cc := s.getJetStreamCluster()
+	if isClustered {
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	if isClustered {
+		js.mu.RLock()
+		sa := js.streamAssignment(acc.Name, stream)
+		var nsa *streamAssignment
+		if sa != nil {
+			nsa = sa.copyGroup()
+		}
+		js.mu.RUnlock()
+		if nsa == nil {
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		ncfg := nsa.Config.clone()
+		ncfg.Pause = p
+		// Update asset version metadata due to updating pause/resume.
+		setStaticStreamMetadata(ncfg, nsa.Config)
+		nsa.Config = ncfg
+		// The stream leader does not respond, we do.
+		nsa.Subject, nsa.Reply, nsa.Client = _EMPTY_, _EMPTY_, ci
+		cc.meta.Propose(encodeUpdateStreamAssignment(nsa))
+
+		resp.setPause(p)
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	ncfg := mset.config()
+	ncfg.Pause = p
+	// Update asset version metadata due to updating pause/resume.
+	setStaticStreamMetadata(&ncfg, &ncfg)
+
+	if err := mset.update(&ncfg); err != nil {
+		resp.Error = NewJSStreamUpdateError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	resp.setPause(p)
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Sets the pause of the response, whether it is in effect and for how long.
+func (resp *JSApiStreamPauseResponse) setPause(p *StreamPause) {
+	now := time.Now()
+	resp.Pause = p
+	if resp.Paused = p.active(now); resp.Paused && p.Until != nil {
+		resp.PauseRemaining = p.Until.Sub(now)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// The limits a quota warning is sent for.
+const (
+	quotaMaxBytes uint8 = 1 << iota
+	quotaMaxMsgs
+)
+
+// Checks the usage of the stream against its quota warning threshold and warns the
+// system account once for each limit crossed. A limit is warned for again once the
+// usage dropped below the threshold in between.
+// Lock should not be held.
+func (mset *stream) checkQuotaWarning() {
+	mset.mu.Lock()
+	threshold := mset.cfg.QuotaWarning
+	if threshold <= 0 || !mset.isLeader() || mset.store == nil {
+		mset.mu.Unlock()
+		return
+	}
+	var state StreamState
+	mset.store.FastState(&state)
+
+	var advs []*JSStreamQuotaWarningAdvisory
+	check := func(limit uint8, name string, used uint64, max int64) {
+		if max <= 0 {
+			mset.qwarned &^= limit
+			return
+		}
+		if used*100 < uint64(max)*uint64(threshold) {
+			mset.qwarned &^= limit
+			return
+		}
+		if mset.qwarned&limit != 0 {
+			return
+		}
+		mset.qwarned |= limit
+		advs = append(advs, &JSStreamQuotaWarningAdvisory{
+			Limit: name,
+			Used:  used,
+			Max:   uint64(max),
+		})
+	}
+	check(quotaMaxBytes, "max_bytes", state.Bytes, mset.cfg.MaxBytes)
+	check(quotaMaxMsgs, "max_msgs", state.Msgs, mset.cfg.MaxMsgs)
+	s, accName, name := mset.srv, mset.acc.Name, mset.cfg.Name
+	mset.mu.Unlock()
+
+	for _, adv := range advs {
+		s.Warnf("JetStream stream '%s > %s' reached %d%% of its %s limit (%d of %d)",
+			accName, name, threshold, adv.Limit, adv.Used, adv.Max)
+		adv.TypedEvent = TypedEvent{
+			Type: JSStreamQuotaWarningAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		}
+		adv.Server = s.Name()
+		adv.Account = accName
+		adv.Stream = name
+		adv.Threshold = threshold
+		adv.Cluster = s.cachedClusterName()
+		adv.Domain = s.getOpts().JetStreamDomain
+		s.publishAdvisory(nil, JSAdvisoryStreamQuotaWarningPre+"."+accName+"."+name, adv)
+	}
+}
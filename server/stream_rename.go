@@ -0,0 +1,554 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/minio/highwayhash"
+)
+
+// streamRename is what the meta controller replicates to rename a stream.
+type streamRename struct {
+	Client  *ClientInfo `json:"client,omitempty"`
+	Stream  string      `json:"stream"`
+	Name    string      `json:"name"`
+	Subject string      `json:"subject"`
+	Reply   string      `json:"reply"`
+}
+
+func encodeStreamRename(sr *streamRename) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(renameStreamOp))
+	json.NewEncoder(&bb).Encode(sr)
+	return bb.Bytes()
+}
+
+func decodeStreamRename(buf []byte) (*streamRename, error) {
+	var sr streamRename
+	err := json.Unmarshal(buf, &sr)
+	return &sr, err
+}
+
+// Checks if the stream with the given configuration can be renamed to name.
+// The data of a stream is moved along, which is only possible for unencrypted
+// file storage that is not tiered, and streams owned by a template or sharded keep their names.
+func (s *Server) checkStreamRename(cfg *StreamConfig, name string) error {
+	if !isValidName(name) {
+		return errors.New("stream name is required and can not contain '.', '*', '>'")
+	}
+	if len(name) > JSMaxNameLen {
+		return fmt.Errorf("stream name is too long, maximum allowed is %d", JSMaxNameLen)
+	}
+	if name == cfg.Name {
+		return errors.New("stream already has this name")
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("only streams with file storage can be renamed")
+	}
+	if s.getOpts().JetStreamKey != _EMPTY_ {
+		return errors.New("encrypted streams can not be renamed")
+	}
+	if cfg.Template != _EMPTY_ {
+		return fmt.Errorf("stream is owned by template %q", cfg.Template)
+	}
+	if cfg.Sharding != nil {
+		return errors.New("shards of a sharded stream can not be renamed")
+	}
+	if cfg.Tiering != nil {
+		return errors.New("streams with tiered storage can not be renamed")
+	}
+	return nil
+}
+
+// Request to rename a stream. Streams that source from or mirror the
+// stream need to be updated to the new name separately.
+func (s *Server) jsStreamRenameRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamRenameResponse{ApiResponse: ApiResponse{Type: JSApiStreamRenameResponseType}}
+
+	// Determine if we should proceed here when we are in clustered mode.
+	isClustered := s.JetStreamIsClustered()
+	if isClustered {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamRenameRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	stream := streamNameFromSubject(subject)
+
+	if isClustered {
+		s.jsClusteredStreamRenameRequest(ci, acc, stream, req.Name, subject, reply, msg)
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	cfg := mset.config()
+	if err := s.checkStreamRename(&cfg, req.Name); err != nil {
+		resp.Error = NewJSStreamRenameError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if _, err := acc.lookupStream(req.Name); err == nil {
+		resp.Error = NewJSStreamNameExistError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if _, err := acc.renameStream(mset, req.Name); err != nil {
+		resp.Error = NewJSStreamRenameError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Name, resp.Success = req.Name, true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Proposes the rename of a stream to the meta group, the meta leader responds once applied.
+func (s *Server) jsClusteredStreamRenameRequest(ci *ClientInfo, acc *Account, stream, name, subject, reply string, rmsg []byte) {
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if cc.meta == nil {
+		return
+	}
+
+	var resp = JSApiStreamRenameResponse{ApiResponse: ApiResponse{Type: JSApiStreamRenameResponseType}}
+
+	osa := js.streamAssignment(acc.Name, stream)
+	if osa == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+	if err := s.checkStreamRename(osa.Config, name); err != nil {
+		resp.Error = NewJSStreamRenameError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+	if js.streamAssignment(acc.Name, name) != nil || cc.inflight[acc.Name][name] != nil {
+		resp.Error = NewJSStreamNameExistError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
+	sr := &streamRename{Client: ci, Stream: stream, Name: name, Subject: subject, Reply: reply}
+	if err := cc.meta.Propose(encodeStreamRename(sr)); err == nil {
+		// Reserve the new name until the rename is applied, so that concurrent
+		// requests for it are rejected. There is no group to re-use here.
+		if cc.inflight == nil {
+			cc.inflight = make(map[string]map[string]*inflightInfo)
+		}
+		streams, ok := cc.inflight[acc.Name]
+		if !ok {
+			streams = make(map[string]*inflightInfo)
+			cc.inflight[acc.Name] = streams
+		}
+		streams[name] = &inflightInfo{}
+	}
+}
+
+// Applies the rename of a stream from the meta group. The assignments of the stream
+// and its consumers move to the new name, and members rename their local copies.
+func (js *jetStream) processStreamRename(sr *streamRename, ru *recoveryUpdates) {
+	js.mu.Lock()
+	s, cc := js.srv, js.cluster
+	if s == nil || cc == nil || cc.meta == nil {
+		js.mu.Unlock()
+		return
+	}
+	accName := sr.Client.serviceAccount()
+	accStreams := cc.streams[accName]
+	osa := accStreams[sr.Stream]
+	// Remove the rename from the inflight proposals.
+	cc.removeInflightProposal(accName, sr.Name)
+	if osa == nil || accStreams[sr.Name] != nil {
+		// Checked when proposed, but the stream may have been removed or the name taken since.
+		isLeader := cc.isLeader()
+		js.mu.Unlock()
+		if isLeader && ru == nil && sr.Reply != _EMPTY_ {
+			var resp = JSApiStreamRenameResponse{ApiResponse: ApiResponse{Type: JSApiStreamRenameResponseType}}
+			if osa == nil {
+				resp.Error = NewJSStreamNotFoundError()
+			} else {
+				resp.Error = NewJSStreamNameExistError()
+			}
+			if acc, err := s.LookupAccount(accName); err == nil {
+				s.sendAPIErrResponse(sr.Client, acc, sr.Subject, sr.Reply, _EMPTY_, s.jsonResponse(&resp))
+			}
+		}
+		return
+	}
+
+	// The assignments are replaced, the old ones may still be referenced by the running stream and consumers.
+	nsa := *osa
+	nsa.Config = osa.Config.clone()
+	nsa.Config.Name = sr.Name
+	nsa.Subject, nsa.Reply, nsa.responded = _EMPTY_, _EMPTY_, true
+	nsa.consumers = make(map[string]*consumerAssignment, len(osa.consumers))
+	for name, ca := range osa.consumers {
+		nca := *ca
+		nca.Stream = sr.Name
+		nca.Subject, nca.Reply, nca.responded = _EMPTY_, _EMPTY_, true
+		nsa.consumers[name] = &nca
+	}
+	delete(accStreams, sr.Stream)
+	accStreams[sr.Name] = &nsa
+
+	// Pending updates from the meta recovery need to follow the rename as well.
+	if ru != nil {
+		okey, nkey := osa.recoveryKey(), nsa.recoveryKey()
+		if usa := ru.updateStreams[okey]; usa != nil {
+			delete(ru.updateStreams, okey)
+			usa.Config = usa.Config.clone()
+			usa.Config.Name = sr.Name
+			ru.updateStreams[nkey] = usa
+		}
+		for key, ca := range ru.updateConsumers {
+			if ca.Client.serviceAccount() == accName && ca.Stream == sr.Stream {
+				delete(ru.updateConsumers, key)
+				ca.Stream = sr.Name
+				ru.updateConsumers[ca.recoveryKey()] = ca
+			}
+		}
+	}
+
+	ourID := cc.meta.ID()
+	isMember, isReader := nsa.Group.isMember(ourID), nsa.Group.isReader(ourID)
+	isLeader := cc.isLeader()
+	js.mu.Unlock()
+
+	acc, err := s.LookupAccount(accName)
+	if err != nil {
+		s.Warnf("JetStream failed to lookup account while renaming stream '%s > %s': %v", accName, sr.Stream, err)
+		return
+	}
+
+	if isMember {
+		js.processClusterRenameStream(acc, sr.Stream, &nsa)
+	} else if isReader {
+		s.removeReadReplica(acc, sr.Stream)
+		js.processReadReplica(acc, &nsa)
+	}
+
+	// Recovery updates are only passed in while recovering.
+	if isLeader && ru == nil && sr.Reply != _EMPTY_ {
+		var resp = JSApiStreamRenameResponse{ApiResponse: ApiResponse{Type: JSApiStreamRenameResponseType}}
+		resp.Name, resp.Success = sr.Name, true
+		s.sendAPIResponse(sr.Client, acc, sr.Subject, sr.Reply, _EMPTY_, s.jsonResponse(resp))
+	}
+}
+
+// Renames our copy of a stream we are a member of, and has it rejoin its group under the new name.
+func (js *jetStream) processClusterRenameStream(acc *Account, oname string, nsa *streamAssignment) {
+	s := js.srv
+	_, jsa, err := acc.checkForJetStream()
+	if err != nil {
+		return
+	}
+	sdir := filepath.Join(jsa.storeDir, streamsDir)
+
+	if mset, _ := acc.lookupStream(oname); mset != nil {
+		if nmset, _ := acc.lookupStream(nsa.Config.Name); nmset != nil {
+			// We renamed before a restart and the replay of the meta group brought back the stream under
+			// its old name, without any data. Make sure to not snapshot its state into the groups.
+			for _, o := range mset.getConsumers() {
+				if n := o.raftNode(); n != nil {
+					n.Stop()
+				}
+			}
+			if n := mset.raftNode(); n != nil {
+				n.Stop()
+			}
+			mset.stop(false, false)
+			mset.monitorWg.Wait()
+			os.RemoveAll(filepath.Join(sdir, oname))
+		} else {
+			mset.stop(false, false)
+			mset.monitorWg.Wait()
+			if _, err := acc.moveStream(filepath.Join(sdir, oname), filepath.Join(sdir, nsa.Config.Name), _EMPTY_, oname, nsa.Config.Name); err != nil {
+				s.Warnf("JetStream failed to rename stream '%s > %s' to %q: %v", acc.Name, oname, nsa.Config.Name, err)
+				return
+			}
+		}
+	}
+
+	// The groups were stopped along with the stream, they will be started again.
+	js.mu.Lock()
+	nsa.Group.node = nil
+	consumers := make([]*consumerAssignment, 0, len(nsa.consumers))
+	for _, ca := range nsa.consumers {
+		if ca.Group != nil {
+			ca.Group.node = nil
+		}
+		consumers = append(consumers, ca)
+	}
+	js.mu.Unlock()
+
+	js.processClusterCreateStream(acc, nsa)
+	for _, ca := range consumers {
+		js.processConsumerAssignment(ca)
+	}
+}
+
+// Renames the stream on this server. The stream is stopped, its directory moved
+// and then recovered under the new name, along with its consumers.
+func (a *Account) renameStream(mset *stream, name string) (*stream, error) {
+	_, jsa, err := a.checkForJetStream()
+	if err != nil {
+		return nil, err
+	}
+	oname := mset.name()
+	sdir := filepath.Join(jsa.storeDir, streamsDir)
+	odir, ndir := filepath.Join(sdir, oname), filepath.Join(sdir, name)
+	if _, err := os.Stat(ndir); err == nil {
+		return nil, NewJSStreamNameExistError()
+	}
+
+	if err := mset.stop(false, false); err != nil {
+		return nil, err
+	}
+	jsa.mu.RLock()
+	oidir := jsa.streamIndexDir(oname)
+	jsa.mu.RUnlock()
+	return a.moveStream(odir, ndir, oidir, oname, name)
+}
+
+// Moves the directory of a stopped stream and recovers it under the new name.
+// On failure the stream is restored under its old name.
+func (a *Account) moveStream(odir, ndir, oidir, oname, name string) (*stream, error) {
+	if err := renameStreamDir(odir, ndir, oname, name); err != nil {
+		// Bring the stream back under its old name.
+		if _, rerr := a.recoverStreamFromDir(odir); rerr != nil {
+			a.srv.Warnf("JetStream failed to recover stream '%s > %s' after failed rename: %v", a.Name, oname, rerr)
+		}
+		return nil, err
+	}
+	mset, err := a.recoverStreamFromDir(ndir)
+	if err != nil {
+		// Move the directory back and bring the stream back under its old name.
+		if rerr := renameStreamDir(ndir, odir, name, oname); rerr != nil {
+			a.srv.Warnf("JetStream failed to restore stream '%s > %s' after failed rename: %v", a.Name, oname, rerr)
+		} else if _, rerr := a.recoverStreamFromDir(odir); rerr != nil {
+			a.srv.Warnf("JetStream failed to recover stream '%s > %s' after failed rename: %v", a.Name, oname, rerr)
+		}
+		return nil, err
+	}
+	// The index is rebuilt from the blocks, do not leave one behind under the old name.
+	if oidir != _EMPTY_ {
+		os.RemoveAll(oidir)
+	}
+	return mset, nil
+}
+
+// Recovers a stream and its consumers from its directory, like on startup.
+func (a *Account) recoverStreamFromDir(mdir string) (*stream, error) {
+	if err := finishStreamRename(mdir); err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(filepath.Join(mdir, JetStreamMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var cfg FileStreamInfo
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return nil, err
+	}
+	mset, err := a.addStream(&cfg.StreamConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Created.IsZero() {
+		mset.setCreatedTime(cfg.Created)
+	}
+	a.srv.recoverStreamConsumers(a, mset, filepath.Join(mdir, consumerDir))
+	return mset, nil
+}
+
+// Moves the directory of a stopped stream to the new name and rewrites its metadata.
+// The name the data was written under is kept, as the hashes of the data are keyed by it.
+// The metadata for the new name is written next to the current one before the directory
+// is moved and moved into place afterwards, see finishStreamRename.
+func renameStreamDir(odir, ndir, oname, name string) error {
+	if _, err := os.Stat(ndir); err == nil {
+		return fmt.Errorf("directory for stream %q already exists", name)
+	}
+	meta := filepath.Join(odir, JetStreamMetaFile)
+	buf, err := os.ReadFile(meta)
+	if err != nil {
+		return err
+	}
+	var cfg FileStreamInfo
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return err
+	}
+	cfg.Name = name
+	if buf, err = json.Marshal(cfg); err != nil {
+		return err
+	}
+	checksum, err := streamMetaChecksum(name, buf)
+	if err != nil {
+		return err
+	}
+
+	// Only the first rename records the name, later ones keep the original.
+	onfn := filepath.Join(odir, streamOrigNameFile)
+	if _, err := os.Stat(onfn); os.IsNotExist(err) {
+		if err := writeFileAtomic(onfn, []byte(oname)); err != nil {
+			return err
+		}
+	}
+	// The checksum goes first, the metadata marks the rename as pending.
+	nmeta, nsum := renameMetaFiles(odir)
+	if err := writeFileAtomic(nsum, []byte(checksum)); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(nmeta, buf); err != nil {
+		os.Remove(nsum)
+		return err
+	}
+	// The state file is checksummed with the name of the stream, it is rebuilt from the blocks.
+	os.Remove(filepath.Join(odir, msgDir, streamStreamStateFile))
+
+	if err := os.Rename(odir, ndir); err != nil {
+		os.Remove(nmeta)
+		os.Remove(nsum)
+		return err
+	}
+	return finishStreamRename(ndir)
+}
+
+// Suffix of the metadata files written for the new name of a stream being renamed.
+const renameMetaSuffix = ".new"
+
+// Returns the metadata and checksum files written for the new name of a stream being renamed.
+func renameMetaFiles(mdir string) (string, string) {
+	return filepath.Join(mdir, JetStreamMetaFile+renameMetaSuffix), filepath.Join(mdir, JetStreamMetaFileSum+renameMetaSuffix)
+}
+
+// Finishes a rename of the stream in this directory, which is also done on recovery in case the
+// server went down in the middle of one. The checksum of the metadata written for the new name is
+// keyed by that name, so it only matches once the directory was moved. Then the metadata is moved
+// into place, otherwise the directory was not moved and the metadata is removed.
+func finishStreamRename(mdir string) error {
+	nmeta, nsum := renameMetaFiles(mdir)
+	buf, err := os.ReadFile(nmeta)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// The checksum may have been moved into place already.
+	sum, err := os.ReadFile(nsum)
+	if os.IsNotExist(err) {
+		sum, err = os.ReadFile(filepath.Join(mdir, JetStreamMetaFileSum))
+	}
+	if err != nil {
+		return err
+	}
+	checksum, err := streamMetaChecksum(filepath.Base(mdir), buf)
+	if err != nil {
+		return err
+	}
+	if checksum != string(sum) {
+		os.Remove(nsum)
+		return os.Remove(nmeta)
+	}
+	if err := os.Rename(nsum, filepath.Join(mdir, JetStreamMetaFileSum)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(nmeta, filepath.Join(mdir, JetStreamMetaFile))
+}
+
+// Returns the checksum of the metadata of the stream with the given name.
+func streamMetaChecksum(name string, buf []byte) (string, error) {
+	key := sha256.Sum256([]byte(name))
+	hh, err := highwayhash.New64(key[:])
+	if err != nil {
+		return _EMPTY_, err
+	}
+	hh.Write(buf)
+	return hex.EncodeToString(hh.Sum(nil)), nil
+}
+
+// Writes the file under a temporary name first and then moves it into place.
+func writeFileAtomic(fn string, buf []byte) error {
+	tmp := fn + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFilePerms)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, fn)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Returns the configurations of the consumers of the stream by name,
+// from the assignments when clustered.
+func (mset *stream) consumerConfigs() map[string]*ConsumerConfig {
+	clustered := mset.js.isClustered()
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	consumers := map[string]*ConsumerConfig{}
+	if clustered && mset.sa != nil {
+		for _, c := range mset.sa.consumers {
+			consumers[c.Name] = c.Config
+		}
+	} else {
+		for _, c := range mset.consumers {
+			consumers[c.name] = &c.cfg
+		}
+	}
+	return consumers
+}
+
+// Checks the consumers of a stream allow changing to the retention policy of cfg.
+// Interest and WorkQueue retention need the consumers to be replicated like the stream,
+// and WorkQueue retention also needs explicit acks and consumers that do not overlap.
+func checkRetentionMigration(cfg *StreamConfig, consumers map[string]*ConsumerConfig) error {
+	// Sorted for consistent errors.
+	names := make([]string, 0, len(consumers))
+	for name := range consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	filters := make(map[string][]string, len(consumers))
+	for _, name := range names {
+		ccfg := consumers[name]
+		if ccfg == nil || ccfg.Direct {
+			continue
+		}
+		if cfg.Retention != WorkQueuePolicy {
+			if ccfg.Shared {
+				return fmt.Errorf("consumer %q is shared, which requires workqueue retention", name)
+			}
+			if ccfg.DeliverOrder == DeliverOrderLIFO || ccfg.DeliverOrder == DeliverOrderHeader {
+				return fmt.Errorf("consumer %q delivery order requires workqueue retention", name)
+			}
+		}
+		if cfg.Retention == LimitsPolicy {
+			continue
+		}
+		if ccfg.Replicas > 0 && ccfg.Replicas != cfg.Replicas {
+			return fmt.Errorf("consumer %q replica count must be %d", name, cfg.Replicas)
+		}
+		if cfg.Retention != WorkQueuePolicy {
+			continue
+		}
+		if ccfg.AckPolicy != AckExplicit {
+			return fmt.Errorf("consumer %q needs explicit acks for workqueue retention", name)
+		}
+		subjects := gatherSubjectFilters(ccfg.FilterSubject, ccfg.FilterSubjects)
+		if len(subjects) == 0 {
+			subjects = []string{fwcs}
+		}
+		for oname, osubjects := range filters {
+			for _, subj := range subjects {
+				for _, osubj := range osubjects {
+					if SubjectsCollide(subj, osubj) {
+						return fmt.Errorf("consumers %q and %q overlap, which is not allowed for workqueue retention", oname, name)
+					}
+				}
+			}
+		}
+		filters[name] = subjects
+	}
+	return nil
+}
+
+// Moves the consumers of the stream to a changed retention policy. With Interest or WorkQueue
+// retention the messages the consumers acknowledged already are removed, which is reported
+// in an advisory.
+func (mset *stream) migrateRetention(from, to RetentionPolicy) {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	var before StreamState
+	store.FastState(&before)
+
+	consumers := mset.getConsumers()
+	for _, o := range consumers {
+		o.mu.Lock()
+		o.retention = to
+		// Interest is checked from the first message again.
+		o.chkflr = 0
+		o.mu.Unlock()
+	}
+	if to != LimitsPolicy {
+		for _, o := range consumers {
+			o.checkStateForInterestStream(&before)
+		}
+	}
+
+	var after StreamState
+	store.FastState(&after)
+
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if !mset.isLeader() || mset.outq == nil {
+		return
+	}
+	m := JSStreamRetentionMigratedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamRetentionMigratedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   mset.cfg.Name,
+		From:     from,
+		To:       to,
+		FirstSeq: after.FirstSeq,
+		Domain:   mset.srv.getOpts().JetStreamDomain,
+	}
+	if after.Msgs < before.Msgs {
+		m.RemovedMsgs = before.Msgs - after.Msgs
+	}
+	if after.Bytes < before.Bytes {
+		m.RemovedBytes = before.Bytes - after.Bytes
+	}
+	j, err := json.Marshal(m)
+	if err == nil {
+		subj := JSAdvisoryStreamRetentionMigratedPre + "." + mset.cfg.Name
+		mset.outq.sendMsg(subj, j)
+	}
+}
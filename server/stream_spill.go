@@ -0,0 +1,171 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Directory in the account store directory holding the file stores of memory
+// streams that spilled over to disk. These are never recovered, like memory streams.
+const spillDir = "__spill__"
+
+// Checks the spill setting of a stream.
+func validateSpillToDisk(cfg *StreamConfig) error {
+	if cfg.SpillToDisk && cfg.Storage != MemoryStorage {
+		return errors.New("spill to disk requires memory storage")
+	}
+	return nil
+}
+
+// Returns true if this memory stream can still spill over to disk.
+// Lock should be held.
+func (mset *stream) canSpill() bool {
+	return mset.cfg.SpillToDisk && !mset.spilled.Load() && !mset.spilling && mset.stype == MemoryStorage && mset.jsa != nil
+}
+
+// Returns true if storing this message would exceed the memory limits of the server or
+// the account and the stream should spill over to disk instead of rejecting it.
+// Lock should be held.
+func (mset *stream) shouldSpill(subj string, hdr, msg []byte) bool {
+	if !mset.canSpill() {
+		return false
+	}
+	if mset.js.limitsExceeded(MemoryStorage) {
+		return true
+	}
+	exceeded, _ := mset.jsa.wouldExceedLimits(MemoryStorage, mset.tier, mset.cfg.Replicas, subj, hdr, msg)
+	return exceeded
+}
+
+// Starts spilling this memory stream over to disk in the background.
+// Messages that do not fit in memory in the meantime are rejected as before.
+// Lock should be held.
+func (mset *stream) startSpill() {
+	mset.spilling = true
+	go func() {
+		s, accName, name := mset.srv, mset.accName(), mset.name()
+		if err := mset.spillToDisk(); err != nil {
+			s.Warnf("JetStream stream '%s > %s' could not spill to disk: %v", accName, name, err)
+		} else {
+			s.Noticef("JetStream stream '%s > %s' reached its memory limits and spilled to disk", accName, name)
+		}
+		mset.mu.Lock()
+		mset.spilling = false
+		mset.mu.Unlock()
+	}()
+}
+
+// Moves the messages of this memory stream to a file store in the spill directory, which
+// from then on holds the stream and is accounted as file storage. The cache of the file store
+// keeps the most recently written and read messages in memory.
+// The file storage is reserved first and the messages are copied without holding the stream lock.
+// The stream stays a memory stream, so the file store is removed once the stream stops.
+// Lock should not be held.
+func (mset *stream) spillToDisk() error {
+	mset.mu.RLock()
+	js, jsa, closed := mset.js, mset.jsa, mset.closed.Load()
+	mcfg := mset.cfg.clone()
+	var state StreamState
+	if mset.store != nil {
+		mset.store.FastState(&state)
+	}
+	mset.mu.RUnlock()
+	if closed {
+		return errStreamClosed
+	}
+
+	cfg := mcfg.clone()
+	cfg.Storage = FileStorage
+	if err := mset.reserveSpill(cfg, int64(state.Bytes)); err != nil {
+		return err
+	}
+	js.reserveStreamResources(cfg)
+
+	dir := filepath.Join(jsa.storeDir, spillDir, cfg.Name)
+	// Anything left behind is from an earlier run.
+	os.RemoveAll(dir)
+
+	mset.mu.Lock()
+	sc, err := mset.newStoreConversion(cfg, dir, _EMPTY_)
+	mset.mu.Unlock()
+	if err == nil {
+		if err = sc.copy(); err == nil {
+			mset.mu.Lock()
+			if mset.closed.Load() {
+				err = errStreamClosed
+			} else if err = sc.finish(); err == nil {
+				mset.spilled.Store(true)
+			}
+			mset.mu.Unlock()
+		}
+		if err != nil {
+			sc.abort()
+		}
+	}
+	if err != nil {
+		js.releaseStreamResources(cfg)
+		os.RemoveAll(dir)
+		return err
+	}
+	// Our reservation moved over to file storage.
+	js.releaseStreamResources(mcfg)
+	return nil
+}
+
+// Checks the account and the server have room for the file storage a spill over needs,
+// which is MaxBytes of the stream if set, what it holds otherwise.
+// Lock should not be held.
+func (mset *stream) reserveSpill(cfg *StreamConfig, size int64) error {
+	js, jsa := mset.js, mset.jsa
+	if cfg.MaxBytes > size {
+		size = cfg.MaxBytes
+	}
+	jsa.usageMu.RLock()
+	selected, tier, ok := jsa.selectLimits(cfg.Replicas)
+	var inUse int64
+	if usage := jsa.usage[tier]; usage != nil {
+		inUse = usage.total.store
+	}
+	jsa.usageMu.RUnlock()
+	if !ok {
+		return NewJSNoLimitsError()
+	}
+	js.mu.RLock()
+	err := js.checkBytesLimits(&selected, size, FileStorage, true, inUse, 0)
+	if err == nil && atomic.LoadInt64(&js.storeUsed)+size > js.config.MaxStore {
+		err = NewJSStorageResourcesExceededError()
+	}
+	js.mu.RUnlock()
+	return err
+}
+
+// Returns the configuration to hand to our store and to account our reservation against,
+// which is file storage once spilled.
+func (mset *stream) storeConfig(cfg *StreamConfig) *StreamConfig {
+	if !mset.spilled.Load() {
+		return cfg
+	}
+	scfg := cfg.clone()
+	scfg.Storage = FileStorage
+	return scfg
+}
+
+// Returns true if this memory stream spilled over to disk.
+func (mset *stream) isSpilled() bool {
+	return mset.spilled.Load()
+}
@@ -0,0 +1,409 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errStreamTruncateMirror = errors.New("mirrors can not be truncated")
+	errStreamTruncateMoved  = errors.New("stream moved on while truncating")
+)
+
+// streamTruncate is what the stream leader replicates to truncate a stream.
+type streamTruncate struct {
+	Client *ClientInfo `json:"client,omitempty"`
+	Stream string      `json:"stream"`
+	Seq    uint64      `json:"seq"`
+	// Last is the sequence the leader expected the stream at, including failed proposals.
+	Last uint64 `json:"last"`
+	// Time is when the leader proposed the truncate.
+	Time    int64  `json:"ts"`
+	Subject string `json:"subject"`
+	Reply   string `json:"reply"`
+}
+
+func encodeStreamTruncate(st *streamTruncate) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(truncateStreamOp))
+	json.NewEncoder(&bb).Encode(st)
+	return bb.Bytes()
+}
+
+func decodeStreamTruncate(buf []byte) (*streamTruncate, error) {
+	var st streamTruncate
+	err := json.Unmarshal(buf, &st)
+	return &st, err
+}
+
+// Removes all messages after seq and resets the last sequence to it, so the next
+// message stored is seq+1. Consumers that were past seq are moved back, and the
+// message ids of the removed messages can be used again. Returns the number of
+// messages removed.
+func (mset *stream) truncate(seq uint64) (uint64, error) {
+	mset.mu.Lock()
+	if mset.closed.Load() {
+		mset.mu.Unlock()
+		return 0, errStreamClosed
+	}
+	if mset.cfg.Sealed {
+		mset.mu.Unlock()
+		return 0, errStreamSealed
+	}
+	if mset.cfg.DenyPurge {
+		mset.mu.Unlock()
+		return 0, errStreamDenyPurge
+	}
+	// Mirrors keep the sequences of their origin.
+	if mset.cfg.Mirror != nil {
+		mset.mu.Unlock()
+		return 0, errStreamTruncateMirror
+	}
+	var state StreamState
+	mset.store.FastState(&state)
+	if seq >= state.LastSeq {
+		mset.mu.Unlock()
+		return 0, nil
+	}
+	if seq < state.FirstSeq {
+		mset.mu.Unlock()
+		return 0, fmt.Errorf("sequence %d is before the first sequence %d, purge the stream instead", seq, state.FirstSeq)
+	}
+	if err := mset.store.Truncate(seq); err != nil {
+		mset.mu.Unlock()
+		return 0, err
+	}
+	var nstate StreamState
+	mset.store.FastState(&nstate)
+	mset.lseq = nstate.LastSeq
+	mset.truncateMsgIds(seq)
+	mset.mu.Unlock()
+
+	mset.clsMu.RLock()
+	for _, o := range mset.cList {
+		o.truncate(seq)
+	}
+	mset.clsMu.RUnlock()
+
+	return state.Msgs - nstate.Msgs, nil
+}
+
+// Forgets the message ids of the messages after seq, so they can be published again.
+// Lock should be held.
+func (mset *stream) truncateMsgIds(seq uint64) {
+	if len(mset.ddmap) == 0 {
+		return
+	}
+	var ddarr []*ddentry
+	for _, dde := range mset.ddarr[mset.ddindex:] {
+		if dde.seq > seq {
+			if mset.ddmap[dde.id] == dde {
+				delete(mset.ddmap, dde.id)
+			}
+			continue
+		}
+		ddarr = append(ddarr, dde)
+	}
+	mset.ddarr, mset.ddindex = ddarr, 0
+}
+
+// Moves the consumer back after its stream was truncated to seq,
+// forgetting the pending messages that were removed. The stored state is
+// reset since it moves backwards, and replicated to our followers.
+func (o *consumer) truncate(seq uint64) {
+	// Do not update our state unless we know we are the leader.
+	if !o.isLeader() {
+		return
+	}
+	o.mu.Lock()
+	if o.sseq <= seq+1 {
+		o.mu.Unlock()
+		return
+	}
+	o.sseq = seq + 1
+	for sseq := range o.pending {
+		if sseq > seq {
+			delete(o.pending, sseq)
+			delete(o.rdc, sseq)
+		}
+	}
+	if len(o.rdq) > 0 {
+		rdq := o.rdq
+		o.rdq = nil
+		o.rdqi.Empty()
+		for _, sseq := range rdq {
+			if sseq <= seq {
+				o.addToRedeliverQueue(sseq)
+			}
+		}
+	}
+	if o.asflr > seq {
+		o.asflr = seq
+	}
+	if len(o.pending) == 0 {
+		o.pending, o.rdc = nil, nil
+		o.adflr, o.asflr = o.dseq-1, o.sseq-1
+	}
+	if o.store == nil {
+		o.mu.Unlock()
+		return
+	}
+	state := &ConsumerState{
+		Delivered: SequencePair{
+			Consumer: o.dseq - 1,
+			Stream:   o.sseq - 1,
+		},
+		AckFloor: SequencePair{
+			Consumer: o.adflr,
+			Stream:   o.asflr,
+		},
+		Pending:     o.pending,
+		Redelivered: o.rdc,
+	}
+	err := o.store.Reset(state)
+	// Have our followers do the same.
+	if err == nil && o.node != nil {
+		o.propose(append([]byte{byte(resetConsumerStateOp)}, encodeConsumerState(state)...))
+	}
+	s, acc, mset, name := o.srv, o.acc, o.mset, o.name
+	o.mu.Unlock()
+
+	if err != nil && s != nil && mset != nil {
+		s.Warnf("Consumer '%s > %s > %s' error on reset store state from truncate: %v", acc, mset.name(), name, err)
+	}
+}
+
+// Request to truncate a stream, removing all messages after a sequence.
+func (s *Server) jsStreamTruncateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamTruncateResponse{ApiResponse: ApiResponse{Type: JSApiStreamTruncateResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			}
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			}
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamTruncateRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Sequence == 0 {
+		resp.Error = NewJSStreamTruncateError(errors.New("sequence is required, purge the stream to remove all messages"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	cfg := mset.config()
+	if cfg.Sealed {
+		resp.Error = NewJSStreamSealedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if cfg.DenyPurge {
+		resp.Error = NewJSStreamTruncateError(errStreamDenyPurge)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if cfg.Mirror != nil {
+		resp.Error = NewJSStreamTruncateError(errStreamTruncateMirror)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Truncating may need to be approved by a lifecycle hook first.
+	msg, rmsg = copyBytes(msg), copyBytes(rmsg)
+	s.approveStreamOp(ci, acc, stream, streamHookTruncate, msg, nil, func() {
+		if s.JetStreamIsClustered() {
+			s.jsClusteredStreamTruncateRequest(ci, acc, mset, stream, subject, reply, rmsg, req.Sequence)
+			return
+		}
+		removed, err := mset.truncate(req.Sequence)
+		if err != nil {
+			resp.Error = NewJSStreamTruncateError(err, Unless(err))
+		} else {
+			resp.Removed = removed
+			resp.Success = true
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	}, func(apiErr *ApiError) {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// Proposes the truncate to the group of the stream, the stream leader responds once applied.
+func (s *Server) jsClusteredStreamTruncateRequest(ci *ClientInfo, acc *Account, mset *stream, stream, subject, reply string, rmsg []byte, seq uint64) {
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+
+	var resp = JSApiStreamTruncateResponse{ApiResponse: ApiResponse{Type: JSApiStreamTruncateResponseType}}
+
+	js.mu.RLock()
+	var n RaftNode
+	if sa := js.streamAssignment(acc.Name, stream); sa != nil && sa.Group != nil {
+		n = sa.Group.node
+	}
+	js.mu.RUnlock()
+	if n == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Hold off messages being proposed while stamping where the stream is expected at,
+	// which includes the messages proposed but not applied yet.
+	mset.clMu.Lock()
+	last := mset.lastSeq() + mset.clfs
+	if mset.clseq > last {
+		last = mset.clseq
+	}
+	st := &streamTruncate{Client: ci, Stream: stream, Seq: seq, Last: last, Time: time.Now().UnixNano(), Subject: subject, Reply: reply}
+	err := n.Propose(encodeStreamTruncate(st))
+	mset.clMu.Unlock()
+
+	if err != nil {
+		resp.Error = NewJSStreamTruncateError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+	}
+}
+
+// Applies a replicated truncate. The sequences it removes are accounted as failed proposals,
+// so the sequences the leader expects for the messages proposed after it still line up.
+func (mset *stream) applyStreamTruncate(buf []byte, isRecovering bool) {
+	s := mset.srv
+	st, err := decodeStreamTruncate(buf)
+	if err != nil {
+		if node := mset.raftNode(); node != nil {
+			s.Errorf("JetStream cluster could not decode truncate msg for '%s > %s' [%s]",
+				mset.account(), mset.name(), node.Group())
+		}
+		panic(err.Error())
+	}
+
+	last, clfs := mset.lastSeqAndCLFS()
+	// When replaying, the stream may have been truncated and moved on already.
+	applied := isRecovering && (last == st.Seq || last > st.Seq && mset.storedSince(st.Seq+1, st.Time))
+
+	var removed uint64
+	if !applied {
+		if last+clfs != st.Last {
+			err = errStreamTruncateMoved
+		} else {
+			removed, err = mset.truncate(st.Seq)
+		}
+	}
+	if err == nil && st.Seq <= last && st.Last > st.Seq {
+		mset.setCLFS(st.Last - st.Seq)
+	}
+	if err != nil {
+		s.Warnf("JetStream cluster failed to truncate stream '%s > %s': %v", mset.account(), mset.name(), err)
+	}
+
+	if isRecovering || !mset.IsLeader() {
+		return
+	}
+	var resp = JSApiStreamTruncateResponse{ApiResponse: ApiResponse{Type: JSApiStreamTruncateResponseType}}
+	if err != nil {
+		resp.Error = NewJSStreamTruncateError(err, Unless(err))
+		s.sendAPIErrResponse(st.Client, mset.account(), st.Subject, st.Reply, _EMPTY_, s.jsonResponse(resp))
+	} else {
+		resp.Removed = removed
+		resp.Success = true
+		s.sendAPIResponse(st.Client, mset.account(), st.Subject, st.Reply, _EMPTY_, s.jsonResponse(resp))
+	}
+}
+
+// Returns if the first message from seq on was stored at or after ts.
+func (mset *stream) storedSince(seq uint64, ts int64) bool {
+	var smv StoreMsg
+	sm, _, err := mset.store.LoadNextMsg(fwcs, true, seq, &smv)
+	return err == nil && sm.ts >= ts
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// How long the stream waits for the validator when no timeout is configured.
+	defaultValidationTimeout = time.Second
+	// The longest the stream may wait for the validator, messages queue up behind the wait.
+	maxValidationTimeout = 10 * time.Second
+)
+
+// A validator rejects a message by setting this header in its reply, with the
+// reason as its value. This is the header NATS services use to return errors.
+const JSValidationError = "Nats-Service-Error"
+
+// StreamValidation has the stream send published messages to a validator service
+// before they are stored. The request carries the headers of the message with the
+// stream and subject added as Nats-Stream and Nats-Subject. Any reply accepts the
+// message, unless it has a Nats-Service-Error header in which case it is rejected.
+type StreamValidation struct {
+	// Subject the validation requests are sent to.
+	Subject string `json:"subject"`
+	// Timeout is how long to wait for the reply, defaults to a second.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// HeadersOnly sends the headers without the payload, with its size as Nats-Msg-Size.
+	HeadersOnly bool `json:"headers_only,omitempty"`
+	// Bypass stores messages the validator did not reply to in time instead of rejecting them.
+	Bypass bool `json:"bypass,omitempty"`
+}
+
+func (sv *StreamValidation) validate(cfg *StreamConfig) error {
+	if cfg.Mirror != nil {
+		return errors.New("validation not allowed on a mirror")
+	}
+	if !IsValidLiteralSubject(sv.Subject) {
+		return fmt.Errorf("validation subject %q is not a valid literal subject", sv.Subject)
+	}
+	// The requests would otherwise be stored by the stream itself.
+	for _, subj := range cfg.Subjects {
+		if subjectIsSubsetMatch(sv.Subject, subj) {
+			return fmt.Errorf("validation subject %q overlaps stream subject %q", sv.Subject, subj)
+		}
+	}
+	if sv.Timeout < 0 || sv.Timeout > maxValidationTimeout {
+		return fmt.Errorf("validation timeout must be between 0 and %v", maxValidationTimeout)
+	}
+	return nil
+}
+
+// streamValidator sends the requests of a stream to its validator and matches up the replies.
+type streamValidator struct {
+	mu      sync.Mutex
+	cfg     StreamValidation
+	sub     *subscription
+	pre     string // Prefix of the reply subjects.
+	seq     uint64
+	pending map[string]validationReply // Where the replies go, by reply token.
+	batches []*validationBatch         // Batches waiting for replies, in the order they were sent.
+}
+
+// validationBatch is a batch of inbound messages waiting for the replies of the validator.
+type validationBatch struct {
+	ims     []*inMsg
+	errs    []*ApiError // The error to reject each message with, nil if it may be stored.
+	tokens  []string    // The reply tokens, empty for messages that are not validated.
+	left    int         // The number of replies still expected.
+	timer   *time.Timer
+	done    bool
+	release func(*validationBatch) // Hands on the batch once done.
+}
+
+// validationReply is the message of a batch a reply is for.
+type validationReply struct {
+	b *validationBatch
+	i int
+}
+
+// Returns the validator for the configuration, nil if there is none.
+func newStreamValidator(cfg *StreamValidation) *streamValidator {
+	if cfg == nil {
+		return nil
+	}
+	return &streamValidator{
+		cfg:     *cfg,
+		pre:     syncSubject("$JS.V") + ".",
+		pending: make(map[string]validationReply),
+	}
+}
+
+// Returns how long to wait for replies.
+func (sv *streamValidator) timeout() time.Duration {
+	if sv.cfg.Timeout > 0 {
+		return sv.cfg.Timeout
+	}
+	return defaultValidationTimeout
+}
+
+// Subscribes for the replies unless already subscribed.
+func (sv *streamValidator) subscribe(mset *stream) error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if sv.sub != nil {
+		return nil
+	}
+	sub, err := mset.subscribeInternal(sv.pre+"*", sv.processReply)
+	if err != nil {
+		return err
+	}
+	sv.sub = sub
+	return nil
+}
+
+// Unsubscribes from the replies once the validator is replaced or removed.
+// Batches still waiting time out.
+func (sv *streamValidator) close(mset *stream) {
+	if sv == nil {
+		return
+	}
+	sv.mu.Lock()
+	sub := sv.sub
+	sv.sub = nil
+	sv.mu.Unlock()
+	mset.unsubscribe(sub)
+}
+
+// Takes the verdict of a reply for the message it belongs to.
+func (sv *streamValidator) processReply(_ *subscription, c *client, _ *Account, subject, _ string, rmsg []byte) {
+	if len(subject) <= len(sv.pre) {
+		return
+	}
+	hdr, _ := c.msgParts(rmsg)
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	token := subject[len(sv.pre):]
+	r, ok := sv.pending[token]
+	if !ok {
+		return
+	}
+	delete(sv.pending, token)
+	// Services may set an error code header as well, which would hide the error itself.
+	hdr = removeHeaderIfPresent(copyBytes(hdr), JSValidationError+"-Code")
+	if reason := getHeader(JSValidationError, hdr); len(reason) > 0 {
+		r.b.errs[r.i] = NewJSStreamValidationRejectedError(errors.New(string(reason)))
+	}
+	if r.b.left--; r.b.left == 0 {
+		sv.finish(r.b)
+	}
+}
+
+// start sends the requests for a batch of inbound messages at once, without waiting for
+// the replies. Once all replies are in, or the timeout passed, release is called with the
+// batch, holding for each message the error to reject it with, or nil if it may be stored.
+// Batches are released in the order they were started. Messages that only trace are not
+// validated.
+func (sv *streamValidator) start(mset *stream, c *client, ims []*inMsg, release func(*validationBatch)) {
+	b := &validationBatch{ims: ims, errs: make([]*ApiError, len(ims)), tokens: make([]string, len(ims)), release: release}
+	err := sv.subscribe(mset)
+	if err != nil {
+		mset.srv.Warnf("Failed to subscribe for validation replies of '%s > %s': %v", mset.acc.Name, mset.name(), err)
+	}
+
+	sv.mu.Lock()
+	sv.batches = append(sv.batches, b)
+	if err != nil {
+		if !sv.cfg.Bypass {
+			for i := range b.errs {
+				b.errs[i] = NewJSStreamValidationTimeoutError()
+			}
+		}
+		sv.finish(b)
+		sv.mu.Unlock()
+		return
+	}
+	for i, im := range ims {
+		if im.mt != nil && im.mt.traceOnly() {
+			continue
+		}
+		sv.seq++
+		b.tokens[i] = strconv.FormatUint(sv.seq, 10)
+		sv.pending[b.tokens[i]] = validationReply{b, i}
+		b.left++
+	}
+	if b.left == 0 {
+		sv.finish(b)
+		sv.mu.Unlock()
+		return
+	}
+	b.timer = time.AfterFunc(sv.timeout(), func() { sv.expire(b) })
+	sv.mu.Unlock()
+
+	name := mset.name()
+	for i, im := range ims {
+		if b.tokens[i] == _EMPTY_ {
+			continue
+		}
+		hdr := genHeader(im.hdr, JSStream, name)
+		hdr = genHeader(hdr, JSSubject, im.subj)
+		msg := im.msg
+		if sv.cfg.HeadersOnly {
+			hdr = genHeader(hdr, JSMsgSize, strconv.Itoa(len(im.msg)))
+			msg = nil
+		}
+		sendValidationRequest(c, sv.cfg.Subject, sv.pre+b.tokens[i], hdr, msg)
+	}
+	c.flushClients(0)
+}
+
+// Times out the messages of the batch that did not get a reply yet.
+func (sv *streamValidator) expire(b *validationBatch) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if b.done {
+		return
+	}
+	for i, token := range b.tokens {
+		if _, ok := sv.pending[token]; !ok {
+			continue
+		}
+		delete(sv.pending, token)
+		if !sv.cfg.Bypass {
+			b.errs[i] = NewJSStreamValidationTimeoutError()
+		}
+	}
+	sv.finish(b)
+}
+
+// Marks the batch done, and releases the batches that are done in order.
+// Lock should be held.
+func (sv *streamValidator) finish(b *validationBatch) {
+	b.done = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	for len(sv.batches) > 0 && sv.batches[0].done {
+		nb := sv.batches[0]
+		sv.batches[0] = nil
+		sv.batches = sv.batches[1:]
+		nb.release(nb)
+	}
+}
+
+// validate has a batch of messages validated and waits for the replies. It returns for
+// each message the error to reject it with, or nil if it may be stored. If the stream
+// stops while waiting, all messages are rejected.
+func (sv *streamValidator) validate(mset *stream, c *client, ims []*inMsg, qch chan struct{}) []*ApiError {
+	ch := make(chan *validationBatch, 1)
+	sv.start(mset, c, ims, func(b *validationBatch) { ch <- b })
+	select {
+	case b := <-ch:
+		return b.errs
+	case <-qch:
+		errs := make([]*ApiError, len(ims))
+		for i := range errs {
+			errs[i] = NewJSStreamValidationRejectedError(errStreamClosed)
+		}
+		return errs
+	}
+}
+
+// Publishes a validation request from the client of the stream loop.
+func sendValidationRequest(c *client, subject, reply string, hdr, msg []byte) {
+	c.pa.subject, c.pa.reply, c.pa.deliver = []byte(subject), []byte(reply), nil
+	c.pa.hdr = len(hdr)
+	c.pa.hdb = []byte(strconv.Itoa(c.pa.hdr))
+	c.pa.size = len(hdr) + len(msg)
+	c.pa.szb = []byte(strconv.Itoa(c.pa.size))
+
+	b := make([]byte, 0, c.pa.size+LEN_CR_LF)
+	b = append(b, hdr...)
+	b = append(b, msg...)
+	b = append(b, _CRLF_...)
+	c.processInboundClientMsg(b)
+	c.pa.subject, c.pa.reply, c.pa.szb, c.pa.hdb = nil, nil, nil, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion  = "us-east-1"
+	s3RequestTimeout = 30 * time.Second
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+)
+
+// Tier store that keeps the blocks in a bucket of an S3 compatible object store.
+// Requests use path style addressing and are signed with AWS signature version 4
+// when credentials are configured, otherwise they are sent anonymously.
+type s3TierStore struct {
+	endpoint string
+	region   string
+	bucket   string
+	prefix   string
+	akey     string
+	skey     string
+	hc       *http.Client
+}
+
+func newS3TierStore(opts JSTierOpts) *s3TierStore {
+	region := opts.Region
+	if region == _EMPTY_ {
+		region = s3DefaultRegion
+	}
+	return &s3TierStore{
+		endpoint: strings.TrimSuffix(opts.Endpoint, "/"),
+		region:   region,
+		bucket:   opts.Bucket,
+		prefix:   strings.Trim(opts.Prefix, "/"),
+		akey:     opts.AccessKey,
+		skey:     opts.SecretKey,
+		hc:       &http.Client{Timeout: s3RequestTimeout},
+	}
+}
+
+// Put stores data under key.
+func (t *s3TierStore) Put(key string, data []byte) error {
+	_, err := t.do(http.MethodPut, key, data)
+	return err
+}
+
+// Get returns the data stored under key.
+func (t *s3TierStore) Get(key string) ([]byte, error) {
+	return t.do(http.MethodGet, key, nil)
+}
+
+// Delete removes the data stored under key. Deleting a missing key is not an error.
+func (t *s3TierStore) Delete(key string) error {
+	if _, err := t.do(http.MethodDelete, key, nil); err != nil && err != errTierNotFound {
+		return err
+	}
+	return nil
+}
+
+func (t *s3TierStore) do(method, key string, body []byte) ([]byte, error) {
+	if t.prefix != _EMPTY_ {
+		key = t.prefix + "/" + key
+	}
+	path := "/" + s3EscapePath(t.bucket) + "/" + s3EscapePath(key)
+	req, err := http.NewRequest(method, t.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	t.sign(req, path, body, time.Now().UTC())
+
+	resp, err := t.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	rbody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errTierNotFound
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("tier store %s %q failed with status %d", method, key, resp.StatusCode)
+	}
+	return rbody, nil
+}
+
+// Signs the request with AWS signature version 4.
+func (t *s3TierStore) sign(req *http.Request, path string, body []byte, now time.Time) {
+	phash := sha256.Sum256(body)
+	payload := hex.EncodeToString(phash[:])
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+	if t.akey == _EMPTY_ {
+		return
+	}
+
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	creq := strings.Join([]string{
+		req.Method,
+		path,
+		_EMPTY_,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + amzDate,
+		_EMPTY_,
+		signed,
+		payload,
+	}, "\n")
+	chash := sha256.Sum256([]byte(creq))
+	scope := strings.Join([]string{amzDate[:8], t.region, "s3", "aws4_request"}, "/")
+	sts := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(chash[:])}, "\n")
+
+	key := []byte("AWS4" + t.skey)
+	for _, v := range []string{amzDate[:8], t.region, "s3", "aws4_request"} {
+		key = s3HMAC(key, v)
+	}
+	sig := hex.EncodeToString(s3HMAC(key, sts))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, t.akey, scope, signed, sig))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Escapes the path like S3 expects, all but the unreserved characters and slashes.
+func s3EscapePath(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}